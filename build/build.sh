@@ -91,6 +91,7 @@ function build() {
 	fi
 	cp $ROOT/configs/api.template.yaml $DIST/configs/
 	cp $ROOT/configs/db.template.yaml $DIST/configs/
+	cp $ROOT/configs/master.template.key $DIST/configs/
 	cp -R $ROOT/deploy $DIST/
 	rm -f $dist/deploy/.gitignore
 	cp -R $ROOT/installers $DIST/
@@ -116,6 +117,7 @@ function build() {
 
 	# building api node
 	env GOOS=$OS GOARCH=$ARCH go build -tags $TAG --ldflags="-s -w" -o $DIST/bin/edge-api $ROOT/../cmd/edge-api/main.go
+	env GOOS=$OS GOARCH=$ARCH go build -tags $TAG --ldflags="-s -w" -o $DIST/bin/edge-api-tool $ROOT/../cmd/edge-api-tool/main.go
 
 	# delete hidden files
 	find $DIST -name ".DS_Store" -delete
@@ -0,0 +1,178 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+// 需要访问数据库的一次性命令
+// 这些命令不能放在 edge-api 中，因为 edge-api 引用了后台任务，初始化数据库时会同时启动所有后台任务和Leader竞选
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/acme"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models/dns"
+	"github.com/TeaOSLab/EdgeAPI/internal/secrets"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/iwind/TeaGo/Tea"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	"os"
+)
+
+const processName = "edge-api-tool"
+
+func main() {
+	if !Tea.IsTesting() {
+		Tea.Env = "prod"
+	}
+
+	var usage = "Usage: " + processName + " [rollup|restore-access-logs|secrets]"
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		return
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "rollup":
+		// 使用历史访问日志重新生成汇总数据：edge-api-tool rollup DAY_FROM [DAY_TO]
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: " + processName + " rollup DAY_FROM [DAY_TO]")
+			return
+		}
+		var dayFrom = os.Args[2]
+		var dayTo = dayFrom
+		if len(os.Args) > 3 {
+			dayTo = os.Args[3]
+		}
+		err = backfillAccessLogRollups(dayFrom, dayTo)
+	case "restore-access-logs":
+		// 从归档中恢复某一天的访问日志：edge-api-tool restore-access-logs DAY [DB_NODE_ID]
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: " + processName + " restore-access-logs DAY [DB_NODE_ID]")
+			return
+		}
+		var day = os.Args[2]
+		var dbNodeId int64 = -1
+		if len(os.Args) > 3 {
+			dbNodeId = types.Int64(os.Args[3])
+		}
+		err = restoreAccessLogs(day, dbNodeId)
+	case "secrets":
+		// 生成主密钥：edge-api-tool secrets generate-key KEY_ID
+		// 使用当前主密钥重新加密所有敏感数据：edge-api-tool secrets migrate
+		// 轮换主密钥时先把新密钥加到主密钥文件第一行并重启所有API节点，再执行migrate，最后删除旧密钥
+		var secretsUsage = "Usage: " + processName + " secrets [generate-key KEY_ID|migrate]"
+		if len(os.Args) < 3 {
+			fmt.Println(secretsUsage)
+			return
+		}
+		switch os.Args[2] {
+		case "generate-key":
+			if len(os.Args) < 4 {
+				fmt.Println(secretsUsage)
+				return
+			}
+			line, err := secrets.GenerateKeyLine(os.Args[3])
+			if err != nil {
+				fmt.Println("ERROR: " + err.Error())
+				return
+			}
+			fmt.Println(line)
+			return
+		case "migrate":
+			err = migrateSecrets()
+		default:
+			fmt.Println(secretsUsage)
+			return
+		}
+	default:
+		fmt.Println(usage)
+		return
+	}
+
+	if err != nil {
+		fmt.Println("ERROR: " + err.Error())
+		os.Exit(1)
+	}
+	fmt.Println("finished!")
+}
+
+// 初始化数据库
+// 此命令没有引用后台任务，所以 NotifyReady() 只会初始化数据访问对象
+func initDB() error {
+	dbs.NotifyReady()
+	return models.NewDBNodeInitializer().LoadOnce()
+}
+
+// 重新生成一段日期的访问日志汇总数据
+func backfillAccessLogRollups(dayFrom string, dayTo string) error {
+	days, err := utils.RangeDays(dayFrom, dayTo)
+	if err != nil {
+		return err
+	}
+
+	err = initDB()
+	if err != nil {
+		return err
+	}
+
+	for _, day := range days {
+		fmt.Println("backfill " + day + " ...")
+		count, err := models.SharedHTTPAccessLogRollupDAO.BackfillDay(nil, day, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println("  " + types.String(count) + " access logs")
+	}
+	return nil
+}
+
+// 从归档中恢复某一天的访问日志
+func restoreAccessLogs(day string, dbNodeId int64) error {
+	err := initDB()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("restore " + day + " ...")
+	return models.SharedHTTPAccessLogArchiveDAO.RestoreDay(nil, day, dbNodeId, func(accessLogArchive *models.HTTPAccessLogArchive, countRows int64) {
+		fmt.Println("  db node " + types.String(accessLogArchive.DbNodeId) + ": " + types.String(countRows) + " access logs")
+	})
+}
+
+// 使用当前主密钥重新加密所有敏感数据
+func migrateSecrets() error {
+	keyring, err := secrets.SharedKeyring()
+	if err != nil {
+		return err
+	}
+	if keyring.IsEmpty() {
+		return errors.New("no master key found, please set '" + secrets.EnvMasterKeys + "' or create 'configs/" + secrets.MasterKeyFile + "'")
+	}
+
+	err = initDB()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range []struct {
+		name string
+		f    func(tx *dbs.Tx) (int64, error)
+	}{
+		{"node grants", models.SharedNodeGrantDAO.ReencryptSecrets},
+		{"db nodes", models.SharedDBNodeDAO.ReencryptSecrets},
+		{"ssl certs", models.SharedSSLCertDAO.ReencryptSecrets},
+		{"acme users", acme.SharedACMEUserDAO.ReencryptSecrets},
+		{"dns providers", dns.SharedDNSProviderDAO.ReencryptSecrets},
+		{"webhooks", models.SharedWebhookDAO.ReencryptSecrets},
+	} {
+		fmt.Println("re-encrypt " + migration.name + " ...")
+		count, err := migration.f(nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println("  " + types.String(count) + " values")
+	}
+	return nil
+}
@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"github.com/TeaOSLab/EdgeAPI/internal/apps"
 	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
+	"github.com/TeaOSLab/EdgeAPI/internal/installers"
 	"github.com/TeaOSLab/EdgeAPI/internal/nodes"
 	"github.com/TeaOSLab/EdgeAPI/internal/setup"
 	_ "github.com/TeaOSLab/EdgeAPI/internal/tasks"
 	"github.com/iwind/TeaGo/Tea"
 	_ "github.com/iwind/TeaGo/bootstrap"
 	"github.com/iwind/TeaGo/maps"
+	"io/ioutil"
 	"log"
 	"os"
 )
@@ -22,7 +24,7 @@ func main() {
 	app := apps.NewAppCmd()
 	app.Version(teaconst.Version)
 	app.Product(teaconst.ProductName)
-	app.Usage(teaconst.ProcessName + " [start|stop|restart|setup|upgrade|service|daemon]")
+	app.Usage(teaconst.ProcessName + " [start|stop|restart|setup|upgrade|service|daemon|deploy]")
 	app.On("setup", func() {
 		setupCmd := setup.NewSetupFromCmd()
 		err := setupCmd.Run()
@@ -57,6 +59,56 @@ func main() {
 		}
 		fmt.Println("finished!")
 	})
+	app.On("deploy", func() {
+		// 生成安装包签名密钥：edge-api deploy generate-key KEY_ID
+		// 离线签名安装包：edge-api deploy sign PRIVATE_KEY_FILE ROLE OS ARCH VERSION FILE
+		// 导入签名的安装包到安装包仓库：edge-api deploy import KEY_ID SIGNATURE ROLE OS ARCH VERSION FILE
+		var usage = "Usage: " + teaconst.ProcessName + " deploy [generate-key KEY_ID|sign PRIVATE_KEY_FILE ROLE OS ARCH VERSION FILE|import KEY_ID SIGNATURE ROLE OS ARCH VERSION FILE]"
+		if len(os.Args) < 3 {
+			fmt.Println(usage)
+			return
+		}
+		switch os.Args[2] {
+		case "generate-key":
+			if len(os.Args) < 4 {
+				fmt.Println(usage)
+				return
+			}
+			publicLine, privateKey, err := installers.GenerateDeployKey(os.Args[3])
+			if err != nil {
+				fmt.Println("ERROR: " + err.Error())
+				return
+			}
+			fmt.Println("public key (add to 'configs/" + installers.DeployKeysFile + "'):")
+			fmt.Println(publicLine)
+			fmt.Println("private key (keep it offline):")
+			fmt.Println(privateKey)
+		case "sign":
+			if len(os.Args) < 9 {
+				fmt.Println(usage)
+				return
+			}
+			signature, err := signDeployPackage(os.Args[3], os.Args[4], os.Args[5], os.Args[6], os.Args[7], os.Args[8])
+			if err != nil {
+				fmt.Println("ERROR: " + err.Error())
+				return
+			}
+			fmt.Println(signature)
+		case "import":
+			if len(os.Args) < 10 {
+				fmt.Println(usage)
+				return
+			}
+			err := importDeployPackage(os.Args[3], os.Args[4], os.Args[5], os.Args[6], os.Args[7], os.Args[8], os.Args[9])
+			if err != nil {
+				fmt.Println("ERROR: " + err.Error())
+				return
+			}
+			fmt.Println("finished!")
+		default:
+			fmt.Println(usage)
+		}
+	})
 	app.On("daemon", func() {
 		nodes.NewAPINode().Daemon()
 	})
@@ -72,3 +124,33 @@ func main() {
 		nodes.NewAPINode().Start()
 	})
 }
+
+// 使用私钥离线签名安装包
+func signDeployPackage(privateKeyFile string, role string, osName string, arch string, version string, path string) (string, error) {
+	privateKey, err := ioutil.ReadFile(privateKeyFile)
+	if err != nil {
+		return "", err
+	}
+	sum, size, err := (&installers.DeployFile{Path: path}).SHA256()
+	if err != nil {
+		return "", err
+	}
+	return installers.SignDeployMessage(string(privateKey), installers.DeployPackageSignMessage(role, osName, arch, version, sum, size))
+}
+
+// 导入签名的安装包，用于无法通过管理平台上传文件的环境
+func importDeployPackage(keyId string, signature string, role string, osName string, arch string, version string, path string) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+	pkg, err := installers.SharedDeployManager.ImportPackage(role, osName, arch, version, fp, keyId, signature)
+	if err != nil {
+		return err
+	}
+	fmt.Println("imported " + pkg.Filename + ", sha256: " + pkg.SHA256)
+	return nil
+}
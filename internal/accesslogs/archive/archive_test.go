@@ -0,0 +1,78 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package archive
+
+import (
+	"encoding/json"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/objectstorage"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLocalStorage_WriteAndRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	var storage = objectstorage.NewLocalStorage(dir)
+	var writer = NewWriter(storage, "edgeHTTPAccessLogs_20211010", "20211010", 2, []string{"id", "requestId"}, 3)
+	for i := 1; i <= 7; i++ {
+		err = writer.Write(uint64(i), map[string]interface{}{"id": i, "requestId": "r" + string(rune('0'+i))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	manifest, err := writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 3 || manifest.CountRows != 7 {
+		t.Fatal("unexpected manifest:", len(manifest.Files), manifest.CountRows)
+	}
+	if manifest.Files[2].MinId != 7 || manifest.Files[2].MaxId != 7 {
+		t.Fatal("unexpected id range:", manifest.Files[2].MinId, manifest.Files[2].MaxId)
+	}
+
+	manifest, err = ReadManifest(storage, "20211010", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids = []int{}
+	err = ReadFiles(storage, manifest, func(line []byte) error {
+		var row = map[string]interface{}{}
+		err := json.Unmarshal(line, &row)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, int(row["id"].(float64)))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 7 || ids[0] != 1 || ids[6] != 7 {
+		t.Fatal("unexpected rows:", ids)
+	}
+
+	// 文件被修改
+	err = ioutil.WriteFile(dir+"/"+manifest.Files[0].Key, []byte("broken"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ReadFiles(storage, manifest, func(line []byte) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("broken file should fail")
+	}
+
+	_, err = ReadManifest(storage, "20211011", 2)
+	if err != ErrNotFound {
+		t.Fatal("expect not found, but got:", err)
+	}
+}
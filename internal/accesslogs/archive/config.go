@@ -0,0 +1,99 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package archive
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/objectstorage"
+	"strings"
+)
+
+// SettingCode 访问日志归档配置在系统设置中的代号
+const SettingCode = "httpAccessLogArchiveConfig"
+
+// StorageType 归档存储类型
+type StorageType = string
+
+const (
+	StorageTypeLocal StorageType = "local" // 本地目录
+	StorageTypeS3    StorageType = "s3"    // S3兼容的对象存储
+)
+
+const (
+	DefaultRowsPerFile      = 100000 // 每个归档文件默认最多包含的行数
+	DefaultRestoredKeepDays = 7      // 恢复的日志默认保留天数
+)
+
+// Config 访问日志归档配置
+// 启用后，自动清理访问日志时会先将日志表归档，归档成功后才会删除
+type Config struct {
+	IsOn             bool         `json:"isOn"`             // 是否启用
+	StorageType      StorageType  `json:"storageType"`      // 存储类型
+	Local            *LocalConfig `json:"local"`            // 本地目录设置
+	S3               *S3Config    `json:"s3"`               // S3设置
+	RowsPerFile      int          `json:"rowsPerFile"`      // 每个文件最多包含的行数
+	RestoredKeepDays int          `json:"restoredKeepDays"` // 恢复的日志保留天数，在此期间不会被自动清理
+}
+
+// NewConfig 获取新对象
+func NewConfig() *Config {
+	return &Config{}
+}
+
+// LocalConfig 本地目录设置
+type LocalConfig struct {
+	Dir string `json:"dir"` // 目录
+}
+
+// S3Config S3兼容的对象存储设置
+type S3Config = objectstorage.S3Config
+
+// Init 校验并初始化
+func (this *Config) Init() error {
+	if this.RowsPerFile <= 0 {
+		this.RowsPerFile = DefaultRowsPerFile
+	}
+	if this.RestoredKeepDays <= 0 {
+		this.RestoredKeepDays = DefaultRestoredKeepDays
+	}
+
+	switch this.StorageType {
+	case StorageTypeLocal:
+		if this.Local == nil || len(strings.TrimSpace(this.Local.Dir)) == 0 {
+			return errors.New("'local.dir' should not be empty")
+		}
+	case StorageTypeS3:
+		if this.S3 == nil {
+			return errors.New("'s3' should not be empty")
+		}
+		if len(this.S3.Endpoint) == 0 {
+			return errors.New("'s3.endpoint' should not be empty")
+		}
+		if len(this.S3.Bucket) == 0 {
+			return errors.New("'s3.bucket' should not be empty")
+		}
+		if len(this.S3.AccessKeyId) == 0 || len(this.S3.AccessKeySecret) == 0 {
+			return errors.New("'s3.accessKeyId' and 's3.accessKeySecret' should not be empty")
+		}
+	default:
+		return errors.New("invalid storage type '" + this.StorageType + "'")
+	}
+	return nil
+}
+
+// NewStorage 根据配置获取存储
+func (this *Config) NewStorage() (Storage, error) {
+	switch this.StorageType {
+	case StorageTypeLocal:
+		if this.Local == nil {
+			return nil, errors.New("'local' should not be empty")
+		}
+		return objectstorage.NewLocalStorage(this.Local.Dir), nil
+	case StorageTypeS3:
+		if this.S3 == nil {
+			return nil, errors.New("'s3' should not be empty")
+		}
+		return objectstorage.NewS3Storage(this.S3), nil
+	}
+	return nil, errors.New("invalid storage type '" + this.StorageType + "'")
+}
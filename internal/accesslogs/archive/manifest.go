@@ -0,0 +1,84 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+)
+
+// ManifestVersion 清单格式版本
+const ManifestVersion = 1
+
+// ManifestFormatNDJSON 每行一个JSON对象，使用gzip压缩
+const ManifestFormatNDJSON = "ndjson.gz"
+
+// Manifest 归档清单，描述某一天某个日志表的所有归档文件
+type Manifest struct {
+	Version   int             `json:"version"`   // 清单格式版本
+	Table     string          `json:"table"`     // 原始表名
+	Day       string          `json:"day"`       // 日期，格式为YYYYMMDD
+	DBNodeId  int64           `json:"dbNodeId"`  // 日志数据库节点ID，0表示默认数据库
+	Format    string          `json:"format"`    // 文件格式
+	Columns   []string        `json:"columns"`   // 每行包含的字段
+	CountRows int64           `json:"countRows"` // 总行数
+	Size      int64           `json:"size"`      // 所有文件的总尺寸
+	Files     []*ManifestFile `json:"files"`     // 文件列表
+	CreatedAt int64           `json:"createdAt"` // 创建时间
+}
+
+// ManifestFile 归档文件
+type ManifestFile struct {
+	Key       string `json:"key"`       // 对象名
+	CountRows int64  `json:"countRows"` // 行数
+	Size      int64  `json:"size"`      // 尺寸
+	SHA256    string `json:"sha256"`    // 文件内容的SHA256
+	MinId     uint64 `json:"minId"`     // 最小ID
+	MaxId     uint64 `json:"maxId"`     // 最大ID
+}
+
+var dayReg = regexp.MustCompile(`^\d{8}$`)
+
+// DayPrefix 某一天某个日志数据库节点归档文件的对象名前缀
+func DayPrefix(day string, dbNodeId int64) string {
+	return "httpAccessLogs/" + day + "/" + strconv.FormatInt(dbNodeId, 10)
+}
+
+// ManifestKey 清单的对象名
+func ManifestKey(day string, dbNodeId int64) string {
+	return DayPrefix(day, dbNodeId) + "/manifest.json"
+}
+
+// ReadManifest 从存储中读取清单
+func ReadManifest(storage Storage, day string, dbNodeId int64) (*Manifest, error) {
+	if !dayReg.MatchString(day) {
+		return nil, errors.New("invalid day '" + day + "', should be YYYYMMDD")
+	}
+	reader, err := storage.Get(ManifestKey(day, dbNodeId))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	var manifest = &Manifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, errors.New("decode manifest failed: " + err.Error())
+	}
+	if manifest.Version != ManifestVersion {
+		return nil, errors.New("unsupported manifest version '" + strconv.Itoa(manifest.Version) + "'")
+	}
+	if manifest.Format != ManifestFormatNDJSON {
+		return nil, errors.New("unsupported manifest format '" + manifest.Format + "'")
+	}
+	return manifest, nil
+}
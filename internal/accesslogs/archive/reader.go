@@ -0,0 +1,76 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// ReadFiles 依次读取清单中的所有文件，每行调用一次callback
+// 文件读完后会检查SHA256，不一致时返回错误
+func ReadFiles(storage Storage, manifest *Manifest, callback func(line []byte) error) error {
+	for _, file := range manifest.Files {
+		err := readFile(storage, file, callback)
+		if err != nil {
+			return errors.New("read '" + file.Key + "' failed: " + err.Error())
+		}
+	}
+	return nil
+}
+
+func readFile(storage Storage, file *ManifestFile, callback func(line []byte) error) error {
+	reader, err := storage.Get(file.Key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	var hash = sha256.New()
+	var teeReader = io.TeeReader(reader, hash)
+	gzReader, err := gzip.NewReader(teeReader)
+	if err != nil {
+		return err
+	}
+
+	var countRows int64 = 0
+	var bufReader = bufio.NewReader(gzReader)
+	for {
+		line, err := bufReader.ReadBytes('\n')
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if len(line) > 0 {
+			countRows++
+			err := callback(line)
+			if err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+
+	// 读取剩余的数据以便计算完整的SHA256
+	_, err = io.Copy(ioutil.Discard, teeReader)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != file.SHA256 {
+		return errors.New("checksum mismatch")
+	}
+	if countRows != file.CountRows {
+		return errors.New("rows mismatch")
+	}
+	return nil
+}
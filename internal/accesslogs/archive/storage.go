@@ -0,0 +1,12 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package archive
+
+import (
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/objectstorage"
+)
+
+var ErrNotFound = objectstorage.ErrNotFound
+
+// Storage 归档存储接口
+type Storage = objectstorage.Storage
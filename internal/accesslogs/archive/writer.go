@@ -0,0 +1,184 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Writer 将日志行写入归档文件
+// 行先写入本地临时文件，达到指定行数后上传到存储；关闭时上传清单
+type Writer struct {
+	storage     Storage
+	manifest    *Manifest
+	rowsPerFile int
+
+	fp        *os.File
+	gzWriter  *gzip.Writer
+	hash      hash.Hash
+	size      int64
+	countRows int64
+	minId     uint64
+	maxId     uint64
+}
+
+// NewWriter 获取新对象
+func NewWriter(storage Storage, table string, day string, dbNodeId int64, columns []string, rowsPerFile int) *Writer {
+	if rowsPerFile <= 0 {
+		rowsPerFile = DefaultRowsPerFile
+	}
+	return &Writer{
+		storage: storage,
+		manifest: &Manifest{
+			Version:  ManifestVersion,
+			Table:    table,
+			Day:      day,
+			DBNodeId: dbNodeId,
+			Format:   ManifestFormatNDJSON,
+			Columns:  columns,
+			Files:    []*ManifestFile{},
+		},
+		rowsPerFile: rowsPerFile,
+	}
+}
+
+// Write 写入一行
+func (this *Writer) Write(id uint64, row interface{}) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	if this.fp == nil {
+		err = this.openFile()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = this.gzWriter.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	if this.countRows == 0 || id < this.minId {
+		this.minId = id
+	}
+	if id > this.maxId {
+		this.maxId = id
+	}
+	this.countRows++
+
+	if this.countRows >= int64(this.rowsPerFile) {
+		return this.uploadFile()
+	}
+	return nil
+}
+
+// Close 上传剩余的行和清单
+func (this *Writer) Close() (*Manifest, error) {
+	if this.fp != nil {
+		err := this.uploadFile()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	this.manifest.CreatedAt = time.Now().Unix()
+	data, err := json.MarshalIndent(this.manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = this.storage.Put(ManifestKey(this.manifest.Day, this.manifest.DBNodeId), bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return this.manifest, nil
+}
+
+// Abort 放弃写入，并删除已经上传的文件
+func (this *Writer) Abort() {
+	this.closeFile()
+	for _, file := range this.manifest.Files {
+		_ = this.storage.Delete(file.Key)
+	}
+	this.manifest.Files = nil
+}
+
+func (this *Writer) openFile() error {
+	fp, err := ioutil.TempFile("", "edge-access-log-archive-*")
+	if err != nil {
+		return err
+	}
+	this.fp = fp
+	this.hash = sha256.New()
+	this.size = 0
+	this.countRows = 0
+	this.minId = 0
+	this.maxId = 0
+	this.gzWriter = gzip.NewWriter(io.MultiWriter(fp, this.hash, &countWriter{size: &this.size}))
+	return nil
+}
+
+func (this *Writer) uploadFile() error {
+	err := this.gzWriter.Close()
+	if err != nil {
+		this.closeFile()
+		return err
+	}
+	_, err = this.fp.Seek(0, io.SeekStart)
+	if err != nil {
+		this.closeFile()
+		return err
+	}
+
+	var key = DayPrefix(this.manifest.Day, this.manifest.DBNodeId) + fmt.Sprintf("/part-%05d.", len(this.manifest.Files)+1) + ManifestFormatNDJSON
+	err = this.storage.Put(key, this.fp, this.size)
+	if err != nil {
+		this.closeFile()
+		return err
+	}
+
+	this.manifest.Files = append(this.manifest.Files, &ManifestFile{
+		Key:       key,
+		CountRows: this.countRows,
+		Size:      this.size,
+		SHA256:    hex.EncodeToString(this.hash.Sum(nil)),
+		MinId:     this.minId,
+		MaxId:     this.maxId,
+	})
+	this.manifest.CountRows += this.countRows
+	this.manifest.Size += this.size
+
+	this.closeFile()
+	return nil
+}
+
+func (this *Writer) closeFile() {
+	if this.fp == nil {
+		return
+	}
+	_ = this.fp.Close()
+	_ = os.Remove(this.fp.Name())
+	this.fp = nil
+	this.gzWriter = nil
+}
+
+// 统计写入的字节数
+type countWriter struct {
+	size *int64
+}
+
+func (this *countWriter) Write(p []byte) (int, error) {
+	*this.size += int64(len(p))
+	return len(p), nil
+}
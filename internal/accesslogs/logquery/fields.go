@@ -0,0 +1,64 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package logquery
+
+import "strings"
+
+// FieldType 字段类型
+type FieldType = int
+
+const (
+	FieldTypeInt    FieldType = iota + 1 // 整数
+	FieldTypeString                      // 字符串
+	FieldTypeIP                          // IP地址
+)
+
+// Field 可查询的字段
+type Field struct {
+	Name    string    // 查询语句中使用的名称
+	Aliases []string  // 别名
+	Type    FieldType // 类型
+	Column  string    // 数据表中对应的字段，为空表示从content中读取
+	JSONKey string    // 在访问日志content中对应的键名
+	IsUpper bool      // 是否将值转换为大写
+}
+
+// AllFields 所有可查询的字段
+var AllFields = []*Field{
+	{Name: "requestId", Type: FieldTypeString, Column: "requestId", JSONKey: "requestId"},
+	{Name: "serverId", Type: FieldTypeInt, Column: "serverId", JSONKey: "serverId"},
+	{Name: "nodeId", Type: FieldTypeInt, Column: "nodeId", JSONKey: "nodeId"},
+	{Name: "status", Aliases: []string{"code"}, Type: FieldTypeInt, Column: "status", JSONKey: "status"},
+	{Name: "firewallPolicyId", Aliases: []string{"policy"}, Type: FieldTypeInt, Column: "firewallPolicyId", JSONKey: "firewallPolicyId"},
+	{Name: "firewallRuleGroupId", Aliases: []string{"ruleGroup"}, Type: FieldTypeInt, Column: "firewallRuleGroupId", JSONKey: "firewallRuleGroupId"},
+	{Name: "firewallRuleSetId", Aliases: []string{"ruleSet"}, Type: FieldTypeInt, Column: "firewallRuleSetId", JSONKey: "firewallRuleSetId"},
+	{Name: "firewallRuleId", Aliases: []string{"rule"}, Type: FieldTypeInt, Column: "firewallRuleId", JSONKey: "firewallRuleId"},
+	{Name: "ip", Aliases: []string{"remoteAddr"}, Type: FieldTypeIP, Column: "remoteAddr", JSONKey: "remoteAddr"},
+	{Name: "host", Aliases: []string{"domain"}, Type: FieldTypeString, Column: "domain", JSONKey: "host"},
+	{Name: "method", Aliases: []string{"requestMethod"}, Type: FieldTypeString, JSONKey: "requestMethod", IsUpper: true},
+	{Name: "uri", Aliases: []string{"requestURI"}, Type: FieldTypeString, JSONKey: "requestURI"},
+	{Name: "path", Aliases: []string{"requestPath"}, Type: FieldTypeString, JSONKey: "requestPath"},
+	{Name: "scheme", Type: FieldTypeString, JSONKey: "scheme"},
+	{Name: "proto", Type: FieldTypeString, JSONKey: "proto"},
+	{Name: "userAgent", Aliases: []string{"ua"}, Type: FieldTypeString, JSONKey: "userAgent"},
+	{Name: "referer", Type: FieldTypeString, JSONKey: "referer"},
+	{Name: "bytesSent", Type: FieldTypeInt, JSONKey: "bytesSent"},
+}
+
+// 关键词搜索时匹配的字段
+var keywordFields = []string{"ip", "host", "uri", "userAgent"}
+
+// FindField 根据名称或别名查找字段，不区分大小写
+func FindField(name string) *Field {
+	for _, field := range AllFields {
+		if strings.EqualFold(field.Name, name) {
+			return field
+		}
+		for _, alias := range field.Aliases {
+			if strings.EqualFold(alias, name) {
+				return field
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package logquery
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	MaxQueryLength = 4096 // 查询语句最大长度
+	MaxTerms       = 64   // 最多条件数
+	MaxDepth       = 16   // 括号最多嵌套层级
+)
+
+// Operator 比较操作符
+type Operator = string
+
+const (
+	OperatorMatch Operator = ":" // 匹配，支持通配符、IP段、数字范围等
+	OperatorEq    Operator = "="
+	OperatorNeq   Operator = "!="
+	OperatorGt    Operator = ">"
+	OperatorGte   Operator = ">="
+	OperatorLt    Operator = "<"
+	OperatorLte   Operator = "<="
+)
+
+var termRegexp = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9_]*)(>=|<=|!=|:|=|>|<)(.*)$`)
+
+// Expr 查询表达式
+type Expr interface {
+	String() string
+}
+
+// AndExpr 且
+type AndExpr struct {
+	Left  Expr
+	Right Expr
+}
+
+func (this *AndExpr) String() string {
+	return "(" + this.Left.String() + " AND " + this.Right.String() + ")"
+}
+
+// OrExpr 或
+type OrExpr struct {
+	Left  Expr
+	Right Expr
+}
+
+func (this *OrExpr) String() string {
+	return "(" + this.Left.String() + " OR " + this.Right.String() + ")"
+}
+
+// NotExpr 非
+type NotExpr struct {
+	Expr Expr
+}
+
+func (this *NotExpr) String() string {
+	return "NOT " + this.Expr.String()
+}
+
+// TermExpr 单个条件
+// Field为nil时表示关键词搜索
+type TermExpr struct {
+	Field    *Field
+	Operator Operator
+	Value    string
+}
+
+func (this *TermExpr) String() string {
+	if this.Field == nil {
+		return strconv.Quote(this.Value)
+	}
+	return this.Field.Name + this.Operator + strconv.Quote(this.Value)
+}
+
+// Parse 分析查询语句
+// 语法示例：status>=500 AND host:*.example.com AND NOT ip:10.0.0.0/8
+// 多个条件之间没有AND或OR时默认为AND；空语句返回nil，表示不限制条件
+func Parse(s string) (Expr, error) {
+	if len(s) > MaxQueryLength {
+		return nil, errors.New("query is too long, max length: " + strconv.Itoa(MaxQueryLength))
+	}
+
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	var parser = &parser{tokens: tokens}
+	expr, err := parser.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if parser.index < len(parser.tokens) {
+		var token = parser.tokens[parser.index]
+		return nil, fmt.Errorf("unexpected '%s' at position %d", token.text, token.pos)
+	}
+	return expr, nil
+}
+
+type tokenKind = int
+
+const (
+	tokenWord tokenKind = iota + 1
+	tokenLParen
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// 分词
+func tokenize(s string) ([]*token, error) {
+	var tokens = []*token{}
+	var runes = []rune(s)
+	var i = 0
+	for i < len(runes) {
+		var r = runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			i++
+		case r == '(':
+			tokens = append(tokens, &token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, &token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		default:
+			var start = i
+			var inQuote = false
+		Loop:
+			for i < len(runes) {
+				r = runes[i]
+				switch {
+				case inQuote && r == '\\':
+					i++
+				case r == '"':
+					inQuote = !inQuote
+				case !inQuote && (r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '(' || r == ')'):
+					break Loop
+				}
+				i++
+			}
+			if inQuote {
+				return nil, fmt.Errorf("unterminated quote at position %d", start)
+			}
+			if i > len(runes) {
+				i = len(runes)
+			}
+
+			var text = string(runes[start:i])
+			var kind = tokenWord
+			switch strings.ToUpper(text) {
+			case "AND":
+				kind = tokenAnd
+			case "OR":
+				kind = tokenOr
+			case "NOT":
+				kind = tokenNot
+			}
+			tokens = append(tokens, &token{kind: kind, text: text, pos: start})
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []*token
+	index  int
+	terms  int
+}
+
+func (this *parser) peek() *token {
+	if this.index < len(this.tokens) {
+		return this.tokens[this.index]
+	}
+	return nil
+}
+
+// or := and ("OR" and)*
+func (this *parser) parseOr(depth int) (Expr, error) {
+	left, err := this.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var token = this.peek()
+		if token == nil || token.kind != tokenOr {
+			return left, nil
+		}
+		this.index++
+		right, err := this.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &OrExpr{Left: left, Right: right}
+	}
+}
+
+// and := not (["AND"] not)*
+func (this *parser) parseAnd(depth int) (Expr, error) {
+	left, err := this.parseNot(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var token = this.peek()
+		if token == nil || token.kind == tokenOr || token.kind == tokenRParen {
+			return left, nil
+		}
+		if token.kind == tokenAnd {
+			this.index++
+		}
+		right, err := this.parseNot(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &AndExpr{Left: left, Right: right}
+	}
+}
+
+// not := "NOT" not | primary
+func (this *parser) parseNot(depth int) (Expr, error) {
+	var token = this.peek()
+	if token != nil && token.kind == tokenNot {
+		this.index++
+		expr, err := this.parseNot(depth)
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Expr: expr}, nil
+	}
+	return this.parsePrimary(depth)
+}
+
+// primary := "(" or ")" | term
+func (this *parser) parsePrimary(depth int) (Expr, error) {
+	var token = this.peek()
+	if token == nil {
+		return nil, errors.New("unexpected end of query")
+	}
+
+	switch token.kind {
+	case tokenLParen:
+		if depth >= MaxDepth {
+			return nil, errors.New("too many nested parentheses, max depth: " + strconv.Itoa(MaxDepth))
+		}
+		this.index++
+		expr, err := this.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		var next = this.peek()
+		if next == nil || next.kind != tokenRParen {
+			return nil, fmt.Errorf("missing ')' for '(' at position %d", token.pos)
+		}
+		this.index++
+		return expr, nil
+	case tokenWord:
+		this.index++
+		this.terms++
+		if this.terms > MaxTerms {
+			return nil, errors.New("too many terms, max: " + strconv.Itoa(MaxTerms))
+		}
+		return parseTerm(token)
+	}
+	return nil, fmt.Errorf("unexpected '%s' at position %d", token.text, token.pos)
+}
+
+// 分析单个条件
+func parseTerm(token *token) (Expr, error) {
+	var text = token.text
+
+	// 关键词
+	if strings.HasPrefix(text, "\"") {
+		value, err := unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keyword at position %d: %w", token.pos, err)
+		}
+		if len(value) == 0 {
+			return nil, fmt.Errorf("empty keyword at position %d", token.pos)
+		}
+		return &TermExpr{Value: value}, nil
+	}
+
+	var matches = termRegexp.FindStringSubmatch(text)
+	if len(matches) == 0 {
+		return &TermExpr{Value: text}, nil
+	}
+
+	var field = FindField(matches[1])
+	if field == nil {
+		return nil, fmt.Errorf("unknown field '%s' at position %d", matches[1], token.pos)
+	}
+	value, err := unquote(matches[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid value of '%s' at position %d: %w", matches[1], token.pos, err)
+	}
+	if len(value) == 0 {
+		return nil, fmt.Errorf("empty value of '%s' at position %d", matches[1], token.pos)
+	}
+
+	var op = matches[2]
+	if field.Type != FieldTypeInt && op != OperatorMatch && op != OperatorEq && op != OperatorNeq {
+		return nil, fmt.Errorf("operator '%s' is not supported by field '%s'", op, field.Name)
+	}
+
+	return &TermExpr{
+		Field:    field,
+		Operator: op,
+		Value:    value,
+	}, nil
+}
+
+// 去除引号
+func unquote(s string) (string, error) {
+	if strings.HasPrefix(s, "\"") {
+		return strconv.Unquote(s)
+	}
+	if strings.Contains(s, "\"") {
+		return "", errors.New("quote should wrap the whole value")
+	}
+	return s, nil
+}
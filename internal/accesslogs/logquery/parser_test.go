@@ -0,0 +1,60 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package logquery
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, testCase := range []struct {
+		query  string
+		result string
+	}{
+		{``, `<nil>`},
+		{`status>=500`, `status>="500"`},
+		{`status>=500 AND host:*.example.com AND NOT ip:10.0.0.0/8`, `((status>="500" AND host:"*.example.com") AND NOT ip:"10.0.0.0/8")`},
+		{`status>=500 host:*.example.com`, `(status>="500" AND host:"*.example.com")`},
+		{`a OR b c`, `("a" OR ("b" AND "c"))`},
+		{`(a OR b) c`, `(("a" OR "b") AND "c")`},
+		{`not (a or b)`, `NOT ("a" OR "b")`},
+		{`uri:"/a b(c)"`, `uri:"/a b(c)"`},
+		{`"hello world"`, `"hello world"`},
+		{`DOMAIN:example.com remoteAddr!=127.0.0.1`, `(host:"example.com" AND ip!="127.0.0.1")`},
+	} {
+		expr, err := Parse(testCase.query)
+		if err != nil {
+			t.Fatal(testCase.query, err)
+		}
+		var result = "<nil>"
+		if expr != nil {
+			result = expr.String()
+		}
+		if result != testCase.result {
+			t.Fatal("'"+testCase.query+"'", "expected:", testCase.result, "got:", result)
+		}
+	}
+}
+
+func TestParse_Error(t *testing.T) {
+	for _, query := range []string{
+		`status>=`,
+		`unknown:1`,
+		`host>a`,
+		`(a OR b`,
+		`a OR b)`,
+		`a AND`,
+		`NOT`,
+		`uri:"abc`,
+		`uri:a"b"`,
+		strings.Repeat("(", MaxDepth+1) + "a" + strings.Repeat(")", MaxDepth+1),
+		strings.Repeat("a ", MaxTerms+1),
+	} {
+		_, err := Parse(query)
+		if err == nil {
+			t.Fatal("'" + query + "' should fail")
+		}
+		t.Log(query, "=>", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package logquery
+
+import (
+	"encoding/json"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+)
+
+// Projection 字段投影，只返回指定的字段
+type Projection struct {
+	keys map[string]bool
+}
+
+// NewProjection 获取新对象
+// fields中可以使用查询语句中的字段名、别名或者访问日志中的原始键名；为空时返回nil，表示返回所有字段
+func NewProjection(fields []string) *Projection {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	var keys = map[string]bool{
+		"requestId": true,
+	}
+	for _, name := range fields {
+		var field = FindField(name)
+		if field != nil {
+			keys[field.JSONKey] = true
+		} else {
+			keys[name] = true
+		}
+	}
+	return &Projection{keys: keys}
+}
+
+// Apply 对访问日志执行投影
+func (this *Projection) Apply(accessLog *pb.HTTPAccessLog) (*pb.HTTPAccessLog, error) {
+	if this == nil {
+		return accessLog, nil
+	}
+
+	data, err := json.Marshal(accessLog)
+	if err != nil {
+		return nil, err
+	}
+	var m = map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, err
+	}
+	for key := range m {
+		if !this.keys[key] {
+			delete(m, key)
+		}
+	}
+	data, err = json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = &pb.HTTPAccessLog{}
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package logquery
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var intRangeRegexp = regexp.MustCompile(`^(\d+)-(\d+)$`)
+var intClassRegexp = regexp.MustCompile(`^(\d+)([xX]+)$`) // 5xx
+
+// SQLBuilder 将查询表达式转换为SQL条件
+// 不同日期的访问日志表结构可能不同，所以每个表需要单独构造
+type SQLBuilder struct {
+	hasRemoteAddr bool
+	hasDomain     bool
+
+	params     map[string]interface{}
+	countParam int
+}
+
+// NewSQLBuilder 获取新对象
+func NewSQLBuilder(hasRemoteAddr bool, hasDomain bool) *SQLBuilder {
+	return &SQLBuilder{
+		hasRemoteAddr: hasRemoteAddr,
+		hasDomain:     hasDomain,
+		params:        map[string]interface{}{},
+	}
+}
+
+// Build 构造SQL条件和对应的参数
+// 参数名以lq开头，以免和其他条件冲突
+func (this *SQLBuilder) Build(expr Expr) (where string, params map[string]interface{}, err error) {
+	if expr == nil {
+		return "", this.params, nil
+	}
+	where, err = this.build(expr)
+	if err != nil {
+		return "", nil, err
+	}
+	return where, this.params, nil
+}
+
+func (this *SQLBuilder) build(expr Expr) (string, error) {
+	switch e := expr.(type) {
+	case *AndExpr:
+		return this.buildBinary(e.Left, e.Right, "AND")
+	case *OrExpr:
+		return this.buildBinary(e.Left, e.Right, "OR")
+	case *NotExpr:
+		s, err := this.build(e.Expr)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + s + ")", nil
+	case *TermExpr:
+		if e.Field == nil {
+			return this.buildKeyword(e.Value), nil
+		}
+		switch e.Field.Type {
+		case FieldTypeInt:
+			return this.buildInt(e)
+		case FieldTypeIP:
+			return this.buildIP(e)
+		default:
+			return this.buildString(e)
+		}
+	}
+	return "", errors.New("unknown expression")
+}
+
+func (this *SQLBuilder) buildBinary(left Expr, right Expr, op string) (string, error) {
+	l, err := this.build(left)
+	if err != nil {
+		return "", err
+	}
+	r, err := this.build(right)
+	if err != nil {
+		return "", err
+	}
+	return "(" + l + " " + op + " " + r + ")", nil
+}
+
+// 关键词，在多个字段中模糊查找
+func (this *SQLBuilder) buildKeyword(keyword string) string {
+	var param = this.param("%" + escapeLike(keyword) + "%")
+	var pieces = []string{}
+	for _, name := range keywordFields {
+		pieces = append(pieces, this.column(FindField(name))+" LIKE "+param)
+	}
+	return "(" + strings.Join(pieces, " OR ") + ")"
+}
+
+// 整数
+func (this *SQLBuilder) buildInt(term *TermExpr) (string, error) {
+	var column = this.column(term.Field)
+
+	if term.Operator == OperatorMatch {
+		// 100-200
+		var matches = intRangeRegexp.FindStringSubmatch(term.Value)
+		if len(matches) > 0 {
+			from, _ := strconv.ParseInt(matches[1], 10, 64)
+			to, _ := strconv.ParseInt(matches[2], 10, 64)
+			if from > to {
+				from, to = to, from
+			}
+			return column + " BETWEEN " + this.param(from) + " AND " + this.param(to), nil
+		}
+
+		// 5xx
+		matches = intClassRegexp.FindStringSubmatch(term.Value)
+		if len(matches) > 0 {
+			var zeros = strings.Repeat("0", len(matches[2]))
+			var nines = strings.Repeat("9", len(matches[2]))
+			from, _ := strconv.ParseInt(matches[1]+zeros, 10, 64)
+			to, _ := strconv.ParseInt(matches[1]+nines, 10, 64)
+			return column + " BETWEEN " + this.param(from) + " AND " + this.param(to), nil
+		}
+	}
+
+	value, err := strconv.ParseInt(term.Value, 10, 64)
+	if err != nil {
+		return "", errors.New("invalid number '" + term.Value + "' for field '" + term.Field.Name + "'")
+	}
+	var op = term.Operator
+	if op == OperatorMatch {
+		op = OperatorEq
+	}
+	return column + op + this.param(value), nil
+}
+
+// 字符串，支持*通配符
+func (this *SQLBuilder) buildString(term *TermExpr) (string, error) {
+	var column = this.column(term.Field)
+	var value = term.Value
+	if term.Field.IsUpper {
+		value = strings.ToUpper(value)
+	}
+
+	var where string
+	if strings.Contains(value, "*") {
+		where = column + " LIKE " + this.param(strings.ReplaceAll(escapeLike(value), "*", "%"))
+	} else {
+		where = column + "=" + this.param(value)
+	}
+	if term.Operator == OperatorNeq {
+		return "NOT (" + where + ")", nil
+	}
+	return where, nil
+}
+
+// IP，支持CIDR（10.0.0.0/8）、范围（10.0.0.1-10.0.0.255）和*通配符
+func (this *SQLBuilder) buildIP(term *TermExpr) (string, error) {
+	var column = this.column(term.Field)
+	var value = term.Value
+
+	var where string
+	switch {
+	case strings.Contains(value, "/"):
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return "", errors.New("invalid CIDR '" + value + "'")
+		}
+		var ip4 = ipNet.IP.To4()
+		if ip4 == nil || len(ipNet.Mask) != net.IPv4len {
+			return "", errors.New("only IPv4 CIDR is supported: '" + value + "'")
+		}
+		var from = binary.BigEndian.Uint32(ip4)
+		var to = from | ^binary.BigEndian.Uint32(ipNet.Mask)
+		where = "INET_ATON(" + column + ") BETWEEN " + this.param(from) + " AND " + this.param(to)
+	case strings.Contains(value, "-"):
+		var pieces = strings.SplitN(value, "-", 2)
+		var fromIP = net.ParseIP(strings.TrimSpace(pieces[0])).To4()
+		var toIP = net.ParseIP(strings.TrimSpace(pieces[1])).To4()
+		if fromIP == nil || toIP == nil {
+			return "", errors.New("invalid IPv4 range '" + value + "'")
+		}
+		var from = binary.BigEndian.Uint32(fromIP)
+		var to = binary.BigEndian.Uint32(toIP)
+		if from > to {
+			from, to = to, from
+		}
+		where = "INET_ATON(" + column + ") BETWEEN " + this.param(from) + " AND " + this.param(to)
+	case strings.Contains(value, "*"):
+		where = column + " LIKE " + this.param(strings.ReplaceAll(escapeLike(value), "*", "%"))
+	default:
+		if net.ParseIP(value) == nil {
+			return "", errors.New("invalid IP '" + value + "'")
+		}
+		where = column + "=" + this.param(value)
+	}
+
+	if term.Operator == OperatorNeq {
+		return "NOT (" + where + ")", nil
+	}
+	return where, nil
+}
+
+// 字段对应的SQL
+func (this *SQLBuilder) column(field *Field) string {
+	var hasColumn = len(field.Column) > 0
+	if field.Column == "remoteAddr" && !this.hasRemoteAddr {
+		hasColumn = false
+	}
+	if field.Column == "domain" && !this.hasDomain {
+		hasColumn = false
+	}
+	if hasColumn {
+		return "`" + field.Column + "`"
+	}
+
+	if field.Type == FieldTypeInt {
+		return "JSON_EXTRACT(content, '$." + field.JSONKey + "')"
+	}
+	return "JSON_UNQUOTE(JSON_EXTRACT(content, '$." + field.JSONKey + "'))"
+}
+
+// 添加参数
+func (this *SQLBuilder) param(value interface{}) string {
+	this.countParam++
+	var name = "lq" + strconv.Itoa(this.countParam)
+	this.params[name] = value
+	return ":" + name
+}
+
+// 转义LIKE中的特殊字符
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "%", "\\%")
+	s = strings.ReplaceAll(s, "_", "\\_")
+	return s
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package logquery
+
+import (
+	"testing"
+)
+
+func TestSQLBuilder_Build(t *testing.T) {
+	expr, err := Parse(`status>=500 AND host:*.example.com AND NOT ip:10.0.0.0/8`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	where, params, err := NewSQLBuilder(true, true).Build(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if where != "((`status`>=:lq1 AND `domain` LIKE :lq2) AND NOT (INET_ATON(`remoteAddr`) BETWEEN :lq3 AND :lq4))" {
+		t.Fatal("unexpected where:", where)
+	}
+	if params["lq1"] != int64(500) || params["lq2"] != "%.example.com" || params["lq3"] != uint32(167772160) || params["lq4"] != uint32(184549375) {
+		t.Fatal("unexpected params:", params)
+	}
+}
+
+func TestSQLBuilder_Build_JSON(t *testing.T) {
+	expr, err := Parse(`host:example.com method:get status:5xx "a_b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	where, params, err := NewSQLBuilder(false, false).Build(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(where)
+	t.Log(params)
+	if params["lq2"] != "GET" || params["lq3"] != int64(500) || params["lq4"] != int64(599) || params["lq5"] != "%a\\_b%" {
+		t.Fatal("unexpected params:", params)
+	}
+}
+
+func TestSQLBuilder_Build_Error(t *testing.T) {
+	for _, query := range []string{
+		`status:abc`,
+		`ip:abc`,
+		`ip:::1/64`,
+		`ip:1.2.3.4-abc`,
+	} {
+		expr, err := Parse(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = NewSQLBuilder(true, true).Build(expr)
+		if err == nil {
+			t.Fatal("'" + query + "' should fail")
+		}
+		t.Log(query, "=>", err)
+	}
+}
@@ -28,3 +28,9 @@ type StorageInterface interface {
 	// Close 关闭
 	Close() error
 }
+
+// RawStorageInterface 可以写入原始数据的日志存储接口
+type RawStorageInterface interface {
+	// WriteRaw 写入原始数据，每一项数据为单独的一行
+	WriteRaw(items [][]byte) error
+}
@@ -13,3 +13,8 @@ import (
 func (this *StorageManager) Write(policyId int64, accessLogs []*pb.HTTPAccessLog) error {
 	return nil
 }
+
+// WriteRaw 写入原始数据
+func (this *StorageManager) WriteRaw(policyId int64, items [][]byte) error {
+	return nil
+}
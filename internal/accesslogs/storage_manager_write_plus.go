@@ -8,6 +8,8 @@ package accesslogs
 import (
 	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
 	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/iwind/TeaGo/types"
 )
 
 // 写入日志
@@ -30,3 +32,25 @@ func (this *StorageManager) Write(policyId int64, accessLogs []*pb.HTTPAccessLog
 
 	return storage.Write(accessLogs)
 }
+
+// WriteRaw 写入原始数据
+// 只有支持写入原始数据的存储策略才能写入，比如syslog、tcp
+func (this *StorageManager) WriteRaw(policyId int64, items [][]byte) error {
+	if !teaconst.IsPlus {
+		return nil
+	}
+
+	this.locker.Lock()
+	storage, ok := this.storageMap[policyId]
+	this.locker.Unlock()
+
+	if !ok || !storage.IsOk() {
+		return errors.New("storage policy '" + types.String(policyId) + "' is not ready")
+	}
+
+	rawStorage, ok := storage.(RawStorageInterface)
+	if !ok {
+		return errors.New("storage policy '" + types.String(policyId) + "' does not support raw data")
+	}
+	return rawStorage.WriteRaw(items)
+}
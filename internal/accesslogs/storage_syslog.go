@@ -60,6 +60,25 @@ func (this *SyslogStorage) Write(accessLogs []*pb.HTTPAccessLog) error {
 		return nil
 	}
 
+	var items = [][]byte{}
+	for _, accessLog := range accessLogs {
+		data, err := this.Marshal(accessLog)
+		if err != nil {
+			logs.Error(err)
+			continue
+		}
+		items = append(items, data)
+	}
+
+	return this.WriteRaw(items)
+}
+
+// WriteRaw 写入原始数据
+func (this *SyslogStorage) WriteRaw(items [][]byte) error {
+	if len(items) == 0 {
+		return nil
+	}
+
 	args := []string{}
 	if len(this.config.Tag) > 0 {
 		args = append(args, "-t", this.config.Tag)
@@ -105,12 +124,7 @@ func (this *SyslogStorage) Write(accessLogs []*pb.HTTPAccessLog) error {
 		return err
 	}
 
-	for _, accessLog := range accessLogs {
-		data, err := this.Marshal(accessLog)
-		if err != nil {
-			logs.Error(err)
-			continue
-		}
+	for _, data := range items {
 		_, err = w.Write(data)
 		if err != nil {
 			logs.Error(err)
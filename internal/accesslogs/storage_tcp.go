@@ -46,6 +46,32 @@ func (this *TCPStorage) Write(accessLogs []*pb.HTTPAccessLog) error {
 		return nil
 	}
 
+	var items = [][]byte{}
+	for _, accessLog := range accessLogs {
+		data, err := this.Marshal(accessLog)
+		if err != nil {
+			logs.Error(err)
+			continue
+		}
+		items = append(items, data)
+	}
+
+	err := this.connect()
+	if err != nil {
+		return err
+	}
+
+	// 写入失败时会关闭连接，下次写入时重新连接
+	_ = this.WriteRaw(items)
+	return nil
+}
+
+// WriteRaw 写入原始数据
+func (this *TCPStorage) WriteRaw(items [][]byte) error {
+	if len(items) == 0 {
+		return nil
+	}
+
 	err := this.connect()
 	if err != nil {
 		return err
@@ -59,21 +85,16 @@ func (this *TCPStorage) Write(accessLogs []*pb.HTTPAccessLog) error {
 	this.writeLocker.Lock()
 	defer this.writeLocker.Unlock()
 
-	for _, accessLog := range accessLogs {
-		data, err := this.Marshal(accessLog)
-		if err != nil {
-			logs.Error(err)
-			continue
-		}
+	for _, data := range items {
 		_, err = conn.Write(data)
 		if err != nil {
 			_ = this.Close()
-			break
+			return err
 		}
 		_, err = conn.Write([]byte("\n"))
 		if err != nil {
 			_ = this.Close()
-			break
+			return err
 		}
 	}
 
@@ -3,6 +3,7 @@ package acme
 import (
 	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/tracing"
 	"github.com/go-acme/lego/v4/certcrypto"
 	"github.com/go-acme/lego/v4/certificate"
 	"github.com/go-acme/lego/v4/lego"
@@ -79,6 +80,7 @@ func (this *Request) runDNS() (certData []byte, keyData []byte, err error) {
 	config.Certificate.KeyType = certcrypto.RSA2048
 	config.CADirURL = this.task.Provider.APIURL
 	config.UserAgent = teaconst.ProductName + "/" + teaconst.Version
+	config.HTTPClient.Transport = tracing.NewHTTPTransport(config.HTTPClient.Transport, "acme")
 
 	client, err := lego.NewClient(config)
 	if err != nil {
@@ -150,6 +152,7 @@ func (this *Request) runHTTP() (certData []byte, keyData []byte, err error) {
 	config.Certificate.KeyType = certcrypto.RSA2048
 	config.CADirURL = this.task.Provider.APIURL
 	config.UserAgent = teaconst.ProductName + "/" + teaconst.Version
+	config.HTTPClient.Transport = tracing.NewHTTPTransport(config.HTTPClient.Transport, "acme")
 
 	client, err := lego.NewClient(config)
 	if err != nil {
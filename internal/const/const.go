@@ -2,7 +2,7 @@ package teaconst
 
 const (
 	//Version = "0.3.6"
-	Version = "0.3.8"
+	Version = "0.3.9"
 
 	ProductName   = "Edge API"
 	ProcessName   = "edge-api"
@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/secrets"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
@@ -66,7 +67,12 @@ func (this *ACMEUserDAO) FindEnabledACMEUser(tx *dbs.Tx, id int64) (*ACMEUser, e
 	if result == nil {
 		return nil, err
 	}
-	return result.(*ACMEUser), err
+	var user = result.(*ACMEUser)
+	err = this.decodeSecrets(user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 // CreateACMEUser 创建用户
@@ -81,7 +87,10 @@ func (this *ACMEUserDAO) CreateACMEUser(tx *dbs.Tx, adminId int64, userId int64,
 	if err != nil {
 		return 0, err
 	}
-	privateKeyText := base64.StdEncoding.EncodeToString(privateKeyData)
+	privateKeyText, err := secrets.EncryptString(base64.StdEncoding.EncodeToString(privateKeyData))
+	if err != nil {
+		return 0, err
+	}
 
 	op := NewACMEUserOperator()
 	op.AdminId = adminId
@@ -158,6 +167,15 @@ func (this *ACMEUserDAO) ListACMEUsers(tx *dbs.Tx, adminId int64, userId int64,
 		Slice(&result).
 		DescPk().
 		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range result {
+		err = this.decodeSecrets(user)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return
 }
 
@@ -183,6 +201,15 @@ func (this *ACMEUserDAO) FindAllACMEUsers(tx *dbs.Tx, adminId int64, userId int6
 		Slice(&result).
 		DescPk().
 		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range result {
+		err = this.decodeSecrets(user)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return
 }
 
@@ -205,3 +232,47 @@ func (this *ACMEUserDAO) CheckACMEUser(tx *dbs.Tx, acmeUserId int64, adminId int
 		State(ACMEUserStateEnabled).
 		Exist()
 }
+
+// ReencryptSecrets 使用当前主密钥重新加密所有用户的私钥，返回修改的数量
+func (this *ACMEUserDAO) ReencryptSecrets(tx *dbs.Tx) (count int64, err error) {
+	ones, err := this.Query(tx).
+		Result("id", "privateKey").
+		AscPk().
+		FindAll()
+	if err != nil {
+		return 0, err
+	}
+	for _, one := range ones {
+		var user = one.(*ACMEUser)
+		newPrivateKey, changed, err := secrets.ReencryptString(user.PrivateKey)
+		if err != nil {
+			return count, errors.New("re-encrypt acme user '" + types.String(user.Id) + "' private key failed: " + err.Error())
+		}
+		if !changed {
+			continue
+		}
+		// 只有在数据没有被修改时才更新
+		rowsAffected, err := this.Query(tx).
+			Pk(user.Id).
+			Attr("privateKey", user.PrivateKey).
+			Set("privateKey", newPrivateKey).
+			Update()
+		if err != nil {
+			return count, err
+		}
+		if rowsAffected > 0 {
+			count++
+		}
+	}
+	return
+}
+
+// 解密私钥
+func (this *ACMEUserDAO) decodeSecrets(user *ACMEUser) error {
+	privateKey, err := secrets.DecryptString(user.PrivateKey)
+	if err != nil {
+		return errors.New("decrypt acme user '" + types.String(user.Id) + "' private key failed: " + err.Error())
+	}
+	user.PrivateKey = privateKey
+	return nil
+}
@@ -1 +1,17 @@
 package models
+
+import "github.com/iwind/TeaGo/maps"
+
+// AuditMap 用于审计日志的数据，不包含密码
+func (this *Admin) AuditMap() maps.Map {
+	return maps.Map{
+		"id":       this.Id,
+		"username": this.Username,
+		"fullname": this.Fullname,
+		"isOn":     this.IsOn == 1,
+		"isSuper":  this.IsSuper == 1,
+		"canLogin": this.CanLogin == 1,
+		"modules":  this.Modules,
+		"state":    this.State,
+	}
+}
@@ -5,6 +5,7 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
+	"time"
 )
 
 const (
@@ -12,7 +13,16 @@ const (
 	ApiTokenStateDisabled = 0 // 已禁用
 )
 
-var apiTokenCacheMap = map[string]*ApiToken{} // uniqueId => ApiToken
+// ApiTokenCacheSeconds 节点Token的缓存时间
+// 吊销Token时只能清除当前API节点的缓存，其他API节点最多在这么长时间之后失效
+const ApiTokenCacheSeconds = 30
+
+type apiTokenCacheItem struct {
+	token     *ApiToken
+	expiresAt int64
+}
+
+var apiTokenCacheMap = map[string]*apiTokenCacheItem{} // uniqueId => item
 
 type ApiTokenDAO dbs.DAO
 
@@ -66,10 +76,10 @@ func (this *ApiTokenDAO) FindEnabledApiToken(tx *dbs.Tx, id uint32) (*ApiToken,
 // FindEnabledTokenWithNodeCacheable 获取可缓存的节点Token信息
 func (this *ApiTokenDAO) FindEnabledTokenWithNodeCacheable(tx *dbs.Tx, nodeId string) (*ApiToken, error) {
 	SharedCacheLocker.RLock()
-	token, ok := apiTokenCacheMap[nodeId]
-	if ok {
+	item, ok := apiTokenCacheMap[nodeId]
+	if ok && item.expiresAt > time.Now().Unix() {
 		SharedCacheLocker.RUnlock()
-		return token, nil
+		return item.token, nil
 	}
 	SharedCacheLocker.RUnlock()
 	one, err := this.Query(tx).
@@ -79,10 +89,19 @@ func (this *ApiTokenDAO) FindEnabledTokenWithNodeCacheable(tx *dbs.Tx, nodeId st
 	if one != nil {
 		token := one.(*ApiToken)
 		SharedCacheLocker.Lock()
-		apiTokenCacheMap[nodeId] = token
+		apiTokenCacheMap[nodeId] = &apiTokenCacheItem{
+			token:     token,
+			expiresAt: time.Now().Unix() + ApiTokenCacheSeconds,
+		}
 		SharedCacheLocker.Unlock()
 		return token, nil
 	}
+	if err == nil && ok {
+		// 已经被吊销
+		SharedCacheLocker.Lock()
+		delete(apiTokenCacheMap, nodeId)
+		SharedCacheLocker.Unlock()
+	}
 	return nil, err
 }
 
@@ -98,6 +117,27 @@ func (this *ApiTokenDAO) FindEnabledTokenWithNode(tx *dbs.Tx, nodeId string) (*A
 	return nil, err
 }
 
+// RevokeTokenWithNode 吊销节点的Token，节点此后无法再调用API
+// 其他API节点中的缓存会在 ApiTokenCacheSeconds 之后失效
+func (this *ApiTokenDAO) RevokeTokenWithNode(tx *dbs.Tx, nodeId string) error {
+	if len(nodeId) == 0 {
+		return nil
+	}
+	_, err := this.Query(tx).
+		Attr("nodeId", nodeId).
+		Set("state", ApiTokenStateDisabled).
+		Update()
+	if err != nil {
+		return err
+	}
+
+	SharedCacheLocker.Lock()
+	delete(apiTokenCacheMap, nodeId)
+	delete(nodeIdCacheMap, nodeId)
+	SharedCacheLocker.Unlock()
+	return nil
+}
+
 // FindEnabledTokenWithRole 根据角色获取节点
 func (this *ApiTokenDAO) FindEnabledTokenWithRole(tx *dbs.Tx, role string) (*ApiToken, error) {
 	one, err := this.Query(tx).
@@ -4,11 +4,13 @@ import (
 	"encoding/base64"
 	"github.com/TeaOSLab/EdgeAPI/internal/encrypt"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/secrets"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/types"
 	"strings"
+	"time"
 )
 
 const (
@@ -67,7 +69,10 @@ func (this *DBNodeDAO) FindEnabledDBNode(tx *dbs.Tx, id int64) (*DBNode, error)
 		return nil, err
 	}
 	node := result.(*DBNode)
-	node.Password = this.DecodePassword(node.Password)
+	node.Password, err = this.DecodePassword(node.Password)
+	if err != nil {
+		return nil, err
+	}
 	return node, nil
 }
 
@@ -95,8 +100,14 @@ func (this *DBNodeDAO) ListEnabledNodes(tx *dbs.Tx, offset int64, size int64) (r
 		Slice(&result).
 		DescPk().
 		FindAll()
+	if err != nil {
+		return nil, err
+	}
 	for _, node := range result {
-		node.Password = this.DecodePassword(node.Password)
+		node.Password, err = this.DecodePassword(node.Password)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return
 }
@@ -112,9 +123,13 @@ func (this *DBNodeDAO) CreateDBNode(tx *dbs.Tx, isOn bool, name string, descript
 	op.Port = port
 	op.Database = database
 	op.Username = username
-	op.Password = this.EncodePassword(password)
+	encodedPassword, err := this.EncodePassword(password)
+	if err != nil {
+		return 0, err
+	}
+	op.Password = encodedPassword
 	op.Charset = charset
-	err := this.Save(tx, op)
+	err = this.Save(tx, op)
 	if err != nil {
 		return 0, err
 	}
@@ -135,9 +150,13 @@ func (this *DBNodeDAO) UpdateNode(tx *dbs.Tx, nodeId int64, isOn bool, name stri
 	op.Port = port
 	op.Database = database
 	op.Username = username
-	op.Password = this.EncodePassword(password)
+	encodedPassword, err := this.EncodePassword(password)
+	if err != nil {
+		return err
+	}
+	op.Password = encodedPassword
 	op.Charset = charset
-	err := this.Save(tx, op)
+	err = this.Save(tx, op)
 	return err
 }
 
@@ -149,32 +168,104 @@ func (this *DBNodeDAO) FindAllEnabledAndOnDBNodes(tx *dbs.Tx) (result []*DBNode,
 		Slice(&result).
 		DescPk().
 		FindAll()
+	if err != nil {
+		return nil, err
+	}
 	for _, node := range result {
-		node.Password = this.DecodePassword(node.Password)
+		node.Password, err = this.DecodePassword(node.Password)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return
 }
 
 // EncodePassword 加密密码
-func (this *DBNodeDAO) EncodePassword(password string) string {
-	if strings.HasPrefix(password, DBNodePasswordEncodedPrefix) {
-		return password
+// 设置了主密钥时使用主密钥加密，否则使用内置的密钥；主密钥加密失败时返回错误，不会退回到内置的密钥
+func (this *DBNodeDAO) EncodePassword(password string) (string, error) {
+	if strings.HasPrefix(password, DBNodePasswordEncodedPrefix) || secrets.IsEncrypted(password) {
+		return password, nil
+	}
+	keyring, err := secrets.SharedKeyring()
+	if err != nil {
+		return "", errors.New("encrypt db node password failed: " + err.Error())
+	}
+	if !keyring.IsEmpty() {
+		encryptedPassword, err := secrets.EncryptString(password)
+		if err != nil {
+			return "", errors.New("encrypt db node password failed: " + err.Error())
+		}
+		return encryptedPassword, nil
 	}
 	encodedString := base64.StdEncoding.EncodeToString(encrypt.MagicKeyEncode([]byte(password)))
-	return DBNodePasswordEncodedPrefix + encodedString
+	return DBNodePasswordEncodedPrefix + encodedString, nil
 }
 
 // DecodePassword 解密密码
-func (this *DBNodeDAO) DecodePassword(password string) string {
+// 解密失败时返回错误，不能把密文当作密码使用
+func (this *DBNodeDAO) DecodePassword(password string) (string, error) {
+	decodedPassword, err := this.decodePassword(password)
+	if err != nil {
+		return "", errors.New("decrypt db node password failed: " + err.Error())
+	}
+	return decodedPassword, nil
+}
+
+// ReencryptSecrets 使用当前主密钥重新加密所有数据库节点的密码，返回修改的数量
+func (this *DBNodeDAO) ReencryptSecrets(tx *dbs.Tx) (count int64, err error) {
+	if !secrets.IsEnabled() {
+		return 0, nil
+	}
+	ones, err := this.Query(tx).
+		Result("id", "password").
+		AscPk().
+		FindAll()
+	if err != nil {
+		return 0, err
+	}
+	for _, one := range ones {
+		var node = one.(*DBNode)
+		if len(node.Password) == 0 || !secrets.NeedsReencrypt(node.Password) {
+			continue
+		}
+		password, err := this.decodePassword(node.Password)
+		if err != nil {
+			return count, errors.New("decrypt db node '" + types.String(node.Id) + "' password failed: " + err.Error())
+		}
+		newPassword, err := secrets.EncryptString(password)
+		if err != nil {
+			return count, err
+		}
+		// 只有在数据没有被修改时才更新
+		rowsAffected, err := this.Query(tx).
+			Pk(node.Id).
+			Attr("password", node.Password).
+			Set("password", newPassword).
+			Update()
+		if err != nil {
+			return count, err
+		}
+		if rowsAffected > 0 {
+			count++
+		}
+	}
+	return
+}
+
+// 解密密码，兼容使用内置密钥加密的密码
+func (this *DBNodeDAO) decodePassword(password string) (string, error) {
+	if secrets.IsEncrypted(password) {
+		return secrets.DecryptString(password)
+	}
 	if !strings.HasPrefix(password, DBNodePasswordEncodedPrefix) {
-		return password
+		return password, nil
 	}
 	dataString := password[len(DBNodePasswordEncodedPrefix):]
 	data, err := base64.StdEncoding.DecodeString(dataString)
 	if err != nil {
-		return password
+		return password, nil
 	}
-	return string(encrypt.MagicKeyDecode(data))
+	return string(encrypt.MagicKeyDecode(data)), nil
 }
 
 // CheckNodeIsOn 检查节点是否已经启用
@@ -188,3 +279,66 @@ func (this *DBNodeDAO) CheckNodeIsOn(tx *dbs.Tx, nodeId int64) (bool, error) {
 	}
 	return isOn == 1, nil
 }
+
+// UpdateNodeRouting 修改节点的日志路由设置
+// weight 为0时使用默认权重，maxSize 为0时表示不限制容量
+func (this *DBNodeDAO) UpdateNodeRouting(tx *dbs.Tx, nodeId int64, weight int32, maxSize int64) error {
+	if nodeId <= 0 {
+		return errors.New("invalid nodeId")
+	}
+	if weight < 0 {
+		return errors.New("invalid weight")
+	}
+	if maxSize < 0 {
+		return errors.New("invalid maxSize")
+	}
+	_, err := this.Query(tx).
+		Pk(nodeId).
+		Set("weight", weight).
+		Set("maxSize", maxSize).
+		Update()
+	return err
+}
+
+// UpdateNodeDraining 设置节点是否正在排空
+// 正在排空的节点不再写入新的日志，但仍然可以查询其中的日志
+func (this *DBNodeDAO) UpdateNodeDraining(tx *dbs.Tx, nodeId int64, isDraining bool) error {
+	if nodeId <= 0 {
+		return errors.New("invalid nodeId")
+	}
+	_, err := this.Query(tx).
+		Pk(nodeId).
+		Set("isDraining", isDraining).
+		Update()
+	if err != nil {
+		return err
+	}
+
+	// 当前API节点立即生效，其他API节点在下次加载节点时生效
+	updateDBNodeRouteDraining(nodeId, isDraining)
+	return nil
+}
+
+// UpdateNodeHealth 保存节点健康状态
+func (this *DBNodeDAO) UpdateNodeHealth(tx *dbs.Tx, nodeId int64, isHealthy bool, healthError string) error {
+	var errRunes = []rune(healthError)
+	if len(errRunes) > 1000 {
+		healthError = string(errRunes[:1000]) + "..."
+	}
+	_, err := this.Query(tx).
+		Pk(nodeId).
+		Set("isHealthy", isHealthy).
+		Set("healthError", healthError).
+		Set("healthCheckedAt", time.Now().Unix()).
+		Update()
+	return err
+}
+
+// UpdateNodeSize 保存节点已使用的容量
+func (this *DBNodeDAO) UpdateNodeSize(tx *dbs.Tx, nodeId int64, size int64) error {
+	_, err := this.Query(tx).
+		Pk(nodeId).
+		Set("size", size).
+		Update()
+	return err
+}
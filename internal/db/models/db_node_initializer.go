@@ -7,6 +7,7 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/lists"
+	"github.com/iwind/TeaGo/types"
 	timeutil "github.com/iwind/TeaGo/utils/time"
 	"hash/crc32"
 	"regexp"
@@ -36,8 +37,29 @@ var nsAccessLogTableMapping = map[string]bool{}                // tableName_crc(
 
 // HTTPAccessLogDAOWrapper HTTP访问日志DAO
 type HTTPAccessLogDAOWrapper struct {
-	DAO    *HTTPAccessLogDAO
-	NodeId int64
+	DAO       *HTTPAccessLogDAO
+	RollupDAO *HTTPAccessLogRollupDAO // 汇总数据和日志保存在同一个数据库中
+	NodeId    int64
+
+	queue     *HTTPAccessLogQueue
+	queueOnce sync.Once
+}
+
+// Queue 获取写入队列，第一次调用时启动
+func (this *HTTPAccessLogDAOWrapper) Queue() *HTTPAccessLogQueue {
+	this.queueOnce.Do(func() {
+		this.queue = NewHTTPAccessLogQueue(this.DAO, this.RollupDAO, this.NodeId)
+		go this.queue.Start()
+	})
+	return this.queue
+}
+
+// Close 关闭写入队列，并等待队列中的日志写入完成
+func (this *HTTPAccessLogDAOWrapper) Close() {
+	this.queueOnce.Do(func() {}) // 防止关闭之后再启动队列
+	if this.queue != nil {
+		this.queue.Close()
+	}
 }
 
 // NSAccessLogDAOWrapper NS访问日志DAO
@@ -53,33 +75,99 @@ func init() {
 	})
 }
 
-// 获取获取DAO
-func randomHTTPAccessLogDAO() (dao *HTTPAccessLogDAOWrapper) {
+// 没有日志数据库节点时使用的默认DAO
+var defaultHTTPAccessLogDAOWrapper *HTTPAccessLogDAOWrapper
+var defaultHTTPAccessLogDAOOnce = sync.Once{}
+
+func defaultHTTPAccessLogDAO() *HTTPAccessLogDAOWrapper {
+	defaultHTTPAccessLogDAOOnce.Do(func() {
+		defaultHTTPAccessLogDAOWrapper = &HTTPAccessLogDAOWrapper{
+			DAO:       SharedHTTPAccessLogDAO,
+			RollupDAO: SharedHTTPAccessLogRollupDAO,
+			NodeId:    0,
+		}
+	})
+	return defaultHTTPAccessLogDAOWrapper
+}
+
+// 获取所有日志数据库对应的DAO，用于查询
+// 不健康的节点会被跳过；正在排空和已满的节点仍然可以查询
+func allHTTPAccessLogDAOs() []*HTTPAccessLogDAOWrapper {
 	accessLogLocker.RLock()
-	if len(httpAccessLogDAOMapping) == 0 {
-		dao = nil
-	} else {
-		for _, d := range httpAccessLogDAOMapping {
-			dao = d
-			break
+	var daoList = []*HTTPAccessLogDAOWrapper{}
+	var unhealthyDAOList = []*HTTPAccessLogDAOWrapper{}
+	for nodeId, daoWrapper := range httpAccessLogDAOMapping {
+		if isDBNodeHealthy(nodeId) {
+			daoList = append(daoList, daoWrapper)
+		} else {
+			unhealthyDAOList = append(unhealthyDAOList, daoWrapper)
 		}
 	}
 	accessLogLocker.RUnlock()
-	return
+
+	// 所有节点都不健康时仍然尝试查询，以便调用者能得到具体错误
+	if len(daoList) == 0 {
+		daoList = unhealthyDAOList
+	}
+
+	if len(daoList) == 0 {
+		daoList = append(daoList, defaultHTTPAccessLogDAO())
+	}
+	return daoList
 }
 
-func randomNSAccessLogDAO() (dao *NSAccessLogDAOWrapper) {
-	accessLogLocker.RLock()
-	if len(nsAccessLogDAOMapping) == 0 {
-		dao = nil
-	} else {
-		for _, d := range nsAccessLogDAOMapping {
-			dao = d
-			break
+// 获取所有日志数据库对应的汇总数据DAO，用于查询
+// 总是包含默认数据库，以便读取启用日志数据库节点之前的汇总数据
+func allHTTPAccessLogRollupDAOs() []*HTTPAccessLogRollupDAO {
+	var result = []*HTTPAccessLogRollupDAO{SharedHTTPAccessLogRollupDAO}
+	for _, daoWrapper := range allHTTPAccessLogDAOs() {
+		if daoWrapper.RollupDAO != nil && daoWrapper.RollupDAO != SharedHTTPAccessLogRollupDAO {
+			result = append(result, daoWrapper.RollupDAO)
 		}
 	}
+	return result
+}
+
+// 按权重选择一个可写入的DAO，没有可用的节点时返回nil
+func randomHTTPAccessLogDAO() *HTTPAccessLogDAOWrapper {
+	return selectHTTPAccessLogDAO(0)
+}
+
+// 按权重选择一个可写入的DAO，并排除某个节点
+func selectHTTPAccessLogDAO(excludeNodeId int64) *HTTPAccessLogDAOWrapper {
+	accessLogLocker.RLock()
+	var nodeIds = make([]int64, 0, len(httpAccessLogDAOMapping))
+	for nodeId := range httpAccessLogDAOMapping {
+		nodeIds = append(nodeIds, nodeId)
+	}
 	accessLogLocker.RUnlock()
-	return
+
+	var nodeId = selectDBNodeId(nodeIds, excludeNodeId)
+	if nodeId <= 0 {
+		return nil
+	}
+
+	accessLogLocker.RLock()
+	defer accessLogLocker.RUnlock()
+	return httpAccessLogDAOMapping[nodeId]
+}
+
+func randomNSAccessLogDAO() *NSAccessLogDAOWrapper {
+	accessLogLocker.RLock()
+	var nodeIds = make([]int64, 0, len(nsAccessLogDAOMapping))
+	for nodeId := range nsAccessLogDAOMapping {
+		nodeIds = append(nodeIds, nodeId)
+	}
+	accessLogLocker.RUnlock()
+
+	var nodeId = selectDBNodeId(nodeIds, 0)
+	if nodeId <= 0 {
+		return nil
+	}
+
+	accessLogLocker.RLock()
+	defer accessLogLocker.RUnlock()
+	return nsAccessLogDAOMapping[nodeId]
 }
 
 // 检查表格是否存在
@@ -202,6 +290,7 @@ func findHTTPAccessLogTable(db *dbs.DB, day string, force bool) (*httpAccessLogD
 	var definition = &httpAccessLogDefinition{
 		Name:          tableName,
 		HasRemoteAddr: true,
+		HasDomain:     true,
 		Exists:        true,
 	}
 	httpAccessLogTableMapping[cacheKey] = definition
@@ -269,6 +358,14 @@ func (this *DBNodeInitializer) Start() {
 		remotelogs.Error("DB_NODE", err.Error())
 	}
 
+	// 健康检查
+	go func() {
+		ticker := time.NewTicker(DBNodeHealthCheckInterval)
+		for range ticker.C {
+			this.checkHealth()
+		}
+	}()
+
 	// 定时运行
 	ticker := time.NewTicker(60 * time.Second)
 	for range ticker.C {
@@ -279,6 +376,11 @@ func (this *DBNodeInitializer) Start() {
 	}
 }
 
+// LoadOnce 加载一次数据库节点，用于命令行等不需要定时检查的场景
+func (this *DBNodeInitializer) LoadOnce() error {
+	return this.loop()
+}
+
 // 单次运行
 func (this *DBNodeInitializer) loop() error {
 	dbNodes, err := SharedDBNodeDAO.FindAllEnabledAndOnDBNodes(nil)
@@ -294,16 +396,27 @@ func (this *DBNodeInitializer) loop() error {
 	// 关掉老的
 	accessLogLocker.Lock()
 	closingDbs := []*dbs.DB{}
+	closingDAOs := []*HTTPAccessLogDAOWrapper{}
 	for nodeId, db := range accessLogDBMapping {
 		if !lists.ContainsInt64(nodeIds, nodeId) {
 			closingDbs = append(closingDbs, db)
+			daoWrapper, ok := httpAccessLogDAOMapping[nodeId]
+			if ok {
+				closingDAOs = append(closingDAOs, daoWrapper)
+			}
 			delete(accessLogDBMapping, nodeId)
 			delete(httpAccessLogDAOMapping, nodeId)
 			delete(nsAccessLogDAOMapping, nodeId)
+			removeDBNodeRoute(nodeId)
 			remotelogs.Error("DB_NODE", "close db node '"+strconv.FormatInt(nodeId, 10)+"'")
 		}
 	}
 	accessLogLocker.Unlock()
+
+	// 先写入队列中剩余的日志，再关闭数据库
+	for _, daoWrapper := range closingDAOs {
+		daoWrapper.Close()
+	}
 	for _, db := range closingDbs {
 		_ = db.Close()
 	}
@@ -311,6 +424,8 @@ func (this *DBNodeInitializer) loop() error {
 	// 启动新的
 	for _, node := range dbNodes {
 		nodeId := int64(node.Id)
+		updateDBNodeRoute(node)
+
 		accessLogLocker.Lock()
 		db, ok := accessLogDBMapping[nodeId]
 		accessLogLocker.Unlock()
@@ -327,6 +442,12 @@ func (this *DBNodeInitializer) loop() error {
 
 			// 如果有变化则关闭
 			if oldConfig.Dsn != dsn {
+				accessLogLocker.RLock()
+				daoWrapper, ok := httpAccessLogDAOMapping[nodeId]
+				accessLogLocker.RUnlock()
+				if ok {
+					daoWrapper.Close()
+				}
 				_ = db.Close()
 				db = nil
 			}
@@ -377,14 +498,28 @@ func (this *DBNodeInitializer) loop() error {
 					continue
 				}
 
+				// 汇总数据
+				rollupDAO, err := NewHTTPAccessLogRollupDAOWithDB(db, daoObject.DB)
+				if err != nil {
+					remotelogs.Error("DB_NODE", "initialize rollup dao failed: "+err.Error())
+
+					createLogErr := SharedNodeLogDAO.CreateLog(nil, nodeconfigs.NodeRoleDatabase, nodeId, 0, 0, "error", "ACCESS_LOG", "can not create access log rollup table: "+err.Error(), time.Now().Unix())
+					if createLogErr != nil {
+						remotelogs.Error("NODE_LOG", createLogErr.Error())
+					}
+
+					continue
+				}
+
 				accessLogLocker.Lock()
 				accessLogDBMapping[nodeId] = db
 				dao := &HTTPAccessLogDAO{
 					DAOObject: daoObject,
 				}
 				httpAccessLogDAOMapping[nodeId] = &HTTPAccessLogDAOWrapper{
-					DAO:    dao,
-					NodeId: nodeId,
+					DAO:       dao,
+					RollupDAO: rollupDAO,
+					NodeId:    nodeId,
 				}
 				accessLogLocker.Unlock()
 			}
@@ -435,5 +570,77 @@ func (this *DBNodeInitializer) loop() error {
 		}
 	}
 
+	this.refreshStatus()
+
 	return nil
 }
+
+// 检查所有日志数据库的连接
+func (this *DBNodeInitializer) checkHealth() {
+	var wg = &sync.WaitGroup{}
+	for nodeId, db := range this.allDBs() {
+		wg.Add(1)
+		go func(nodeId int64, db *dbs.DB) {
+			defer wg.Done()
+			_, err := db.FindCol(0, "SELECT 1")
+			if err != nil {
+				reportDBNodeFailure(nodeId, err)
+			} else {
+				reportDBNodeSuccess(nodeId)
+			}
+		}(nodeId, db)
+	}
+	wg.Wait()
+}
+
+// 读取并保存所有日志数据库的容量和健康状态
+func (this *DBNodeInitializer) refreshStatus() {
+	for nodeId, db := range this.allDBs() {
+		route, ok := findDBNodeRoute(nodeId)
+		if !ok {
+			continue
+		}
+
+		if route.IsHealthy {
+			size, err := db.FindCol(0, "SELECT IFNULL(SUM(DATA_LENGTH+INDEX_LENGTH), 0) FROM information_schema.`TABLES` WHERE TABLE_SCHEMA=?", db.Name())
+			if err != nil {
+				reportDBNodeFailure(nodeId, err)
+			} else {
+				updateDBNodeRouteSize(nodeId, types.Int64(size))
+				err = SharedDBNodeDAO.UpdateNodeSize(nil, nodeId, types.Int64(size))
+				if err != nil {
+					remotelogs.Error("DB_NODE", "save db node size failed: "+err.Error())
+				}
+			}
+		}
+
+		err := SharedDBNodeDAO.UpdateNodeHealth(nil, nodeId, route.IsHealthy, route.LastError)
+		if err != nil {
+			remotelogs.Error("DB_NODE", "save db node health failed: "+err.Error())
+		}
+	}
+}
+
+func (this *DBNodeInitializer) allDBs() map[int64]*dbs.DB {
+	var result = map[int64]*dbs.DB{}
+	accessLogLocker.RLock()
+	for nodeId, db := range accessLogDBMapping {
+		result[nodeId] = db
+	}
+	accessLogLocker.RUnlock()
+	return result
+}
+
+// 获取日志数据库，dbNodeId为0时表示默认数据库
+func findAccessLogDB(dbNodeId int64) (*dbs.DB, error) {
+	if dbNodeId == 0 {
+		return dbs.Default()
+	}
+	accessLogLocker.RLock()
+	db, ok := accessLogDBMapping[dbNodeId]
+	accessLogLocker.RUnlock()
+	if !ok {
+		return nil, errors.New("db node '" + strconv.FormatInt(dbNodeId, 10) + "' is not available")
+	}
+	return db, nil
+}
@@ -0,0 +1,340 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package models
+
+import (
+	"database/sql/driver"
+	"github.com/1uLang/EdgeCommon/pkg/nodeconfigs"
+	"github.com/TeaOSLab/EdgeAPI/internal/metrics"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/iwind/TeaGo/types"
+	"math/rand"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DBNodeDefaultWeight       = 10 // 未设置权重时使用的默认权重
+	DBNodeUnhealthyFailures   = 3  // 连续失败多少次后认为节点不健康
+	DBNodeHealthySuccesses    = 2  // 不健康的节点连续成功多少次后重新加入
+	DBNodeHealthCheckInterval = 10 * time.Second
+)
+
+// 表示数据库不可用的MySQL错误代号：连接、超时和只读
+var dbNodeUnavailableErrorCodes = map[string]bool{
+	"1040": true, // Too many connections
+	"1053": true, // Server shutdown in progress
+	"1205": true, // Lock wait timeout exceeded
+	"1290": true, // The MySQL server is running with the --read-only option
+	"1317": true, // Query execution was interrupted
+	"1792": true, // Cannot execute statement in a READ ONLY transaction
+	"1836": true, // Running in read-only mode
+	"1927": true, // Connection was killed
+	"2002": true, // Can't connect to local MySQL server
+	"2003": true, // Can't connect to MySQL server
+	"2006": true, // MySQL server has gone away
+	"2013": true, // Lost connection to MySQL server during query
+	"3024": true, // Query execution was interrupted, maximum statement execution time exceeded
+}
+
+// 表示连接已断开的错误信息
+var dbNodeUnavailableErrorStrings = []string{
+	"invalid connection",
+	"bad connection",
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"i/o timeout",
+	"no route to host",
+	"network is unreachable",
+	"unexpected EOF",
+}
+
+var dbNodeErrorCodeReg = regexp.MustCompile(`Error (\d+)`)
+
+func init() {
+	metrics.SharedRegistry.Describe("edge_api_db_node_healthy", "Whether the access log database node is healthy")
+	metrics.SharedRegistry.Describe("edge_api_db_node_writable", "Whether new access logs can be routed to the database node")
+	metrics.SharedRegistry.Describe("edge_api_db_node_size_bytes", "Disk usage of the access log database node")
+	metrics.SharedRegistry.Describe("edge_api_db_node_failovers_total", "Access logs rerouted to another database node after write errors")
+}
+
+// 日志数据库节点的路由状态
+type dbNodeRoute struct {
+	NodeId     int64
+	Weight     int64
+	MaxSize    int64 // 0表示不限制
+	Size       int64
+	IsDraining bool
+	IsHealthy  bool
+	LastError  string
+
+	failures  int
+	successes int
+}
+
+// IsFull 是否已达到最大容量
+func (this *dbNodeRoute) IsFull() bool {
+	return this.MaxSize > 0 && this.Size >= this.MaxSize
+}
+
+// IsWritable 是否可以写入新的日志
+func (this *dbNodeRoute) IsWritable() bool {
+	return this.IsHealthy && !this.IsDraining && !this.IsFull()
+}
+
+func (this *dbNodeRoute) weight() int64 {
+	if this.Weight <= 0 {
+		return DBNodeDefaultWeight
+	}
+	return this.Weight
+}
+
+func (this *dbNodeRoute) updateMetrics() {
+	var label = types.String(this.NodeId)
+	var healthy int64 = 0
+	if this.IsHealthy {
+		healthy = 1
+	}
+	var writable int64 = 0
+	if this.IsWritable() {
+		writable = 1
+	}
+	metrics.SharedRegistry.Gauge("edge_api_db_node_healthy", "db", label).Set(healthy)
+	metrics.SharedRegistry.Gauge("edge_api_db_node_writable", "db", label).Set(writable)
+	metrics.SharedRegistry.Gauge("edge_api_db_node_size_bytes", "db", label).Set(this.Size)
+}
+
+var dbNodeRouteMapping = map[int64]*dbNodeRoute{} // dbNodeId => route
+var dbNodeRouteLocker = &sync.RWMutex{}
+
+// 根据节点设置更新路由，新节点默认为健康
+func updateDBNodeRoute(node *DBNode) {
+	var nodeId = int64(node.Id)
+
+	dbNodeRouteLocker.Lock()
+	route, ok := dbNodeRouteMapping[nodeId]
+	if !ok {
+		route = &dbNodeRoute{
+			NodeId:    nodeId,
+			IsHealthy: true,
+		}
+		dbNodeRouteMapping[nodeId] = route
+	}
+	route.Weight = int64(node.Weight)
+	route.MaxSize = int64(node.MaxSize)
+	route.IsDraining = node.IsDraining == 1
+	route.updateMetrics()
+	dbNodeRouteLocker.Unlock()
+}
+
+// 更新节点是否正在排空
+func updateDBNodeRouteDraining(nodeId int64, isDraining bool) {
+	dbNodeRouteLocker.Lock()
+	route, ok := dbNodeRouteMapping[nodeId]
+	if ok {
+		route.IsDraining = isDraining
+		route.updateMetrics()
+	}
+	dbNodeRouteLocker.Unlock()
+}
+
+// 更新节点已使用的容量
+func updateDBNodeRouteSize(nodeId int64, size int64) {
+	dbNodeRouteLocker.Lock()
+	route, ok := dbNodeRouteMapping[nodeId]
+	if ok {
+		var wasFull = route.IsFull()
+		route.Size = size
+		route.updateMetrics()
+		if !wasFull && route.IsFull() {
+			remotelogs.Warn("DB_NODE", "db node '"+types.String(nodeId)+"' is full, stop writing new access logs to it")
+		}
+	}
+	dbNodeRouteLocker.Unlock()
+}
+
+// 删除节点路由
+func removeDBNodeRoute(nodeId int64) {
+	dbNodeRouteLocker.Lock()
+	delete(dbNodeRouteMapping, nodeId)
+	dbNodeRouteLocker.Unlock()
+}
+
+// 报告节点访问失败，连续失败达到一定次数后节点被移出路由
+// 只在健康状态变化时保存到数据库，其余时候由定时任务保存
+func reportDBNodeFailure(nodeId int64, err error) {
+	if nodeId <= 0 {
+		return
+	}
+
+	dbNodeRouteLocker.Lock()
+	route, ok := dbNodeRouteMapping[nodeId]
+	if !ok {
+		dbNodeRouteLocker.Unlock()
+		return
+	}
+	route.successes = 0
+	route.failures++
+	route.LastError = err.Error()
+	var changed = route.IsHealthy && route.failures >= DBNodeUnhealthyFailures
+	if changed {
+		route.IsHealthy = false
+		route.updateMetrics()
+	}
+	dbNodeRouteLocker.Unlock()
+
+	if !changed {
+		return
+	}
+	remotelogs.Error("DB_NODE", "db node '"+types.String(nodeId)+"' is unhealthy: "+err.Error())
+	createLogErr := SharedNodeLogDAO.CreateLog(nil, nodeconfigs.NodeRoleDatabase, nodeId, 0, 0, "error", "HEALTH_CHECK", "database node is unhealthy, stop routing access logs to it: "+err.Error(), time.Now().Unix())
+	if createLogErr != nil {
+		remotelogs.Error("NODE_LOG", createLogErr.Error())
+	}
+	saveErr := SharedDBNodeDAO.UpdateNodeHealth(nil, nodeId, false, err.Error())
+	if saveErr != nil {
+		remotelogs.Error("DB_NODE", "save health status failed: "+saveErr.Error())
+	}
+}
+
+// 报告节点访问成功，不健康的节点连续成功达到一定次数后重新加入路由
+func reportDBNodeSuccess(nodeId int64) {
+	if nodeId <= 0 {
+		return
+	}
+
+	dbNodeRouteLocker.Lock()
+	route, ok := dbNodeRouteMapping[nodeId]
+	if !ok {
+		dbNodeRouteLocker.Unlock()
+		return
+	}
+	route.failures = 0
+	route.successes++
+	var changed = !route.IsHealthy && route.successes >= DBNodeHealthySuccesses
+	if changed {
+		route.IsHealthy = true
+		route.LastError = ""
+		route.updateMetrics()
+	}
+	dbNodeRouteLocker.Unlock()
+
+	if !changed {
+		return
+	}
+	remotelogs.Println("DB_NODE", "db node '"+types.String(nodeId)+"' is healthy again")
+	createLogErr := SharedNodeLogDAO.CreateLog(nil, nodeconfigs.NodeRoleDatabase, nodeId, 0, 0, "success", "HEALTH_CHECK", "database node is healthy again, resume routing access logs to it", time.Now().Unix())
+	if createLogErr != nil {
+		remotelogs.Error("NODE_LOG", createLogErr.Error())
+	}
+	saveErr := SharedDBNodeDAO.UpdateNodeHealth(nil, nodeId, true, "")
+	if saveErr != nil {
+		remotelogs.Error("DB_NODE", "save health status failed: "+saveErr.Error())
+	}
+}
+
+// 获取节点路由状态的副本
+func findDBNodeRoute(nodeId int64) (route dbNodeRoute, ok bool) {
+	dbNodeRouteLocker.RLock()
+	defer dbNodeRouteLocker.RUnlock()
+	r, ok := dbNodeRouteMapping[nodeId]
+	if ok {
+		route = *r
+	}
+	return
+}
+
+// 判断节点是否健康，没有路由信息的节点认为是健康的
+func isDBNodeHealthy(nodeId int64) bool {
+	dbNodeRouteLocker.RLock()
+	defer dbNodeRouteLocker.RUnlock()
+	route, ok := dbNodeRouteMapping[nodeId]
+	return !ok || route.IsHealthy
+}
+
+// 从候选节点中按权重选择一个可写入的节点，返回0表示没有可用的节点
+// 如果所有节点都已满，则在健康且没有排空的节点中选择，以免日志写入默认数据库
+func selectDBNodeId(nodeIds []int64, excludeNodeId int64) int64 {
+	var writableRoutes = []*dbNodeRoute{}
+	var fullRoutes = []*dbNodeRoute{}
+
+	dbNodeRouteLocker.RLock()
+	for _, nodeId := range nodeIds {
+		if nodeId == excludeNodeId {
+			continue
+		}
+		route, ok := dbNodeRouteMapping[nodeId]
+		if !ok {
+			route = &dbNodeRoute{NodeId: nodeId, IsHealthy: true}
+		}
+		if route.IsWritable() {
+			writableRoutes = append(writableRoutes, route)
+		} else if route.IsHealthy && !route.IsDraining {
+			fullRoutes = append(fullRoutes, route)
+		}
+	}
+
+	var route = weightedSelectDBNodeRoute(writableRoutes)
+	if route == nil {
+		route = weightedSelectDBNodeRoute(fullRoutes)
+	}
+	dbNodeRouteLocker.RUnlock()
+
+	if route == nil {
+		return 0
+	}
+	return route.NodeId
+}
+
+// 按权重随机选择
+func weightedSelectDBNodeRoute(routes []*dbNodeRoute) *dbNodeRoute {
+	if len(routes) == 0 {
+		return nil
+	}
+	if len(routes) == 1 {
+		return routes[0]
+	}
+
+	var total int64 = 0
+	for _, route := range routes {
+		total += route.weight()
+	}
+	var n = rand.Int63n(total)
+	for _, route := range routes {
+		n -= route.weight()
+		if n < 0 {
+			return route
+		}
+	}
+	return routes[len(routes)-1]
+}
+
+// 判断错误是否表示数据库节点不可用
+// 只有连接、超时和只读错误才影响节点的健康状态，数据过长等语句错误换一个节点写入也会失败
+func isDBNodeUnavailableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == driver.ErrBadConn {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	var errString = err.Error()
+	var matches = dbNodeErrorCodeReg.FindStringSubmatch(errString)
+	if len(matches) > 1 {
+		return dbNodeUnavailableErrorCodes[matches[1]]
+	}
+	for _, s := range dbNodeUnavailableErrorStrings {
+		if strings.Contains(errString, s) {
+			return true
+		}
+	}
+	return false
+}
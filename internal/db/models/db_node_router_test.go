@@ -0,0 +1,99 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func TestWeightedSelectDBNodeRoute(t *testing.T) {
+	var routes = []*dbNodeRoute{
+		{NodeId: 1, Weight: 1},
+		{NodeId: 2, Weight: 3},
+		{NodeId: 3}, // 默认权重
+	}
+
+	var counts = map[int64]int{}
+	for i := 0; i < 14000; i++ {
+		counts[weightedSelectDBNodeRoute(routes).NodeId]++
+	}
+	t.Log(counts)
+
+	// 权重比例为 1:3:10
+	if counts[1] < 500 || counts[1] > 1500 {
+		t.Fatal("unexpected count for node 1:", counts[1])
+	}
+	if counts[2] < 2400 || counts[2] > 3600 {
+		t.Fatal("unexpected count for node 2:", counts[2])
+	}
+	if counts[3] < 9000 || counts[3] > 11000 {
+		t.Fatal("unexpected count for node 3:", counts[3])
+	}
+
+	if weightedSelectDBNodeRoute(nil) != nil {
+		t.Fatal("should return nil for empty routes")
+	}
+}
+
+func TestSelectDBNodeId(t *testing.T) {
+	dbNodeRouteLocker.Lock()
+	var oldMapping = dbNodeRouteMapping
+	dbNodeRouteMapping = map[int64]*dbNodeRoute{
+		1: {NodeId: 1, IsHealthy: false},
+		2: {NodeId: 2, IsHealthy: true, IsDraining: true},
+		3: {NodeId: 3, IsHealthy: true, MaxSize: 100, Size: 100},
+		4: {NodeId: 4, IsHealthy: true},
+	}
+	dbNodeRouteLocker.Unlock()
+	defer func() {
+		dbNodeRouteLocker.Lock()
+		dbNodeRouteMapping = oldMapping
+		dbNodeRouteLocker.Unlock()
+	}()
+
+	// 只有节点4可以写入
+	for i := 0; i < 100; i++ {
+		if nodeId := selectDBNodeId([]int64{1, 2, 3, 4}, 0); nodeId != 4 {
+			t.Fatal("expect node 4, but got:", nodeId)
+		}
+	}
+
+	// 排除节点4后使用已满的节点，而不是不健康或正在排空的节点
+	if nodeId := selectDBNodeId([]int64{1, 2, 3, 4}, 4); nodeId != 3 {
+		t.Fatal("expect node 3, but got:", nodeId)
+	}
+
+	// 没有可用的节点
+	if nodeId := selectDBNodeId([]int64{1, 2}, 0); nodeId != 0 {
+		t.Fatal("expect no node, but got:", nodeId)
+	}
+
+	// 没有路由信息的节点认为是健康的
+	if nodeId := selectDBNodeId([]int64{5}, 0); nodeId != 5 {
+		t.Fatal("expect node 5, but got:", nodeId)
+	}
+}
+
+func TestIsDBNodeUnavailableError(t *testing.T) {
+	for _, item := range []struct {
+		err    error
+		result bool
+	}{
+		{nil, false},
+		{driver.ErrBadConn, true},
+		{errors.New("invalid connection"), true},
+		{errors.New("dial tcp 127.0.0.1:3306: connect: connection refused"), true},
+		{errors.New("read tcp 127.0.0.1:3306: i/o timeout"), true},
+		{errors.New("Error 1040: Too many connections"), true},
+		{errors.New("Error 1290 (HY000): The MySQL server is running with the --read-only option so it cannot execute this statement"), true},
+		{errors.New("Error 1406: Data too long for column 'requestId' at row 1"), false},
+		{errors.New("Error 1366 (HY000): Incorrect string value: '\\xF0' for column 'content' at row 2"), false},
+		{errors.New("Error 1062: Duplicate entry '1' for key 'PRIMARY'"), false},
+	} {
+		if isDBNodeUnavailableError(item.err) != item.result {
+			t.Fatal("unexpected result for error:", item.err)
+		}
+	}
+}
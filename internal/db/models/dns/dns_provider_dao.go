@@ -1,8 +1,10 @@
 package dns
 
 import (
+	"encoding/json"
 	dbutils "github.com/TeaOSLab/EdgeAPI/internal/db/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/secrets"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
@@ -63,7 +65,12 @@ func (this *DNSProviderDAO) FindEnabledDNSProvider(tx *dbs.Tx, id int64) (*DNSPr
 	if result == nil {
 		return nil, err
 	}
-	return result.(*DNSProvider), err
+	var provider = result.(*DNSProvider)
+	err = this.decodeSecrets(provider)
+	if err != nil {
+		return nil, err
+	}
+	return provider, nil
 }
 
 // CreateDNSProvider 创建服务商
@@ -74,7 +81,11 @@ func (this *DNSProviderDAO) CreateDNSProvider(tx *dbs.Tx, adminId int64, userId
 	op.Type = providerType
 	op.Name = name
 	if len(apiParamsJSON) > 0 {
-		op.ApiParams = apiParamsJSON
+		encodedAPIParams, err := this.encodeAPIParams(string(apiParamsJSON))
+		if err != nil {
+			return 0, err
+		}
+		op.ApiParams = encodedAPIParams
 	}
 	op.State = DNSProviderStateEnabled
 	err := this.Save(tx, op)
@@ -96,7 +107,11 @@ func (this *DNSProviderDAO) UpdateDNSProvider(tx *dbs.Tx, dnsProviderId int64, n
 
 	// 如果留空则表示不修改
 	if len(apiParamsJSON) > 0 {
-		op.ApiParams = apiParamsJSON
+		encodedAPIParams, err := this.encodeAPIParams(string(apiParamsJSON))
+		if err != nil {
+			return err
+		}
+		op.ApiParams = encodedAPIParams
 	}
 
 	err := this.Save(tx, op)
@@ -131,6 +146,15 @@ func (this *DNSProviderDAO) ListEnabledDNSProviders(tx *dbs.Tx, adminId int64, u
 		DescPk().
 		Slice(&result).
 		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, provider := range result {
+		err = this.decodeSecrets(provider)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return
 }
 
@@ -141,6 +165,15 @@ func (this *DNSProviderDAO) FindAllEnabledDNSProviders(tx *dbs.Tx, adminId int64
 		DescPk().
 		Slice(&result).
 		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, provider := range result {
+		err = this.decodeSecrets(provider)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return
 }
 
@@ -152,6 +185,15 @@ func (this *DNSProviderDAO) FindAllEnabledDNSProvidersWithType(tx *dbs.Tx, provi
 		DescPk().
 		Slice(&result).
 		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, provider := range result {
+		err = this.decodeSecrets(provider)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return
 }
 
@@ -163,3 +205,92 @@ func (this *DNSProviderDAO) UpdateProviderDataUpdatedTime(tx *dbs.Tx, providerId
 		Update()
 	return err
 }
+
+// ReencryptSecrets 使用当前主密钥重新加密所有服务商的API参数，返回修改的数量
+func (this *DNSProviderDAO) ReencryptSecrets(tx *dbs.Tx) (count int64, err error) {
+	ones, err := this.Query(tx).
+		Result("id", "apiParams").
+		AscPk().
+		FindAll()
+	if err != nil {
+		return 0, err
+	}
+	for _, one := range ones {
+		var provider = one.(*DNSProvider)
+		var apiParams = provider.ApiParams
+		if len(apiParams) == 0 || apiParams == "null" {
+			continue
+		}
+		secret, err := this.unwrapAPIParams(apiParams)
+		if err != nil {
+			return count, err
+		}
+		if !secrets.NeedsReencrypt(secret) {
+			continue
+		}
+		apiParamsJSON, err := secrets.DecryptString(secret)
+		if err != nil {
+			return count, errors.New("decrypt dns provider '" + types.String(provider.Id) + "' api params failed: " + err.Error())
+		}
+		newAPIParams, err := this.encodeAPIParams(apiParamsJSON)
+		if err != nil {
+			return count, err
+		}
+		// 只有在数据没有被修改时才更新，JSON字段需要转换后才能比较
+		rowsAffected, err := this.Query(tx).
+			Pk(provider.Id).
+			Where("apiParams=CAST(:apiParams AS JSON)").
+			Param("apiParams", apiParams).
+			Set("apiParams", newAPIParams).
+			Update()
+		if err != nil {
+			return count, err
+		}
+		if rowsAffected > 0 {
+			count++
+		}
+	}
+	return
+}
+
+// 加密API参数
+// 因为字段类型为JSON，所以加密后的数据以JSON字符串形式保存
+func (this *DNSProviderDAO) encodeAPIParams(apiParamsJSON string) (string, error) {
+	secret, err := secrets.EncryptString(apiParamsJSON)
+	if err != nil {
+		return "", err
+	}
+	if !secrets.IsEncrypted(secret) {
+		return apiParamsJSON, nil
+	}
+	secretJSON, err := json.Marshal(secret)
+	if err != nil {
+		return "", err
+	}
+	return string(secretJSON), nil
+}
+
+// 取出保存的API参数，加密的数据会去掉JSON字符串的引号
+func (this *DNSProviderDAO) unwrapAPIParams(apiParams string) (string, error) {
+	if len(apiParams) == 0 || apiParams[0] != '"' {
+		return apiParams, nil
+	}
+	var secret = ""
+	err := json.Unmarshal([]byte(apiParams), &secret)
+	if err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// 解密API参数
+func (this *DNSProviderDAO) decodeSecrets(provider *DNSProvider) error {
+	secret, err := this.unwrapAPIParams(provider.ApiParams)
+	if err == nil {
+		provider.ApiParams, err = secrets.DecryptString(secret)
+	}
+	if err != nil {
+		return errors.New("decrypt dns provider '" + types.String(provider.Id) + "' api params failed: " + err.Error())
+	}
+	return nil
+}
@@ -1,5 +1,75 @@
 package dns
 
 import (
+	"github.com/TeaOSLab/EdgeAPI/internal/secrets"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+	"testing"
 )
+
+func TestDNSProviderDAO_ReencryptSecrets(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var dao = SharedDNSProviderDAO
+
+	// 没有主密钥时以明文保存
+	secrets.SetSharedKeyring(&secrets.Keyring{})
+	defer secrets.SetSharedKeyring(nil)
+
+	providerId, err := dao.CreateDNSProvider(tx, 1, 0, "dnspod", "test-reencrypt", []byte(`{"id":"123","token":"456"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = dao.Query(tx).Pk(providerId).Delete()
+	}()
+
+	oldAPIParams, err := dao.Query(tx).Pk(providerId).Result("apiParams").FindStringCol("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := secrets.GenerateKeyLine("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := secrets.ParseKeyring(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets.SetSharedKeyring(keyring)
+
+	count, err := dao.ReencryptSecrets(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count == 0 {
+		t.Fatal("should re-encrypt at least one provider")
+	}
+
+	// 数据库中保存的数据必须已经被修改
+	newAPIParams, err := dao.Query(tx).Pk(providerId).Result("apiParams").FindStringCol("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newAPIParams == oldAPIParams {
+		t.Fatal("api params should be changed")
+	}
+	secret, err := dao.unwrapAPIParams(newAPIParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !secrets.IsEncrypted(secret) {
+		t.Fatal("api params should be encrypted, but got:", newAPIParams)
+	}
+
+	provider, err := dao.FindEnabledDNSProvider(tx, providerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider == nil || provider.ApiParams != oldAPIParams {
+		t.Fatal("decrypted api params should be same as before")
+	}
+}
@@ -2,6 +2,7 @@ package dns
 
 import (
 	"encoding/json"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	"github.com/iwind/TeaGo/maps"
 )
 
@@ -14,3 +15,21 @@ func (this *DNSProvider) DecodeAPIParams() (maps.Map, error) {
 	err := json.Unmarshal([]byte(this.ApiParams), &result)
 	return result, err
 }
+
+// AuditMap 用于审计日志的数据，API参数中的密钥会被替换为掩码
+func (this *DNSProvider) AuditMap() maps.Map {
+	var apiParams interface{} = nil
+	params, err := this.DecodeAPIParams()
+	if err == nil {
+		apiParams = utils.RedactJSONSecrets(map[string]interface{}(params))
+	}
+	return maps.Map{
+		"id":        this.Id,
+		"name":      this.Name,
+		"type":      this.Type,
+		"adminId":   this.AdminId,
+		"userId":    this.UserId,
+		"apiParams": apiParams,
+		"state":     this.State,
+	}
+}
@@ -3,3 +3,6 @@ package models
 import "github.com/TeaOSLab/EdgeAPI/internal/errors"
 
 var ErrNotFound = errors.New("resource not found")
+
+var ErrAccessLogQueueFull = errors.New("access log queue is full, please try again later")
+var ErrAccessLogQueueClosed = errors.New("access log queue has been closed")
@@ -0,0 +1,440 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/filestores"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/objectstorage"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+type FileBlobDAO dbs.DAO
+
+func NewFileBlobDAO() *FileBlobDAO {
+	return dbs.NewDAO(&FileBlobDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeFileBlobs",
+			Model:  new(FileBlob),
+			PkName: "id",
+		},
+	}).(*FileBlobDAO)
+}
+
+var SharedFileBlobDAO *FileBlobDAO
+
+var ErrFileHashMismatch = errors.New("file hash mismatch")
+
+func init() {
+	dbs.OnReady(func() {
+		SharedFileBlobDAO = NewFileBlobDAO()
+	})
+}
+
+// 根据配置缓存的对象存储，每个存储类型一个
+// 切换存储类型后，以前保存的文件仍然从原来的存储中读取
+type fileBlobStorage struct {
+	storage    objectstorage.Storage
+	configJSON string
+}
+
+var fileBlobStorages = map[string]*fileBlobStorage{} // storageType => storage
+var fileBlobStorageLocker = sync.Mutex{}
+
+// ReadConfig 读取文件存储配置，没有配置时使用数据库存储
+func (this *FileBlobDAO) ReadConfig(tx *dbs.Tx) (*filestores.Config, error) {
+	configJSON, err := SharedSysSettingDAO.ReadSetting(tx, filestores.SettingCode)
+	if err != nil {
+		return nil, err
+	}
+	var config = filestores.NewConfig()
+	if len(configJSON) > 0 {
+		err = json.Unmarshal(configJSON, config)
+		if err != nil {
+			return nil, errors.New("decode file store config failed: " + err.Error())
+		}
+	}
+	err = config.Init()
+	if err != nil {
+		return nil, errors.New("invalid file store config: " + err.Error())
+	}
+	return config, nil
+}
+
+// CheckConfig 检查文件存储配置是否可以在当前的API节点中使用
+func (this *FileBlobDAO) CheckConfig(tx *dbs.Tx, config *filestores.Config) error {
+	if config.StorageType != filestores.StorageTypeLocal {
+		return nil
+	}
+	countAPINodes, err := SharedAPINodeDAO.CountAllEnabledAndOnAPINodes(tx)
+	if err != nil {
+		return err
+	}
+	return config.CheckAPINodes(countAPINodes)
+}
+
+// FindBlob 查找文件数据
+func (this *FileBlobDAO) FindBlob(tx *dbs.Tx, blobId int64) (*FileBlob, error) {
+	one, err := this.Query(tx).
+		Pk(blobId).
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*FileBlob), nil
+}
+
+// FindBlobWithHash 根据内容SHA256查找文件数据
+func (this *FileBlobDAO) FindBlobWithHash(tx *dbs.Tx, hash string) (*FileBlob, error) {
+	one, err := this.Query(tx).
+		Attr("hash", hash).
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*FileBlob), nil
+}
+
+// IncreaseBlobRefs 增加引用，只有已经保存完成的文件数据才能被引用
+func (this *FileBlobDAO) IncreaseBlobRefs(tx *dbs.Tx, blobId int64) (ok bool, err error) {
+	rowsAffected, err := this.Query(tx).
+		Pk(blobId).
+		Attr("isReady", true).
+		Set("refs", dbs.SQL("refs+1")).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// DecreaseBlobRefs 减少引用
+func (this *FileBlobDAO) DecreaseBlobRefs(tx *dbs.Tx, blobId int64) error {
+	_, err := this.Query(tx).
+		Pk(blobId).
+		Set("refs", dbs.SQL("refs-1")).
+		Update()
+	return err
+}
+
+// StoreFile 将上传完成的文件保存到文件数据中
+// 内容相同的文件共用同一份文件数据；文件数据正在被其他上传保存时，此文件保留自己的片段
+func (this *FileBlobDAO) StoreFile(tx *dbs.Tx, fileId int64) error {
+	file, err := SharedFileDAO.Query(tx).
+		Pk(fileId).
+		Find()
+	if err != nil {
+		return err
+	}
+	if file == nil || file.(*File).BlobId > 0 {
+		return nil
+	}
+	var uploadFile = file.(*File)
+
+	// 断点续传时需要所有片段都已上传
+	if uploadFile.ChunkSize > 0 {
+		missingIndexes, err := SharedFileChunkDAO.FindMissingChunkIndexes(tx, uploadFile)
+		if err != nil {
+			return err
+		}
+		if len(missingIndexes) > 0 {
+			return errors.New("file is incomplete, " + types.String(len(missingIndexes)) + " chunks missing")
+		}
+	}
+
+	chunks, err := SharedFileChunkDAO.FindAllUploadingChunks(tx, fileId)
+	if err != nil {
+		return err
+	}
+	var reader = NewFileChunkReader(tx, chunks)
+	var hash = sha256.New()
+	_, err = io.Copy(hash, reader)
+	if err != nil {
+		return err
+	}
+	var hashString = hex.EncodeToString(hash.Sum(nil))
+
+	// 校验上传时声明的SHA256
+	if len(uploadFile.UploadHash) > 0 && uploadFile.UploadHash != hashString {
+		return ErrFileHashMismatch
+	}
+
+	// 已经有相同内容
+	blob, err := this.FindBlobWithHash(tx, hashString)
+	if err != nil {
+		return err
+	}
+	if blob != nil {
+		return this.reuseBlob(tx, fileId, hashString, int64(blob.Id))
+	}
+
+	config, err := this.ReadConfig(tx)
+	if err != nil {
+		return err
+	}
+	err = this.CheckConfig(tx, config)
+	if err != nil {
+		return err
+	}
+
+	// 创建文件数据，同时上传相同内容时只有一个能创建成功
+	var storageKey = ""
+	if config.IsObjectStorage() {
+		storageKey, err = filestores.ObjectKey(hashString)
+		if err != nil {
+			return err
+		}
+	}
+	blobId, err := this.createBlob(tx, hashString, reader.Size(), config.StorageType, storageKey, len(chunks))
+	if err != nil {
+		return err
+	}
+	if blobId == 0 {
+		blob, err = this.FindBlobWithHash(tx, hashString)
+		if err != nil {
+			return err
+		}
+		if blob == nil {
+			return errors.New("blob '" + hashString + "' not found")
+		}
+		return this.reuseBlob(tx, fileId, hashString, int64(blob.Id))
+	}
+
+	err = this.storeChunks(tx, config, fileId, hashString, blobId, storageKey, reader, chunks)
+	if err != nil {
+		_, _ = this.Query(tx).
+			Pk(blobId).
+			Delete()
+		return err
+	}
+	return nil
+}
+
+// ReadBlobRange 从对象存储中读取文件数据的一部分
+func (this *FileBlobDAO) ReadBlobRange(tx *dbs.Tx, blobId int64, offset int64, size int64) ([]byte, error) {
+	blob, err := this.FindBlob(tx, blobId)
+	if err != nil {
+		return nil, err
+	}
+	if blob == nil {
+		return nil, errors.New("blob '" + types.String(blobId) + "' not found")
+	}
+	storage, err := this.findStorage(tx, blob.StorageType)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := storage.GetRange(blob.StorageKey, offset, size)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != size {
+		return nil, errors.New("blob '" + types.String(blobId) + "' is incomplete")
+	}
+	return data, nil
+}
+
+// FindAllUnusedBlobIds 查找没有引用的文件数据
+// 保存时中断的文件数据在一天后也会被清理
+func (this *FileBlobDAO) FindAllUnusedBlobIds(tx *dbs.Tx, size int64) (result []int64, err error) {
+	ones, err := this.Query(tx).
+		Where("((isReady=1 AND refs<=0) OR (isReady=0 AND createdAt<:expiredAt))").
+		Param("expiredAt", time.Now().Unix()-86400).
+		ResultPk().
+		Limit(size).
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, one := range ones {
+		result = append(result, int64(one.(*FileBlob).Id))
+	}
+	return
+}
+
+// DeleteUnusedBlob 删除没有引用的文件数据
+func (this *FileBlobDAO) DeleteUnusedBlob(tx *dbs.Tx, blobId int64) error {
+	// 先置为未完成，防止在删除过程中被新的上传引用
+	_, err := this.Query(tx).
+		Pk(blobId).
+		Where("(refs<=0 OR (isReady=0 AND createdAt<:expiredAt))").
+		Param("expiredAt", time.Now().Unix()-86400).
+		Set("isReady", false).
+		Set("refs", 0).
+		Update()
+	if err != nil {
+		return err
+	}
+	blob, err := this.FindBlob(tx, blobId)
+	if err != nil || blob == nil {
+		return err
+	}
+	if blob.IsReady == 1 || blob.Refs > 0 {
+		return nil
+	}
+
+	if len(blob.StorageKey) > 0 {
+		storage, err := this.findStorage(tx, blob.StorageType)
+		if err != nil {
+			return err
+		}
+		err = storage.Delete(blob.StorageKey)
+		if err != nil {
+			return err
+		}
+	}
+	err = SharedFileChunkDAO.DeleteBlobChunks(tx, blobId)
+	if err != nil {
+		return err
+	}
+	_, err = this.Query(tx).
+		Pk(blobId).
+		Delete()
+	return err
+}
+
+// 使用已有的文件数据，并删除上传的片段
+func (this *FileBlobDAO) reuseBlob(tx *dbs.Tx, fileId int64, hash string, blobId int64) error {
+	ok, err := this.IncreaseBlobRefs(tx, blobId)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 还没有保存完成，保留自己的片段
+		return SharedFileDAO.UpdateFileBlob(tx, fileId, hash, 0)
+	}
+	err = SharedFileDAO.UpdateFileBlob(tx, fileId, hash, blobId)
+	if err != nil {
+		return err
+	}
+	return SharedFileChunkDAO.DeleteFileChunks(tx, fileId)
+}
+
+// 创建文件数据，已经存在时返回0
+func (this *FileBlobDAO) createBlob(tx *dbs.Tx, hash string, size int64, storageType string, storageKey string, countChunks int) (int64, error) {
+	var sqlString = "INSERT IGNORE INTO `" + this.Table + "` (`hash`, `size`, `storageType`, `storageKey`, `countChunks`, `refs`, `isReady`, `createdAt`) VALUES (?, ?, ?, ?, ?, 1, 0, ?)"
+	var args = []interface{}{hash, size, storageType, storageKey, countChunks, time.Now().Unix()}
+	var result sql.Result
+	var err error
+	if tx != nil {
+		result, err = tx.Exec(sqlString, args...)
+	} else {
+		result, err = this.Instance.Exec(sqlString, args...)
+	}
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rowsAffected == 0 {
+		return 0, nil
+	}
+	blob, err := this.FindBlobWithHash(tx, hash)
+	if err != nil || blob == nil {
+		return 0, err
+	}
+	return int64(blob.Id), nil
+}
+
+// 保存片段，并将文件数据标记为已完成
+// 数据库存储直接将片段转移到文件数据中；对象存储上传完整内容，数据库中只保留片段的位置，并删除上传的片段；
+// 数据库中的修改在同一个事务中完成，中断时不会出现只转移了部分片段的文件数据
+func (this *FileBlobDAO) storeChunks(tx *dbs.Tx, config *filestores.Config, fileId int64, hash string, blobId int64, storageKey string, reader *FileChunkReader, chunks []*FileChunk) error {
+	if config.IsObjectStorage() {
+		storage, err := this.findStorage(tx, config.StorageType)
+		if err != nil {
+			return err
+		}
+		_, err = reader.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		err = storage.Put(storageKey, reader, reader.Size())
+		if err != nil {
+			return err
+		}
+	}
+
+	return this.runTx(tx, func(tx *dbs.Tx) error {
+		for _, chunk := range chunks {
+			var err error
+			if config.IsObjectStorage() {
+				err = SharedFileChunkDAO.CreateBlobChunk(tx, blobId, int(chunk.Idx), int64(chunk.Offset), int64(chunk.Size))
+			} else {
+				err = SharedFileChunkDAO.MoveChunkToBlob(tx, int64(chunk.Id), blobId, int64(chunk.Offset), int64(chunk.Size))
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		// 内容已经保存在对象存储中
+		if config.IsObjectStorage() {
+			err := SharedFileChunkDAO.DeleteFileChunks(tx, fileId)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := this.Query(tx).
+			Pk(blobId).
+			Set("isReady", true).
+			Update()
+		if err != nil {
+			return err
+		}
+		return SharedFileDAO.UpdateFileBlob(tx, fileId, hash, blobId)
+	})
+}
+
+// 在事务中执行，已经在事务中时直接执行
+func (this *FileBlobDAO) runTx(tx *dbs.Tx, f func(tx *dbs.Tx) error) error {
+	if tx != nil {
+		return f(tx)
+	}
+	return this.Instance.RunTx(f)
+}
+
+// 获取某个存储类型的对象存储，配置改变后重新创建
+// 存储类型可以和当前使用的存储类型不同，此时使用配置中保留的此类型的设置
+func (this *FileBlobDAO) findStorage(tx *dbs.Tx, storageType string) (objectstorage.Storage, error) {
+	config, err := this.ReadConfig(tx)
+	if err != nil {
+		return nil, err
+	}
+	var configJSON = string(config.StorageConfigJSON(storageType))
+
+	fileBlobStorageLocker.Lock()
+	defer fileBlobStorageLocker.Unlock()
+	cached, ok := fileBlobStorages[storageType]
+	if ok && cached.configJSON == configJSON {
+		return cached.storage, nil
+	}
+	storage, err := config.NewStorageWithType(storageType)
+	if err != nil {
+		return nil, errors.New("can not find settings of '" + storageType + "' storage: " + err.Error())
+	}
+	fileBlobStorages[storageType] = &fileBlobStorage{
+		storage:    storage,
+		configJSON: configJSON,
+	}
+	return storage, nil
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/TeaOSLab/EdgeAPI/internal/filestores"
+	"github.com/iwind/TeaGo/dbs"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileBlobDAO_StoreFile(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var fileIds = []int64{}
+	for i := 0; i < 2; i++ {
+		fileId, err := SharedFileDAO.CreateFile(tx, 1, 0, "test", "", "test.txt", 10, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range []string{"01234", "56789"} {
+			_, err = SharedFileChunkDAO.CreateFileChunk(tx, fileId, []byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = SharedFileDAO.UpdateFileIsFinished(tx, fileId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileIds = append(fileIds, fileId)
+	}
+
+	// 内容相同的文件共用同一份文件数据
+	blobId1, err := SharedFileDAO.FindFileBlobId(tx, fileIds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobId2, err := SharedFileDAO.FindFileBlobId(tx, fileIds[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blobId1 == 0 || blobId1 != blobId2 {
+		t.Fatal("blob should be shared:", blobId1, blobId2)
+	}
+
+	chunks, err := SharedFileChunkDAO.FindAllFileChunks(tx, fileIds[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content = ""
+	for _, chunk := range chunks {
+		content += chunk.Data
+	}
+	if content != "0123456789" {
+		t.Fatal("unexpected content:", content)
+	}
+
+	for _, fileId := range fileIds {
+		err = SharedFileDAO.DisableFile(tx, fileId)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = SharedFileBlobDAO.DeleteUnusedBlob(tx, blobId1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ok")
+}
+
+func TestFileBlobDAO_StoreFile_ObjectStorage(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+
+	// 临时使用本地目录存储
+	dir, err := ioutil.TempDir("", "file-blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	oldConfigJSON, err := SharedSysSettingDAO.ReadSetting(tx, filestores.SettingCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = SharedSysSettingDAO.UpdateSetting(tx, filestores.SettingCode, oldConfigJSON)
+	}()
+	configJSON, err := json.Marshal(&filestores.Config{
+		StorageType: filestores.StorageTypeLocal,
+		Local:       &filestores.LocalConfig{Dir: dir, IsShared: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SharedSysSettingDAO.UpdateSetting(tx, filestores.SettingCode, configJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 使用不同的内容，以免复用已有的文件数据
+	var data = time.Now().String()
+	fileId, err := SharedFileDAO.CreateFile(tx, 1, 0, "test", "", "test.txt", int64(len(data)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = SharedFileChunkDAO.CreateFileChunk(tx, fileId, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SharedFileDAO.UpdateFileIsFinished(tx, fileId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobId, err := SharedFileDAO.FindFileBlobId(tx, fileId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blobId == 0 {
+		t.Fatal("file should be stored in blob")
+	}
+
+	// 上传的片段已经删除，内容从对象存储中读取
+	count, err := SharedFileChunkDAO.Query(tx).
+		Attr("fileId", fileId).
+		Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count > 0 {
+		t.Fatal("uploaded chunks should be deleted, but got", count)
+	}
+	chunks, err := SharedFileChunkDAO.FindAllFileChunks(tx, fileId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content = ""
+	for _, chunk := range chunks {
+		content += chunk.Data
+	}
+	if content != data {
+		t.Fatal("unexpected content:", content)
+	}
+
+	err = SharedFileDAO.DisableFile(tx, fileId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SharedFileBlobDAO.DeleteUnusedBlob(tx, blobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
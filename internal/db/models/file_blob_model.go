@@ -0,0 +1,30 @@
+package models
+
+// FileBlob 按内容去重的文件数据
+type FileBlob struct {
+	Id          uint32 `field:"id"`          // ID
+	Hash        string `field:"hash"`        // 内容SHA256
+	Size        uint64 `field:"size"`        // 尺寸
+	StorageType string `field:"storageType"` // 存储类型
+	StorageKey  string `field:"storageKey"`  // 存储中的对象名
+	CountChunks uint32 `field:"countChunks"` // 分块数量
+	Refs        int32  `field:"refs"`        // 引用数量
+	IsReady     uint8  `field:"isReady"`     // 是否已保存完成
+	CreatedAt   uint64 `field:"createdAt"`   // 创建时间
+}
+
+type FileBlobOperator struct {
+	Id          interface{} // ID
+	Hash        interface{} // 内容SHA256
+	Size        interface{} // 尺寸
+	StorageType interface{} // 存储类型
+	StorageKey  interface{} // 存储中的对象名
+	CountChunks interface{} // 分块数量
+	Refs        interface{} // 引用数量
+	IsReady     interface{} // 是否已保存完成
+	CreatedAt   interface{} // 创建时间
+}
+
+func NewFileBlobOperator() *FileBlobOperator {
+	return &FileBlobOperator{}
+}
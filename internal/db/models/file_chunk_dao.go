@@ -1,13 +1,19 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
 	"github.com/iwind/TeaGo/types"
+	"strings"
 )
 
+var ErrFileChunkHashMismatch = errors.New("file chunk hash mismatch")
+
 type FileChunkDAO dbs.DAO
 
 func NewFileChunkDAO() *FileChunkDAO {
@@ -34,6 +40,7 @@ func (this *FileChunkDAO) CreateFileChunk(tx *dbs.Tx, fileId int64, data []byte)
 	op := NewFileChunkOperator()
 	op.FileId = fileId
 	op.Data = data
+	op.Size = len(data)
 	err := this.Save(tx, op)
 	if err != nil {
 		return 0, err
@@ -41,20 +48,106 @@ func (this *FileChunkDAO) CreateFileChunk(tx *dbs.Tx, fileId int64, data []byte)
 	return types.Int64(op.Id), nil
 }
 
+// UploadFileChunk 断点续传时上传文件片段
+// 同一个序号的片段可以重复上传，后上传的会覆盖之前的内容
+func (this *FileChunkDAO) UploadFileChunk(tx *dbs.Tx, file *File, idx int, data []byte, hash string) error {
+	if file.ChunkSize == 0 {
+		return errors.New("file '" + types.String(file.Id) + "' is not uploaded with session")
+	}
+	if file.IsFinished == 1 {
+		return errors.New("file '" + types.String(file.Id) + "' has been finished")
+	}
+
+	// 检查片段
+	var countChunks = file.CountUploadChunks()
+	if idx < 0 || idx >= countChunks {
+		return errors.New("invalid chunk index '" + types.String(idx) + "'")
+	}
+	var expectedSize = int64(file.ChunkSize)
+	if idx == countChunks-1 {
+		expectedSize = int64(file.Size) - int64(file.ChunkSize)*int64(countChunks-1)
+	}
+	if int64(len(data)) != expectedSize {
+		return errors.New("invalid chunk size '" + types.String(len(data)) + "', expected '" + types.String(expectedSize) + "'")
+	}
+	var sum = sha256.Sum256(data)
+	var dataHash = hex.EncodeToString(sum[:])
+	if len(hash) > 0 && strings.ToLower(hash) != dataHash {
+		return ErrFileChunkHashMismatch
+	}
+
+	return this.Query(tx).
+		InsertOrUpdateQuickly(maps.Map{
+			"fileId":    file.Id,
+			"idx":       idx,
+			"data":      data,
+			"size":      len(data),
+			"hash":      dataHash,
+			"uploadKey": types.String(file.Id) + ":" + types.String(idx),
+		}, maps.Map{
+			"data": data,
+			"size": len(data),
+			"hash": dataHash,
+		})
+}
+
+// FindMissingChunkIndexes 查找断点续传时还没有上传的片段序号
+func (this *FileChunkDAO) FindMissingChunkIndexes(tx *dbs.Tx, file *File) ([]int32, error) {
+	ones, err := this.Query(tx).
+		Attr("fileId", file.Id).
+		Attr("blobId", 0).
+		Where("uploadKey IS NOT NULL").
+		Result("idx").
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	var uploadedMap = map[uint32]bool{}
+	for _, one := range ones {
+		uploadedMap[one.(*FileChunk).Idx] = true
+	}
+	var result = []int32{}
+	var countChunks = file.CountUploadChunks()
+	for i := 0; i < countChunks; i++ {
+		if !uploadedMap[uint32(i)] {
+			result = append(result, int32(i))
+		}
+	}
+	return result, nil
+}
+
 // 列出所有的文件Chunk
 func (this *FileChunkDAO) FindAllFileChunks(tx *dbs.Tx, fileId int64) (result []*FileChunk, err error) {
-	_, err = this.Query(tx).
-		Attr("fileId", fileId).
+	query, err := this.fileChunksQuery(tx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	_, err = query.
+		Asc("idx").
 		AscPk().
 		Slice(&result).
 		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, chunk := range result {
+		err = this.loadChunkData(tx, chunk)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return
 }
 
 // 读取文件的所有片段ID
+// 已经保存到文件数据中的文件返回文件数据的片段ID
 func (this *FileChunkDAO) FindAllFileChunkIds(tx *dbs.Tx, fileId int64) ([]int64, error) {
-	ones, err := this.Query(tx).
-		Attr("fileId", fileId).
+	query, err := this.fileChunksQuery(tx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	ones, err := query.
+		Asc("idx").
 		AscPk().
 		ResultPk().
 		FindAll()
@@ -80,6 +173,7 @@ func (this *FileChunkDAO) DeleteFileChunks(tx *dbs.Tx, fileId int64) error {
 }
 
 // 根据ID查找片段
+// 保存在对象存储中的片段会从存储中读取内容
 func (this *FileChunkDAO) FindFileChunk(tx *dbs.Tx, chunkId int64) (*FileChunk, error) {
 	one, err := this.Query(tx).
 		Pk(chunkId).
@@ -90,5 +184,92 @@ func (this *FileChunkDAO) FindFileChunk(tx *dbs.Tx, chunkId int64) (*FileChunk,
 	if one == nil {
 		return nil, nil
 	}
-	return one.(*FileChunk), nil
+	var chunk = one.(*FileChunk)
+	err = this.loadChunkData(tx, chunk)
+	if err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// FindAllUploadingChunks 查找文件上传的所有片段，只包含ID、偏移量和尺寸
+func (this *FileChunkDAO) FindAllUploadingChunks(tx *dbs.Tx, fileId int64) (result []*FileChunk, err error) {
+	if fileId <= 0 {
+		return nil, errors.New("invalid fileId")
+	}
+	_, err = this.Query(tx).
+		Attr("fileId", fileId).
+		Attr("blobId", 0).
+		Result("id", "idx", "LENGTH(data) AS size").
+		Asc("idx").
+		AscPk().
+		Slice(&result).
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	var offset uint64 = 0
+	for _, chunk := range result {
+		chunk.Offset = offset
+		offset += uint64(chunk.Size)
+	}
+	return
+}
+
+// MoveChunkToBlob 将文件上传的片段转移到文件数据中
+func (this *FileChunkDAO) MoveChunkToBlob(tx *dbs.Tx, chunkId int64, blobId int64, offset int64, size int64) error {
+	_, err := this.Query(tx).
+		Pk(chunkId).
+		Set("fileId", 0).
+		Set("blobId", blobId).
+		Set("offset", offset).
+		Set("size", size).
+		Update()
+	return err
+}
+
+// CreateBlobChunk 创建保存在对象存储中的片段索引，内容不保存在数据库中
+func (this *FileChunkDAO) CreateBlobChunk(tx *dbs.Tx, blobId int64, idx int, offset int64, size int64) error {
+	op := NewFileChunkOperator()
+	op.BlobId = blobId
+	op.Idx = idx
+	op.Offset = offset
+	op.Size = size
+	return this.Save(tx, op)
+}
+
+// DeleteBlobChunks 删除文件数据的所有片段
+func (this *FileChunkDAO) DeleteBlobChunks(tx *dbs.Tx, blobId int64) error {
+	if blobId <= 0 {
+		return errors.New("invalid blobId")
+	}
+	_, err := this.Query(tx).
+		Attr("blobId", blobId).
+		Delete()
+	return err
+}
+
+// 文件片段查询，已经保存到文件数据中的文件使用文件数据的片段
+func (this *FileChunkDAO) fileChunksQuery(tx *dbs.Tx, fileId int64) (*dbs.Query, error) {
+	blobId, err := SharedFileDAO.FindFileBlobId(tx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	if blobId > 0 {
+		return this.Query(tx).Attr("blobId", blobId), nil
+	}
+	return this.Query(tx).Attr("fileId", fileId), nil
+}
+
+// 从对象存储中读取片段内容
+func (this *FileChunkDAO) loadChunkData(tx *dbs.Tx, chunk *FileChunk) error {
+	if chunk.BlobId == 0 || len(chunk.Data) > 0 || chunk.Size == 0 {
+		return nil
+	}
+	data, err := SharedFileBlobDAO.ReadBlobRange(tx, int64(chunk.BlobId), int64(chunk.Offset), int64(chunk.Size))
+	if err != nil {
+		return err
+	}
+	chunk.Data = string(data)
+	return nil
 }
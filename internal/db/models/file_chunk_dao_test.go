@@ -1,5 +1,66 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/dbs"
+	"testing"
 )
+
+func TestFileChunkDAO_UploadFileChunk(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var content = []byte("0123456789")
+	var sum = sha256.Sum256(content)
+	fileId, err := SharedFileDAO.CreateUploadFile(tx, 1, 0, "test", "test.txt", int64(len(content)), hex.EncodeToString(sum[:]), 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := SharedFileDAO.FindEnabledFile(tx, fileId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.CountUploadChunks() != 3 {
+		t.Fatal("expect 3 chunks, but got:", file.CountUploadChunks())
+	}
+
+	// 乱序并重复上传
+	var chunks = [][]byte{content[:4], content[4:8], content[8:]}
+	for _, idx := range []int{2, 0, 0} {
+		err = SharedFileChunkDAO.UploadFileChunk(tx, file, idx, chunks[idx], "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	missingIndexes, err := SharedFileChunkDAO.FindMissingChunkIndexes(tx, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missingIndexes) != 1 || missingIndexes[0] != 1 {
+		t.Fatal("unexpected missing indexes:", missingIndexes)
+	}
+
+	// 没有上传完成
+	err = SharedFileDAO.UpdateFileIsFinished(tx, fileId)
+	if err == nil {
+		t.Fatal("incomplete file should not be finished")
+	}
+
+	// 尺寸不正确
+	err = SharedFileChunkDAO.UploadFileChunk(tx, file, 1, []byte("45"), "")
+	if err == nil {
+		t.Fatal("invalid chunk size should fail")
+	}
+
+	err = SharedFileChunkDAO.UploadFileChunk(tx, file, 1, chunks[1], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SharedFileDAO.UpdateFileIsFinished(tx, fileId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ok")
+}
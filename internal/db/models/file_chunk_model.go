@@ -1,16 +1,27 @@
 package models
 
-//
 type FileChunk struct {
-	Id     uint32 `field:"id"`     // ID
-	FileId uint32 `field:"fileId"` // 文件ID
-	Data   string `field:"data"`   // 分块内容
+	Id        uint32 `field:"id"`        // ID
+	FileId    uint32 `field:"fileId"`    // 文件ID
+	Data      string `field:"data"`      // 分块内容
+	BlobId    uint32 `field:"blobId"`    // 文件数据ID
+	Offset    uint64 `field:"offset"`    // 在文件数据中的偏移量
+	Size      uint32 `field:"size"`      // 分块尺寸
+	Idx       uint32 `field:"idx"`       // 分块序号
+	Hash      string `field:"hash"`      // 分块内容SHA256
+	UploadKey string `field:"uploadKey"` // 断点续传的分块标识
 }
 
 type FileChunkOperator struct {
-	Id     interface{} // ID
-	FileId interface{} // 文件ID
-	Data   interface{} // 分块内容
+	Id        interface{} // ID
+	FileId    interface{} // 文件ID
+	Data      interface{} // 分块内容
+	BlobId    interface{} // 文件数据ID
+	Offset    interface{} // 在文件数据中的偏移量
+	Size      interface{} // 分块尺寸
+	Idx       interface{} // 分块序号
+	Hash      interface{} // 分块内容SHA256
+	UploadKey interface{} // 断点续传的分块标识
 }
 
 func NewFileChunkOperator() *FileChunkOperator {
@@ -0,0 +1,112 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package models
+
+import (
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	"io"
+)
+
+// FileChunkReader 按顺序读取数据库中的文件片段，每次只加载一个片段
+// 支持Seek，以便写入对象存储时计算校验值后重新读取
+type FileChunkReader struct {
+	tx     *dbs.Tx
+	chunks []*FileChunk // 只包含ID、偏移量和尺寸
+	size   int64
+	offset int64
+
+	chunkIndex int
+	chunkData  []byte
+}
+
+// NewFileChunkReader 获取新对象
+func NewFileChunkReader(tx *dbs.Tx, chunks []*FileChunk) *FileChunkReader {
+	var size int64 = 0
+	for _, chunk := range chunks {
+		size += int64(chunk.Size)
+	}
+	return &FileChunkReader{
+		tx:         tx,
+		chunks:     chunks,
+		size:       size,
+		chunkIndex: -1,
+	}
+}
+
+// Size 总尺寸
+func (this *FileChunkReader) Size() int64 {
+	return this.size
+}
+
+// Read 读取数据
+func (this *FileChunkReader) Read(p []byte) (n int, err error) {
+	if this.offset >= this.size {
+		return 0, io.EOF
+	}
+
+	// 查找当前偏移量所在的片段
+	var index = this.chunkIndex
+	if index < 0 || !this.contains(index, this.offset) {
+		index = -1
+		for i, chunk := range this.chunks {
+			if this.offset >= int64(chunk.Offset) && this.offset < int64(chunk.Offset)+int64(chunk.Size) {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return 0, io.EOF
+		}
+	}
+	if index != this.chunkIndex {
+		var chunk = this.chunks[index]
+		one, err := SharedFileChunkDAO.Query(this.tx).
+			Pk(chunk.Id).
+			Result("data").
+			Find()
+		if err != nil {
+			return 0, err
+		}
+		if one == nil {
+			return 0, errors.New("chunk '" + types.String(chunk.Id) + "' not found")
+		}
+		var data = []byte(one.(*FileChunk).Data)
+		if int64(len(data)) != int64(chunk.Size) {
+			return 0, errors.New("chunk '" + types.String(chunk.Id) + "' has been changed")
+		}
+		this.chunkIndex = index
+		this.chunkData = data
+	}
+
+	var chunkOffset = this.offset - int64(this.chunks[index].Offset)
+	n = copy(p, this.chunkData[chunkOffset:])
+	this.offset += int64(n)
+	return n, nil
+}
+
+// Seek 设置读取位置
+func (this *FileChunkReader) Seek(offset int64, whence int) (int64, error) {
+	var newOffset int64
+	switch whence {
+	case io.SeekStart:
+		newOffset = offset
+	case io.SeekCurrent:
+		newOffset = this.offset + offset
+	case io.SeekEnd:
+		newOffset = this.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if newOffset < 0 {
+		return 0, errors.New("negative position")
+	}
+	this.offset = newOffset
+	return newOffset, nil
+}
+
+func (this *FileChunkReader) contains(index int, offset int64) bool {
+	var chunk = this.chunks[index]
+	return offset >= int64(chunk.Offset) && offset < int64(chunk.Offset)+int64(chunk.Size)
+}
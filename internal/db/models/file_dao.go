@@ -1,15 +1,30 @@
 package models
 
 import (
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/types"
+	"math"
+	"time"
 )
 
 const (
 	FileStateEnabled  = 1 // 已启用
 	FileStateDisabled = 0 // 已禁用
+
+	FileDataChunkSize = 512 * 1024 // 使用已有数据创建文件时的分块尺寸
+
+	MinFileUploadChunkSize = 64 * 1024      // 断点续传时通过接口设置的最小分块尺寸
+	MaxFileUploadSize      = math.MaxUint32 // 断点续传最大文件尺寸，不能超过size字段的范围
+	MaxFileUploadChunks    = 65536          // 断点续传最多片段数量
+)
+
+// 可以通过接口上传的文件类型
+const (
+	FileTypeIPLibrary     = "ipLibrary"     // IP库
+	FileTypeDeployPackage = "deployPackage" // 节点安装包，只有管理员可以上传
 )
 
 type FileDAO dbs.DAO
@@ -43,12 +58,29 @@ func (this *FileDAO) EnableFile(tx *dbs.Tx, id int64) error {
 }
 
 // 禁用条目
+// 同时减少文件数据的引用，没有引用的文件数据会被定期清理
 func (this *FileDAO) DisableFile(tx *dbs.Tx, id int64) error {
-	_, err := this.Query(tx).
+	blobId, err := this.Query(tx).
+		Pk(id).
+		Attr("state", FileStateEnabled).
+		Result("blobId").
+		FindInt64Col(0)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := this.Query(tx).
 		Pk(id).
+		Attr("state", FileStateEnabled).
 		Set("state", FileStateDisabled).
 		Update()
-	return err
+	if err != nil {
+		return err
+	}
+	if rowsAffected > 0 && blobId > 0 {
+		return SharedFileBlobDAO.DecreaseBlobRefs(tx, blobId)
+	}
+	return nil
 }
 
 // 查找启用中的条目
@@ -82,11 +114,149 @@ func (this *FileDAO) CreateFile(tx *dbs.Tx, adminId int64, userId int64, busines
 	return types.Int64(op.Id), nil
 }
 
+// CreateFileWithData 使用已有的数据创建文件，数据按固定尺寸分块保存
+func (this *FileDAO) CreateFileWithData(tx *dbs.Tx, adminId int64, userId int64, businessType string, description string, filename string, data []byte) (int64, error) {
+	fileId, err := this.CreateFile(tx, adminId, userId, businessType, description, filename, int64(len(data)), false)
+	if err != nil {
+		return 0, err
+	}
+	for offset := 0; offset < len(data); offset += FileDataChunkSize {
+		var end = offset + FileDataChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		_, err = SharedFileChunkDAO.CreateFileChunk(tx, fileId, data[offset:end])
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = this.UpdateFileIsFinished(tx, fileId)
+	if err != nil {
+		return 0, err
+	}
+	return fileId, nil
+}
+
+// CreateUploadFile 创建断点续传的文件，声明文件尺寸、内容SHA256和分块尺寸
+func (this *FileDAO) CreateUploadFile(tx *dbs.Tx, adminId int64, userId int64, businessType string, filename string, size int64, hash string, chunkSize int64, isPublic bool) (int64, error) {
+	err := CheckFileUploadSize(size, chunkSize)
+	if err != nil {
+		return 0, err
+	}
+
+	op := NewFileOperator()
+	op.AdminId = adminId
+	op.UserId = userId
+	op.Type = businessType
+	op.State = FileStateEnabled
+	op.Size = size
+	op.Filename = filename
+	op.IsPublic = isPublic
+	op.UploadHash = hash
+	op.ChunkSize = chunkSize
+	op.UpdatedAt = time.Now().Unix()
+	err = this.Save(tx, op)
+	if err != nil {
+		return 0, err
+	}
+	return types.Int64(op.Id), nil
+}
+
+// CheckFileUploadSize 检查断点续传的文件尺寸和分块尺寸
+// 超出范围时返回错误，防止尺寸溢出，以及片段数量过多时检查片段耗尽内存；最小分块尺寸由调用者保证
+func CheckFileUploadSize(size int64, chunkSize int64) error {
+	if size <= 0 || size > MaxFileUploadSize {
+		return errors.New("invalid file size '" + types.String(size) + "', should be between 1 and " + types.String(int64(MaxFileUploadSize)))
+	}
+	if chunkSize <= 0 || chunkSize > MaxFileUploadSize {
+		return errors.New("invalid chunk size '" + types.String(chunkSize) + "'")
+	}
+	if (size+chunkSize-1)/chunkSize > MaxFileUploadChunks {
+		return errors.New("too many chunks, should not be more than " + types.String(MaxFileUploadChunks))
+	}
+	return nil
+}
+
+// UpdateFileUploadedAt 记录最后上传时间，长时间没有上传的未完成文件会被清理
+func (this *FileDAO) UpdateFileUploadedAt(tx *dbs.Tx, fileId int64) error {
+	_, err := this.Query(tx).
+		Pk(fileId).
+		Set("updatedAt", time.Now().Unix()).
+		Update()
+	return err
+}
+
+// FindAllExpiredUploadingFileIds 查找长时间没有上传的未完成断点续传文件
+func (this *FileDAO) FindAllExpiredUploadingFileIds(tx *dbs.Tx, days int, size int64) (result []int64, err error) {
+	ones, err := this.Query(tx).
+		Attr("state", FileStateEnabled).
+		Attr("isFinished", false).
+		Gt("chunkSize", 0).
+		Lt("updatedAt", time.Now().Unix()-int64(days)*86400).
+		ResultPk().
+		Limit(size).
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, one := range ones {
+		result = append(result, int64(one.(*File).Id))
+	}
+	return
+}
+
+// DeleteUploadingFile 删除未完成的文件和已经上传的片段
+func (this *FileDAO) DeleteUploadingFile(tx *dbs.Tx, fileId int64) error {
+	err := SharedFileChunkDAO.DeleteFileChunks(tx, fileId)
+	if err != nil {
+		return err
+	}
+	_, err = this.Query(tx).
+		Pk(fileId).
+		Attr("isFinished", false).
+		Set("state", FileStateDisabled).
+		Update()
+	return err
+}
+
 // 将文件置为已完成
+// 上传的片段会按照内容去重后保存到文件数据中
 func (this *FileDAO) UpdateFileIsFinished(tx *dbs.Tx, fileId int64) error {
-	_, err := this.Query(tx).
+	err := SharedFileBlobDAO.StoreFile(tx, fileId)
+	if err != nil {
+		return err
+	}
+
+	_, err = this.Query(tx).
 		Pk(fileId).
 		Set("isFinished", true).
 		Update()
 	return err
 }
+
+// UpdateFileSize 修改文件尺寸
+func (this *FileDAO) UpdateFileSize(tx *dbs.Tx, fileId int64, size int64) error {
+	_, err := this.Query(tx).
+		Pk(fileId).
+		Set("size", size).
+		Update()
+	return err
+}
+
+// FindFileBlobId 查找文件对应的文件数据ID
+func (this *FileDAO) FindFileBlobId(tx *dbs.Tx, fileId int64) (int64, error) {
+	return this.Query(tx).
+		Pk(fileId).
+		Result("blobId").
+		FindInt64Col(0)
+}
+
+// UpdateFileBlob 设置文件的内容SHA256和文件数据
+func (this *FileDAO) UpdateFileBlob(tx *dbs.Tx, fileId int64, hash string, blobId int64) error {
+	_, err := this.Query(tx).
+		Pk(fileId).
+		Set("hash", hash).
+		Set("blobId", blobId).
+		Update()
+	return err
+}
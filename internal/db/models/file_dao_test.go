@@ -2,4 +2,25 @@ package models
 
 import (
 	_ "github.com/go-sql-driver/mysql"
+	"testing"
 )
+
+func TestCheckFileUploadSize(t *testing.T) {
+	for _, c := range []struct {
+		size      int64
+		chunkSize int64
+		isOk      bool
+	}{
+		{10, 4, true},
+		{MaxFileUploadSize, MinFileUploadChunkSize, true},
+		{0, MinFileUploadChunkSize, false},
+		{MaxFileUploadSize + 1, MinFileUploadChunkSize, false},
+		{1024, 0, false},
+		{MaxFileUploadSize, 1, false},
+	} {
+		var err = CheckFileUploadSize(c.size, c.chunkSize)
+		if (err == nil) != c.isOk {
+			t.Fatal(c.size, c.chunkSize, "expected ok:", c.isOk, "error:", err)
+		}
+	}
+}
@@ -14,6 +14,11 @@ type File struct {
 	State       uint8  `field:"state"`       // 状态
 	IsFinished  uint8  `field:"isFinished"`  // 是否已完成上传
 	IsPublic    uint8  `field:"isPublic"`    // 是否可以公开访问
+	Hash        string `field:"hash"`        // 内容SHA256
+	BlobId      uint32 `field:"blobId"`      // 文件数据ID
+	UploadHash  string `field:"uploadHash"`  // 上传时声明的内容SHA256
+	ChunkSize   uint32 `field:"chunkSize"`   // 断点续传的分块尺寸
+	UpdatedAt   uint64 `field:"updatedAt"`   // 最后上传时间
 }
 
 type FileOperator struct {
@@ -29,6 +34,11 @@ type FileOperator struct {
 	State       interface{} // 状态
 	IsFinished  interface{} // 是否已完成上传
 	IsPublic    interface{} // 是否可以公开访问
+	Hash        interface{} // 内容SHA256
+	BlobId      interface{} // 文件数据ID
+	UploadHash  interface{} // 上传时声明的内容SHA256
+	ChunkSize   interface{} // 断点续传的分块尺寸
+	UpdatedAt   interface{} // 最后上传时间
 }
 
 func NewFileOperator() *FileOperator {
@@ -1 +1,13 @@
 package models
+
+// CountUploadChunks 断点续传时的片段数量，最多不超过 MaxFileUploadChunks
+func (this *File) CountUploadChunks() int {
+	if this.ChunkSize == 0 || this.Size == 0 {
+		return 0
+	}
+	var count = (int64(this.Size) + int64(this.ChunkSize) - 1) / int64(this.ChunkSize)
+	if count > MaxFileUploadChunks {
+		count = MaxFileUploadChunks
+	}
+	return int(count)
+}
@@ -0,0 +1,363 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/TeaOSLab/EdgeAPI/internal/accesslogs/archive"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"strings"
+	"time"
+)
+
+type HTTPAccessLogArchiveDAO dbs.DAO
+
+func NewHTTPAccessLogArchiveDAO() *HTTPAccessLogArchiveDAO {
+	return dbs.NewDAO(&HTTPAccessLogArchiveDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeHTTPAccessLogArchives",
+			Model:  new(HTTPAccessLogArchive),
+			PkName: "id",
+		},
+	}).(*HTTPAccessLogArchiveDAO)
+}
+
+var SharedHTTPAccessLogArchiveDAO *HTTPAccessLogArchiveDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedHTTPAccessLogArchiveDAO = NewHTTPAccessLogArchiveDAO()
+	})
+}
+
+// 归档文件中的一行，和日志表中的字段一一对应
+type httpAccessLogArchiveRow struct {
+	Id                  uint64 `json:"id"`
+	ServerId            uint32 `json:"serverId"`
+	NodeId              uint32 `json:"nodeId"`
+	Status              uint32 `json:"status"`
+	CreatedAt           uint64 `json:"createdAt"`
+	Content             string `json:"content"`
+	RequestId           string `json:"requestId"`
+	FirewallPolicyId    uint32 `json:"firewallPolicyId"`
+	FirewallRuleGroupId uint32 `json:"firewallRuleGroupId"`
+	FirewallRuleSetId   uint32 `json:"firewallRuleSetId"`
+	FirewallRuleId      uint32 `json:"firewallRuleId"`
+	RemoteAddr          string `json:"remoteAddr"`
+	Domain              string `json:"domain"`
+	RequestBody         []byte `json:"requestBody,omitempty"`  // 使用base64编码，以免二进制内容丢失
+	ResponseBody        []byte `json:"responseBody,omitempty"` // 使用base64编码，以免二进制内容丢失
+}
+
+var httpAccessLogArchiveColumns = []string{"id", "serverId", "nodeId", "status", "createdAt", "content", "requestId", "firewallPolicyId", "firewallRuleGroupId", "firewallRuleSetId", "firewallRuleId", "remoteAddr", "domain", "requestBody", "responseBody"}
+
+// ReadConfig 读取归档配置，没有配置时返回未启用的配置
+func (this *HTTPAccessLogArchiveDAO) ReadConfig(tx *dbs.Tx) (*archive.Config, error) {
+	configJSON, err := SharedSysSettingDAO.ReadSetting(tx, archive.SettingCode)
+	if err != nil {
+		return nil, err
+	}
+	var config = archive.NewConfig()
+	if len(configJSON) == 0 {
+		return config, nil
+	}
+	err = json.Unmarshal(configJSON, config)
+	if err != nil {
+		return nil, errors.New("decode archive config failed: " + err.Error())
+	}
+	if !config.IsOn {
+		return config, nil
+	}
+	err = config.Init()
+	if err != nil {
+		return nil, errors.New("invalid archive config: " + err.Error())
+	}
+	return config, nil
+}
+
+// FindArchive 查找某个数据库节点某一天的归档
+func (this *HTTPAccessLogArchiveDAO) FindArchive(tx *dbs.Tx, dbNodeId int64, day string) (*HTTPAccessLogArchive, error) {
+	one, err := this.Query(tx).
+		Attr("dbNodeId", dbNodeId).
+		Attr("day", day).
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*HTTPAccessLogArchive), nil
+}
+
+// FindAllArchivesWithDay 查找某一天的所有归档
+func (this *HTTPAccessLogArchiveDAO) FindAllArchivesWithDay(tx *dbs.Tx, day string) (result []*HTTPAccessLogArchive, err error) {
+	_, err = this.Query(tx).
+		Attr("day", day).
+		AscPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// UpdateArchiveRestored 设置归档最近一次恢复时间
+func (this *HTTPAccessLogArchiveDAO) UpdateArchiveRestored(tx *dbs.Tx, archiveId int64) error {
+	_, err := this.Query(tx).
+		Pk(archiveId).
+		Set("restoredAt", time.Now().Unix()).
+		Update()
+	return err
+}
+
+// ArchiveTable 将某个数据库中某一天的访问日志表归档到存储中
+// 表不存在时返回nil；同一天重复归档时会覆盖之前的归档
+func (this *HTTPAccessLogArchiveDAO) ArchiveTable(tx *dbs.Tx, db *dbs.DB, dbNodeId int64, day string, config *archive.Config) (*HTTPAccessLogArchive, error) {
+	tableDef, err := findHTTPAccessLogTable(db, day, false)
+	if err != nil {
+		return nil, err
+	}
+	if !tableDef.Exists {
+		return nil, nil
+	}
+
+	storage, err := config.NewStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	dao, err := this.accessLogDAO(db, tableDef.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var writer = archive.NewWriter(storage, tableDef.Name, day, dbNodeId, httpAccessLogArchiveColumns, config.RowsPerFile)
+	var lastId uint64 = 0
+	for {
+		var accessLogs []*HTTPAccessLog
+		_, err = dao.Query(nil).
+			Table(tableDef.Name).
+			Gt("id", lastId).
+			AscPk().
+			Limit(1000).
+			Slice(&accessLogs).
+			FindAll()
+		if err != nil {
+			writer.Abort()
+			return nil, err
+		}
+		if len(accessLogs) == 0 {
+			break
+		}
+		for _, accessLog := range accessLogs {
+			err = writer.Write(accessLog.Id, &httpAccessLogArchiveRow{
+				Id:                  accessLog.Id,
+				ServerId:            accessLog.ServerId,
+				NodeId:              accessLog.NodeId,
+				Status:              accessLog.Status,
+				CreatedAt:           accessLog.CreatedAt,
+				Content:             accessLog.Content,
+				RequestId:           accessLog.RequestId,
+				FirewallPolicyId:    accessLog.FirewallPolicyId,
+				FirewallRuleGroupId: accessLog.FirewallRuleGroupId,
+				FirewallRuleSetId:   accessLog.FirewallRuleSetId,
+				FirewallRuleId:      accessLog.FirewallRuleId,
+				RemoteAddr:          accessLog.RemoteAddr,
+				Domain:              accessLog.Domain,
+				RequestBody:         []byte(accessLog.RequestBody),
+				ResponseBody:        []byte(accessLog.ResponseBody),
+			})
+			if err != nil {
+				writer.Abort()
+				return nil, err
+			}
+		}
+		lastId = accessLogs[len(accessLogs)-1].Id
+	}
+
+	manifest, err := writer.Close()
+	if err != nil {
+		writer.Abort()
+		return nil, err
+	}
+
+	var now = time.Now().Unix()
+	var manifestKey = archive.ManifestKey(day, dbNodeId)
+	err = this.Query(tx).
+		InsertOrUpdateQuickly(maps.Map{
+			"dbNodeId":    dbNodeId,
+			"day":         day,
+			"tableName":   tableDef.Name,
+			"storageType": config.StorageType,
+			"manifestKey": manifestKey,
+			"countRows":   manifest.CountRows,
+			"countFiles":  len(manifest.Files),
+			"size":        manifest.Size,
+			"createdAt":   now,
+		}, maps.Map{
+			"tableName":   tableDef.Name,
+			"storageType": config.StorageType,
+			"manifestKey": manifestKey,
+			"countRows":   manifest.CountRows,
+			"countFiles":  len(manifest.Files),
+			"size":        manifest.Size,
+			"createdAt":   now,
+		})
+	if err != nil {
+		return nil, err
+	}
+	return this.FindArchive(tx, dbNodeId, day)
+}
+
+// RestoreArchive 将归档重新导入到数据库中
+// 使用原来的ID写入并忽略已存在的行，所以可以重复执行
+func (this *HTTPAccessLogArchiveDAO) RestoreArchive(tx *dbs.Tx, db *dbs.DB, accessLogArchive *HTTPAccessLogArchive, config *archive.Config) (countRows int64, err error) {
+	storage, err := config.NewStorage()
+	if err != nil {
+		return 0, err
+	}
+	manifest, err := archive.ReadManifest(storage, accessLogArchive.Day, int64(accessLogArchive.DbNodeId))
+	if err != nil {
+		return 0, err
+	}
+
+	tableDef, err := findHTTPAccessLogTable(db, manifest.Day, true)
+	if err != nil && strings.Contains(err.Error(), "1050") {
+		// 表格已经被其他API节点创建
+		tableDef, err = findHTTPAccessLogTable(db, manifest.Day, true)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var rows = []*httpAccessLogArchiveRow{}
+	err = archive.ReadFiles(storage, manifest, func(line []byte) error {
+		var row = &httpAccessLogArchiveRow{}
+		err := json.Unmarshal(line, row)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+		if len(rows) < HTTPAccessLogInsertRows {
+			return nil
+		}
+		err = this.insertArchiveRows(db, tableDef, rows)
+		if err != nil {
+			return err
+		}
+		countRows += int64(len(rows))
+		rows = rows[:0]
+		return nil
+	})
+	if err != nil {
+		return countRows, err
+	}
+	if len(rows) > 0 {
+		err = this.insertArchiveRows(db, tableDef, rows)
+		if err != nil {
+			return countRows, err
+		}
+		countRows += int64(len(rows))
+	}
+
+	err = this.UpdateArchiveRestored(tx, int64(accessLogArchive.Id))
+	if err != nil {
+		return countRows, err
+	}
+	return countRows, nil
+}
+
+// 批量写入归档中的行
+func (this *HTTPAccessLogArchiveDAO) insertArchiveRows(db *dbs.DB, tableDef *httpAccessLogDefinition, rows []*httpAccessLogArchiveRow) error {
+	var columns = []string{"id", "serverId", "nodeId", "status", "createdAt", "content", "requestId", "firewallPolicyId", "firewallRuleGroupId", "firewallRuleSetId", "firewallRuleId", "requestBody", "responseBody"}
+	if tableDef.HasRemoteAddr {
+		columns = append(columns, "remoteAddr")
+	}
+	if tableDef.HasDomain {
+		columns = append(columns, "domain")
+	}
+	var rowPlaceholder = "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+
+	var placeholders = make([]string, 0, len(rows))
+	var args = make([]interface{}, 0, len(rows)*len(columns))
+	for _, row := range rows {
+		placeholders = append(placeholders, rowPlaceholder)
+
+		// content为json字段，不能写入空字符串
+		var content interface{} = row.Content
+		if len(row.Content) == 0 {
+			content = nil
+		}
+		args = append(args, row.Id, row.ServerId, row.NodeId, row.Status, row.CreatedAt, content, row.RequestId, row.FirewallPolicyId, row.FirewallRuleGroupId, row.FirewallRuleSetId, row.FirewallRuleId, row.RequestBody, row.ResponseBody)
+		if tableDef.HasRemoteAddr {
+			args = append(args, row.RemoteAddr)
+		}
+		if tableDef.HasDomain {
+			args = append(args, row.Domain)
+		}
+	}
+
+	_, err := db.Exec("INSERT IGNORE INTO `"+tableDef.Name+"` (`"+strings.Join(columns, "`,`")+"`) VALUES "+strings.Join(placeholders, ","), args...)
+	return err
+}
+
+// 获取用来读取某个日志表的DAO
+func (this *HTTPAccessLogArchiveDAO) accessLogDAO(db *dbs.DB, tableName string) (*HTTPAccessLogDAO, error) {
+	var daoObject = dbs.DAOObject{
+		Instance: db,
+		DB:       db.Name(),
+		Table:    tableName,
+		PkName:   "id",
+		Model:    new(HTTPAccessLog),
+	}
+	err := daoObject.Init()
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPAccessLogDAO{
+		DAOObject: daoObject,
+	}, nil
+}
+
+// RestoreDay 恢复某一天的归档
+// dbNodeId 小于0时恢复所有数据库节点的归档；每个归档恢复后调用一次callback
+func (this *HTTPAccessLogArchiveDAO) RestoreDay(tx *dbs.Tx, day string, dbNodeId int64, callback func(accessLogArchive *HTTPAccessLogArchive, countRows int64)) error {
+	config, err := this.ReadConfig(tx)
+	if err != nil {
+		return err
+	}
+	if len(config.StorageType) == 0 {
+		return errors.New("access log archive has not been configured")
+	}
+	err = config.Init()
+	if err != nil {
+		return err
+	}
+
+	archives, err := this.FindAllArchivesWithDay(tx, day)
+	if err != nil {
+		return err
+	}
+	var found = false
+	for _, accessLogArchive := range archives {
+		if dbNodeId >= 0 && int64(accessLogArchive.DbNodeId) != dbNodeId {
+			continue
+		}
+		found = true
+
+		db, err := findAccessLogDB(int64(accessLogArchive.DbNodeId))
+		if err != nil {
+			return err
+		}
+		countRows, err := this.RestoreArchive(tx, db, accessLogArchive, config)
+		if err != nil {
+			return err
+		}
+		if callback != nil {
+			callback(accessLogArchive, countRows)
+		}
+	}
+	if !found {
+		return errors.New("can not find archives of day '" + day + "'")
+	}
+	return nil
+}
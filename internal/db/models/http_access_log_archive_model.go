@@ -0,0 +1,34 @@
+package models
+
+// HTTPAccessLogArchive 访问日志归档
+type HTTPAccessLogArchive struct {
+	Id          uint64 `field:"id"`          // ID
+	DbNodeId    uint32 `field:"dbNodeId"`    // 日志数据库节点ID，0表示默认数据库
+	Day         string `field:"day"`         // 日期YYYYMMDD
+	TableName   string `field:"tableName"`   // 原始表名
+	StorageType string `field:"storageType"` // 存储类型
+	ManifestKey string `field:"manifestKey"` // 清单对象名
+	CountRows   uint64 `field:"countRows"`   // 行数
+	CountFiles  uint32 `field:"countFiles"`  // 文件数
+	Size        uint64 `field:"size"`        // 尺寸
+	CreatedAt   uint64 `field:"createdAt"`   // 归档时间
+	RestoredAt  uint64 `field:"restoredAt"`  // 最近一次恢复时间
+}
+
+type HTTPAccessLogArchiveOperator struct {
+	Id          interface{} // ID
+	DbNodeId    interface{} // 日志数据库节点ID，0表示默认数据库
+	Day         interface{} // 日期YYYYMMDD
+	TableName   interface{} // 原始表名
+	StorageType interface{} // 存储类型
+	ManifestKey interface{} // 清单对象名
+	CountRows   interface{} // 行数
+	CountFiles  interface{} // 文件数
+	Size        interface{} // 尺寸
+	CreatedAt   interface{} // 归档时间
+	RestoredAt  interface{} // 最近一次恢复时间
+}
+
+func NewHTTPAccessLogArchiveOperator() *HTTPAccessLogArchiveOperator {
+	return &HTTPAccessLogArchiveOperator{}
+}
@@ -21,7 +21,6 @@ import (
 	"sort"
 	"strings"
 	"sync"
-	"time"
 )
 
 type HTTPAccessLogDAO dbs.DAO
@@ -46,19 +45,18 @@ func NewHTTPAccessLogDAO() *HTTPAccessLogDAO {
 }
 
 // CreateHTTPAccessLogs 创建访问日志
-func (this *HTTPAccessLogDAO) CreateHTTPAccessLogs(tx *dbs.Tx, accessLogs []*pb.HTTPAccessLog) error {
+// 日志通过写入队列异步写入，所以不使用事务
+func (this *HTTPAccessLogDAO) CreateHTTPAccessLogs(accessLogs []*pb.HTTPAccessLog) error {
 	dao := randomHTTPAccessLogDAO()
 	if dao == nil {
-		dao = &HTTPAccessLogDAOWrapper{
-			DAO:    SharedHTTPAccessLogDAO,
-			NodeId: 0,
-		}
+		dao = defaultHTTPAccessLogDAO()
 	}
-	return this.CreateHTTPAccessLogsWithDAO(tx, dao, accessLogs)
+	return this.CreateHTTPAccessLogsWithDAO(dao, accessLogs)
 }
 
 // CreateHTTPAccessLogsWithDAO 使用特定的DAO创建访问日志
-func (this *HTTPAccessLogDAO) CreateHTTPAccessLogsWithDAO(tx *dbs.Tx, daoWrapper *HTTPAccessLogDAOWrapper, accessLogs []*pb.HTTPAccessLog) error {
+// 日志会先放入DAO对应的写入队列，再由队列批量写入数据库；队列已满时返回 ErrAccessLogQueueFull
+func (this *HTTPAccessLogDAO) CreateHTTPAccessLogsWithDAO(daoWrapper *HTTPAccessLogDAOWrapper, accessLogs []*pb.HTTPAccessLog) error {
 	if daoWrapper == nil {
 		return errors.New("dao should not be nil")
 	}
@@ -66,67 +64,7 @@ func (this *HTTPAccessLogDAO) CreateHTTPAccessLogsWithDAO(tx *dbs.Tx, daoWrapper
 		return nil
 	}
 
-	dao := daoWrapper.DAO
-
-	// TODO 改成事务批量提交，以加快速度
-
-	for _, accessLog := range accessLogs {
-		day := timeutil.Format("Ymd", time.Unix(accessLog.Timestamp, 0))
-		tableDef, err := findHTTPAccessLogTable(dao.Instance, day, false)
-		if err != nil {
-			return err
-		}
-
-		fields := map[string]interface{}{}
-		fields["serverId"] = accessLog.ServerId
-		fields["nodeId"] = accessLog.NodeId
-		fields["status"] = accessLog.Status
-		fields["createdAt"] = accessLog.Timestamp
-		fields["requestId"] = accessLog.RequestId
-		fields["firewallPolicyId"] = accessLog.FirewallPolicyId
-		fields["firewallRuleGroupId"] = accessLog.FirewallRuleGroupId
-		fields["firewallRuleSetId"] = accessLog.FirewallRuleSetId
-		fields["firewallRuleId"] = accessLog.FirewallRuleId
-
-		// TODO 根据集群、服务设置获取IP
-		if tableDef.HasRemoteAddr {
-			fields["remoteAddr"] = accessLog.RemoteAddr
-		}
-		if tableDef.HasDomain {
-			fields["domain"] = accessLog.Host
-		}
-
-		content, err := json.Marshal(accessLog)
-		if err != nil {
-			return err
-		}
-		fields["content"] = content
-
-		_, err = dao.Query(tx).
-			Table(tableDef.Name).
-			Sets(fields).
-			Insert()
-		if err != nil {
-			// 是否为 Error 1146: Table 'xxx.xxx' doesn't exist  如果是，则创建表之后重试
-			if strings.Contains(err.Error(), "1146") {
-				tableDef, err = findHTTPAccessLogTable(dao.Instance, day, true)
-				if err != nil {
-					return err
-				}
-				_, err = dao.Query(tx).
-					Table(tableDef.Name).
-					Sets(fields).
-					Insert()
-				if err != nil {
-					return err
-				}
-			} else {
-				logs.Println("HTTP_ACCESS_LOG", err.Error())
-			}
-		}
-	}
-
-	return nil
+	return daoWrapper.Queue().Push(accessLogs)
 }
 
 // ListAccessLogs 读取往前的 单页访问日志
@@ -707,14 +645,6 @@ func (this *HTTPAccessLogDAO) SearchAccessLogs(tx *dbs.Tx, lastRequestId, day,
 // StatisticsTop 统计指定域名的攻击ip排行
 func (this *HTTPAccessLogDAO) StatisticsTop(tx *dbs.Tx,
 	day string, userId int64, ip2region func(string) (string, string, string)) (resp *StatisticsTop, err error) {
-
-	accessLogLocker.RLock()
-	daoList := []*HTTPAccessLogDAOWrapper{}
-	for _, daoWrapper := range httpAccessLogDAOMapping {
-		daoList = append(daoList, daoWrapper)
-	}
-	accessLogLocker.RUnlock()
-
 	serverIds := []int64{}
 	resp = &StatisticsTop{Tops: make([]*StatisticsTopItem, 0)}
 	if userId > 0 {
@@ -728,84 +658,55 @@ func (this *HTTPAccessLogDAO) StatisticsTop(tx *dbs.Tx,
 		}
 	}
 
-	if len(daoList) == 0 {
-		daoList = []*HTTPAccessLogDAOWrapper{{
-			DAO:    SharedHTTPAccessLogDAO,
-			NodeId: 0,
-		}}
-	}
-
-	locker := sync.Mutex{}
-	var result []*HTTPAccessLog
-	wg := &sync.WaitGroup{}
-	wg.Add(len(serverIds))
 	for _, serverId := range serverIds {
+		serverLogs, err := this.findRollupLogs(tx, day, HTTPAccessLogRollupDimensionIP, []int64{serverId}, true, 0)
+		if err != nil {
+			return nil, err
+		}
+		_, total, ips, region := statisticsTop(serverLogs, ip2region)
+		resp.Tops = append(resp.Tops, &StatisticsTopItem{ServerId: serverId, Total: total, Ips: ips, Region: region})
+	}
 
-		go func(serverId int64) {
-			defer wg.Done()
-
-			dwg := &sync.WaitGroup{}
-			dwg.Add(len(daoList))
-			l := sync.Mutex{}
-			serverLogs := make([]*HTTPAccessLog, 0)
-			for _, daoWrapper := range daoList {
-				go func(daoWrapper *HTTPAccessLogDAOWrapper) {
-					defer dwg.Done()
-
-					dao := daoWrapper.DAO
-
-					tableName, _, _, exists, err := findHTTPAccessLogTableName(dao.Instance, day)
-					if !exists {
-						// 表格不存在则跳过
-						return
-					}
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-
-					query := dao.Query(tx)
-
-					// 条件
-					query.Attr("serverId", serverId).
-						Reuse(false)
-
-					query.Where("firewallPolicyId>0")
-					query.UseIndex("firewallPolicyId")
-
-					var ones []*HTTPAccessLog
-					// 开始查询
-					_, err = query.
-						Table(tableName).
-						Group("remoteAddr").
-						Result("remoteAddr, COUNT(1) AS count").
-						Slice(&ones).
-						FindAll()
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-					l.Lock()
-					serverLogs = append(serverLogs, ones...)
-					l.Unlock()
-				}(daoWrapper)
-			}
-			dwg.Wait()
-			// 统计
-
-			mergeLogs, total, ips, region := statisticsTop(serverLogs, ip2region)
-
-			locker.Lock()
-			result = append(result, mergeLogs...)
-			resp.Tops = append(resp.Tops, &StatisticsTopItem{ServerId: serverId, Total: total, Ips: ips, Region: region})
-			locker.Unlock()
-		}(serverId)
+	// 所有服务
+	allLogs, err := this.findRollupLogs(tx, day, HTTPAccessLogRollupDimensionIP, serverIds, true, 0)
+	if err != nil {
+		return nil, err
 	}
-	wg.Wait()
-	_, total, ips, region := statisticsTop(result, ip2region)
+	_, total, ips, region := statisticsTop(allLogs, ip2region)
 	resp.Tops = append(resp.Tops, &StatisticsTopItem{ServerId: 0, Total: total, Ips: ips, Region: region})
 	return resp, nil
 }
+
+// 从汇总数据中读取某个维度的数据，并转换为访问日志格式
+// onlyAttack 为true时只读取攻击请求
+func (this *HTTPAccessLogDAO) findRollupLogs(tx *dbs.Tx, day string, dimension HTTPAccessLogRollupDimension, serverIds []int64, onlyAttack bool, size int64) ([]*HTTPAccessLog, error) {
+	rollups, err := SharedHTTPAccessLogRollupDAO.FindTopValues(tx, day, dimension, serverIds, onlyAttack, size)
+	if err != nil {
+		return nil, err
+	}
+	var result = make([]*HTTPAccessLog, 0, len(rollups))
+	for _, rollup := range rollups {
+		var accessLog = &HTTPAccessLog{
+			Count: int64(rollup.Count),
+		}
+		if onlyAttack {
+			accessLog.Count = int64(rollup.AttackCount)
+		}
+		switch dimension {
+		case HTTPAccessLogRollupDimensionIP:
+			accessLog.RemoteAddr = rollup.Value
+		case HTTPAccessLogRollupDimensionHost:
+			accessLog.Host = rollup.Value
+		case HTTPAccessLogRollupDimensionURI:
+			accessLog.Uri = rollup.Value
+		case HTTPAccessLogRollupDimensionStatus:
+			accessLog.Status = types.Uint32(rollup.Value)
+		}
+		result = append(result, accessLog)
+	}
+	return result, nil
+}
+
 func statisticsTop(result []*HTTPAccessLog, ip2region func(string) (string, string, string)) (mergeLogs []*HTTPAccessLog, total int64, ips IpCount, region RegionCount) {
 
 	// ip+city
@@ -911,14 +812,6 @@ func (this RegionCount) Swap(i, j int) {
 
 // Statistics 统计指定提起下用户的攻击次数
 func (this *HTTPAccessLogDAO) Statistics(tx *dbs.Tx, days []string, userId int64) (counts []int64, err error) {
-
-	accessLogLocker.RLock()
-	daoList := []*HTTPAccessLogDAOWrapper{}
-	for _, daoWrapper := range httpAccessLogDAOMapping {
-		daoList = append(daoList, daoWrapper)
-	}
-	accessLogLocker.RUnlock()
-
 	serverIds := []int64{}
 
 	if userId > 0 {
@@ -931,81 +824,22 @@ func (this *HTTPAccessLogDAO) Statistics(tx *dbs.Tx, days []string, userId int64
 			return
 		}
 	}
-	if len(daoList) == 0 {
-		daoList = []*HTTPAccessLogDAOWrapper{{
-			DAO:    SharedHTTPAccessLogDAO,
-			NodeId: 0,
-		}}
-	}
 	if len(days) == 0 {
 		return []int64{}, nil
 	}
 	counts = make([]int64, len(days))
-	locker := sync.Mutex{}
-
-	count := len(daoList)
-	wg := &sync.WaitGroup{}
-	wg.Add(count)
-	for _, daoWrapper := range daoList {
-		go func(daoWrapper *HTTPAccessLogDAOWrapper) {
-			defer wg.Done()
-
-			dao := daoWrapper.DAO
-			dwg := &sync.WaitGroup{}
-			dwg.Add(len(days))
-			for k, day := range days {
-				go func(k int, day string) {
-					defer dwg.Done()
-					tableName, _, _, exists, err := findHTTPAccessLogTableName(dao.Instance, day)
-					if !exists {
-						// 表格不存在则跳过
-						return
-					}
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-
-					query := dao.Query(tx)
-
-					// 条件
-					if userId > 0 && len(serverIds) > 0 {
-						query.Attr("serverId", serverIds).
-							Reuse(false)
-					}
-					query.Where("firewallPolicyId>0")
-					query.UseIndex("firewallPolicyId")
-					// 开始查询
-					c, err := query.
-						Table(tableName).
-						Count()
-
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-					locker.Lock()
-					counts[k] += c
-					locker.Unlock()
-				}(k, day)
-			}
-			dwg.Wait()
-		}(daoWrapper)
+	for k, day := range days {
+		_, attackCount, err := SharedHTTPAccessLogRollupDAO.CountTotal(tx, day, serverIds)
+		if err != nil {
+			return nil, err
+		}
+		counts[k] = attackCount
 	}
-	wg.Wait()
 	return counts, nil
 }
 
 // StatisticsType 统计各类型策略的条数
 func (this *HTTPAccessLogDAO) StatisticsType(tx *dbs.Tx, day string, userId int64) (attacks []*AttackType, err error) {
-
-	accessLogLocker.RLock()
-	daoList := []*HTTPAccessLogDAOWrapper{}
-	for _, daoWrapper := range httpAccessLogDAOMapping {
-		daoList = append(daoList, daoWrapper)
-	}
-	accessLogLocker.RUnlock()
-
 	serverIds := []int64{}
 
 	if userId > 0 {
@@ -1019,13 +853,6 @@ func (this *HTTPAccessLogDAO) StatisticsType(tx *dbs.Tx, day string, userId int6
 		}
 	}
 
-	if len(daoList) == 0 {
-		daoList = []*HTTPAccessLogDAOWrapper{{
-			DAO:    SharedHTTPAccessLogDAO,
-			NodeId: 0,
-		}}
-	}
-
 	var attacks1 = make([]AttackType, 0)
 	attacks = make([]*AttackType, 0)
 
@@ -1043,98 +870,35 @@ func (this *HTTPAccessLogDAO) StatisticsType(tx *dbs.Tx, day string, userId int6
 		})
 	}
 
-	locker := sync.Mutex{}
-	wg := &sync.WaitGroup{}
-	wg.Add(len(serverIds))
-
 	for _, serverId := range serverIds {
-		go func(serverId int64) {
-			defer wg.Done()
+		rollups, err := SharedHTTPAccessLogRollupDAO.FindTopValues(tx, day, HTTPAccessLogRollupDimensionAttackGroup, []int64{serverId}, true, 0)
+		if err != nil {
+			return nil, err
+		}
+		var groupCounts = map[int64]int64{} // groupId => count
+		for _, rollup := range rollups {
+			groupCounts[types.Int64(rollup.Value)] += int64(rollup.AttackCount)
+		}
 
-			gwg := &sync.WaitGroup{}
-			gwg.Add(len(attacks1))
-			for k, group := range attacks1 {
-				go func(k int, group AttackType) {
-					defer gwg.Done()
-					dwg := &sync.WaitGroup{}
-					dwg.Add(len(daoList))
-					var count int64
-					for _, daoWrapper := range daoList {
-						go func(daoWrapper *HTTPAccessLogDAOWrapper, count *int64) {
-							defer dwg.Done()
-							dao := daoWrapper.DAO
-							tableName, _, _, exists, err := findHTTPAccessLogTableName(dao.Instance, day)
-							if !exists {
-								// 表格不存在则跳过
-								return
-							}
-							if err != nil {
-								logs.Println("[DB_NODE]" + err.Error())
-								return
-							}
-							query := dao.Query(tx)
-
-							// 条件
-							query.Attr("serverId", serverId).
-								Reuse(false)
-
-							query.Where("firewallPolicyId>0")
-							query.UseIndex("firewallPolicyId")
-
-							// 开始查询
-							var c int64
-							if len(group.ids) == 0 {
-								c = 0
-							} else {
-								c, err = query.
-									Table(tableName).
-									Where(fmt.Sprintf("firewallRuleGroupId in (%s)", func(ids []int64) string {
-										r := ""
-										for _, id := range ids {
-											r += fmt.Sprintf("%d,", id)
-										}
-										return r[:len(r)-1]
-									}(group.ids))).
-									Count()
-								if err != nil {
-									logs.Println("[DB_NODE]" + err.Error())
-									return
-								}
-							}
-							locker.Lock()
-							*count += c
-							locker.Unlock()
-						}(daoWrapper, &count)
-					}
-					dwg.Wait()
-					locker.Lock()
-					attacks = append(attacks, &AttackType{
-						Code:     attacks1[k].Code,
-						Name:     attacks1[k].Name,
-						ServerId: serverId,
-						Count:    count,
-					})
-					locker.Unlock()
-				}(k, group)
+		for _, group := range attacks1 {
+			var count int64
+			for _, groupId := range group.ids {
+				count += groupCounts[groupId]
 			}
-			gwg.Wait()
-		}(serverId)
+			attacks = append(attacks, &AttackType{
+				Code:     group.Code,
+				Name:     group.Name,
+				ServerId: serverId,
+				Count:    count,
+			})
+		}
 	}
-	wg.Wait()
 
 	return attacks, nil
 }
 
 // AccessStatistics 统计访问条数 访问总次数  防护总次数 访问IP总数 拦截IP总数
 func (this *HTTPAccessLogDAO) AccessStatistics(tx *dbs.Tx, day string, userId int64) (stats []*AccessStatistics, err error) {
-
-	accessLogLocker.RLock()
-	daoList := []*HTTPAccessLogDAOWrapper{}
-	for _, daoWrapper := range httpAccessLogDAOMapping {
-		daoList = append(daoList, daoWrapper)
-	}
-	accessLogLocker.RUnlock()
-
 	serverIds := []int64{}
 
 	if userId > 0 {
@@ -1148,127 +912,36 @@ func (this *HTTPAccessLogDAO) AccessStatistics(tx *dbs.Tx, day string, userId in
 		}
 	}
 
-	if len(daoList) == 0 {
-		daoList = []*HTTPAccessLogDAOWrapper{{
-			DAO:    SharedHTTPAccessLogDAO,
-			NodeId: 0,
-		}}
-	}
-
-	locker := sync.Mutex{}
 	stats = make([]*AccessStatistics, 0)
-	count := len(serverIds)
-	wg := &sync.WaitGroup{}
-	wg.Add(count)
 	for _, serverId := range serverIds {
+		stat := &AccessStatistics{ServerId: serverId}
 
-		go func(serverId int64) {
-			defer wg.Done()
+		// 访问总数和防护总数
+		stat.AccessTotal, stat.AttackTotal, err = SharedHTTPAccessLogRollupDAO.CountTotal(tx, day, []int64{serverId})
+		if err != nil {
+			return nil, err
+		}
 
-			dwg := &sync.WaitGroup{}
-			dwg.Add(len(daoList))
-			stat := &AccessStatistics{ServerId: serverId}
-			//访问IP地址列表
-			svrAddrStats1 := []*HTTPAccessLog{}
-			// 攻击访问IP地址列表
-			svrAddrStats2 := []*HTTPAccessLog{}
-			for _, daoWrapper := range daoList {
-				go func(daoWrapper *HTTPAccessLogDAOWrapper, stat *AccessStatistics) {
-					defer dwg.Done()
-
-					dao := daoWrapper.DAO
-					tableName, _, _, exists, err := findHTTPAccessLogTableName(dao.Instance, day)
-					if !exists {
-						// 表格不存在则跳过
-						return
-					}
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-					// 1. 统计该服务的服务总数
-					accessTotal, err := dao.Query(tx).Attr("serverId", serverId).
-						Reuse(false).
-						Table(tableName).
-						Count()
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-					// 2. 统计防护的总数
-					attackTotal, err := dao.Query(tx).Attr("serverId", serverId).
-						Reuse(false).Where("firewallPolicyId>0").UseIndex("firewallPolicyId").
-						Table(tableName).
-						Count()
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-					// 3. 访问IP列表
-					var logs1 []*HTTPAccessLog
-					_, err = dao.Query(tx).SQL(fmt.Sprintf("SELECT  `remoteAddr` FROM `%s`"+
-						" WHERE `serverId`=%d GROUP BY `remoteAddr`", tableName, serverId)).Slice(&logs1).
-						FindAll()
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-					// 4. 拦截IP列表
-					var logs2 []*HTTPAccessLog
-					_, err = dao.Query(tx).SQL(fmt.Sprintf("SELECT  `remoteAddr` FROM `%s` WHERE `serverId`=%d and `firewallPolicyId`>0 GROUP BY `remoteAddr`", tableName, serverId)).Slice(&logs2).
-						FindAll()
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-					locker.Lock()
-					stat.AccessTotal += accessTotal
-					stat.AttackTotal += attackTotal
-					svrAddrStats1 = append(svrAddrStats1, logs1...)
-					svrAddrStats2 = append(svrAddrStats2, logs2...)
-					locker.Unlock()
-				}(daoWrapper, stat)
-			}
-			dwg.Wait()
-			// 访问IP地址列表 差重map
-			fraddr1 := map[string]bool{}
-			// 攻击IP地址列表 差重map
-			fraddr2 := map[string]bool{}
-			locker.Lock()
-			for _, v := range svrAddrStats1 {
-				if _, ok := fraddr1[v.RemoteAddr]; !ok {
-					fraddr1[v.RemoteAddr] = true
-					stat.AccessIpTotal++
-				}
-			}
-			for _, v := range svrAddrStats2 {
-				if _, ok := fraddr2[v.RemoteAddr]; !ok {
-					fraddr2[v.RemoteAddr] = true
-					stat.AttackIpTotal++
-				}
-			}
-			stats = append(stats, stat)
-			locker.Unlock()
-		}(serverId)
+		// 访问IP总数
+		stat.AccessIpTotal, err = SharedHTTPAccessLogRollupDAO.CountValues(tx, day, HTTPAccessLogRollupDimensionIP, []int64{serverId}, false)
+		if err != nil {
+			return nil, err
+		}
+
+		// 拦截IP总数
+		stat.AttackIpTotal, err = SharedHTTPAccessLogRollupDAO.CountValues(tx, day, HTTPAccessLogRollupDimensionIP, []int64{serverId}, true)
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, stat)
 	}
-	wg.Wait()
 
 	return stats, nil
 }
 
 // AttackURLTop 统计最受攻击的域名排行
 func (this *HTTPAccessLogDAO) AttackURLTop(tx *dbs.Tx, day string, userId int64) (resp *AttackURLTop, err error) {
-	accessLogLocker.RLock()
-	daoList := []*HTTPAccessLogDAOWrapper{}
-	for _, daoWrapper := range httpAccessLogDAOMapping {
-		daoList = append(daoList, daoWrapper)
-	}
-	accessLogLocker.RUnlock()
-
 	serverIds := []int64{}
 	resp = &AttackURLTop{Tops: make([]*AttackUrlTopItem1, 0)}
 	if userId > 0 {
@@ -1282,111 +955,29 @@ func (this *HTTPAccessLogDAO) AttackURLTop(tx *dbs.Tx, day string, userId int64)
 		}
 	}
 
-	if len(daoList) == 0 {
-		daoList = []*HTTPAccessLogDAOWrapper{{
-			DAO:    SharedHTTPAccessLogDAO,
-			NodeId: 0,
-		}}
-	}
-
-	locker := sync.Mutex{}
-	hostStats := make([]*HTTPAccessLog, 0)
-	uriStats := make([]*HTTPAccessLog, 0)
-
-	wg := &sync.WaitGroup{}
-	wg.Add(len(serverIds))
 	for _, serverId := range serverIds {
-
-		l := sync.Mutex{}
-		serverHostStats := make([]*HTTPAccessLog, 0)
-		serverUriStats := make([]*HTTPAccessLog, 0)
-
-		dwg := &sync.WaitGroup{}
-		dwg.Add(len(daoList))
-		go func(serverId int64) {
-			defer wg.Done()
-
-			for _, daoWrapper := range daoList {
-				go func(daoWrapper *HTTPAccessLogDAOWrapper) {
-					defer dwg.Done()
-
-					dao := daoWrapper.DAO
-					tableName, _, _, exists, err := findHTTPAccessLogTableName(dao.Instance, day)
-					if !exists {
-						// 表格不存在则跳过
-						return
-					}
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-
-					// 开始查询 - 统计域名
-					query := dao.Query(tx)
-
-					// 条件
-					query.Attr("serverId", serverId).
-						Reuse(false)
-
-					query.Where("firewallPolicyId>0")
-					query.UseIndex("firewallPolicyId")
-
-					var ones []*HTTPAccessLog
-
-					// 开始查询
-					_, err = query.
-						Table(tableName).
-						Group("host").
-						Result("TRIM(BOTH '\"' FROM json_extract(content,'$.host')) AS host, COUNT(*) AS count").
-						Slice(&ones).
-						FindAll()
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-					l.Lock()
-					serverHostStats = append(serverHostStats, ones...)
-					l.Unlock()
-
-					ones = make([]*HTTPAccessLog, 0)
-					// 开始查询 - 统计URI
-					query = dao.Query(tx)
-
-					// 条件
-					query.Attr("serverId", serverId).
-						Reuse(false)
-
-					query.Where("firewallPolicyId>0")
-					query.UseIndex("firewallPolicyId")
-
-					// 开始查询
-					_, err = query.
-						Table(tableName).
-						Group("uri").
-						Result("TRIM(BOTH '\"' FROM json_extract(content,'$.requestURI')) AS uri, COUNT(*) AS count").
-						Slice(&ones).
-						FindAll()
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-					l.Lock()
-					serverUriStats = append(serverUriStats, ones...)
-					l.Unlock()
-				}(daoWrapper)
-			}
-		}(serverId)
-		dwg.Wait()
-		mergeHostStats, hostCountStu := statisticsHostTop(serverHostStats)
-		serverUriStats, uriCountStu := statisticsUriTop(serverUriStats)
-		locker.Lock()
-		hostStats = append(hostStats, mergeHostStats...)
-		uriStats = append(uriStats, serverUriStats...)
+		serverHostStats, err := this.findRollupLogs(tx, day, HTTPAccessLogRollupDimensionHost, []int64{serverId}, true, 0)
+		if err != nil {
+			return nil, err
+		}
+		serverUriStats, err := this.findRollupLogs(tx, day, HTTPAccessLogRollupDimensionURI, []int64{serverId}, true, 0)
+		if err != nil {
+			return nil, err
+		}
+		_, hostCountStu := statisticsHostTop(serverHostStats)
+		_, uriCountStu := statisticsUriTop(serverUriStats)
 		resp.Tops = append(resp.Tops, &AttackUrlTopItem1{ServerId: serverId, Hosts: hostCountStu, Uris: uriCountStu})
-		locker.Unlock()
 	}
-	wg.Wait()
 
+	// 所有服务
+	hostStats, err := this.findRollupLogs(tx, day, HTTPAccessLogRollupDimensionHost, serverIds, true, 0)
+	if err != nil {
+		return nil, err
+	}
+	uriStats, err := this.findRollupLogs(tx, day, HTTPAccessLogRollupDimensionURI, serverIds, true, 0)
+	if err != nil {
+		return nil, err
+	}
 	_, hostCountStu := statisticsHostTop(hostStats)
 	_, uriCountStu := statisticsUriTop(uriStats)
 	resp.Tops = append(resp.Tops, &AttackUrlTopItem1{ServerId: 0, Hosts: hostCountStu, Uris: uriCountStu})
@@ -1451,13 +1042,6 @@ func statisticsHostTop(serverStats []*HTTPAccessLog) ([]*HTTPAccessLog, *ValueCo
 
 // AccessIPTop 客户端访问IP排行
 func (this *HTTPAccessLogDAO) AccessIPTop(tx *dbs.Tx, day string, userId int64, top int) (resp *AccessIPTop, err error) {
-	accessLogLocker.RLock()
-	daoList := []*HTTPAccessLogDAOWrapper{}
-	for _, daoWrapper := range httpAccessLogDAOMapping {
-		daoList = append(daoList, daoWrapper)
-	}
-	accessLogLocker.RUnlock()
-
 	serverIds := []int64{}
 	resp = &AccessIPTop{Tops: make([]*AccessIPTopItem, 0)}
 	if userId > 0 {
@@ -1471,76 +1055,20 @@ func (this *HTTPAccessLogDAO) AccessIPTop(tx *dbs.Tx, day string, userId int64,
 		}
 	}
 
-	if len(daoList) == 0 {
-		daoList = []*HTTPAccessLogDAOWrapper{{
-			DAO:    SharedHTTPAccessLogDAO,
-			NodeId: 0,
-		}}
-	}
-
-	locker := sync.Mutex{}
-	stats := make([]*HTTPAccessLog, 0)
-	wg := &sync.WaitGroup{}
-	wg.Add(len(serverIds))
 	for _, serverId := range serverIds {
-
-		go func(serverId int64) {
-			defer wg.Done()
-
-			l := sync.Mutex{}
-			serverLogs := make([]*HTTPAccessLog, 0)
-
-			dwg := &sync.WaitGroup{}
-			dwg.Add(len(daoList))
-			for _, daoWrapper := range daoList {
-				go func(daoWrapper *HTTPAccessLogDAOWrapper) {
-					defer dwg.Done()
-
-					dao := daoWrapper.DAO
-					tableName, _, _, exists, err := findHTTPAccessLogTableName(dao.Instance, day)
-					if !exists {
-						// 表格不存在则跳过
-						return
-					}
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-
-					// 开始查询
-					query := dao.Query(tx)
-
-					// 条件
-					query.Attr("serverId", serverId).
-						Reuse(false)
-
-					var ones []*HTTPAccessLog
-					// 开始查询
-					_, err = query.
-						Table(tableName).
-						Group("remoteAddr").
-						Result("remoteAddr, COUNT(1) AS count").
-						Slice(&ones).
-						FindAll()
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-					l.Lock()
-					serverLogs = append(serverLogs, ones...)
-					l.Unlock()
-				}(daoWrapper)
-			}
-			dwg.Wait()
-			mergeStats, ipCountStu := statisticsAccessIpTop(serverLogs, top)
-			locker.Lock()
-			stats = append(stats, mergeStats...)
-			resp.Tops = append(resp.Tops, &AccessIPTopItem{ServerId: serverId, Counts: ipCountStu.Count, IPs: ipCountStu.IP})
-			locker.Unlock()
-		}(serverId)
+		serverLogs, err := this.findRollupLogs(tx, day, HTTPAccessLogRollupDimensionIP, []int64{serverId}, false, int64(top))
+		if err != nil {
+			return nil, err
+		}
+		_, ipCountStu := statisticsAccessIpTop(serverLogs, top)
+		resp.Tops = append(resp.Tops, &AccessIPTopItem{ServerId: serverId, Counts: ipCountStu.Count, IPs: ipCountStu.IP})
 	}
-	wg.Wait()
 
+	// 所有服务
+	stats, err := this.findRollupLogs(tx, day, HTTPAccessLogRollupDimensionIP, serverIds, false, int64(top))
+	if err != nil {
+		return nil, err
+	}
 	_, ipCountStu := statisticsAccessIpTop(stats, top)
 	resp.Tops = append(resp.Tops, &AccessIPTopItem{ServerId: 0, Counts: ipCountStu.Count, IPs: ipCountStu.IP})
 	return resp, nil
@@ -1604,13 +1132,6 @@ func statisticsStatusCodeTop(serverStats []*HTTPAccessLog) ([]*HTTPAccessLog, *C
 
 // StatusCodeStatistics 客户端访问IP排行
 func (this *HTTPAccessLogDAO) StatusCodeStatistics(tx *dbs.Tx, day string, userId int64) (resp *StatusCodeTop, err error) {
-	accessLogLocker.RLock()
-	daoList := []*HTTPAccessLogDAOWrapper{}
-	for _, daoWrapper := range httpAccessLogDAOMapping {
-		daoList = append(daoList, daoWrapper)
-	}
-	accessLogLocker.RUnlock()
-
 	serverIds := []int64{}
 	resp = &StatusCodeTop{Tops: make([]*StatusCodeTopItem, 0)}
 	if userId > 0 {
@@ -1624,78 +1145,22 @@ func (this *HTTPAccessLogDAO) StatusCodeStatistics(tx *dbs.Tx, day string, userI
 		}
 	}
 
-	if len(daoList) == 0 {
-		daoList = []*HTTPAccessLogDAOWrapper{{
-			DAO:    SharedHTTPAccessLogDAO,
-			NodeId: 0,
-		}}
-	}
-
-	locker := sync.Mutex{}
-	stats := make([]*HTTPAccessLog, 0)
-	wg := &sync.WaitGroup{}
-	wg.Add(len(serverIds))
 	for _, serverId := range serverIds {
-
-		go func(serverId int64) {
-			defer wg.Done()
-
-			l := sync.Mutex{}
-			serverLogs := make([]*HTTPAccessLog, 0)
-
-			dwg := &sync.WaitGroup{}
-			dwg.Add(len(daoList))
-			for _, daoWrapper := range daoList {
-				go func(daoWrapper *HTTPAccessLogDAOWrapper) {
-					defer dwg.Done()
-
-					dao := daoWrapper.DAO
-					tableName, _, _, exists, err := findHTTPAccessLogTableName(dao.Instance, day)
-					if !exists {
-						// 表格不存在则跳过
-						return
-					}
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-
-					// 开始查询
-					query := dao.Query(tx)
-
-					// 条件
-					query.Attr("serverId", serverId).
-						Reuse(false)
-
-					var ones []*HTTPAccessLog
-					// 开始查询
-					_, err = query.
-						Table(tableName).
-						Group("status").
-						Result("status, COUNT(1) AS count").
-						Slice(&ones).
-						FindAll()
-					if err != nil {
-						logs.Println("[DB_NODE]" + err.Error())
-						return
-					}
-					l.Lock()
-					serverLogs = append(serverLogs, ones...)
-					l.Unlock()
-				}(daoWrapper)
-			}
-			dwg.Wait()
-			mergeStats, codeCountStu := statisticsStatusCodeTop(serverLogs)
-			locker.Lock()
-			stats = append(stats, mergeStats...)
-			resp.Tops = append(resp.Tops, &StatusCodeTopItem{ServerId: serverId, Counts: codeCountStu.Count, Codes: codeCountStu.Code})
-			locker.Unlock()
-		}(serverId)
+		serverLogs, err := this.findRollupLogs(tx, day, HTTPAccessLogRollupDimensionStatus, []int64{serverId}, false, 0)
+		if err != nil {
+			return nil, err
+		}
+		_, codeCountStu := statisticsStatusCodeTop(serverLogs)
+		resp.Tops = append(resp.Tops, &StatusCodeTopItem{ServerId: serverId, Counts: codeCountStu.Count, Codes: codeCountStu.Code})
 	}
-	wg.Wait()
 
-	_, ipCountStu := statisticsStatusCodeTop(stats)
-	resp.Tops = append(resp.Tops, &StatusCodeTopItem{ServerId: 0, Counts: ipCountStu.Count, Codes: ipCountStu.Code})
+	// 所有服务
+	stats, err := this.findRollupLogs(tx, day, HTTPAccessLogRollupDimensionStatus, serverIds, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, codeCountStu := statisticsStatusCodeTop(stats)
+	resp.Tops = append(resp.Tops, &StatusCodeTopItem{ServerId: 0, Counts: codeCountStu.Count, Codes: codeCountStu.Code})
 	return resp, nil
 }
 
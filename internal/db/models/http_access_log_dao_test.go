@@ -12,8 +12,6 @@ import (
 )
 
 func TestCreateHTTPAccessLogs(t *testing.T) {
-	var tx *dbs.Tx
-
 	err := NewDBNodeInitializer().loop()
 	if err != nil {
 		t.Fatal(err)
@@ -27,7 +25,7 @@ func TestCreateHTTPAccessLogs(t *testing.T) {
 	}
 	dao := randomHTTPAccessLogDAO()
 	t.Log("dao:", dao)
-	err = SharedHTTPAccessLogDAO.CreateHTTPAccessLogsWithDAO(tx, dao, []*pb.HTTPAccessLog{accessLog})
+	err = SharedHTTPAccessLogDAO.CreateHTTPAccessLogsWithDAO(dao, []*pb.HTTPAccessLog{accessLog})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,398 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"time"
+)
+
+const (
+	HTTPAccessLogExportStateEnabled  = 1 // 已启用
+	HTTPAccessLogExportStateDisabled = 0 // 已禁用
+)
+
+type HTTPAccessLogExportStatus = uint8
+
+const (
+	HTTPAccessLogExportStatusPending HTTPAccessLogExportStatus = 0 // 等待执行
+	HTTPAccessLogExportStatusRunning HTTPAccessLogExportStatus = 1 // 执行中
+	HTTPAccessLogExportStatusDone    HTTPAccessLogExportStatus = 2 // 已完成
+	HTTPAccessLogExportStatusFailed  HTTPAccessLogExportStatus = 3 // 失败
+)
+
+type HTTPAccessLogExportFormat = string
+
+const (
+	HTTPAccessLogExportFormatNDJSON HTTPAccessLogExportFormat = "ndjson"
+	HTTPAccessLogExportFormatCSV    HTTPAccessLogExportFormat = "csv"
+)
+
+const (
+	HTTPAccessLogExportFileType      = "accessLogExport" // 导出文件在文件管理中的类型
+	HTTPAccessLogExportExpireSeconds = 7 * 86400         // 导出文件保留时间
+	HTTPAccessLogExportStaleSeconds  = 300               // 执行中的任务超过此时间没有更新，则认为执行任务的API节点已退出
+	HTTPAccessLogExportMaxSeconds    = 93 * 86400        // 单个任务最长时间范围
+)
+
+// ErrHTTPAccessLogExportLost 任务已被其他执行者领取
+var ErrHTTPAccessLogExportLost = errors.New("the export has been claimed by another runner")
+
+type HTTPAccessLogExportDAO dbs.DAO
+
+func init() {
+	dbs.OnReadyDone(func() {
+		// 清理过期的导出
+		var ticker = time.NewTicker(1 * time.Hour)
+		go func() {
+			for range ticker.C {
+				err := SharedHTTPAccessLogExportDAO.CleanExpiredExports(nil)
+				if err != nil {
+					remotelogs.Error("SharedHTTPAccessLogExportDAO", "clean expired data failed: "+err.Error())
+				}
+			}
+		}()
+	})
+}
+
+func NewHTTPAccessLogExportDAO() *HTTPAccessLogExportDAO {
+	return dbs.NewDAO(&HTTPAccessLogExportDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeHTTPAccessLogExports",
+			Model:  new(HTTPAccessLogExport),
+			PkName: "id",
+		},
+	}).(*HTTPAccessLogExportDAO)
+}
+
+var SharedHTTPAccessLogExportDAO *HTTPAccessLogExportDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedHTTPAccessLogExportDAO = NewHTTPAccessLogExportDAO()
+	})
+}
+
+// DisableExport 禁用条目
+// 执行中的任务会在下次更新进度时退出
+func (this *HTTPAccessLogExportDAO) DisableExport(tx *dbs.Tx, exportId int64) error {
+	export, err := this.FindEnabledExport(tx, exportId)
+	if err != nil {
+		return err
+	}
+	if export == nil {
+		return nil
+	}
+
+	_, err = this.Query(tx).
+		Pk(exportId).
+		Set("state", HTTPAccessLogExportStateDisabled).
+		Update()
+	if err != nil {
+		return err
+	}
+
+	// 正在执行的任务由执行者删除文件
+	if export.Status != HTTPAccessLogExportStatusRunning {
+		return this.deleteExportFile(tx, int64(export.FileId))
+	}
+	return nil
+}
+
+// FindEnabledExport 查找启用中的条目
+func (this *HTTPAccessLogExportDAO) FindEnabledExport(tx *dbs.Tx, exportId int64) (*HTTPAccessLogExport, error) {
+	result, err := this.Query(tx).
+		Pk(exportId).
+		Attr("state", HTTPAccessLogExportStateEnabled).
+		Find()
+	if result == nil {
+		return nil, err
+	}
+	return result.(*HTTPAccessLogExport), err
+}
+
+// CreateExport 创建导出任务
+func (this *HTTPAccessLogExportDAO) CreateExport(tx *dbs.Tx, adminId int64, userId int64, serverId int64, query string, format HTTPAccessLogExportFormat, timeFrom int64, timeTo int64) (int64, error) {
+	if format != HTTPAccessLogExportFormatNDJSON && format != HTTPAccessLogExportFormatCSV {
+		return 0, errors.New("invalid format '" + format + "'")
+	}
+	if timeFrom <= 0 || timeTo <= timeFrom {
+		return 0, errors.New("invalid time range")
+	}
+	if timeTo-timeFrom > HTTPAccessLogExportMaxSeconds {
+		return 0, errors.New("time range should not be longer than 93 days")
+	}
+
+	op := NewHTTPAccessLogExportOperator()
+	op.AdminId = adminId
+	op.UserId = userId
+	op.ServerId = serverId
+	op.Query = query
+	op.Format = format
+	op.TimeFrom = timeFrom
+	op.TimeTo = timeTo
+	op.Status = HTTPAccessLogExportStatusPending
+	op.UpdatedAt = time.Now().Unix()
+	op.State = HTTPAccessLogExportStateEnabled
+	return this.SaveInt64(tx, op)
+}
+
+// CountEnabledExports 计算导出任务数量
+// adminId和userId都为0时表示所有任务
+func (this *HTTPAccessLogExportDAO) CountEnabledExports(tx *dbs.Tx, adminId int64, userId int64, serverId int64) (int64, error) {
+	return this.exportsQuery(tx, adminId, userId, serverId).Count()
+}
+
+// ListEnabledExports 列出单页导出任务
+func (this *HTTPAccessLogExportDAO) ListEnabledExports(tx *dbs.Tx, adminId int64, userId int64, serverId int64, offset int64, size int64) (result []*HTTPAccessLogExport, err error) {
+	_, err = this.exportsQuery(tx, adminId, userId, serverId).
+		Offset(offset).
+		Limit(size).
+		DescPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// ClaimPendingExport 领取一个等待执行的任务，并将其状态改为执行中
+// 执行者长时间没有更新心跳的任务会被重新领取；每次领取都会生成新的执行令牌，旧的执行者在更新时会因为令牌不一致而退出
+// 需要在锁内调用，以免多个API节点领取同一个任务
+func (this *HTTPAccessLogExportDAO) ClaimPendingExport(tx *dbs.Tx) (*HTTPAccessLogExport, error) {
+	one, err := this.Query(tx).
+		Attr("state", HTTPAccessLogExportStateEnabled).
+		Where("(status=:pendingStatus OR (status=:runningStatus AND updatedAt<:staleTime))").
+		Param("pendingStatus", HTTPAccessLogExportStatusPending).
+		Param("runningStatus", HTTPAccessLogExportStatusRunning).
+		Param("staleTime", time.Now().Unix()-HTTPAccessLogExportStaleSeconds).
+		AscPk().
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	var export = one.(*HTTPAccessLogExport)
+
+	runToken, err := this.generateRunToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// 先更换令牌，让上一个执行者停止写入，再丢弃上次未完成的文件
+	var now = time.Now().Unix()
+	rows, err := this.Query(tx).
+		Pk(export.Id).
+		Attr("status", export.Status).
+		Attr("updatedAt", export.UpdatedAt).
+		Set("status", HTTPAccessLogExportStatusRunning).
+		Set("runToken", runToken).
+		Set("progress", 0).
+		Set("countLogs", 0).
+		Set("fileId", 0).
+		Set("size", 0).
+		Set("error", "").
+		Set("startedAt", now).
+		Set("updatedAt", now).
+		Update()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		// 在查询之后已被其他执行者更新
+		return nil, nil
+	}
+
+	err = this.deleteExportFile(tx, int64(export.FileId))
+	if err != nil {
+		return nil, err
+	}
+
+	export.Status = HTTPAccessLogExportStatusRunning
+	export.RunToken = runToken
+	export.FileId = 0
+	return export, nil
+}
+
+// UpdateExportFile 设置导出文件
+func (this *HTTPAccessLogExportDAO) UpdateExportFile(tx *dbs.Tx, exportId int64, runToken string, fileId int64) (isValid bool, err error) {
+	_, err = this.runningQuery(tx, exportId, runToken).
+		Set("fileId", fileId).
+		Set("updatedAt", time.Now().Unix()).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return this.CheckExportRunning(tx, exportId, runToken)
+}
+
+// UpdateExportProgress 更新进度
+// 返回任务是否仍然有效，如果已被删除或者被其他执行者领取则执行者应当退出
+func (this *HTTPAccessLogExportDAO) UpdateExportProgress(tx *dbs.Tx, exportId int64, runToken string, progress int, countLogs int64, size int64) (isValid bool, err error) {
+	if progress > 100 {
+		progress = 100
+	}
+	_, err = this.runningQuery(tx, exportId, runToken).
+		Set("progress", progress).
+		Set("countLogs", countLogs).
+		Set("size", size).
+		Set("updatedAt", time.Now().Unix()).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return this.CheckExportRunning(tx, exportId, runToken)
+}
+
+// UpdateExportHeartbeat 更新心跳，防止执行时间较长的任务被重新领取
+// 返回任务是否仍然有效
+func (this *HTTPAccessLogExportDAO) UpdateExportHeartbeat(tx *dbs.Tx, exportId int64, runToken string) (isValid bool, err error) {
+	_, err = this.runningQuery(tx, exportId, runToken).
+		Set("updatedAt", time.Now().Unix()).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return this.CheckExportRunning(tx, exportId, runToken)
+}
+
+// CheckExportRunning 检查任务是否仍然由持有令牌的执行者执行
+// 因为同一秒内重复更新时影响的行数为0，所以这里单独查询
+func (this *HTTPAccessLogExportDAO) CheckExportRunning(tx *dbs.Tx, exportId int64, runToken string) (bool, error) {
+	if len(runToken) == 0 {
+		return false, nil
+	}
+	return this.runningQuery(tx, exportId, runToken).
+		Attr("state", HTTPAccessLogExportStateEnabled).
+		Exist()
+}
+
+// UpdateExportDone 设置任务完成
+// 如果任务已被其他执行者领取，则返回 ErrHTTPAccessLogExportLost
+func (this *HTTPAccessLogExportDAO) UpdateExportDone(tx *dbs.Tx, exportId int64, runToken string, countLogs int64, size int64) error {
+	var now = time.Now().Unix()
+	rows, err := this.runningQuery(tx, exportId, runToken).
+		Set("status", HTTPAccessLogExportStatusDone).
+		Set("progress", 100).
+		Set("countLogs", countLogs).
+		Set("size", size).
+		Set("updatedAt", now).
+		Set("finishedAt", now).
+		Set("expiresAt", now+HTTPAccessLogExportExpireSeconds).
+		Update()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrHTTPAccessLogExportLost
+	}
+	return nil
+}
+
+// UpdateExportFailed 设置任务失败，并删除未完成的文件
+// 如果任务已被其他执行者领取，则不做任何修改，并返回 ErrHTTPAccessLogExportLost
+func (this *HTTPAccessLogExportDAO) UpdateExportFailed(tx *dbs.Tx, exportId int64, runToken string, errString string) error {
+	var errRunes = []rune(errString)
+	if len(errRunes) > 1000 {
+		errString = string(errRunes[:1000]) + "..."
+	}
+
+	fileId, err := this.runningQuery(tx, exportId, runToken).
+		Result("fileId").
+		FindInt64Col(0)
+	if err != nil {
+		return err
+	}
+
+	var now = time.Now().Unix()
+	rows, err := this.runningQuery(tx, exportId, runToken).
+		Set("status", HTTPAccessLogExportStatusFailed).
+		Set("fileId", 0).
+		Set("error", errString).
+		Set("updatedAt", now).
+		Set("finishedAt", now).
+		Set("expiresAt", now+HTTPAccessLogExportExpireSeconds).
+		Update()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrHTTPAccessLogExportLost
+	}
+	return this.deleteExportFile(tx, fileId)
+}
+
+// CleanExpiredExports 清理过期的导出任务和文件
+func (this *HTTPAccessLogExportDAO) CleanExpiredExports(tx *dbs.Tx) error {
+	var exports []*HTTPAccessLogExport
+	_, err := this.Query(tx).
+		Where("((expiresAt>0 AND expiresAt<:now) OR (state=:disabledState AND status!=:runningStatus))").
+		Param("now", time.Now().Unix()).
+		Param("disabledState", HTTPAccessLogExportStateDisabled).
+		Param("runningStatus", HTTPAccessLogExportStatusRunning).
+		Slice(&exports).
+		FindAll()
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		err = this.deleteExportFile(tx, int64(export.FileId))
+		if err != nil {
+			return err
+		}
+		_, err = this.Query(tx).
+			Pk(export.Id).
+			Delete()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *HTTPAccessLogExportDAO) exportsQuery(tx *dbs.Tx, adminId int64, userId int64, serverId int64) *dbs.Query {
+	var query = this.Query(tx).
+		Attr("state", HTTPAccessLogExportStateEnabled)
+	if adminId > 0 {
+		query.Attr("adminId", adminId)
+	}
+	if userId > 0 {
+		query.Attr("userId", userId)
+	}
+	if serverId > 0 {
+		query.Attr("serverId", serverId)
+	}
+	return query
+}
+
+// 删除导出文件
+func (this *HTTPAccessLogExportDAO) deleteExportFile(tx *dbs.Tx, fileId int64) error {
+	if fileId <= 0 {
+		return nil
+	}
+	err := SharedFileChunkDAO.DeleteFileChunks(tx, fileId)
+	if err != nil {
+		return err
+	}
+	return SharedFileDAO.DisableFile(tx, fileId)
+}
+
+// 持有令牌的执行者正在执行的任务
+func (this *HTTPAccessLogExportDAO) runningQuery(tx *dbs.Tx, exportId int64, runToken string) *dbs.Query {
+	return this.Query(tx).
+		Pk(exportId).
+		Attr("status", HTTPAccessLogExportStatusRunning).
+		Attr("runToken", runToken)
+}
+
+// 生成执行令牌
+func (this *HTTPAccessLogExportDAO) generateRunToken() (string, error) {
+	var data = make([]byte, 16)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
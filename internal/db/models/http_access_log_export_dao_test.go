@@ -0,0 +1,98 @@
+package models
+
+import (
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+	"testing"
+	"time"
+)
+
+func TestHTTPAccessLogExportDAO_CreateExport(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var now = time.Now().Unix()
+	exportId, err := SharedHTTPAccessLogExportDAO.CreateExport(tx, 1, 0, 0, "status>=500", HTTPAccessLogExportFormatCSV, now-86400, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("exportId:", exportId)
+
+	_, err = SharedHTTPAccessLogExportDAO.CreateExport(tx, 1, 0, 0, "", "xml", now-86400, now)
+	if err == nil {
+		t.Fatal("invalid format should fail")
+	}
+
+	err = SharedHTTPAccessLogExportDAO.DisableExport(tx, exportId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SharedHTTPAccessLogExportDAO.CleanExpiredExports(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ok")
+}
+
+func TestHTTPAccessLogExportDAO_RunToken(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var dao = SharedHTTPAccessLogExportDAO
+	var now = time.Now().Unix()
+	exportId, err := dao.CreateExport(tx, 1, 0, 0, "", HTTPAccessLogExportFormatNDJSON, now-86400, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = dao.Query(tx).Pk(exportId).Delete()
+	}()
+
+	// 模拟已被执行者领取
+	_, err = dao.Query(tx).
+		Pk(exportId).
+		Set("status", HTTPAccessLogExportStatusRunning).
+		Set("runToken", "token1").
+		Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	isValid, err := dao.UpdateExportHeartbeat(tx, exportId, "token1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isValid {
+		t.Fatal("heartbeat with current token should be valid")
+	}
+
+	isValid, err = dao.UpdateExportProgress(tx, exportId, "token2", 50, 100, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isValid {
+		t.Fatal("progress with stale token should be invalid")
+	}
+
+	err = dao.UpdateExportDone(tx, exportId, "token2", 100, 1024)
+	if err != ErrHTTPAccessLogExportLost {
+		t.Fatal("done with stale token should be rejected, but got:", err)
+	}
+	err = dao.UpdateExportFailed(tx, exportId, "token2", "stale runner")
+	if err != ErrHTTPAccessLogExportLost {
+		t.Fatal("failed with stale token should be rejected, but got:", err)
+	}
+
+	err = dao.UpdateExportDone(tx, exportId, "token1", 100, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	export, err := dao.FindEnabledExport(tx, exportId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export == nil || export.Status != HTTPAccessLogExportStatusDone {
+		t.Fatal("export should be done")
+	}
+}
@@ -0,0 +1,54 @@
+package models
+
+// HTTPAccessLogExport 访问日志导出任务
+type HTTPAccessLogExport struct {
+	Id         uint64 `field:"id"`         // ID
+	AdminId    uint32 `field:"adminId"`    // 管理员ID
+	UserId     uint32 `field:"userId"`     // 用户ID
+	ServerId   uint32 `field:"serverId"`   // 服务ID
+	Query      string `field:"query"`      // 查询语句
+	Format     string `field:"format"`     // 文件格式：ndjson|csv
+	TimeFrom   uint64 `field:"timeFrom"`   // 开始时间
+	TimeTo     uint64 `field:"timeTo"`     // 结束时间
+	Status     uint8  `field:"status"`     // 状态
+	Progress   uint8  `field:"progress"`   // 进度：0-100
+	CountLogs  uint64 `field:"countLogs"`  // 已导出日志数
+	FileId     uint32 `field:"fileId"`     // 文件ID
+	Size       uint64 `field:"size"`       // 压缩后文件尺寸
+	Error      string `field:"error"`      // 错误信息
+	CreatedAt  uint64 `field:"createdAt"`  // 创建时间
+	StartedAt  uint64 `field:"startedAt"`  // 开始执行时间
+	UpdatedAt  uint64 `field:"updatedAt"`  // 最后更新时间
+	RunToken   string `field:"runToken"`   // 执行令牌
+	FinishedAt uint64 `field:"finishedAt"` // 完成时间
+	ExpiresAt  uint64 `field:"expiresAt"`  // 过期时间
+	State      uint8  `field:"state"`      // 状态
+}
+
+type HTTPAccessLogExportOperator struct {
+	Id         interface{} // ID
+	AdminId    interface{} // 管理员ID
+	UserId     interface{} // 用户ID
+	ServerId   interface{} // 服务ID
+	Query      interface{} // 查询语句
+	Format     interface{} // 文件格式：ndjson|csv
+	TimeFrom   interface{} // 开始时间
+	TimeTo     interface{} // 结束时间
+	Status     interface{} // 状态
+	Progress   interface{} // 进度：0-100
+	CountLogs  interface{} // 已导出日志数
+	FileId     interface{} // 文件ID
+	Size       interface{} // 压缩后文件尺寸
+	Error      interface{} // 错误信息
+	CreatedAt  interface{} // 创建时间
+	StartedAt  interface{} // 开始执行时间
+	UpdatedAt  interface{} // 最后更新时间
+	RunToken   interface{} // 执行令牌
+	FinishedAt interface{} // 完成时间
+	ExpiresAt  interface{} // 过期时间
+	State      interface{} // 状态
+}
+
+func NewHTTPAccessLogExportOperator() *HTTPAccessLogExportOperator {
+	return &HTTPAccessLogExportOperator{}
+}
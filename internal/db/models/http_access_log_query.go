@@ -0,0 +1,184 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package models
+
+import (
+	"github.com/TeaOSLab/EdgeAPI/internal/accesslogs/logquery"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/lists"
+	"github.com/iwind/TeaGo/types"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+var httpAccessLogCursorRegexp = regexp.MustCompile(`^\d{11,}`)
+
+// QueryAccessLogs 使用查询语句跨日期、跨日志数据库查询访问日志
+// 结果按照requestId倒序分批传给callback，每批最多batchSize条，总共最多size条；
+// cursor为上一次查询返回的nextCursor，hasMore为true时可以用nextCursor继续查询
+func (this *HTTPAccessLogDAO) QueryAccessLogs(tx *dbs.Tx, expr logquery.Expr, timeFrom int64, timeTo int64, serverIds []int64, cursor string, size int64, batchSize int64, callback func(accessLogs []*HTTPAccessLog) error) (nextCursor string, hasMore bool, err error) {
+	if size <= 0 || batchSize <= 0 {
+		return
+	}
+	if timeFrom > timeTo {
+		timeFrom, timeTo = timeTo, timeFrom
+	}
+	if len(cursor) > 0 && !httpAccessLogCursorRegexp.MatchString(cursor) {
+		return "", false, errors.New("invalid cursor '" + cursor + "'")
+	}
+
+	days, err := utils.RangeDays(timeutil.FormatTime("Ymd", timeFrom), timeutil.FormatTime("Ymd", timeTo))
+	if err != nil {
+		return "", false, err
+	}
+	lists.Reverse(days)
+
+	var cursorDay = ""
+	if len(cursor) > 0 {
+		cursorDay = timeutil.FormatTime("Ymd", types.Int64(cursor[:10]))
+	}
+
+	var remaining = size
+	for _, day := range days {
+		// 比游标更新的日期已经查询过
+		if len(cursorDay) > 0 && day > cursorDay {
+			continue
+		}
+
+		for {
+			// 已经查够数量，只需要判断是否还有更多
+			if remaining <= 0 {
+				accessLogs, err := this.queryDayAccessLogs(tx, day, expr, timeFrom, timeTo, serverIds, cursor, 1)
+				if err != nil {
+					return "", false, err
+				}
+				if len(accessLogs) > 0 {
+					return cursor, true, nil
+				}
+				break
+			}
+
+			var limit = batchSize
+			if limit > remaining {
+				limit = remaining
+			}
+			accessLogs, err := this.queryDayAccessLogs(tx, day, expr, timeFrom, timeTo, serverIds, cursor, limit+1)
+			if err != nil {
+				return "", false, err
+			}
+			if len(accessLogs) == 0 {
+				break
+			}
+
+			var dayHasMore = int64(len(accessLogs)) > limit
+			if dayHasMore {
+				accessLogs = accessLogs[:limit]
+			}
+			err = callback(accessLogs)
+			if err != nil {
+				return "", false, err
+			}
+			cursor = accessLogs[len(accessLogs)-1].RequestId
+			remaining -= int64(len(accessLogs))
+
+			if !dayHasMore {
+				break
+			}
+			if remaining <= 0 {
+				return cursor, true, nil
+			}
+		}
+	}
+
+	return "", false, nil
+}
+
+// 从所有日志数据库中查询某一天的访问日志，按照requestId倒序排列
+func (this *HTTPAccessLogDAO) queryDayAccessLogs(tx *dbs.Tx, day string, expr logquery.Expr, timeFrom int64, timeTo int64, serverIds []int64, cursor string, limit int64) (result []*HTTPAccessLog, resultErr error) {
+	var locker = sync.Mutex{}
+	var wg = &sync.WaitGroup{}
+	for _, daoWrapper := range allHTTPAccessLogDAOs() {
+		wg.Add(1)
+		go func(daoWrapper *HTTPAccessLogDAOWrapper) {
+			defer wg.Done()
+
+			ones, err := this.queryTableAccessLogs(tx, daoWrapper.DAO, day, expr, timeFrom, timeTo, serverIds, cursor, limit)
+
+			locker.Lock()
+			defer locker.Unlock()
+			if err != nil {
+				if resultErr == nil {
+					resultErr = err
+				}
+				return
+			}
+			result = append(result, ones...)
+		}(daoWrapper)
+	}
+	wg.Wait()
+
+	if resultErr != nil {
+		return nil, resultErr
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].RequestId > result[j].RequestId
+	})
+	if int64(len(result)) > limit {
+		result = result[:limit]
+	}
+	return
+}
+
+// 从单个日志数据库中查询某一天的访问日志
+func (this *HTTPAccessLogDAO) queryTableAccessLogs(tx *dbs.Tx, dao *HTTPAccessLogDAO, day string, expr logquery.Expr, timeFrom int64, timeTo int64, serverIds []int64, cursor string, limit int64) ([]*HTTPAccessLog, error) {
+	tableDef, err := findHTTPAccessLogTable(dao.Instance, day, false)
+	if err != nil {
+		return nil, err
+	}
+	if !tableDef.Exists {
+		return nil, nil
+	}
+
+	// 每个表的字段可能不同，需要单独构造条件
+	where, params, err := logquery.NewSQLBuilder(tableDef.HasRemoteAddr, tableDef.HasDomain).Build(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	var query = dao.Query(tx).
+		Table(tableDef.Name).
+		Between("createdAt", timeFrom, timeTo)
+	if len(serverIds) > 0 {
+		query.Attr("serverId", serverIds).
+			Reuse(false)
+	}
+	if len(where) > 0 {
+		query.Where(where)
+		for name, value := range params {
+			query.Param(name, value)
+		}
+	}
+	if len(cursor) > 0 {
+		query.Where("requestId<:requestId").
+			Param("requestId", cursor)
+	}
+
+	ones, err := query.
+		Desc("requestId").
+		Limit(limit).
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var result = []*HTTPAccessLog{}
+	for _, one := range ones {
+		result = append(result, one.(*HTTPAccessLog))
+	}
+	return result, nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package models
+
+import (
+	"github.com/TeaOSLab/EdgeAPI/internal/accesslogs/logquery"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+	"testing"
+	"time"
+)
+
+func TestHTTPAccessLogDAO_QueryAccessLogs(t *testing.T) {
+	dbs.NotifyReady()
+
+	expr, err := logquery.Parse("status>=400 AND NOT ip:10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var now = time.Now().Unix()
+	var count = 0
+	nextCursor, hasMore, err := SharedHTTPAccessLogDAO.QueryAccessLogs(nil, expr, now-3*86400, now, nil, "", 10, 3, func(accessLogs []*HTTPAccessLog) error {
+		for _, accessLog := range accessLogs {
+			t.Log(accessLog.RequestId, accessLog.Status)
+		}
+		count += len(accessLogs)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count > 10 {
+		t.Fatal("count should not be greater than 10")
+	}
+	t.Log("count:", count, "nextCursor:", nextCursor, "hasMore:", hasMore)
+}
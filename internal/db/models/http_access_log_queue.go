@@ -0,0 +1,493 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package models
+
+import (
+	"encoding/json"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeAPI/internal/events"
+	"github.com/TeaOSLab/EdgeAPI/internal/metrics"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HTTPAccessLogQueueMaxSize       = 20000           // 队列中最多可以缓存的日志数量
+	HTTPAccessLogQueueBatchSize     = 1000            // 每次从队列中取出的日志数量
+	HTTPAccessLogQueueFlushInterval = 1 * time.Second // 最长写入间隔
+	HTTPAccessLogQueueWaitTimeout   = 3 * time.Second // 队列已满时调用方最长等待时间
+	HTTPAccessLogInsertRows         = 200             // 单条INSERT语句最多包含的行数
+)
+
+func init() {
+	metrics.SharedRegistry.Describe("edge_api_http_access_log_queue_size", "Access logs waiting in ingest queue")
+	metrics.SharedRegistry.Describe("edge_api_http_access_log_written_total", "Access logs written to database")
+	metrics.SharedRegistry.Describe("edge_api_http_access_log_dropped_total", "Access logs dropped because of database errors")
+	metrics.SharedRegistry.Describe("edge_api_http_access_log_rejected_total", "Access logs rejected because ingest queue is full")
+	metrics.SharedRegistry.Describe("edge_api_http_access_log_wait_ms_total", "Time callers spent waiting for queue space")
+	metrics.SharedRegistry.Describe("edge_api_http_access_log_write_batches_total", "Access log batches written to database")
+	metrics.SharedRegistry.Describe("edge_api_http_access_log_write_ms_total", "Time spent writing access log batches")
+	metrics.SharedRegistry.Describe("edge_api_http_access_log_latency_ms_total", "Time between access logs being queued and written")
+	metrics.SharedRegistry.Describe("edge_api_http_access_log_rollup_errors_total", "Failed access log rollup updates")
+
+	// 退出前写入队列中剩余的日志
+	events.On(events.EventQuit, func() {
+		closeAllHTTPAccessLogQueues()
+	})
+}
+
+// 队列中的单条日志
+type httpAccessLogQueueItem struct {
+	accessLog *pb.HTTPAccessLog
+	queuedAt  time.Time
+}
+
+// HTTPAccessLogQueue 访问日志写入队列
+// 每个日志数据库对应一个队列，由单独的协程批量写入数据库
+type HTTPAccessLogQueue struct {
+	dao       *HTTPAccessLogDAO
+	rollupDAO *HTTPAccessLogRollupDAO
+	dbNodeId  int64
+	dbLabel   string
+
+	items      []*httpAccessLogQueueItem
+	spaceChan  chan bool // 队列有空间时关闭，用来通知所有等待的调用方
+	notifyChan chan bool
+	locker     sync.Mutex
+
+	maxSize       int
+	batchSize     int
+	flushInterval time.Duration
+	waitTimeout   time.Duration
+
+	isClosed  bool
+	closeChan chan bool
+	doneChan  chan bool
+	closeOnce sync.Once
+}
+
+// NewHTTPAccessLogQueue 获取新队列
+// rollupDAO 为日志所在数据库的汇总数据DAO，为nil时不汇总
+func NewHTTPAccessLogQueue(dao *HTTPAccessLogDAO, rollupDAO *HTTPAccessLogRollupDAO, dbNodeId int64) *HTTPAccessLogQueue {
+	return &HTTPAccessLogQueue{
+		dao:           dao,
+		rollupDAO:     rollupDAO,
+		dbNodeId:      dbNodeId,
+		dbLabel:       types.String(dbNodeId),
+		spaceChan:     make(chan bool),
+		notifyChan:    make(chan bool, 1),
+		maxSize:       HTTPAccessLogQueueMaxSize,
+		batchSize:     HTTPAccessLogQueueBatchSize,
+		flushInterval: HTTPAccessLogQueueFlushInterval,
+		waitTimeout:   HTTPAccessLogQueueWaitTimeout,
+		closeChan:     make(chan bool),
+		doneChan:      make(chan bool),
+	}
+}
+
+// Start 启动写入协程
+func (this *HTTPAccessLogQueue) Start() {
+	var ticker = time.NewTicker(this.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-this.notifyChan:
+		case <-ticker.C:
+		case <-this.closeChan:
+			this.flush()
+			close(this.doneChan)
+			return
+		}
+		this.flush()
+	}
+}
+
+// Push 放入一组日志
+// 一组日志要么全部放入，要么全部拒绝；队列已满时会等待写入协程腾出空间，超时后返回 ErrAccessLogQueueFull
+func (this *HTTPAccessLogQueue) Push(accessLogs []*pb.HTTPAccessLog) error {
+	if this == nil {
+		return ErrAccessLogQueueClosed
+	}
+	if len(accessLogs) == 0 {
+		return nil
+	}
+
+	var startTime = time.Now()
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+			metrics.SharedRegistry.Counter("edge_api_http_access_log_wait_ms_total", "db", this.dbLabel).Add(time.Since(startTime).Milliseconds())
+		}
+	}()
+
+	for {
+		this.locker.Lock()
+		if this.isClosed {
+			this.locker.Unlock()
+			return ErrAccessLogQueueClosed
+		}
+
+		// 队列为空时总是放入，防止单组日志超过队列容量时永远无法写入
+		if len(this.items) == 0 || len(this.items)+len(accessLogs) <= this.maxSize {
+			var now = time.Now()
+			for _, accessLog := range accessLogs {
+				this.items = append(this.items, &httpAccessLogQueueItem{
+					accessLog: accessLog,
+					queuedAt:  now,
+				})
+			}
+			var size = len(this.items)
+			this.locker.Unlock()
+
+			metrics.SharedRegistry.Gauge("edge_api_http_access_log_queue_size", "db", this.dbLabel).Set(int64(size))
+			if size >= this.batchSize {
+				select {
+				case this.notifyChan <- true:
+				default:
+				}
+			}
+			return nil
+		}
+
+		var spaceChan = this.spaceChan
+		this.locker.Unlock()
+
+		if timer == nil {
+			timer = time.NewTimer(this.waitTimeout)
+		}
+		select {
+		case <-spaceChan:
+		case <-timer.C:
+			metrics.SharedRegistry.Counter("edge_api_http_access_log_rejected_total", "db", this.dbLabel).Add(int64(len(accessLogs)))
+			return ErrAccessLogQueueFull
+		case <-this.closeChan:
+			return ErrAccessLogQueueClosed
+		}
+	}
+}
+
+// Len 队列中的日志数量
+func (this *HTTPAccessLogQueue) Len() int {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	return len(this.items)
+}
+
+// Close 关闭队列，并等待剩余的日志写入完成
+func (this *HTTPAccessLogQueue) Close() {
+	this.closeOnce.Do(func() {
+		this.locker.Lock()
+		this.isClosed = true
+		this.locker.Unlock()
+		close(this.closeChan)
+	})
+	<-this.doneChan
+}
+
+// 写入队列中所有日志
+func (this *HTTPAccessLogQueue) flush() {
+	for {
+		var items = this.pop()
+		if len(items) == 0 {
+			return
+		}
+		this.write(items)
+		if len(items) < this.batchSize {
+			return
+		}
+	}
+}
+
+// 取出一批日志，并通知等待的调用方
+func (this *HTTPAccessLogQueue) pop() []*httpAccessLogQueueItem {
+	this.locker.Lock()
+	var count = len(this.items)
+	if count == 0 {
+		this.locker.Unlock()
+		return nil
+	}
+	if count > this.batchSize {
+		count = this.batchSize
+	}
+	var items = this.items[:count]
+	if count == len(this.items) {
+		this.items = nil
+	} else {
+		this.items = append([]*httpAccessLogQueueItem{}, this.items[count:]...)
+	}
+	var size = len(this.items)
+
+	close(this.spaceChan)
+	this.spaceChan = make(chan bool)
+	this.locker.Unlock()
+
+	metrics.SharedRegistry.Gauge("edge_api_http_access_log_queue_size", "db", this.dbLabel).Set(int64(size))
+	return items
+}
+
+func (this *HTTPAccessLogQueue) write(items []*httpAccessLogQueueItem) {
+	var accessLogs = make([]*pb.HTTPAccessLog, 0, len(items))
+	for _, item := range items {
+		accessLogs = append(accessLogs, item.accessLog)
+	}
+
+	// 语句错误的日志换一个数据库写入也会失败，所以直接丢弃，也不影响节点的健康状态
+	var failedLogMap = map[*pb.HTTPAccessLog]bool{}
+	var startTime = time.Now()
+	unwrittenLogs, err := this.dao.insertHTTPAccessLogsByDay(accessLogs, func(rejectedLogs []*pb.HTTPAccessLog, err error) {
+		remotelogs.Error("HTTP_ACCESS_LOG", "drop "+types.String(len(rejectedLogs))+" invalid access logs: "+err.Error())
+		metrics.SharedRegistry.Counter("edge_api_http_access_log_dropped_total", "db", this.dbLabel).Add(int64(len(rejectedLogs)))
+		for _, accessLog := range rejectedLogs {
+			failedLogMap[accessLog] = true
+		}
+	})
+	var now = time.Now()
+	metrics.SharedRegistry.Counter("edge_api_http_access_log_write_batches_total", "db", this.dbLabel).Increase()
+	metrics.SharedRegistry.Counter("edge_api_http_access_log_write_ms_total", "db", this.dbLabel).Add(now.Sub(startTime).Milliseconds())
+	if err != nil {
+		remotelogs.Error("HTTP_ACCESS_LOG", "write "+types.String(len(unwrittenLogs))+" access logs failed: "+err.Error())
+		reportDBNodeFailure(this.dbNodeId, err)
+		this.failover(unwrittenLogs)
+		for _, accessLog := range unwrittenLogs {
+			failedLogMap[accessLog] = true
+		}
+	} else {
+		reportDBNodeSuccess(this.dbNodeId)
+	}
+
+	var writtenLogs = accessLogs
+	if len(failedLogMap) > 0 {
+		writtenLogs = make([]*pb.HTTPAccessLog, 0, len(accessLogs))
+		for _, accessLog := range accessLogs {
+			if !failedLogMap[accessLog] {
+				writtenLogs = append(writtenLogs, accessLog)
+			}
+		}
+	}
+	if len(writtenLogs) == 0 {
+		return
+	}
+
+	var latencyMs int64
+	for _, item := range items {
+		if !failedLogMap[item.accessLog] {
+			latencyMs += now.Sub(item.queuedAt).Milliseconds()
+		}
+	}
+	metrics.SharedRegistry.Counter("edge_api_http_access_log_written_total", "db", this.dbLabel).Add(int64(len(writtenLogs)))
+	metrics.SharedRegistry.Counter("edge_api_http_access_log_latency_ms_total", "db", this.dbLabel).Add(latencyMs)
+
+	// 汇总数据
+	if this.rollupDAO == nil {
+		return
+	}
+	err = this.rollupDAO.IncreaseRollups(nil, writtenLogs)
+	if err != nil {
+		remotelogs.Error("HTTP_ACCESS_LOG", "update rollups failed: "+err.Error())
+		metrics.SharedRegistry.Counter("edge_api_http_access_log_rollup_errors_total", "db", this.dbLabel).Increase()
+	}
+}
+
+// 将写入失败的日志转到其他可写入的日志数据库，没有其他节点时丢弃
+func (this *HTTPAccessLogQueue) failover(accessLogs []*pb.HTTPAccessLog) {
+	if this.dbNodeId > 0 {
+		var daoWrapper = selectHTTPAccessLogDAO(this.dbNodeId)
+		if daoWrapper != nil {
+			err := daoWrapper.Queue().Push(accessLogs)
+			if err == nil {
+				metrics.SharedRegistry.Counter("edge_api_db_node_failovers_total", "db", this.dbLabel).Add(int64(len(accessLogs)))
+				return
+			}
+			remotelogs.Error("HTTP_ACCESS_LOG", "reroute "+types.String(len(accessLogs))+" access logs failed: "+err.Error())
+		}
+	}
+	metrics.SharedRegistry.Counter("edge_api_http_access_log_dropped_total", "db", this.dbLabel).Add(int64(len(accessLogs)))
+}
+
+// 关闭所有写入队列
+func closeAllHTTPAccessLogQueues() {
+	accessLogLocker.RLock()
+	var daoWrappers = []*HTTPAccessLogDAOWrapper{}
+	for _, daoWrapper := range httpAccessLogDAOMapping {
+		daoWrappers = append(daoWrappers, daoWrapper)
+	}
+	accessLogLocker.RUnlock()
+
+	daoWrappers = append(daoWrappers, defaultHTTPAccessLogDAO())
+
+	for _, daoWrapper := range daoWrappers {
+		daoWrapper.Close()
+	}
+}
+
+// 使用事务和多行INSERT语句批量写入日志
+func (this *HTTPAccessLogDAO) insertHTTPAccessLogs(accessLogs []*pb.HTTPAccessLog) error {
+	var rejectErr error
+	_, err := this.insertHTTPAccessLogsByDay(accessLogs, func(rejectedLogs []*pb.HTTPAccessLog, err error) {
+		if rejectErr == nil {
+			rejectErr = err
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return rejectErr
+}
+
+// 按日期分组写入日志，每组使用单独的事务
+// 数据库不可用时立即返回尚未写入的日志，以便转到其他数据库写入而不会重复；
+// 其他错误（比如数据过长）时拆分后重新写入，出错的日志交给 rejectFunc 处理
+func (this *HTTPAccessLogDAO) insertHTTPAccessLogsByDay(accessLogs []*pb.HTTPAccessLog, rejectFunc func(rejectedLogs []*pb.HTTPAccessLog, err error)) (unwrittenLogs []*pb.HTTPAccessLog, err error) {
+	// 按日期分组
+	var dayMap = map[string][]*pb.HTTPAccessLog{}
+	var days = []string{}
+	for _, accessLog := range accessLogs {
+		var day = timeutil.Format("Ymd", time.Unix(accessLog.Timestamp, 0))
+		_, ok := dayMap[day]
+		if !ok {
+			days = append(days, day)
+		}
+		dayMap[day] = append(dayMap[day], accessLog)
+	}
+
+	for index, day := range days {
+		var dayLogs = dayMap[day]
+		err = this.insertDayHTTPAccessLogs(day, dayLogs)
+		if err == nil {
+			continue
+		}
+		if !isDBNodeUnavailableError(err) {
+			// 找出出错的日志，其余的日志仍然写入
+			if len(dayLogs) == 1 {
+				if rejectFunc != nil {
+					rejectFunc(dayLogs, err)
+				}
+				continue
+			}
+			dayLogs, err = this.insertDayHTTPAccessLogsBySplit(day, dayLogs, rejectFunc)
+			if err == nil {
+				continue
+			}
+		}
+		unwrittenLogs = append(unwrittenLogs, dayLogs...)
+		for _, unwrittenDay := range days[index+1:] {
+			unwrittenLogs = append(unwrittenLogs, dayMap[unwrittenDay]...)
+		}
+		return unwrittenLogs, err
+	}
+	return nil, nil
+}
+
+// 将写入失败的日志分成两半分别写入，直到找出单条出错的日志
+// 数据库不可用时立即返回尚未写入的日志
+func (this *HTTPAccessLogDAO) insertDayHTTPAccessLogsBySplit(day string, dayLogs []*pb.HTTPAccessLog, rejectFunc func(rejectedLogs []*pb.HTTPAccessLog, err error)) (unwrittenLogs []*pb.HTTPAccessLog, err error) {
+	var middle = len(dayLogs) / 2
+	var parts = [][]*pb.HTTPAccessLog{dayLogs[:middle], dayLogs[middle:]}
+	for index, part := range parts {
+		err = this.insertDayHTTPAccessLogs(day, part)
+		if err == nil {
+			continue
+		}
+		if !isDBNodeUnavailableError(err) {
+			if len(part) == 1 {
+				if rejectFunc != nil {
+					rejectFunc(part, err)
+				}
+				continue
+			}
+			part, err = this.insertDayHTTPAccessLogsBySplit(day, part, rejectFunc)
+			if err == nil {
+				continue
+			}
+		}
+		unwrittenLogs = append(unwrittenLogs, part...)
+		for _, unwrittenPart := range parts[index+1:] {
+			unwrittenLogs = append(unwrittenLogs, unwrittenPart...)
+		}
+		return unwrittenLogs, err
+	}
+	return nil, nil
+}
+
+// 写入某一天的日志，表格不存在时自动创建
+func (this *HTTPAccessLogDAO) insertDayHTTPAccessLogs(day string, dayLogs []*pb.HTTPAccessLog) error {
+	var db = this.Instance
+	tableDef, err := findHTTPAccessLogTable(db, day, false)
+	if err != nil {
+		return err
+	}
+
+	err = db.RunTx(func(tx *dbs.Tx) error {
+		return this.insertHTTPAccessLogsWithTx(tx, tableDef, dayLogs)
+	})
+	if err != nil {
+		// 是否为 Error 1146: Table 'xxx.xxx' doesn't exist  如果是，则创建表之后重试
+		if !strings.Contains(err.Error(), "1146") {
+			return err
+		}
+		tableDef, err = findHTTPAccessLogTable(db, day, true)
+		if err != nil && strings.Contains(err.Error(), "1050") {
+			// 表格已经被其他API节点创建
+			tableDef, err = findHTTPAccessLogTable(db, day, true)
+		}
+		if err != nil {
+			return err
+		}
+		return db.RunTx(func(tx *dbs.Tx) error {
+			return this.insertHTTPAccessLogsWithTx(tx, tableDef, dayLogs)
+		})
+	}
+	return nil
+}
+
+func (this *HTTPAccessLogDAO) insertHTTPAccessLogsWithTx(tx *dbs.Tx, tableDef *httpAccessLogDefinition, accessLogs []*pb.HTTPAccessLog) error {
+	// TODO 根据集群、服务设置获取IP
+	var columns = []string{"serverId", "nodeId", "status", "createdAt", "requestId", "firewallPolicyId", "firewallRuleGroupId", "firewallRuleSetId", "firewallRuleId", "content"}
+	if tableDef.HasRemoteAddr {
+		columns = append(columns, "remoteAddr")
+	}
+	if tableDef.HasDomain {
+		columns = append(columns, "domain")
+	}
+	var rowPlaceholder = "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+	var prefix = "INSERT INTO `" + tableDef.Name + "` (`" + strings.Join(columns, "`,`") + "`) VALUES "
+
+	for offset := 0; offset < len(accessLogs); offset += HTTPAccessLogInsertRows {
+		var end = offset + HTTPAccessLogInsertRows
+		if end > len(accessLogs) {
+			end = len(accessLogs)
+		}
+		var rows = accessLogs[offset:end]
+
+		var placeholders = make([]string, 0, len(rows))
+		var args = make([]interface{}, 0, len(rows)*len(columns))
+		for _, accessLog := range rows {
+			content, err := json.Marshal(accessLog)
+			if err != nil {
+				return err
+			}
+
+			placeholders = append(placeholders, rowPlaceholder)
+			args = append(args, accessLog.ServerId, accessLog.NodeId, accessLog.Status, accessLog.Timestamp, accessLog.RequestId, accessLog.FirewallPolicyId, accessLog.FirewallRuleGroupId, accessLog.FirewallRuleSetId, accessLog.FirewallRuleId, content)
+			if tableDef.HasRemoteAddr {
+				args = append(args, accessLog.RemoteAddr)
+			}
+			if tableDef.HasDomain {
+				args = append(args, accessLog.Host)
+			}
+		}
+
+		_, err := tx.Exec(prefix+strings.Join(placeholders, ","), args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
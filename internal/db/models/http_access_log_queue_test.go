@@ -0,0 +1,107 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package models
+
+import (
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/rands"
+	"github.com/iwind/TeaGo/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPAccessLogQueue_Push(t *testing.T) {
+	var queue = NewHTTPAccessLogQueue(nil, nil, 0)
+	queue.maxSize = 3
+	queue.waitTimeout = 100 * time.Millisecond
+
+	err := queue.Push([]*pb.HTTPAccessLog{{}, {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 超出容量
+	var before = time.Now()
+	err = queue.Push([]*pb.HTTPAccessLog{{}, {}})
+	if err != ErrAccessLogQueueFull {
+		t.Fatal("should be full, but got:", err)
+	}
+	if time.Since(before) < queue.waitTimeout {
+		t.Fatal("should wait before rejecting")
+	}
+	if queue.Len() != 2 {
+		t.Fatal("rejected logs should not be queued")
+	}
+
+	// 取出后等待的调用方可以继续放入
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		queue.pop()
+	}()
+	err = queue.Push([]*pb.HTTPAccessLog{{}, {}, {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue.Len() != 3 {
+		t.Fatal("expect 3 logs, but got", queue.Len())
+	}
+}
+
+func TestHTTPAccessLogDAO_insertHTTPAccessLogs(t *testing.T) {
+	dbs.NotifyReady()
+
+	var accessLogs = []*pb.HTTPAccessLog{}
+	for i := 0; i < 500; i++ {
+		accessLogs = append(accessLogs, &pb.HTTPAccessLog{
+			RequestId:  rands.HexString(16),
+			ServerId:   1,
+			NodeId:     4,
+			Status:     200,
+			Timestamp:  time.Now().Unix(),
+			RemoteAddr: "127.0.0.1",
+			Host:       "example.com",
+		})
+	}
+
+	var before = time.Now()
+	err := SharedHTTPAccessLogDAO.insertHTTPAccessLogs(accessLogs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("inserted " + types.String(len(accessLogs)) + " logs in " + time.Since(before).String())
+}
+
+func TestHTTPAccessLogDAO_insertHTTPAccessLogsByDay_Reject(t *testing.T) {
+	dbs.NotifyReady()
+
+	var accessLogs = []*pb.HTTPAccessLog{}
+	for i := 0; i < 10; i++ {
+		accessLogs = append(accessLogs, &pb.HTTPAccessLog{
+			RequestId: rands.HexString(16),
+			ServerId:  1,
+			NodeId:    4,
+			Status:    200,
+			Timestamp: time.Now().Unix(),
+		})
+	}
+
+	// 请求ID超出字段长度，在严格模式下写入失败
+	accessLogs[3].RequestId = strings.Repeat("a", 1024)
+
+	var rejectedLogs = []*pb.HTTPAccessLog{}
+	unwrittenLogs, err := SharedHTTPAccessLogDAO.insertHTTPAccessLogsByDay(accessLogs, func(logs []*pb.HTTPAccessLog, err error) {
+		t.Log("reject:", err)
+		rejectedLogs = append(rejectedLogs, logs...)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unwrittenLogs) > 0 {
+		t.Fatal("should not have unwritten logs")
+	}
+	if len(rejectedLogs) > 1 || (len(rejectedLogs) == 1 && rejectedLogs[0] != accessLogs[3]) {
+		t.Fatal("only the invalid log should be rejected")
+	}
+}
@@ -0,0 +1,681 @@
+package models
+
+import (
+	"fmt"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/lists"
+	"github.com/iwind/TeaGo/rands"
+	"github.com/iwind/TeaGo/types"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type HTTPAccessLogRollupPeriod = string
+
+const (
+	HTTPAccessLogRollupPeriodMinute HTTPAccessLogRollupPeriod = "minute"
+	HTTPAccessLogRollupPeriodHour   HTTPAccessLogRollupPeriod = "hour"
+)
+
+type HTTPAccessLogRollupDimension = string
+
+// 汇总维度
+// 分钟汇总只包含基数较小的维度，IP、URL等只做小时汇总
+const (
+	HTTPAccessLogRollupDimensionTotal       HTTPAccessLogRollupDimension = "total"       // 总数，值为空
+	HTTPAccessLogRollupDimensionStatus      HTTPAccessLogRollupDimension = "status"      // 状态码
+	HTTPAccessLogRollupDimensionAttackGroup HTTPAccessLogRollupDimension = "attackGroup" // WAF规则分组ID
+	HTTPAccessLogRollupDimensionIP          HTTPAccessLogRollupDimension = "ip"          // 客户端IP
+	HTTPAccessLogRollupDimensionHost        HTTPAccessLogRollupDimension = "host"        // 域名
+	HTTPAccessLogRollupDimensionURI         HTTPAccessLogRollupDimension = "uri"         // 请求URI
+)
+
+const (
+	HTTPAccessLogRollupMinuteDays    = 3         // 分钟汇总保留天数
+	HTTPAccessLogRollupHourDays      = 90        // 小时汇总保留天数
+	HTTPAccessLogRollupHourMaxValues = 1000      // 每个服务每小时IP、URI最多保留的不同值数量，其余的合并到 HTTPAccessLogRollupOtherValue
+	HTTPAccessLogRollupOtherValue    = "(other)" // 超出数量限制的值合并后的值
+	httpAccessLogRollupMaxValue      = 255
+	httpAccessLogRollupInsertRows    = 500
+	httpAccessLogRollupTopFactor     = 10 // 从多个数据库读取排行时，每个数据库多读取的倍数
+)
+
+// 日志数据库节点中的汇总数据表
+const httpAccessLogRollupTableSQL = "CREATE TABLE IF NOT EXISTS `edgeHTTPAccessLogRollups` (\n  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'ID',\n  `serverId` int(11) unsigned DEFAULT '0' COMMENT '服务ID',\n  `period` varchar(8) DEFAULT NULL COMMENT '周期：minute|hour',\n  `time` varchar(12) DEFAULT NULL COMMENT 'YYYYMMDDHH或YYYYMMDDHHII',\n  `day` varchar(8) DEFAULT NULL COMMENT 'YYYYMMDD',\n  `dimension` varchar(16) DEFAULT NULL COMMENT '维度',\n  `value` varchar(255) DEFAULT NULL COMMENT '维度值',\n  `count` bigint(20) unsigned DEFAULT '0' COMMENT '请求数',\n  `attackCount` bigint(20) unsigned DEFAULT '0' COMMENT '攻击请求数',\n  PRIMARY KEY (`id`),\n  UNIQUE KEY `serverId_period_time` (`serverId`,`period`,`time`,`dimension`,`value`),\n  KEY `day_dimension` (`day`,`dimension`,`period`,`serverId`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='访问日志汇总';"
+
+// 需要限制不同值数量的维度
+var httpAccessLogRollupCappedDimensions = []HTTPAccessLogRollupDimension{HTTPAccessLogRollupDimensionIP, HTTPAccessLogRollupDimensionURI}
+
+type HTTPAccessLogRollupDAO dbs.DAO
+
+func init() {
+	dbs.OnReadyDone(func() {
+		// 清理数据任务
+		var ticker = time.NewTicker(time.Duration(rands.Int(24, 48)) * time.Hour)
+		go func() {
+			for range ticker.C {
+				err := SharedHTTPAccessLogRollupDAO.CleanExpiredRollups(nil, HTTPAccessLogRollupPeriodMinute, HTTPAccessLogRollupMinuteDays)
+				if err == nil {
+					err = SharedHTTPAccessLogRollupDAO.CleanExpiredRollups(nil, HTTPAccessLogRollupPeriodHour, HTTPAccessLogRollupHourDays)
+				}
+				if err != nil {
+					remotelogs.Error("SharedHTTPAccessLogRollupDAO", "clean expired data failed: "+err.Error())
+				}
+			}
+		}()
+
+		// 合并上一个小时超出数量限制的值
+		var compactTicker = time.NewTicker(10 * time.Minute)
+		go func() {
+			for range compactTicker.C {
+				err := SharedHTTPAccessLogRollupDAO.CompactHourRollups(nil, timeutil.Format("YmdH", time.Now().Add(-1*time.Hour)))
+				if err != nil {
+					remotelogs.Error("SharedHTTPAccessLogRollupDAO", "compact rollups failed: "+err.Error())
+				}
+			}
+		}()
+	})
+}
+
+func NewHTTPAccessLogRollupDAO() *HTTPAccessLogRollupDAO {
+	return dbs.NewDAO(&HTTPAccessLogRollupDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeHTTPAccessLogRollups",
+			Model:  new(HTTPAccessLogRollup),
+			PkName: "id",
+		},
+	}).(*HTTPAccessLogRollupDAO)
+}
+
+// NewHTTPAccessLogRollupDAOWithDB 获取日志数据库节点中的汇总数据DAO，汇总数据表不存在时自动创建
+func NewHTTPAccessLogRollupDAOWithDB(db *dbs.DB, dbName string) (*HTTPAccessLogRollupDAO, error) {
+	_, err := db.Exec(httpAccessLogRollupTableSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	var dao = &HTTPAccessLogRollupDAO{
+		DAOObject: dbs.DAOObject{
+			Instance: db,
+			DB:       dbName,
+			Table:    "edgeHTTPAccessLogRollups",
+			Model:    new(HTTPAccessLogRollup),
+			PkName:   "id",
+		},
+	}
+	err = dao.Init()
+	if err != nil {
+		return nil, err
+	}
+	return dao, nil
+}
+
+var SharedHTTPAccessLogRollupDAO *HTTPAccessLogRollupDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedHTTPAccessLogRollupDAO = NewHTTPAccessLogRollupDAO()
+	})
+}
+
+// IncreaseRollups 将一批访问日志累加到汇总数据中
+func (this *HTTPAccessLogRollupDAO) IncreaseRollups(tx *dbs.Tx, accessLogs []*pb.HTTPAccessLog) error {
+	if len(accessLogs) == 0 {
+		return nil
+	}
+
+	var rollups = NewHTTPAccessLogRollupMap()
+	for _, accessLog := range accessLogs {
+		rollups.Add(accessLog)
+	}
+	return this.saveRollups(tx, rollups)
+}
+
+// CountTotal 计算某天的请求数和攻击请求数
+// serverIds 为空表示所有服务
+func (this *HTTPAccessLogRollupDAO) CountTotal(tx *dbs.Tx, day string, serverIds []int64) (count int64, attackCount int64, err error) {
+	err = this.eachDAO(tx, func(tx *dbs.Tx, dao *HTTPAccessLogRollupDAO) error {
+		var query = dao.Query(tx).
+			Attr("day", day).
+			Attr("dimension", HTTPAccessLogRollupDimensionTotal).
+			Attr("period", HTTPAccessLogRollupPeriodHour)
+		if len(serverIds) > 0 {
+			query.Attr("serverId", serverIds).
+				Reuse(false)
+		}
+		one, err := query.
+			Result("SUM(count) AS count, SUM(attackCount) AS attackCount").
+			Find()
+		if err != nil || one == nil {
+			return err
+		}
+		var rollup = one.(*HTTPAccessLogRollup)
+		count += int64(rollup.Count)
+		attackCount += int64(rollup.AttackCount)
+		return nil
+	})
+	return
+}
+
+// CountValues 计算某天某个维度下不同值的数量
+// IP、URI超出数量限制的值被合并，所以结果是近似值
+func (this *HTTPAccessLogRollupDAO) CountValues(tx *dbs.Tx, day string, dimension HTTPAccessLogRollupDimension, serverIds []int64, onlyAttack bool) (int64, error) {
+	var where = "`day`=? AND `dimension`=? AND `period`=?"
+	var args = []interface{}{day, dimension, HTTPAccessLogRollupPeriodHour}
+	if len(serverIds) > 0 {
+		where += " AND `serverId` IN (" + strings.TrimSuffix(strings.Repeat("?,", len(serverIds)), ",") + ")"
+		for _, serverId := range serverIds {
+			args = append(args, serverId)
+		}
+	}
+	if onlyAttack {
+		where += " AND `attackCount`>0"
+	}
+
+	var daoList = allHTTPAccessLogRollupDAOs()
+	if len(daoList) == 1 {
+		col, err := daoList[0].Instance.FindCol(0, "SELECT COUNT(DISTINCT `value`) FROM `"+daoList[0].Table+"` WHERE "+where, args...)
+		if err != nil {
+			return 0, err
+		}
+		return types.Int64(col), nil
+	}
+
+	// 多个数据库中可能有相同的值，所以需要合并之后再计算
+	var valueMap = map[string]bool{}
+	for _, dao := range daoList {
+		ones, _, err := dao.Instance.FindOnes("SELECT DISTINCT `value` FROM `"+dao.Table+"` WHERE "+where, args...)
+		if err != nil {
+			return 0, err
+		}
+		for _, one := range ones {
+			valueMap[one.GetString("value")] = true
+		}
+	}
+	return int64(len(valueMap)), nil
+}
+
+// FindTopValues 查找某天某个维度下请求数最多的值
+// serverIds 为空表示所有服务；onlyAttack 为true时按攻击请求数排序
+func (this *HTTPAccessLogRollupDAO) FindTopValues(tx *dbs.Tx, day string, dimension HTTPAccessLogRollupDimension, serverIds []int64, onlyAttack bool, size int64) (result []*HTTPAccessLogRollup, err error) {
+	var daoList = allHTTPAccessLogRollupDAOs()
+	var daoSize = size
+	if size > 0 && len(daoList) > 1 {
+		daoSize = size * httpAccessLogRollupTopFactor
+	}
+
+	var valueMap = map[string]*HTTPAccessLogRollup{}
+	err = this.eachDAO(tx, func(tx *dbs.Tx, dao *HTTPAccessLogRollupDAO) error {
+		var query = dao.Query(tx).
+			Attr("day", day).
+			Attr("dimension", dimension).
+			Attr("period", HTTPAccessLogRollupPeriodHour)
+		if len(serverIds) > 0 {
+			query.Attr("serverId", serverIds).
+				Reuse(false)
+		}
+		if onlyAttack {
+			query.Gt("attackCount", 0)
+			query.Desc("attackCount")
+		} else {
+			query.Desc("count")
+		}
+		if daoSize > 0 {
+			query.Limit(daoSize)
+		}
+		var rollups []*HTTPAccessLogRollup
+		_, err := query.
+			Result("value, SUM(count) AS count, SUM(attackCount) AS attackCount").
+			Group("value").
+			Slice(&rollups).
+			FindAll()
+		if err != nil {
+			return err
+		}
+		for _, rollup := range rollups {
+			oldRollup, ok := valueMap[rollup.Value]
+			if ok {
+				oldRollup.Count += rollup.Count
+				oldRollup.AttackCount += rollup.AttackCount
+			} else {
+				valueMap[rollup.Value] = rollup
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rollup := range valueMap {
+		result = append(result, rollup)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if onlyAttack && result[i].AttackCount != result[j].AttackCount {
+			return result[i].AttackCount > result[j].AttackCount
+		}
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	if size > 0 && int64(len(result)) > size {
+		result = result[:size]
+	}
+	return result, nil
+}
+
+// FindMinutelyTotals 查找一段时间内每分钟的请求数和攻击请求数
+// minuteFrom 和 minuteTo 格式为YYYYMMDDHHII
+func (this *HTTPAccessLogRollupDAO) FindMinutelyTotals(tx *dbs.Tx, serverIds []int64, minuteFrom string, minuteTo string) (result []*HTTPAccessLogRollup, err error) {
+	var timeMap = map[string]*HTTPAccessLogRollup{}
+	err = this.eachDAO(tx, func(tx *dbs.Tx, dao *HTTPAccessLogRollupDAO) error {
+		var query = dao.Query(tx).
+			Attr("period", HTTPAccessLogRollupPeriodMinute).
+			Attr("dimension", HTTPAccessLogRollupDimensionTotal).
+			Between("time", minuteFrom, minuteTo)
+		if len(serverIds) > 0 {
+			query.Attr("serverId", serverIds).
+				Reuse(false)
+		}
+		var rollups []*HTTPAccessLogRollup
+		_, err := query.
+			Result("time, SUM(count) AS count, SUM(attackCount) AS attackCount").
+			Group("time").
+			Slice(&rollups).
+			FindAll()
+		if err != nil {
+			return err
+		}
+		for _, rollup := range rollups {
+			oldRollup, ok := timeMap[rollup.Time]
+			if ok {
+				oldRollup.Count += rollup.Count
+				oldRollup.AttackCount += rollup.AttackCount
+			} else {
+				timeMap[rollup.Time] = rollup
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rollup := range timeMap {
+		result = append(result, rollup)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Time < result[j].Time
+	})
+	return result, nil
+}
+
+// DeleteDayRollups 删除所有日志数据库中某天的汇总数据
+func (this *HTTPAccessLogRollupDAO) DeleteDayRollups(tx *dbs.Tx, day string) error {
+	return this.eachDAO(tx, func(tx *dbs.Tx, dao *HTTPAccessLogRollupDAO) error {
+		_, err := dao.Query(tx).
+			Attr("day", day).
+			Delete()
+		return err
+	})
+}
+
+// BackfillDay 使用某天的原始访问日志重新生成汇总数据
+// 每个日志数据库中的日志汇总到同一个数据库中；只能用于已经结束的日期，否则会和正在写入的汇总数据重复计算
+func (this *HTTPAccessLogRollupDAO) BackfillDay(tx *dbs.Tx, day string, progress func(count int64)) (total int64, err error) {
+	if !regexp.MustCompile(`^\d{8}$`).MatchString(day) {
+		return 0, errors.New("invalid day '" + day + "', should be YYYYMMDD")
+	}
+	if day >= timeutil.Format("Ymd") {
+		return 0, errors.New("can not backfill '" + day + "', only past days are allowed")
+	}
+
+	err = this.DeleteDayRollups(tx, day)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, daoWrapper := range allHTTPAccessLogDAOs() {
+		var dao = daoWrapper.DAO
+		var rollupDAO = daoWrapper.RollupDAO
+		if rollupDAO == nil {
+			continue
+		}
+		tableName, _, _, exists, err := findHTTPAccessLogTableName(dao.Instance, day)
+		if err != nil {
+			return total, err
+		}
+		if !exists {
+			continue
+		}
+
+		var lastId uint64 = 0
+		for {
+			var accessLogs []*HTTPAccessLog
+			_, err = dao.Query(tx).
+				Table(tableName).
+				Gt("id", lastId).
+				AscPk().
+				Limit(HTTPAccessLogQueueBatchSize).
+				Slice(&accessLogs).
+				FindAll()
+			if err != nil {
+				return total, err
+			}
+			if len(accessLogs) == 0 {
+				break
+			}
+			lastId = accessLogs[len(accessLogs)-1].Id
+
+			var rollups = NewHTTPAccessLogRollupMap()
+			for _, accessLog := range accessLogs {
+				pbAccessLog, err := accessLog.ToPB()
+				if err != nil {
+					// 忽略无法解析的日志
+					continue
+				}
+				rollups.Add(pbAccessLog)
+			}
+			err = rollupDAO.saveRollups(nil, rollups)
+			if err != nil {
+				return total, err
+			}
+
+			total += int64(len(accessLogs))
+			if progress != nil {
+				progress(total)
+			}
+		}
+	}
+
+	// 合并超出数量限制的值
+	for hour := 0; hour < 24; hour++ {
+		err = this.CompactHourRollups(tx, day+fmt.Sprintf("%02d", hour))
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// CleanExpiredRollups 清理所有日志数据库中过期的汇总数据
+func (this *HTTPAccessLogRollupDAO) CleanExpiredRollups(tx *dbs.Tx, period HTTPAccessLogRollupPeriod, days int) error {
+	if days <= 0 {
+		return nil
+	}
+	var day = timeutil.Format("Ymd", time.Now().AddDate(0, 0, -days))
+	return this.eachDAO(tx, func(tx *dbs.Tx, dao *HTTPAccessLogRollupDAO) error {
+		_, err := dao.Query(tx).
+			Attr("period", period).
+			Lt("day", day).
+			Delete()
+		return err
+	})
+}
+
+// CompactHourRollups 将所有日志数据库中某个小时超出数量限制的IP、URI合并为一条
+// hour 格式为YYYYMMDDHH；同一批日志在写入时已经限制了数量，这里合并多批日志累加之后超出限制的值
+func (this *HTTPAccessLogRollupDAO) CompactHourRollups(tx *dbs.Tx, hour string) error {
+	return this.eachDAO(tx, func(tx *dbs.Tx, dao *HTTPAccessLogRollupDAO) error {
+		for _, dimension := range httpAccessLogRollupCappedDimensions {
+			ones, _, err := dao.Instance.FindOnes("SELECT `serverId` FROM `"+dao.Table+"` WHERE `serverId`>=0 AND `period`=? AND `time`=? AND `dimension`=? GROUP BY `serverId` HAVING COUNT(*)>?", HTTPAccessLogRollupPeriodHour, hour, dimension, HTTPAccessLogRollupHourMaxValues+1)
+			if err != nil {
+				return err
+			}
+			for _, one := range ones {
+				err = dao.Instance.RunTx(func(tx *dbs.Tx) error {
+					return dao.compactServerHourRollups(tx, one.GetInt64("serverId"), hour, dimension)
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// 合并某个服务某个小时超出数量限制的值
+// 在事务中锁定要合并的行，防止多个API节点同时合并时重复累加
+func (this *HTTPAccessLogRollupDAO) compactServerHourRollups(tx *dbs.Tx, serverId int64, hour string, dimension HTTPAccessLogRollupDimension) error {
+	var rollups []*HTTPAccessLogRollup
+	_, err := this.Query(tx).
+		Attr("serverId", serverId).
+		Attr("period", HTTPAccessLogRollupPeriodHour).
+		Attr("time", hour).
+		Attr("dimension", dimension).
+		Neq("value", HTTPAccessLogRollupOtherValue).
+		Desc("count").
+		Offset(HTTPAccessLogRollupHourMaxValues).
+		Limit(math.MaxInt32).
+		Lock(dbs.QueryLockForUpdate).
+		Slice(&rollups).
+		FindAll()
+	if err != nil || len(rollups) == 0 {
+		return err
+	}
+
+	var other = &HTTPAccessLogRollup{
+		ServerId:  uint32(serverId),
+		Period:    HTTPAccessLogRollupPeriodHour,
+		Time:      hour,
+		Day:       hour[:8],
+		Dimension: dimension,
+		Value:     HTTPAccessLogRollupOtherValue,
+	}
+	var rollupIds = []int64{}
+	for _, rollup := range rollups {
+		other.Count += rollup.Count
+		other.AttackCount += rollup.AttackCount
+		rollupIds = append(rollupIds, int64(rollup.Id))
+	}
+	_, err = this.Query(tx).
+		Attr("id", rollupIds).
+		Reuse(false).
+		Delete()
+	if err != nil {
+		return err
+	}
+	return this.saveRollupItems(tx, []*HTTPAccessLogRollup{other})
+}
+
+// 在所有日志数据库的汇总数据中执行操作，事务只用于默认数据库
+func (this *HTTPAccessLogRollupDAO) eachDAO(tx *dbs.Tx, f func(tx *dbs.Tx, dao *HTTPAccessLogRollupDAO) error) error {
+	for _, dao := range allHTTPAccessLogRollupDAOs() {
+		var daoTx *dbs.Tx
+		if dao == this {
+			daoTx = tx
+		}
+		err := f(daoTx, dao)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 保存汇总数据
+// 使用 INSERT ... ON DUPLICATE KEY UPDATE 累加，多个API节点可以同时写入
+func (this *HTTPAccessLogRollupDAO) saveRollups(tx *dbs.Tx, rollups *HTTPAccessLogRollupMap) error {
+	return this.saveRollupItems(tx, rollups.Items())
+}
+
+// 累加多条汇总数据
+func (this *HTTPAccessLogRollupDAO) saveRollupItems(tx *dbs.Tx, items []*HTTPAccessLogRollup) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	var prefix = "INSERT INTO `" + this.Table + "` (`serverId`,`period`,`time`,`day`,`dimension`,`value`,`count`,`attackCount`) VALUES "
+	var suffix = " ON DUPLICATE KEY UPDATE `count`=`count`+VALUES(`count`), `attackCount`=`attackCount`+VALUES(`attackCount`)"
+	for offset := 0; offset < len(items); offset += httpAccessLogRollupInsertRows {
+		var end = offset + httpAccessLogRollupInsertRows
+		if end > len(items) {
+			end = len(items)
+		}
+
+		var placeholders = []string{}
+		var args = []interface{}{}
+		for _, item := range items[offset:end] {
+			placeholders = append(placeholders, "(?,?,?,?,?,?,?,?)")
+			args = append(args, item.ServerId, item.Period, item.Time, item.Day, item.Dimension, item.Value, item.Count, item.AttackCount)
+		}
+
+		var sql = prefix + strings.Join(placeholders, ",") + suffix
+		var err error
+		if tx != nil {
+			_, err = tx.Exec(sql, args...)
+		} else {
+			_, err = this.Instance.Exec(sql, args...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HTTPAccessLogRollupMap 在内存中汇总一批访问日志
+type HTTPAccessLogRollupMap struct {
+	m map[string]*HTTPAccessLogRollup // key => rollup
+}
+
+func NewHTTPAccessLogRollupMap() *HTTPAccessLogRollupMap {
+	return &HTTPAccessLogRollupMap{
+		m: map[string]*HTTPAccessLogRollup{},
+	}
+}
+
+// Add 添加一条访问日志
+func (this *HTTPAccessLogRollupMap) Add(accessLog *pb.HTTPAccessLog) {
+	if accessLog == nil {
+		return
+	}
+
+	var t = time.Unix(accessLog.Timestamp, 0)
+	var day = timeutil.Format("Ymd", t)
+	var hour = timeutil.Format("YmdH", t)
+	var minute = timeutil.Format("YmdHi", t)
+	var serverId = accessLog.ServerId
+	var isAttack = accessLog.FirewallPolicyId > 0
+
+	// 分钟
+	this.increase(serverId, HTTPAccessLogRollupPeriodMinute, minute, day, HTTPAccessLogRollupDimensionTotal, "", isAttack)
+	this.increase(serverId, HTTPAccessLogRollupPeriodMinute, minute, day, HTTPAccessLogRollupDimensionStatus, types.String(accessLog.Status), isAttack)
+	if accessLog.FirewallRuleGroupId > 0 {
+		this.increase(serverId, HTTPAccessLogRollupPeriodMinute, minute, day, HTTPAccessLogRollupDimensionAttackGroup, types.String(accessLog.FirewallRuleGroupId), isAttack)
+	}
+
+	// 小时
+	this.increase(serverId, HTTPAccessLogRollupPeriodHour, hour, day, HTTPAccessLogRollupDimensionTotal, "", isAttack)
+	this.increase(serverId, HTTPAccessLogRollupPeriodHour, hour, day, HTTPAccessLogRollupDimensionStatus, types.String(accessLog.Status), isAttack)
+	if accessLog.FirewallRuleGroupId > 0 {
+		this.increase(serverId, HTTPAccessLogRollupPeriodHour, hour, day, HTTPAccessLogRollupDimensionAttackGroup, types.String(accessLog.FirewallRuleGroupId), isAttack)
+	}
+	if len(accessLog.RemoteAddr) > 0 {
+		this.increase(serverId, HTTPAccessLogRollupPeriodHour, hour, day, HTTPAccessLogRollupDimensionIP, accessLog.RemoteAddr, isAttack)
+	}
+	if len(accessLog.Host) > 0 {
+		this.increase(serverId, HTTPAccessLogRollupPeriodHour, hour, day, HTTPAccessLogRollupDimensionHost, accessLog.Host, isAttack)
+	}
+	if len(accessLog.RequestURI) > 0 {
+		this.increase(serverId, HTTPAccessLogRollupPeriodHour, hour, day, HTTPAccessLogRollupDimensionURI, accessLog.RequestURI, isAttack)
+	}
+}
+
+// Items 所有汇总数据，按唯一键排序，以减少多个节点同时写入时的死锁
+// 每个服务每小时的IP、URI超出数量限制时，请求数较少的值合并为 HTTPAccessLogRollupOtherValue
+func (this *HTTPAccessLogRollupMap) Items() []*HTTPAccessLogRollup {
+	this.trim()
+
+	var keys = make([]string, 0, len(this.m))
+	for key := range this.m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result = make([]*HTTPAccessLogRollup, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, this.m[key])
+	}
+	return result
+}
+
+// Len 汇总数据条数
+func (this *HTTPAccessLogRollupMap) Len() int {
+	return len(this.m)
+}
+
+// 合并超出数量限制的值
+func (this *HTTPAccessLogRollupMap) trim() {
+	var bucketMap = map[string][]string{} // bucket => keys
+	for key, rollup := range this.m {
+		if rollup.Period != HTTPAccessLogRollupPeriodHour || rollup.Value == HTTPAccessLogRollupOtherValue || !lists.ContainsString(httpAccessLogRollupCappedDimensions, rollup.Dimension) {
+			continue
+		}
+		var bucket = types.String(rollup.ServerId) + "|" + rollup.Time + "|" + rollup.Dimension
+		bucketMap[bucket] = append(bucketMap[bucket], key)
+	}
+
+	for _, keys := range bucketMap {
+		if len(keys) <= HTTPAccessLogRollupHourMaxValues {
+			continue
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			var rollup1 = this.m[keys[i]]
+			var rollup2 = this.m[keys[j]]
+			if rollup1.Count != rollup2.Count {
+				return rollup1.Count > rollup2.Count
+			}
+			return keys[i] < keys[j]
+		})
+		for _, key := range keys[HTTPAccessLogRollupHourMaxValues:] {
+			var rollup = this.m[key]
+			delete(this.m, key)
+			var other = this.find(int64(rollup.ServerId), rollup.Period, rollup.Time, rollup.Day, rollup.Dimension, HTTPAccessLogRollupOtherValue)
+			other.Count += rollup.Count
+			other.AttackCount += rollup.AttackCount
+		}
+	}
+}
+
+func (this *HTTPAccessLogRollupMap) increase(serverId int64, period HTTPAccessLogRollupPeriod, timeString string, day string, dimension HTTPAccessLogRollupDimension, value string, isAttack bool) {
+	if len(value) > httpAccessLogRollupMaxValue {
+		value = strings.ToValidUTF8(value[:httpAccessLogRollupMaxValue], "")
+	}
+
+	var rollup = this.find(serverId, period, timeString, day, dimension, value)
+	rollup.Count++
+	if isAttack {
+		rollup.AttackCount++
+	}
+}
+
+// 查找汇总数据，不存在时创建
+func (this *HTTPAccessLogRollupMap) find(serverId int64, period HTTPAccessLogRollupPeriod, timeString string, day string, dimension HTTPAccessLogRollupDimension, value string) *HTTPAccessLogRollup {
+	var key = types.String(serverId) + "|" + period + "|" + timeString + "|" + dimension + "|" + value
+	rollup, ok := this.m[key]
+	if !ok {
+		rollup = &HTTPAccessLogRollup{
+			ServerId:  uint32(serverId),
+			Period:    period,
+			Time:      timeString,
+			Day:       day,
+			Dimension: dimension,
+			Value:     value,
+		}
+		this.m[key] = rollup
+	}
+	return rollup
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+	"testing"
+	"time"
+)
+
+func TestHTTPAccessLogRollupMap_Add(t *testing.T) {
+	var timestamp = time.Now().Unix()
+	var rollups = NewHTTPAccessLogRollupMap()
+	rollups.Add(&pb.HTTPAccessLog{ServerId: 1, Status: 200, Timestamp: timestamp, RemoteAddr: "127.0.0.1", Host: "example.com", RequestURI: "/"})
+	rollups.Add(&pb.HTTPAccessLog{ServerId: 1, Status: 403, Timestamp: timestamp, RemoteAddr: "127.0.0.1", Host: "example.com", RequestURI: "/admin", FirewallPolicyId: 1, FirewallRuleGroupId: 2})
+
+	var counts = map[string]uint64{}
+	var attackCounts = map[string]uint64{}
+	for _, rollup := range rollups.Items() {
+		counts[rollup.Period+"|"+rollup.Dimension+"|"+rollup.Value] += rollup.Count
+		attackCounts[rollup.Period+"|"+rollup.Dimension+"|"+rollup.Value] += rollup.AttackCount
+	}
+	if counts["hour|total|"] != 2 || attackCounts["hour|total|"] != 1 {
+		t.Fatal("invalid total:", counts["hour|total|"], attackCounts["hour|total|"])
+	}
+	if counts["minute|total|"] != 2 {
+		t.Fatal("invalid minute total")
+	}
+	if counts["hour|ip|127.0.0.1"] != 2 || attackCounts["hour|ip|127.0.0.1"] != 1 {
+		t.Fatal("invalid ip rollup")
+	}
+	if counts["hour|status|403"] != 1 || attackCounts["hour|attackGroup|2"] != 1 {
+		t.Fatal("invalid status or attack group rollup")
+	}
+	if counts["minute|ip|127.0.0.1"] > 0 {
+		t.Fatal("ip should not be rolled up by minute")
+	}
+}
+
+func TestHTTPAccessLogRollupMap_Items_Trim(t *testing.T) {
+	var timestamp = time.Now().Unix()
+	var rollups = NewHTTPAccessLogRollupMap()
+	for i := 0; i < HTTPAccessLogRollupHourMaxValues+5; i++ {
+		rollups.Add(&pb.HTTPAccessLog{ServerId: 1, Status: 200, Timestamp: timestamp, RemoteAddr: "192.168.0." + types.String(i)})
+	}
+
+	// 请求数较多的值需要保留
+	for i := 0; i < 2; i++ {
+		rollups.Add(&pb.HTTPAccessLog{ServerId: 1, Status: 200, Timestamp: timestamp, RemoteAddr: "192.168.0.9999"})
+	}
+
+	var countIPs = 0
+	var otherCount uint64
+	var keepTop = false
+	for _, rollup := range rollups.Items() {
+		if rollup.Period != HTTPAccessLogRollupPeriodHour || rollup.Dimension != HTTPAccessLogRollupDimensionIP {
+			continue
+		}
+		if rollup.Value == HTTPAccessLogRollupOtherValue {
+			otherCount = rollup.Count
+			continue
+		}
+		if rollup.Value == "192.168.0.9999" {
+			keepTop = true
+		}
+		countIPs++
+	}
+	if countIPs != HTTPAccessLogRollupHourMaxValues {
+		t.Fatal("expect", HTTPAccessLogRollupHourMaxValues, "ips, but got", countIPs)
+	}
+	if otherCount != 6 {
+		t.Fatal("expect other count 6, but got", otherCount)
+	}
+	if !keepTop {
+		t.Fatal("top ip should be kept")
+	}
+}
+
+func TestHTTPAccessLogRollupDAO_IncreaseRollups(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	err := SharedHTTPAccessLogRollupDAO.IncreaseRollups(tx, []*pb.HTTPAccessLog{
+		{ServerId: 1, Status: 200, Timestamp: time.Now().Unix(), RemoteAddr: "127.0.0.1", Host: "example.com", RequestURI: "/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, attackCount, err := SharedHTTPAccessLogRollupDAO.CountTotal(tx, timeutil.Format("Ymd"), []int64{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("count:", count, "attackCount:", attackCount)
+}
+
+func TestHTTPAccessLogRollupDAO_BackfillDay(t *testing.T) {
+	dbs.NotifyReady()
+
+	err := NewDBNodeInitializer().LoadOnce()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := SharedHTTPAccessLogRollupDAO.BackfillDay(nil, timeutil.Format("Ymd", time.Now().AddDate(0, 0, -1)), func(count int64) {
+		t.Log(count)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("backfill", count, "access logs")
+}
@@ -0,0 +1,30 @@
+package models
+
+// HTTPAccessLogRollup 访问日志汇总
+type HTTPAccessLogRollup struct {
+	Id          uint64 `field:"id"`          // ID
+	ServerId    uint32 `field:"serverId"`    // 服务ID
+	Period      string `field:"period"`      // 周期：minute|hour
+	Time        string `field:"time"`        // YYYYMMDDHH或YYYYMMDDHHII
+	Day         string `field:"day"`         // YYYYMMDD
+	Dimension   string `field:"dimension"`   // 维度
+	Value       string `field:"value"`       // 维度值
+	Count       uint64 `field:"count"`       // 请求数
+	AttackCount uint64 `field:"attackCount"` // 攻击请求数
+}
+
+type HTTPAccessLogRollupOperator struct {
+	Id          interface{} // ID
+	ServerId    interface{} // 服务ID
+	Period      interface{} // 周期：minute|hour
+	Time        interface{} // YYYYMMDDHH或YYYYMMDDHHII
+	Day         interface{} // YYYYMMDD
+	Dimension   interface{} // 维度
+	Value       interface{} // 维度值
+	Count       interface{} // 请求数
+	AttackCount interface{} // 攻击请求数
+}
+
+func NewHTTPAccessLogRollupOperator() *HTTPAccessLogRollupOperator {
+	return &HTTPAccessLogRollupOperator{}
+}
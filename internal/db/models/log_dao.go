@@ -1,7 +1,11 @@
 package models
 
 import (
+	"encoding/json"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/secrets"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
@@ -9,6 +13,7 @@ import (
 	timeutil "github.com/iwind/TeaGo/utils/time"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,6 +32,15 @@ func NewLogDAO() *LogDAO {
 
 var SharedLogDAO *LogDAO
 
+// 没有主密钥时只提示一次
+var logUnkeyedHashWarnOnce = &sync.Once{}
+
+const (
+	logHashChainLockerKey        = "adminLogHashChain"       // 哈希链写入锁
+	logHashChainAnchorSettingKey = "adminLogHashChainAnchor" // 已清理日志中最后一条日志的哈希值
+	logHashKeyPurpose            = "adminLogHashChain"       // 从主密钥派生哈希链密钥时使用的用途
+)
+
 func init() {
 	dbs.OnReady(func() {
 		SharedLogDAO = NewLogDAO()
@@ -35,25 +49,93 @@ func init() {
 
 // 创建管理员日志
 func (this *LogDAO) CreateLog(tx *dbs.Tx, adminType string, adminId int64, level string, description string, action string, ip string) error {
-	op := NewLogOperator()
-	op.Level = level
-	op.Description = description
-	op.Action = action
-	op.Ip = ip
-	op.Type = adminType
+	return this.CreateAuditLog(tx, adminType, adminId, level, description, action, ip, "", nil)
+}
+
+// CreateAuditLog 创建审计日志
+// 日志中会记录调用的RPC方法和数据变更，并和上一条日志组成哈希链
+func (this *LogDAO) CreateAuditLog(tx *dbs.Tx, adminType string, adminId int64, level string, description string, action string, ip string, rpcMethod string, diffItems []*utils.JSONDiffItem) error {
+	if tx == nil {
+		return this.Instance.RunTx(func(tx *dbs.Tx) error {
+			return this.CreateAuditLog(tx, adminType, adminId, level, description, action, ip, rpcMethod, diffItems)
+		})
+	}
+
+	var log = &Log{
+		Level:       this.limitString(level, 32),
+		Description: this.limitString(description, 1024),
+		Action:      this.limitString(action, 255),
+		Ip:          this.limitString(ip, 32),
+		RpcMethod:   this.limitString(rpcMethod, 255),
+		Type:        LogTypeAdmin,
+		Day:         timeutil.Format("Ymd"),
+		CreatedAt:   uint64(time.Now().Unix()),
+	}
 
 	switch adminType {
 	case "admin":
-		op.AdminId = adminId
+		log.AdminId = uint32(adminId)
 	case "user":
-		op.UserId = adminId
+		log.UserId = uint32(adminId)
 	case "provider":
-		op.ProviderId = adminId
+		log.ProviderId = uint32(adminId)
+	}
+
+	if len(diffItems) > 0 {
+		diffJSON, err := json.Marshal(diffItems)
+		if err != nil {
+			return err
+		}
+		log.Diff = string(diffJSON)
+	}
+
+	// 锁定哈希链，防止多个API节点同时写入时出现分叉
+	_, err := SharedSysLockerDAO.Increase(tx, logHashChainLockerKey, 0)
+	if err != nil {
+		return err
+	}
+	prevHash, err := this.findLastHash(tx)
+	if err != nil {
+		return err
+	}
+	log.PrevHash = prevHash
+
+	// 使用从当前主密钥派生的密钥计算哈希值
+	keyring, err := secrets.SharedKeyring()
+	if err != nil {
+		return err
+	}
+	var hashKey []byte
+	if !keyring.IsEmpty() {
+		var masterKey = keyring.ActiveKey()
+		log.HashKeyId = masterKey.Id
+		hashKey = masterKey.DeriveKey(logHashKeyPurpose)
+	} else {
+		logUnkeyedHashWarnOnce.Do(func() {
+			remotelogs.Error("AUDIT_LOG", "no master key found, audit log hash chain will not be keyed, please set '"+secrets.EnvMasterKeys+"' or create 'configs/"+secrets.MasterKeyFile+"'")
+		})
 	}
+	log.Hash = log.ComputeHash(hashKey)
 
-	op.Day = timeutil.Format("Ymd")
-	op.Type = LogTypeAdmin
-	err := this.Save(tx, op)
+	op := NewLogOperator()
+	op.Level = log.Level
+	op.Description = log.Description
+	op.Action = log.Action
+	op.Ip = log.Ip
+	op.RpcMethod = log.RpcMethod
+	op.Type = log.Type
+	op.AdminId = log.AdminId
+	op.UserId = log.UserId
+	op.ProviderId = log.ProviderId
+	op.Day = log.Day
+	op.CreatedAt = log.CreatedAt
+	if len(log.Diff) > 0 {
+		op.Diff = log.Diff
+	}
+	op.PrevHash = log.PrevHash
+	op.Hash = log.Hash
+	op.HashKeyId = log.HashKeyId
+	err = this.Save(tx, op)
 	return err
 }
 
@@ -120,6 +202,17 @@ func (this *LogDAO) ListLogs(tx *dbs.Tx, offset int64, size int64, dayFrom strin
 	return
 }
 
+// ListLogsAfterId 列出某个ID之后的日志
+func (this *LogDAO) ListLogsAfterId(tx *dbs.Tx, lastId int64, size int64) (result []*Log, err error) {
+	_, err = this.Query(tx).
+		Gt("id", lastId).
+		AscPk().
+		Limit(size).
+		Slice(&result).
+		FindAll()
+	return
+}
+
 // 物理删除日志
 func (this *LogDAO) DeleteLogPermanently(tx *dbs.Tx, logId int64) error {
 	if logId <= 0 {
@@ -130,22 +223,87 @@ func (this *LogDAO) DeleteLogPermanently(tx *dbs.Tx, logId int64) error {
 }
 
 // 物理删除所有日志
+// 删除前会记录哈希链的锚点，并在删除后记录一条清理日志
 func (this *LogDAO) DeleteAllLogsPermanently(tx *dbs.Tx) error {
-	_, err := this.Query(tx).
-		Delete()
-	return err
+	return this.purgeLogs(tx, "")
 }
 
 // 物理删除某些天之前的日志
+// 删除前会记录哈希链的锚点，并在删除后记录一条清理日志
 func (this *LogDAO) DeleteLogsPermanentlyBeforeDays(tx *dbs.Tx, days int) error {
 	if days <= 0 {
 		days = 0
 	}
 	untilDay := timeutil.Format("Ymd", time.Now().AddDate(0, 0, -days))
-	_, err := this.Query(tx).
-		Lte("day", untilDay).
-		Delete()
-	return err
+	return this.purgeLogs(tx, untilDay)
+}
+
+// CheckHashChain 检查日志哈希链是否完整
+// 返回第一条被修改、或者前面有日志被删除的日志ID，如果为0表示日志完整
+// 校验使用主密钥的日志时需要对应的主密钥，所以轮换主密钥后仍然需要保留旧密钥
+func (this *LogDAO) CheckHashChain(tx *dbs.Tx) (brokenLogId int64, err error) {
+	anchor, err := SharedSysSettingDAO.ReadSetting(tx, logHashChainAnchorSettingKey)
+	if err != nil {
+		return 0, err
+	}
+	keyring, err := secrets.SharedKeyring()
+	if err != nil {
+		return 0, err
+	}
+
+	var lastHash = string(anchor)
+	var lastId int64 = 0
+	var hasHash = false
+	var hasKey = false
+	for {
+		var logs = []*Log{}
+		_, err = this.Query(tx).
+			Gt("id", lastId).
+			AscPk().
+			Limit(1000).
+			Slice(&logs).
+			FindAll()
+		if err != nil {
+			return 0, err
+		}
+		if len(logs) == 0 {
+			break
+		}
+
+		for _, log := range logs {
+			lastId = int64(log.Id)
+
+			// 升级之前的日志没有哈希值
+			if len(log.Hash) == 0 {
+				if hasHash {
+					return lastId, nil
+				}
+				lastHash = ""
+				continue
+			}
+			hasHash = true
+
+			var hashKey []byte
+			if len(log.HashKeyId) > 0 {
+				var masterKey = keyring.FindKey(log.HashKeyId)
+				if masterKey == nil {
+					return 0, errors.New("can not find master key '" + log.HashKeyId + "' to check log '" + types.String(lastId) + "'")
+				}
+				hashKey = masterKey.DeriveKey(logHashKeyPurpose)
+				hasKey = true
+			} else if hasKey {
+				// 使用主密钥之后的日志都必须使用主密钥，防止通过去掉密钥ID来伪造日志
+				return lastId, nil
+			}
+
+			if log.PrevHash != lastHash || log.ComputeHash(hashKey) != log.Hash {
+				return lastId, nil
+			}
+			lastHash = log.Hash
+		}
+	}
+
+	return 0, nil
 }
 
 // 计算当前日志容量大小
@@ -157,6 +315,81 @@ func (this *LogDAO) SumLogsSize() (int64, error) {
 	return types.Int64(col), nil
 }
 
+// 清理某天及之前的日志，如果day为空则清理所有日志
+func (this *LogDAO) purgeLogs(tx *dbs.Tx, untilDay string) error {
+	if tx == nil {
+		return this.Instance.RunTx(func(tx *dbs.Tx) error {
+			return this.purgeLogs(tx, untilDay)
+		})
+	}
+
+	_, err := SharedSysLockerDAO.Increase(tx, logHashChainLockerKey, 0)
+	if err != nil {
+		return err
+	}
+
+	query := this.Query(tx)
+	if len(untilDay) > 0 {
+		query.Lte("day", untilDay)
+	}
+	one, err := query.
+		Result("id", "hash").
+		DescPk().
+		Find()
+	if err != nil {
+		return err
+	}
+	if one == nil {
+		return nil
+	}
+	var lastLog = one.(*Log)
+
+	count, err := this.Query(tx).
+		Lte("id", lastLog.Id).
+		Delete()
+	if err != nil {
+		return err
+	}
+
+	// 记录锚点，用来校验剩余日志的哈希链
+	err = SharedSysSettingDAO.UpdateSetting(tx, logHashChainAnchorSettingKey, []byte(lastLog.Hash))
+	if err != nil {
+		return err
+	}
+
+	return this.CreateAuditLog(tx, "", 0, "warn", "清理了"+types.String(count)+"条操作日志，最后一条日志ID："+types.String(lastLog.Id)+"，哈希值："+lastLog.Hash, "purge", "", "", nil)
+}
+
+// 查找最后一条日志的哈希值
+func (this *LogDAO) findLastHash(tx *dbs.Tx) (string, error) {
+	one, err := this.Query(tx).
+		Result("id", "hash").
+		DescPk().
+		Find()
+	if err != nil {
+		return "", err
+	}
+	if one != nil {
+		return one.(*Log).Hash, nil
+	}
+
+	// 如果日志已被全部清理，则使用清理时记录的锚点
+	anchor, err := SharedSysSettingDAO.ReadSetting(tx, logHashChainAnchorSettingKey)
+	if err != nil {
+		return "", err
+	}
+	return string(anchor), nil
+}
+
+// 限制字符串长度，防止写入数据库时被截断而导致哈希值不一致
+func (this *LogDAO) limitString(s string, maxLength int) string {
+	var runes = []rune(s)
+	if len(runes) > maxLength {
+		return string(runes[:maxLength])
+	}
+	return s
+}
+
 // 格式化日期
 func (this *LogDAO) formatDay(day string) string {
 	if !regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`).MatchString(day) {
@@ -1,8 +1,10 @@
 package models
 
 import (
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
 	"testing"
 )
 
@@ -15,3 +17,53 @@ func TestLogDAO_SumLogsSize(t *testing.T) {
 	}
 	t.Log("size:", size)
 }
+
+func TestLogDAO_CreateAuditLog(t *testing.T) {
+	dbs.NotifyReady()
+
+	diffItems, err := utils.DiffObjects(maps.Map{"name": "a"}, maps.Map{"name": "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SharedLogDAO.CreateAuditLog(nil, "admin", 1, "info", "test audit log", "", "127.0.0.1", "/pb.LogService/createLog", diffItems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ok")
+}
+
+func TestLogDAO_CheckHashChain(t *testing.T) {
+	dbs.NotifyReady()
+
+	brokenLogId, err := SharedLogDAO.CheckHashChain(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("brokenLogId:", brokenLogId)
+}
+
+func TestLog_ComputeHash(t *testing.T) {
+	var log = &Log{
+		Level:       "info",
+		Description: "test audit log",
+		CreatedAt:   1600000000,
+		AdminId:     1,
+		Type:        LogTypeAdmin,
+	}
+	var plainHash = log.ComputeHash(nil)
+
+	log.HashKeyId = "1"
+	var keyedHash = log.ComputeHash([]byte("key1"))
+	if keyedHash == plainHash {
+		t.Fatal("keyed hash should be different from plain hash")
+	}
+	if log.ComputeHash([]byte("key2")) == keyedHash {
+		t.Fatal("hash should depend on key")
+	}
+
+	// 修改密钥ID
+	log.HashKeyId = "2"
+	if log.ComputeHash([]byte("key1")) == keyedHash {
+		t.Fatal("hash should depend on key id")
+	}
+}
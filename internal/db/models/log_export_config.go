@@ -0,0 +1,17 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package models
+
+// LogExportSettingCode 操作日志导出配置代号
+const LogExportSettingCode = "adminLogExportConfig"
+
+// LogExportConfig 操作日志导出配置
+type LogExportConfig struct {
+	IsOn      bool    `json:"isOn"`      // 是否启用
+	PolicyIds []int64 `json:"policyIds"` // 访问日志存储策略ID，仅支持syslog和tcp类型的策略
+}
+
+// NewLogExportConfig 获取新对象
+func NewLogExportConfig() *LogExportConfig {
+	return &LogExportConfig{}
+}
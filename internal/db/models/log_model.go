@@ -14,6 +14,11 @@ type Log struct {
 	Type        string `field:"type"`        // 类型：admin, user
 	Day         string `field:"day"`         // 日期
 	BillId      uint32 `field:"billId"`      // 账单ID
+	RpcMethod   string `field:"rpcMethod"`   // RPC方法
+	Diff        string `field:"diff"`        // 数据变更
+	PrevHash    string `field:"prevHash"`    // 上一条日志的哈希值
+	Hash        string `field:"hash"`        // 哈希值
+	HashKeyId   string `field:"hashKeyId"`   // 计算哈希值使用的主密钥ID
 }
 
 type LogOperator struct {
@@ -29,6 +34,11 @@ type LogOperator struct {
 	Type        interface{} // 类型：admin, user
 	Day         interface{} // 日期
 	BillId      interface{} // 账单ID
+	RpcMethod   interface{} // RPC方法
+	Diff        interface{} // 数据变更
+	PrevHash    interface{} // 上一条日志的哈希值
+	Hash        interface{} // 哈希值
+	HashKeyId   interface{} // 计算哈希值使用的主密钥ID
 }
 
 func NewLogOperator() *LogOperator {
@@ -1 +1,75 @@
 package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/iwind/TeaGo/maps"
+	"strings"
+)
+
+// ComputeHash 计算日志的哈希值
+// 哈希值中包含上一条日志的哈希值，从而形成哈希链，任何删除或修改都可以被检测到；
+// key为从主密钥派生的密钥，不为空时使用HMAC-SHA256，从而只能访问数据库的人无法重新计算整条哈希链
+func (this *Log) ComputeHash(key []byte) string {
+	var pieces = []string{
+		this.PrevHash,
+		fmt.Sprintf("%d", this.CreatedAt),
+		this.Type,
+		fmt.Sprintf("%d", this.AdminId),
+		fmt.Sprintf("%d", this.UserId),
+		fmt.Sprintf("%d", this.ProviderId),
+		this.Level,
+		this.Action,
+		this.Description,
+		this.Ip,
+		this.RpcMethod,
+		this.Day,
+		this.Diff,
+	}
+	if len(key) == 0 {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(pieces, "\n"))))
+	}
+
+	pieces = append(pieces, this.HashKeyId)
+	var h = hmac.New(sha256.New, key)
+	h.Write([]byte(strings.Join(pieces, "\n")))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// DecodeDiff 解析数据变更
+func (this *Log) DecodeDiff() []*utils.JSONDiffItem {
+	var result = []*utils.JSONDiffItem{}
+	if len(this.Diff) == 0 || this.Diff == "null" {
+		return result
+	}
+	err := json.Unmarshal([]byte(this.Diff), &result)
+	if err != nil {
+		return []*utils.JSONDiffItem{}
+	}
+	return result
+}
+
+// ExportJSON 导出到外部存储时使用的JSON数据
+func (this *Log) ExportJSON() ([]byte, error) {
+	return json.Marshal(maps.Map{
+		"id":          this.Id,
+		"type":        this.Type,
+		"level":       this.Level,
+		"adminId":     this.AdminId,
+		"userId":      this.UserId,
+		"providerId":  this.ProviderId,
+		"action":      this.Action,
+		"description": this.Description,
+		"ip":          this.Ip,
+		"rpcMethod":   this.RpcMethod,
+		"diff":        this.DecodeDiff(),
+		"createdAt":   this.CreatedAt,
+		"day":         this.Day,
+		"prevHash":    this.PrevHash,
+		"hash":        this.Hash,
+		"hashKeyId":   this.HashKeyId,
+	})
+}
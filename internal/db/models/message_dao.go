@@ -42,6 +42,8 @@ const (
 	MessageTypeFirewallEvent              MessageType = "FirewallEvent"              // 防火墙事件
 	MessageTypeIPAddrUp                   MessageType = "IPAddrUp"                   // IP地址上线
 	MessageTypeIPAddrDown                 MessageType = "IPAddrDown"                 // IP地址下线
+	MessageTypeAccessLogExportSuccess     MessageType = "AccessLogExportSuccess"     // 访问日志导出成功
+	MessageTypeAccessLogExportFailed      MessageType = "AccessLogExportFailed"      // 访问日志导出失败
 
 	MessageTypeNSNodeInactive MessageType = "NSNodeInactive" // NS节点不活跃
 	MessageTypeNSNodeActive   MessageType = "NSNodeActive"   // NS节点活跃
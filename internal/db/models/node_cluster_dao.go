@@ -407,6 +407,22 @@ func (this *NodeClusterDAO) FindClusterGrantId(tx *dbs.Tx, clusterId int64) (int
 		FindInt64Col(0)
 }
 
+// UpdateClusterPackageVersionRange 设置集群允许安装的版本范围
+func (this *NodeClusterDAO) UpdateClusterPackageVersionRange(tx *dbs.Tx, clusterId int64, versionRange string) error {
+	return this.Query(tx).
+		Pk(clusterId).
+		Set("packageVersionRange", versionRange).
+		UpdateQuickly()
+}
+
+// FindClusterPackageVersionRange 查找集群允许安装的版本范围
+func (this *NodeClusterDAO) FindClusterPackageVersionRange(tx *dbs.Tx, clusterId int64) (string, error) {
+	return this.Query(tx).
+		Pk(clusterId).
+		Result("packageVersionRange").
+		FindStringCol("")
+}
+
 // FindClusterDNSInfo 查找DNS信息
 func (this *NodeClusterDAO) FindClusterDNSInfo(tx *dbs.Tx, clusterId int64, cacheMap *utils.CacheMap) (*NodeCluster, error) {
 	var cacheKey = this.Table + ":FindClusterDNSInfo:" + types.String(clusterId)
@@ -27,6 +27,7 @@ type NodeCluster struct {
 	AccessLog            string `field:"accessLog"`            // 访问日志设置
 	SystemServices       string `field:"systemServices"`       // 系统服务设置
 	TimeZone             string `field:"timeZone"`             // 时区
+	PackageVersionRange  string `field:"packageVersionRange"`  // 允许安装的版本范围
 }
 
 type NodeClusterOperator struct {
@@ -55,6 +56,7 @@ type NodeClusterOperator struct {
 	AccessLog            interface{} // 访问日志设置
 	SystemServices       interface{} // 系统服务设置
 	TimeZone             interface{} // 时区
+	PackageVersionRange  interface{} // 允许安装的版本范围
 }
 
 func NewNodeClusterOperator() *NodeClusterOperator {
@@ -21,6 +21,7 @@ import (
 	"github.com/iwind/TeaGo/types"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -28,7 +29,12 @@ const (
 	NodeStateDisabled = 0 // 已禁用
 )
 
-var nodeIdCacheMap = map[string]int64{} // uniqueId => nodeId
+type nodeIdCacheItem struct {
+	nodeId    int64
+	expiresAt int64
+}
+
+var nodeIdCacheMap = map[string]*nodeIdCacheItem{} // uniqueId => item，缓存时间和 ApiTokenCacheSeconds 一致
 
 type NodeDAO dbs.DAO
 
@@ -934,12 +940,13 @@ func (this *NodeDAO) FindEnabledNodeIdWithUniqueId(tx *dbs.Tx, uniqueId string)
 }
 
 // FindEnabledNodeIdWithUniqueIdCacheable 根据UniqueId获取ID，并可以使用缓存
+// 节点在其他API节点上被删除后，缓存最多在 ApiTokenCacheSeconds 之后失效
 func (this *NodeDAO) FindEnabledNodeIdWithUniqueIdCacheable(tx *dbs.Tx, uniqueId string) (int64, error) {
 	SharedCacheLocker.RLock()
-	nodeId, ok := nodeIdCacheMap[uniqueId]
-	if ok {
+	item, ok := nodeIdCacheMap[uniqueId]
+	if ok && item.expiresAt > time.Now().Unix() {
 		SharedCacheLocker.RUnlock()
-		return nodeId, nil
+		return item.nodeId, nil
 	}
 	SharedCacheLocker.RUnlock()
 	nodeId, err := this.Query(tx).
@@ -950,11 +957,16 @@ func (this *NodeDAO) FindEnabledNodeIdWithUniqueIdCacheable(tx *dbs.Tx, uniqueId
 	if err != nil {
 		return 0, err
 	}
+	SharedCacheLocker.Lock()
 	if nodeId > 0 {
-		SharedCacheLocker.Lock()
-		nodeIdCacheMap[uniqueId] = nodeId
-		SharedCacheLocker.Unlock()
+		nodeIdCacheMap[uniqueId] = &nodeIdCacheItem{
+			nodeId:    nodeId,
+			expiresAt: time.Now().Unix() + ApiTokenCacheSeconds,
+		}
+	} else {
+		delete(nodeIdCacheMap, uniqueId)
 	}
+	SharedCacheLocker.Unlock()
 	return nodeId, nil
 }
 
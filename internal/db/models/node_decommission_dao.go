@@ -0,0 +1,184 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/1uLang/EdgeCommon/pkg/nodeconfigs"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	"time"
+)
+
+const (
+	NodeDecommissionStateEnabled  = 1 // 已启用
+	NodeDecommissionStateDisabled = 0 // 已禁用
+
+	NodeDecommissionStatusRunning  = "running"  // 执行中
+	NodeDecommissionStatusFinished = "finished" // 已下线
+	NodeDecommissionStatusFailed   = "failed"   // 下线失败，节点仍然在线
+
+	NodeDecommissionStepStatusOk      = "ok"      // 成功
+	NodeDecommissionStepStatusFailed  = "failed"  // 失败
+	NodeDecommissionStepStatusSkipped = "skipped" // 跳过
+)
+
+type NodeDecommissionDAO dbs.DAO
+
+func NewNodeDecommissionDAO() *NodeDecommissionDAO {
+	return dbs.NewDAO(&NodeDecommissionDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeNodeDecommissions",
+			Model:  new(NodeDecommission),
+			PkName: "id",
+		},
+	}).(*NodeDecommissionDAO)
+}
+
+var SharedNodeDecommissionDAO *NodeDecommissionDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedNodeDecommissionDAO = NewNodeDecommissionDAO()
+	})
+}
+
+// FindEnabledNodeDecommission 查找下线记录
+func (this *NodeDecommissionDAO) FindEnabledNodeDecommission(tx *dbs.Tx, decommissionId int64) (*NodeDecommission, error) {
+	result, err := this.Query(tx).
+		Pk(decommissionId).
+		State(NodeDecommissionStateEnabled).
+		Find()
+	if result == nil {
+		return nil, err
+	}
+	return result.(*NodeDecommission), err
+}
+
+// CreateDecommission 创建下线记录
+func (this *NodeDecommissionDAO) CreateDecommission(tx *dbs.Tx, role nodeconfigs.NodeRole, nodeId int64, nodeName string, adminId int64, isForced bool) (int64, error) {
+	op := NewNodeDecommissionOperator()
+	op.Role = role
+	op.NodeId = nodeId
+	op.NodeName = nodeName
+	op.AdminId = adminId
+	op.IsForced = isForced
+	op.Status = NodeDecommissionStatusRunning
+	op.Steps = "[]"
+	op.State = NodeDecommissionStateEnabled
+	err := this.Save(tx, op)
+	if err != nil {
+		return 0, err
+	}
+	return types.Int64(op.Id), nil
+}
+
+// CreateDecommissionIfNotRunning 节点没有正在下线时创建下线记录，正在下线时返回0
+// 使用锁保证检查和创建不会被同时执行，防止同一个节点被重复下线
+func (this *NodeDecommissionDAO) CreateDecommissionIfNotRunning(tx *dbs.Tx, role nodeconfigs.NodeRole, nodeId int64, nodeName string, adminId int64, isForced bool) (int64, error) {
+	var lockerKey = "nodeDecommission:" + role + ":" + types.String(nodeId)
+	ok, err := SharedSysLockerDAO.Lock(tx, lockerKey, 30)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		// 其他请求正在创建
+		return 0, nil
+	}
+	defer func() {
+		_ = SharedSysLockerDAO.Unlock(tx, lockerKey)
+	}()
+
+	isRunning, err := this.ExistRunningDecommission(tx, role, nodeId)
+	if err != nil {
+		return 0, err
+	}
+	if isRunning {
+		return 0, nil
+	}
+	return this.CreateDecommission(tx, role, nodeId, nodeName, adminId, isForced)
+}
+
+// ExistRunningDecommission 检查节点是否正在下线
+func (this *NodeDecommissionDAO) ExistRunningDecommission(tx *dbs.Tx, role nodeconfigs.NodeRole, nodeId int64) (bool, error) {
+	return this.Query(tx).
+		Attr("role", role).
+		Attr("nodeId", nodeId).
+		Attr("status", NodeDecommissionStatusRunning).
+		State(NodeDecommissionStateEnabled).
+		Exist()
+}
+
+// AddSteps 添加执行步骤
+func (this *NodeDecommissionDAO) AddSteps(tx *dbs.Tx, decommissionId int64, steps []*NodeDecommissionStep) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	decommission, err := this.FindEnabledNodeDecommission(tx, decommissionId)
+	if err != nil {
+		return err
+	}
+	if decommission == nil {
+		return nil
+	}
+	stepsJSON, err := json.Marshal(append(decommission.DecodeSteps(), steps...))
+	if err != nil {
+		return err
+	}
+	_, err = this.Query(tx).
+		Pk(decommissionId).
+		Set("steps", stepsJSON).
+		Update()
+	return err
+}
+
+// FinishDecommission 结束下线
+func (this *NodeDecommissionDAO) FinishDecommission(tx *dbs.Tx, decommissionId int64, isOk bool, errString string) error {
+	var status = NodeDecommissionStatusFinished
+	if !isOk {
+		status = NodeDecommissionStatusFailed
+	}
+	if len(errString) > 1024 {
+		errString = errString[:1024]
+	}
+	_, err := this.Query(tx).
+		Pk(decommissionId).
+		Set("status", status).
+		Set("error", errString).
+		Set("finishedAt", time.Now().Unix()).
+		Update()
+	return err
+}
+
+// CountAllEnabledDecommissions 计算下线记录数量
+func (this *NodeDecommissionDAO) CountAllEnabledDecommissions(tx *dbs.Tx, role nodeconfigs.NodeRole, nodeId int64) (int64, error) {
+	var query = this.Query(tx).
+		State(NodeDecommissionStateEnabled)
+	if len(role) > 0 {
+		query.Attr("role", role)
+	}
+	if nodeId > 0 {
+		query.Attr("nodeId", nodeId)
+	}
+	return query.Count()
+}
+
+// ListEnabledDecommissions 列出单页下线记录
+func (this *NodeDecommissionDAO) ListEnabledDecommissions(tx *dbs.Tx, role nodeconfigs.NodeRole, nodeId int64, offset int64, size int64) (result []*NodeDecommission, err error) {
+	var query = this.Query(tx).
+		State(NodeDecommissionStateEnabled)
+	if len(role) > 0 {
+		query.Attr("role", role)
+	}
+	if nodeId > 0 {
+		query.Attr("nodeId", nodeId)
+	}
+	_, err = query.
+		Offset(offset).
+		Limit(size).
+		DescPk().
+		Slice(&result).
+		FindAll()
+	return
+}
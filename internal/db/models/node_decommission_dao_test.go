@@ -0,0 +1,80 @@
+package models
+
+import (
+	"github.com/1uLang/EdgeCommon/pkg/nodeconfigs"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/dbs"
+	"sync"
+	"testing"
+)
+
+func TestNodeDecommissionDAO_CreateDecommission(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	decommissionId, err := SharedNodeDecommissionDAO.CreateDecommission(tx, nodeconfigs.NodeRoleNode, 1, "test", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SharedNodeDecommissionDAO.AddSteps(tx, decommissionId, []*NodeDecommissionStep{
+		{Code: "login", Status: NodeDecommissionStepStatusOk},
+		{Code: "stop", Status: NodeDecommissionStepStatusSkipped},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SharedNodeDecommissionDAO.FinishDecommission(tx, decommissionId, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decommission, err := SharedNodeDecommissionDAO.FindEnabledNodeDecommission(tx, decommissionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decommission.Status != NodeDecommissionStatusFinished {
+		t.Fatal("invalid status:", decommission.Status)
+	}
+	if len(decommission.DecodeSteps()) != 2 {
+		t.Fatal("invalid steps:", decommission.Steps)
+	}
+}
+
+func TestNodeDecommissionDAO_CreateDecommissionIfNotRunning(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	var nodeId int64 = 1000000
+
+	// 同时下线只有一个能成功
+	var count = 10
+	var ids = make(chan int64, count)
+	var wg = sync.WaitGroup{}
+	wg.Add(count)
+	for i := 0; i < count; i++ {
+		go func() {
+			defer wg.Done()
+			decommissionId, err := SharedNodeDecommissionDAO.CreateDecommissionIfNotRunning(tx, nodeconfigs.NodeRoleNode, nodeId, "test", 1, false)
+			if err != nil {
+				t.Log("err:", err)
+				return
+			}
+			ids <- decommissionId
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	var createdIds = []int64{}
+	for decommissionId := range ids {
+		if decommissionId > 0 {
+			createdIds = append(createdIds, decommissionId)
+		}
+	}
+	for _, decommissionId := range createdIds {
+		_, _ = SharedNodeDecommissionDAO.Query(tx).Pk(decommissionId).Delete()
+	}
+	if len(createdIds) != 1 {
+		t.Fatal("expected only one decommission, but got:", createdIds)
+	}
+}
@@ -0,0 +1,36 @@
+package models
+
+// NodeDecommission 节点下线记录
+type NodeDecommission struct {
+	Id         uint32 `field:"id"`         // ID
+	Role       string `field:"role"`       // 节点角色
+	NodeId     uint32 `field:"nodeId"`     // 节点ID
+	NodeName   string `field:"nodeName"`   // 节点名称
+	AdminId    uint32 `field:"adminId"`    // 管理员ID
+	IsForced   uint8  `field:"isForced"`   // 是否强制下线（远程卸载失败时仍然下线）
+	Status     string `field:"status"`     // 状态
+	Steps      string `field:"steps"`      // 执行步骤
+	Error      string `field:"error"`      // 错误信息
+	CreatedAt  uint64 `field:"createdAt"`  // 创建时间
+	FinishedAt uint64 `field:"finishedAt"` // 结束时间
+	State      uint8  `field:"state"`      // 状态
+}
+
+type NodeDecommissionOperator struct {
+	Id         interface{} // ID
+	Role       interface{} // 节点角色
+	NodeId     interface{} // 节点ID
+	NodeName   interface{} // 节点名称
+	AdminId    interface{} // 管理员ID
+	IsForced   interface{} // 是否强制下线（远程卸载失败时仍然下线）
+	Status     interface{} // 状态
+	Steps      interface{} // 执行步骤
+	Error      interface{} // 错误信息
+	CreatedAt  interface{} // 创建时间
+	FinishedAt interface{} // 结束时间
+	State      interface{} // 状态
+}
+
+func NewNodeDecommissionOperator() *NodeDecommissionOperator {
+	return &NodeDecommissionOperator{}
+}
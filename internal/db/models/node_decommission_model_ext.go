@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/iwind/TeaGo/logs"
+)
+
+// NodeDecommissionStep 节点下线步骤
+type NodeDecommissionStep struct {
+	Code      string `json:"code"`      // 步骤代号：login, stop, removeService, removeFiles, revokeToken, disable, dns
+	Status    string `json:"status"`    // 结果：ok, failed, skipped
+	Message   string `json:"message"`   // 说明
+	CreatedAt int64  `json:"createdAt"` // 执行时间
+}
+
+// DecodeSteps 解析执行步骤
+func (this *NodeDecommission) DecodeSteps() []*NodeDecommissionStep {
+	var result = []*NodeDecommissionStep{}
+	if len(this.Steps) == 0 || this.Steps == "null" {
+		return result
+	}
+	err := json.Unmarshal([]byte(this.Steps), &result)
+	if err != nil {
+		logs.Println("NodeDecommission.DecodeSteps(): " + err.Error())
+	}
+	return result
+}
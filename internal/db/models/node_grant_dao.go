@@ -2,6 +2,7 @@ package models
 
 import (
 	"errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/secrets"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
@@ -60,7 +61,12 @@ func (this *NodeGrantDAO) FindEnabledNodeGrant(tx *dbs.Tx, id int64) (*NodeGrant
 	if result == nil {
 		return nil, err
 	}
-	return result.(*NodeGrant), err
+	var grant = result.(*NodeGrant)
+	err = this.decodeSecrets(grant)
+	if err != nil {
+		return nil, err
+	}
+	return grant, nil
 }
 
 // FindNodeGrantName 根据主键查找名称
@@ -74,6 +80,11 @@ func (this *NodeGrantDAO) FindNodeGrantName(tx *dbs.Tx, id uint32) (string, erro
 
 // CreateGrant 创建认证信息
 func (this *NodeGrantDAO) CreateGrant(tx *dbs.Tx, adminId int64, name string, method string, username string, password string, privateKey string, passphrase string, description string, nodeId int64) (grantId int64, err error) {
+	err = secrets.EncryptStrings(&password, &privateKey, &passphrase)
+	if err != nil {
+		return 0, err
+	}
+
 	op := NewNodeGrantOperator()
 	op.AdminId = adminId
 	op.Name = name
@@ -102,6 +113,11 @@ func (this *NodeGrantDAO) UpdateGrant(tx *dbs.Tx, grantId int64, name string, me
 		return errors.New("invalid grantId")
 	}
 
+	err := secrets.EncryptStrings(&password, &privateKey, &passphrase)
+	if err != nil {
+		return err
+	}
+
 	op := NewNodeGrantOperator()
 	op.Id = grantId
 	op.Name = name
@@ -119,7 +135,7 @@ func (this *NodeGrantDAO) UpdateGrant(tx *dbs.Tx, grantId int64, name string, me
 	}
 	op.Description = description
 	op.NodeId = nodeId
-	err := this.Save(tx, op)
+	err = this.Save(tx, op)
 	return err
 }
 
@@ -148,6 +164,15 @@ func (this *NodeGrantDAO) ListEnabledGrants(tx *dbs.Tx, keyword string, offset i
 		DescPk().
 		Slice(&result).
 		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range result {
+		err = this.decodeSecrets(grant)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return
 }
 
@@ -158,5 +183,63 @@ func (this *NodeGrantDAO) FindAllEnabledGrants(tx *dbs.Tx) (result []*NodeGrant,
 		DescPk().
 		Slice(&result).
 		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range result {
+		err = this.decodeSecrets(grant)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// ReencryptSecrets 使用当前主密钥重新加密所有认证信息中的密码和私钥，返回修改的数量
+func (this *NodeGrantDAO) ReencryptSecrets(tx *dbs.Tx) (count int64, err error) {
+	ones, err := this.Query(tx).
+		Result("id", "password", "privateKey", "passphrase").
+		AscPk().
+		FindAll()
+	if err != nil {
+		return 0, err
+	}
+	for _, one := range ones {
+		var grant = one.(*NodeGrant)
+		for field, value := range map[string]string{
+			"password":   grant.Password,
+			"privateKey": grant.PrivateKey,
+			"passphrase": grant.Passphrase,
+		} {
+			newValue, changed, err := secrets.ReencryptString(value)
+			if err != nil {
+				return count, errors.New("re-encrypt grant '" + types.String(grant.Id) + "' field '" + field + "' failed: " + err.Error())
+			}
+			if !changed {
+				continue
+			}
+			// 只有在数据没有被修改时才更新
+			rowsAffected, err := this.Query(tx).
+				Pk(grant.Id).
+				Attr(field, value).
+				Set(field, newValue).
+				Update()
+			if err != nil {
+				return count, err
+			}
+			if rowsAffected > 0 {
+				count++
+			}
+		}
+	}
 	return
 }
+
+// 解密密码和私钥
+func (this *NodeGrantDAO) decodeSecrets(grant *NodeGrant) error {
+	err := secrets.DecryptStrings(&grant.Password, &grant.PrivateKey, &grant.Passphrase)
+	if err != nil {
+		return errors.New("decrypt grant '" + types.String(grant.Id) + "' failed: " + err.Error())
+	}
+	return nil
+}
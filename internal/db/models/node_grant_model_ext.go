@@ -1 +1,19 @@
 package models
+
+import "github.com/iwind/TeaGo/maps"
+
+// AuditMap 用于审计日志的数据，隐藏密码和私钥等敏感信息
+func (this *NodeGrant) AuditMap() maps.Map {
+	return maps.Map{
+		"id":            this.Id,
+		"name":          this.Name,
+		"method":        this.Method,
+		"username":      this.Username,
+		"hasPassword":   len(this.Password) > 0,
+		"hasPrivateKey": len(this.PrivateKey) > 0,
+		"hasPassphrase": len(this.Passphrase) > 0,
+		"su":            this.Su,
+		"description":   this.Description,
+		"nodeId":        this.NodeId,
+	}
+}
@@ -0,0 +1,355 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	"time"
+)
+
+const (
+	NodeInstallJobStateEnabled  = 1 // 已启用
+	NodeInstallJobStateDisabled = 0 // 已禁用
+
+	NodeInstallJobStatusPending   = "pending"   // 等待执行
+	NodeInstallJobStatusRunning   = "running"   // 执行中
+	NodeInstallJobStatusPaused    = "paused"    // 已暂停
+	NodeInstallJobStatusFinished  = "finished"  // 已完成
+	NodeInstallJobStatusCancelled = "cancelled" // 已取消
+	NodeInstallJobStatusFailed    = "failed"    // 执行出错
+
+	NodeInstallJobNodeStatusPending = "pending" // 等待安装
+	NodeInstallJobNodeStatusRunning = "running" // 安装中
+	NodeInstallJobNodeStatusOk      = "ok"      // 安装成功
+	NodeInstallJobNodeStatusFailed  = "failed"  // 安装失败
+)
+
+type NodeInstallJobDAO dbs.DAO
+
+func NewNodeInstallJobDAO() *NodeInstallJobDAO {
+	return dbs.NewDAO(&NodeInstallJobDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeNodeInstallJobs",
+			Model:  new(NodeInstallJob),
+			PkName: "id",
+		},
+	}).(*NodeInstallJobDAO)
+}
+
+var SharedNodeInstallJobDAO *NodeInstallJobDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedNodeInstallJobDAO = NewNodeInstallJobDAO()
+	})
+}
+
+// DisableNodeInstallJob 禁用条目
+func (this *NodeInstallJobDAO) DisableNodeInstallJob(tx *dbs.Tx, jobId int64) error {
+	_, err := this.Query(tx).
+		Pk(jobId).
+		Set("state", NodeInstallJobStateDisabled).
+		Update()
+	return err
+}
+
+// FindEnabledNodeInstallJob 查找启用中的任务
+func (this *NodeInstallJobDAO) FindEnabledNodeInstallJob(tx *dbs.Tx, jobId int64) (*NodeInstallJob, error) {
+	result, err := this.Query(tx).
+		Pk(jobId).
+		State(NodeInstallJobStateEnabled).
+		Find()
+	if result == nil {
+		return nil, err
+	}
+	return result.(*NodeInstallJob), err
+}
+
+// CreateJob 创建批量安装任务
+// 节点按顺序分批：有灰度节点时前canarySize个节点为第1批，其余节点每concurrency个为一批
+func (this *NodeInstallJobDAO) CreateJob(tx *dbs.Tx, adminId int64, clusterId int64, nodeIds []int64, isUpgrading bool, concurrency int, canarySize int, maxFailures int, healthCheck bool) (int64, error) {
+	if len(nodeIds) == 0 {
+		return 0, errors.New("'nodeIds' should not be empty")
+	}
+
+	// 去除重复的节点，以免灰度节点数量超过实际节点数量
+	var uniqueNodeIds = []int64{}
+	var nodeIdMap = map[int64]bool{}
+	for _, nodeId := range nodeIds {
+		if nodeIdMap[nodeId] {
+			continue
+		}
+		nodeIdMap[nodeId] = true
+		uniqueNodeIds = append(uniqueNodeIds, nodeId)
+	}
+
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if canarySize < 0 {
+		canarySize = 0
+	}
+	if canarySize > len(uniqueNodeIds) {
+		canarySize = len(uniqueNodeIds)
+	}
+	if maxFailures < 0 {
+		maxFailures = 0
+	}
+
+	var jobNodes = []*NodeInstallJobNode{}
+	for _, nodeId := range uniqueNodeIds {
+		nodeClusterId, err := SharedNodeDAO.FindNodeClusterId(tx, nodeId)
+		if err != nil {
+			return 0, err
+		}
+		if nodeClusterId == 0 {
+			return 0, errors.New("can not find node '" + types.String(nodeId) + "'")
+		}
+
+		var wave int
+		var index = len(jobNodes)
+		if index < canarySize {
+			wave = 1
+		} else {
+			wave = (index-canarySize)/concurrency + 1
+			if canarySize > 0 {
+				wave++
+			}
+		}
+		jobNodes = append(jobNodes, &NodeInstallJobNode{
+			NodeId:    nodeId,
+			ClusterId: nodeClusterId,
+			Wave:      wave,
+			Status:    NodeInstallJobNodeStatusPending,
+		})
+	}
+	jobNodesJSON, err := json.Marshal(jobNodes)
+	if err != nil {
+		return 0, err
+	}
+
+	var op = NewNodeInstallJobOperator()
+	op.AdminId = adminId
+	op.ClusterId = clusterId
+	op.IsUpgrading = isUpgrading
+	op.Concurrency = concurrency
+	op.CanarySize = canarySize
+	op.MaxFailures = maxFailures
+	op.HealthCheck = healthCheck
+	op.Status = NodeInstallJobStatusPending
+	op.Nodes = jobNodesJSON
+	op.CountNodes = len(jobNodes)
+	op.UpdatedAt = time.Now().Unix()
+	op.State = NodeInstallJobStateEnabled
+	err = this.Save(tx, op)
+	if err != nil {
+		return 0, err
+	}
+	return types.Int64(op.Id), nil
+}
+
+// CountAllEnabledJobs 计算任务数量
+func (this *NodeInstallJobDAO) CountAllEnabledJobs(tx *dbs.Tx, clusterId int64) (int64, error) {
+	var query = this.Query(tx).
+		State(NodeInstallJobStateEnabled)
+	if clusterId > 0 {
+		query.Attr("clusterId", clusterId)
+	}
+	return query.Count()
+}
+
+// ListEnabledJobs 列出单页任务
+func (this *NodeInstallJobDAO) ListEnabledJobs(tx *dbs.Tx, clusterId int64, offset int64, size int64) (result []*NodeInstallJob, err error) {
+	var query = this.Query(tx).
+		State(NodeInstallJobStateEnabled)
+	if clusterId > 0 {
+		query.Attr("clusterId", clusterId)
+	}
+	_, err = query.
+		Offset(offset).
+		Limit(size).
+		DescPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// FindNextJob 查找下一个需要执行的任务
+// 执行中的任务可能是由于上一个执行者退出而中断的，需要继续执行
+func (this *NodeInstallJobDAO) FindNextJob(tx *dbs.Tx) (*NodeInstallJob, error) {
+	one, err := this.Query(tx).
+		State(NodeInstallJobStateEnabled).
+		Where("status IN (:statusRunning, :statusPending)").
+		Param("statusRunning", NodeInstallJobStatusRunning).
+		Param("statusPending", NodeInstallJobStatusPending).
+		AscPk().
+		Find()
+	if one == nil {
+		return nil, err
+	}
+	return one.(*NodeInstallJob), err
+}
+
+// FindJobStatus 查找任务状态
+func (this *NodeInstallJobDAO) FindJobStatus(tx *dbs.Tx, jobId int64) (string, error) {
+	return this.Query(tx).
+		Pk(jobId).
+		Result("status").
+		FindStringCol("")
+}
+
+// ClaimJob 使用Leader的防护令牌开始或者接管任务
+// 令牌比任务中记录的令牌小时说明已经有新的Leader接管，返回false；接管之后旧Leader的修改都会失败
+func (this *NodeInstallJobDAO) ClaimJob(tx *dbs.Tx, jobId int64, leaderToken int64) (bool, error) {
+	if leaderToken <= 0 {
+		return false, errors.New("invalid leader token")
+	}
+	var now = time.Now().Unix()
+	_, err := this.Query(tx).
+		Pk(jobId).
+		State(NodeInstallJobStateEnabled).
+		Where("status IN (:statusPending, :statusRunning)").
+		Param("statusPending", NodeInstallJobStatusPending).
+		Param("statusRunning", NodeInstallJobStatusRunning).
+		Where("leaderToken<=:leaderToken").
+		Param("leaderToken", leaderToken).
+		Set("status", NodeInstallJobStatusRunning).
+		Set("leaderToken", leaderToken).
+		Set("startedAt", dbs.SQL("IF(startedAt=0, "+types.String(now)+", startedAt)")).
+		Set("updatedAt", now).
+		Update()
+	if err != nil {
+		return false, err
+	}
+
+	// 同一秒内重复接管时数据没有变化，影响的行数为0，所以需要再次检查
+	return this.Query(tx).
+		Pk(jobId).
+		State(NodeInstallJobStateEnabled).
+		Attr("status", NodeInstallJobStatusRunning).
+		Attr("leaderToken", leaderToken).
+		Exist()
+}
+
+// UpdateJobProgress 保存节点进度
+// 任务已经被其他Leader接管时返回false
+func (this *NodeInstallJobDAO) UpdateJobProgress(tx *dbs.Tx, jobId int64, leaderToken int64, jobNodes []*NodeInstallJobNode, currentWave int) (bool, error) {
+	var countFinished = 0
+	var countFailed = 0
+	for _, jobNode := range jobNodes {
+		if jobNode.IsDone() {
+			countFinished++
+		}
+		if jobNode.Status == NodeInstallJobNodeStatusFailed {
+			countFailed++
+		}
+	}
+	jobNodesJSON, err := json.Marshal(jobNodes)
+	if err != nil {
+		return false, err
+	}
+	rows, err := this.Query(tx).
+		Pk(jobId).
+		Attr("leaderToken", leaderToken).
+		Set("nodes", jobNodesJSON).
+		Set("countFinished", countFinished).
+		Set("countFailed", countFailed).
+		Set("currentWave", currentWave).
+		Set("updatedAt", time.Now().Unix()).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	if rows > 0 {
+		return true, nil
+	}
+	return this.CheckJobLeader(tx, jobId, leaderToken)
+}
+
+// CheckJobLeader 检查任务是否仍然由持有此令牌的Leader执行
+func (this *NodeInstallJobDAO) CheckJobLeader(tx *dbs.Tx, jobId int64, leaderToken int64) (bool, error) {
+	return this.Query(tx).
+		Pk(jobId).
+		Attr("leaderToken", leaderToken).
+		Exist()
+}
+
+// FinishJob 任务执行结束
+// 任务已经被其他Leader接管时不做任何修改
+func (this *NodeInstallJobDAO) FinishJob(tx *dbs.Tx, jobId int64, leaderToken int64, errString string) error {
+	var status = NodeInstallJobStatusFinished
+	if len(errString) > 0 {
+		status = NodeInstallJobStatusFailed
+	}
+	_, err := this.updateStatus(tx, jobId, leaderToken, []string{NodeInstallJobStatusRunning}, status, errString)
+	return err
+}
+
+// PauseJobWithLeader 由执行任务的Leader暂停任务
+func (this *NodeInstallJobDAO) PauseJobWithLeader(tx *dbs.Tx, jobId int64, leaderToken int64, reason string) (bool, error) {
+	return this.updateStatus(tx, jobId, leaderToken, []string{NodeInstallJobStatusRunning}, NodeInstallJobStatusPaused, reason)
+}
+
+// PauseJob 暂停任务，正在安装的节点会继续完成
+func (this *NodeInstallJobDAO) PauseJob(tx *dbs.Tx, jobId int64, reason string) (bool, error) {
+	return this.updateStatus(tx, jobId, 0, []string{NodeInstallJobStatusPending, NodeInstallJobStatusRunning}, NodeInstallJobStatusPaused, reason)
+}
+
+// ResumeJob 恢复暂停的任务，之前失败的节点不再计入暂停阈值
+func (this *NodeInstallJobDAO) ResumeJob(tx *dbs.Tx, jobId int64) (bool, error) {
+	ok, err := this.updateStatus(tx, jobId, 0, []string{NodeInstallJobStatusPaused}, NodeInstallJobStatusPending, "")
+	if err != nil || !ok {
+		return ok, err
+	}
+	_, err = this.Query(tx).
+		Pk(jobId).
+		Set("countIgnoredFailures", dbs.SQL("countFailed")).
+		Update()
+	return true, err
+}
+
+// CancelJob 取消任务，正在安装的节点会继续完成
+func (this *NodeInstallJobDAO) CancelJob(tx *dbs.Tx, jobId int64) (bool, error) {
+	return this.updateStatus(tx, jobId, 0, []string{NodeInstallJobStatusPending, NodeInstallJobStatusRunning, NodeInstallJobStatusPaused}, NodeInstallJobStatusCancelled, "")
+}
+
+// 在当前状态为fromStatusList之一时修改状态
+// leaderToken大于0时只有持有此令牌的Leader才能修改
+func (this *NodeInstallJobDAO) updateStatus(tx *dbs.Tx, jobId int64, leaderToken int64, fromStatusList []string, status string, errString string) (bool, error) {
+	var query = this.Query(tx).
+		Pk(jobId).
+		State(NodeInstallJobStateEnabled).
+		Where("status IN (" + this.placeholders(len(fromStatusList)) + ")")
+	for index, fromStatus := range fromStatusList {
+		query.Param("status"+types.String(index), fromStatus)
+	}
+	if leaderToken > 0 {
+		query.Attr("leaderToken", leaderToken)
+	}
+	query.Set("status", status).
+		Set("error", errString).
+		Set("updatedAt", time.Now().Unix())
+	if status == NodeInstallJobStatusFinished || status == NodeInstallJobStatusFailed || status == NodeInstallJobStatusCancelled {
+		query.Set("finishedAt", time.Now().Unix())
+	}
+	rows, err := query.Update()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func (this *NodeInstallJobDAO) placeholders(count int) string {
+	var result = ""
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			result += ", "
+		}
+		result += ":status" + types.String(i)
+	}
+	return result
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/dbs"
+	"testing"
+)
+
+func TestNodeInstallJob_CountWaves(t *testing.T) {
+	for _, c := range []struct {
+		countNodes  uint32
+		canarySize  uint32
+		concurrency uint32
+		countWaves  int
+	}{
+		{0, 1, 5, 0},
+		{1, 1, 5, 1},
+		{10, 0, 5, 2},
+		{10, 1, 5, 3},
+		{11, 1, 5, 3},
+		{12, 1, 5, 4},
+		{3, 3, 1, 1},
+	} {
+		var job = &NodeInstallJob{
+			CountNodes:  c.countNodes,
+			CanarySize:  c.canarySize,
+			Concurrency: c.concurrency,
+		}
+		if job.CountWaves() != c.countWaves {
+			t.Fatal("nodes:", c.countNodes, "canary:", c.canarySize, "concurrency:", c.concurrency, "expected:", c.countWaves, "actual:", job.CountWaves())
+		}
+	}
+}
+
+func TestNodeInstallJob_IsPausedOnFailures(t *testing.T) {
+	var job = &NodeInstallJob{MaxFailures: 2, CountFailed: 1}
+	if job.IsPausedOnFailures() {
+		t.Fatal("should not pause")
+	}
+	job.CountFailed = 2
+	if !job.IsPausedOnFailures() {
+		t.Fatal("should pause")
+	}
+
+	// 恢复之后
+	job.CountIgnoredFailures = 2
+	if job.IsPausedOnFailures() {
+		t.Fatal("should not pause after resumed")
+	}
+}
+
+func TestNodeInstallJobDAO_CreateJob(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	nodeIds, err := SharedNodeDAO.FindAllEnabledNodeIdsWithClusterId(tx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeIds) == 0 {
+		t.Log("no nodes")
+		return
+	}
+	jobId, err := SharedNodeInstallJobDAO.CreateJob(tx, 0, 1, nodeIds, true, 2, 1, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = SharedNodeInstallJobDAO.DisableNodeInstallJob(tx, jobId)
+	}()
+
+	job, err := SharedNodeInstallJobDAO.FindEnabledNodeInstallJob(tx, jobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobNodes, err := job.DecodeNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, jobNode := range jobNodes {
+		t.Log(jobNode.NodeId, "wave:", jobNode.Wave)
+	}
+
+	ok, err := SharedNodeInstallJobDAO.PauseJob(tx, jobId, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("paused:", ok)
+	ok, err = SharedNodeInstallJobDAO.ResumeJob(tx, jobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("resumed:", ok)
+}
+
+func TestNodeInstallJobDAO_ClaimJob(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	nodeIds, err := SharedNodeDAO.FindAllEnabledNodeIdsWithClusterId(tx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeIds) == 0 {
+		t.Log("no nodes")
+		return
+	}
+
+	// 重复的节点不计入灰度节点数量
+	jobId, err := SharedNodeInstallJobDAO.CreateJob(tx, 0, 1, append(nodeIds, nodeIds[0]), true, 2, len(nodeIds)+1, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = SharedNodeInstallJobDAO.DisableNodeInstallJob(tx, jobId)
+	}()
+	job, err := SharedNodeInstallJobDAO.FindEnabledNodeInstallJob(tx, jobId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(job.CanarySize) != len(nodeIds) || int(job.CountNodes) != len(nodeIds) {
+		t.Fatal("invalid canary size:", job.CanarySize, "count nodes:", job.CountNodes)
+	}
+	jobNodes, err := job.DecodeNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := SharedNodeInstallJobDAO.ClaimJob(tx, jobId, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("should claim the job")
+	}
+
+	// 旧的令牌不能接管和修改任务
+	ok, err = SharedNodeInstallJobDAO.ClaimJob(tx, jobId, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("should not claim the job with an old token")
+	}
+	ok, err = SharedNodeInstallJobDAO.UpdateJobProgress(tx, jobId, 1, jobNodes, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("should not update progress with an old token")
+	}
+	ok, err = SharedNodeInstallJobDAO.UpdateJobProgress(tx, jobId, 2, jobNodes, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("should update progress")
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+// NodeInstallJob 节点批量安装任务
+type NodeInstallJob struct {
+	Id                   uint32 `field:"id"`                   // ID
+	AdminId              uint32 `field:"adminId"`              // 管理员ID
+	ClusterId            uint32 `field:"clusterId"`            // 集群ID
+	IsUpgrading          uint8  `field:"isUpgrading"`          // 是否为升级
+	Concurrency          uint32 `field:"concurrency"`          // 每批并行数量
+	CanarySize           uint32 `field:"canarySize"`           // 灰度节点数量
+	MaxFailures          uint32 `field:"maxFailures"`          // 失败多少个节点后暂停
+	HealthCheck          uint8  `field:"healthCheck"`          // 每批结束后是否执行健康检查
+	Status               string `field:"status"`               // 状态
+	Nodes                string `field:"nodes"`                // 节点进度
+	CountNodes           uint32 `field:"countNodes"`           // 节点数量
+	CountFinished        uint32 `field:"countFinished"`        // 已完成节点数量
+	CountFailed          uint32 `field:"countFailed"`          // 失败节点数量
+	CountIgnoredFailures uint32 `field:"countIgnoredFailures"` // 恢复时忽略的失败数量
+	CurrentWave          uint32 `field:"currentWave"`          // 当前批次
+	LeaderToken          uint64 `field:"leaderToken"`          // 执行者的防护令牌
+	Error                string `field:"error"`                // 错误信息
+	CreatedAt            uint64 `field:"createdAt"`            // 创建时间
+	StartedAt            uint64 `field:"startedAt"`            // 开始时间
+	UpdatedAt            uint64 `field:"updatedAt"`            // 更新时间
+	FinishedAt           uint64 `field:"finishedAt"`           // 结束时间
+	State                uint8  `field:"state"`                // 状态
+}
+
+type NodeInstallJobOperator struct {
+	Id                   interface{} // ID
+	AdminId              interface{} // 管理员ID
+	ClusterId            interface{} // 集群ID
+	IsUpgrading          interface{} // 是否为升级
+	Concurrency          interface{} // 每批并行数量
+	CanarySize           interface{} // 灰度节点数量
+	MaxFailures          interface{} // 失败多少个节点后暂停
+	HealthCheck          interface{} // 每批结束后是否执行健康检查
+	Status               interface{} // 状态
+	Nodes                interface{} // 节点进度
+	CountNodes           interface{} // 节点数量
+	CountFinished        interface{} // 已完成节点数量
+	CountFailed          interface{} // 失败节点数量
+	CountIgnoredFailures interface{} // 恢复时忽略的失败数量
+	CurrentWave          interface{} // 当前批次
+	LeaderToken          interface{} // 执行者的防护令牌
+	Error                interface{} // 错误信息
+	CreatedAt            interface{} // 创建时间
+	StartedAt            interface{} // 开始时间
+	UpdatedAt            interface{} // 更新时间
+	FinishedAt           interface{} // 结束时间
+	State                interface{} // 状态
+}
+
+func NewNodeInstallJobOperator() *NodeInstallJobOperator {
+	return &NodeInstallJobOperator{}
+}
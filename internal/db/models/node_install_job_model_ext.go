@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// NodeInstallJobNode 批量安装任务中单个节点的进度
+type NodeInstallJobNode struct {
+	NodeId     int64  `json:"nodeId"`     // 节点ID
+	ClusterId  int64  `json:"clusterId"`  // 集群ID
+	Wave       int    `json:"wave"`       // 所在批次，从1开始；有灰度节点时第1批为灰度节点
+	Status     string `json:"status"`     // 状态
+	Error      string `json:"error"`      // 错误信息
+	ErrorCode  string `json:"errorCode"`  // 错误代号
+	StartedAt  int64  `json:"startedAt"`  // 开始时间
+	FinishedAt int64  `json:"finishedAt"` // 结束时间
+}
+
+// IsDone 是否已经执行完成
+func (this *NodeInstallJobNode) IsDone() bool {
+	return this.Status == NodeInstallJobNodeStatusOk || this.Status == NodeInstallJobNodeStatusFailed
+}
+
+// DecodeNodes 解析节点进度
+func (this *NodeInstallJob) DecodeNodes() ([]*NodeInstallJobNode, error) {
+	var result = []*NodeInstallJobNode{}
+	if !IsNotNull(this.Nodes) {
+		return result, nil
+	}
+	err := json.Unmarshal([]byte(this.Nodes), &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CountWaves 批次数量
+func (this *NodeInstallJob) CountWaves() int {
+	var countNodes = int(this.CountNodes)
+	var canarySize = int(this.CanarySize)
+	var concurrency = int(this.Concurrency)
+	if countNodes == 0 || concurrency <= 0 {
+		return 0
+	}
+	var countWaves = 0
+	if canarySize > 0 {
+		countWaves++
+		countNodes -= canarySize
+	}
+	if countNodes > 0 {
+		countWaves += (countNodes + concurrency - 1) / concurrency
+	}
+	return countWaves
+}
+
+// IsPausedOnFailures 失败数量是否已经达到暂停阈值
+func (this *NodeInstallJob) IsPausedOnFailures() bool {
+	return this.MaxFailures > 0 && this.CountFailed >= this.CountIgnoredFailures+this.MaxFailures
+}
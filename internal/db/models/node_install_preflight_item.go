@@ -0,0 +1,15 @@
+package models
+
+const (
+	NodeInstallPreflightStatusPass = "pass" // 通过
+	NodeInstallPreflightStatusWarn = "warn" // 警告，不影响安装
+	NodeInstallPreflightStatusFail = "fail" // 失败，无法安装
+)
+
+// NodeInstallPreflightItem 安装前检查项目
+type NodeInstallPreflightItem struct {
+	Code    string `json:"code"`    // 检查项目代号：os, arch, systemd, disk, memory, port, clock
+	Name    string `json:"name"`    // 检查项目名称
+	Status  string `json:"status"`  // 检查结果：pass, warn, fail
+	Message string `json:"message"` // 说明
+}
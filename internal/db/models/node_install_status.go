@@ -9,6 +9,8 @@ type NodeInstallStatus struct {
 	ErrorCode  string                   `json:"errorCode"`  // 错误代号
 	UpdatedAt  int64                    `json:"updatedAt"`  // 更新时间，安装过程中需要每隔N秒钟更新这个状态，以便于让系统知道安装仍在进行中
 	Steps      []*NodeInstallStatusStep `json:"steps"`      // 步骤
+
+	Preflight []*NodeInstallPreflightItem `json:"preflight"` // 安装前检查结果
 }
 
 func NewNodeInstallStatus() *NodeInstallStatus {
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	"time"
+)
+
+const (
+	NodeJoinTokenStateEnabled  = 1 // 已启用
+	NodeJoinTokenStateDisabled = 0 // 已禁用
+
+	NodeJoinTokenDefaultLife = 3600          // 默认有效期
+	NodeJoinTokenMaxLife     = 7 * 24 * 3600 // 最长有效期
+)
+
+type NodeJoinTokenDAO dbs.DAO
+
+func NewNodeJoinTokenDAO() *NodeJoinTokenDAO {
+	return dbs.NewDAO(&NodeJoinTokenDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeNodeJoinTokens",
+			Model:  new(NodeJoinToken),
+			PkName: "id",
+		},
+	}).(*NodeJoinTokenDAO)
+}
+
+var SharedNodeJoinTokenDAO *NodeJoinTokenDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedNodeJoinTokenDAO = NewNodeJoinTokenDAO()
+	})
+}
+
+// DisableNodeJoinToken 吊销令牌
+func (this *NodeJoinTokenDAO) DisableNodeJoinToken(tx *dbs.Tx, tokenId int64) error {
+	_, err := this.Query(tx).
+		Pk(tokenId).
+		Set("state", NodeJoinTokenStateDisabled).
+		Update()
+	return err
+}
+
+// FindEnabledNodeJoinToken 查找令牌
+func (this *NodeJoinTokenDAO) FindEnabledNodeJoinToken(tx *dbs.Tx, tokenId int64) (*NodeJoinToken, error) {
+	result, err := this.Query(tx).
+		Pk(tokenId).
+		State(NodeJoinTokenStateEnabled).
+		Find()
+	if result == nil {
+		return nil, err
+	}
+	return result.(*NodeJoinToken), err
+}
+
+// CreateToken 创建一次性注册令牌
+// 数据库中只保存令牌的SHA256值，令牌明文只在创建时返回一次
+func (this *NodeJoinTokenDAO) CreateToken(tx *dbs.Tx, adminId int64, clusterId int64, groupId int64, regionId int64, name string, lifeSeconds int64) (tokenId int64, token string, err error) {
+	if clusterId <= 0 {
+		return 0, "", errors.New("'clusterId' should not be empty")
+	}
+	if lifeSeconds <= 0 {
+		lifeSeconds = NodeJoinTokenDefaultLife
+	}
+	if lifeSeconds > NodeJoinTokenMaxLife {
+		lifeSeconds = NodeJoinTokenMaxLife
+	}
+
+	var tokenBytes = make([]byte, 24)
+	_, err = rand.Read(tokenBytes)
+	if err != nil {
+		return 0, "", err
+	}
+	token = hex.EncodeToString(tokenBytes)
+
+	op := NewNodeJoinTokenOperator()
+	op.AdminId = adminId
+	op.ClusterId = clusterId
+	op.GroupId = groupId
+	op.RegionId = regionId
+	op.Name = name
+	op.TokenHash = hashNodeJoinToken(token)
+	op.ExpiresAt = time.Now().Unix() + lifeSeconds
+	op.IsUsed = false
+	op.State = NodeJoinTokenStateEnabled
+	err = this.Save(tx, op)
+	if err != nil {
+		return 0, "", err
+	}
+	return types.Int64(op.Id), token, nil
+}
+
+// FindUsableToken 根据令牌明文查找未使用、未过期的令牌
+func (this *NodeJoinTokenDAO) FindUsableToken(tx *dbs.Tx, token string) (*NodeJoinToken, error) {
+	if len(token) == 0 {
+		return nil, nil
+	}
+	one, err := this.Query(tx).
+		Attr("tokenHash", hashNodeJoinToken(token)).
+		Attr("isUsed", false).
+		State(NodeJoinTokenStateEnabled).
+		Where("expiresAt>:now").
+		Param("now", time.Now().Unix()).
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*NodeJoinToken), nil
+}
+
+// ConsumeToken 使用令牌，令牌只能被使用一次
+// 返回false表示令牌已经被其他请求使用，或者在查找之后被吊销、已经过期
+func (this *NodeJoinTokenDAO) ConsumeToken(tx *dbs.Tx, tokenId int64, nodeId int64, ip string) (bool, error) {
+	var now = time.Now().Unix()
+	rowsAffected, err := this.Query(tx).
+		Pk(tokenId).
+		Attr("isUsed", false).
+		State(NodeJoinTokenStateEnabled).
+		Where("expiresAt>:now").
+		Param("now", now).
+		Set("isUsed", true).
+		Set("usedAt", now).
+		Set("usedNodeId", nodeId).
+		Set("usedIP", ip).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// CountAllEnabledTokens 计算令牌数量
+func (this *NodeJoinTokenDAO) CountAllEnabledTokens(tx *dbs.Tx, clusterId int64) (int64, error) {
+	var query = this.Query(tx).
+		State(NodeJoinTokenStateEnabled)
+	if clusterId > 0 {
+		query.Attr("clusterId", clusterId)
+	}
+	return query.Count()
+}
+
+// ListEnabledTokens 列出单页令牌
+func (this *NodeJoinTokenDAO) ListEnabledTokens(tx *dbs.Tx, clusterId int64, offset int64, size int64) (result []*NodeJoinToken, err error) {
+	var query = this.Query(tx).
+		State(NodeJoinTokenStateEnabled)
+	if clusterId > 0 {
+		query.Attr("clusterId", clusterId)
+	}
+	_, err = query.
+		Offset(offset).
+		Limit(size).
+		DescPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// 计算令牌的SHA256值
+func hashNodeJoinToken(token string) string {
+	var sum = sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
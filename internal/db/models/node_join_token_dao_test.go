@@ -0,0 +1,94 @@
+package models
+
+import (
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/dbs"
+	"testing"
+	"time"
+)
+
+func TestNodeJoinTokenDAO_ConsumeToken(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	tokenId, token, err := SharedNodeJoinTokenDAO.CreateToken(tx, 1, 1, 0, 0, "test", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("token:", token)
+
+	one, err := SharedNodeJoinTokenDAO.FindUsableToken(tx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one == nil || int64(one.Id) != tokenId {
+		t.Fatal("should find the token")
+	}
+
+	ok, err := SharedNodeJoinTokenDAO.ConsumeToken(tx, tokenId, 0, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("should consume the token")
+	}
+
+	// 再次使用
+	ok, err = SharedNodeJoinTokenDAO.ConsumeToken(tx, tokenId, 0, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("token should be used only once")
+	}
+	one, err = SharedNodeJoinTokenDAO.FindUsableToken(tx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one != nil {
+		t.Fatal("used token should not be usable")
+	}
+}
+
+func TestNodeJoinTokenDAO_ConsumeToken_Revoked(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	tokenId, _, err := SharedNodeJoinTokenDAO.CreateToken(tx, 1, 1, 0, 0, "test", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 查找之后被吊销
+	err = SharedNodeJoinTokenDAO.DisableNodeJoinToken(tx, tokenId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := SharedNodeJoinTokenDAO.ConsumeToken(tx, tokenId, 0, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("revoked token should not be consumed")
+	}
+
+	// 已经过期
+	tokenId, _, err = SharedNodeJoinTokenDAO.CreateToken(tx, 1, 1, 0, 0, "test", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = SharedNodeJoinTokenDAO.Query(tx).
+		Pk(tokenId).
+		Set("expiresAt", time.Now().Unix()-1).
+		Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err = SharedNodeJoinTokenDAO.ConsumeToken(tx, tokenId, 0, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expired token should not be consumed")
+	}
+}
@@ -0,0 +1,40 @@
+package models
+
+// NodeJoinToken 节点注册令牌
+type NodeJoinToken struct {
+	Id         uint32 `field:"id"`         // ID
+	AdminId    uint32 `field:"adminId"`    // 管理员ID
+	ClusterId  uint32 `field:"clusterId"`  // 集群ID
+	GroupId    uint32 `field:"groupId"`    // 节点分组ID
+	RegionId   uint32 `field:"regionId"`   // 节点区域ID
+	Name       string `field:"name"`       // 名称
+	TokenHash  string `field:"tokenHash"`  // 令牌的SHA256值
+	ExpiresAt  uint64 `field:"expiresAt"`  // 过期时间
+	IsUsed     uint8  `field:"isUsed"`     // 是否已使用
+	UsedAt     uint64 `field:"usedAt"`     // 使用时间
+	UsedNodeId uint32 `field:"usedNodeId"` // 注册的节点ID
+	UsedIP     string `field:"usedIP"`     // 注册时的来源IP
+	CreatedAt  uint64 `field:"createdAt"`  // 创建时间
+	State      uint8  `field:"state"`      // 状态
+}
+
+type NodeJoinTokenOperator struct {
+	Id         interface{} // ID
+	AdminId    interface{} // 管理员ID
+	ClusterId  interface{} // 集群ID
+	GroupId    interface{} // 节点分组ID
+	RegionId   interface{} // 节点区域ID
+	Name       interface{} // 名称
+	TokenHash  interface{} // 令牌的SHA256值
+	ExpiresAt  interface{} // 过期时间
+	IsUsed     interface{} // 是否已使用
+	UsedAt     interface{} // 使用时间
+	UsedNodeId interface{} // 注册的节点ID
+	UsedIP     interface{} // 注册时的来源IP
+	CreatedAt  interface{} // 创建时间
+	State      interface{} // 状态
+}
+
+func NewNodeJoinTokenOperator() *NodeJoinTokenOperator {
+	return &NodeJoinTokenOperator{}
+}
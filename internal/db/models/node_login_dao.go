@@ -1,12 +1,14 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
 	"github.com/1uLang/EdgeCommon/pkg/nodeconfigs"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/types"
+	"time"
 )
 
 const (
@@ -96,12 +98,31 @@ func (this *NodeLoginDAO) UpdateNodeLogin(tx *dbs.Tx, loginId int64, name string
 	if loginId <= 0 {
 		return errors.New("invalid loginId")
 	}
+
+	// 登录地址改变后需要重新信任主机密钥
+	oldLogin, err := this.FindEnabledNodeLogin(tx, loginId)
+	if err != nil {
+		return err
+	}
+
+	if oldLogin != nil {
+		paramsJSON = oldLogin.keepJumpHostKeys(paramsJSON)
+	}
+
 	login := NewNodeLoginOperator()
 	login.Id = loginId
 	login.Name = name
 	login.Type = loginType
 	login.Params = string(paramsJSON)
-	err := this.Save(tx, login)
+	if oldLogin != nil && oldLogin.sshAddr() != (&NodeLogin{Type: loginType, Params: string(paramsJSON)}).sshAddr() {
+		login.HostKeyType = ""
+		login.HostKeyFingerprint = ""
+		login.HostKeyPinnedAt = 0
+		login.PendingHostKeyType = ""
+		login.PendingHostKeyFingerprint = ""
+		login.PendingHostKeyAt = 0
+	}
+	err = this.Save(tx, login)
 	return err
 }
 
@@ -184,3 +205,117 @@ func (this *NodeLoginDAO) FindFrequentGrantIds(tx *dbs.Tx, nodeClusterId int64,
 	}
 	return grantIds, nil
 }
+
+// PinHostKey 首次连接时信任主机密钥，已经信任其他密钥时不做修改
+func (this *NodeLoginDAO) PinHostKey(tx *dbs.Tx, loginId int64, keyType string, fingerprint string) error {
+	_, err := this.Query(tx).
+		Pk(loginId).
+		Where("(hostKeyFingerprint IS NULL OR hostKeyFingerprint='')").
+		Set("hostKeyType", keyType).
+		Set("hostKeyFingerprint", fingerprint).
+		Set("hostKeyPinnedAt", time.Now().Unix()).
+		Update()
+	return err
+}
+
+// UpdatePendingHostKey 记录和信任的密钥不一致的主机密钥，等待管理员确认
+func (this *NodeLoginDAO) UpdatePendingHostKey(tx *dbs.Tx, loginId int64, keyType string, fingerprint string) error {
+	_, err := this.Query(tx).
+		Pk(loginId).
+		Set("pendingHostKeyType", keyType).
+		Set("pendingHostKeyFingerprint", fingerprint).
+		Set("pendingHostKeyAt", time.Now().Unix()).
+		Update()
+	return err
+}
+
+// ApprovePendingHostKey 信任待确认的主机密钥
+// 需要传入待确认的指纹，防止确认之后密钥又发生了变化
+func (this *NodeLoginDAO) ApprovePendingHostKey(tx *dbs.Tx, loginId int64, fingerprint string) error {
+	login, err := this.FindEnabledNodeLogin(tx, loginId)
+	if err != nil {
+		return err
+	}
+	if login == nil {
+		return errors.New("node login not found")
+	}
+	if len(login.PendingHostKeyFingerprint) == 0 || login.PendingHostKeyFingerprint != fingerprint {
+		return errors.New("pending host key fingerprint mismatch")
+	}
+	_, err = this.Query(tx).
+		Pk(loginId).
+		Attr("pendingHostKeyFingerprint", fingerprint).
+		Set("hostKeyType", login.PendingHostKeyType).
+		Set("hostKeyFingerprint", fingerprint).
+		Set("hostKeyPinnedAt", time.Now().Unix()).
+		Set("pendingHostKeyType", "").
+		Set("pendingHostKeyFingerprint", "").
+		Set("pendingHostKeyAt", 0).
+		Update()
+	return err
+}
+
+// PinJumpHostKeys 首次连接时信任跳板机的主机密钥，已经信任其他密钥的跳板机不做修改
+// keys 中的元素依次对应登录参数中的跳板机，每个元素为 [密钥类型, 密钥指纹]
+func (this *NodeLoginDAO) PinJumpHostKeys(tx *dbs.Tx, loginId int64, keys [][2]string) error {
+	login, err := this.FindEnabledNodeLogin(tx, loginId)
+	if err != nil {
+		return err
+	}
+	if login == nil {
+		return errors.New("node login not found")
+	}
+	params, err := login.DecodeSSHParams()
+	if err != nil {
+		return err
+	}
+
+	var changed = false
+	for index, jumpHost := range params.JumpHosts {
+		if jumpHost == nil || index >= len(keys) {
+			continue
+		}
+		if len(jumpHost.HostKeyFingerprint) > 0 || len(keys[index][1]) == 0 {
+			continue
+		}
+		jumpHost.HostKeyType = keys[index][0]
+		jumpHost.HostKeyFingerprint = keys[index][1]
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	// 只有在登录参数没有被修改时才更新，JSON字段需要转换后才能比较
+	rowsAffected, err := this.Query(tx).
+		Pk(loginId).
+		Where("params=CAST(:params AS JSON)").
+		Param("params", login.Params).
+		Set("params", paramsJSON).
+		Update()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errors.New("pin jump host keys failed: node login has been changed, please try again")
+	}
+	return nil
+}
+
+// ResetHostKey 清除信任的主机密钥，下次连接时重新信任
+func (this *NodeLoginDAO) ResetHostKey(tx *dbs.Tx, loginId int64) error {
+	_, err := this.Query(tx).
+		Pk(loginId).
+		Set("hostKeyType", "").
+		Set("hostKeyFingerprint", "").
+		Set("hostKeyPinnedAt", 0).
+		Set("pendingHostKeyType", "").
+		Set("pendingHostKeyFingerprint", "").
+		Set("pendingHostKeyAt", 0).
+		Update()
+	return err
+}
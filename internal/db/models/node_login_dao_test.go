@@ -15,3 +15,81 @@ func TestNodeLoginDAO_FindFrequentPorts(t *testing.T) {
 	}
 	t.Log(ports)
 }
+
+func TestNodeLogin_KeepJumpHostKeys(t *testing.T) {
+	var login = &NodeLogin{
+		Type:   NodeLoginTypeSSH,
+		Params: `{"grantId":1,"host":"192.168.1.100","port":22,"jumpHosts":[{"grantId":2,"host":"10.0.0.1","port":22,"hostKeyType":"ssh-ed25519","hostKeyFingerprint":"SHA256:a"}]}`,
+	}
+
+	// 跳板机未改变
+	{
+		var paramsJSON = login.keepJumpHostKeys([]byte(`{"grantId":1,"host":"192.168.1.101","port":22,"jumpHosts":[{"grantId":3,"host":"10.0.0.1","port":22}]}`))
+		params, err := (&NodeLogin{Type: NodeLoginTypeSSH, Params: string(paramsJSON)}).DecodeSSHParams()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if params.JumpHosts[0].HostKeyFingerprint != "SHA256:a" {
+			t.Fatal("should keep pinned jump host key")
+		}
+	}
+
+	// 跳板机已改变
+	{
+		var paramsJSON = login.keepJumpHostKeys([]byte(`{"grantId":1,"host":"192.168.1.100","port":22,"jumpHosts":[{"grantId":2,"host":"10.0.0.2","port":22}]}`))
+		params, err := (&NodeLogin{Type: NodeLoginTypeSSH, Params: string(paramsJSON)}).DecodeSSHParams()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(params.JumpHosts[0].HostKeyFingerprint) > 0 {
+			t.Fatal("should not keep key of another jump host")
+		}
+	}
+}
+
+func TestNodeLoginDAO_PinJumpHostKeys(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	loginId, err := SharedNodeLoginDAO.CreateNodeLogin(tx, "", 0, "test-jump-host", NodeLoginTypeSSH, []byte(`{"grantId":1,"host":"192.168.1.100","port":22,"jumpHosts":[{"grantId":2,"host":"10.0.0.1","port":22}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = SharedNodeLoginDAO.Query(tx).Pk(loginId).Delete()
+	}()
+
+	err = SharedNodeLoginDAO.PinJumpHostKeys(tx, loginId, [][2]string{{"ssh-ed25519", "SHA256:a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login, err := SharedNodeLoginDAO.FindEnabledNodeLogin(tx, loginId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := login.DecodeSSHParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params.JumpHosts) != 1 || params.JumpHosts[0].HostKeyFingerprint != "SHA256:a" || params.JumpHosts[0].HostKeyType != "ssh-ed25519" {
+		t.Fatal("jump host key should be pinned, but got:", login.Params)
+	}
+
+	// 已经信任的密钥不会被替换
+	err = SharedNodeLoginDAO.PinJumpHostKeys(tx, loginId, [][2]string{{"ssh-rsa", "SHA256:b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	login, err = SharedNodeLoginDAO.FindEnabledNodeLogin(tx, loginId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err = login.DecodeSSHParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.JumpHosts[0].HostKeyFingerprint != "SHA256:a" {
+		t.Fatal("pinned jump host key should not be replaced")
+	}
+}
@@ -2,23 +2,35 @@ package models
 
 // NodeLogin 节点登录信息
 type NodeLogin struct {
-	Id     uint32 `field:"id"`     // ID
-	NodeId uint32 `field:"nodeId"` // 节点ID
-	Role   string `field:"role"`   // 角色
-	Name   string `field:"name"`   // 名称
-	Type   string `field:"type"`   // 类型：ssh,agent
-	Params string `field:"params"` // 配置参数
-	State  uint8  `field:"state"`  // 状态
+	Id                        uint32 `field:"id"`                        // ID
+	NodeId                    uint32 `field:"nodeId"`                    // 节点ID
+	Role                      string `field:"role"`                      // 角色
+	Name                      string `field:"name"`                      // 名称
+	Type                      string `field:"type"`                      // 类型：ssh,agent
+	Params                    string `field:"params"`                    // 配置参数
+	State                     uint8  `field:"state"`                     // 状态
+	HostKeyType               string `field:"hostKeyType"`               // 信任的SSH主机密钥类型
+	HostKeyFingerprint        string `field:"hostKeyFingerprint"`        // 信任的SSH主机密钥指纹
+	HostKeyPinnedAt           uint64 `field:"hostKeyPinnedAt"`           // 信任主机密钥的时间
+	PendingHostKeyType        string `field:"pendingHostKeyType"`        // 待确认的SSH主机密钥类型
+	PendingHostKeyFingerprint string `field:"pendingHostKeyFingerprint"` // 待确认的SSH主机密钥指纹
+	PendingHostKeyAt          uint64 `field:"pendingHostKeyAt"`          // 发现待确认主机密钥的时间
 }
 
 type NodeLoginOperator struct {
-	Id     interface{} // ID
-	NodeId interface{} // 节点ID
-	Role   interface{} // 角色
-	Name   interface{} // 名称
-	Type   interface{} // 类型：ssh,agent
-	Params interface{} // 配置参数
-	State  interface{} // 状态
+	Id                        interface{} // ID
+	NodeId                    interface{} // 节点ID
+	Role                      interface{} // 角色
+	Name                      interface{} // 名称
+	Type                      interface{} // 类型：ssh,agent
+	Params                    interface{} // 配置参数
+	State                     interface{} // 状态
+	HostKeyType               interface{} // 信任的SSH主机密钥类型
+	HostKeyFingerprint        interface{} // 信任的SSH主机密钥指纹
+	HostKeyPinnedAt           interface{} // 信任主机密钥的时间
+	PendingHostKeyType        interface{} // 待确认的SSH主机密钥类型
+	PendingHostKeyFingerprint interface{} // 待确认的SSH主机密钥指纹
+	PendingHostKeyAt          interface{} // 发现待确认主机密钥的时间
 }
 
 func NewNodeLoginOperator() *NodeLoginOperator {
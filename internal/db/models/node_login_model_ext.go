@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"errors"
+	"strconv"
 )
 
 // 解析SSH登录参数
@@ -23,3 +24,57 @@ func (this *NodeLogin) DecodeSSHParams() (*NodeLoginSSHParams, error) {
 
 	return params, nil
 }
+
+// SSH登录地址，用来判断主机密钥是否需要重新信任
+func (this *NodeLogin) sshAddr() string {
+	if this.Type != NodeLoginTypeSSH {
+		return ""
+	}
+	params, err := this.DecodeSSHParams()
+	if err != nil {
+		return ""
+	}
+	return params.Host + ":" + strconv.Itoa(params.Port)
+}
+
+// 修改登录参数时保留已经信任的跳板机主机密钥
+func (this *NodeLogin) keepJumpHostKeys(paramsJSON []byte) []byte {
+	if this.Type != NodeLoginTypeSSH {
+		return paramsJSON
+	}
+	oldParams, err := this.DecodeSSHParams()
+	if err != nil || len(oldParams.JumpHosts) == 0 {
+		return paramsJSON
+	}
+	newParams, err := (&NodeLogin{Type: NodeLoginTypeSSH, Params: string(paramsJSON)}).DecodeSSHParams()
+	if err != nil || len(newParams.JumpHosts) == 0 {
+		return paramsJSON
+	}
+
+	var oldKeys = map[string]*NodeLoginJumpHost{}
+	for _, jumpHost := range oldParams.JumpHosts {
+		if jumpHost != nil && len(jumpHost.HostKeyFingerprint) > 0 {
+			oldKeys[jumpHost.Host+":"+strconv.Itoa(jumpHost.Port)] = jumpHost
+		}
+	}
+	var changed = false
+	for _, jumpHost := range newParams.JumpHosts {
+		if jumpHost == nil || len(jumpHost.HostKeyFingerprint) > 0 {
+			continue
+		}
+		oldJumpHost, ok := oldKeys[jumpHost.Host+":"+strconv.Itoa(jumpHost.Port)]
+		if ok {
+			jumpHost.HostKeyType = oldJumpHost.HostKeyType
+			jumpHost.HostKeyFingerprint = oldJumpHost.HostKeyFingerprint
+			changed = true
+		}
+	}
+	if !changed {
+		return paramsJSON
+	}
+	newParamsJSON, err := json.Marshal(newParams)
+	if err != nil {
+		return paramsJSON
+	}
+	return newParamsJSON
+}
@@ -4,4 +4,16 @@ type NodeLoginSSHParams struct {
 	GrantId int64  `json:"grantId"`
 	Host    string `json:"host"`
 	Port    int    `json:"port"`
+
+	JumpHosts    []*NodeLoginJumpHost `json:"jumpHosts"`    // 跳板机，按照顺序依次连接
+	ForwardAgent bool                 `json:"forwardAgent"` // 是否向目标主机转发认证代理
+}
+
+// NodeLoginJumpHost SSH跳板机
+type NodeLoginJumpHost struct {
+	GrantId            int64  `json:"grantId"`            // 跳板机使用的认证
+	Host               string `json:"host"`               // 跳板机地址
+	Port               int    `json:"port"`               // 跳板机端口
+	HostKeyType        string `json:"hostKeyType"`        // 信任的主机密钥类型
+	HostKeyFingerprint string `json:"hostKeyFingerprint"` // 信任的主机密钥指纹，首次连接时自动记录
 }
@@ -193,6 +193,22 @@ func (this *NSClusterDAO) FindClusterRecursion(tx *dbs.Tx, clusterId int64) ([]b
 	return []byte(recursion), nil
 }
 
+// UpdateClusterPackageVersionRange 设置集群允许安装的版本范围
+func (this *NSClusterDAO) UpdateClusterPackageVersionRange(tx *dbs.Tx, clusterId int64, versionRange string) error {
+	return this.Query(tx).
+		Pk(clusterId).
+		Set("packageVersionRange", versionRange).
+		UpdateQuickly()
+}
+
+// FindClusterPackageVersionRange 查找集群允许安装的版本范围
+func (this *NSClusterDAO) FindClusterPackageVersionRange(tx *dbs.Tx, clusterId int64) (string, error) {
+	return this.Query(tx).
+		Pk(clusterId).
+		Result("packageVersionRange").
+		FindStringCol("")
+}
+
 // NotifyUpdate 通知更改
 func (this *NSClusterDAO) NotifyUpdate(tx *dbs.Tx, clusterId int64) error {
 	return SharedNodeTaskDAO.CreateClusterTask(tx, nodeconfigs.NodeRoleDNS, clusterId, NSNodeTaskTypeConfigChanged)
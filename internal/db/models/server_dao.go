@@ -8,6 +8,7 @@ import (
 	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
 	"github.com/1uLang/EdgeCommon/pkg/serverconfigs"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models/dns"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils/numberutils"
 	_ "github.com/go-sql-driver/mysql"
@@ -19,6 +20,7 @@ import (
 	"github.com/iwind/TeaGo/types"
 	timeutil "github.com/iwind/TeaGo/utils/time"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -250,6 +252,19 @@ func (this *ServerDAO) CreateServer(tx *dbs.Tx,
 		return 0, err
 	}
 
+	// 通知Webhook订阅
+	err = SharedWebhookDAO.NotifyEvent(tx, WebhookEventTypeServerCreated, maps.Map{
+		"serverId":  serverId,
+		"name":      name,
+		"type":      serverType,
+		"clusterId": clusterId,
+		"adminId":   adminId,
+		"userId":    userId,
+	})
+	if err != nil {
+		remotelogs.Error("SERVER", "notify webhooks failed: "+err.Error())
+	}
+
 	return serverId, nil
 }
 
@@ -1807,6 +1822,44 @@ func (this *ServerDAO) FindFirstHTTPOrHTTPSPortWithClusterId(tx *dbs.Tx, cluster
 	return 0, nil
 }
 
+// FindAllEnabledServerPortsWithClusterId 获取集群中所有启用的服务监听的TCP和UDP端口
+func (this *ServerDAO) FindAllEnabledServerPortsWithClusterId(tx *dbs.Tx, clusterId int64) ([]int, error) {
+	ones, err := this.Query(tx).
+		Result("tcpPorts", "udpPorts").
+		Attr("clusterId", clusterId).
+		State(ServerStateEnabled).
+		Attr("isOn", 1).
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var portMap = map[int]bool{}
+	for _, one := range ones {
+		var server = one.(*Server)
+		for _, portsJSON := range []string{server.TcpPorts, server.UdpPorts} {
+			if len(portsJSON) == 0 || portsJSON == "null" {
+				continue
+			}
+			var ports = []int{}
+			err = json.Unmarshal([]byte(portsJSON), &ports)
+			if err != nil {
+				return nil, err
+			}
+			for _, port := range ports {
+				portMap[port] = true
+			}
+		}
+	}
+
+	var result = []int{}
+	for port := range portMap {
+		result = append(result, port)
+	}
+	sort.Ints(result)
+	return result, nil
+}
+
 // NotifyServerPortsUpdate 通知服务端口变化
 func (this *ServerDAO) NotifyServerPortsUpdate(tx *dbs.Tx, serverId int64) error {
 	one, err := this.Query(tx).
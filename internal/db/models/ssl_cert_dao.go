@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/1uLang/EdgeCommon/pkg/serverconfigs/sslconfigs"
+	"github.com/TeaOSLab/EdgeAPI/internal/secrets"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
@@ -74,7 +75,12 @@ func (this *SSLCertDAO) FindEnabledSSLCert(tx *dbs.Tx, id int64) (*SSLCert, erro
 	if result == nil {
 		return nil, err
 	}
-	return result.(*SSLCert), err
+	var cert = result.(*SSLCert)
+	cert.KeyData, err = secrets.DecryptString(cert.KeyData)
+	if err != nil {
+		return nil, errors.New("decrypt cert '" + types.String(id) + "' key failed: " + err.Error())
+	}
+	return cert, nil
 }
 
 // FindSSLCertName 根据主键查找名称
@@ -97,7 +103,11 @@ func (this *SSLCertDAO) CreateCert(tx *dbs.Tx, adminId int64, userId int64, isOn
 	op.ServerName = serverName
 	op.IsCA = isCA
 	op.CertData = certData
-	op.KeyData = keyData
+	encryptedKeyData, err := secrets.EncryptString(string(keyData))
+	if err != nil {
+		return 0, err
+	}
+	op.KeyData = encryptedKeyData
 	op.TimeBeginAt = timeBeginAt
 	op.TimeEndAt = timeEndAt
 
@@ -138,7 +148,11 @@ func (this *SSLCertDAO) UpdateCert(tx *dbs.Tx, certId int64, isOn bool, name str
 		op.CertData = certData
 	}
 	if len(keyData) > 0 {
-		op.KeyData = keyData
+		encryptedKeyData, err := secrets.EncryptString(string(keyData))
+		if err != nil {
+			return err
+		}
+		op.KeyData = encryptedKeyData
 	}
 
 	op.TimeBeginAt = timeBeginAt
@@ -308,6 +322,53 @@ func (this *SSLCertDAO) UpdateCertACME(tx *dbs.Tx, certId int64, acmeTaskId int6
 	return err
 }
 
+// ReencryptSecrets 使用当前主密钥重新加密所有证书的私钥，返回修改的数量
+func (this *SSLCertDAO) ReencryptSecrets(tx *dbs.Tx) (count int64, err error) {
+	ones, err := this.Query(tx).
+		ResultPk().
+		AscPk().
+		FindAll()
+	if err != nil {
+		return 0, err
+	}
+	for _, one := range ones {
+		var certId = int64(one.(*SSLCert).Id)
+
+		// 私钥可能比较大，所以逐个读取
+		keyOne, err := this.Query(tx).
+			Pk(certId).
+			Result("id", "keyData").
+			Find()
+		if err != nil {
+			return count, err
+		}
+		if keyOne == nil {
+			continue
+		}
+		var keyData = keyOne.(*SSLCert).KeyData
+		newKeyData, changed, err := secrets.ReencryptString(keyData)
+		if err != nil {
+			return count, errors.New("re-encrypt cert '" + types.String(certId) + "' key failed: " + err.Error())
+		}
+		if !changed {
+			continue
+		}
+		// 只有在数据没有被修改时才更新
+		rowsAffected, err := this.Query(tx).
+			Pk(certId).
+			Attr("keyData", keyData).
+			Set("keyData", newKeyData).
+			Update()
+		if err != nil {
+			return count, err
+		}
+		if rowsAffected > 0 {
+			count++
+		}
+	}
+	return
+}
+
 // FindAllExpiringCerts 查找需要自动更新的任务
 // 这里我们只返回有限的字段以节省内存
 func (this *SSLCertDAO) FindAllExpiringCerts(tx *dbs.Tx, days int) (result []*SSLCert, err error) {
@@ -1 +1,36 @@
 package models
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/iwind/TeaGo/maps"
+)
+
+// DecodeDNSNames 解析DNS名称列表
+func (this *SSLCert) DecodeDNSNames() []string {
+	var result = []string{}
+	if !IsNotNull(this.DnsNames) {
+		return result
+	}
+	_ = json.Unmarshal([]byte(this.DnsNames), &result)
+	return result
+}
+
+// AuditMap 用于审计日志的数据，不包含私钥，证书内容只记录其SHA256
+func (this *SSLCert) AuditMap() maps.Map {
+	return maps.Map{
+		"id":          this.Id,
+		"name":        this.Name,
+		"description": this.Description,
+		"isOn":        this.IsOn == 1,
+		"isCA":        this.IsCA == 1,
+		"serverName":  this.ServerName,
+		"dnsNames":    this.DecodeDNSNames(),
+		"timeBeginAt": this.TimeBeginAt,
+		"timeEndAt":   this.TimeEndAt,
+		"certSHA256":  fmt.Sprintf("%x", sha256.Sum256([]byte(this.CertData))),
+		"hasKey":      len(this.KeyData) > 0,
+		"state":       this.State,
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package models
+
+import (
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	"sync"
+	"time"
+)
+
+var ErrLeaseLost = errors.New("lease has been lost")
+
+// SysLease 自动续期的锁
+// 持有期间会在后台定期续期；续期失败或者被其他持有者接管后，Lost() 返回的通道会被关闭，执行者应当尽快停止。
+// Check() 只能确认调用时仍然持有锁；需要防止和接管者交错的数据库修改应当放在 RunTx() 中执行，
+// 或者像安装任务一样把 Token() 写入数据并在修改时作为条件
+type SysLease struct {
+	dao     *SysLockerDAO
+	key     string
+	owner   string
+	token   int64
+	timeout int64
+
+	lastRenewedAt time.Time
+	isLost        bool
+	isStopped     bool
+	locker        sync.Mutex
+
+	lostChan chan bool
+	stopChan chan bool
+	doneChan chan bool
+}
+
+// AcquireLease 获得租约并开始自动续期，锁被其他持有者占用时返回nil
+// timeout为单次续期的有效时间，执行时间可以超过timeout
+func (this *SysLockerDAO) AcquireLease(tx *dbs.Tx, key string, timeout int64) (*SysLease, error) {
+	var owner = CurrentLockerOwner()
+	var now = time.Now()
+	token, ok, err := this.AcquireLock(tx, key, owner, timeout)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	var lease = &SysLease{
+		dao:           this,
+		key:           key,
+		owner:         owner,
+		token:         token,
+		timeout:       timeout,
+		lastRenewedAt: now,
+		lostChan:      make(chan bool),
+		stopChan:      make(chan bool),
+		doneChan:      make(chan bool),
+	}
+	go lease.keepAlive()
+	return lease, nil
+}
+
+// Key 锁的键值
+func (this *SysLease) Key() string {
+	return this.key
+}
+
+// Token 防护令牌
+func (this *SysLease) Token() int64 {
+	return this.token
+}
+
+// Lost 租约丢失时关闭的通道
+func (this *SysLease) Lost() <-chan bool {
+	return this.lostChan
+}
+
+// IsLost 租约是否已经丢失
+// 即使续期请求一直没有返回，超过有效时间后也认为已经丢失
+func (this *SysLease) IsLost() bool {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	if this.isLost {
+		return true
+	}
+	if time.Since(this.lastRenewedAt) >= time.Duration(this.timeout)*time.Second {
+		this.markLost()
+		return true
+	}
+	return false
+}
+
+// Check 到数据库中确认调用时仍然持有锁，丢失时返回 ErrLeaseLost
+func (this *SysLease) Check() error {
+	if this.IsLost() {
+		return ErrLeaseLost
+	}
+	ok, err := this.dao.CheckFencingToken(nil, this.key, this.owner, this.token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		this.locker.Lock()
+		this.markLost()
+		this.locker.Unlock()
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// RunTx 在锁定租约的事务中执行修改
+// 事务开始时使用防护令牌锁定租约，已经被接管时返回 ErrLeaseLost 并且不会执行修改
+func (this *SysLease) RunTx(f func(tx *dbs.Tx) error) error {
+	if this.IsLost() {
+		return ErrLeaseLost
+	}
+	return this.dao.Instance.RunTx(func(tx *dbs.Tx) error {
+		ok, err := this.dao.LockFencingToken(tx, this.key, this.owner, this.token)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			this.locker.Lock()
+			this.markLost()
+			this.locker.Unlock()
+			return ErrLeaseLost
+		}
+		return f(tx)
+	})
+}
+
+// Stop 停止续期，但不释放锁，锁会在有效时间结束后自动失效
+// 用于控制任务在一段时间内只执行一次的场景
+func (this *SysLease) Stop() {
+	this.locker.Lock()
+	if this.isStopped {
+		this.locker.Unlock()
+		return
+	}
+	this.isStopped = true
+	this.locker.Unlock()
+
+	close(this.stopChan)
+	<-this.doneChan
+}
+
+// Release 停止续期并释放锁
+func (this *SysLease) Release() error {
+	this.Stop()
+	return this.dao.ReleaseLock(nil, this.key, this.owner, this.token)
+}
+
+// 定期续期，间隔为有效时间的三分之一
+func (this *SysLease) keepAlive() {
+	defer close(this.doneChan)
+
+	var interval = time.Duration(this.timeout) * time.Second / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-this.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		if this.IsLost() {
+			return
+		}
+
+		var renewedAt = time.Now()
+		ok, err := this.dao.RenewLock(nil, this.key, this.owner, this.token, this.timeout)
+		if err != nil {
+			// 临时错误时继续尝试，直到超过有效时间
+			remotelogs.Error("SYS_LEASE", "renew lease '"+this.key+"' failed: "+err.Error())
+			continue
+		}
+
+		this.locker.Lock()
+		if ok {
+			this.lastRenewedAt = renewedAt
+		} else {
+			remotelogs.Warn("SYS_LEASE", "lease '"+this.key+"' (token: "+types.String(this.token)+") has been taken over")
+			this.markLost()
+		}
+		this.locker.Unlock()
+		if !ok {
+			return
+		}
+	}
+}
+
+// 标记为丢失，需要在锁内调用
+func (this *SysLease) markLost() {
+	if this.isLost {
+		return
+	}
+	this.isLost = true
+	close(this.lostChan)
+}
@@ -1,11 +1,16 @@
 package models
 
 import (
+	"database/sql"
+	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/rands"
 	"github.com/iwind/TeaGo/types"
+	"os"
 	"time"
 )
 
@@ -30,88 +35,178 @@ func init() {
 	})
 }
 
-// 开锁
+// SysLockerLeaderPrefix 单例任务Leader选举使用的锁前缀
+const SysLockerLeaderPrefix = "leader:"
+
+// 当前进程的标识，用来区分同一个API节点上的多个进程（比如命令行工具）
+var sysLockerProcessId = rands.HexString(16)
+
+// CurrentLockerOwner 当前进程作为锁持有者的标识
+func CurrentLockerOwner() string {
+	return "apiNode:" + types.String(teaconst.NodeId) + "/pid:" + types.String(os.Getpid()) + "/" + sysLockerProcessId
+}
+
+// Lock 使用当前进程的标识获得锁
 func (this *SysLockerDAO) Lock(tx *dbs.Tx, key string, timeout int64) (ok bool, err error) {
-	maxErrors := 5
-	for {
-		one, err := this.Query(tx).
-			Attr("key", key).
-			Find()
-		if err != nil {
-			maxErrors--
-			if maxErrors < 0 {
-				return false, err
-			}
-			continue
-		}
+	_, ok, err = this.AcquireLock(tx, key, CurrentLockerOwner(), timeout)
+	return
+}
 
-		// 如果没有锁，则创建
-		if one == nil {
-			op := NewSysLockerOperator()
-			op.Key = key
-			op.TimeoutAt = time.Now().Unix() + timeout
-			op.Version = 1
-			err := this.Save(tx, op)
-			if err != nil {
-				maxErrors--
-				if maxErrors < 0 {
-					return false, err
-				}
-				continue
-			}
+// Unlock 释放当前进程持有的锁，其他持有者的锁不受影响
+func (this *SysLockerDAO) Unlock(tx *dbs.Tx, key string) error {
+	return this.ReleaseLock(tx, key, CurrentLockerOwner(), 0)
+}
 
-			return true, nil
-		}
+// AcquireLock 获得锁，成功时返回防护令牌
+// 防护令牌在每次获得锁时递增；锁不可重入，即使是同一个持有者，也只能在锁被释放或者超时后才能再次获得
+func (this *SysLockerDAO) AcquireLock(tx *dbs.Tx, key string, owner string, timeout int64) (token int64, ok bool, err error) {
+	if len(key) == 0 {
+		return 0, false, errors.New("key should not be empty")
+	}
+	if len(owner) == 0 {
+		return 0, false, errors.New("owner should not be empty")
+	}
+	if timeout <= 0 {
+		return 0, false, errors.New("timeout should be greater than 0")
+	}
 
-		// 如果已经有锁
-		locker := one.(*SysLocker)
-		if time.Now().Unix() <= int64(locker.TimeoutAt) {
-			return false, nil
-		}
+	// 已经释放或者超时时接管
+	var now = time.Now().Unix()
+	rowsAffected, err := this.Query(tx).
+		Attr("key", key).
+		Where("timeoutAt<:now").
+		Param("now", now).
+		Set("version", dbs.SQL("version+1")).
+		Set("timeoutAt", now+timeout).
+		Set("owner", owner).
+		Set("ownerNodeId", teaconst.NodeId).
+		Set("acquiredAt", now).
+		Update()
+	if err != nil {
+		return 0, false, err
+	}
 
-		// 修改
-		op := NewSysLockerOperator()
-		op.Id = locker.Id
-		op.Version = locker.Version + 1
-		op.TimeoutAt = time.Now().Unix() + timeout
-		err = this.Save(tx, op)
+	// 锁不存在时创建，并发创建时只有一个能成功
+	if rowsAffected == 0 {
+		var sqlString = "INSERT IGNORE INTO `" + this.Table + "` (`key`, `version`, `timeoutAt`, `owner`, `ownerNodeId`, `acquiredAt`) VALUES (?, 1, ?, ?, ?, ?)"
+		var args = []interface{}{key, now + timeout, owner, teaconst.NodeId, now}
+		var result sql.Result
+		if tx != nil {
+			result, err = tx.Exec(sqlString, args...)
+		} else {
+			result, err = this.Instance.Exec(sqlString, args...)
+		}
 		if err != nil {
-			maxErrors--
-			if maxErrors < 0 {
-				return false, err
-			}
-			continue
+			return 0, false, err
 		}
-
-		// 再次查询版本
-		version, err := this.Query(tx).
-			Attr("key", key).
-			Result("version").
-			FindCol("0")
+		rowsAffected, err = result.RowsAffected()
 		if err != nil {
-			maxErrors--
-			if maxErrors < 0 {
-				return false, err
-			}
-			continue
+			return 0, false, err
 		}
-		if types.Int64(version) != int64(locker.Version)+1 {
-			return false, nil
+		if rowsAffected == 0 {
+			return 0, false, nil
 		}
+	}
+
+	token, err = this.Query(tx).
+		Attr("key", key).
+		Attr("owner", owner).
+		Result("version").
+		FindInt64Col(0)
+	if err != nil {
+		return 0, false, err
+	}
+	return token, token > 0, nil
+}
 
+// RenewLock 续期，返回锁是否仍然属于此持有者
+func (this *SysLockerDAO) RenewLock(tx *dbs.Tx, key string, owner string, token int64, timeout int64) (ok bool, err error) {
+	var now = time.Now().Unix()
+	rowsAffected, err := this.Query(tx).
+		Attr("key", key).
+		Attr("owner", owner).
+		Attr("version", token).
+		Where("timeoutAt>=:now").
+		Param("now", now).
+		Set("timeoutAt", now+timeout).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	if rowsAffected > 0 {
 		return true, nil
 	}
+
+	// 同一秒内续期时数据没有变化，影响的行数为0，需要再次检查
+	return this.CheckFencingToken(tx, key, owner, token)
 }
 
-// 解锁
-func (this *SysLockerDAO) Unlock(tx *dbs.Tx, key string) error {
-	_, err := this.Query(tx).
+// ReleaseLock 释放锁
+// token为0时释放此持有者的锁，否则只在令牌一致时释放
+func (this *SysLockerDAO) ReleaseLock(tx *dbs.Tx, key string, owner string, token int64) error {
+	var query = this.Query(tx).
 		Attr("key", key).
-		Set("timeoutAt", time.Now().Unix()-86400*365).
+		Attr("owner", owner)
+	if token > 0 {
+		query.Attr("version", token)
+	}
+	_, err := query.
+		Set("timeoutAt", 0).
+		Set("owner", "").
+		Set("ownerNodeId", 0).
 		Update()
 	return err
 }
 
+// CheckFencingToken 检查锁是否仍然由此持有者以此令牌持有，并且没有超时
+func (this *SysLockerDAO) CheckFencingToken(tx *dbs.Tx, key string, owner string, token int64) (bool, error) {
+	return this.Query(tx).
+		Attr("key", key).
+		Attr("owner", owner).
+		Attr("version", token).
+		Where("timeoutAt>=:now").
+		Param("now", time.Now().Unix()).
+		Exist()
+}
+
+// LockFencingToken 在事务中锁定仍然由此持有者以此令牌持有的锁
+// 事务提交之前其他持有者无法接管，所以同一个事务中的修改不会和接管者的修改交错
+func (this *SysLockerDAO) LockFencingToken(tx *dbs.Tx, key string, owner string, token int64) (bool, error) {
+	if tx == nil {
+		return false, errors.New("'tx' should not be nil")
+	}
+	return this.Query(tx).
+		Attr("key", key).
+		Attr("owner", owner).
+		Attr("version", token).
+		Where("timeoutAt>=:now").
+		Param("now", time.Now().Unix()).
+		Lock(dbs.QueryLockForUpdate).
+		Exist()
+}
+
+// FindLocker 查找锁
+func (this *SysLockerDAO) FindLocker(tx *dbs.Tx, key string) (*SysLocker, error) {
+	one, err := this.Query(tx).
+		Attr("key", key).
+		Find()
+	if err != nil || one == nil {
+		return nil, err
+	}
+	return one.(*SysLocker), nil
+}
+
+// FindAllLockersWithPrefix 查找某个前缀的所有锁
+func (this *SysLockerDAO) FindAllLockersWithPrefix(tx *dbs.Tx, prefix string) (result []*SysLocker, err error) {
+	_, err = this.Query(tx).
+		Where("`key` LIKE :prefix").
+		Param("prefix", prefix+"%").
+		Asc("`key`").
+		Slice(&result).
+		FindAll()
+	return
+}
+
 // 增加版本号
 func (this *SysLockerDAO) Increase(tx *dbs.Tx, key string, defaultValue int64) (int64, error) {
 	if tx == nil {
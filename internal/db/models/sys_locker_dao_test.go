@@ -5,6 +5,7 @@ import (
 	"github.com/iwind/TeaGo/dbs"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestSysLockerDAO_Lock(t *testing.T) {
@@ -44,3 +45,106 @@ func TestSysLocker_Increase(t *testing.T) {
 	wg.Wait()
 	t.Log("ok")
 }
+
+func TestSysLockerDAO_AcquireLock(t *testing.T) {
+	var tx *dbs.Tx
+	var key = "test_acquire"
+
+	token, ok, err := SharedSysLockerDAO.AcquireLock(tx, key, "owner1", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("owner1:", token, ok)
+
+	// 锁不可重入
+	_, ok1, err := SharedSysLockerDAO.AcquireLock(tx, key, "owner1", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok && ok1 {
+		t.Fatal("owner1 should not acquire the lock again")
+	}
+
+	// 被其他持有者占用
+	_, ok2, err := SharedSysLockerDAO.AcquireLock(tx, key, "owner2", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok && ok2 {
+		t.Fatal("owner2 should not acquire the lock")
+	}
+
+	// 其他持有者不能释放
+	err = SharedSysLockerDAO.ReleaseLock(tx, key, "owner2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err = SharedSysLockerDAO.CheckFencingToken(tx, key, "owner1", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("owner1 still holds:", ok)
+
+	err = SharedSysLockerDAO.ReleaseLock(tx, key, "owner1", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token2, ok2, err := SharedSysLockerDAO.AcquireLock(tx, key, "owner2", 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok2 || token2 <= token {
+		t.Fatal("owner2 should acquire the lock with a larger token:", token, token2)
+	}
+	_ = SharedSysLockerDAO.ReleaseLock(tx, key, "owner2", token2)
+}
+
+func TestSysLockerDAO_AcquireLease(t *testing.T) {
+	lease, err := SharedSysLockerDAO.AcquireLease(nil, "test_lease", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease == nil {
+		t.Log("held by others")
+		return
+	}
+	defer func() {
+		_ = lease.Release()
+	}()
+
+	// 超过有效时间后仍然持有
+	time.Sleep(3 * time.Second)
+	err = lease.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var isCalled = false
+	err = lease.RunTx(func(tx *dbs.Tx) error {
+		isCalled = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isCalled {
+		t.Fatal("should run in tx")
+	}
+
+	// 被接管之后不能再修改
+	_, err = SharedSysLockerDAO.Query(nil).
+		Attr("key", "test_lease").
+		Set("version", dbs.SQL("version+1")).
+		Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lease.RunTx(func(tx *dbs.Tx) error {
+		t.Fatal("should not run after taken over")
+		return nil
+	})
+	if err != ErrLeaseLost {
+		t.Fatal("expected ErrLeaseLost, but got:", err)
+	}
+}
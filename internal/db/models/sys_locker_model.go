@@ -2,17 +2,23 @@ package models
 
 // 并发锁
 type SysLocker struct {
-	Id        uint64 `field:"id"`        // ID
-	Key       string `field:"key"`       // 键值
-	Version   uint64 `field:"version"`   // 版本号
-	TimeoutAt uint64 `field:"timeoutAt"` // 超时时间
+	Id          uint64 `field:"id"`          // ID
+	Key         string `field:"key"`         // 键值
+	Version     uint64 `field:"version"`     // 版本号，每次获得锁时加1，同时作为防护令牌
+	TimeoutAt   uint64 `field:"timeoutAt"`   // 超时时间
+	Owner       string `field:"owner"`       // 持有者标识
+	OwnerNodeId uint32 `field:"ownerNodeId"` // 持有者API节点ID
+	AcquiredAt  uint64 `field:"acquiredAt"`  // 获得锁时间
 }
 
 type SysLockerOperator struct {
-	Id        interface{} // ID
-	Key       interface{} // 键值
-	Version   interface{} // 版本号
-	TimeoutAt interface{} // 超时时间
+	Id          interface{} // ID
+	Key         interface{} // 键值
+	Version     interface{} // 版本号，每次获得锁时加1，同时作为防护令牌
+	TimeoutAt   interface{} // 超时时间
+	Owner       interface{} // 持有者标识
+	OwnerNodeId interface{} // 持有者API节点ID
+	AcquiredAt  interface{} // 获得锁时间
 }
 
 func NewSysLockerOperator() *SysLockerOperator {
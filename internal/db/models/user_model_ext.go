@@ -1 +1,20 @@
 package models
+
+import "github.com/iwind/TeaGo/maps"
+
+// AuditMap 用于审计日志的数据，不包含密码
+func (this *User) AuditMap() maps.Map {
+	return maps.Map{
+		"id":        this.Id,
+		"username":  this.Username,
+		"fullname":  this.Fullname,
+		"mobile":    this.Mobile,
+		"tel":       this.Tel,
+		"email":     this.Email,
+		"remark":    this.Remark,
+		"isOn":      this.IsOn == 1,
+		"clusterId": this.ClusterId,
+		"features":  this.Features,
+		"state":     this.State,
+	}
+}
@@ -0,0 +1,360 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/secrets"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/rands"
+	"github.com/iwind/TeaGo/types"
+	"net"
+	"net/url"
+	"time"
+)
+
+const (
+	WebhookStateEnabled  = 1 // 已启用
+	WebhookStateDisabled = 0 // 已禁用
+)
+
+type WebhookDAO dbs.DAO
+
+func NewWebhookDAO() *WebhookDAO {
+	return dbs.NewDAO(&WebhookDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeWebhooks",
+			Model:  new(Webhook),
+			PkName: "id",
+		},
+	}).(*WebhookDAO)
+}
+
+var SharedWebhookDAO *WebhookDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedWebhookDAO = NewWebhookDAO()
+	})
+}
+
+// EnableWebhook 启用条目
+func (this *WebhookDAO) EnableWebhook(tx *dbs.Tx, id int64) error {
+	_, err := this.Query(tx).
+		Pk(id).
+		Set("state", WebhookStateEnabled).
+		Update()
+	return err
+}
+
+// DisableWebhook 禁用条目
+func (this *WebhookDAO) DisableWebhook(tx *dbs.Tx, id int64) error {
+	_, err := this.Query(tx).
+		Pk(id).
+		Set("state", WebhookStateDisabled).
+		Update()
+	return err
+}
+
+// FindEnabledWebhook 查找启用中的条目
+func (this *WebhookDAO) FindEnabledWebhook(tx *dbs.Tx, id int64) (*Webhook, error) {
+	result, err := this.Query(tx).
+		Pk(id).
+		Attr("state", WebhookStateEnabled).
+		Find()
+	if err != nil || result == nil {
+		return nil, err
+	}
+	var webhook = result.(*Webhook)
+	err = this.decodeSecret(webhook)
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// CreateWebhook 创建订阅
+// secret 为空时自动生成
+func (this *WebhookDAO) CreateWebhook(tx *dbs.Tx, adminId int64, name string, url string, secret string, eventTypes []string, isOn bool) (int64, error) {
+	err := CheckWebhookURL(url)
+	if err != nil {
+		return 0, err
+	}
+	err = this.checkEventTypes(eventTypes)
+	if err != nil {
+		return 0, err
+	}
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	eventTypesJSON, err := json.Marshal(eventTypes)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(secret) == 0 {
+		secret = rands.HexString(32)
+	}
+	secret, err = secrets.EncryptString(secret)
+	if err != nil {
+		return 0, err
+	}
+
+	op := NewWebhookOperator()
+	op.AdminId = adminId
+	op.Name = name
+	op.Url = url
+	op.Secret = secret
+	op.EventTypes = eventTypesJSON
+	op.IsOn = isOn
+	op.State = WebhookStateEnabled
+	return this.SaveInt64(tx, op)
+}
+
+// UpdateWebhook 修改订阅
+// secret 为空时表示不修改
+func (this *WebhookDAO) UpdateWebhook(tx *dbs.Tx, webhookId int64, name string, url string, secret string, eventTypes []string, isOn bool) error {
+	if webhookId <= 0 {
+		return errors.New("invalid webhookId")
+	}
+
+	err := CheckWebhookURL(url)
+	if err != nil {
+		return err
+	}
+	err = this.checkEventTypes(eventTypes)
+	if err != nil {
+		return err
+	}
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	eventTypesJSON, err := json.Marshal(eventTypes)
+	if err != nil {
+		return err
+	}
+
+	op := NewWebhookOperator()
+	op.Id = webhookId
+	op.Name = name
+	op.Url = url
+	if len(secret) > 0 {
+		secret, err = secrets.EncryptString(secret)
+		if err != nil {
+			return err
+		}
+		op.Secret = secret
+	}
+	op.EventTypes = eventTypesJSON
+	op.IsOn = isOn
+	return this.Save(tx, op)
+}
+
+// CountAllEnabledWebhooks 计算订阅数量
+func (this *WebhookDAO) CountAllEnabledWebhooks(tx *dbs.Tx) (int64, error) {
+	return this.Query(tx).
+		State(WebhookStateEnabled).
+		Count()
+}
+
+// ListEnabledWebhooks 列出单页订阅
+func (this *WebhookDAO) ListEnabledWebhooks(tx *dbs.Tx, offset int64, size int64) (result []*Webhook, err error) {
+	_, err = this.Query(tx).
+		State(WebhookStateEnabled).
+		Offset(offset).
+		Limit(size).
+		DescPk().
+		Slice(&result).
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range result {
+		err = this.decodeSecret(webhook)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// FindAllEnabledAndOnWebhooks 查找所有启用的订阅
+func (this *WebhookDAO) FindAllEnabledAndOnWebhooks(tx *dbs.Tx) (result []*Webhook, err error) {
+	_, err = this.Query(tx).
+		State(WebhookStateEnabled).
+		Attr("isOn", true).
+		AscPk().
+		Slice(&result).
+		FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range result {
+		err = this.decodeSecret(webhook)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// ReencryptSecrets 使用当前主密钥重新加密所有订阅的签名密钥，返回修改的数量
+func (this *WebhookDAO) ReencryptSecrets(tx *dbs.Tx) (count int64, err error) {
+	ones, err := this.Query(tx).
+		Result("id", "secret").
+		AscPk().
+		FindAll()
+	if err != nil {
+		return 0, err
+	}
+	for _, one := range ones {
+		var webhook = one.(*Webhook)
+		newSecret, changed, err := secrets.ReencryptString(webhook.Secret)
+		if err != nil {
+			return count, errors.New("re-encrypt webhook '" + types.String(webhook.Id) + "' secret failed: " + err.Error())
+		}
+		if !changed {
+			continue
+		}
+		// 只有在数据没有被修改时才更新
+		rowsAffected, err := this.Query(tx).
+			Pk(webhook.Id).
+			Attr("secret", webhook.Secret).
+			Set("secret", newSecret).
+			Update()
+		if err != nil {
+			return count, err
+		}
+		if rowsAffected > 0 {
+			count++
+		}
+	}
+	return
+}
+
+// NotifyEvent 通知事件
+// 为每个订阅了此事件的Webhook创建一个投递任务，由投递任务异步发送
+func (this *WebhookDAO) NotifyEvent(tx *dbs.Tx, eventType WebhookEventType, data maps.Map) error {
+	if this == nil {
+		// 数据库尚未准备好
+		return nil
+	}
+
+	webhooks, err := this.FindAllEnabledAndOnWebhooks(tx)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	return this.createDeliveries(tx, webhooks, eventType, data)
+}
+
+// PingWebhook 向某个订阅发送测试事件
+func (this *WebhookDAO) PingWebhook(tx *dbs.Tx, webhookId int64) error {
+	webhook, err := this.FindEnabledWebhook(tx, webhookId)
+	if err != nil {
+		return err
+	}
+	if webhook == nil {
+		return errors.New("can not find webhook '" + types.String(webhookId) + "'")
+	}
+	return this.createDeliveries(tx, []*Webhook{webhook}, WebhookEventTypePing, maps.Map{
+		"webhookId": webhookId,
+	})
+}
+
+func (this *WebhookDAO) createDeliveries(tx *dbs.Tx, webhooks []*Webhook, eventType WebhookEventType, data maps.Map) error {
+	if data == nil {
+		data = maps.Map{}
+	}
+
+	// 同一个事件发送给不同订阅时使用相同的事件ID，接收方可以用来去重
+	var eventId = rands.HexString(32)
+	payloadJSON, err := json.Marshal(maps.Map{
+		"id":        eventId,
+		"type":      eventType,
+		"createdAt": time.Now().Unix(),
+		"data":      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.MatchEvent(eventType) {
+			continue
+		}
+		_, err = SharedWebhookDeliveryDAO.CreateDelivery(tx, int64(webhook.Id), eventId, eventType, payloadJSON)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *WebhookDAO) checkEventTypes(eventTypes []string) error {
+	for _, eventType := range eventTypes {
+		if !IsValidWebhookEventType(eventType) {
+			return errors.New("invalid event type '" + eventType + "'")
+		}
+	}
+	return nil
+}
+
+// 解密签名密钥
+func (this *WebhookDAO) decodeSecret(webhook *Webhook) error {
+	secret, err := secrets.DecryptString(webhook.Secret)
+	if err != nil {
+		return errors.New("decrypt webhook '" + types.String(webhook.Id) + "' secret failed: " + err.Error())
+	}
+	webhook.Secret = secret
+	return nil
+}
+
+// CheckWebhookURL 检查订阅的接收地址
+// 只支持HTTP和HTTPS，并且域名解析后的所有IP都必须是公网IP，防止通过Webhook访问内网服务
+func CheckWebhookURL(rawURL string) error {
+	host, err := parseWebhookURL(rawURL)
+	if err != nil {
+		return err
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return errors.New("resolve webhook host '" + host + "' failed: " + err.Error())
+	}
+	if len(addrs) == 0 {
+		return errors.New("resolve webhook host '" + host + "' failed: no ip found")
+	}
+	for _, addr := range addrs {
+		if !utils.IsPublicIP(addr.IP) {
+			return errors.New("webhook host '" + host + "' should not resolve to non-public ip '" + addr.IP.String() + "'")
+		}
+	}
+	return nil
+}
+
+// 解析订阅的接收地址，返回其中的主机名
+func parseWebhookURL(rawURL string) (host string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.New("invalid webhook url: " + err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.New("invalid webhook url: scheme should be 'http' or 'https'")
+	}
+	host = u.Hostname()
+	if len(host) == 0 {
+		return "", errors.New("invalid webhook url: host should not be empty")
+	}
+	return host, nil
+}
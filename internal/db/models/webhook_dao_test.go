@@ -0,0 +1,78 @@
+package models
+
+import (
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"testing"
+)
+
+func TestWebhookDAO_NotifyEvent(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	err := SharedWebhookDAO.NotifyEvent(tx, WebhookEventTypeServerCreated, maps.Map{
+		"serverId": 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ok")
+}
+
+func TestWebhook_MatchEvent(t *testing.T) {
+	{
+		var webhook = &Webhook{}
+		if !webhook.MatchEvent(WebhookEventTypeNodeOffline) {
+			t.Fatal("should match all events")
+		}
+	}
+	{
+		var webhook = &Webhook{EventTypes: `["server.created"]`}
+		if !webhook.MatchEvent(WebhookEventTypeServerCreated) || webhook.MatchEvent(WebhookEventTypeNodeOffline) {
+			t.Fatal("should match server.created only")
+		}
+		if !webhook.MatchEvent(WebhookEventTypePing) {
+			t.Fatal("should always match ping")
+		}
+	}
+}
+
+func TestWebhook_Sign(t *testing.T) {
+	var webhook = &Webhook{Secret: "123456"}
+	var signature = webhook.Sign(1600000000, []byte(`{"type":"ping"}`))
+	if signature != webhook.Sign(1600000000, []byte(`{"type":"ping"}`)) {
+		t.Fatal("signature should be stable")
+	}
+	if signature == webhook.Sign(1600000001, []byte(`{"type":"ping"}`)) {
+		t.Fatal("signature should contain timestamp")
+	}
+	t.Log(signature)
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	for _, u := range []string{
+		"ftp://8.8.8.8/hook",
+		"file:///etc/passwd",
+		"http:///hook",
+		"http://127.0.0.1:8001/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://192.168.1.1/hook",
+		"http://[::1]/hook",
+	} {
+		if CheckWebhookURL(u) == nil {
+			t.Fatal("'" + u + "' should be rejected")
+		}
+	}
+	for _, u := range []string{
+		"http://8.8.8.8/hook",
+		"https://[2001:4860::8888]:8443/hook",
+	} {
+		err := CheckWebhookURL(u)
+		if err != nil {
+			t.Fatal("'"+u+"' should be allowed:", err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+	"strings"
+	"time"
+)
+
+type WebhookDeliveryAttemptDAO dbs.DAO
+
+func NewWebhookDeliveryAttemptDAO() *WebhookDeliveryAttemptDAO {
+	return dbs.NewDAO(&WebhookDeliveryAttemptDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeWebhookDeliveryAttempts",
+			Model:  new(WebhookDeliveryAttempt),
+			PkName: "id",
+		},
+	}).(*WebhookDeliveryAttemptDAO)
+}
+
+var SharedWebhookDeliveryAttemptDAO *WebhookDeliveryAttemptDAO
+
+func init() {
+	dbs.OnReady(func() {
+		SharedWebhookDeliveryAttemptDAO = NewWebhookDeliveryAttemptDAO()
+	})
+}
+
+// CreateAttempt 记录一次投递尝试
+func (this *WebhookDeliveryAttemptDAO) CreateAttempt(tx *dbs.Tx, deliveryId int64, webhookId int64, isManual bool, isOk bool, statusCode int, errMsg string, response string, costMs int64) (int64, error) {
+	op := NewWebhookDeliveryAttemptOperator()
+	op.DeliveryId = deliveryId
+	op.WebhookId = webhookId
+	op.IsManual = isManual
+	op.IsOk = isOk
+	op.StatusCode = statusCode
+	op.Error = this.limitString(errMsg, 1024)
+	op.Response = this.limitString(response, 1024)
+	op.CostMs = costMs
+	op.Day = timeutil.Format("Ymd")
+	return this.SaveInt64(tx, op)
+}
+
+// FindAttempt 查找投递记录
+func (this *WebhookDeliveryAttemptDAO) FindAttempt(tx *dbs.Tx, attemptId int64) (*WebhookDeliveryAttempt, error) {
+	one, err := this.Query(tx).
+		Pk(attemptId).
+		Find()
+	if one == nil || err != nil {
+		return nil, err
+	}
+	return one.(*WebhookDeliveryAttempt), nil
+}
+
+// FindAllAttemptsWithDeliveryId 列出某个投递的所有尝试记录
+func (this *WebhookDeliveryAttemptDAO) FindAllAttemptsWithDeliveryId(tx *dbs.Tx, deliveryId int64) (result []*WebhookDeliveryAttempt, err error) {
+	_, err = this.Query(tx).
+		Attr("deliveryId", deliveryId).
+		AscPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// CleanExpiredAttempts 清理
+func (this *WebhookDeliveryAttemptDAO) CleanExpiredAttempts(tx *dbs.Tx, days int) error {
+	if days <= 0 {
+		days = 30
+	}
+	var day = timeutil.Format("Ymd", time.Now().AddDate(0, 0, -days))
+	_, err := this.Query(tx).
+		Where("(day IS NULL OR day<:day)").
+		Param("day", day).
+		Delete()
+	return err
+}
+
+// 限制字符串长度，并去除无效的UTF-8字符，防止写入数据库时出错
+func (this *WebhookDeliveryAttemptDAO) limitString(s string, maxLength int) string {
+	var runes = []rune(strings.ToValidUTF8(s, ""))
+	if len(runes) > maxLength {
+		return string(runes[:maxLength])
+	}
+	return string(runes)
+}
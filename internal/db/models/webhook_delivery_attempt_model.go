@@ -0,0 +1,34 @@
+package models
+
+// WebhookDeliveryAttempt Webhook投递记录
+type WebhookDeliveryAttempt struct {
+	Id         uint64 `field:"id"`         // ID
+	DeliveryId uint64 `field:"deliveryId"` // 投递ID
+	WebhookId  uint32 `field:"webhookId"`  // Webhook ID
+	IsManual   uint8  `field:"isManual"`   // 是否为手动重新投递
+	IsOk       uint8  `field:"isOk"`       // 是否成功
+	StatusCode uint32 `field:"statusCode"` // HTTP状态码
+	Error      string `field:"error"`      // 错误信息
+	Response   string `field:"response"`   // 响应信息
+	CostMs     uint32 `field:"costMs"`     // 耗时（毫秒）
+	CreatedAt  uint64 `field:"createdAt"`  // 创建时间
+	Day        string `field:"day"`        // YYYYMMDD
+}
+
+type WebhookDeliveryAttemptOperator struct {
+	Id         interface{} // ID
+	DeliveryId interface{} // 投递ID
+	WebhookId  interface{} // Webhook ID
+	IsManual   interface{} // 是否为手动重新投递
+	IsOk       interface{} // 是否成功
+	StatusCode interface{} // HTTP状态码
+	Error      interface{} // 错误信息
+	Response   interface{} // 响应信息
+	CostMs     interface{} // 耗时（毫秒）
+	CreatedAt  interface{} // 创建时间
+	Day        interface{} // YYYYMMDD
+}
+
+func NewWebhookDeliveryAttemptOperator() *WebhookDeliveryAttemptOperator {
+	return &WebhookDeliveryAttemptOperator{}
+}
@@ -0,0 +1,304 @@
+package models
+
+import (
+	"bytes"
+	"crypto/tls"
+	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwind/TeaGo/Tea"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/rands"
+	"github.com/iwind/TeaGo/types"
+	timeutil "github.com/iwind/TeaGo/utils/time"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type WebhookDeliveryStatus = uint8
+
+const (
+	WebhookDeliveryStatusPending WebhookDeliveryStatus = 0 // 等待投递，包括等待重试
+	WebhookDeliveryStatusSuccess WebhookDeliveryStatus = 1 // 投递成功
+	WebhookDeliveryStatusFailed  WebhookDeliveryStatus = 2 // 多次重试后仍然失败
+)
+
+const (
+	WebhookDeliveryMaxAttempts = 8                // 最多尝试次数
+	WebhookDeliveryTimeout     = 10 * time.Second // 单次投递超时时间
+)
+
+type WebhookDeliveryDAO dbs.DAO
+
+func init() {
+	dbs.OnReadyDone(func() {
+		// 清理数据任务
+		var ticker = time.NewTicker(time.Duration(rands.Int(24, 48)) * time.Hour)
+		go func() {
+			for range ticker.C {
+				err := SharedWebhookDeliveryDAO.CleanExpiredDeliveries(nil, 30) // 只保留30天
+				if err != nil {
+					remotelogs.Error("SharedWebhookDeliveryDAO", "clean expired data failed: "+err.Error())
+				}
+			}
+		}()
+	})
+}
+
+func NewWebhookDeliveryDAO() *WebhookDeliveryDAO {
+	return dbs.NewDAO(&WebhookDeliveryDAO{
+		DAOObject: dbs.DAOObject{
+			DB:     Tea.Env,
+			Table:  "edgeWebhookDeliveries",
+			Model:  new(WebhookDelivery),
+			PkName: "id",
+		},
+	}).(*WebhookDeliveryDAO)
+}
+
+var SharedWebhookDeliveryDAO *WebhookDeliveryDAO
+
+var webhookHTTPClient *http.Client
+var webhookHTTPClientOnce = sync.Once{}
+
+func init() {
+	dbs.OnReady(func() {
+		SharedWebhookDeliveryDAO = NewWebhookDeliveryDAO()
+	})
+}
+
+// CreateDelivery 创建投递
+func (this *WebhookDeliveryDAO) CreateDelivery(tx *dbs.Tx, webhookId int64, eventId string, eventType string, payload []byte) (int64, error) {
+	op := NewWebhookDeliveryOperator()
+	op.WebhookId = webhookId
+	op.EventId = eventId
+	op.EventType = eventType
+	op.Payload = string(payload)
+	op.Status = WebhookDeliveryStatusPending
+	op.CountAttempts = 0
+	op.NextAttemptAt = time.Now().Unix()
+	op.Day = timeutil.Format("Ymd")
+	return this.SaveInt64(tx, op)
+}
+
+// FindDelivery 查找投递
+func (this *WebhookDeliveryDAO) FindDelivery(tx *dbs.Tx, deliveryId int64) (*WebhookDelivery, error) {
+	one, err := this.Query(tx).
+		Pk(deliveryId).
+		Find()
+	if one == nil || err != nil {
+		return nil, err
+	}
+	return one.(*WebhookDelivery), nil
+}
+
+// FindDueDeliveries 查找需要投递的任务
+func (this *WebhookDeliveryDAO) FindDueDeliveries(tx *dbs.Tx, size int64) (result []*WebhookDelivery, err error) {
+	_, err = this.Query(tx).
+		Attr("status", WebhookDeliveryStatusPending).
+		Lte("nextAttemptAt", time.Now().Unix()).
+		AscPk().
+		Limit(size).
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// CountDeliveries 计算投递数量
+// status 小于0时表示所有状态
+func (this *WebhookDeliveryDAO) CountDeliveries(tx *dbs.Tx, webhookId int64, status int) (int64, error) {
+	var query = this.Query(tx)
+	if webhookId > 0 {
+		query.Attr("webhookId", webhookId)
+	}
+	if status >= 0 {
+		query.Attr("status", status)
+	}
+	return query.Count()
+}
+
+// ListDeliveries 列出单页投递
+func (this *WebhookDeliveryDAO) ListDeliveries(tx *dbs.Tx, webhookId int64, status int, offset int64, size int64) (result []*WebhookDelivery, err error) {
+	var query = this.Query(tx)
+	if webhookId > 0 {
+		query.Attr("webhookId", webhookId)
+	}
+	if status >= 0 {
+		query.Attr("status", status)
+	}
+	_, err = query.
+		Offset(offset).
+		Limit(size).
+		DescPk().
+		Slice(&result).
+		FindAll()
+	return
+}
+
+// Deliver 执行一次投递，并记录此次尝试
+// isManual 为手动重新投递，手动投递不计入自动重试次数，成功后投递状态会改为成功
+func (this *WebhookDeliveryDAO) Deliver(tx *dbs.Tx, delivery *WebhookDelivery, isManual bool) (attempt *WebhookDeliveryAttempt, err error) {
+	if delivery == nil {
+		return nil, errors.New("delivery should not be nil")
+	}
+	var deliveryId = int64(delivery.Id)
+
+	webhook, err := SharedWebhookDAO.FindEnabledWebhook(tx, int64(delivery.WebhookId))
+	if err != nil {
+		return nil, err
+	}
+	if webhook == nil {
+		// 订阅已被删除，不再重试
+		err = this.updateDeliveryStatus(tx, deliveryId, WebhookDeliveryStatusFailed, int(delivery.CountAttempts), 0)
+		return nil, err
+	}
+
+	var startTime = time.Now()
+	statusCode, response, sendErr := this.send(webhook, delivery)
+	var costMs = time.Since(startTime).Milliseconds()
+
+	var isOk = sendErr == nil && statusCode >= 200 && statusCode < 300
+	var errMsg = ""
+	if sendErr != nil {
+		errMsg = sendErr.Error()
+	} else if !isOk {
+		errMsg = "unexpected status code '" + types.String(statusCode) + "'"
+	}
+
+	attemptId, err := SharedWebhookDeliveryAttemptDAO.CreateAttempt(tx, deliveryId, int64(webhook.Id), isManual, isOk, statusCode, errMsg, response, costMs)
+	if err != nil {
+		return nil, err
+	}
+
+	// 修改投递状态
+	var countAttempts = int(delivery.CountAttempts)
+	if isOk {
+		if !isManual {
+			countAttempts++
+		}
+		err = this.updateDeliveryStatus(tx, deliveryId, WebhookDeliveryStatusSuccess, countAttempts, 0)
+	} else if !isManual {
+		countAttempts++
+		if countAttempts >= WebhookDeliveryMaxAttempts {
+			err = this.updateDeliveryStatus(tx, deliveryId, WebhookDeliveryStatusFailed, countAttempts, 0)
+		} else {
+			err = this.updateDeliveryStatus(tx, deliveryId, WebhookDeliveryStatusPending, countAttempts, time.Now().Unix()+WebhookRetryDelay(countAttempts))
+		}
+	} else {
+		_, err = this.Query(tx).
+			Pk(deliveryId).
+			Set("lastAttemptAt", time.Now().Unix()).
+			Update()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return SharedWebhookDeliveryAttemptDAO.FindAttempt(tx, attemptId)
+}
+
+// CleanExpiredDeliveries 清理
+func (this *WebhookDeliveryDAO) CleanExpiredDeliveries(tx *dbs.Tx, days int) error {
+	if days <= 0 {
+		days = 30
+	}
+	var day = timeutil.Format("Ymd", time.Now().AddDate(0, 0, -days))
+	_, err := this.Query(tx).
+		Where("(day IS NULL OR day<:day)").
+		Param("day", day).
+		Delete()
+	if err != nil {
+		return err
+	}
+	return SharedWebhookDeliveryAttemptDAO.CleanExpiredAttempts(tx, days)
+}
+
+// 发送请求
+func (this *WebhookDeliveryDAO) send(webhook *Webhook, delivery *WebhookDelivery) (statusCode int, response string, err error) {
+	// 创建之后域名解析结果可能发生变化，所以在连接时还会再次检查IP
+	_, err = parseWebhookURL(webhook.Url)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var payload = []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, webhook.Url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+
+	var timestamp = time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", teaconst.ProductName+"/"+teaconst.Version)
+	req.Header.Set("X-Edge-Event", delivery.EventType)
+	req.Header.Set("X-Edge-Event-Id", delivery.EventId)
+	req.Header.Set("X-Edge-Delivery", types.String(delivery.Id))
+	req.Header.Set("X-Edge-Timestamp", types.String(timestamp))
+	req.Header.Set("X-Edge-Signature", webhook.Sign(timestamp, payload))
+
+	resp, err := sharedWebhookHTTPClient().Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// 只记录响应的开头部分
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return resp.StatusCode, "", err
+	}
+	return resp.StatusCode, string(data), nil
+}
+
+// 获取投递使用的HTTP客户端
+// 在建立连接时检查实际连接的IP，包括重定向之后的地址，只允许连接公网IP
+func sharedWebhookHTTPClient() *http.Client {
+	webhookHTTPClientOnce.Do(func() {
+		var dialer = &net.Dialer{
+			Timeout: WebhookDeliveryTimeout,
+			Control: func(network string, address string, c syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if !utils.IsPublicIP(net.ParseIP(host)) {
+					return errors.New("webhook should not connect to non-public ip '" + host + "'")
+				}
+				return nil
+			},
+		}
+		webhookHTTPClient = &http.Client{
+			Timeout: WebhookDeliveryTimeout,
+			Transport: &http.Transport{
+				DialContext:           dialer.DialContext,
+				MaxIdleConns:          1024,
+				MaxIdleConnsPerHost:   8,
+				IdleConnTimeout:       2 * time.Minute,
+				ExpectContinueTimeout: 1 * time.Second,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true,
+				},
+			},
+		}
+	})
+	return webhookHTTPClient
+}
+
+func (this *WebhookDeliveryDAO) updateDeliveryStatus(tx *dbs.Tx, deliveryId int64, status WebhookDeliveryStatus, countAttempts int, nextAttemptAt int64) error {
+	op := NewWebhookDeliveryOperator()
+	op.Id = deliveryId
+	op.Status = status
+	op.CountAttempts = countAttempts
+	op.NextAttemptAt = nextAttemptAt
+	op.LastAttemptAt = time.Now().Unix()
+	return this.Save(tx, op)
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/iwind/TeaGo/bootstrap"
+	"github.com/iwind/TeaGo/dbs"
+	"testing"
+)
+
+func TestWebhookDeliveryDAO_FindDueDeliveries(t *testing.T) {
+	dbs.NotifyReady()
+
+	var tx *dbs.Tx
+	deliveries, err := SharedWebhookDeliveryDAO.FindDueDeliveries(tx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, delivery := range deliveries {
+		t.Log(delivery.Id, delivery.EventType, delivery.CountAttempts)
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	var delays = []int64{}
+	for i := 0; i <= WebhookDeliveryMaxAttempts; i++ {
+		delays = append(delays, WebhookRetryDelay(i))
+	}
+	t.Log(delays)
+	if delays[1] != 30 || delays[2] != 60 || delays[3] != 120 {
+		t.Fatal("invalid delays")
+	}
+	if WebhookRetryDelay(100) != 6*3600 {
+		t.Fatal("delay should not be greater than 6 hours")
+	}
+}
@@ -0,0 +1,34 @@
+package models
+
+// WebhookDelivery Webhook投递
+type WebhookDelivery struct {
+	Id            uint64 `field:"id"`            // ID
+	WebhookId     uint32 `field:"webhookId"`     // Webhook ID
+	EventId       string `field:"eventId"`       // 事件ID
+	EventType     string `field:"eventType"`     // 事件类型
+	Payload       string `field:"payload"`       // 发送的数据
+	Status        uint8  `field:"status"`        // 投递状态
+	CountAttempts uint32 `field:"countAttempts"` // 尝试次数
+	NextAttemptAt uint64 `field:"nextAttemptAt"` // 下次尝试时间
+	LastAttemptAt uint64 `field:"lastAttemptAt"` // 最后一次尝试时间
+	CreatedAt     uint64 `field:"createdAt"`     // 创建时间
+	Day           string `field:"day"`           // YYYYMMDD
+}
+
+type WebhookDeliveryOperator struct {
+	Id            interface{} // ID
+	WebhookId     interface{} // Webhook ID
+	EventId       interface{} // 事件ID
+	EventType     interface{} // 事件类型
+	Payload       interface{} // 发送的数据
+	Status        interface{} // 投递状态
+	CountAttempts interface{} // 尝试次数
+	NextAttemptAt interface{} // 下次尝试时间
+	LastAttemptAt interface{} // 最后一次尝试时间
+	CreatedAt     interface{} // 创建时间
+	Day           interface{} // YYYYMMDD
+}
+
+func NewWebhookDeliveryOperator() *WebhookDeliveryOperator {
+	return &WebhookDeliveryOperator{}
+}
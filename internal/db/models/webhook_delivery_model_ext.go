@@ -0,0 +1,17 @@
+package models
+
+// WebhookRetryDelay 第N次失败后等待重试的时间（秒）
+// 从30秒开始每次翻倍，最多等待6小时
+func WebhookRetryDelay(countAttempts int) int64 {
+	if countAttempts <= 0 {
+		return 0
+	}
+	var delay int64 = 30
+	for i := 1; i < countAttempts; i++ {
+		delay *= 2
+		if delay >= 6*3600 {
+			return 6 * 3600
+		}
+	}
+	return delay
+}
@@ -0,0 +1,73 @@
+package models
+
+import "github.com/iwind/TeaGo/maps"
+
+type WebhookEventType = string
+
+// Webhook事件类型
+const (
+	WebhookEventTypeServerCreated           WebhookEventType = "server.created"           // 服务已创建
+	WebhookEventTypeNodeOffline             WebhookEventType = "node.offline"             // 边缘节点离线
+	WebhookEventTypeNodeOnline              WebhookEventType = "node.online"              // 边缘节点上线
+	WebhookEventTypeCertRenewed             WebhookEventType = "cert.renewed"             // 证书已自动续期
+	WebhookEventTypeCertRenewFailed         WebhookEventType = "cert.renewFailed"         // 证书自动续期失败
+	WebhookEventTypeDNSTaskFailed           WebhookEventType = "dns.taskFailed"           // DNS同步任务失败
+	WebhookEventTypeAccessLogExportFinished WebhookEventType = "accessLogExport.finished" // 访问日志导出任务结束
+	WebhookEventTypePing                    WebhookEventType = "ping"                     // 测试事件
+)
+
+// FindAllWebhookEventTypes 所有事件类型
+func FindAllWebhookEventTypes() []maps.Map {
+	return []maps.Map{
+		{
+			"name":        "服务已创建",
+			"code":        WebhookEventTypeServerCreated,
+			"description": "新的服务被管理员或用户创建。",
+		},
+		{
+			"name":        "边缘节点离线",
+			"code":        WebhookEventTypeNodeOffline,
+			"description": "边缘节点长时间没有上报状态，被系统认为已离线。",
+		},
+		{
+			"name":        "边缘节点上线",
+			"code":        WebhookEventTypeNodeOnline,
+			"description": "离线的边缘节点重新连接到API节点。",
+		},
+		{
+			"name":        "证书已续期",
+			"code":        WebhookEventTypeCertRenewed,
+			"description": "通过ACME任务自动续期证书成功。",
+		},
+		{
+			"name":        "证书续期失败",
+			"code":        WebhookEventTypeCertRenewFailed,
+			"description": "通过ACME任务自动续期证书时发生错误。",
+		},
+		{
+			"name":        "DNS任务失败",
+			"code":        WebhookEventTypeDNSTaskFailed,
+			"description": "同步集群、节点或服务的DNS记录时发生错误。",
+		},
+		{
+			"name":        "访问日志导出结束",
+			"code":        WebhookEventTypeAccessLogExportFinished,
+			"description": "访问日志导出任务执行成功或失败。",
+		},
+		{
+			"name":        "测试",
+			"code":        WebhookEventTypePing,
+			"description": "通过API手动发送的测试事件，总会发送给对应的订阅。",
+		},
+	}
+}
+
+// IsValidWebhookEventType 检查事件类型是否有效
+func IsValidWebhookEventType(eventType string) bool {
+	for _, m := range FindAllWebhookEventTypes() {
+		if m.GetString("code") == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package models
+
+// Webhook Webhook订阅
+type Webhook struct {
+	Id         uint32 `field:"id"`         // ID
+	AdminId    uint32 `field:"adminId"`    // 管理员ID
+	Name       string `field:"name"`       // 名称
+	Url        string `field:"url"`        // 接收地址
+	Secret     string `field:"secret"`     // 签名密钥
+	EventTypes string `field:"eventTypes"` // 订阅的事件类型
+	IsOn       uint8  `field:"isOn"`       // 是否启用
+	CreatedAt  uint64 `field:"createdAt"`  // 创建时间
+	State      uint8  `field:"state"`      // 状态
+}
+
+type WebhookOperator struct {
+	Id         interface{} // ID
+	AdminId    interface{} // 管理员ID
+	Name       interface{} // 名称
+	Url        interface{} // 接收地址
+	Secret     interface{} // 签名密钥
+	EventTypes interface{} // 订阅的事件类型
+	IsOn       interface{} // 是否启用
+	CreatedAt  interface{} // 创建时间
+	State      interface{} // 状态
+}
+
+func NewWebhookOperator() *WebhookOperator {
+	return &WebhookOperator{}
+}
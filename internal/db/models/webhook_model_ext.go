@@ -0,0 +1,47 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/iwind/TeaGo/lists"
+	"github.com/iwind/TeaGo/logs"
+	"strconv"
+)
+
+// DecodeEventTypes 解析订阅的事件类型
+func (this *Webhook) DecodeEventTypes() []string {
+	var result = []string{}
+	if !IsNotNull(this.EventTypes) {
+		return result
+	}
+	err := json.Unmarshal([]byte(this.EventTypes), &result)
+	if err != nil {
+		logs.Println("Webhook.DecodeEventTypes(): " + err.Error())
+		// 不阻断执行
+	}
+	return result
+}
+
+// MatchEvent 检查是否订阅了某个事件，没有设置事件类型表示订阅所有事件
+func (this *Webhook) MatchEvent(eventType string) bool {
+	if eventType == WebhookEventTypePing {
+		return true
+	}
+	var eventTypes = this.DecodeEventTypes()
+	if len(eventTypes) == 0 {
+		return true
+	}
+	return lists.ContainsString(eventTypes, eventType)
+}
+
+// Sign 计算签名
+// 签名内容为 时间戳 + "." + 请求体，使用HMAC-SHA256算法，接收方应该同时检查时间戳防止重放
+func (this *Webhook) Sign(timestamp int64, payload []byte) string {
+	var h = hmac.New(sha256.New, []byte(this.Secret))
+	h.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	h.Write([]byte("."))
+	h.Write(payload)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
@@ -3,6 +3,7 @@ package dnsclients
 import (
 	"errors"
 	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients/dnstypes"
+	"github.com/TeaOSLab/EdgeAPI/internal/tracing"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
 	"github.com/aliyun/alibaba-cloud-sdk-go/services/alidns"
@@ -200,6 +201,7 @@ func (this *AliDNSProvider) doAPI(req requests.AcsRequest, resp responses.AcsRes
 	if err != nil {
 		return err
 	}
+	client.SetTransport(tracing.NewHTTPTransport(nil, "alidns"))
 	err = client.DoAction(req, resp)
 	if err != nil {
 		return err
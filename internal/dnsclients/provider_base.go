@@ -1,4 +1,21 @@
 package dnsclients
 
+import "context"
+
 type BaseProvider struct {
+	ctx context.Context
+}
+
+// SetContext 设置调用上下文
+// 对外请求使用此上下文，从而使链路追踪中的请求跨度成为RPC调用跨度的子跨度
+func (this *BaseProvider) SetContext(ctx context.Context) {
+	this.ctx = ctx
+}
+
+// Context 获取调用上下文
+func (this *BaseProvider) Context() context.Context {
+	if this.ctx == nil {
+		return context.Background()
+	}
+	return this.ctx
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients/cloudflare"
 	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients/dnstypes"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/tracing"
 	"github.com/iwind/TeaGo/maps"
 	"github.com/iwind/TeaGo/types"
 	"io"
@@ -26,11 +27,11 @@ const CloudFlareDefaultRoute = "default"
 
 var cloudFlareHTTPClient = &http.Client{
 	Timeout: 10 * time.Second,
-	Transport: &http.Transport{
+	Transport: tracing.NewHTTPTransport(&http.Transport{
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: true,
 		},
-	},
+	}, "cloudFlare"),
 }
 
 type CloudFlareProvider struct {
@@ -253,7 +254,7 @@ func (this *CloudFlareProvider) doAPI(method string, apiPath string, args map[st
 		bodyReader = bytes.NewReader(bodyData)
 	}
 
-	req, err := http.NewRequest(method, apiURL, bodyReader)
+	req, err := http.NewRequestWithContext(this.Context(), method, apiURL, bodyReader)
 	if err != nil {
 		return err
 	}
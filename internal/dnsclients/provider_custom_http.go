@@ -9,6 +9,7 @@ import (
 	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
 	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients/dnstypes"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/tracing"
 	"github.com/iwind/TeaGo/maps"
 	"io/ioutil"
 	"net/http"
@@ -18,15 +19,17 @@ import (
 
 var customHTTPClient = &http.Client{
 	Timeout: 10 * time.Second,
-	Transport: &http.Transport{
+	Transport: tracing.NewHTTPTransport(&http.Transport{
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: true,
 		},
-	},
+	}, "customHTTP"),
 }
 
 // CustomHTTPProvider HTTP自定义DNS
 type CustomHTTPProvider struct {
+	BaseProvider
+
 	url    string
 	secret string
 }
@@ -158,7 +161,7 @@ func (this *CustomHTTPProvider) post(params maps.Map) (respData []byte, err erro
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodPost, this.url, bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(this.Context(), http.MethodPost, this.url, bytes.NewReader(data))
 	if err != nil {
 		return nil, err
 	}
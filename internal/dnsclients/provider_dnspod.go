@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients/dnstypes"
+	"github.com/TeaOSLab/EdgeAPI/internal/tracing"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils/numberutils"
 	"github.com/iwind/TeaGo/maps"
 	"github.com/iwind/TeaGo/types"
@@ -239,14 +240,16 @@ func (this *DNSPodProvider) post(path string, params map[string]string) (maps.Ma
 	for p, v := range params {
 		query[p] = []string{v}
 	}
-	req, err := http.NewRequest(http.MethodPost, apiHost+path, strings.NewReader(query.Encode()))
+	req, err := http.NewRequestWithContext(this.Context(), http.MethodPost, apiHost+path, strings.NewReader(query.Encode()))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("User-Agent", "GoEdge Client/1.0.0 (iwind.liu@gmail.com)")
 
-	client := http.Client{}
+	client := http.Client{
+		Transport: tracing.NewHTTPTransport(nil, "dnspod"),
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
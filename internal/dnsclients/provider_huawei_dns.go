@@ -12,6 +12,7 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients/dnstypes"
 	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients/huaweidns"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/tracing"
 	"github.com/iwind/TeaGo/maps"
 	"github.com/iwind/TeaGo/types"
 	"io"
@@ -28,11 +29,11 @@ const HuaweiDNSEndpoint = "https://dns.cn-north-1.myhuaweicloud.com/"
 
 var huaweiDNSHTTPClient = &http.Client{
 	Timeout: 10 * time.Second,
-	Transport: &http.Transport{
+	Transport: tracing.NewHTTPTransport(&http.Transport{
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: true,
 		},
-	},
+	}, "huaweiDNS"),
 }
 
 // HuaweiDNSProvider 华为云DNS
@@ -1460,7 +1461,7 @@ func (this *HuaweiDNSProvider) doAPI(method string, apiPath string, args map[str
 		bodyReader = bytes.NewReader(bodyData)
 	}
 
-	req, err := http.NewRequest(method, apiURL, bodyReader)
+	req, err := http.NewRequestWithContext(this.Context(), method, apiURL, bodyReader)
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package dnsclients
 
 import (
+	"context"
 	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients/dnstypes"
 	"github.com/iwind/TeaGo/maps"
 )
@@ -33,4 +34,7 @@ type ProviderInterface interface {
 
 	// DefaultRoute 默认线路
 	DefaultRoute() string
+
+	// SetContext 设置调用上下文
+	SetContext(ctx context.Context)
 }
@@ -15,6 +15,8 @@ import (
 )
 
 type LocalEdgeDNSProvider struct {
+	BaseProvider
+
 	clusterId int64 // 集群ID
 	ttl       int32 // TTL
 }
@@ -8,6 +8,7 @@ import (
 )
 
 type UserEdgeDNSProvider struct {
+	BaseProvider
 }
 
 // Auth 认证
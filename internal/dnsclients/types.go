@@ -1,6 +1,7 @@
 package dnsclients
 
 import (
+	"context"
 	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
 	"github.com/iwind/TeaGo/maps"
 )
@@ -94,6 +95,15 @@ func FindProvider(providerType ProviderType) ProviderInterface {
 	return nil
 }
 
+// FindProviderWithContext 查找服务商实例，对外请求使用调用上下文
+func FindProviderWithContext(ctx context.Context, providerType ProviderType) ProviderInterface {
+	var provider = FindProvider(providerType)
+	if provider != nil {
+		provider.SetContext(ctx)
+	}
+	return provider
+}
+
 // FindProviderTypeName 查找服务商名称
 func FindProviderTypeName(providerType ProviderType) string {
 	for _, t := range FindAllProviderTypes() {
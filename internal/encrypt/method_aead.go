@@ -0,0 +1,112 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+// 带认证的加密方法使用的数据格式：
+// | 'EDGE' (4) | 版本 (1) | 方法代号 (1) | 随机数 (NonceSize) | 密文+认证标签 |
+// 每次加密都使用新的随机数；头部和iv会作为附加数据参与认证，任何修改都会导致解密失败
+const (
+	CiphertextVersion1 byte = 1
+
+	CiphertextMethodAES256GCM        byte = 1
+	CiphertextMethodChaCha20Poly1305 byte = 2
+)
+
+var ciphertextMagic = []byte("EDGE")
+var ciphertextHeaderSize = len(ciphertextMagic) + 2
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// 不同代号对应的方法名称
+var ciphertextMethodNames = map[byte]string{
+	CiphertextMethodAES256GCM:        "aes-256-gcm",
+	CiphertextMethodChaCha20Poly1305: "chacha20-poly1305",
+}
+
+// IsVersionedCiphertext 判断是否为带版本头部的密文
+func IsVersionedCiphertext(data []byte) bool {
+	return len(data) >= ciphertextHeaderSize &&
+		bytes.Equal(data[:len(ciphertextMagic)], ciphertextMagic) &&
+		data[len(ciphertextMagic)] == CiphertextVersion1
+}
+
+// FindCiphertextMethod 从带版本头部的密文中读取加密方法名称
+func FindCiphertextMethod(data []byte) (method string, ok bool) {
+	if !IsVersionedCiphertext(data) {
+		return "", false
+	}
+	method, ok = ciphertextMethodNames[data[len(ciphertextMagic)+1]]
+	return
+}
+
+// 带认证的加密方法的公共实现
+type aeadMethod struct {
+	methodCode byte
+	aead       cipher.AEAD
+	iv         []byte
+}
+
+func (this *aeadMethod) init(methodCode byte, aead cipher.AEAD, iv []byte) {
+	this.methodCode = methodCode
+	this.aead = aead
+	this.iv = append([]byte{}, iv...)
+}
+
+func (this *aeadMethod) Encrypt(src []byte) (dst []byte, err error) {
+	var nonceSize = this.aead.NonceSize()
+	dst = make([]byte, ciphertextHeaderSize+nonceSize, ciphertextHeaderSize+nonceSize+len(src)+this.aead.Overhead())
+	var header = this.header(dst)
+	var nonce = dst[ciphertextHeaderSize:]
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	dst = this.aead.Seal(dst, nonce, src, this.additionalData(header))
+	return dst, nil
+}
+
+func (this *aeadMethod) Decrypt(dst []byte) (src []byte, err error) {
+	var nonceSize = this.aead.NonceSize()
+	if len(dst) < ciphertextHeaderSize+nonceSize+this.aead.Overhead() || !IsVersionedCiphertext(dst) {
+		return nil, ErrInvalidCiphertext
+	}
+	if dst[len(ciphertextMagic)+1] != this.methodCode {
+		return nil, errors.New("ciphertext was not encrypted with '" + ciphertextMethodNames[this.methodCode] + "'")
+	}
+	var header = dst[:ciphertextHeaderSize]
+	var nonce = dst[ciphertextHeaderSize : ciphertextHeaderSize+nonceSize]
+	src, err = this.aead.Open(nil, nonce, dst[ciphertextHeaderSize+nonceSize:], this.additionalData(header))
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return src, nil
+}
+
+// 写入头部
+func (this *aeadMethod) header(dst []byte) []byte {
+	copy(dst, ciphertextMagic)
+	dst[len(ciphertextMagic)] = CiphertextVersion1
+	dst[len(ciphertextMagic)+1] = this.methodCode
+	return dst[:ciphertextHeaderSize]
+}
+
+func (this *aeadMethod) additionalData(header []byte) []byte {
+	var data = make([]byte, 0, len(header)+len(this.iv))
+	data = append(data, header...)
+	return append(data, this.iv...)
+}
+
+// 生成256位的密钥，长度刚好为32时直接使用，否则使用SHA256生成
+func aeadKey256(key []byte) []byte {
+	if len(key) == 32 {
+		return key
+	}
+	var sum = sha256.Sum256(key)
+	return sum[:]
+}
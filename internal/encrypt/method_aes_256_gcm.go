@@ -0,0 +1,25 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+// AES256GCMMethod AES-256-GCM加密，每次加密使用随机数，解密时校验数据完整性
+// iv不作为随机数使用，而是作为附加数据参与认证
+type AES256GCMMethod struct {
+	aeadMethod
+}
+
+func (this *AES256GCMMethod) Init(key, iv []byte) error {
+	block, err := aes.NewCipher(aeadKey256(key))
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	this.init(CiphertextMethodAES256GCM, aead, iv)
+	return nil
+}
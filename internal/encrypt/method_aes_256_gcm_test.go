@@ -0,0 +1,79 @@
+package encrypt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAES256GCMMethod_Encrypt(t *testing.T) {
+	method, err := NewMethodInstance("aes-256-gcm", "abc", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := []byte("Hello, World")
+	dst, err := method.Encrypt(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("dst:", dst)
+	if !IsVersionedCiphertext(dst) {
+		t.Fatal("should have versioned header")
+	}
+
+	// 每次加密使用不同的随机数
+	dst2, err := method.Encrypt(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(dst, dst2) {
+		t.Fatal("nonce should be different")
+	}
+
+	src2, err := method.Decrypt(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, src2) {
+		t.Fatal("decrypt failed:", string(src2))
+	}
+}
+
+func TestAES256GCMMethod_Tamper(t *testing.T) {
+	method, err := NewMethodInstance("aes-256-gcm", "abc", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := method.Encrypt([]byte("Hello, World"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < len(dst); i++ {
+		var tampered = append([]byte{}, dst...)
+		tampered[i] ^= 1
+		_, err = method.Decrypt(tampered)
+		if err == nil {
+			t.Fatal("tampered byte", i, "should fail")
+		}
+	}
+
+	// 截断
+	_, err = method.Decrypt(dst[:len(dst)-1])
+	if err == nil {
+		t.Fatal("truncated data should fail")
+	}
+	_, err = method.Decrypt(nil)
+	if err == nil {
+		t.Fatal("empty data should fail")
+	}
+
+	// 使用不同的iv
+	method2, err := NewMethodInstance("aes-256-gcm", "abc", "456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = method2.Decrypt(dst)
+	if err == nil {
+		t.Fatal("different iv should fail")
+	}
+}
@@ -0,0 +1,20 @@
+package encrypt
+
+import (
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ChaCha20Poly1305Method ChaCha20-Poly1305加密，适合没有AES硬件加速的环境
+// iv不作为随机数使用，而是作为附加数据参与认证
+type ChaCha20Poly1305Method struct {
+	aeadMethod
+}
+
+func (this *ChaCha20Poly1305Method) Init(key, iv []byte) error {
+	aead, err := chacha20poly1305.New(aeadKey256(key))
+	if err != nil {
+		return err
+	}
+	this.init(CiphertextMethodChaCha20Poly1305, aead, iv)
+	return nil
+}
@@ -0,0 +1,48 @@
+package encrypt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestChaCha20Poly1305Method_Encrypt(t *testing.T) {
+	method, err := NewMethodInstance("chacha20-poly1305", "abc", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := []byte("Hello, World")
+	dst, err := method.Encrypt(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("dst:", dst)
+
+	src2, err := method.Decrypt(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, src2) {
+		t.Fatal("decrypt failed:", string(src2))
+	}
+
+	// 篡改
+	dst[len(dst)-1] ^= 1
+	_, err = method.Decrypt(dst)
+	if err == nil {
+		t.Fatal("tampered data should fail")
+	}
+
+	// 不同方法之间不能混用
+	gcmMethod, err := NewMethodInstance("aes-256-gcm", "abc", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err = method.Encrypt(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = gcmMethod.Decrypt(dst)
+	if err == nil {
+		t.Fatal("should not decrypt with another method")
+	}
+}
@@ -0,0 +1,101 @@
+package encrypt
+
+import (
+	"errors"
+	"sync"
+)
+
+// MigrationMethod 从没有认证的加密方法（比如aes-256-cfb）迁移到带认证的加密方法
+// 加密时使用新方法；解密时如果数据带有版本头部，则使用头部中记录的方法，否则使用旧方法
+type MigrationMethod struct {
+	method       MethodInterface
+	legacyMethod MethodInterface
+
+	key []byte
+	iv  []byte
+
+	versionedMethods map[string]MethodInterface // method name => instance
+	locker           sync.Mutex
+}
+
+// NewMigrationMethodInstance 获取新对象
+func NewMigrationMethodInstance(method string, legacyMethod string, key string, iv string) (*MigrationMethod, error) {
+	methodInstance, err := NewMethodInstance(method, key, iv)
+	if err != nil {
+		return nil, err
+	}
+	legacyMethodInstance, err := NewMethodInstance(legacyMethod, key, iv)
+	if err != nil {
+		return nil, err
+	}
+	return &MigrationMethod{
+		method:       methodInstance,
+		legacyMethod: legacyMethodInstance,
+		key:          []byte(key),
+		iv:           []byte(iv),
+		versionedMethods: map[string]MethodInterface{
+			method: methodInstance,
+		},
+	}, nil
+}
+
+func (this *MigrationMethod) Init(key, iv []byte) error {
+	err := this.method.Init(key, iv)
+	if err != nil {
+		return err
+	}
+	err = this.legacyMethod.Init(key, iv)
+	if err != nil {
+		return err
+	}
+
+	this.locker.Lock()
+	this.key = key
+	this.iv = iv
+	for name, method := range this.versionedMethods {
+		if method != this.method {
+			delete(this.versionedMethods, name)
+		}
+	}
+	this.locker.Unlock()
+	return nil
+}
+
+func (this *MigrationMethod) Encrypt(src []byte) (dst []byte, err error) {
+	return this.method.Encrypt(src)
+}
+
+func (this *MigrationMethod) Decrypt(dst []byte) (src []byte, err error) {
+	if !IsVersionedCiphertext(dst) {
+		return this.legacyMethod.Decrypt(dst)
+	}
+	methodName, ok := FindCiphertextMethod(dst)
+	if !ok {
+		return nil, errors.New("unknown ciphertext method")
+	}
+	method, err := this.findVersionedMethod(methodName)
+	if err != nil {
+		return nil, err
+	}
+	return method.Decrypt(dst)
+}
+
+// NeedsMigration 判断数据是否还在使用旧方法加密
+func (this *MigrationMethod) NeedsMigration(data []byte) bool {
+	return len(data) > 0 && !IsVersionedCiphertext(data)
+}
+
+func (this *MigrationMethod) findVersionedMethod(methodName string) (MethodInterface, error) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	method, ok := this.versionedMethods[methodName]
+	if ok {
+		return method, nil
+	}
+	method, err := NewMethodInstance(methodName, string(this.key), string(this.iv))
+	if err != nil {
+		return nil, err
+	}
+	this.versionedMethods[methodName] = method
+	return method, nil
+}
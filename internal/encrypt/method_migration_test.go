@@ -0,0 +1,71 @@
+package encrypt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMigrationMethod_Decrypt(t *testing.T) {
+	legacyMethod, err := NewMethodInstance("aes-256-cfb", "abc", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chachaMethod, err := NewMethodInstance("chacha20-poly1305", "abc", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	method, err := NewMigrationMethodInstance("aes-256-gcm", "aes-256-cfb", "abc", "123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var src = []byte("Hello, World")
+
+	// 旧方法加密的数据
+	legacyDst, err := legacyMethod.Encrypt(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !method.NeedsMigration(legacyDst) {
+		t.Fatal("should need migration")
+	}
+	result, err := method.Decrypt(legacyDst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, src) {
+		t.Fatal("decrypt legacy data failed")
+	}
+
+	// 新方法加密的数据
+	dst, err := method.Encrypt(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method.NeedsMigration(dst) {
+		t.Fatal("should not need migration")
+	}
+	if name, _ := FindCiphertextMethod(dst); name != "aes-256-gcm" {
+		t.Fatal("invalid method:", name)
+	}
+	result, err = method.Decrypt(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, src) {
+		t.Fatal("decrypt failed")
+	}
+
+	// 其他带认证的方法加密的数据
+	chachaDst, err := chachaMethod.Encrypt(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = method.Decrypt(chachaDst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, src) {
+		t.Fatal("decrypt chacha20-poly1305 data failed")
+	}
+}
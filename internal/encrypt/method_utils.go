@@ -10,6 +10,9 @@ var methods = map[string]reflect.Type{
 	"aes-128-cfb": reflect.TypeOf(new(AES128CFBMethod)).Elem(),
 	"aes-192-cfb": reflect.TypeOf(new(AES192CFBMethod)).Elem(),
 	"aes-256-cfb": reflect.TypeOf(new(AES256CFBMethod)).Elem(),
+
+	"aes-256-gcm":       reflect.TypeOf(new(AES256GCMMethod)).Elem(),
+	"chacha20-poly1305": reflect.TypeOf(new(ChaCha20Poly1305Method)).Elem(),
 }
 
 func NewMethodInstance(method string, key string, iv string) (MethodInterface, error) {
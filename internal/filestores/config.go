@@ -0,0 +1,138 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package filestores
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils/objectstorage"
+	"regexp"
+	"strings"
+)
+
+// SettingCode 文件存储配置在系统设置中的代号
+const SettingCode = "fileStoreConfig"
+
+// StorageType 文件存储类型
+type StorageType = string
+
+const (
+	StorageTypeDB    StorageType = "db"    // 数据库分块，默认
+	StorageTypeLocal StorageType = "local" // 本地目录
+	StorageTypeS3    StorageType = "s3"    // S3兼容的对象存储
+)
+
+var hashReg = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Config 文件存储配置
+// 上传完成的文件按照内容的SHA256去重后保存在指定的存储中，修改配置只影响之后上传的文件；
+// 切换存储类型后，之前的存储设置需要保留，以便读取之前保存的文件
+type Config struct {
+	StorageType StorageType             `json:"storageType"` // 存储类型
+	Local       *LocalConfig            `json:"local"`       // 本地目录设置
+	S3          *objectstorage.S3Config `json:"s3"`          // S3设置
+}
+
+// NewConfig 获取新对象
+func NewConfig() *Config {
+	return &Config{
+		StorageType: StorageTypeDB,
+	}
+}
+
+// LocalConfig 本地目录设置
+// 有多个API节点时需要使用所有节点都能访问的共享目录（比如NFS），并设置 isShared 为 true，否则不允许使用
+type LocalConfig struct {
+	Dir      string `json:"dir"`      // 目录
+	IsShared bool   `json:"isShared"` // 是否为所有API节点都能访问的共享目录
+}
+
+// Init 校验并初始化
+func (this *Config) Init() error {
+	switch this.StorageType {
+	case "", StorageTypeDB:
+		this.StorageType = StorageTypeDB
+	case StorageTypeLocal:
+		if this.Local == nil || len(strings.TrimSpace(this.Local.Dir)) == 0 {
+			return errors.New("'local.dir' should not be empty")
+		}
+	case StorageTypeS3:
+		if this.S3 == nil {
+			return errors.New("'s3' should not be empty")
+		}
+		if len(this.S3.Endpoint) == 0 {
+			return errors.New("'s3.endpoint' should not be empty")
+		}
+		if len(this.S3.Bucket) == 0 {
+			return errors.New("'s3.bucket' should not be empty")
+		}
+		if len(this.S3.AccessKeyId) == 0 || len(this.S3.AccessKeySecret) == 0 {
+			return errors.New("'s3.accessKeyId' and 's3.accessKeySecret' should not be empty")
+		}
+	default:
+		return errors.New("invalid storage type '" + this.StorageType + "'")
+	}
+	return nil
+}
+
+// IsObjectStorage 是否保存在数据库之外的对象存储中
+func (this *Config) IsObjectStorage() bool {
+	return this.StorageType == StorageTypeLocal || this.StorageType == StorageTypeS3
+}
+
+// CheckAPINodes 检查存储是否可以在多个API节点中使用
+// 本地目录只有在共享时才能被多个API节点同时使用，否则其他节点无法读取文件
+func (this *Config) CheckAPINodes(countAPINodes int64) error {
+	if this.StorageType != StorageTypeLocal || countAPINodes <= 1 {
+		return nil
+	}
+	if this.Local != nil && this.Local.IsShared {
+		return nil
+	}
+	return errors.New("'local' storage can not be used with multiple API nodes unless 'local.dir' is a shared directory and 'local.isShared' is true")
+}
+
+// NewStorage 根据配置获取当前使用的对象存储，数据库存储时返回错误
+func (this *Config) NewStorage() (objectstorage.Storage, error) {
+	return this.NewStorageWithType(this.StorageType)
+}
+
+// StorageConfigJSON 某个存储类型的设置，用来判断设置是否有变化
+func (this *Config) StorageConfigJSON(storageType StorageType) []byte {
+	var section interface{}
+	switch storageType {
+	case StorageTypeLocal:
+		section = this.Local
+	case StorageTypeS3:
+		section = this.S3
+	}
+	data, _ := json.Marshal(section)
+	return data
+}
+
+// NewStorageWithType 根据某个存储类型的设置获取对象存储
+// 用来读取以前保存在其他存储中的文件，数据库存储时返回错误
+func (this *Config) NewStorageWithType(storageType StorageType) (objectstorage.Storage, error) {
+	switch storageType {
+	case StorageTypeLocal:
+		if this.Local == nil {
+			return nil, errors.New("'local' should not be empty")
+		}
+		return objectstorage.NewLocalStorage(this.Local.Dir), nil
+	case StorageTypeS3:
+		if this.S3 == nil {
+			return nil, errors.New("'s3' should not be empty")
+		}
+		return objectstorage.NewS3Storage(this.S3), nil
+	}
+	return nil, errors.New("storage type '" + storageType + "' is not an object storage")
+}
+
+// ObjectKey 根据内容的SHA256生成对象名
+// 使用前两个字符作为子目录，避免单个目录下文件过多
+func ObjectKey(hash string) (string, error) {
+	if !hashReg.MatchString(hash) {
+		return "", errors.New("invalid hash '" + hash + "'")
+	}
+	return "files/" + hash[:2] + "/" + hash, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package filestores
+
+import (
+	"testing"
+)
+
+func TestConfig_Init(t *testing.T) {
+	var config = &Config{}
+	err := config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.StorageType != StorageTypeDB || config.IsObjectStorage() {
+		t.Fatal("default storage type should be 'db'")
+	}
+
+	config = &Config{StorageType: StorageTypeLocal}
+	if config.Init() == nil {
+		t.Fatal("empty dir should be invalid")
+	}
+	config.Local = &LocalConfig{Dir: "/tmp/files"}
+	err = config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = config.NewStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestObjectKey(t *testing.T) {
+	key, err := ObjectKey("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "files/e3/e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Fatal("unexpected key:", key)
+	}
+
+	for _, hash := range []string{"", "../a", "E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855"} {
+		_, err = ObjectKey(hash)
+		if err == nil {
+			t.Fatal("hash '" + hash + "' should be invalid")
+		}
+	}
+}
+
+func TestConfig_CheckAPINodes(t *testing.T) {
+	var config = &Config{
+		StorageType: StorageTypeLocal,
+		Local:       &LocalConfig{Dir: "/tmp/files"},
+	}
+	if config.CheckAPINodes(1) != nil {
+		t.Fatal("local storage should be allowed with one API node")
+	}
+	if config.CheckAPINodes(2) == nil {
+		t.Fatal("local storage should not be allowed with multiple API nodes")
+	}
+	config.Local.IsShared = true
+	if config.CheckAPINodes(2) != nil {
+		t.Fatal("shared local storage should be allowed with multiple API nodes")
+	}
+}
+
+func TestConfig_NewStorageWithType(t *testing.T) {
+	// 切换到数据库存储后仍然可以读取以前保存在本地目录中的文件
+	var config = &Config{
+		StorageType: StorageTypeDB,
+		Local:       &LocalConfig{Dir: "/tmp/files"},
+	}
+	err := config.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = config.NewStorageWithType(StorageTypeLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = config.NewStorageWithType(StorageTypeS3)
+	if err == nil {
+		t.Fatal("s3 storage without settings should fail")
+	}
+	if len(config.StorageConfigJSON(StorageTypeLocal)) == 0 {
+		t.Fatal("local storage config should not be empty")
+	}
+}
@@ -8,4 +8,13 @@ type Credentials struct {
 	PrivateKey string
 	Passphrase string
 	Method     string
+
+	PinnedHostKeyType        string // 信任的主机密钥类型，不为空时只和主机协商此类型的密钥
+	PinnedHostKeyFingerprint string // 信任的主机密钥指纹，为空时接受任何密钥
+
+	HostKeyType        string // 登录时主机返回的密钥类型
+	HostKeyFingerprint string // 登录时主机返回的密钥指纹
+
+	JumpHosts    []*Credentials // 跳板机，按照顺序依次连接，最后一台跳板机连接目标主机
+	ForwardAgent bool           // 是否向目标主机转发认证代理，私钥只保存在内存中，不会写入跳板机和目标主机
 }
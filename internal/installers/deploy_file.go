@@ -4,6 +4,7 @@ package installers
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
@@ -15,6 +16,8 @@ type DeployFile struct {
 	Arch    string
 	Version string
 	Path    string
+
+	Package *DeployPackage // 安装包仓库中的安装包信息，没有启用签名校验时为nil
 }
 
 // Sum 计算概要
@@ -46,6 +49,36 @@ func (this *DeployFile) Sum() (string, error) {
 	return fmt.Sprintf("%x", sum), nil
 }
 
+// SHA256 计算文件的SHA256和尺寸
+func (this *DeployFile) SHA256() (sum string, size int64, err error) {
+	fp, err := os.Open(this.Path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	m := sha256.New()
+	size, err = io.Copy(m, fp)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprintf("%x", m.Sum(nil)), size, nil
+}
+
+// ReadDeployChunk 从安装包内容中读取一个片段数据，和 Read() 的片段尺寸一致
+func ReadDeployChunk(data []byte, offset int64) (chunk []byte, newOffset int64, err error) {
+	if offset < 0 || offset >= int64(len(data)) {
+		return nil, offset, io.EOF
+	}
+	var end = offset + 128*1024
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return data[offset:end], end, nil
+}
+
 // Read 读取一个片段数据
 func (this *DeployFile) Read(offset int64) (data []byte, newOffset int64, err error) {
 	fp, err := os.Open(this.Path)
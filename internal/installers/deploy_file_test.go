@@ -34,3 +34,19 @@ func TestDeployFile_Read(t *testing.T) {
 		offset = newOffset
 	}
 }
+
+func TestReadDeployChunk(t *testing.T) {
+	var data = make([]byte, 128*1024+10)
+	chunk, offset, err := ReadDeployChunk(data, 0)
+	if err != nil || len(chunk) != 128*1024 || offset != 128*1024 {
+		t.Fatal("invalid first chunk", len(chunk), offset, err)
+	}
+	chunk, offset, err = ReadDeployChunk(data, offset)
+	if err != nil || len(chunk) != 10 || offset != int64(len(data)) {
+		t.Fatal("invalid last chunk", len(chunk), offset, err)
+	}
+	_, _, err = ReadDeployChunk(data, offset)
+	if err != io.EOF {
+		t.Fatal("should be EOF")
+	}
+}
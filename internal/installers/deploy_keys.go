@@ -0,0 +1,135 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/iwind/TeaGo/Tea"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	EnvDeployKeys          = "EDGE_API_DEPLOY_KEYS"           // 环境变量，格式和部署公钥文件相同，多个公钥可以用逗号分隔
+	EnvDeployAllowUnsigned = "EDGE_API_DEPLOY_ALLOW_UNSIGNED" // 环境变量，设置为1时允许在没有部署公钥时使用未签名的安装包，不推荐
+	DeployKeysFile         = "deploy.keys"                    // 配置目录下的部署公钥文件
+)
+
+// AllowUnsignedDeployFiles 是否明确允许在没有部署公钥时使用未签名的安装包
+func AllowUnsignedDeployFiles() bool {
+	return os.Getenv(EnvDeployAllowUnsigned) == "1"
+}
+
+var deployKeyIdReg = regexp.MustCompile(`^[\w-]+$`)
+
+// DeployKeyring 用来校验安装包签名的公钥集合
+type DeployKeyring struct {
+	keys map[string]ed25519.PublicKey // keyId => public key
+}
+
+// ParseDeployKeyring 分析部署公钥，每行（或者用逗号分隔）一个公钥，格式为 ID:BASE64公钥
+// 空行和以#开头的行会被忽略
+func ParseDeployKeyring(data string) (*DeployKeyring, error) {
+	var keyring = &DeployKeyring{
+		keys: map[string]ed25519.PublicKey{},
+	}
+	var lines = strings.FieldsFunc(data, func(r rune) bool {
+		return r == '\n' || r == ','
+	})
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var index = strings.Index(line, ":")
+		if index <= 0 {
+			return nil, errors.New("invalid deploy key line, should be 'ID:BASE64_PUBLIC_KEY'")
+		}
+		var keyId = line[:index]
+		if !deployKeyIdReg.MatchString(keyId) {
+			return nil, errors.New("invalid deploy key id '" + keyId + "'")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line[index+1:]))
+		if err != nil {
+			return nil, errors.New("decode deploy key '" + keyId + "' failed: " + err.Error())
+		}
+		if len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("deploy key '" + keyId + "' should be an ed25519 public key")
+		}
+		_, ok := keyring.keys[keyId]
+		if ok {
+			return nil, errors.New("duplicate deploy key id '" + keyId + "'")
+		}
+		keyring.keys[keyId] = key
+	}
+	return keyring, nil
+}
+
+// LoadDeployKeyring 从环境变量或者部署公钥文件中加载公钥
+// 都没有设置时返回空的公钥集合
+func LoadDeployKeyring() (*DeployKeyring, error) {
+	var data = os.Getenv(EnvDeployKeys)
+	if len(data) > 0 {
+		return ParseDeployKeyring(data)
+	}
+
+	fileData, err := ioutil.ReadFile(Tea.ConfigFile(DeployKeysFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ParseDeployKeyring("")
+		}
+		return nil, err
+	}
+	return ParseDeployKeyring(string(fileData))
+}
+
+// GenerateDeployKey 生成新的签名密钥
+// publicLine 可以直接写入部署公钥文件，privateKey 为BASE64编码的私钥，需要离线保存
+func GenerateDeployKey(keyId string) (publicLine string, privateKey string, err error) {
+	if !deployKeyIdReg.MatchString(keyId) {
+		return "", "", errors.New("invalid deploy key id '" + keyId + "'")
+	}
+	publicKey, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return keyId + ":" + base64.StdEncoding.EncodeToString(publicKey), base64.StdEncoding.EncodeToString(key), nil
+}
+
+// IsEmpty 是否没有任何公钥
+func (this *DeployKeyring) IsEmpty() bool {
+	return len(this.keys) == 0
+}
+
+// Verify 校验签名
+func (this *DeployKeyring) Verify(keyId string, message []byte, signature string) error {
+	key, ok := this.keys[keyId]
+	if !ok {
+		return errors.New("unknown deploy key '" + keyId + "'")
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.New("decode signature failed: " + err.Error())
+	}
+	if !ed25519.Verify(key, message, signatureBytes) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// SignDeployMessage 使用BASE64编码的私钥签名，返回BASE64编码的签名
+func SignDeployMessage(privateKey string, message []byte) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(privateKey))
+	if err != nil {
+		return "", errors.New("decode private key failed: " + err.Error())
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return "", errors.New("invalid ed25519 private key")
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, message)), nil
+}
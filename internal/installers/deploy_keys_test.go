@@ -0,0 +1,176 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDeployKeyring_Verify(t *testing.T) {
+	publicLine, privateKey, err := GenerateDeployKey("release-2021")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := ParseDeployKeyring("# release keys\n" + publicLine + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyring.IsEmpty() {
+		t.Fatal("keyring should not be empty")
+	}
+
+	var message = DeployPackageSignMessage("node", "linux", "amd64", "0.3.0", "abc", 1024)
+	signature, err := SignDeployMessage(privateKey, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = keyring.Verify("release-2021", message, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改版本
+	err = keyring.Verify("release-2021", DeployPackageSignMessage("node", "linux", "amd64", "0.3.1", "abc", 1024), signature)
+	if err == nil {
+		t.Fatal("should fail on changed version")
+	}
+
+	// 未知的密钥
+	err = keyring.Verify("release-2020", message, signature)
+	if err == nil {
+		t.Fatal("should fail on unknown key")
+	}
+}
+
+func TestParseDeployKeyring_Invalid(t *testing.T) {
+	for _, data := range []string{"abc", "a b:AAAA", "a:!!!", "a:AAAA"} {
+		_, err := ParseDeployKeyring(data)
+		if err == nil {
+			t.Fatal("'" + data + "' should be invalid")
+		}
+	}
+}
+
+func TestDeployManager_ImportPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	publicLine, privateKey, err := GenerateDeployKey("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Setenv(EnvDeployKeys, publicLine)
+	defer func() {
+		_ = os.Unsetenv(EnvDeployKeys)
+	}()
+
+	var data = []byte("edge-node package")
+	var manager = &DeployManager{dir: dir}
+	sum, size, err := (&DeployFile{Path: writeTempFile(t, dir, data)}).SHA256()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 签名错误
+	signature, err := SignDeployMessage(privateKey, DeployPackageSignMessage("node", "linux", "amd64", "0.3.1", sum, size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = manager.ImportPackage("node", "linux", "amd64", "0.3.0", bytes.NewReader(data), "test", signature)
+	if err == nil {
+		t.Fatal("should fail on invalid signature")
+	}
+	if manager.FindNodeFile("linux", "amd64") != nil {
+		t.Fatal("unsigned package should not be found")
+	}
+
+	// 签名正确
+	signature, err = SignDeployMessage(privateKey, DeployPackageSignMessage("node", "linux", "amd64", "0.3.0", sum, size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = manager.ImportPackage("node", "linux", "amd64", "0.3.0", bytes.NewReader(data), "test", signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file = manager.FindNodeFile("linux", "amd64")
+	if file == nil || file.Version != "0.3.0" {
+		t.Fatal("can not find imported package")
+	}
+	if manager.FindNodeFileWithRange("linux", "amd64", "<0.3.0") != nil {
+		t.Fatal("should not find package out of version range")
+	}
+	if manager.FindNSNodeFile("linux", "amd64") != nil {
+		t.Fatal("should not find package of other role")
+	}
+	err = manager.VerifyFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiedData, verifiedSum, err := manager.ReadVerifiedFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(verifiedData) != string(data) || verifiedSum != sum {
+		t.Fatal("verified data or sum mismatch")
+	}
+
+	// 文件内容被修改
+	err = ioutil.WriteFile(file.Path, []byte("edge-node package!"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager.VerifyFile(file) == nil {
+		t.Fatal("should fail on changed file")
+	}
+	_, _, err = manager.ReadVerifiedFile(file)
+	if err == nil {
+		t.Fatal("should fail on changed file")
+	}
+}
+
+func TestDeployManager_VerifyFile_Unsigned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	_ = os.Unsetenv(EnvDeployKeys)
+	var manager = &DeployManager{dir: dir}
+	var file = &DeployFile{Path: writeTempFile(t, dir, []byte("edge-node package"))}
+
+	// 没有部署公钥时默认拒绝
+	if manager.VerifyFile(file) == nil {
+		t.Fatal("unsigned package should be refused")
+	}
+
+	// 明确允许未签名的安装包
+	_ = os.Setenv(EnvDeployAllowUnsigned, "1")
+	defer func() {
+		_ = os.Unsetenv(EnvDeployAllowUnsigned)
+	}()
+	err = manager.VerifyFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTempFile(t *testing.T, dir string, data []byte) string {
+	var path = dir + "/package.tmp"
+	err := ioutil.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -1,96 +1,356 @@
 package installers
 
 import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/1uLang/EdgeCommon/pkg/nodeconfigs"
 	"github.com/iwind/TeaGo/Tea"
 	"github.com/iwind/TeaGo/files"
+	"github.com/iwind/TeaGo/logs"
 	stringutil "github.com/iwind/TeaGo/utils/string"
+	"io"
+	"io/ioutil"
+	"os"
 	"regexp"
+	"sync"
+	"time"
 )
 
 var SharedDeployManager = NewDeployManager()
 
+var deployPlatformReg = regexp.MustCompile(`^\w+$`)
+
+// 最多缓存的已校验安装包数量
+const deployMaxVerifiedFiles = 4
+
 type DeployManager struct {
-	dir string
+	dir    string
+	locker sync.Mutex
+
+	verifiedFiles  map[string]*verifiedDeployFile // key => file
+	verifiedLocker sync.Mutex
+}
+
+// 已经校验过的安装包内容
+type verifiedDeployFile struct {
+	data   []byte
+	sha256 string
 }
 
 // NewDeployManager 节点部署文件管理器
+// 只使用安装包清单中签名有效的安装包；没有配置部署公钥时，只有明确设置了 EDGE_API_DEPLOY_ALLOW_UNSIGNED=1 才会直接扫描部署目录
 func NewDeployManager() *DeployManager {
 	return &DeployManager{
-		dir: Tea.Root + "/deploy",
+		dir:           Tea.Root + "/deploy",
+		verifiedFiles: map[string]*verifiedDeployFile{},
 	}
 }
 
 // LoadNodeFiles 加载所有边缘节点文件
 func (this *DeployManager) LoadNodeFiles() []*DeployFile {
-	keyMap := map[string]*DeployFile{} // key => File
+	return this.LoadNodeFilesWithRange("")
+}
 
-	reg := regexp.MustCompile(`^edge-node-(\w+)-(\w+)-v([0-9.]+)\.zip$`)
-	for _, file := range files.NewFile(this.dir).List() {
-		name := file.Name()
-		if !reg.MatchString(name) {
-			continue
-		}
-		matches := reg.FindStringSubmatch(name)
-		osName := matches[1]
-		arch := matches[2]
-		version := matches[3]
+// LoadNodeFilesWithRange 加载每个平台在版本范围内的最新边缘节点文件
+func (this *DeployManager) LoadNodeFilesWithRange(versionRange string) []*DeployFile {
+	return this.latestFiles(this.loadFiles(nodeconfigs.NodeRoleNode), versionRange)
+}
 
-		key := osName + "_" + arch
-		oldFile, ok := keyMap[key]
-		if ok && stringutil.VersionCompare(oldFile.Version, version) > 0 {
-			continue
+// FindNodeFile 查找特别平台的节点文件
+func (this *DeployManager) FindNodeFile(os string, arch string) *DeployFile {
+	return this.FindNodeFileWithRange(os, arch, "")
+}
+
+// FindNodeFileWithRange 查找特别平台在版本范围内的最新节点文件
+func (this *DeployManager) FindNodeFileWithRange(os string, arch string, versionRange string) *DeployFile {
+	return this.findFile(this.loadFiles(nodeconfigs.NodeRoleNode), os, arch, versionRange)
+}
+
+// LoadNSNodeFiles 加载所有NS节点安装文件
+func (this *DeployManager) LoadNSNodeFiles() []*DeployFile {
+	return this.LoadNSNodeFilesWithRange("")
+}
+
+// LoadNSNodeFilesWithRange 加载每个平台在版本范围内的最新NS节点安装文件
+func (this *DeployManager) LoadNSNodeFilesWithRange(versionRange string) []*DeployFile {
+	return this.latestFiles(this.loadFiles(nodeconfigs.NodeRoleDNS), versionRange)
+}
+
+// FindNSNodeFile 查找特别平台的NS节点安装文件
+func (this *DeployManager) FindNSNodeFile(os string, arch string) *DeployFile {
+	return this.FindNSNodeFileWithRange(os, arch, "")
+}
+
+// FindNSNodeFileWithRange 查找特别平台在版本范围内的最新NS节点安装文件
+func (this *DeployManager) FindNSNodeFileWithRange(os string, arch string, versionRange string) *DeployFile {
+	return this.findFile(this.loadFiles(nodeconfigs.NodeRoleDNS), os, arch, versionRange)
+}
+
+// VerifyFile 在上传到远程主机之前校验安装包
+// 安装包必须在清单中，而且内容和签名都要有效；没有配置部署公钥时，只有明确允许才不校验
+func (this *DeployManager) VerifyFile(file *DeployFile) error {
+	if file == nil {
+		return errors.New("deploy file should not be nil")
+	}
+	sum, size, err := file.SHA256()
+	if err != nil {
+		return err
+	}
+	return this.verifySum(file, sum, size)
+}
+
+// ReadVerifiedFile 读取并校验安装包，返回校验过的内容和SHA256
+// 内容只读取一次并在内存中校验，之后分段下载时使用同一份内容，防止校验之后文件被替换
+func (this *DeployManager) ReadVerifiedFile(file *DeployFile) (data []byte, sum string, err error) {
+	if file == nil {
+		return nil, "", errors.New("deploy file should not be nil")
+	}
+	stat, err := os.Stat(file.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	var key = file.Path + "@" + fmt.Sprintf("%d-%d", stat.Size(), stat.ModTime().UnixNano())
+	if file.Package != nil {
+		key += "@" + file.Package.SHA256
+	}
+
+	this.verifiedLocker.Lock()
+	verifiedFile, ok := this.verifiedFiles[key]
+	this.verifiedLocker.Unlock()
+	if ok {
+		return verifiedFile.data, verifiedFile.sha256, nil
+	}
+
+	data, err = ioutil.ReadFile(file.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	sum = fmt.Sprintf("%x", sha256.Sum256(data))
+	err = this.verifySum(file, sum, int64(len(data)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	this.verifiedLocker.Lock()
+	if this.verifiedFiles == nil || len(this.verifiedFiles) >= deployMaxVerifiedFiles {
+		this.verifiedFiles = map[string]*verifiedDeployFile{}
+	}
+	this.verifiedFiles[key] = &verifiedDeployFile{
+		data:   data,
+		sha256: sum,
+	}
+	this.verifiedLocker.Unlock()
+	return data, sum, nil
+}
+
+// 使用安装包内容的SHA256和尺寸校验
+func (this *DeployManager) verifySum(file *DeployFile, sum string, size int64) error {
+	keyring, err := LoadDeployKeyring()
+	if err != nil {
+		return errors.New("load deploy keys failed: " + err.Error())
+	}
+	if keyring.IsEmpty() {
+		if AllowUnsignedDeployFiles() {
+			logs.Println("[DEPLOY]WARNING: use unsigned package '" + file.Path + "' because '" + EnvDeployAllowUnsigned + "' is set")
+			return nil
 		}
-		keyMap[key] = &DeployFile{
-			OS:      osName,
-			Arch:    arch,
-			Version: version,
-			Path:    file.Path(),
+		return errors.New("no deploy key found, please add public keys to '" + DeployKeysFile + "', or set '" + EnvDeployAllowUnsigned + "=1' to allow unsigned packages")
+	}
+
+	var pkg = file.Package
+	if pkg == nil {
+		return errors.New("'" + file.Path + "' is not in the signed package manifest")
+	}
+	err = keyring.Verify(pkg.KeyId, pkg.SignMessage(), pkg.Signature)
+	if err != nil {
+		return errors.New("verify '" + pkg.Filename + "' failed: " + err.Error())
+	}
+	if size != pkg.Size || sum != pkg.SHA256 {
+		return errors.New("verify '" + pkg.Filename + "' failed: file content has been changed")
+	}
+	return nil
+}
+
+// ImportPackage 导入已签名的安装包到安装包仓库
+// 签名无效时不会写入部署目录
+func (this *DeployManager) ImportPackage(role nodeconfigs.NodeRole, osName string, arch string, version string, reader io.Reader, keyId string, signature string) (*DeployPackage, error) {
+	if role != nodeconfigs.NodeRoleNode && role != nodeconfigs.NodeRoleDNS {
+		return nil, errors.New("invalid role '" + role + "'")
+	}
+	if !deployPlatformReg.MatchString(osName) || !deployPlatformReg.MatchString(arch) {
+		return nil, errors.New("invalid platform '" + osName + "/" + arch + "'")
+	}
+	if !deployVersionReg.MatchString(version) {
+		return nil, errors.New("invalid version '" + version + "'")
+	}
+
+	keyring, err := LoadDeployKeyring()
+	if err != nil {
+		return nil, errors.New("load deploy keys failed: " + err.Error())
+	}
+	if keyring.IsEmpty() {
+		return nil, errors.New("no deploy key found, please add public keys to '" + DeployKeysFile + "' first")
+	}
+
+	err = os.MkdirAll(this.dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	var filename = DeployPackageFilename(role, osName, arch, version)
+	var tmpPath = this.dir + "/." + filename + ".tmp"
+	fp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	var isOk = false
+	defer func() {
+		if !isOk {
+			_ = os.Remove(tmpPath)
 		}
+	}()
+
+	var hash = sha256.New()
+	size, err := io.Copy(io.MultiWriter(fp, hash), reader)
+	closeErr := fp.Close()
+	if err != nil {
+		return nil, err
+	}
+	if closeErr != nil {
+		return nil, closeErr
 	}
 
-	result := []*DeployFile{}
-	for _, v := range keyMap {
-		result = append(result, v)
+	var pkg = &DeployPackage{
+		Role:      role,
+		OS:        osName,
+		Arch:      arch,
+		Version:   version,
+		Filename:  filename,
+		Size:      size,
+		SHA256:    fmt.Sprintf("%x", hash.Sum(nil)),
+		KeyId:     keyId,
+		Signature: signature,
+		CreatedAt: time.Now().Unix(),
 	}
-	return result
+	err = keyring.Verify(keyId, pkg.SignMessage(), signature)
+	if err != nil {
+		return nil, errors.New("verify package failed: " + err.Error())
+	}
+
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	manifest, err := LoadDeployManifest(this.manifestPath())
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(tmpPath, this.dir+"/"+filename)
+	if err != nil {
+		return nil, err
+	}
+	isOk = true
+	manifest.Add(pkg)
+	err = manifest.Save(this.manifestPath())
+	if err != nil {
+		return nil, err
+	}
+	return pkg, nil
 }
 
-// FindNodeFile 查找特别平台的节点文件
-func (this *DeployManager) FindNodeFile(os string, arch string) *DeployFile {
-	for _, file := range this.LoadNodeFiles() {
-		if file.OS == os && file.Arch == arch {
-			return file
+// ListPackages 列出清单中的所有安装包
+func (this *DeployManager) ListPackages() ([]*DeployPackage, error) {
+	manifest, err := LoadDeployManifest(this.manifestPath())
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Packages, nil
+}
+
+// 加载某个角色的所有版本的安装文件
+func (this *DeployManager) loadFiles(role nodeconfigs.NodeRole) []*DeployFile {
+	keyring, err := LoadDeployKeyring()
+	if err != nil {
+		logs.Println("[DEPLOY]load deploy keys failed: " + err.Error())
+		return nil
+	}
+	if keyring.IsEmpty() {
+		if !AllowUnsignedDeployFiles() {
+			logs.Println("[DEPLOY]no deploy key found, unsigned packages will not be used, please add public keys to '" + DeployKeysFile + "', or set '" + EnvDeployAllowUnsigned + "=1' to allow unsigned packages")
+			return nil
 		}
+		logs.Println("[DEPLOY]WARNING: scan unsigned packages because '" + EnvDeployAllowUnsigned + "' is set")
+		return this.scanFiles(role)
 	}
-	return nil
+
+	manifest, err := LoadDeployManifest(this.manifestPath())
+	if err != nil {
+		logs.Println("[DEPLOY]load package manifest failed: " + err.Error())
+		return nil
+	}
+	var result = []*DeployFile{}
+	for _, pkg := range manifest.Packages {
+		if pkg.Role != role {
+			continue
+		}
+		err = keyring.Verify(pkg.KeyId, pkg.SignMessage(), pkg.Signature)
+		if err != nil {
+			logs.Println("[DEPLOY]skip package '" + pkg.Filename + "': " + err.Error())
+			continue
+		}
+		var path = this.dir + "/" + pkg.Filename
+		_, err = os.Stat(path)
+		if err != nil {
+			continue
+		}
+		result = append(result, &DeployFile{
+			OS:      pkg.OS,
+			Arch:    pkg.Arch,
+			Version: pkg.Version,
+			Path:    path,
+			Package: pkg,
+		})
+	}
+	return result
 }
 
-// LoadNSNodeFiles 加载所有NS节点安装文件
-func (this *DeployManager) LoadNSNodeFiles() []*DeployFile {
-	keyMap := map[string]*DeployFile{} // key => File
+// 扫描部署目录中的安装文件
+func (this *DeployManager) scanFiles(role nodeconfigs.NodeRole) []*DeployFile {
+	var reg = regexp.MustCompile(`^edge-node-(\w+)-(\w+)-v([0-9.]+)\.zip$`)
+	if role == nodeconfigs.NodeRoleDNS {
+		reg = regexp.MustCompile(`^edge-dns-(\w+)-(\w+)-v([0-9.]+)\.zip$`)
+	}
 
-	reg := regexp.MustCompile(`^edge-dns-(\w+)-(\w+)-v([0-9.]+)\.zip$`)
+	var result = []*DeployFile{}
 	for _, file := range files.NewFile(this.dir).List() {
 		name := file.Name()
 		if !reg.MatchString(name) {
 			continue
 		}
 		matches := reg.FindStringSubmatch(name)
-		osName := matches[1]
-		arch := matches[2]
-		version := matches[3]
+		result = append(result, &DeployFile{
+			OS:      matches[1],
+			Arch:    matches[2],
+			Version: matches[3],
+			Path:    file.Path(),
+		})
+	}
+	return result
+}
 
-		key := osName + "_" + arch
-		oldFile, ok := keyMap[key]
-		if ok && stringutil.VersionCompare(oldFile.Version, version) > 0 {
+// 每个平台只保留版本范围内的最新版本
+func (this *DeployManager) latestFiles(deployFiles []*DeployFile, versionRange string) []*DeployFile {
+	keyMap := map[string]*DeployFile{} // key => File
+	for _, file := range deployFiles {
+		if len(versionRange) > 0 && !MatchDeployVersionRange(file.Version, versionRange) {
 			continue
 		}
-		keyMap[key] = &DeployFile{
-			OS:      osName,
-			Arch:    arch,
-			Version: version,
-			Path:    file.Path(),
+		key := file.OS + "_" + file.Arch
+		oldFile, ok := keyMap[key]
+		if ok && stringutil.VersionCompare(oldFile.Version, file.Version) > 0 {
+			continue
 		}
+		keyMap[key] = file
 	}
 
 	result := []*DeployFile{}
@@ -100,12 +360,17 @@ func (this *DeployManager) LoadNSNodeFiles() []*DeployFile {
 	return result
 }
 
-// FindNSNodeFile 查找特别平台的NS节点安装文件
-func (this *DeployManager) FindNSNodeFile(os string, arch string) *DeployFile {
-	for _, file := range this.LoadNSNodeFiles() {
+// 查找特定平台在版本范围内的最新文件
+func (this *DeployManager) findFile(deployFiles []*DeployFile, os string, arch string, versionRange string) *DeployFile {
+	for _, file := range this.latestFiles(deployFiles, versionRange) {
 		if file.OS == os && file.Arch == arch {
 			return file
 		}
 	}
 	return nil
 }
+
+// 清单文件路径
+func (this *DeployManager) manifestPath() string {
+	return this.dir + "/" + DeployManifestFile
+}
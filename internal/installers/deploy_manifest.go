@@ -0,0 +1,103 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"encoding/json"
+	"github.com/1uLang/EdgeCommon/pkg/nodeconfigs"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DeployManifestFile 部署目录下的安装包清单文件
+const DeployManifestFile = "manifest.json"
+
+// DeployPackage 安装包仓库中的安装包
+type DeployPackage struct {
+	Role      nodeconfigs.NodeRole `json:"role"`      // 节点角色：node, dns
+	OS        string               `json:"os"`        // 操作系统
+	Arch      string               `json:"arch"`      // 架构
+	Version   string               `json:"version"`   // 版本
+	Filename  string               `json:"filename"`  // 部署目录下的文件名
+	Size      int64                `json:"size"`      // 文件尺寸
+	SHA256    string               `json:"sha256"`    // 文件SHA256
+	KeyId     string               `json:"keyId"`     // 签名使用的密钥ID
+	Signature string               `json:"signature"` // BASE64编码的ed25519签名
+	CreatedAt int64                `json:"createdAt"` // 导入时间
+}
+
+// SignMessage 需要签名的内容
+// 签名覆盖角色、平台、版本和文件内容，任何一项被修改都会导致校验失败
+func (this *DeployPackage) SignMessage() []byte {
+	return DeployPackageSignMessage(this.Role, this.OS, this.Arch, this.Version, this.SHA256, this.Size)
+}
+
+// DeployPackageSignMessage 构造安装包需要签名的内容
+func DeployPackageSignMessage(role nodeconfigs.NodeRole, osName string, arch string, version string, sha256 string, size int64) []byte {
+	return []byte(strings.Join([]string{
+		"edge-deploy-package-v1",
+		role,
+		osName,
+		arch,
+		version,
+		strings.ToLower(sha256),
+		strconv.FormatInt(size, 10),
+	}, "\n"))
+}
+
+// DeployPackageFilename 安装包在部署目录下的文件名
+func DeployPackageFilename(role nodeconfigs.NodeRole, osName string, arch string, version string) string {
+	var prefix = "edge-node-"
+	if role == nodeconfigs.NodeRoleDNS {
+		prefix = "edge-dns-"
+	}
+	return prefix + osName + "-" + arch + "-v" + version + ".zip"
+}
+
+// DeployManifest 安装包清单
+type DeployManifest struct {
+	Packages []*DeployPackage `json:"packages"`
+}
+
+// LoadDeployManifest 读取清单文件，文件不存在时返回空清单
+func LoadDeployManifest(path string) (*DeployManifest, error) {
+	var manifest = &DeployManifest{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifest, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Save 保存清单文件，先写入临时文件再替换，避免读到写了一半的清单
+func (this *DeployManifest) Save(path string) error {
+	data, err := json.MarshalIndent(this, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path+".tmp", data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Add 添加安装包，同一个角色、平台和版本的安装包会被替换
+func (this *DeployManifest) Add(pkg *DeployPackage) {
+	for index, oldPkg := range this.Packages {
+		if oldPkg.Role == pkg.Role && oldPkg.OS == pkg.OS && oldPkg.Arch == pkg.Arch && oldPkg.Version == pkg.Version {
+			this.Packages[index] = pkg
+			return
+		}
+	}
+	this.Packages = append(this.Packages, pkg)
+}
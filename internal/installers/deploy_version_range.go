@@ -0,0 +1,93 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"errors"
+	stringutil "github.com/iwind/TeaGo/utils/string"
+	"regexp"
+	"strings"
+)
+
+var deployVersionReg = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+var deployVersionOpSpaceReg = regexp.MustCompile(`([<>=])\s+`)
+
+// 版本范围中的单个条件
+type deployVersionCondition struct {
+	op      string // =, >, >=, <, <=
+	version string
+	prefix  bool // 是否为 1.2.* 这种前缀匹配
+}
+
+// 分析版本范围，多个条件之间用逗号或者空格分隔，需要同时满足
+// 比如：">=1.2.0, <1.3.0"、"1.2.*"、"=1.2.5"，空字符串表示不限制版本
+func parseDeployVersionRange(versionRange string) ([]*deployVersionCondition, error) {
+	var conditions = []*deployVersionCondition{}
+	var pieces = strings.FieldsFunc(deployVersionOpSpaceReg.ReplaceAllString(versionRange, "$1"), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	for _, piece := range pieces {
+		var condition = &deployVersionCondition{op: "="}
+		for _, op := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(piece, op) {
+				condition.op = op
+				piece = piece[len(op):]
+				break
+			}
+		}
+		piece = strings.TrimPrefix(piece, "v")
+		if strings.HasSuffix(piece, ".*") {
+			if condition.op != "=" {
+				return nil, errors.New("wildcard version '" + piece + "' can only be used with '='")
+			}
+			condition.prefix = true
+			piece = strings.TrimSuffix(piece, ".*")
+		}
+		if !deployVersionReg.MatchString(piece) {
+			return nil, errors.New("invalid version '" + piece + "' in range '" + versionRange + "'")
+		}
+		condition.version = piece
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
+
+// ValidateDeployVersionRange 检查版本范围格式
+func ValidateDeployVersionRange(versionRange string) error {
+	_, err := parseDeployVersionRange(versionRange)
+	return err
+}
+
+// MatchDeployVersionRange 判断版本是否在范围内，范围格式错误时返回false
+func MatchDeployVersionRange(version string, versionRange string) bool {
+	conditions, err := parseDeployVersionRange(versionRange)
+	if err != nil {
+		return false
+	}
+	for _, condition := range conditions {
+		if condition.prefix {
+			if version != condition.version && !strings.HasPrefix(version, condition.version+".") {
+				return false
+			}
+			continue
+		}
+		var result = stringutil.VersionCompare(version, condition.version)
+		var ok bool
+		switch condition.op {
+		case "=":
+			ok = result == 0
+		case ">":
+			ok = result > 0
+		case ">=":
+			ok = result >= 0
+		case "<":
+			ok = result < 0
+		case "<=":
+			ok = result <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"testing"
+)
+
+func TestMatchDeployVersionRange(t *testing.T) {
+	for _, testCase := range []struct {
+		version      string
+		versionRange string
+		result       bool
+	}{
+		{"0.3.0", "", true},
+		{"0.3.0", ">=0.2.0", true},
+		{"0.3.0", ">=0.2.0, <0.3.0", false},
+		{"0.2.9", ">=0.2.0, <0.3.0", true},
+		{"0.2.9", ">= 0.2.0 < 0.3.0", true},
+		{"0.3.0", "0.3.0", true},
+		{"0.3.1", "=0.3.0", false},
+		{"0.3.1", "0.3.*", true},
+		{"0.3", "0.3.*", true},
+		{"0.31.0", "0.3.*", false},
+		{"0.3.1", "<=0.3.1", true},
+		{"0.3.2", ">0.3.1", true},
+	} {
+		if MatchDeployVersionRange(testCase.version, testCase.versionRange) != testCase.result {
+			t.Fatal("'"+testCase.version+"' in '"+testCase.versionRange+"' should be", testCase.result)
+		}
+	}
+}
+
+func TestValidateDeployVersionRange(t *testing.T) {
+	for _, versionRange := range []string{"", ">=0.2.0,<0.3.0", "v0.3.1", "0.3.*"} {
+		if ValidateDeployVersionRange(versionRange) != nil {
+			t.Fatal("'" + versionRange + "' should be valid")
+		}
+	}
+	for _, versionRange := range []string{">=", "abc", ">=0.3.*", "0.3.x"} {
+		if ValidateDeployVersionRange(versionRange) == nil {
+			t.Fatal("'" + versionRange + "' should be invalid")
+		}
+	}
+
+	// 格式错误的范围不匹配任何版本
+	if MatchDeployVersionRange("0.3.0", "abc") {
+		t.Fatal("invalid range should not match")
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DiagnosticsFileType       = "nodeDiagnostics" // 诊断包在文件管理中的类型
+	DiagnosticsMaxOutputBytes = 1 << 20           // 单个命令最多保留的输出
+)
+
+// DiagnosticCommand 预先审核过的诊断命令
+// 只能执行这里列出的命令，命令中的 ${name} 和 ${target} 分别替换为节点程序名称和程序目录
+type DiagnosticCommand struct {
+	Code    string
+	Name    string
+	Command string
+}
+
+var DiagnosticCommands = []*DiagnosticCommand{
+	{
+		Code:    "serviceStatus",
+		Name:    "服务状态",
+		Command: `systemctl status ${name} --no-pager -l; ps -eo pid,ppid,user,%cpu,%mem,etime,args | grep "bin/${name}" | grep -v grep`,
+	},
+	{
+		Code:    "recentLogs",
+		Name:    "最近日志",
+		Command: `journalctl -u ${name} -n 200 --no-pager; tail -n 500 "${target}/logs/run.log"`,
+	},
+	{
+		Code:    "disk",
+		Name:    "磁盘",
+		Command: `df -h; df -i; du -sh "${target}"`,
+	},
+	{
+		Code:    "sockets",
+		Name:    "网络连接",
+		Command: `ss -s; ss -lntup 2>/dev/null || netstat -lntup`,
+	},
+	{
+		Code:    "configChecksum",
+		Name:    "配置校验值",
+		Command: `sha256sum "${target}/bin/${name}" "${target}"/configs/*`,
+	},
+}
+
+// DiagnosticResult 诊断命令执行结果
+type DiagnosticResult struct {
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	Output string `json:"output"`
+	Error  string `json:"error"`
+	CostMs int64  `json:"costMs"`
+}
+
+// DiagnosticsBundleInfo 诊断包说明
+type DiagnosticsBundleInfo struct {
+	Role      string `json:"role"`
+	NodeId    int64  `json:"nodeId"`
+	NodeName  string `json:"nodeName"`
+	Method    string `json:"method"` // stream, ssh
+	AdminId   int64  `json:"adminId"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// FindDiagnosticCommands 根据代号查找诊断命令，代号为空时返回所有命令
+func FindDiagnosticCommands(codes []string) ([]*DiagnosticCommand, error) {
+	if len(codes) == 0 {
+		return DiagnosticCommands, nil
+	}
+	var result = []*DiagnosticCommand{}
+	for _, code := range codes {
+		var found *DiagnosticCommand
+		for _, command := range DiagnosticCommands {
+			if command.Code == code {
+				found = command
+				break
+			}
+		}
+		if found == nil {
+			return nil, errors.New("unknown diagnostic command '" + code + "'")
+		}
+		result = append(result, found)
+	}
+	return result, nil
+}
+
+// RunDiagnostics 在远程主机上执行诊断命令
+// dir 为安装目录，name 为节点程序名称，比如 edge-node, edge-dns；单个命令出错不会影响其他命令
+func (this *BaseInstaller) RunDiagnostics(dir string, name string, codes []string) ([]*DiagnosticResult, error) {
+	commands, err := FindDiagnosticCommands(codes)
+	if err != nil {
+		return nil, err
+	}
+	dir = path.Clean(dir)
+	if !path.IsAbs(dir) || strings.ContainsAny(dir, `"$`+"`\\") {
+		return nil, errors.New("invalid install directory '" + dir + "'")
+	}
+
+	var results = []*DiagnosticResult{}
+	for _, command := range commands {
+		var before = time.Now()
+		var result = &DiagnosticResult{
+			Code: command.Code,
+			Name: command.Name,
+		}
+		stdout, stderr, err := this.client.Exec(buildDiagnosticCommand(command, dir, name))
+		result.Output = stdout + stderr
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.CostMs = time.Since(before).Milliseconds()
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// BuildDiagnosticsBundle 将诊断结果打包成zip文件
+// 每个命令的输出单独一个文件，info.json 中记录节点和每个命令的执行情况
+func BuildDiagnosticsBundle(info *DiagnosticsBundleInfo, results []*DiagnosticResult) ([]byte, error) {
+	var buf = &bytes.Buffer{}
+	var writer = zip.NewWriter(buf)
+	var modified = time.Unix(info.CreatedAt, 0)
+
+	var summaries = []map[string]interface{}{}
+	for _, result := range results {
+		summaries = append(summaries, map[string]interface{}{
+			"code":   result.Code,
+			"name":   result.Name,
+			"error":  result.Error,
+			"costMs": result.CostMs,
+			"size":   len(result.Output),
+		})
+	}
+	infoJSON, err := json.MarshalIndent(map[string]interface{}{
+		"info":     info,
+		"commands": summaries,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var addFile = func(name string, data []byte) error {
+		fileWriter, err := writer.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: modified,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fileWriter.Write(data)
+		return err
+	}
+	err = addFile("info.json", infoJSON)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		var output = result.Output
+		if len(result.Error) > 0 {
+			output += "\n[ERROR]" + result.Error + "\n"
+		}
+		err = addFile(result.Code+".txt", []byte(output))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 生成在远程主机上执行的命令，合并标准输出和错误输出并限制输出长度
+func buildDiagnosticCommand(command *DiagnosticCommand, dir string, name string) string {
+	var s = strings.NewReplacer("${name}", name, "${target}", dir+"/"+name).Replace(command.Command)
+	return "(" + s + ") 2>&1 | head -c " + strconv.Itoa(DiagnosticsMaxOutputBytes)
+}
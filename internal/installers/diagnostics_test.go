@@ -0,0 +1,94 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFindDiagnosticCommands(t *testing.T) {
+	commands, err := FindDiagnosticCommands(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != len(DiagnosticCommands) {
+		t.Fatal("should return all commands")
+	}
+
+	commands, err = FindDiagnosticCommands([]string{"disk", "sockets"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 2 || commands[0].Code != "disk" || commands[1].Code != "sockets" {
+		t.Fatal("invalid commands")
+	}
+
+	_, err = FindDiagnosticCommands([]string{"rm -rf /"})
+	if err == nil {
+		t.Fatal("should reject unknown command")
+	}
+}
+
+func TestBuildDiagnosticCommand(t *testing.T) {
+	commands, err := FindDiagnosticCommands([]string{"configChecksum"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var command = buildDiagnosticCommand(commands[0], "/opt/edge", "edge-node")
+	if !strings.Contains(command, `"/opt/edge/edge-node/bin/edge-node"`) {
+		t.Fatal("invalid command:", command)
+	}
+	if !strings.HasSuffix(command, "| head -c 1048576") {
+		t.Fatal("output should be limited:", command)
+	}
+}
+
+func TestBuildDiagnosticsBundle(t *testing.T) {
+	data, err := BuildDiagnosticsBundle(&DiagnosticsBundleInfo{
+		Role:      "node",
+		NodeId:    1,
+		NodeName:  "node1",
+		Method:    "ssh",
+		CreatedAt: 1630000000,
+	}, []*DiagnosticResult{
+		{Code: "disk", Name: "磁盘", Output: "/dev/vda1 40G"},
+		{Code: "sockets", Name: "网络连接", Error: "exit status 127"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents = map[string]string{}
+	for _, file := range reader.File {
+		fp, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileData, err := ioutil.ReadAll(fp)
+		_ = fp.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[file.Name] = string(fileData)
+	}
+	if len(contents) != 3 {
+		t.Fatal("invalid files:", len(contents))
+	}
+	if contents["disk.txt"] != "/dev/vda1 40G" {
+		t.Fatal("invalid disk.txt:", contents["disk.txt"])
+	}
+	if !strings.Contains(contents["sockets.txt"], "exit status 127") {
+		t.Fatal("error should be included")
+	}
+	if !strings.Contains(contents["info.json"], `"nodeName": "node1"`) {
+		t.Fatal("invalid info.json:", contents["info.json"])
+	}
+}
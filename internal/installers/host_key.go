@@ -0,0 +1,166 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"strconv"
+)
+
+// ErrorCodeSSHHostKeyMismatch 主机密钥和信任的密钥不一致时的错误代号
+const ErrorCodeSSHHostKeyMismatch = "SSH_HOST_KEY_MISMATCH"
+
+// HostKeyMismatchError 主机密钥不一致错误
+type HostKeyMismatchError struct {
+	KeyType           string // 主机返回的密钥类型
+	Fingerprint       string // 主机返回的密钥指纹
+	PinnedFingerprint string // 信任的密钥指纹
+	IsJumpHost        bool   // 是否为跳板机
+}
+
+func (this *HostKeyMismatchError) Error() string {
+	if this.IsJumpHost {
+		return "ssh jump host key mismatch: expected '" + this.PinnedFingerprint + "', but got '" + this.Fingerprint + "' (" + this.KeyType + "), the jump host may have been reinstalled or the connection may be intercepted"
+	}
+	return "ssh host key mismatch: expected '" + this.PinnedFingerprint + "', but got '" + this.Fingerprint + "' (" + this.KeyType + "), the host may have been reinstalled or the connection may be intercepted"
+}
+
+// IsHostKeyMismatchError 判断是否为主机密钥不一致错误
+func IsHostKeyMismatchError(err error) bool {
+	var mismatchErr *HostKeyMismatchError
+	return errors.As(err, &mismatchErr)
+}
+
+// 生成校验主机密钥的回调
+// 没有信任的密钥时接受并记录主机密钥（首次信任），否则要求指纹一致
+func newHostKeyCallback(credentials *Credentials) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		credentials.HostKeyType = key.Type()
+		credentials.HostKeyFingerprint = ssh.FingerprintSHA256(key)
+		return checkHostKeyMismatch(credentials)
+	}
+}
+
+// 和主机协商的密钥类型
+// 主机有多种类型的密钥时，只协商信任的密钥类型，否则主机可能返回其他类型的密钥而被误认为密钥不一致
+func hostKeyAlgorithms(credentials *Credentials) []string {
+	if len(credentials.PinnedHostKeyFingerprint) == 0 || len(credentials.PinnedHostKeyType) == 0 {
+		return nil
+	}
+	return []string{credentials.PinnedHostKeyType}
+}
+
+// 检查登录时主机返回的密钥是否和信任的密钥一致
+func checkHostKeyMismatch(credentials *Credentials) error {
+	if len(credentials.PinnedHostKeyFingerprint) == 0 || len(credentials.HostKeyFingerprint) == 0 {
+		return nil
+	}
+	if credentials.PinnedHostKeyFingerprint == credentials.HostKeyFingerprint {
+		return nil
+	}
+	return &HostKeyMismatchError{
+		KeyType:           credentials.HostKeyType,
+		Fingerprint:       credentials.HostKeyFingerprint,
+		PinnedFingerprint: credentials.PinnedHostKeyFingerprint,
+	}
+}
+
+// LoginWithNodeLogin 使用节点登录信息中信任的主机密钥登录
+// 首次登录成功后信任主机密钥；主机密钥不一致时记录为待确认的密钥
+// 登录信息中设置了跳板机时，会依次通过跳板机连接
+func (this *BaseInstaller) LoginWithNodeLogin(login *models.NodeLogin, credentials *Credentials) error {
+	credentials.PinnedHostKeyType = login.HostKeyType
+	credentials.PinnedHostKeyFingerprint = login.HostKeyFingerprint
+	jumpHosts, err := fillJumpHosts(login, credentials)
+	if err != nil {
+		return err
+	}
+
+	err = this.Login(credentials)
+	if err != nil {
+		var mismatchErr *HostKeyMismatchError
+		if errors.As(err, &mismatchErr) && !mismatchErr.IsJumpHost {
+			updateErr := models.SharedNodeLoginDAO.UpdatePendingHostKey(nil, int64(login.Id), credentials.HostKeyType, credentials.HostKeyFingerprint)
+			if updateErr != nil {
+				return errors.New(err.Error() + ", record pending host key failed: " + updateErr.Error())
+			}
+		}
+		return err
+	}
+
+	if len(login.HostKeyFingerprint) == 0 && len(credentials.HostKeyFingerprint) > 0 {
+		err = models.SharedNodeLoginDAO.PinHostKey(nil, int64(login.Id), credentials.HostKeyType, credentials.HostKeyFingerprint)
+		if err != nil {
+			_ = this.Close()
+			return err
+		}
+	}
+
+	// 信任跳板机主机密钥
+	var shouldPinJumpHosts = false
+	var jumpHostKeys = [][2]string{}
+	for index, jumpHost := range jumpHosts {
+		jumpCredentials := credentials.JumpHosts[index]
+		if len(jumpHost.HostKeyFingerprint) == 0 && len(jumpCredentials.HostKeyFingerprint) > 0 {
+			shouldPinJumpHosts = true
+		}
+		jumpHostKeys = append(jumpHostKeys, [2]string{jumpCredentials.HostKeyType, jumpCredentials.HostKeyFingerprint})
+	}
+	if shouldPinJumpHosts {
+		err = models.SharedNodeLoginDAO.PinJumpHostKeys(nil, int64(login.Id), jumpHostKeys)
+		if err != nil {
+			_ = this.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// 根据登录信息中的跳板机设置认证信息
+func fillJumpHosts(login *models.NodeLogin, credentials *Credentials) ([]*models.NodeLoginJumpHost, error) {
+	if login.Type != models.NodeLoginTypeSSH {
+		return nil, nil
+	}
+	params, err := login.DecodeSSHParams()
+	if err != nil {
+		return nil, err
+	}
+	credentials.ForwardAgent = params.ForwardAgent
+
+	credentials.JumpHosts = nil
+	var jumpHosts = []*models.NodeLoginJumpHost{}
+	for _, jumpHost := range params.JumpHosts {
+		if jumpHost == nil {
+			continue
+		}
+		if len(jumpHost.Host) == 0 || jumpHost.Port <= 0 {
+			return nil, errors.New("invalid jump host '" + jumpHost.Host + "'")
+		}
+		if jumpHost.GrantId <= 0 {
+			return nil, errors.New("jump host '" + jumpHost.Host + "' should have a grant")
+		}
+		grant, err := models.SharedNodeGrantDAO.FindEnabledNodeGrant(nil, jumpHost.GrantId)
+		if err != nil {
+			return nil, err
+		}
+		if grant == nil {
+			return nil, errors.New("can not find grant with id '" + strconv.FormatInt(jumpHost.GrantId, 10) + "' for jump host '" + jumpHost.Host + "'")
+		}
+		jumpHosts = append(jumpHosts, jumpHost)
+		credentials.JumpHosts = append(credentials.JumpHosts, &Credentials{
+			Host:                     jumpHost.Host,
+			Port:                     jumpHost.Port,
+			Username:                 grant.Username,
+			Password:                 grant.Password,
+			PrivateKey:               grant.PrivateKey,
+			Passphrase:               grant.Passphrase,
+			Method:                   grant.Method,
+			PinnedHostKeyType:        jumpHost.HostKeyType,
+			PinnedHostKeyFingerprint: jumpHost.HostKeyFingerprint,
+		})
+	}
+	return jumpHosts, nil
+}
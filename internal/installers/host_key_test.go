@@ -0,0 +1,45 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"testing"
+)
+
+func TestCheckHostKeyMismatch(t *testing.T) {
+	// 首次连接
+	{
+		var credentials = &Credentials{HostKeyType: "ssh-ed25519", HostKeyFingerprint: "SHA256:a"}
+		if checkHostKeyMismatch(credentials) != nil {
+			t.Fatal("should accept any key if not pinned")
+		}
+	}
+
+	// 密钥一致
+	{
+		var credentials = &Credentials{PinnedHostKeyFingerprint: "SHA256:a", HostKeyType: "ssh-ed25519", HostKeyFingerprint: "SHA256:a"}
+		if checkHostKeyMismatch(credentials) != nil {
+			t.Fatal("should accept pinned key")
+		}
+	}
+
+	// 密钥不一致
+	{
+		var credentials = &Credentials{PinnedHostKeyFingerprint: "SHA256:a", HostKeyType: "ssh-ed25519", HostKeyFingerprint: "SHA256:b"}
+		var err = checkHostKeyMismatch(credentials)
+		if !IsHostKeyMismatchError(err) {
+			t.Fatal("should reject changed key")
+		}
+		t.Log(err)
+	}
+}
+
+func TestHostKeyAlgorithms(t *testing.T) {
+	if hostKeyAlgorithms(&Credentials{}) != nil {
+		t.Fatal("should negotiate any key type if not pinned")
+	}
+	var algorithms = hostKeyAlgorithms(&Credentials{PinnedHostKeyType: "ssh-rsa", PinnedHostKeyFingerprint: "SHA256:a"})
+	if len(algorithms) != 1 || algorithms[0] != "ssh-rsa" {
+		t.Fatal("should negotiate pinned key type only, but got:", algorithms)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"github.com/iwind/TeaGo/Tea"
 	stringutil "github.com/iwind/TeaGo/utils/string"
 	"golang.org/x/crypto/ssh"
-	"net"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -21,58 +20,79 @@ type BaseInstaller struct {
 
 // Login 登录SSH服务
 func (this *BaseInstaller) Login(credentials *Credentials) error {
+	// 依次连接跳板机
+	var jumpClients = []*ssh.Client{}
+	var closeJumpClients = func() {
+		for i := len(jumpClients) - 1; i >= 0; i-- {
+			_ = jumpClients[i].Close()
+		}
+	}
+	var lastClient *ssh.Client
+	for _, jumpHost := range credentials.JumpHosts {
+		jumpClient, err := this.dial(lastClient, jumpHost, true)
+		if err != nil {
+			closeJumpClients()
+			if IsHostKeyMismatchError(err) {
+				return err
+			}
+			return errors.New("login jump host '" + jumpHost.Host + "' failed: " + err.Error())
+		}
+		jumpClients = append(jumpClients, jumpClient)
+		lastClient = jumpClient
+	}
+
+	sshClient, err := this.dial(lastClient, credentials, false)
+	if err != nil {
+		closeJumpClients()
+		return err
+	}
+
+	client, err := NewSSHClient(sshClient)
+	if err != nil {
+		closeJumpClients()
+		return err
+	}
+	client.jumpClients = jumpClients
+
+	// 转发认证代理
+	if credentials.ForwardAgent {
+		err = client.forwardAgent(credentials)
+		if err != nil {
+			_ = client.Close()
+			return errors.New("forward agent failed: " + err.Error())
+		}
+	}
+
+	this.client = client
+	return nil
+}
+
+// 连接SSH主机，via不为空时通过已有的连接（跳板机）建立连接
+func (this *BaseInstaller) dial(via *ssh.Client, credentials *Credentials, isJumpHost bool) (*ssh.Client, error) {
 	var hostKeyCallback ssh.HostKeyCallback = nil
 
 	// 检查参数
 	if len(credentials.Host) == 0 {
-		return errors.New("'host' should not be empty")
+		return nil, errors.New("'host' should not be empty")
 	}
 	if credentials.Port <= 0 {
-		return errors.New("'port' should be greater than 0")
+		return nil, errors.New("'port' should be greater than 0")
 	}
 	if len(credentials.Password) == 0 && len(credentials.PrivateKey) == 0 {
-		return errors.New("require user 'password' or 'privateKey'")
+		return nil, errors.New("require user 'password' or 'privateKey'")
 	}
 
-	// 不使用known_hosts
+	// 不使用known_hosts，而是和信任的主机密钥指纹对比
 	if hostKeyCallback == nil {
-		hostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
-			return nil
-		}
+		credentials.HostKeyType = ""
+		credentials.HostKeyFingerprint = ""
+		hostKeyCallback = newHostKeyCallback(credentials)
 	}
 
 	// 认证
-	methods := []ssh.AuthMethod{}
-	if credentials.Method == "user" {
-		{
-			authMethod := ssh.Password(credentials.Password)
-			methods = append(methods, authMethod)
-		}
-
-		{
-			authMethod := ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) (answers []string, err error) {
-				if len(questions) == 0 {
-					return []string{}, nil
-				}
-				return []string{credentials.Password}, nil
-			})
-			methods = append(methods, authMethod)
-		}
-	} else if credentials.Method == "privateKey" {
-		var signer ssh.Signer
-		var err error
-		if len(credentials.Passphrase) > 0 {
-			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(credentials.PrivateKey), []byte(credentials.Passphrase))
-		} else {
-			signer, err = ssh.ParsePrivateKey([]byte(credentials.PrivateKey))
-		}
-		if err != nil {
-			return errors.New("parse private key: " + err.Error())
-		}
-		authMethod := ssh.PublicKeys(signer)
-		methods = append(methods, authMethod)
-	} else {
-		return errors.New("invalid method '" + credentials.Method + "'")
+	methods, err := newSSHAuthMethods(credentials)
+	if err != nil {
+		return nil, err
 	}
 
 	// SSH客户端
@@ -80,22 +100,30 @@ func (this *BaseInstaller) Login(credentials *Credentials) error {
 		credentials.Username = "root"
 	}
 	config := &ssh.ClientConfig{
-		User:            credentials.Username,
-		Auth:            methods,
-		HostKeyCallback: hostKeyCallback,
-		Timeout:         5 * time.Second, // TODO 后期可以设置这个超时时间
+		User:              credentials.Username,
+		Auth:              methods,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms(credentials),
+		Timeout:           5 * time.Second, // TODO 后期可以设置这个超时时间
 	}
 
-	sshClient, err := ssh.Dial("tcp", configutils.QuoteIP(credentials.Host)+":"+strconv.Itoa(credentials.Port), config)
-	if err != nil {
-		return err
+	var addr = configutils.QuoteIP(credentials.Host) + ":" + strconv.Itoa(credentials.Port)
+	var sshClient *ssh.Client
+	if via == nil {
+		sshClient, err = ssh.Dial("tcp", addr, config)
+	} else {
+		sshClient, err = dialVia(via, addr, config)
 	}
-	client, err := NewSSHClient(sshClient)
 	if err != nil {
-		return err
+		// ssh库会把回调返回的错误转换为字符串，所以这里重新检查主机密钥
+		mismatchErr := checkHostKeyMismatch(credentials)
+		if mismatchErr != nil {
+			mismatchErr.(*HostKeyMismatchError).IsJumpHost = isJumpHost
+			return nil, mismatchErr
+		}
+		return nil, err
 	}
-	this.client = client
-	return nil
+	return sshClient, nil
 }
 
 // Close 关闭SSH服务
@@ -146,15 +174,40 @@ func (this *BaseInstaller) InstallHelper(targetDir string, role nodeconfigs.Node
 		return env, err
 	}
 
-	osName := ""
-	archName := ""
+	osName, archName, err := parseUname(uname)
+	if err != nil {
+		return env, err
+	}
+
+	exeName := "edge-installer-helper-" + osName + "-" + archName
+	switch role {
+	case nodeconfigs.NodeRoleDNS:
+		exeName = "edge-installer-dns-helper-" + osName + "-" + archName
+	}
+	exePath := Tea.Root + "/installers/" + exeName
+
+	err = this.client.Copy(exePath, targetDir+"/"+exeName, 0777)
+	if err != nil {
+		return env, errors.New("copy '" + exeName + "' to '" + targetDir + "' failed: " + err.Error())
+	}
+
+	env = &Env{
+		OS:         osName,
+		Arch:       archName,
+		HelperName: exeName,
+	}
+	return env, nil
+}
+
+// 从uname -a的输出中分析操作系统和架构
+func parseUname(uname string) (osName string, archName string, err error) {
 	if strings.Contains(uname, "Darwin") {
 		osName = "darwin"
 	} else if strings.Contains(uname, "Linux") {
 		osName = "linux"
 	} else {
 		// TODO 支持freebsd, aix ...
-		return env, errors.New("installer not supported os '" + uname + "'")
+		return "", "", errors.New("installer not supported os '" + uname + "'")
 	}
 
 	if strings.Contains(uname, "aarch64") || strings.Contains(uname, "armv8") {
@@ -170,23 +223,5 @@ func (this *BaseInstaller) InstallHelper(targetDir string, role nodeconfigs.Node
 	} else {
 		archName = "386"
 	}
-
-	exeName := "edge-installer-helper-" + osName + "-" + archName
-	switch role {
-	case nodeconfigs.NodeRoleDNS:
-		exeName = "edge-installer-dns-helper-" + osName + "-" + archName
-	}
-	exePath := Tea.Root + "/installers/" + exeName
-
-	err = this.client.Copy(exePath, targetDir+"/"+exeName, 0777)
-	if err != nil {
-		return env, errors.New("copy '" + exeName + "' to '" + targetDir + "' failed: " + err.Error())
-	}
-
-	env = &Env{
-		OS:         osName,
-		Arch:       archName,
-		HelperName: exeName,
-	}
-	return env, nil
+	return osName, archName, nil
 }
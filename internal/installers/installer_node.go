@@ -44,16 +44,24 @@ func (this *NodeInstaller) Install(dir string, params interface{}, installStatus
 	}
 
 	// 上传安装文件
-	filePrefix := "edge-node-" + env.OS + "-" + env.Arch
-	zipFile, err := this.LookupLatestInstaller(filePrefix)
+	deployFile := SharedDeployManager.FindNodeFileWithRange(env.OS, env.Arch, nodeParams.PackageVersionRange)
+	if deployFile == nil {
+		installStatus.ErrorCode = "PACKAGE_NOT_FOUND"
+		return errors.New("can not find installer file for " + env.OS + "/" + env.Arch)
+	}
+	// 上传校验过的内容，而不是重新从磁盘读取
+	zipData, _, err := SharedDeployManager.ReadVerifiedFile(deployFile)
 	if err != nil {
+		installStatus.ErrorCode = "PACKAGE_VERIFY_FAILED"
 		return err
 	}
-	if len(zipFile) == 0 {
-		return errors.New("can not find installer file for " + env.OS + "/" + env.Arch)
-	}
+	zipFile := deployFile.Path
 	targetZip := dir + "/" + filepath.Base(zipFile)
-	err = this.client.Copy(zipFile, targetZip, 0777)
+	_, err = this.client.WriteFile(targetZip, zipData)
+	if err != nil {
+		return err
+	}
+	err = this.client.Chmod(targetZip, 0777)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,99 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"path"
+	"strings"
+	"time"
+)
+
+// Uninstall 卸载节点：停止服务、删除systemd服务文件和安装文件
+// dir 为安装目录，name 为节点程序名称，比如 edge-node, edge-dns
+// 某个步骤出错时会继续执行后续步骤，尽可能清理远程主机
+func (this *BaseInstaller) Uninstall(dir string, name string) (steps []*models.NodeDecommissionStep, err error) {
+	dir = path.Clean(dir)
+	if !path.IsAbs(dir) || dir == "/" {
+		return nil, errors.New("invalid install directory '" + dir + "'")
+	}
+	var target = dir + "/" + name
+	var exePath = target + "/bin/" + name
+	var failedCodes = []string{}
+	var addStep = func(code string, stepErr error, message string) {
+		if stepErr != nil {
+			failedCodes = append(failedCodes, code)
+		}
+		steps = append(steps, newDecommissionStep(code, stepErr, message))
+	}
+
+	// 停止
+	_, _, _ = this.client.Exec("systemctl stop " + shellQuote(name) + " 2>/dev/null")
+	_, statErr := this.client.Stat(exePath)
+	if statErr != nil {
+		steps = append(steps, &models.NodeDecommissionStep{
+			Code:      "stop",
+			Status:    models.NodeDecommissionStepStatusSkipped,
+			Message:   "can not find executable file: " + exePath,
+			CreatedAt: time.Now().Unix(),
+		})
+	} else {
+		_, stderr, err := this.client.Exec(shellQuote(exePath) + " stop")
+		if err == nil && len(stderr) > 0 {
+			err = errors.New(stderr)
+		}
+		addStep("stop", err, "stopped")
+	}
+
+	// systemd服务文件
+	{
+		_, stderr, err := this.client.Exec("if command -v systemctl >/dev/null 2>&1; then systemctl disable " + shellQuote(name) + " 2>/dev/null; rm -f " + shellQuote("/etc/systemd/system/"+name+".service") + " && systemctl daemon-reload; fi")
+		if err == nil && len(stderr) > 0 {
+			err = errors.New(stderr)
+		}
+		addStep("removeService", err, "removed '/etc/systemd/system/"+name+".service'")
+	}
+
+	// 安装文件，包括安装包和安装助手
+	{
+		// 通配符不能放在引号中
+		_, stderr, err := this.client.Exec("rm -rf " + shellQuote(target) + " && rm -f " + shellQuote(dir) + "/edge-installer-*helper-* " + shellQuote(dir+"/"+name) + "-*.zip")
+		if err == nil && len(stderr) > 0 {
+			err = errors.New(stderr)
+		}
+		addStep("removeFiles", err, "removed '"+target+"'")
+	}
+
+	if len(failedCodes) > 0 {
+		return steps, errors.New("uninstall failed at steps: " + strings.Join(failedCodes, ", "))
+	}
+	return steps, nil
+}
+
+// 生成下线步骤，出错时使用错误信息作为说明
+func newDecommissionStep(code string, err error, message string) *models.NodeDecommissionStep {
+	var status = models.NodeDecommissionStepStatusOk
+	if err != nil {
+		status = models.NodeDecommissionStepStatusFailed
+		message = err.Error()
+	}
+	return &models.NodeDecommissionStep{
+		Code:      code,
+		Status:    status,
+		Message:   message,
+		CreatedAt: time.Now().Unix(),
+	}
+}
+
+// 记录下线步骤并结束下线
+func finishDecommission(decommissionId int64, steps []*models.NodeDecommissionStep, err error) error {
+	addErr := models.SharedNodeDecommissionDAO.AddSteps(nil, decommissionId, steps)
+	if addErr != nil {
+		return addErr
+	}
+	if err != nil {
+		return models.SharedNodeDecommissionDAO.FinishDecommission(nil, decommissionId, false, err.Error())
+	}
+	return models.SharedNodeDecommissionDAO.FinishDecommission(nil, decommissionId, true, "")
+}
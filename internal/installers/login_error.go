@@ -0,0 +1,37 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"errors"
+)
+
+// LoginError 登录节点失败的错误，Code 为安装状态中使用的错误代号
+type LoginError struct {
+	Code string
+	Err  error
+}
+
+func newLoginError(code string, err error) *LoginError {
+	return &LoginError{
+		Code: code,
+		Err:  err,
+	}
+}
+
+func (this *LoginError) Error() string {
+	return this.Err.Error()
+}
+
+func (this *LoginError) Unwrap() error {
+	return this.Err
+}
+
+// LoginErrorCode 获取登录错误的代号，不是登录错误时返回空
+func LoginErrorCode(err error) string {
+	var loginErr *LoginError
+	if errors.As(err, &loginErr) {
+		return loginErr.Code
+	}
+	return ""
+}
@@ -10,6 +10,8 @@ type NodeParams struct {
 	NodeId      string
 	Secret      string
 	IsUpgrading bool // 是否为升级
+
+	PackageVersionRange string // 允许安装的版本范围，为空表示不限制
 }
 
 func (this *NodeParams) Validate() error {
@@ -0,0 +1,296 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"errors"
+	"github.com/1uLang/EdgeCommon/pkg/nodeconfigs"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PreflightMinDiskMB     = 200  // 最小可用磁盘空间
+	PreflightWarnDiskMB    = 1024 // 可用磁盘空间低于此值时警告
+	PreflightMinMemoryMB   = 128  // 最小可用内存
+	PreflightWarnMemoryMB  = 512  // 可用内存低于此值时警告
+	PreflightWarnClockSkew = 10   // 时钟偏差超过此秒数时警告
+	PreflightMaxClockSkew  = 60   // 时钟偏差超过此秒数时无法安装，节点和API通讯时会校验时间戳
+)
+
+var PreflightNSNodePorts = []int{53} // DNS节点需要监听的端口
+
+// PreflightOptions 安装前检查选项
+type PreflightOptions struct {
+	Role        nodeconfigs.NodeRole
+	Dir         string // 安装目录
+	Ports       []int  // 节点需要监听的端口，边缘节点为集群中所有服务的端口
+	IsUpgrading bool   // 是否为升级，升级时端口由节点自身占用，所以不再检查
+
+	VersionRange string // 集群允许安装的版本范围
+}
+
+// Preflight 安装前检查系统环境
+// 每个检查项目单独给出结果，执行命令出错时不会中断其他项目的检查
+func (this *BaseInstaller) Preflight(options *PreflightOptions) []*models.NodeInstallPreflightItem {
+	var items = []*models.NodeInstallPreflightItem{}
+
+	// 操作系统和架构
+	osName := ""
+	uname, _, err := this.client.Exec("uname -a")
+	if err != nil {
+		items = append(items, preflightItem("os", "操作系统", models.NodeInstallPreflightStatusFail, "can not detect os: "+err.Error()))
+	} else {
+		var archName string
+		osName, archName, err = parseUname(uname)
+		if err != nil {
+			items = append(items, preflightItem("os", "操作系统", models.NodeInstallPreflightStatusFail, err.Error()))
+		} else {
+			items = append(items, preflightItem("os", "操作系统", models.NodeInstallPreflightStatusPass, osName))
+
+			var file *DeployFile
+			if options.Role == nodeconfigs.NodeRoleDNS {
+				file = SharedDeployManager.FindNSNodeFileWithRange(osName, archName, options.VersionRange)
+			} else {
+				file = SharedDeployManager.FindNodeFileWithRange(osName, archName, options.VersionRange)
+			}
+			if file == nil {
+				items = append(items, preflightItem("arch", "系统架构", models.NodeInstallPreflightStatusFail, "can not find installer file for "+osName+"/"+archName))
+			} else {
+				items = append(items, preflightItem("arch", "系统架构", models.NodeInstallPreflightStatusPass, osName+"/"+archName+", v"+file.Version))
+			}
+		}
+	}
+
+	// systemd
+	if osName == "linux" {
+		stdout, _, _ := this.client.Exec("command -v systemctl")
+		if len(strings.TrimSpace(stdout)) == 0 {
+			items = append(items, preflightItem("systemd", "systemd", models.NodeInstallPreflightStatusWarn, "systemd not found, node will not be started on boot"))
+		} else {
+			items = append(items, preflightItem("systemd", "systemd", models.NodeInstallPreflightStatusPass, strings.TrimSpace(stdout)))
+		}
+	}
+
+	// 磁盘
+	{
+		stdout, _, err := this.client.Exec(`d=` + shellQuote(options.Dir) + `; while [ ! -e "$d" ]; do d=$(dirname "$d"); done; df -Pk "$d"`)
+		if err != nil {
+			items = append(items, preflightItem("disk", "磁盘空间", models.NodeInstallPreflightStatusWarn, "can not check disk space: "+err.Error()))
+		} else {
+			availableMB, err := parseDfAvailableMB(stdout)
+			if err != nil {
+				items = append(items, preflightItem("disk", "磁盘空间", models.NodeInstallPreflightStatusWarn, "can not check disk space: "+err.Error()))
+			} else {
+				items = append(items, preflightThresholdItem("disk", "磁盘空间", availableMB, PreflightMinDiskMB, PreflightWarnDiskMB))
+			}
+		}
+	}
+
+	// 内存
+	if osName == "linux" {
+		stdout, _, err := this.client.Exec("cat /proc/meminfo")
+		if err != nil {
+			items = append(items, preflightItem("memory", "内存", models.NodeInstallPreflightStatusWarn, "can not check memory: "+err.Error()))
+		} else {
+			availableMB, err := parseMemAvailableMB(stdout)
+			if err != nil {
+				items = append(items, preflightItem("memory", "内存", models.NodeInstallPreflightStatusWarn, "can not check memory: "+err.Error()))
+			} else {
+				items = append(items, preflightThresholdItem("memory", "内存", availableMB, PreflightMinMemoryMB, PreflightWarnMemoryMB))
+			}
+		}
+	}
+
+	// 端口
+	// 已经被节点程序自身占用的端口不算冲突，比如重新安装时节点仍在运行
+	if !options.IsUpgrading && len(options.Ports) > 0 {
+		var processName = "edge-node"
+		if options.Role == nodeconfigs.NodeRoleDNS {
+			processName = "edge-dns"
+		}
+		stdout, _, err := this.client.Exec("ss -lntup 2>/dev/null || netstat -lntup 2>/dev/null")
+		if err != nil || len(strings.TrimSpace(stdout)) == 0 {
+			items = append(items, preflightItem("port", "端口", models.NodeInstallPreflightStatusWarn, "can not list listening ports, 'ss' or 'netstat' required"))
+		} else {
+			var listeningPorts = parseListeningPorts(stdout)
+			var countAvailable = 0
+			for _, port := range options.Ports {
+				var name = "端口" + strconv.Itoa(port)
+				process, ok := listeningPorts[port]
+				if !ok {
+					countAvailable++
+					continue
+				}
+				if process == processName {
+					items = append(items, preflightItem("port", name, models.NodeInstallPreflightStatusPass, "port "+strconv.Itoa(port)+" is used by "+processName))
+				} else {
+					items = append(items, preflightItem("port", name, models.NodeInstallPreflightStatusFail, "port "+strconv.Itoa(port)+" is already in use"))
+				}
+			}
+			if countAvailable > 0 {
+				items = append(items, preflightItem("port", "端口", models.NodeInstallPreflightStatusPass, strconv.Itoa(countAvailable)+" ports are available"))
+			}
+		}
+	}
+
+	// 时钟
+	{
+		stdout, _, err := this.client.Exec("date +%s")
+		var localTime = time.Now().Unix()
+		if err != nil {
+			items = append(items, preflightItem("clock", "时钟", models.NodeInstallPreflightStatusWarn, "can not check clock: "+err.Error()))
+		} else {
+			remoteTime, err := strconv.ParseInt(strings.TrimSpace(stdout), 10, 64)
+			if err != nil {
+				items = append(items, preflightItem("clock", "时钟", models.NodeInstallPreflightStatusWarn, "can not check clock: invalid time '"+stdout+"'"))
+			} else {
+				var skew = int64(math.Abs(float64(remoteTime - localTime)))
+				var message = "clock skew: " + strconv.FormatInt(skew, 10) + "s"
+				if skew > PreflightMaxClockSkew {
+					items = append(items, preflightItem("clock", "时钟", models.NodeInstallPreflightStatusFail, message))
+				} else if skew > PreflightWarnClockSkew {
+					items = append(items, preflightItem("clock", "时钟", models.NodeInstallPreflightStatusWarn, message))
+				} else {
+					items = append(items, preflightItem("clock", "时钟", models.NodeInstallPreflightStatusPass, message))
+				}
+			}
+		}
+	}
+
+	return items
+}
+
+// PreflightError 将检查失败的项目转换为错误，没有失败的项目时返回nil
+func PreflightError(items []*models.NodeInstallPreflightItem) error {
+	var messages = []string{}
+	for _, item := range items {
+		if item.Status == models.NodeInstallPreflightStatusFail {
+			messages = append(messages, item.Code+": "+item.Message)
+		}
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return errors.New("preflight checks failed: " + strings.Join(messages, "; "))
+}
+
+func preflightItem(code string, name string, status string, message string) *models.NodeInstallPreflightItem {
+	return &models.NodeInstallPreflightItem{
+		Code:    code,
+		Name:    name,
+		Status:  status,
+		Message: message,
+	}
+}
+
+// 根据阈值生成检查结果
+func preflightThresholdItem(code string, name string, availableMB int64, minMB int64, warnMB int64) *models.NodeInstallPreflightItem {
+	var message = strconv.FormatInt(availableMB, 10) + "MB available"
+	if availableMB < minMB {
+		return preflightItem(code, name, models.NodeInstallPreflightStatusFail, message+", at least "+strconv.FormatInt(minMB, 10)+"MB required")
+	}
+	if availableMB < warnMB {
+		return preflightItem(code, name, models.NodeInstallPreflightStatusWarn, message+", "+strconv.FormatInt(warnMB, 10)+"MB recommended")
+	}
+	return preflightItem(code, name, models.NodeInstallPreflightStatusPass, message)
+}
+
+// 分析df -Pk的输出，返回可用空间
+func parseDfAvailableMB(output string) (int64, error) {
+	var lines = strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return 0, errors.New("invalid df output")
+	}
+	var fields = strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return 0, errors.New("invalid df output")
+	}
+	availableKB, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid df output")
+	}
+	return availableKB / 1024, nil
+}
+
+// 分析/proc/meminfo的内容，返回可用内存
+// 较老的内核没有MemAvailable，使用MemFree+Buffers+Cached估算
+func parseMemAvailableMB(meminfo string) (int64, error) {
+	var values = map[string]int64{}
+	for _, line := range strings.Split(meminfo, "\n") {
+		var fields = strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = value
+	}
+
+	availableKB, ok := values["MemAvailable"]
+	if !ok {
+		freeKB, ok := values["MemFree"]
+		if !ok {
+			return 0, errors.New("invalid meminfo")
+		}
+		availableKB = freeKB + values["Buffers"] + values["Cached"]
+	}
+	return availableKB / 1024, nil
+}
+
+var preflightPortReg = regexp.MustCompile(`[:.](\d+)$`)
+var preflightSSProcessReg = regexp.MustCompile(`users:\(\("([^"]+)"`)
+var preflightNetstatProcessReg = regexp.MustCompile(`^\d+/(\S+)$`)
+
+// 分析ss -lntup或netstat -lntup的输出，返回正在监听的端口和占用端口的程序名称
+// 每行中第一个以端口结尾的地址为本地地址；没有权限查看程序或者多个程序占用同一个端口时程序名称为空
+func parseListeningPorts(output string) map[int]string {
+	var result = map[int]string{}
+	for _, line := range strings.Split(output, "\n") {
+		var fields = strings.Fields(line)
+		var port = 0
+		for _, field := range fields {
+			if !strings.ContainsAny(field, ":.") {
+				continue
+			}
+			var matches = preflightPortReg.FindStringSubmatch(field)
+			if len(matches) < 2 {
+				continue
+			}
+			port, _ = strconv.Atoi(matches[1])
+			break
+		}
+		if port <= 0 {
+			continue
+		}
+
+		var process = ""
+		var matches = preflightSSProcessReg.FindStringSubmatch(line)
+		if len(matches) > 1 {
+			process = matches[1]
+		} else if len(fields) > 0 {
+			matches = preflightNetstatProcessReg.FindStringSubmatch(fields[len(fields)-1])
+			if len(matches) > 1 {
+				process = matches[1]
+			}
+		}
+
+		oldProcess, ok := result[port]
+		if ok && oldProcess != process {
+			process = ""
+		}
+		result[port] = process
+	}
+	return result
+}
+
+// 将字符串转义为Shell中的单引号字符串
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
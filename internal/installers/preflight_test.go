@@ -0,0 +1,130 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"testing"
+)
+
+func TestParseUname(t *testing.T) {
+	osName, archName, err := parseUname("Linux node1 4.18.0-305.el8.x86_64 #1 SMP Tue Jun 1 16:14:33 UTC 2021 x86_64 x86_64 x86_64 GNU/Linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if osName != "linux" || archName != "amd64" {
+		t.Fatal("invalid result:", osName, archName)
+	}
+
+	_, _, err = parseUname("FreeBSD node1 12.2-RELEASE amd64")
+	if err == nil {
+		t.Fatal("should not support freebsd")
+	}
+}
+
+func TestParseDfAvailableMB(t *testing.T) {
+	availableMB, err := parseDfAvailableMB(`Filesystem     1024-blocks     Used Available Capacity Mounted on
+/dev/vda1         41152812 10234560  29015988      27% /`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if availableMB != 28335 {
+		t.Fatal("invalid available:", availableMB)
+	}
+
+	_, err = parseDfAvailableMB("df: /opt: No such file or directory")
+	if err == nil {
+		t.Fatal("should fail on invalid output")
+	}
+}
+
+func TestParseMemAvailableMB(t *testing.T) {
+	availableMB, err := parseMemAvailableMB(`MemTotal:        1882064 kB
+MemFree:          183584 kB
+MemAvailable:    1048576 kB
+Buffers:            2092 kB
+Cached:          1004460 kB`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if availableMB != 1024 {
+		t.Fatal("invalid available:", availableMB)
+	}
+
+	// 没有MemAvailable
+	availableMB, err = parseMemAvailableMB(`MemTotal:        1882064 kB
+MemFree:          102400 kB
+Buffers:            2048 kB
+Cached:           100352 kB`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if availableMB != 200 {
+		t.Fatal("invalid available:", availableMB)
+	}
+}
+
+func TestParseListeningPorts(t *testing.T) {
+	// ss
+	{
+		var ports = parseListeningPorts(`Netid State  Recv-Q Send-Q Local Address:Port  Peer Address:Port
+udp   UNCONN 0      0      127.0.0.53%lo:53         0.0.0.0:*
+tcp   LISTEN 0      128          0.0.0.0:22         0.0.0.0:*
+tcp   LISTEN 0      511             [::]:80            [::]:*`)
+		for _, port := range []int{53, 22, 80} {
+			_, ok := ports[port]
+			if !ok {
+				t.Fatal("port", port, "should be listening")
+			}
+		}
+		_, ok := ports[443]
+		if ok {
+			t.Fatal("port 443 should not be listening")
+		}
+	}
+
+	// ss with processes
+	{
+		var ports = parseListeningPorts(`Netid State  Recv-Q Send-Q Local Address:Port  Peer Address:Port Process
+tcp   LISTEN 0      511          0.0.0.0:80         0.0.0.0:*     users:(("edge-node",pid=1024,fd=7))
+tcp   LISTEN 0      511             [::]:80            [::]:*     users:(("edge-node",pid=1024,fd=8))
+tcp   LISTEN 0      511          0.0.0.0:443        0.0.0.0:*     users:(("nginx",pid=900,fd=6))
+tcp   LISTEN 0      511             [::]:443           [::]:*     users:(("edge-node",pid=1024,fd=9))`)
+		if ports[80] != "edge-node" {
+			t.Fatal("port 80 should be used by edge-node, but got:", ports[80])
+		}
+		process, ok := ports[443]
+		if !ok || len(process) > 0 {
+			t.Fatal("port 443 should be used by unknown processes, but got:", process)
+		}
+	}
+
+	// netstat
+	{
+		var ports = parseListeningPorts(`Active Internet connections (only servers)
+Proto Recv-Q Send-Q Local Address           Foreign Address         State       PID/Program name
+tcp        0      0 0.0.0.0:443             0.0.0.0:*               LISTEN      1024/edge-node
+tcp6       0      0 :::8080                 :::*                    LISTEN      -`)
+		if ports[443] != "edge-node" {
+			t.Fatal("invalid ports:", ports)
+		}
+		process, ok := ports[8080]
+		if !ok || len(process) > 0 {
+			t.Fatal("invalid ports:", ports)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, c := range []struct {
+		s      string
+		result string
+	}{
+		{"/opt/edge-node", "'/opt/edge-node'"},
+		{`/opt/"$(reboot)"`, `'/opt/"$(reboot)"'`},
+		{"/opt/it's", `'/opt/it'\''s'`},
+	} {
+		if shellQuote(c.s) != c.result {
+			t.Fatal("quote", c.s, "expected:", c.result, "actual:", shellQuote(c.s))
+		}
+	}
+}
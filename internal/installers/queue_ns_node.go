@@ -88,68 +88,15 @@ func (this *NSNodeQueue) InstallNode(nodeId int64, installStatus *models.NodeIns
 		return errors.New("can not find node, ID：'" + numberutils.FormatInt64(nodeId) + "'")
 	}
 
-	// 登录信息
-	login, err := models.SharedNodeLoginDAO.FindEnabledNodeLoginWithNodeId(nil, nodeconfigs.NodeRoleDNS, nodeId)
-	if err != nil {
-		return err
-	}
-	if login == nil {
-		installStatus.ErrorCode = "EMPTY_LOGIN"
-		return errors.New("can not find node login information")
-	}
-	loginParams, err := login.DecodeSSHParams()
-	if err != nil {
-		return err
-	}
-
-	if len(loginParams.Host) == 0 {
-		installStatus.ErrorCode = "EMPTY_SSH_HOST"
-		return errors.New("ssh host should not be empty")
-	}
-
-	if loginParams.Port <= 0 {
-		installStatus.ErrorCode = "EMPTY_SSH_PORT"
-		return errors.New("ssh port is invalid")
-	}
-
-	if loginParams.GrantId == 0 {
-		// 从集群中读取
-		grantId, err := models.SharedNSClusterDAO.FindClusterGrantId(nil, int64(node.ClusterId))
-		if err != nil {
-			return err
-		}
-		if grantId == 0 {
-			installStatus.ErrorCode = "EMPTY_GRANT"
-			return errors.New("can not find node grant")
-		}
-		loginParams.GrantId = grantId
-	}
-	grant, err := models.SharedNodeGrantDAO.FindEnabledNodeGrant(nil, loginParams.GrantId)
+	// 登录
+	installer, installDir, err := this.login(nodeId)
 	if err != nil {
+		installStatus.ErrorCode = LoginErrorCode(err)
 		return err
 	}
-	if grant == nil {
-		installStatus.ErrorCode = "EMPTY_GRANT"
-		return errors.New("can not find user grant with id '" + numberutils.FormatInt64(loginParams.GrantId) + "'")
-	}
-
-	// 安装目录
-	installDir := node.InstallDir
-	if len(installDir) == 0 {
-		clusterId := node.ClusterId
-		cluster, err := models.SharedNSClusterDAO.FindEnabledNSCluster(nil, int64(clusterId))
-		if err != nil {
-			return err
-		}
-		if cluster == nil {
-			return errors.New("can not find cluster, ID：'" + fmt.Sprintf("%d", clusterId) + "'")
-		}
-		installDir = cluster.InstallDir
-		if len(installDir) == 0 {
-			// 默认是 $登录用户/edge-dns
-			installDir = "/" + grant.Username + "/edge-dns"
-		}
-	}
+	defer func() {
+		_ = installer.Close()
+	}()
 
 	// API终端
 	apiNodes, err := models.SharedAPINodeDAO.FindAllEnabledAndOnAPINodes(nil)
@@ -171,30 +118,33 @@ func (this *NSNodeQueue) InstallNode(nodeId int64, installStatus *models.NodeIns
 		}
 	}
 
-	params := &NodeParams{
-		Endpoints:   apiEndpoints,
-		NodeId:      node.UniqueId,
-		Secret:      node.Secret,
-		IsUpgrading: isUpgrading,
+	// 集群允许安装的版本范围
+	versionRange, err := models.SharedNSClusterDAO.FindClusterPackageVersionRange(nil, int64(node.ClusterId))
+	if err != nil {
+		return err
 	}
 
-	installer := &NSNodeInstaller{}
-	err = installer.Login(&Credentials{
-		Host:       loginParams.Host,
-		Port:       loginParams.Port,
-		Username:   grant.Username,
-		Password:   grant.Password,
-		PrivateKey: grant.PrivateKey,
-		Passphrase: grant.Passphrase,
-		Method:     grant.Method,
+	params := &NodeParams{
+		Endpoints:           apiEndpoints,
+		NodeId:              node.UniqueId,
+		Secret:              node.Secret,
+		IsUpgrading:         isUpgrading,
+		PackageVersionRange: versionRange,
+	}
+
+	// 安装前检查
+	installStatus.Preflight = installer.Preflight(&PreflightOptions{
+		Role:         nodeconfigs.NodeRoleDNS,
+		Dir:          installDir,
+		Ports:        PreflightNSNodePorts,
+		IsUpgrading:  isUpgrading,
+		VersionRange: versionRange,
 	})
+	err = PreflightError(installStatus.Preflight)
 	if err != nil {
-		installStatus.ErrorCode = "SSH_LOGIN_FAILED"
+		installStatus.ErrorCode = "PREFLIGHT_FAILED"
 		return err
 	}
-	defer func() {
-		_ = installer.Close()
-	}()
 
 	err = installer.Install(installDir, params, installStatus)
 	return err
@@ -202,170 +152,218 @@ func (this *NSNodeQueue) InstallNode(nodeId int64, installStatus *models.NodeIns
 
 // StartNode 启动边缘节点
 func (this *NSNodeQueue) StartNode(nodeId int64) error {
-	node, err := models.SharedNSNodeDAO.FindEnabledNSNode(nil, nodeId)
+	installer, installDir, err := this.login(nodeId)
 	if err != nil {
 		return err
 	}
-	if node == nil {
-		return errors.New("can not find node, ID：'" + numberutils.FormatInt64(nodeId) + "'")
+	defer func() {
+		_ = installer.Close()
+	}()
+
+	// 检查命令是否存在
+	exeFile := installDir + "/edge-dns/bin/edge-dns"
+	_, err = installer.client.Stat(exeFile)
+	if err != nil {
+		return errors.New("edge node is not installed correctly, can not find executable file: " + exeFile)
 	}
 
-	// 登录信息
-	login, err := models.SharedNodeLoginDAO.FindEnabledNodeLoginWithNodeId(nil, nodeconfigs.NodeRoleDNS, nodeId)
+	// 我们先尝试Systemd启动
+	_, _, _ = installer.client.Exec("systemctl start edge-dns")
+
+	_, stderr, err := installer.client.Exec(exeFile + " start")
 	if err != nil {
-		return err
+		return errors.New("start failed: " + err.Error())
 	}
-	if login == nil {
-		return errors.New("can not find node login information")
+	if len(stderr) > 0 {
+		return errors.New("start failed: " + stderr)
 	}
-	loginParams, err := login.DecodeSSHParams()
+
+	return nil
+}
+
+// StopNode 停止节点
+func (this *NSNodeQueue) StopNode(nodeId int64) error {
+	installer, installDir, err := this.login(nodeId)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = installer.Close()
+	}()
 
-	if len(loginParams.Host) == 0 {
-		return errors.New("ssh host should not be empty")
+	// 检查命令是否存在
+	exeFile := installDir + "/edge-dns/bin/edge-dns"
+	_, err = installer.client.Stat(exeFile)
+	if err != nil {
+		return errors.New("edge node is not installed correctly, can not find executable file: " + exeFile)
 	}
 
-	if loginParams.Port <= 0 {
-		return errors.New("ssh port is invalid")
-	}
+	// 我们先尝试Systemd停止
+	_, _, _ = installer.client.Exec("systemctl stop edge-dns")
 
-	if loginParams.GrantId == 0 {
-		// 从集群中读取
-		grantId, err := models.SharedNSClusterDAO.FindClusterGrantId(nil, int64(node.ClusterId))
-		if err != nil {
-			return err
-		}
-		if grantId == 0 {
-			return errors.New("can not find node grant")
-		}
-		loginParams.GrantId = grantId
+	_, stderr, err := installer.client.Exec(exeFile + " stop")
+	if err != nil {
+		return errors.New("stop failed: " + err.Error())
 	}
-	grant, err := models.SharedNodeGrantDAO.FindEnabledNodeGrant(nil, loginParams.GrantId)
+	if len(stderr) > 0 {
+		return errors.New("stop failed: " + stderr)
+	}
+
+	return nil
+}
+
+// DecommissionNodeProcess 下线DNS节点流程控制
+// 先通过SSH卸载节点，再吊销节点Token并禁用节点；远程卸载失败时，只有强制下线才会继续
+func (this *NSNodeQueue) DecommissionNodeProcess(decommissionId int64, nodeId int64, isForced bool) error {
+	node, err := models.SharedNSNodeDAO.FindEnabledNSNode(nil, nodeId)
 	if err != nil {
-		return err
+		return finishDecommission(decommissionId, nil, err)
 	}
-	if grant == nil {
-		return errors.New("can not find user grant with id '" + numberutils.FormatInt64(loginParams.GrantId) + "'")
+	if node == nil {
+		return finishDecommission(decommissionId, nil, errors.New("can not find node, ID：'"+numberutils.FormatInt64(nodeId)+"'"))
 	}
 
-	// 安装目录
-	installDir := node.InstallDir
-	if len(installDir) == 0 {
-		clusterId := node.ClusterId
-		cluster, err := models.SharedNSClusterDAO.FindEnabledNSCluster(nil, int64(clusterId))
+	// 远程卸载
+	var steps = []*models.NodeDecommissionStep{}
+	uninstallErr := func() error {
+		installer, installDir, err := this.login(nodeId)
 		if err != nil {
+			steps = append(steps, newDecommissionStep("login", err, ""))
 			return err
 		}
-		if cluster == nil {
-			return errors.New("can not find cluster, ID：'" + fmt.Sprintf("%d", clusterId) + "'")
-		}
-		installDir = cluster.InstallDir
-		if len(installDir) == 0 {
-			// 默认是 $登录用户/edge-dns
-			installDir = "/" + grant.Username + "/edge-dns"
-		}
+		defer func() {
+			_ = installer.Close()
+		}()
+		steps = append(steps, newDecommissionStep("login", nil, "logged in"))
+
+		uninstallSteps, err := installer.Uninstall(installDir, "edge-dns")
+		steps = append(steps, uninstallSteps...)
+		return err
+	}()
+	if uninstallErr != nil && !isForced {
+		return finishDecommission(decommissionId, steps, uninstallErr)
 	}
 
-	installer := &NSNodeInstaller{}
-	err = installer.Login(&Credentials{
-		Host:       loginParams.Host,
-		Port:       loginParams.Port,
-		Username:   grant.Username,
-		Password:   grant.Password,
-		PrivateKey: grant.PrivateKey,
-		Passphrase: grant.Passphrase,
-		Method:     grant.Method,
-	})
+	// 吊销Token
+	err = models.SharedApiTokenDAO.RevokeTokenWithNode(nil, node.UniqueId)
+	steps = append(steps, newDecommissionStep("revokeToken", err, "revoked"))
 	if err != nil {
-		return err
+		return finishDecommission(decommissionId, steps, err)
+	}
+
+	// 删除节点相关任务
+	err = models.SharedNodeTaskDAO.DeleteNodeTasks(nil, nodeconfigs.NodeRoleDNS, nodeId)
+	if err != nil {
+		return finishDecommission(decommissionId, steps, err)
+	}
+
+	// 禁用节点
+	err = models.SharedNSNodeDAO.DisableNSNode(nil, nodeId)
+	steps = append(steps, newDecommissionStep("disable", err, "disabled"))
+	return finishDecommission(decommissionId, steps, err)
+}
+
+// PreflightNode 安装前检查节点系统环境
+func (this *NSNodeQueue) PreflightNode(nodeId int64, isUpgrading bool) ([]*models.NodeInstallPreflightItem, error) {
+	installer, installDir, err := this.login(nodeId)
+	if err != nil {
+		return nil, err
 	}
 	defer func() {
 		_ = installer.Close()
 	}()
 
-	// 检查命令是否存在
-	exeFile := installDir + "/edge-dns/bin/edge-dns"
-	_, err = installer.client.Stat(exeFile)
+	clusterId, err := models.SharedNSNodeDAO.FindNodeClusterId(nil, nodeId)
 	if err != nil {
-		return errors.New("edge node is not installed correctly, can not find executable file: " + exeFile)
+		return nil, err
+	}
+	versionRange, err := models.SharedNSClusterDAO.FindClusterPackageVersionRange(nil, clusterId)
+	if err != nil {
+		return nil, err
 	}
 
-	// 我们先尝试Systemd启动
-	_, _, _ = installer.client.Exec("systemctl start edge-dns")
+	return installer.Preflight(&PreflightOptions{
+		Role:         nodeconfigs.NodeRoleDNS,
+		Dir:          installDir,
+		Ports:        PreflightNSNodePorts,
+		IsUpgrading:  isUpgrading,
+		VersionRange: versionRange,
+	}), nil
+}
 
-	_, stderr, err := installer.client.Exec(exeFile + " start")
+// RunDiagnostics 通过SSH在DNS节点上执行诊断命令
+func (this *NSNodeQueue) RunDiagnostics(nodeId int64, codes []string) ([]*DiagnosticResult, error) {
+	installer, installDir, err := this.login(nodeId)
 	if err != nil {
-		return errors.New("start failed: " + err.Error())
-	}
-	if len(stderr) > 0 {
-		return errors.New("start failed: " + stderr)
+		return nil, err
 	}
+	defer func() {
+		_ = installer.Close()
+	}()
 
-	return nil
+	return installer.RunDiagnostics(installDir, "edge-dns", codes)
 }
 
-// StopNode 停止节点
-func (this *NSNodeQueue) StopNode(nodeId int64) error {
+// 登录DNS节点，返回安装器和安装目录
+func (this *NSNodeQueue) login(nodeId int64) (installer *NSNodeInstaller, installDir string, err error) {
 	node, err := models.SharedNSNodeDAO.FindEnabledNSNode(nil, nodeId)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 	if node == nil {
-		return errors.New("can not find node, ID：'" + numberutils.FormatInt64(nodeId) + "'")
+		return nil, "", errors.New("can not find node, ID：'" + numberutils.FormatInt64(nodeId) + "'")
 	}
 
 	// 登录信息
 	login, err := models.SharedNodeLoginDAO.FindEnabledNodeLoginWithNodeId(nil, nodeconfigs.NodeRoleDNS, nodeId)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 	if login == nil {
-		return errors.New("can not find node login information")
+		return nil, "", newLoginError("EMPTY_LOGIN", errors.New("can not find node login information"))
 	}
 	loginParams, err := login.DecodeSSHParams()
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
 	if len(loginParams.Host) == 0 {
-		return errors.New("ssh host should not be empty")
+		return nil, "", newLoginError("EMPTY_SSH_HOST", errors.New("ssh host should not be empty"))
 	}
 
 	if loginParams.Port <= 0 {
-		return errors.New("ssh port is invalid")
+		return nil, "", newLoginError("EMPTY_SSH_PORT", errors.New("ssh port is invalid"))
 	}
 
 	if loginParams.GrantId == 0 {
 		// 从集群中读取
 		grantId, err := models.SharedNSClusterDAO.FindClusterGrantId(nil, int64(node.ClusterId))
 		if err != nil {
-			return err
+			return nil, "", err
 		}
 		if grantId == 0 {
-			return errors.New("can not find node grant")
+			return nil, "", newLoginError("EMPTY_GRANT", errors.New("can not find node grant"))
 		}
 		loginParams.GrantId = grantId
 	}
 	grant, err := models.SharedNodeGrantDAO.FindEnabledNodeGrant(nil, loginParams.GrantId)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 	if grant == nil {
-		return errors.New("can not find user grant with id '" + numberutils.FormatInt64(loginParams.GrantId) + "'")
+		return nil, "", newLoginError("EMPTY_GRANT", errors.New("can not find user grant with id '"+numberutils.FormatInt64(loginParams.GrantId)+"'"))
 	}
 
 	// 安装目录
-	installDir := node.InstallDir
+	installDir = node.InstallDir
 	if len(installDir) == 0 {
 		clusterId := node.ClusterId
 		cluster, err := models.SharedNSClusterDAO.FindEnabledNSCluster(nil, int64(clusterId))
 		if err != nil {
-			return err
+			return nil, "", err
 		}
 		if cluster == nil {
-			return errors.New("can not find cluster, ID：'" + fmt.Sprintf("%d", clusterId) + "'")
+			return nil, "", errors.New("can not find cluster, ID：'" + fmt.Sprintf("%d", clusterId) + "'")
 		}
 		installDir = cluster.InstallDir
 		if len(installDir) == 0 {
@@ -374,8 +372,8 @@ func (this *NSNodeQueue) StopNode(nodeId int64) error {
 		}
 	}
 
-	installer := &NSNodeInstaller{}
-	err = installer.Login(&Credentials{
+	installer = &NSNodeInstaller{}
+	err = installer.LoginWithNodeLogin(login, &Credentials{
 		Host:       loginParams.Host,
 		Port:       loginParams.Port,
 		Username:   grant.Username,
@@ -385,29 +383,10 @@ func (this *NSNodeQueue) StopNode(nodeId int64) error {
 		Method:     grant.Method,
 	})
 	if err != nil {
-		return err
-	}
-	defer func() {
-		_ = installer.Close()
-	}()
-
-	// 检查命令是否存在
-	exeFile := installDir + "/edge-dns/bin/edge-dns"
-	_, err = installer.client.Stat(exeFile)
-	if err != nil {
-		return errors.New("edge node is not installed correctly, can not find executable file: " + exeFile)
-	}
-
-	// 我们先尝试Systemd停止
-	_, _, _ = installer.client.Exec("systemctl stop edge-dns")
-
-	_, stderr, err := installer.client.Exec(exeFile + " stop")
-	if err != nil {
-		return errors.New("stop failed: " + err.Error())
-	}
-	if len(stderr) > 0 {
-		return errors.New("stop failed: " + stderr)
+		if IsHostKeyMismatchError(err) {
+			return nil, "", newLoginError(ErrorCodeSSHHostKeyMismatch, err)
+		}
+		return nil, "", newLoginError("SSH_LOGIN_FAILED", err)
 	}
-
-	return nil
+	return installer, installDir, nil
 }
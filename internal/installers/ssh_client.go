@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 	"io"
 	"net"
 	"os"
@@ -13,6 +14,9 @@ import (
 type SSHClient struct {
 	raw  *ssh.Client
 	sftp *sftp.Client
+
+	jumpClients     []*ssh.Client // 经过的跳板机连接
+	agentForwarding bool          // 是否在会话中请求转发认证代理
 }
 
 func NewSSHClient(raw *ssh.Client) (*SSHClient, error) {
@@ -40,6 +44,13 @@ func (this *SSHClient) Exec(cmd string) (stdout string, stderr string, err error
 		_ = session.Close()
 	}()
 
+	if this.agentForwarding {
+		err = agent.RequestAgentForwarding(session)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
 	stdoutBuf := bytes.NewBuffer([]byte{})
 	stderrBuf := bytes.NewBuffer([]byte{})
 	session.Stdout = stdoutBuf
@@ -63,7 +74,15 @@ func (this *SSHClient) Close() error {
 	if this.sftp != nil {
 		_ = this.sftp.Close()
 	}
-	return this.raw.Close()
+	err := this.raw.Close()
+
+	// 从最后一台跳板机开始关闭
+	for i := len(this.jumpClients) - 1; i >= 0; i-- {
+		_ = this.jumpClients[i].Close()
+	}
+	this.jumpClients = nil
+
+	return err
 }
 
 func (this *SSHClient) OpenFile(path string, flags int) (*sftp.File, error) {
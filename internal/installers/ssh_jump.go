@@ -0,0 +1,121 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package installers
+
+import (
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"time"
+)
+
+// 生成SSH认证方式
+func newSSHAuthMethods(credentials *Credentials) ([]ssh.AuthMethod, error) {
+	methods := []ssh.AuthMethod{}
+	if credentials.Method == "user" {
+		{
+			authMethod := ssh.Password(credentials.Password)
+			methods = append(methods, authMethod)
+		}
+
+		{
+			authMethod := ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) (answers []string, err error) {
+				if len(questions) == 0 {
+					return []string{}, nil
+				}
+				return []string{credentials.Password}, nil
+			})
+			methods = append(methods, authMethod)
+		}
+	} else if credentials.Method == "privateKey" {
+		key, err := parseCredentialsPrivateKey(credentials)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.NewSignerFromKey(key)
+		if err != nil {
+			return nil, errors.New("parse private key: " + err.Error())
+		}
+		authMethod := ssh.PublicKeys(signer)
+		methods = append(methods, authMethod)
+	} else {
+		return nil, errors.New("invalid method '" + credentials.Method + "'")
+	}
+	return methods, nil
+}
+
+// 解析认证中的私钥
+func parseCredentialsPrivateKey(credentials *Credentials) (interface{}, error) {
+	var key interface{}
+	var err error
+	if len(credentials.Passphrase) > 0 {
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase([]byte(credentials.PrivateKey), []byte(credentials.Passphrase))
+	} else {
+		key, err = ssh.ParseRawPrivateKey([]byte(credentials.PrivateKey))
+	}
+	if err != nil {
+		return nil, errors.New("parse private key: " + err.Error())
+	}
+	return key, nil
+}
+
+// 通过已有的SSH连接（跳板机）连接到下一台主机
+// 和下一台主机之间的SSH会话是端到端加密的，跳板机只负责转发TCP数据
+func dialVia(via *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 握手超时，和直接连接时 ssh.Dial 的行为保持一致
+	// 通过跳板机转发的连接不支持设置deadline，此时超时后直接关闭连接
+	var timer *time.Timer
+	if config.Timeout > 0 {
+		err = conn.SetDeadline(time.Now().Add(config.Timeout))
+		if err != nil {
+			timer = time.AfterFunc(config.Timeout, func() {
+				_ = conn.Close()
+			})
+		}
+	}
+
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if timer != nil && !timer.Stop() && err == nil {
+		_ = clientConn.Close()
+		return nil, errors.New("ssh: handshake with '" + addr + "' timeout")
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if config.Timeout > 0 && timer == nil {
+		_ = conn.SetDeadline(time.Time{})
+	}
+	return ssh.NewClient(clientConn, chans, reqs), nil
+}
+
+// 在内存中生成认证代理，并转发到目标主机
+// 目标主机上的命令可以使用此代理继续认证，但私钥不会离开当前进程
+func (this *SSHClient) forwardAgent(credentials *Credentials) error {
+	if credentials.Method != "privateKey" {
+		return errors.New("agent forwarding requires 'privateKey' method")
+	}
+	key, err := parseCredentialsPrivateKey(credentials)
+	if err != nil {
+		return err
+	}
+	keyring := agent.NewKeyring()
+	err = keyring.Add(agent.AddedKey{
+		PrivateKey: key,
+		Comment:    "edge-api",
+	})
+	if err != nil {
+		return err
+	}
+	err = agent.ForwardToAgent(this.raw, keyring)
+	if err != nil {
+		return err
+	}
+	this.agentForwarding = true
+	return nil
+}
@@ -1,5 +0,0 @@
-package iplibrary
-
-func init() {
-
-}
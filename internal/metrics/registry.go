@@ -0,0 +1,199 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var SharedRegistry = NewRegistry()
+
+// Counter 只增不减的计数器
+type Counter struct {
+	value int64
+}
+
+// Add 增加数值
+func (this *Counter) Add(delta int64) {
+	atomic.AddInt64(&this.value, delta)
+}
+
+// Increase 加一
+func (this *Counter) Increase() {
+	atomic.AddInt64(&this.value, 1)
+}
+
+// Value 当前数值
+func (this *Counter) Value() int64 {
+	return atomic.LoadInt64(&this.value)
+}
+
+// Gauge 可以增减的数值
+type Gauge struct {
+	value int64
+}
+
+// Set 设置数值
+func (this *Gauge) Set(value int64) {
+	atomic.StoreInt64(&this.value, value)
+}
+
+// Add 增加数值，可以为负数
+func (this *Gauge) Add(delta int64) {
+	atomic.AddInt64(&this.value, delta)
+}
+
+// Value 当前数值
+func (this *Gauge) Value() int64 {
+	return atomic.LoadInt64(&this.value)
+}
+
+type metricType = string
+
+const (
+	metricTypeCounter metricType = "counter"
+	metricTypeGauge   metricType = "gauge"
+)
+
+type metricItem struct {
+	name   string
+	labels string
+	kind   metricType
+	help   string
+
+	counter *Counter
+	gauge   *Gauge
+}
+
+// Registry 指标注册表，用来输出API节点自身的运行指标
+type Registry struct {
+	itemsMap map[string]*metricItem // name{labels} => item
+	helpMap  map[string]string      // name => help
+	locker   sync.RWMutex
+}
+
+// NewRegistry 获取新对象
+func NewRegistry() *Registry {
+	return &Registry{
+		itemsMap: map[string]*metricItem{},
+		helpMap:  map[string]string{},
+	}
+}
+
+// Describe 设置指标说明
+func (this *Registry) Describe(name string, help string) {
+	this.locker.Lock()
+	this.helpMap[name] = help
+	this.locker.Unlock()
+}
+
+// Counter 获取计数器，如果不存在则创建
+// labels 为 key1, value1, key2, value2 ... 形式
+func (this *Registry) Counter(name string, labels ...string) *Counter {
+	return this.find(name, metricTypeCounter, labels).counter
+}
+
+// Gauge 获取数值，如果不存在则创建
+func (this *Registry) Gauge(name string, labels ...string) *Gauge {
+	return this.find(name, metricTypeGauge, labels).gauge
+}
+
+// WriteText 以Prometheus文本格式输出所有指标
+func (this *Registry) WriteText(writer io.Writer) error {
+	this.locker.RLock()
+	var keys = []string{}
+	for key := range this.itemsMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var items = []*metricItem{}
+	for _, key := range keys {
+		items = append(items, this.itemsMap[key])
+	}
+	var helpMap = map[string]string{}
+	for name, help := range this.helpMap {
+		helpMap[name] = help
+	}
+	this.locker.RUnlock()
+
+	var lastName = ""
+	for _, item := range items {
+		if item.name != lastName {
+			lastName = item.name
+			help, ok := helpMap[item.name]
+			if ok {
+				_, err := fmt.Fprintf(writer, "# HELP %s %s\n", item.name, help)
+				if err != nil {
+					return err
+				}
+			}
+			_, err := fmt.Fprintf(writer, "# TYPE %s %s\n", item.name, item.kind)
+			if err != nil {
+				return err
+			}
+		}
+
+		var value int64
+		switch item.kind {
+		case metricTypeCounter:
+			value = item.counter.Value()
+		case metricTypeGauge:
+			value = item.gauge.Value()
+		}
+		_, err := fmt.Fprintf(writer, "%s%s %d\n", item.name, item.labels, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *Registry) find(name string, kind metricType, labels []string) *metricItem {
+	var labelString = this.formatLabels(labels)
+	var key = name + labelString
+
+	this.locker.RLock()
+	item, ok := this.itemsMap[key]
+	this.locker.RUnlock()
+	if ok {
+		return item
+	}
+
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	item, ok = this.itemsMap[key]
+	if ok {
+		return item
+	}
+	item = &metricItem{
+		name:   name,
+		labels: labelString,
+		kind:   kind,
+	}
+	switch kind {
+	case metricTypeCounter:
+		item.counter = &Counter{}
+	case metricTypeGauge:
+		item.gauge = &Gauge{}
+	}
+	this.itemsMap[key] = item
+	return item
+}
+
+func (this *Registry) formatLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	var pieces = []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		var value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		pieces = append(pieces, labels[i]+`="`+value+`"`)
+	}
+	return "{" + strings.Join(pieces, ",") + "}"
+}
@@ -0,0 +1,29 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	var registry = NewRegistry()
+	registry.Describe("edge_api_requests_total", "total requests")
+	registry.Counter("edge_api_requests_total", "role", "admin").Increase()
+	registry.Counter("edge_api_requests_total", "role", "admin").Add(2)
+	registry.Counter("edge_api_requests_total", "role", "node").Increase()
+	registry.Gauge("edge_api_queue_size").Set(10)
+
+	var buf = &bytes.Buffer{}
+	err := registry.WriteText(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(buf.String())
+
+	if !strings.Contains(buf.String(), `edge_api_requests_total{role="admin"} 3`) {
+		t.Fatal("counter value should be 3")
+	}
+}
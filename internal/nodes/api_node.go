@@ -9,8 +9,10 @@ import (
 	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	"github.com/TeaOSLab/EdgeAPI/internal/events"
+	"github.com/TeaOSLab/EdgeAPI/internal/ratelimit"
 	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
 	"github.com/TeaOSLab/EdgeAPI/internal/setup"
+	"github.com/TeaOSLab/EdgeAPI/internal/tracing"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	"github.com/go-yaml/yaml"
 	"github.com/iwind/TeaGo/Tea"
@@ -123,6 +125,12 @@ func (this *APINode) Start() {
 	// 访问日志存储管理器
 	go accesslogs.SharedStorageManager.Start()
 
+	// 调用限流
+	go ratelimit.SharedLimiter.Start()
+
+	// 链路追踪
+	go tracing.SharedTracer.Start()
+
 	// 监听RPC服务
 	remotelogs.Println("API_NODE", "starting RPC server ...")
 
@@ -204,13 +212,18 @@ func (this *APINode) InstallSystemService() error {
 
 // 启动RPC监听
 func (this *APINode) listenRPC(listener net.Listener, tlsConfig *tls.Config) error {
+	var options = []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(this.unaryTracingInterceptor, this.unaryRateLimitInterceptor),
+		grpc.ChainStreamInterceptor(this.streamTracingInterceptor, this.streamRateLimitInterceptor),
+	}
+
 	var rpcServer *grpc.Server
 	if tlsConfig == nil {
 		remotelogs.Println("API_NODE", "listening GRPC http://"+listener.Addr().String()+" ...")
-		rpcServer = grpc.NewServer()
+		rpcServer = grpc.NewServer(options...)
 	} else {
 		logs.Println("[API_NODE]listening GRPC https://" + listener.Addr().String() + " ...")
-		rpcServer = grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+		rpcServer = grpc.NewServer(append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))...)
 	}
 	this.registerServices(rpcServer)
 	err := rpcServer.Serve(listener)
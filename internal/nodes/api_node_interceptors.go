@@ -0,0 +1,44 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package nodes
+
+import (
+	"context"
+	"github.com/TeaOSLab/EdgeAPI/internal/ratelimit"
+	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/iwind/TeaGo/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errTooManyRequests = status.Error(codes.ResourceExhausted, "too many requests, please try again later")
+
+// 普通调用限流
+func (this *APINode) unaryRateLimitInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	ctx, ok := allowRPCRequest(ctx, info.FullMethod)
+	if !ok {
+		return nil, errTooManyRequests
+	}
+	return handler(ctx, req)
+}
+
+// 流式调用限流，只在建立连接时检查
+func (this *APINode) streamRateLimitInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, ok := allowRPCRequest(stream.Context(), info.FullMethod)
+	if !ok {
+		return errTooManyRequests
+	}
+	return handler(srv, &contextServerStream{ServerStream: stream, ctx: ctx})
+}
+
+// 检查调用者是否超出限制
+// 校验过的身份会放入返回的上下文中，服务中调用 ValidateRequest() 时不再重复校验
+func allowRPCRequest(ctx context.Context, method string) (context.Context, bool) {
+	ctx, identity := rpcutils.ContextWithIdentity(ctx)
+	if !identity.IsAuthenticated() {
+		// 未认证的请求按客户端IP限流，认证失败由服务自行处理
+		return ctx, ratelimit.SharedLimiter.AllowAnonymous(rpcutils.RequestPeerIP(ctx), method)
+	}
+	return ctx, ratelimit.SharedLimiter.Allow(identity.UserType, types.String(identity.UserId), method)
+}
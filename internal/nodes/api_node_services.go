@@ -38,6 +38,31 @@ func (this *APINode) registerServices(server *grpc.Server) {
 		pb.RegisterNodeServiceServer(server, instance)
 		this.rest(instance)
 	}
+	{
+		instance := this.serviceInstance(&services.NodeInstallJobService{}).(*services.NodeInstallJobService)
+		pb.RegisterNodeInstallJobServiceServer(server, instance)
+		this.rest(instance)
+	}
+	{
+		instance := this.serviceInstance(&services.NodeDecommissionService{}).(*services.NodeDecommissionService)
+		pb.RegisterNodeDecommissionServiceServer(server, instance)
+		this.rest(instance)
+	}
+	{
+		instance := this.serviceInstance(&services.NodeJoinTokenService{}).(*services.NodeJoinTokenService)
+		pb.RegisterNodeJoinTokenServiceServer(server, instance)
+		this.rest(instance)
+	}
+	{
+		instance := this.serviceInstance(&services.DeployPackageService{}).(*services.DeployPackageService)
+		pb.RegisterDeployPackageServiceServer(server, instance)
+		this.rest(instance)
+	}
+	{
+		instance := this.serviceInstance(&services.NodeDiagnosticsService{}).(*services.NodeDiagnosticsService)
+		pb.RegisterNodeDiagnosticsServiceServer(server, instance)
+		this.rest(instance)
+	}
 	{
 		instance := this.serviceInstance(&services.NodeClusterService{}).(*services.NodeClusterService)
 		pb.RegisterNodeClusterServiceServer(server, instance)
@@ -537,6 +562,16 @@ func (this *APINode) registerServices(server *grpc.Server) {
 		pb.RegisterUserPlanServiceServer(server, instance)
 		this.rest(instance)
 	}
+	{
+		instance := this.serviceInstance(&services.WebhookService{}).(*services.WebhookService)
+		pb.RegisterWebhookServiceServer(server, instance)
+		this.rest(instance)
+	}
+	{
+		instance := this.serviceInstance(&services.HTTPAccessLogExportService{}).(*services.HTTPAccessLogExportService)
+		pb.RegisterHTTPAccessLogExportServiceServer(server, instance)
+		this.rest(instance)
+	}
 
 	APINodeServicesRegister(this, server)
 
@@ -0,0 +1,84 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package nodes
+
+import (
+	"context"
+	"github.com/TeaOSLab/EdgeAPI/internal/tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// 普通调用链路追踪
+func (this *APINode) unaryTracingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	ctx, span := startRPCSpan(ctx, info.FullMethod)
+	if span == nil {
+		return handler(ctx, req)
+	}
+	defer func() {
+		endRPCSpan(span, err)
+	}()
+
+	return handler(ctx, req)
+}
+
+// 流式调用链路追踪，跨度覆盖整个流的生命周期
+func (this *APINode) streamTracingInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	ctx, span := startRPCSpan(stream.Context(), info.FullMethod)
+	if span == nil {
+		return handler(srv, stream)
+	}
+	defer func() {
+		endRPCSpan(span, err)
+	}()
+
+	return handler(srv, &contextServerStream{ServerStream: stream, ctx: ctx})
+}
+
+func startRPCSpan(ctx context.Context, fullMethod string) (context.Context, *tracing.Span) {
+	var traceParent = ""
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		var values = md.Get("traceparent")
+		if len(values) > 0 {
+			traceParent = values[0]
+		}
+	}
+
+	ctx, span := tracing.SharedTracer.StartServerSpan(ctx, fullMethod, traceParent)
+	if span == nil {
+		return ctx, nil
+	}
+
+	// fullMethod 格式为 /pb.ServerService/createServer
+	span.SetAttribute("rpc.system", "grpc")
+	var pieces = strings.SplitN(strings.TrimPrefix(fullMethod, "/"), "/", 2)
+	if len(pieces) == 2 {
+		span.SetAttribute("rpc.service", pieces[0])
+		span.SetAttribute("rpc.method", pieces[1])
+	}
+	return ctx, span
+}
+
+func endRPCSpan(span *tracing.Span, err error) {
+	if err != nil {
+		span.SetAttribute("rpc.grpc.status_code", int(status.Code(err)))
+		span.SetError(err)
+	} else {
+		span.SetAttribute("rpc.grpc.status_code", 0)
+	}
+	span.End()
+}
+
+// 使用新上下文的流，比如带有跨度或者调用者身份的上下文
+type contextServerStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+}
+
+func (this *contextServerStream) Context() context.Context {
+	return this.ctx
+}
@@ -0,0 +1,332 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package nodes
+
+import (
+	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
+	"github.com/iwind/TeaGo/maps"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var openAPIDocumentOnce = sync.Once{}
+var openAPIDocument maps.Map
+
+// 获取OpenAPI文档，文档只在第一次调用时生成
+func sharedOpenAPIDocument(pretty bool) []byte {
+	openAPIDocumentOnce.Do(func() {
+		openAPIDocument = newOpenAPIBuilder().Build()
+	})
+	if pretty {
+		return openAPIDocument.AsPrettyJSON()
+	}
+	return openAPIDocument.AsJSON()
+}
+
+// OpenAPI 3文档生成器
+// 通过反射读取所有已注册的服务和消息
+type openAPIBuilder struct {
+	schemas     maps.Map
+	schemaTypes map[string]reflect.Type // schema name => type
+}
+
+func newOpenAPIBuilder() *openAPIBuilder {
+	return &openAPIBuilder{
+		schemas:     maps.Map{},
+		schemaTypes: map[string]reflect.Type{},
+	}
+}
+
+// Build 生成文档
+func (this *openAPIBuilder) Build() maps.Map {
+	var serviceNames = []string{}
+	for serviceName := range restServicesMap {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	sort.Strings(serviceNames)
+
+	var paths = maps.Map{}
+	var tags = []maps.Map{}
+	for _, serviceName := range serviceNames {
+		var serviceValue = restServicesMap[serviceName]
+		var serviceType = serviceValue.Type()
+		var hasMethods = false
+
+		for i := 0; i < serviceType.NumMethod(); i++ {
+			var method = serviceType.Method(i)
+			var methodName = strings.ToLower(method.Name[:1]) + method.Name[1:]
+			var path = "/" + serviceName + "/" + methodName
+
+			// 去掉接收者
+			var methodType = serviceValue.Method(i).Type()
+
+			if adapter, ok := restStreamAdapters[serviceName+"."+method.Name]; ok && adapter != nil {
+				operation := this.buildStreamOperation(serviceName, methodName, methodType)
+				if operation != nil {
+					paths[path] = maps.Map{"post": operation}
+					hasMethods = true
+				}
+				continue
+			}
+
+			if !isRestUnaryMethod(methodType) {
+				continue
+			}
+			paths[path] = maps.Map{
+				"post": this.buildOperation(serviceName, methodName, methodType),
+			}
+			hasMethods = true
+		}
+
+		if hasMethods {
+			tags = append(tags, maps.Map{"name": serviceName})
+		}
+	}
+
+	this.schemas["Error"] = maps.Map{
+		"type": "object",
+		"properties": maps.Map{
+			"code":    maps.Map{"type": "integer", "format": "int32"},
+			"message": maps.Map{"type": "string"},
+			"data":    maps.Map{"type": "object"},
+		},
+	}
+
+	return maps.Map{
+		"openapi": "3.0.3",
+		"info": maps.Map{
+			"title":   teaconst.ProductName,
+			"version": teaconst.Version,
+		},
+		"tags":  tags,
+		"paths": paths,
+		"components": maps.Map{
+			"schemas": this.schemas,
+			"securitySchemes": maps.Map{
+				"AccessToken": maps.Map{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "X-Edge-Access-Token",
+				},
+			},
+		},
+		"security": []maps.Map{
+			{"AccessToken": []string{}},
+		},
+	}
+}
+
+// 普通方法
+func (this *openAPIBuilder) buildOperation(serviceName string, methodName string, methodType reflect.Type) maps.Map {
+	var responses = this.errorResponses()
+	responses["200"] = maps.Map{
+		"description": "OK",
+		"content": maps.Map{
+			"application/json": maps.Map{
+				"schema": maps.Map{
+					"type": "object",
+					"properties": maps.Map{
+						"code":    maps.Map{"type": "integer", "format": "int32"},
+						"message": maps.Map{"type": "string"},
+						"data":    this.schemaOf(methodType.Out(0)),
+					},
+				},
+			},
+		},
+	}
+
+	return maps.Map{
+		"tags":        []string{serviceName},
+		"operationId": serviceName + "_" + methodName,
+		"requestBody": maps.Map{
+			"content": maps.Map{
+				"application/json": maps.Map{
+					"schema": this.schemaOf(methodType.In(1)),
+				},
+			},
+		},
+		"responses": responses,
+	}
+}
+
+// 流式方法，响应为Server-Sent Events
+// 双向流的请求体中为按行分隔的客户端消息，服务端流的请求体中为单个请求JSON
+func (this *openAPIBuilder) buildStreamOperation(serviceName string, methodName string, methodType reflect.Type) maps.Map {
+	if methodType.NumIn() == 0 {
+		return nil
+	}
+	var streamType = methodType.In(methodType.NumIn() - 1)
+	if streamType.Kind() != reflect.Interface {
+		return nil
+	}
+	sendMethod, ok := streamType.MethodByName("Send")
+	if !ok || sendMethod.Type.NumIn() != 1 {
+		return nil
+	}
+
+	var requestBody maps.Map
+	switch methodType.NumIn() {
+	case 1:
+		recvMethod, ok := streamType.MethodByName("Recv")
+		if !ok || recvMethod.Type.NumOut() != 2 {
+			return nil
+		}
+		requestBody = maps.Map{
+			"required": false,
+			"content": maps.Map{
+				"application/x-ndjson": maps.Map{
+					"schema": this.schemaOf(recvMethod.Type.Out(0)),
+				},
+			},
+		}
+	case 2:
+		if methodType.In(0).Kind() != reflect.Ptr {
+			return nil
+		}
+		requestBody = maps.Map{
+			"required": false,
+			"content": maps.Map{
+				"application/json": maps.Map{
+					"schema": this.schemaOf(methodType.In(0)),
+				},
+			},
+		}
+	default:
+		return nil
+	}
+
+	var responses = this.errorResponses()
+	responses["200"] = maps.Map{
+		"description": "Server-Sent Events, every 'message' event contains one message",
+		"content": maps.Map{
+			"text/event-stream": maps.Map{
+				"schema": this.schemaOf(sendMethod.Type.In(0)),
+			},
+		},
+	}
+
+	return maps.Map{
+		"tags":        []string{serviceName},
+		"operationId": serviceName + "_" + methodName,
+		"requestBody": requestBody,
+		"responses":   responses,
+	}
+}
+
+func (this *openAPIBuilder) errorResponses() maps.Map {
+	var result = maps.Map{}
+	for code, description := range map[string]string{
+		"400": "Bad Request",
+		"401": "Unauthorized",
+		"403": "Forbidden",
+		"404": "Not Found",
+		"429": "Too Many Requests",
+		"500": "Internal Server Error",
+	} {
+		result[code] = maps.Map{
+			"description": description,
+			"content": maps.Map{
+				"application/json": maps.Map{
+					"schema": maps.Map{"$ref": "#/components/schemas/Error"},
+				},
+			},
+		}
+	}
+	return result
+}
+
+// 获取某个类型对应的Schema
+func (this *openAPIBuilder) schemaOf(t reflect.Type) maps.Map {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return this.schemaOf(t.Elem())
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return maps.Map{"type": "object"}
+		}
+		var name = this.schemaName(t)
+		if _, ok := this.schemas[name]; !ok {
+			// 先占位，防止循环引用
+			this.schemas[name] = maps.Map{}
+			this.schemaTypes[name] = t
+			this.schemas[name] = this.structSchema(t)
+		}
+		return maps.Map{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return maps.Map{"type": "string", "format": "byte"}
+		}
+		return maps.Map{
+			"type":  "array",
+			"items": this.schemaOf(t.Elem()),
+		}
+	case reflect.Map:
+		return maps.Map{
+			"type":                 "object",
+			"additionalProperties": this.schemaOf(t.Elem()),
+		}
+	case reflect.Bool:
+		return maps.Map{"type": "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return maps.Map{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return maps.Map{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return maps.Map{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return maps.Map{"type": "number", "format": "double"}
+	case reflect.String:
+		return maps.Map{"type": "string"}
+	}
+	return maps.Map{"type": "object"}
+}
+
+// 获取类型对应的Schema名称，比如 pb.Node
+// 不同的包中可能有同名的类型，所以名称中带有包名；包名也相同时使用完整的包路径
+func (this *openAPIBuilder) schemaName(t reflect.Type) string {
+	var pkgPath = t.PkgPath()
+	var pkgName = pkgPath
+	var index = strings.LastIndex(pkgPath, "/")
+	if index >= 0 {
+		pkgName = pkgPath[index+1:]
+	}
+	var name = t.Name()
+	if len(pkgName) > 0 {
+		name = pkgName + "." + name
+	}
+	existType, ok := this.schemaTypes[name]
+	if !ok || existType == t {
+		return name
+	}
+	return strings.NewReplacer("/", ".", "~", ".").Replace(pkgPath) + "." + t.Name()
+}
+
+func (this *openAPIBuilder) structSchema(t reflect.Type) maps.Map {
+	var properties = maps.Map{}
+	for i := 0; i < t.NumField(); i++ {
+		var field = t.Field(i)
+		if len(field.PkgPath) > 0 { // 非导出字段
+			continue
+		}
+
+		var name = field.Name
+		var tag = field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if len(tag) > 0 {
+			var pieces = strings.Split(tag, ",")
+			if len(pieces[0]) > 0 {
+				name = pieces[0]
+			}
+		}
+		properties[name] = this.schemaOf(field.Type)
+	}
+
+	return maps.Map{
+		"type":       "object",
+		"properties": properties,
+	}
+}
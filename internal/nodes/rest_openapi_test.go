@@ -0,0 +1,46 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package nodes
+
+import (
+	htmltemplate "html/template"
+	"reflect"
+	"testing"
+	texttemplate "text/template"
+)
+
+func TestOpenAPIBuilder_Build(t *testing.T) {
+	var doc = newOpenAPIBuilder().Build()
+	paths := doc.GetMap("paths")
+	if len(paths) == 0 {
+		t.Fatal("paths should not be empty")
+	}
+	_, ok := paths["/APIAccessTokenService/getAPIAccessToken"]
+	if !ok {
+		t.Fatal("'/APIAccessTokenService/getAPIAccessToken' should be in paths")
+	}
+	t.Log(string(doc.AsPrettyJSON()))
+}
+
+func TestOpenAPIBuilder_SchemaName(t *testing.T) {
+	var builder = newOpenAPIBuilder()
+	var textType = reflect.TypeOf(texttemplate.Template{})
+	var htmlType = reflect.TypeOf(htmltemplate.Template{})
+
+	var textName = builder.schemaName(textType)
+	if textName != "template.Template" {
+		t.Fatal("unexpected name:", textName)
+	}
+	builder.schemaTypes[textName] = textType
+
+	// 同一个类型使用同一个名称
+	if builder.schemaName(textType) != textName {
+		t.Fatal("same type should have same name")
+	}
+
+	// 包名相同的不同类型
+	var htmlName = builder.schemaName(htmlType)
+	if htmlName != "html.template.Template" {
+		t.Fatal("unexpected name:", htmlName)
+	}
+}
@@ -5,9 +5,16 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/metrics"
+	"github.com/TeaOSLab/EdgeAPI/internal/ratelimit"
 	"github.com/TeaOSLab/EdgeAPI/internal/rpc/services"
 	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/tracing"
 	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -63,9 +70,33 @@ func (this *RestServer) handle(writer http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// API节点运行指标，只允许管理员的AccessToken访问
+	// Prometheus可以通过 Authorization: Bearer TOKEN 传入AccessToken
+	if path == "/metrics" {
+		accessToken, statusCode, message := this.validateAccessToken(req)
+		if accessToken == nil {
+			this.writeError(writer, statusCode, message, shouldPretty)
+			return
+		}
+		if accessToken.AdminId <= 0 {
+			this.writeError(writer, http.StatusForbidden, "only admin can access metrics", shouldPretty)
+			return
+		}
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = metrics.SharedRegistry.WriteText(writer)
+		return
+	}
+
+	// OpenAPI文档
+	if path == "/openapi.json" {
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = writer.Write(sharedOpenAPIDocument(shouldPretty))
+		return
+	}
+
 	matches := servicePathReg.FindStringSubmatch(path)
 	if len(matches) != 3 {
-		writer.WriteHeader(http.StatusNotFound)
+		this.writeError(writer, http.StatusNotFound, "not found", shouldPretty)
 		return
 	}
 
@@ -74,98 +105,118 @@ func (this *RestServer) handle(writer http.ResponseWriter, req *http.Request) {
 
 	serviceType, ok := restServicesMap[serviceName]
 	if !ok {
-		writer.WriteHeader(http.StatusNotFound)
+		this.writeError(writer, http.StatusNotFound, "service '"+serviceName+"' not found", shouldPretty)
 		return
 	}
 
 	if len(methodName) == 0 {
-		writer.WriteHeader(http.StatusNotFound)
+		this.writeError(writer, http.StatusNotFound, "not found", shouldPretty)
 		return
 	}
 
 	// 再次查找
 	methodName = strings.ToUpper(string(methodName[0])) + methodName[1:]
 	method := serviceType.MethodByName(methodName)
+
+	// 和gRPC中的方法名保持一致，比如 /pb.ServerService/listEnabledServersMatch，限流规则使用此方法名匹配
+	var fullMethod = "/pb." + serviceName + "/" + strings.ToLower(string(methodName[0])) + methodName[1:]
 	if !method.IsValid() {
-		writer.WriteHeader(http.StatusNotFound)
+		this.writeError(writer, http.StatusNotFound, "method '"+matches[2]+"' not found", shouldPretty)
 		return
 	}
-	if method.Type().NumIn() != 2 || method.Type().NumOut() != 2 {
-		writer.WriteHeader(http.StatusNotFound)
-		return
-	}
-	if method.Type().In(0).Name() != "Context" {
-		writer.WriteHeader(http.StatusNotFound)
+
+	var streamAdapter = restStreamAdapters[serviceName+"."+methodName]
+	if streamAdapter == nil && !isRestUnaryMethod(method.Type()) {
+		this.writeError(writer, http.StatusNotFound, "method '"+matches[2]+"' not found", shouldPretty)
 		return
 	}
 
-	// 上下文
-	ctx := context.Background()
+	// 链路追踪
+	_, span := tracing.SharedTracer.StartServerSpan(req.Context(), "REST "+path, req.Header.Get("traceparent"))
+	if span != nil {
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.target", path)
 
-	if serviceName != "APIAccessTokenService" || (methodName != "GetAPIAccessToken" && methodName != "getAPIAccessToken") {
-		// 校验TOKEN
-		token := req.Header.Get("X-Edge-Access-Token")
-		if len(token) == 0 {
-			token = req.Header.Get("Edge-Access-Token")
-			if len(token) == 0 {
-				this.writeJSON(writer, maps.Map{
-					"code":    400,
-					"data":    maps.Map{},
-					"message": "require 'X-Edge-Access-Token' header",
-				}, shouldPretty)
-				return
+		var statusWriter = &restStatusWriter{ResponseWriter: writer, statusCode: http.StatusOK}
+		writer = statusWriter
+		defer func() {
+			span.SetAttribute("http.status_code", statusWriter.statusCode)
+			if statusWriter.statusCode >= http.StatusInternalServerError {
+				span.SetStatus(tracing.StatusCodeError, http.StatusText(statusWriter.statusCode))
 			}
-		}
+			span.End()
+		}()
+	}
 
-		accessToken, err := models.SharedAPIAccessTokenDAO.FindAccessToken(nil, token)
-		if err != nil {
-			this.writeJSON(writer, maps.Map{
-				"code":    400,
-				"data":    maps.Map{},
-				"message": "server error: " + err.Error(),
-			}, shouldPretty)
-			return
-		}
+	// 上下文，跨度通过上下文传递给服务
+	ctx := tracing.ContextWithSpan(context.Background(), span)
+	var isRateLimited = false // 是否已经检查过限流
 
-		if accessToken == nil || int64(accessToken.ExpiredAt) < time.Now().Unix() {
-			this.writeJSON(writer, maps.Map{
-				"code":    400,
-				"data":    maps.Map{},
-				"message": "invalid access token",
-			}, shouldPretty)
+	if len(req.Header.Get("X-Edge-Node-Id")) > 0 {
+		// 节点使用和gRPC相同的认证方式
+		ctx = metadata.NewIncomingContext(tracing.ContextWithSpan(req.Context(), span), metadata.Pairs(
+			"nodeid", req.Header.Get("X-Edge-Node-Id"),
+			"token", req.Header.Get("X-Edge-Token"),
+		))
+	} else if serviceName != "APIAccessTokenService" || (methodName != "GetAPIAccessToken" && methodName != "getAPIAccessToken") {
+		// 校验TOKEN
+		accessToken, statusCode, message := this.validateAccessToken(req)
+		if accessToken == nil {
+			this.writeError(writer, statusCode, message, shouldPretty)
 			return
 		}
 
+		var plainCtx *rpcutils.PlainContext
 		if accessToken.UserId > 0 {
-			ctx = rpcutils.NewPlainContext("user", int64(accessToken.UserId))
+			plainCtx = rpcutils.NewPlainContext("user", int64(accessToken.UserId))
 		} else if accessToken.AdminId > 0 {
-			ctx = rpcutils.NewPlainContext("admin", int64(accessToken.AdminId))
+			plainCtx = rpcutils.NewPlainContext("admin", int64(accessToken.AdminId))
 		} else {
 			// TODO 支持更多类型的角色
-			this.writeJSON(writer, maps.Map{
-				"code":    400,
-				"data":    maps.Map{},
-				"message": "not supported role",
-			}, shouldPretty)
+			this.writeError(writer, http.StatusForbidden, "not supported role", shouldPretty)
+			return
+		}
+		plainCtx.Method = fullMethod
+		plainCtx.ClientIP = this.clientIP(req)
+		plainCtx.SetContext(ctx)
+		ctx = plainCtx
+
+		// 限流，AccessKey和其所属的用户同时计算
+		if !ratelimit.SharedLimiter.AllowCallers(fullMethod,
+			&ratelimit.Caller{Role: ratelimit.RoleAccessKey, Id: types.String(accessToken.Id)},
+			&ratelimit.Caller{Role: plainCtx.UserType, Id: types.String(plainCtx.UserId)}) {
+			this.writeError(writer, http.StatusTooManyRequests, "too many requests, please try again later", shouldPretty)
 			return
 		}
+		isRateLimited = true
+	}
+
+	if !isRateLimited && !allowRPCRequest(ctx, fullMethod) {
+		this.writeError(writer, http.StatusTooManyRequests, "too many requests, please try again later", shouldPretty)
+		return
+	}
+
+	// 流式调用
+	if streamAdapter != nil {
+		this.handleStream(writer, req, ctx, method, streamAdapter, shouldPretty)
+		return
 	}
 
 	// TODO 需要防止BODY过大攻击
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		writer.WriteHeader(http.StatusBadRequest)
-		_, _ = writer.Write([]byte(err.Error()))
+		this.writeError(writer, http.StatusBadRequest, err.Error(), shouldPretty)
 		return
 	}
 
 	// 请求数据
 	reqValue := reflect.New(method.Type().In(1).Elem()).Interface()
-	err = json.Unmarshal(body, reqValue)
-	if err != nil {
-		writer.WriteHeader(http.StatusBadRequest)
-		_, _ = writer.Write([]byte("Decode request failed: " + err.Error() + ". Request body should be a valid JSON data"))
-		return
+	if len(body) > 0 {
+		err = json.Unmarshal(body, reqValue)
+		if err != nil {
+			this.writeError(writer, http.StatusBadRequest, "Decode request failed: "+err.Error()+". Request body should be a valid JSON data", shouldPretty)
+			return
+		}
 	}
 
 	result := method.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(reqValue)})
@@ -173,17 +224,10 @@ func (this *RestServer) handle(writer http.ResponseWriter, req *http.Request) {
 	if resultErr != nil {
 		e, ok := resultErr.(error)
 		if ok {
-			this.writeJSON(writer, maps.Map{
-				"code":    400,
-				"message": e.Error(),
-				"data":    maps.Map{},
-			}, shouldPretty)
+			statusCode, message := this.convertError(e)
+			this.writeError(writer, statusCode, message, shouldPretty)
 		} else {
-			this.writeJSON(writer, maps.Map{
-				"code":    500,
-				"message": "server error: server should return a error object, but return a " + result[1].Type().String(),
-				"data":    maps.Map{},
-			}, shouldPretty)
+			this.writeError(writer, http.StatusInternalServerError, "server error: server should return a error object, but return a "+result[1].Type().String(), shouldPretty)
 		}
 	} else { // 没有返回错误
 		data := maps.Map{
@@ -197,17 +241,157 @@ func (this *RestServer) handle(writer http.ResponseWriter, req *http.Request) {
 		} else {
 			dataJSON = data.AsJSON()
 		}
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, _ = writer.Write(dataJSON)
+	}
+}
+
+// 处理流式调用，服务端消息以Server-Sent Events方式发送
+func (this *RestServer) handleStream(writer http.ResponseWriter, req *http.Request, ctx context.Context, method reflect.Value, adapter restStreamAdapter, shouldPretty bool) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		this.writeError(writer, http.StatusInternalServerError, "server error: streaming is not supported", shouldPretty)
+		return
+	}
+
+	// 服务端流：func(*Request, Stream) error，请求体中为单个请求JSON
+	var reqValue reflect.Value
+	var isServerStream = method.Type().NumIn() == 2
+	if isServerStream {
+		// TODO 需要防止BODY过大攻击
+		body, err := ioutil.ReadAll(req.Body)
 		if err != nil {
-			this.writeJSON(writer, maps.Map{
-				"code":    500,
-				"message": "server error: marshal json failed: " + err.Error(),
-				"data":    maps.Map{},
-			}, shouldPretty)
-		} else {
-			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			this.writeError(writer, http.StatusBadRequest, err.Error(), shouldPretty)
+			return
+		}
+		reqValue = reflect.New(method.Type().In(0).Elem())
+		if len(body) > 0 {
+			err = json.Unmarshal(body, reqValue.Interface())
+			if err != nil {
+				this.writeError(writer, http.StatusBadRequest, "Decode request failed: "+err.Error()+". Request body should be a valid JSON data", shouldPretty)
+				return
+			}
+		}
+	}
+
+	// 客户端流需要在发送响应之后继续读取请求体中的消息
+	if !isServerStream && !enableRestFullDuplex(writer, req) {
+		this.writeError(writer, http.StatusHTTPVersionNotSupported, "client streaming requires HTTP/2", shouldPretty)
+		return
+	}
 
-			_, _ = writer.Write(dataJSON)
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-req.Context().Done():
+			cancel()
+		case <-streamCtx.Done():
 		}
+	}()
+
+	writer.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var stream = newRestServerStream(streamCtx, writer, flusher, req.Body)
+	var args = []reflect.Value{reflect.ValueOf(adapter(stream))}
+	if isServerStream {
+		args = []reflect.Value{reqValue, args[0]}
+	}
+	result := method.Call(args)
+	resultErr := result[0].Interface()
+	if resultErr != nil {
+		e, ok := resultErr.(error)
+		if ok && streamCtx.Err() == nil {
+			statusCode, message := this.convertError(e)
+			stream.writeEvent("error", maps.Map{
+				"code":    statusCode,
+				"message": message,
+			}.AsJSON())
+		}
+	}
+}
+
+// 从请求中读取并校验AccessToken，校验失败时返回nil以及对应的状态码和错误信息
+func (this *RestServer) validateAccessToken(req *http.Request) (accessToken *models.APIAccessToken, statusCode int, message string) {
+	token := req.Header.Get("X-Edge-Access-Token")
+	if len(token) == 0 {
+		token = req.Header.Get("Edge-Access-Token")
+	}
+	if len(token) == 0 {
+		var authorization = req.Header.Get("Authorization")
+		if strings.HasPrefix(authorization, "Bearer ") {
+			token = strings.TrimSpace(authorization[len("Bearer "):])
+		}
+	}
+	if len(token) == 0 {
+		return nil, http.StatusUnauthorized, "require 'X-Edge-Access-Token' header"
+	}
+
+	accessToken, err := models.SharedAPIAccessTokenDAO.FindAccessToken(nil, token)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "server error: " + err.Error()
+	}
+	if accessToken == nil || int64(accessToken.ExpiredAt) < time.Now().Unix() {
+		return nil, http.StatusUnauthorized, "invalid access token"
+	}
+	return accessToken, http.StatusOK, ""
+}
+
+// 将错误转换为HTTP状态码和提示信息
+// 认证失败的错误来自 rpcutils.ValidateRequest()，为 codes.Unauthenticated；
+// 不是gRPC状态的错误和gRPC一样视为 codes.Unknown，作为服务器内部错误处理
+func (this *RestServer) convertError(err error) (statusCode int, message string) {
+	s, ok := status.FromError(err)
+	if !ok {
+		return http.StatusInternalServerError, err.Error()
+	}
+
+	switch s.Code() {
+	case codes.OK:
+		statusCode = http.StatusOK
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		statusCode = http.StatusBadRequest
+	case codes.Unauthenticated:
+		statusCode = http.StatusUnauthorized
+	case codes.PermissionDenied:
+		statusCode = http.StatusForbidden
+	case codes.NotFound:
+		statusCode = http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		statusCode = http.StatusConflict
+	case codes.ResourceExhausted:
+		statusCode = http.StatusTooManyRequests
+	case codes.Canceled:
+		statusCode = 499
+	case codes.Unimplemented:
+		statusCode = http.StatusNotImplemented
+	case codes.Unavailable:
+		statusCode = http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		statusCode = http.StatusGatewayTimeout
+	default:
+		statusCode = http.StatusInternalServerError
+	}
+	return statusCode, s.Message()
+}
+
+func (this *RestServer) writeError(writer http.ResponseWriter, statusCode int, message string, pretty bool) {
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(statusCode)
+
+	var v = maps.Map{
+		"code":    statusCode,
+		"message": message,
+		"data":    maps.Map{},
+	}
+	if pretty {
+		_, _ = writer.Write(v.AsPrettyJSON())
+	} else {
+		_, _ = writer.Write(v.AsJSON())
 	}
 }
 
@@ -220,3 +404,54 @@ func (this *RestServer) writeJSON(writer http.ResponseWriter, v maps.Map, pretty
 		_, _ = writer.Write(v.AsJSON())
 	}
 }
+
+// 获取客户端IP
+func (this *RestServer) clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// 判断是否为可以通过REST调用的普通方法：func(context.Context, *Request) (*Response, error)
+func isRestUnaryMethod(methodType reflect.Type) bool {
+	if methodType.NumIn() != 2 || methodType.NumOut() != 2 {
+		return false
+	}
+	if methodType.In(0).Name() != "Context" {
+		return false
+	}
+	if methodType.In(1).Kind() != reflect.Ptr || methodType.In(1).Elem().Kind() != reflect.Struct {
+		return false
+	}
+	if methodType.Out(0).Kind() != reflect.Ptr || methodType.Out(0).Elem().Kind() != reflect.Struct {
+		return false
+	}
+	return methodType.Out(1).Name() == "error"
+}
+
+// 记录响应状态码
+type restStatusWriter struct {
+	http.ResponseWriter
+
+	statusCode int
+}
+
+func (this *restStatusWriter) WriteHeader(statusCode int) {
+	this.statusCode = statusCode
+	this.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush 流式调用需要
+func (this *restStatusWriter) Flush() {
+	flusher, ok := this.ResponseWriter.(http.Flusher)
+	if ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 获取原始的ResponseWriter，http.ResponseController 需要
+func (this *restStatusWriter) Unwrap() http.ResponseWriter {
+	return this.ResponseWriter
+}
@@ -0,0 +1,33 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package nodes
+
+import (
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"testing"
+)
+
+func TestRestServer_convertError(t *testing.T) {
+	var server = &RestServer{}
+	for _, testCase := range []struct {
+		err        error
+		statusCode int
+	}{
+		{errors.New("database is closed"), http.StatusInternalServerError},
+		{status.Error(codes.InvalidArgument, "invalid 'nodeId'"), http.StatusBadRequest},
+		{status.Error(codes.Unauthenticated, "context: need 'nodeId'"), http.StatusUnauthorized},
+		{status.Error(codes.PermissionDenied, "Permission Denied"), http.StatusForbidden},
+		{status.Error(codes.NotFound, "not found"), http.StatusNotFound},
+		{status.Error(codes.ResourceExhausted, "too many requests"), http.StatusTooManyRequests},
+		{status.Error(codes.Internal, "server error"), http.StatusInternalServerError},
+	} {
+		statusCode, message := server.convertError(testCase.err)
+		if statusCode != testCase.statusCode {
+			t.Fatal("expect", testCase.statusCode, "for", testCase.err, "but got", statusCode)
+		}
+		t.Log(statusCode, message)
+	}
+}
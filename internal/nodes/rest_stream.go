@@ -0,0 +1,161 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package nodes
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"google.golang.org/grpc/metadata"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// 将REST流封装为gRPC生成的流接口
+type restStreamAdapter func(stream *restServerStream) interface{}
+
+// 支持通过REST调用的流式方法：服务名.方法名 => 适配器
+var restStreamAdapters = map[string]restStreamAdapter{
+	"NodeService.NodeStream": func(stream *restServerStream) interface{} {
+		return &restNodeStreamServer{restServerStream: stream}
+	},
+	"NSNodeService.NsNodeStream": func(stream *restServerStream) interface{} {
+		return &restNSNodeStreamServer{restServerStream: stream}
+	},
+	"HTTPAccessLogService.QueryHTTPAccessLogs": func(stream *restServerStream) interface{} {
+		return &restQueryHTTPAccessLogsServer{restServerStream: stream}
+	},
+}
+
+// restServerStream 通过Server-Sent Events实现的gRPC服务端流
+// 服务端发送的消息以message事件发送给客户端，客户端消息从请求体中按行读取JSON
+type restServerStream struct {
+	ctx     context.Context
+	writer  http.ResponseWriter
+	flusher http.Flusher
+	decoder *json.Decoder
+
+	writeLocker sync.Mutex
+}
+
+func newRestServerStream(ctx context.Context, writer http.ResponseWriter, flusher http.Flusher, body io.Reader) *restServerStream {
+	return &restServerStream{
+		ctx:     ctx,
+		writer:  writer,
+		flusher: flusher,
+		decoder: json.NewDecoder(bufio.NewReader(body)),
+	}
+}
+
+func (this *restServerStream) SetHeader(md metadata.MD) error {
+	return nil
+}
+
+func (this *restServerStream) SendHeader(md metadata.MD) error {
+	return nil
+}
+
+func (this *restServerStream) SetTrailer(md metadata.MD) {
+}
+
+func (this *restServerStream) Context() context.Context {
+	return this.ctx
+}
+
+// SendMsg 发送消息
+func (this *restServerStream) SendMsg(m interface{}) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return this.writeEvent("message", data)
+}
+
+// RecvMsg 接收消息
+// 请求体中的消息读取完毕后会一直等待，直到客户端断开连接
+func (this *restServerStream) RecvMsg(m interface{}) error {
+	if this.decoder != nil {
+		err := this.decoder.Decode(m)
+		if err == nil {
+			return nil
+		}
+		this.decoder = nil
+		if err != io.EOF {
+			return err
+		}
+	}
+
+	<-this.ctx.Done()
+	return io.EOF
+}
+
+func (this *restServerStream) writeEvent(event string, data []byte) error {
+	this.writeLocker.Lock()
+	defer this.writeLocker.Unlock()
+
+	if this.ctx.Err() != nil {
+		return this.ctx.Err()
+	}
+
+	_, err := this.writer.Write([]byte("event: " + event + "\ndata: "))
+	if err != nil {
+		return err
+	}
+	_, err = this.writer.Write(data)
+	if err != nil {
+		return err
+	}
+	_, err = this.writer.Write([]byte("\n\n"))
+	if err != nil {
+		return err
+	}
+	this.flusher.Flush()
+	return nil
+}
+
+// 边缘节点流
+type restNodeStreamServer struct {
+	*restServerStream
+}
+
+func (this *restNodeStreamServer) Send(m *pb.NodeStreamMessage) error {
+	return this.SendMsg(m)
+}
+
+func (this *restNodeStreamServer) Recv() (*pb.NodeStreamMessage, error) {
+	m := new(pb.NodeStreamMessage)
+	err := this.RecvMsg(m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DNS节点流
+type restNSNodeStreamServer struct {
+	*restServerStream
+}
+
+func (this *restNSNodeStreamServer) Send(m *pb.NSNodeStreamMessage) error {
+	return this.SendMsg(m)
+}
+
+func (this *restNSNodeStreamServer) Recv() (*pb.NSNodeStreamMessage, error) {
+	m := new(pb.NSNodeStreamMessage)
+	err := this.RecvMsg(m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// 访问日志查询流
+type restQueryHTTPAccessLogsServer struct {
+	*restServerStream
+}
+
+func (this *restQueryHTTPAccessLogsServer) Send(m *pb.QueryHTTPAccessLogsResponse) error {
+	return this.SendMsg(m)
+}
@@ -0,0 +1,16 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+//go:build go1.21
+// +build go1.21
+
+package nodes
+
+import "net/http"
+
+// 开启全双工模式，以便在发送响应之后仍然可以读取请求体
+// HTTP/2本身就支持全双工；HTTP/1.1需要 http.ResponseController 支持
+func enableRestFullDuplex(writer http.ResponseWriter, req *http.Request) bool {
+	if req.ProtoMajor >= 2 {
+		return true
+	}
+	return http.NewResponseController(writer).EnableFullDuplex() == nil
+}
@@ -0,0 +1,13 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+//go:build !go1.21
+// +build !go1.21
+
+package nodes
+
+import "net/http"
+
+// 开启全双工模式，以便在发送响应之后仍然可以读取请求体
+// 低版本的Go中HTTP/1.1服务端在发送响应后无法继续读取请求体，所以只支持HTTP/2
+func enableRestFullDuplex(writer http.ResponseWriter, req *http.Request) bool {
+	return req.ProtoMajor >= 2
+}
@@ -0,0 +1,31 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+//go:build plus
+// +build plus
+
+package nodes
+
+import "github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+
+func init() {
+	restStreamAdapters["ReportNodeService.ReportNodeStream"] = func(stream *restServerStream) interface{} {
+		return &restReportNodeStreamServer{restServerStream: stream}
+	}
+}
+
+// 区域监控节点流
+type restReportNodeStreamServer struct {
+	*restServerStream
+}
+
+func (this *restReportNodeStreamServer) Send(m *pb.ReportNodeStreamMessage) error {
+	return this.SendMsg(m)
+}
+
+func (this *restReportNodeStreamServer) Recv() (*pb.ReportNodeStreamMessage, error) {
+	m := new(pb.ReportNodeStreamMessage)
+	err := this.RecvMsg(m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
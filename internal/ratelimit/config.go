@@ -0,0 +1,63 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package ratelimit
+
+// SettingCode 限流配置在系统设置中的代号
+const SettingCode = "apiRateLimitConfig"
+
+// 调用者角色，除了RPC中的用户类型外，还支持以下角色
+const (
+	RoleAccessKey = "accessKey" // REST API中使用的AccessKey
+	RoleAnonymous = "anonymous" // 未认证的调用者，按客户端IP限流
+)
+
+// 未认证调用的默认规则，在没有配置匿名规则时使用
+var defaultAnonymousRule = &Rule{
+	Role:  RoleAnonymous,
+	Rate:  10,
+	Burst: 50,
+}
+
+// Config 限流配置
+type Config struct {
+	IsOn  bool    `json:"isOn"`  // 是否启用
+	Rules []*Rule `json:"rules"` // 规则
+}
+
+// NewConfig 获取新对象
+func NewConfig() *Config {
+	return &Config{}
+}
+
+// Caller 调用者
+type Caller struct {
+	Role string // 角色
+	Id   string // 调用者ID
+}
+
+// Rule 限流规则
+// 每个调用者（比如某个用户、某个节点）使用单独的令牌桶
+type Rule struct {
+	Role   string  `json:"role"`   // 调用者角色：admin、user、node、dns、accessKey等
+	Method string  `json:"method"` // RPC方法名，比如 listEnabledServersMatch，为空表示所有方法
+	Rate   float64 `json:"rate"`   // 每秒允许的请求数
+	Burst  int     `json:"burst"`  // 突发请求数
+}
+
+// HasRole 是否有某个角色的规则
+func (this *Config) HasRole(role string) bool {
+	for _, rule := range this.Rules {
+		if rule.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Match 检查规则是否匹配
+func (this *Rule) Match(role string, method string) bool {
+	if this.Role != role {
+		return false
+	}
+	return len(this.Method) == 0 || this.Method == method
+}
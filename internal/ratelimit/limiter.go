@@ -0,0 +1,224 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package ratelimit
+
+import (
+	"encoding/json"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/metrics"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/iwind/TeaGo/Tea"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var SharedLimiter = NewLimiter()
+
+func init() {
+	metrics.SharedRegistry.Describe("edge_api_rate_limit_allowed_total", "Requests allowed by rate limiter")
+	metrics.SharedRegistry.Describe("edge_api_rate_limit_rejected_total", "Requests rejected by rate limiter")
+}
+
+// Limiter 按调用者限流
+type Limiter struct {
+	config *Config
+
+	buckets map[string]*TokenBucket // ruleIndex@role:callerId => bucket
+	locker  sync.RWMutex
+}
+
+// NewLimiter 获取新对象
+func NewLimiter() *Limiter {
+	return &Limiter{
+		config:  NewConfig(),
+		buckets: map[string]*TokenBucket{},
+	}
+}
+
+// Start 启动，定时读取配置并清理过期的令牌桶
+func (this *Limiter) Start() {
+	var ticker = time.NewTicker(30 * time.Second)
+	if Tea.IsTesting() {
+		ticker = time.NewTicker(5 * time.Second)
+	}
+
+	// 启动时执行一次
+	err := this.Loop()
+	if err != nil {
+		remotelogs.Error("RATE_LIMITER", "load config failed: "+err.Error())
+	}
+
+	for range ticker.C {
+		err := this.Loop()
+		if err != nil {
+			remotelogs.Error("RATE_LIMITER", "load config failed: "+err.Error())
+		}
+		this.clean()
+	}
+}
+
+// Loop 读取配置
+func (this *Limiter) Loop() error {
+	valueJSON, err := models.SharedSysSettingDAO.ReadSetting(nil, SettingCode)
+	if err != nil {
+		return err
+	}
+	var config = NewConfig()
+	if len(valueJSON) > 0 {
+		err = json.Unmarshal(valueJSON, config)
+		if err != nil {
+			return err
+		}
+	}
+	this.UpdateConfig(config)
+	return nil
+}
+
+// UpdateConfig 修改配置
+func (this *Limiter) UpdateConfig(config *Config) {
+	if config == nil {
+		config = NewConfig()
+	}
+
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	configJSON, _ := json.Marshal(config)
+	oldConfigJSON, _ := json.Marshal(this.config)
+	if string(configJSON) == string(oldConfigJSON) {
+		return
+	}
+
+	this.config = config
+
+	// 规则变化后重新计算
+	this.buckets = map[string]*TokenBucket{}
+}
+
+// IsOn 是否启用了限流
+func (this *Limiter) IsOn() bool {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+	return this.config != nil && this.config.IsOn && len(this.config.Rules) > 0
+}
+
+// Allow 检查调用是否被允许
+// method 为RPC完整方法名，比如 /pb.ServerService/listEnabledServersMatch
+func (this *Limiter) Allow(role string, callerId string, method string) bool {
+	return this.AllowCallers(method, &Caller{Role: role, Id: callerId})
+}
+
+// AllowCallers 检查同时以多个身份发起的调用是否被允许，比如REST API中的AccessKey和其所属的用户
+// 只有所有匹配的规则都允许时才会消耗令牌，任何一个规则拒绝时，已经取出的令牌都会被退回
+func (this *Limiter) AllowCallers(method string, callers ...*Caller) bool {
+	this.locker.RLock()
+	var config = this.config
+	this.locker.RUnlock()
+
+	if config == nil || !config.IsOn || len(config.Rules) == 0 {
+		return true
+	}
+
+	var shortMethod = method
+	index := strings.LastIndex(method, "/")
+	if index >= 0 {
+		shortMethod = method[index+1:]
+	}
+	var takenBuckets = []*TokenBucket{}
+	var rejectedRole = ""
+	for _, caller := range callers {
+		for ruleIndex, rule := range config.Rules {
+			if rule.Rate <= 0 || !rule.Match(caller.Role, shortMethod) {
+				continue
+			}
+			var bucket = this.bucket(ruleIndex, rule, caller.Role, caller.Id)
+			if !bucket.Allow() {
+				rejectedRole = caller.Role
+				break
+			}
+			takenBuckets = append(takenBuckets, bucket)
+		}
+		if len(rejectedRole) > 0 {
+			break
+		}
+	}
+
+	if len(rejectedRole) > 0 {
+		for _, bucket := range takenBuckets {
+			bucket.Refund()
+		}
+		metrics.SharedRegistry.Counter("edge_api_rate_limit_rejected_total", "role", rejectedRole, "method", shortMethod).Increase()
+		return false
+	}
+	for _, caller := range callers {
+		metrics.SharedRegistry.Counter("edge_api_rate_limit_allowed_total", "role", caller.Role).Increase()
+	}
+	return true
+}
+
+// AllowAnonymous 检查未认证的调用是否被允许，按客户端IP限流
+// 没有启用限流或者没有配置匿名规则时使用默认规则，防止未认证的接口被滥用
+func (this *Limiter) AllowAnonymous(ip string, method string) bool {
+	this.locker.RLock()
+	var config = this.config
+	this.locker.RUnlock()
+
+	if config != nil && config.IsOn && config.HasRole(RoleAnonymous) {
+		return this.AllowCallers(method, &Caller{Role: RoleAnonymous, Id: ip})
+	}
+
+	var shortMethod = method
+	index := strings.LastIndex(method, "/")
+	if index >= 0 {
+		shortMethod = method[index+1:]
+	}
+	if !this.bucket(-1, defaultAnonymousRule, RoleAnonymous, ip).Allow() {
+		metrics.SharedRegistry.Counter("edge_api_rate_limit_rejected_total", "role", RoleAnonymous, "method", shortMethod).Increase()
+		return false
+	}
+	metrics.SharedRegistry.Counter("edge_api_rate_limit_allowed_total", "role", RoleAnonymous).Increase()
+	return true
+}
+
+func (this *Limiter) bucket(ruleIndex int, rule *Rule, role string, callerId string) *TokenBucket {
+	var key = strconv.Itoa(ruleIndex) + "@" + role + ":" + callerId
+
+	this.locker.RLock()
+	bucket, ok := this.buckets[key]
+	this.locker.RUnlock()
+	if ok {
+		return bucket
+	}
+
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	bucket, ok = this.buckets[key]
+	if ok {
+		return bucket
+	}
+	bucket = NewTokenBucket(rule.Rate, rule.Burst)
+	this.buckets[key] = bucket
+	return bucket
+}
+
+// 清理长时间未访问的令牌桶
+func (this *Limiter) clean() {
+	var expiredAt = time.Now().Unix() - 600
+
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	for key, bucket := range this.buckets {
+		if bucket.AccessedAt() < expiredAt {
+			delete(this.buckets, key)
+		}
+	}
+}
+
+// CountBuckets 令牌桶数量
+func (this *Limiter) CountBuckets() int {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+	return len(this.buckets)
+}
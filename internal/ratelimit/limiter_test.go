@@ -0,0 +1,119 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package ratelimit
+
+import (
+	"testing"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	var limiter = NewLimiter()
+	limiter.UpdateConfig(&Config{
+		IsOn: true,
+		Rules: []*Rule{
+			{
+				Role:   "user",
+				Method: "listEnabledServersMatch",
+				Rate:   1,
+				Burst:  2,
+			},
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow("user", "1", "/pb.ServerService/listEnabledServersMatch") {
+			t.Fatal("should be allowed")
+		}
+	}
+	if limiter.Allow("user", "1", "/pb.ServerService/listEnabledServersMatch") {
+		t.Fatal("should be rejected")
+	}
+
+	// 其他调用者和其他方法不受影响
+	if !limiter.Allow("user", "2", "/pb.ServerService/listEnabledServersMatch") {
+		t.Fatal("another user should be allowed")
+	}
+	if !limiter.Allow("user", "1", "/pb.ServerService/findEnabledServer") {
+		t.Fatal("another method should be allowed")
+	}
+	if !limiter.Allow("admin", "1", "/pb.ServerService/listEnabledServersMatch") {
+		t.Fatal("another role should be allowed")
+	}
+	t.Log("buckets:", limiter.CountBuckets())
+}
+
+func TestLimiter_AllowCallers_Refund(t *testing.T) {
+	var limiter = NewLimiter()
+	limiter.UpdateConfig(&Config{
+		IsOn: true,
+		Rules: []*Rule{
+			{
+				Role:  RoleAccessKey,
+				Rate:  0.001,
+				Burst: 3,
+			},
+			{
+				Role:   "user",
+				Method: "listEnabledServersMatch",
+				Rate:   0.001,
+				Burst:  1,
+			},
+		},
+	})
+
+	var method = "/pb.ServerService/listEnabledServersMatch"
+	var callers = []*Caller{{Role: RoleAccessKey, Id: "1"}, {Role: "user", Id: "1"}}
+	if !limiter.AllowCallers(method, callers...) {
+		t.Fatal("should be allowed")
+	}
+
+	// 用户的规则拒绝，不能消耗AccessKey的令牌
+	for i := 0; i < 3; i++ {
+		if limiter.AllowCallers(method, callers...) {
+			t.Fatal("should be rejected by user rule")
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow(RoleAccessKey, "1", "/pb.ServerService/findEnabledServer") {
+			t.Fatal("tokens of access key should be refunded")
+		}
+	}
+	if limiter.Allow(RoleAccessKey, "1", "/pb.ServerService/findEnabledServer") {
+		t.Fatal("should be rejected")
+	}
+}
+
+func TestLimiter_AllowAnonymous(t *testing.T) {
+	var limiter = NewLimiter()
+
+	// 没有启用限流时使用默认规则
+	for i := 0; i < defaultAnonymousRule.Burst; i++ {
+		if !limiter.AllowAnonymous("192.168.1.100", "/pb.NodeService/enrollNode") {
+			t.Fatal("should be allowed")
+		}
+	}
+	if limiter.AllowAnonymous("192.168.1.100", "/pb.NodeService/enrollNode") {
+		t.Fatal("should be rejected")
+	}
+	if !limiter.AllowAnonymous("192.168.1.101", "/pb.NodeService/enrollNode") {
+		t.Fatal("another ip should be allowed")
+	}
+
+	// 使用配置的匿名规则
+	limiter.UpdateConfig(&Config{
+		IsOn: true,
+		Rules: []*Rule{
+			{
+				Role:  RoleAnonymous,
+				Rate:  0.001,
+				Burst: 1,
+			},
+		},
+	})
+	if !limiter.AllowAnonymous("192.168.1.100", "/pb.NodeService/enrollNode") {
+		t.Fatal("should be allowed")
+	}
+	if limiter.AllowAnonymous("192.168.1.100", "/pb.NodeService/enrollNode") {
+		t.Fatal("should be rejected")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket 令牌桶
+type TokenBucket struct {
+	rate  float64 // 每秒生成的令牌数
+	burst float64 // 桶容量
+
+	tokens     float64
+	lastTime   time.Time
+	accessedAt int64
+
+	locker sync.Mutex
+}
+
+// NewTokenBucket 获取新对象
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	var now = time.Now()
+	return &TokenBucket{
+		rate:       rate,
+		burst:      float64(burst),
+		tokens:     float64(burst),
+		lastTime:   now,
+		accessedAt: now.Unix(),
+	}
+}
+
+// Allow 尝试取出一个令牌
+func (this *TokenBucket) Allow() bool {
+	return this.AllowAt(time.Now())
+}
+
+// AllowAt 在某个时间点尝试取出一个令牌
+func (this *TokenBucket) AllowAt(now time.Time) bool {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	this.accessedAt = now.Unix()
+
+	var elapsed = now.Sub(this.lastTime).Seconds()
+	if elapsed > 0 {
+		this.tokens += elapsed * this.rate
+		if this.tokens > this.burst {
+			this.tokens = this.burst
+		}
+		this.lastTime = now
+	}
+
+	if this.tokens >= 1 {
+		this.tokens--
+		return true
+	}
+	return false
+}
+
+// Refund 退回一个令牌
+// 同一个调用需要从多个令牌桶中取出令牌时，如果其中一个桶拒绝，则退回已经取出的令牌
+func (this *TokenBucket) Refund() {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	this.tokens++
+	if this.tokens > this.burst {
+		this.tokens = this.burst
+	}
+}
+
+// AccessedAt 最后访问时间
+func (this *TokenBucket) AccessedAt() int64 {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	return this.accessedAt
+}
@@ -0,0 +1,22 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Allow(t *testing.T) {
+	var bucket = NewTokenBucket(1, 2)
+	var now = time.Now()
+	if !bucket.AllowAt(now) || !bucket.AllowAt(now) {
+		t.Fatal("burst requests should be allowed")
+	}
+	if bucket.AllowAt(now) {
+		t.Fatal("should be rejected after burst")
+	}
+	if !bucket.AllowAt(now.Add(1 * time.Second)) {
+		t.Fatal("should be allowed after refilling")
+	}
+}
@@ -144,7 +144,11 @@ func (this *NSNodeService) CountAllUpgradeNSNodesWithNSClusterId(ctx context.Con
 
 	tx := this.NullTx()
 
-	deployFiles := installers.SharedDeployManager.LoadNSNodeFiles()
+	versionRange, err := models.SharedNSClusterDAO.FindClusterPackageVersionRange(tx, req.NsClusterId)
+	if err != nil {
+		return nil, err
+	}
+	deployFiles := installers.SharedDeployManager.LoadNSNodeFilesWithRange(versionRange)
 	total := int64(0)
 	for _, deployFile := range deployFiles {
 		count, err := models.SharedNSNodeDAO.CountAllLowerVersionNodesWithClusterId(tx, req.NsClusterId, deployFile.OS, deployFile.Arch, deployFile.Version)
@@ -335,6 +339,23 @@ func (this *NSNodeService) InstallNSNode(ctx context.Context, req *pb.InstallNSN
 	return &pb.InstallNSNodeResponse{}, nil
 }
 
+// PreflightNSNodeInstall 安装前检查节点系统环境
+func (this *NSNodeService) PreflightNSNodeInstall(ctx context.Context, req *pb.PreflightNSNodeInstallRequest) (*pb.PreflightNSNodeInstallResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := installers.SharedNSNodeQueue().PreflightNode(req.NsNodeId, req.IsUpgrading)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PreflightNSNodeInstallResponse{
+		Items: services.ConvertNodeInstallPreflightItems(items),
+		IsOk:  installers.PreflightError(items) == nil,
+	}, nil
+}
+
 // FindNSNodeInstallStatus 读取节点安装状态
 func (this *NSNodeService) FindNSNodeInstallStatus(ctx context.Context, req *pb.FindNSNodeInstallStatusRequest) (*pb.FindNSNodeInstallStatusResponse, error) {
 	// 校验请求
@@ -354,12 +375,13 @@ func (this *NSNodeService) FindNSNodeInstallStatus(ctx context.Context, req *pb.
 	}
 
 	pbInstallStatus := &pb.NodeInstallStatus{
-		IsRunning:  installStatus.IsRunning,
-		IsFinished: installStatus.IsFinished,
-		IsOk:       installStatus.IsOk,
-		Error:      installStatus.Error,
-		ErrorCode:  installStatus.ErrorCode,
-		UpdatedAt:  installStatus.UpdatedAt,
+		IsRunning:      installStatus.IsRunning,
+		IsFinished:     installStatus.IsFinished,
+		IsOk:           installStatus.IsOk,
+		Error:          installStatus.Error,
+		ErrorCode:      installStatus.ErrorCode,
+		UpdatedAt:      installStatus.UpdatedAt,
+		PreflightItems: services.ConvertNodeInstallPreflightItems(installStatus.Preflight),
 	}
 	return &pb.FindNSNodeInstallStatusResponse{InstallStatus: pbInstallStatus}, nil
 }
@@ -451,22 +473,32 @@ func (this *NSNodeService) CheckNSNodeLatestVersion(ctx context.Context, req *pb
 
 // DownloadNSNodeInstallationFile 下载最新DNS节点安装文件
 func (this *NSNodeService) DownloadNSNodeInstallationFile(ctx context.Context, req *pb.DownloadNSNodeInstallationFileRequest) (*pb.DownloadNSNodeInstallationFileResponse, error) {
-	_, err := this.ValidateNSNode(ctx)
+	nodeId, err := this.ValidateNSNode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	clusterId, err := models.SharedNSNodeDAO.FindNodeClusterId(tx, nodeId)
+	if err != nil {
+		return nil, err
+	}
+	versionRange, err := models.SharedNSClusterDAO.FindClusterPackageVersionRange(tx, clusterId)
 	if err != nil {
 		return nil, err
 	}
 
-	file := installers.SharedDeployManager.FindNSNodeFile(req.Os, req.Arch)
+	file := installers.SharedDeployManager.FindNSNodeFileWithRange(req.Os, req.Arch, versionRange)
 	if file == nil {
 		return &pb.DownloadNSNodeInstallationFileResponse{}, nil
 	}
 
-	sum, err := file.Sum()
+	// 每个片段都从校验过的内容中读取，返回的概要为校验过的SHA256
+	fileData, sum, err := installers.SharedDeployManager.ReadVerifiedFile(file)
 	if err != nil {
 		return nil, err
 	}
-
-	data, offset, err := file.Read(req.ChunkOffset)
+	data, offset, err := installers.ReadDeployChunk(fileData, req.ChunkOffset)
 	if err != nil && err != io.EOF {
 		return nil, err
 	}
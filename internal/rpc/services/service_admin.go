@@ -200,20 +200,25 @@ func (this *AdminService) CreateOrUpdateAdmin(ctx context.Context, req *pb.Creat
 		return nil, err
 	}
 
-	tx := this.NullTx()
-
-	adminId, err := models.SharedAdminDAO.FindAdminIdWithUsername(tx, req.Username)
-	if err != nil {
-		return nil, err
-	}
-	if adminId > 0 {
-		err = models.SharedAdminDAO.UpdateAdminPassword(tx, adminId, req.Password)
+	var adminId int64
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		adminId, err = models.SharedAdminDAO.FindAdminIdWithUsername(tx, req.Username)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		return &pb.CreateOrUpdateAdminResponse{AdminId: adminId}, nil
-	}
-	adminId, err = models.SharedAdminDAO.CreateAdmin(tx, req.Username, true, req.Password, "管理员", true, nil)
+		if adminId > 0 {
+			err = models.SharedAdminDAO.UpdateAdminPassword(tx, adminId, req.Password)
+			if err != nil {
+				return err
+			}
+			return this.CreateAuditLog(ctx, tx, "warn", "修改管理员密码 "+req.Username, nil, nil)
+		}
+		adminId, err = models.SharedAdminDAO.CreateAdmin(tx, req.Username, true, req.Password, "管理员", true, nil)
+		if err != nil {
+			return err
+		}
+		return this.auditAdmin(ctx, tx, "创建管理员", nil, adminId)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -228,9 +233,17 @@ func (this *AdminService) UpdateAdminInfo(ctx context.Context, req *pb.UpdateAdm
 		return nil, err
 	}
 
-	tx := this.NullTx()
-
-	err = models.SharedAdminDAO.UpdateAdminInfo(tx, req.AdminId, req.Fullname)
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		oldAdmin, err := models.SharedAdminDAO.FindEnabledAdmin(tx, req.AdminId)
+		if err != nil {
+			return err
+		}
+		err = models.SharedAdminDAO.UpdateAdminInfo(tx, req.AdminId, req.Fullname)
+		if err != nil {
+			return err
+		}
+		return this.auditAdmin(ctx, tx, "修改管理员信息", oldAdmin, req.AdminId)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -245,17 +258,25 @@ func (this *AdminService) UpdateAdminLogin(ctx context.Context, req *pb.UpdateAd
 		return nil, err
 	}
 
-	tx := this.NullTx()
-
-	exists, err := models.SharedAdminDAO.CheckAdminUsername(tx, req.AdminId, req.Username)
-	if err != nil {
-		return nil, err
-	}
-	if exists {
-		return nil, errors.New("username already been token")
-	}
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		exists, err := models.SharedAdminDAO.CheckAdminUsername(tx, req.AdminId, req.Username)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return errors.New("username already been token")
+		}
 
-	err = models.SharedAdminDAO.UpdateAdminLogin(tx, req.AdminId, req.Username, req.Password)
+		oldAdmin, err := models.SharedAdminDAO.FindEnabledAdmin(tx, req.AdminId)
+		if err != nil {
+			return err
+		}
+		err = models.SharedAdminDAO.UpdateAdminLogin(tx, req.AdminId, req.Username, req.Password)
+		if err != nil {
+			return err
+		}
+		return this.auditAdmin(ctx, tx, "修改管理员登录信息", oldAdmin, req.AdminId)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -318,9 +339,14 @@ func (this *AdminService) CreateAdmin(ctx context.Context, req *pb.CreateAdminRe
 
 	// TODO 检查权限
 
-	tx := this.NullTx()
-
-	adminId, err := models.SharedAdminDAO.CreateAdmin(tx, req.Username, req.CanLogin, req.Password, req.Fullname, req.IsSuper, req.ModulesJSON)
+	var adminId int64
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		adminId, err = models.SharedAdminDAO.CreateAdmin(tx, req.Username, req.CanLogin, req.Password, req.Fullname, req.IsSuper, req.ModulesJSON)
+		if err != nil {
+			return err
+		}
+		return this.auditAdmin(ctx, tx, "创建管理员", nil, adminId)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -337,9 +363,17 @@ func (this *AdminService) UpdateAdmin(ctx context.Context, req *pb.UpdateAdminRe
 
 	// TODO 检查权限
 
-	tx := this.NullTx()
-
-	err = models.SharedAdminDAO.UpdateAdmin(tx, req.AdminId, req.Username, req.CanLogin, req.Password, req.Fullname, req.IsSuper, req.ModulesJSON, req.IsOn)
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		oldAdmin, err := models.SharedAdminDAO.FindEnabledAdmin(tx, req.AdminId)
+		if err != nil {
+			return err
+		}
+		err = models.SharedAdminDAO.UpdateAdmin(tx, req.AdminId, req.Username, req.CanLogin, req.Password, req.Fullname, req.IsSuper, req.ModulesJSON, req.IsOn)
+		if err != nil {
+			return err
+		}
+		return this.auditAdmin(ctx, tx, "修改管理员", oldAdmin, req.AdminId)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -423,11 +457,19 @@ func (this *AdminService) DeleteAdmin(ctx context.Context, req *pb.DeleteAdminRe
 
 	// TODO 检查权限
 
-	tx := this.NullTx()
-
 	// TODO 超级管理员用户是不能删除的，或者要至少留一个超级管理员用户
 
-	_, err = models.SharedAdminDAO.DisableAdmin(tx, req.AdminId)
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		oldAdmin, err := models.SharedAdminDAO.FindEnabledAdmin(tx, req.AdminId)
+		if err != nil {
+			return err
+		}
+		_, err = models.SharedAdminDAO.DisableAdmin(tx, req.AdminId)
+		if err != nil {
+			return err
+		}
+		return this.auditAdmin(ctx, tx, "删除管理员", oldAdmin, 0)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -859,3 +901,32 @@ func (this *AdminService) findMetricDataCharts(tx *dbs.Tx) (result []*pb.MetricD
 	}
 	return pbMetricCharts, nil
 }
+
+// 记录管理员变更的审计日志
+// oldAdmin为变更前的管理员，newAdminId为变更后需要读取的管理员ID，删除时为0
+func (this *AdminService) auditAdmin(ctx context.Context, tx *dbs.Tx, description string, oldAdmin *models.Admin, newAdminId int64) error {
+	var before, after interface{}
+	var username = ""
+	if oldAdmin != nil {
+		before = oldAdmin.AuditMap()
+		username = oldAdmin.Username
+	}
+	if newAdminId > 0 {
+		newAdmin, err := models.SharedAdminDAO.FindEnabledAdmin(tx, newAdminId)
+		if err != nil {
+			return err
+		}
+		if newAdmin != nil {
+			after = newAdmin.AuditMap()
+			username = newAdmin.Username
+		}
+	}
+	if before == nil && after == nil {
+		return nil
+	}
+	var level = "info"
+	if after == nil {
+		level = "warn"
+	}
+	return this.CreateAuditLog(ctx, tx, level, description+" "+username, before, after)
+}
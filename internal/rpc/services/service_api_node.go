@@ -6,7 +6,11 @@ import (
 	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/tasks"
 	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/lists"
+	"strings"
+	"time"
 )
 
 type APINodeService struct {
@@ -295,3 +299,62 @@ func (this *APINodeService) CountAllEnabledAPINodesWithSSLCertId(ctx context.Con
 	}
 	return this.SuccessCount(count)
 }
+
+// FindAllAPINodeTaskLeaders 查看单例任务当前由哪个API节点执行
+func (this *APINodeService) FindAllAPINodeTaskLeaders(ctx context.Context, req *pb.FindAllAPINodeTaskLeadersRequest) (*pb.FindAllAPINodeTaskLeadersResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	lockers, err := models.SharedSysLockerDAO.FindAllLockersWithPrefix(tx, models.SysLockerLeaderPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var now = time.Now().Unix()
+	var pbLeaders = []*pb.APINodeTaskLeader{}
+	var taskNames = []string{}
+	var nodeNames = map[int64]string{} // nodeId => name
+	for _, locker := range lockers {
+		var taskName = strings.TrimPrefix(locker.Key, models.SysLockerLeaderPrefix)
+		taskNames = append(taskNames, taskName)
+
+		// 已经过期或者已经释放
+		if len(locker.Owner) == 0 || int64(locker.TimeoutAt) < now {
+			pbLeaders = append(pbLeaders, &pb.APINodeTaskLeader{TaskName: taskName})
+			continue
+		}
+
+		var nodeId = int64(locker.OwnerNodeId)
+		nodeName, ok := nodeNames[nodeId]
+		if !ok && nodeId > 0 {
+			nodeName, err = models.SharedAPINodeDAO.FindAPINodeName(tx, nodeId)
+			if err != nil {
+				return nil, err
+			}
+			nodeNames[nodeId] = nodeName
+		}
+
+		pbLeaders = append(pbLeaders, &pb.APINodeTaskLeader{
+			TaskName:      taskName,
+			ApiNodeId:     nodeId,
+			ApiNodeName:   nodeName,
+			Owner:         locker.Owner,
+			FencingToken:  int64(locker.Version),
+			AcquiredAt:    int64(locker.AcquiredAt),
+			ExpiresAt:     int64(locker.TimeoutAt),
+			IsCurrentNode: nodeId == teaconst.NodeId,
+		})
+	}
+
+	// 当前节点注册了但还没有任何节点竞选成功的任务
+	for _, taskName := range tasks.SharedLeaderElector.FindAllTasks() {
+		if !lists.ContainsString(taskNames, taskName) {
+			pbLeaders = append(pbLeaders, &pb.APINodeTaskLeader{TaskName: taskName})
+		}
+	}
+
+	return &pb.FindAllAPINodeTaskLeadersResponse{ApiNodeTaskLeaders: pbLeaders}, nil
+}
@@ -15,7 +15,9 @@ import (
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/lists"
 	"github.com/iwind/TeaGo/maps"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 type BaseService struct {
@@ -215,7 +217,27 @@ func (this *BaseService) Exists(b bool) (*pb.RPCExists, error) {
 
 // PermissionError 返回权限错误
 func (this *BaseService) PermissionError() error {
-	return errors.New("Permission Denied")
+	return status.Error(codes.PermissionDenied, "Permission Denied")
+}
+
+// CreateAuditLog 记录审计日志
+// before和after为变更前后的对象，用来计算数据变更，新建时before为nil，删除时after为nil；
+// tx应当为执行变更的事务，从而变更和日志同时提交或者同时回滚
+func (this *BaseService) CreateAuditLog(ctx context.Context, tx *dbs.Tx, level string, description string, before interface{}, after interface{}) error {
+	userType, _, userId, err := rpcutils.ValidateRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	var diffItems []*utils.JSONDiffItem
+	if before != nil || after != nil {
+		diffItems, err = utils.DiffObjects(before, after)
+		if err != nil {
+			return err
+		}
+	}
+
+	return models.SharedLogDAO.CreateAuditLog(tx, userType, userId, level, description, "", rpcutils.RequestIP(ctx), rpcutils.RequestMethod(ctx), diffItems)
 }
 
 // NullTx 空的数据库事务
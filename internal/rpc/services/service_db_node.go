@@ -140,6 +140,12 @@ func (this *DBNodeService) ListEnabledDBNodes(ctx context.Context, req *pb.ListE
 			Password:    node.Password,
 			Charset:     node.Charset,
 			Status:      status,
+			Weight:      int32(node.Weight),
+			MaxSize:     int64(node.MaxSize),
+			Size:        int64(node.Size),
+			IsDraining:  node.IsDraining == 1,
+			IsHealthy:   node.IsHealthy == 1,
+			HealthError: node.HealthError,
 		})
 	}
 	return &pb.ListEnabledDBNodesResponse{DbNodes: result}, nil
@@ -173,6 +179,12 @@ func (this *DBNodeService) FindEnabledDBNode(ctx context.Context, req *pb.FindEn
 		Username:    node.Username,
 		Password:    node.Password,
 		Charset:     node.Charset,
+		Weight:      int32(node.Weight),
+		MaxSize:     int64(node.MaxSize),
+		Size:        int64(node.Size),
+		IsDraining:  node.IsDraining == 1,
+		IsHealthy:   node.IsHealthy == 1,
+		HealthError: node.HealthError,
 	}}, nil
 }
 
@@ -344,3 +356,42 @@ func (this *DBNodeService) CheckDBNodeStatus(ctx context.Context, req *pb.CheckD
 
 	return &pb.CheckDBNodeStatusResponse{DbNodeStatus: status}, nil
 }
+
+// UpdateDBNodeRouting 修改数据库节点的日志路由设置
+func (this *DBNodeService) UpdateDBNodeRouting(ctx context.Context, req *pb.UpdateDBNodeRoutingRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedDBNodeDAO.UpdateNodeRouting(tx, req.DbNodeId, req.Weight, req.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// DrainDBNode 排空数据库节点，或者取消排空
+// 排空后不再向节点写入新的访问日志，已有的日志仍然可以查询
+func (this *DBNodeService) DrainDBNode(ctx context.Context, req *pb.DrainDBNodeRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	node, err := models.SharedDBNodeDAO.FindEnabledDBNode(tx, req.DbNodeId)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, errors.New("can not find db node with id '" + types.String(req.DbNodeId) + "'")
+	}
+
+	err = models.SharedDBNodeDAO.UpdateNodeDraining(tx, req.DbNodeId, req.IsDraining)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package services
+
+import (
+	"context"
+	"github.com/1uLang/EdgeCommon/pkg/nodeconfigs"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/installers"
+	"github.com/iwind/TeaGo/dbs"
+	"io"
+	"strings"
+)
+
+// DeployPackageService 节点安装包仓库
+type DeployPackageService struct {
+	BaseService
+}
+
+// ImportDeployPackage 从已上传的文件中导入签名的安装包
+func (this *DeployPackageService) ImportDeployPackage(ctx context.Context, req *pb.ImportDeployPackageRequest) (*pb.ImportDeployPackageResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	file, err := models.SharedFileDAO.FindEnabledFile(tx, req.FileId)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, errors.New("can not find file")
+	}
+	if file.IsFinished != 1 {
+		return nil, errors.New("the file has not been uploaded completely")
+	}
+	chunkIds, err := models.SharedFileChunkDAO.FindAllFileChunkIds(tx, req.FileId)
+	if err != nil {
+		return nil, err
+	}
+
+	// 逐个片段读取，避免一次性把整个安装包加载到内存
+	reader, writer := io.Pipe()
+	go this.writeFileChunks(tx, chunkIds, writer)
+	pkg, err := installers.SharedDeployManager.ImportPackage(this.role(req.Role), req.Os, req.Arch, req.Version, reader, req.KeyId, req.Signature)
+	_ = reader.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ImportDeployPackageResponse{DeployPackage: this.convertPackage(pkg)}, nil
+}
+
+// ListDeployPackages 列出仓库中的安装包
+func (this *DeployPackageService) ListDeployPackages(ctx context.Context, req *pb.ListDeployPackagesRequest) (*pb.ListDeployPackagesResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	packages, err := installers.SharedDeployManager.ListPackages()
+	if err != nil {
+		return nil, err
+	}
+	var pbPackages = []*pb.DeployPackage{}
+	for _, pkg := range packages {
+		if len(req.Role) > 0 && pkg.Role != req.Role {
+			continue
+		}
+		pbPackages = append(pbPackages, this.convertPackage(pkg))
+	}
+	return &pb.ListDeployPackagesResponse{DeployPackages: pbPackages}, nil
+}
+
+// UpdateClusterPackageVersionRange 设置集群允许安装的版本范围
+func (this *DeployPackageService) UpdateClusterPackageVersionRange(ctx context.Context, req *pb.UpdateClusterPackageVersionRangeRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var versionRange = strings.TrimSpace(req.VersionRange)
+	err = installers.ValidateDeployVersionRange(versionRange)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	switch this.role(req.Role) {
+	case nodeconfigs.NodeRoleNode:
+		err = models.SharedNodeClusterDAO.UpdateClusterPackageVersionRange(tx, req.ClusterId, versionRange)
+	case nodeconfigs.NodeRoleDNS:
+		err = models.SharedNSClusterDAO.UpdateClusterPackageVersionRange(tx, req.ClusterId, versionRange)
+	default:
+		return nil, errors.New("invalid role '" + req.Role + "'")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// FindClusterPackageVersionRange 查找集群允许安装的版本范围
+func (this *DeployPackageService) FindClusterPackageVersionRange(ctx context.Context, req *pb.FindClusterPackageVersionRangeRequest) (*pb.FindClusterPackageVersionRangeResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	var versionRange string
+	switch this.role(req.Role) {
+	case nodeconfigs.NodeRoleNode:
+		versionRange, err = models.SharedNodeClusterDAO.FindClusterPackageVersionRange(tx, req.ClusterId)
+	case nodeconfigs.NodeRoleDNS:
+		versionRange, err = models.SharedNSClusterDAO.FindClusterPackageVersionRange(tx, req.ClusterId)
+	default:
+		return nil, errors.New("invalid role '" + req.Role + "'")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pb.FindClusterPackageVersionRangeResponse{VersionRange: versionRange}, nil
+}
+
+// 按顺序写入文件片段
+func (this *DeployPackageService) writeFileChunks(tx *dbs.Tx, chunkIds []int64, writer *io.PipeWriter) {
+	for _, chunkId := range chunkIds {
+		chunk, err := models.SharedFileChunkDAO.FindFileChunk(tx, chunkId)
+		if err != nil {
+			_ = writer.CloseWithError(err)
+			return
+		}
+		if chunk == nil {
+			_ = writer.CloseWithError(errors.New("can not find file chunk"))
+			return
+		}
+		_, err = writer.Write([]byte(chunk.Data))
+		if err != nil {
+			// 读取端已关闭
+			return
+		}
+	}
+	_ = writer.Close()
+}
+
+// 默认为边缘节点
+func (this *DeployPackageService) role(role string) nodeconfigs.NodeRole {
+	if len(role) == 0 {
+		return nodeconfigs.NodeRoleNode
+	}
+	return role
+}
+
+// 转换安装包
+func (this *DeployPackageService) convertPackage(pkg *installers.DeployPackage) *pb.DeployPackage {
+	return &pb.DeployPackage{
+		Role:      pkg.Role,
+		Os:        pkg.OS,
+		Arch:      pkg.Arch,
+		Version:   pkg.Version,
+		Filename:  pkg.Filename,
+		Size:      pkg.Size,
+		Sha256:    pkg.SHA256,
+		KeyId:     pkg.KeyId,
+		CreatedAt: pkg.CreatedAt,
+	}
+}
@@ -274,7 +274,7 @@ func (this *DNSDomainService) SyncDNSDomainData(ctx context.Context, req *pb.Syn
 	if err != nil {
 		return nil, err
 	}
-	return this.syncClusterDNS(req)
+	return this.syncClusterDNS(ctx, req)
 }
 
 // FindAllDNSDomainRoutes 查看支持的线路
@@ -599,7 +599,7 @@ func (this *DNSDomainService) findClusterDNSChanges(cluster *models.NodeCluster,
 }
 
 // 执行同步
-func (this *DNSDomainService) syncClusterDNS(req *pb.SyncDNSDomainDataRequest) (*pb.SyncDNSDomainDataResponse, error) {
+func (this *DNSDomainService) syncClusterDNS(ctx context.Context, req *pb.SyncDNSDomainDataRequest) (*pb.SyncDNSDomainDataResponse, error) {
 	tx := this.NullTx()
 
 	// 查询集群信息
@@ -660,7 +660,7 @@ func (this *DNSDomainService) syncClusterDNS(req *pb.SyncDNSDomainDataRequest) (
 	}
 
 	// 开始同步
-	manager := dnsclients.FindProvider(provider.Type)
+	manager := dnsclients.FindProviderWithContext(ctx, provider.Type)
 	if manager == nil {
 		return &pb.SyncDNSDomainDataResponse{IsOk: false, Error: "目前不支持'" + provider.Type + "'"}, nil
 	}
@@ -800,7 +800,7 @@ func (this *DNSDomainService) SyncDNSDomainsFromProvider(ctx context.Context, re
 		return nil, err
 	}
 
-	dnsProvider := dnsclients.FindProvider(provider.Type)
+	dnsProvider := dnsclients.FindProviderWithContext(ctx, provider.Type)
 	if dnsProvider == nil {
 		return nil, errors.New("provider type '" + provider.Type + "' is not supported yet")
 	}
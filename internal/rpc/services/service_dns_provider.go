@@ -5,6 +5,7 @@ import (
 	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models/dns"
 	"github.com/TeaOSLab/EdgeAPI/internal/dnsclients"
+	"github.com/iwind/TeaGo/dbs"
 )
 
 // DNSProviderService DNS服务商相关服务
@@ -20,9 +21,14 @@ func (this *DNSProviderService) CreateDNSProvider(ctx context.Context, req *pb.C
 		return nil, err
 	}
 
-	tx := this.NullTx()
-
-	providerId, err := dns.SharedDNSProviderDAO.CreateDNSProvider(tx, adminId, userId, req.Type, req.Name, req.ApiParamsJSON)
+	var providerId int64
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		providerId, err = dns.SharedDNSProviderDAO.CreateDNSProvider(tx, adminId, userId, req.Type, req.Name, req.ApiParamsJSON)
+		if err != nil {
+			return err
+		}
+		return this.auditProvider(ctx, tx, "创建DNS服务商", nil, providerId)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -40,9 +46,17 @@ func (this *DNSProviderService) UpdateDNSProvider(ctx context.Context, req *pb.U
 
 	// TODO 校验权限
 
-	tx := this.NullTx()
-
-	err = dns.SharedDNSProviderDAO.UpdateDNSProvider(tx, req.DnsProviderId, req.Name, req.ApiParamsJSON)
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		oldProvider, err := dns.SharedDNSProviderDAO.FindEnabledDNSProvider(tx, req.DnsProviderId)
+		if err != nil {
+			return err
+		}
+		err = dns.SharedDNSProviderDAO.UpdateDNSProvider(tx, req.DnsProviderId, req.Name, req.ApiParamsJSON)
+		if err != nil {
+			return err
+		}
+		return this.auditProvider(ctx, tx, "修改DNS服务商", oldProvider, req.DnsProviderId)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -136,9 +150,17 @@ func (this *DNSProviderService) DeleteDNSProvider(ctx context.Context, req *pb.D
 
 	// TODO 校验权限
 
-	tx := this.NullTx()
-
-	err = dns.SharedDNSProviderDAO.DisableDNSProvider(tx, req.DnsProviderId)
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		oldProvider, err := dns.SharedDNSProviderDAO.FindEnabledDNSProvider(tx, req.DnsProviderId)
+		if err != nil {
+			return err
+		}
+		err = dns.SharedDNSProviderDAO.DisableDNSProvider(tx, req.DnsProviderId)
+		if err != nil {
+			return err
+		}
+		return this.auditProvider(ctx, tx, "删除DNS服务商", oldProvider, 0)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -217,3 +239,32 @@ func (this *DNSProviderService) FindAllEnabledDNSProvidersWithType(ctx context.C
 	}
 	return &pb.FindAllEnabledDNSProvidersWithTypeResponse{DnsProviders: result}, nil
 }
+
+// 记录DNS服务商变更的审计日志
+// oldProvider为变更前的服务商，newProviderId为变更后需要读取的服务商ID，删除时为0
+func (this *DNSProviderService) auditProvider(ctx context.Context, tx *dbs.Tx, description string, oldProvider *dns.DNSProvider, newProviderId int64) error {
+	var before, after interface{}
+	var name = ""
+	if oldProvider != nil {
+		before = oldProvider.AuditMap()
+		name = oldProvider.Name
+	}
+	if newProviderId > 0 {
+		newProvider, err := dns.SharedDNSProviderDAO.FindEnabledDNSProvider(tx, newProviderId)
+		if err != nil {
+			return err
+		}
+		if newProvider != nil {
+			after = newProvider.AuditMap()
+			name = newProvider.Name
+		}
+	}
+	if before == nil && after == nil {
+		return nil
+	}
+	var level = "info"
+	if after == nil {
+		level = "warn"
+	}
+	return this.CreateAuditLog(ctx, tx, level, description+" "+name, before, after)
+}
@@ -4,8 +4,19 @@ import (
 	"context"
 	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/iwind/TeaGo/dbs"
+	"regexp"
+	"strings"
 )
 
+const (
+	defaultFileUploadChunkSize = 512 * 1024      // 断点续传默认分块尺寸
+	maxFileUploadChunkSize     = 2 * 1024 * 1024 // 断点续传最大分块尺寸，不能超过gRPC消息限制
+)
+
+var fileHashReg = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
 // 文件相关服务
 type FileService struct {
 	BaseService
@@ -41,6 +52,7 @@ func (this *FileService) FindEnabledFile(ctx context.Context, req *pb.FindEnable
 			Size:      int64(file.Size),
 			CreatedAt: int64(file.CreatedAt),
 			IsPublic:  file.IsPublic == 1,
+			Hash:      file.Hash,
 		},
 	}, nil
 }
@@ -52,27 +64,106 @@ func (this *FileService) CreateFile(ctx context.Context, req *pb.CreateFileReque
 		return nil, err
 	}
 
+	fileType, err := this.uploadFileType(req.Type, userId)
+	if err != nil {
+		return nil, err
+	}
+
 	tx := this.NullTx()
 
-	fileId, err := models.SharedFileDAO.CreateFile(tx, adminId, userId, "ipLibrary", "", req.Filename, req.Size, req.IsPublic)
+	fileId, err := models.SharedFileDAO.CreateFile(tx, adminId, userId, fileType, "", req.Filename, req.Size, req.IsPublic)
 	if err != nil {
 		return nil, err
 	}
 	return &pb.CreateFileResponse{FileId: fileId}, nil
 }
 
+// CreateFileUpload 创建断点续传的文件
+func (this *FileService) CreateFileUpload(ctx context.Context, req *pb.CreateFileUploadRequest) (*pb.CreateFileUploadResponse, error) {
+	adminId, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fileType, err := this.uploadFileType(req.Type, userId)
+	if err != nil {
+		return nil, err
+	}
+	if req.Size <= 0 || req.Size > models.MaxFileUploadSize {
+		return nil, errors.New("invalid 'size'")
+	}
+	var hash = strings.ToLower(req.Sha256)
+	if !fileHashReg.MatchString(hash) {
+		return nil, errors.New("invalid 'sha256'")
+	}
+	var chunkSize = req.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultFileUploadChunkSize
+	} else if chunkSize < models.MinFileUploadChunkSize {
+		chunkSize = models.MinFileUploadChunkSize
+	} else if chunkSize > maxFileUploadChunkSize {
+		chunkSize = maxFileUploadChunkSize
+	}
+
+	var tx = this.NullTx()
+	fileId, err := models.SharedFileDAO.CreateUploadFile(tx, adminId, userId, fileType, req.Filename, req.Size, hash, chunkSize, req.IsPublic)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateFileUploadResponse{
+		FileId:      fileId,
+		ChunkSize:   chunkSize,
+		CountChunks: (req.Size + chunkSize - 1) / chunkSize,
+	}, nil
+}
+
 // 将文件置为已完成
+// 断点续传的文件会检查是否所有片段都已上传，以及内容SHA256是否和创建时声明的一致
 func (this *FileService) UpdateFileFinished(ctx context.Context, req *pb.UpdateFileFinishedRequest) (*pb.RPCSuccess, error) {
-	_, err := this.ValidateAdmin(ctx, 0)
+	_, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
 	if err != nil {
 		return nil, err
 	}
 
 	tx := this.NullTx()
 
+	if userId > 0 {
+		err = this.checkFileUser(tx, req.FileId, userId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	err = models.SharedFileDAO.UpdateFileIsFinished(tx, req.FileId)
 	if err != nil {
 		return nil, err
 	}
 	return this.Success()
 }
+
+// 检查上传的文件类型，为空时为IP库，以兼容以前的版本
+// 导出文件、诊断包等由系统生成的类型不能通过接口创建
+func (this *FileService) uploadFileType(fileType string, userId int64) (string, error) {
+	switch fileType {
+	case "", models.FileTypeIPLibrary:
+		return models.FileTypeIPLibrary, nil
+	case models.FileTypeDeployPackage:
+		if userId > 0 {
+			return "", this.PermissionError()
+		}
+		return fileType, nil
+	}
+	return "", errors.New("invalid file type '" + fileType + "'")
+}
+
+// 检查文件是否属于某个用户
+func (this *FileService) checkFileUser(tx *dbs.Tx, fileId int64, userId int64) error {
+	file, err := models.SharedFileDAO.FindEnabledFile(tx, fileId)
+	if err != nil {
+		return err
+	}
+	if file == nil || int64(file.UserId) != userId {
+		return this.PermissionError()
+	}
+	return nil
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
 	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
 )
 
 // FileChunkService 文件片段相关服务
@@ -29,6 +32,53 @@ func (this *FileChunkService) CreateFileChunk(ctx context.Context, req *pb.Creat
 	return &pb.CreateFileChunkResponse{FileChunkId: chunkId}, nil
 }
 
+// UploadFileChunk 断点续传时上传文件片段，同一个片段可以重复上传
+func (this *FileChunkService) UploadFileChunk(ctx context.Context, req *pb.UploadFileChunkRequest) (*pb.RPCSuccess, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	file, err := this.findUploadFile(tx, req.FileId, userId)
+	if err != nil {
+		return nil, err
+	}
+	err = models.SharedFileChunkDAO.UploadFileChunk(tx, file, int(req.Index), req.Data, req.Sha256)
+	if err != nil {
+		return nil, err
+	}
+	err = models.SharedFileDAO.UpdateFileUploadedAt(tx, req.FileId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// FindFileUploadMissingChunks 查找断点续传时还没有上传的片段
+func (this *FileChunkService) FindFileUploadMissingChunks(ctx context.Context, req *pb.FindFileUploadMissingChunksRequest) (*pb.FindFileUploadMissingChunksResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	file, err := this.findUploadFile(tx, req.FileId, userId)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := models.SharedFileChunkDAO.FindMissingChunkIndexes(tx, file)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.FindFileUploadMissingChunksResponse{
+		MissingIndexes: indexes,
+		CountChunks:    int32(file.CountUploadChunks()),
+		ChunkSize:      int64(file.ChunkSize),
+		IsFinished:     file.IsFinished == 1,
+	}, nil
+}
+
 // FindAllFileChunkIds 获取的一个文件的所有片段IDs
 func (this *FileChunkService) FindAllFileChunkIds(ctx context.Context, req *pb.FindAllFileChunkIdsRequest) (*pb.FindAllFileChunkIdsResponse, error) {
 	// 校验请求
@@ -69,3 +119,18 @@ func (this *FileChunkService) DownloadFileChunk(ctx context.Context, req *pb.Dow
 	}
 	return &pb.DownloadFileChunkResponse{FileChunk: &pb.FileChunk{Data: []byte(chunk.Data)}}, nil
 }
+
+// 查找断点续传的文件
+func (this *FileChunkService) findUploadFile(tx *dbs.Tx, fileId int64, userId int64) (*models.File, error) {
+	file, err := models.SharedFileDAO.FindEnabledFile(tx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, errors.New("file '" + types.String(fileId) + "' not found")
+	}
+	if userId > 0 && int64(file.UserId) != userId {
+		return nil, this.PermissionError()
+	}
+	return file, nil
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	"github.com/TeaOSLab/EdgeAPI/internal/iplibrary"
 	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // HTTPAccessLogService 访问日志相关服务
@@ -27,15 +29,17 @@ func (this *HTTPAccessLogService) CreateHTTPAccessLogs(ctx context.Context, req
 		return &pb.CreateHTTPAccessLogsResponse{}, nil
 	}
 
-	tx := this.NullTx()
-
-	err = models.SharedHTTPAccessLogDAO.CreateHTTPAccessLogs(tx, req.HttpAccessLogs)
+	err = models.SharedHTTPAccessLogDAO.CreateHTTPAccessLogs(req.HttpAccessLogs)
 	if err != nil {
+		// 写入队列已满时让节点稍后重试
+		if err == models.ErrAccessLogQueueFull || err == models.ErrAccessLogQueueClosed {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
 		return nil, err
 	}
 
 	// 发送到访问日志策略
-	policyId, err := models.SharedHTTPAccessLogPolicyDAO.FindCurrentPublicPolicyId(tx)
+	policyId, err := models.SharedHTTPAccessLogPolicyDAO.FindCurrentPublicPolicyId(this.NullTx())
 	if err != nil {
 		return nil, err
 	}
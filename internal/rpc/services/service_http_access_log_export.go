@@ -0,0 +1,166 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package services
+
+import (
+	"context"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeAPI/internal/accesslogs/logquery"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+// HTTPAccessLogExportService 访问日志导出服务
+type HTTPAccessLogExportService struct {
+	BaseService
+}
+
+// CreateHTTPAccessLogExport 创建导出任务
+func (this *HTTPAccessLogExportService) CreateHTTPAccessLogExport(ctx context.Context, req *pb.CreateHTTPAccessLogExportRequest) (*pb.CreateHTTPAccessLogExportResponse, error) {
+	adminId, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	if userId > 0 && req.ServerId > 0 {
+		err = models.SharedServerDAO.CheckUserServer(tx, userId, req.ServerId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 检查查询语句
+	expr, err := logquery.Parse(req.Query)
+	if err != nil {
+		return nil, errors.New("invalid query: " + err.Error())
+	}
+	_, _, err = logquery.NewSQLBuilder(true, true).Build(expr)
+	if err != nil {
+		return nil, errors.New("invalid query: " + err.Error())
+	}
+
+	var format = req.Format
+	if len(format) == 0 {
+		format = models.HTTPAccessLogExportFormatNDJSON
+	}
+
+	exportId, err := models.SharedHTTPAccessLogExportDAO.CreateExport(tx, adminId, userId, req.ServerId, req.Query, format, req.TimeFrom, req.TimeTo)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateHTTPAccessLogExportResponse{HttpAccessLogExportId: exportId}, nil
+}
+
+// FindHTTPAccessLogExport 查找单个导出任务
+func (this *HTTPAccessLogExportService) FindHTTPAccessLogExport(ctx context.Context, req *pb.FindHTTPAccessLogExportRequest) (*pb.FindHTTPAccessLogExportResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	export, err := this.findExport(tx, userId, req.HttpAccessLogExportId)
+	if err != nil {
+		return nil, err
+	}
+	if export == nil {
+		return &pb.FindHTTPAccessLogExportResponse{HttpAccessLogExport: nil}, nil
+	}
+	return &pb.FindHTTPAccessLogExportResponse{HttpAccessLogExport: this.convertExport(export)}, nil
+}
+
+// CountHTTPAccessLogExports 计算导出任务数量
+func (this *HTTPAccessLogExportService) CountHTTPAccessLogExports(ctx context.Context, req *pb.CountHTTPAccessLogExportsRequest) (*pb.RPCCountResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	count, err := models.SharedHTTPAccessLogExportDAO.CountEnabledExports(tx, 0, userId, req.ServerId)
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// ListHTTPAccessLogExports 列出单页导出任务
+func (this *HTTPAccessLogExportService) ListHTTPAccessLogExports(ctx context.Context, req *pb.ListHTTPAccessLogExportsRequest) (*pb.ListHTTPAccessLogExportsResponse, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	exports, err := models.SharedHTTPAccessLogExportDAO.ListEnabledExports(tx, 0, userId, req.ServerId, req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	var pbExports = []*pb.HTTPAccessLogExport{}
+	for _, export := range exports {
+		pbExports = append(pbExports, this.convertExport(export))
+	}
+	return &pb.ListHTTPAccessLogExportsResponse{HttpAccessLogExports: pbExports}, nil
+}
+
+// DeleteHTTPAccessLogExport 删除导出任务
+// 正在执行的任务会被取消
+func (this *HTTPAccessLogExportService) DeleteHTTPAccessLogExport(ctx context.Context, req *pb.DeleteHTTPAccessLogExportRequest) (*pb.RPCSuccess, error) {
+	_, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	export, err := this.findExport(tx, userId, req.HttpAccessLogExportId)
+	if err != nil {
+		return nil, err
+	}
+	if export == nil {
+		return this.Success()
+	}
+
+	err = models.SharedHTTPAccessLogExportDAO.DisableExport(tx, int64(export.Id))
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// 查找导出任务并检查权限
+func (this *HTTPAccessLogExportService) findExport(tx *dbs.Tx, userId int64, exportId int64) (*models.HTTPAccessLogExport, error) {
+	export, err := models.SharedHTTPAccessLogExportDAO.FindEnabledExport(tx, exportId)
+	if err != nil {
+		return nil, err
+	}
+	if export == nil {
+		return nil, nil
+	}
+	if userId > 0 && int64(export.UserId) != userId {
+		return nil, this.PermissionError()
+	}
+	return export, nil
+}
+
+func (this *HTTPAccessLogExportService) convertExport(export *models.HTTPAccessLogExport) *pb.HTTPAccessLogExport {
+	return &pb.HTTPAccessLogExport{
+		Id:         int64(export.Id),
+		ServerId:   int64(export.ServerId),
+		Query:      export.Query,
+		Format:     export.Format,
+		TimeFrom:   int64(export.TimeFrom),
+		TimeTo:     int64(export.TimeTo),
+		Status:     int32(export.Status),
+		Progress:   int32(export.Progress),
+		CountLogs:  int64(export.CountLogs),
+		FileId:     int64(export.FileId),
+		Size:       int64(export.Size),
+		Error:      export.Error,
+		CreatedAt:  int64(export.CreatedAt),
+		StartedAt:  int64(export.StartedAt),
+		FinishedAt: int64(export.FinishedAt),
+		ExpiresAt:  int64(export.ExpiresAt),
+	}
+}
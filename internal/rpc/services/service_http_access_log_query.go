@@ -0,0 +1,130 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package services
+
+import (
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeAPI/internal/accesslogs/logquery"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+const (
+	httpAccessLogQueryDefaultSize   = 1000
+	httpAccessLogQueryMaxSize       = 100000
+	httpAccessLogQueryBatchSize     = 200
+	httpAccessLogQueryDefaultPeriod = 3600       // 默认查询最近一小时
+	httpAccessLogQueryMaxPeriod     = 31 * 86400 // 最多查询31天
+)
+
+// QueryHTTPAccessLogs 使用查询语句跨日期查询访问日志
+// 结果分批发送，每批中的cursor为此批最后一条日志的requestId，断开后可以用它继续查询；
+// 最后一条消息的isDone为true，其中的hasMore和cursor用于查询下一页
+func (this *HTTPAccessLogService) QueryHTTPAccessLogs(req *pb.QueryHTTPAccessLogsRequest, stream pb.HTTPAccessLogService_QueryHTTPAccessLogsServer) error {
+	var ctx = stream.Context()
+
+	// 校验请求
+	_, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	expr, err := logquery.Parse(req.Query)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid query: "+err.Error())
+	}
+
+	// 提前检查条件中的值，比如IP、数字格式等
+	_, _, err = logquery.NewSQLBuilder(true, true).Build(expr)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid query: "+err.Error())
+	}
+
+	// 时间范围
+	var timeTo = req.TimeTo
+	if timeTo <= 0 {
+		timeTo = time.Now().Unix()
+	}
+	var timeFrom = req.TimeFrom
+	if timeFrom <= 0 {
+		timeFrom = timeTo - httpAccessLogQueryDefaultPeriod
+	}
+	if timeFrom > timeTo {
+		return status.Error(codes.InvalidArgument, "'timeFrom' should not be greater than 'timeTo'")
+	}
+	if timeTo-timeFrom > httpAccessLogQueryMaxPeriod {
+		return status.Error(codes.InvalidArgument, "time range should not be longer than 31 days")
+	}
+
+	var size = req.Size
+	if size <= 0 {
+		size = httpAccessLogQueryDefaultSize
+	} else if size > httpAccessLogQueryMaxSize {
+		size = httpAccessLogQueryMaxSize
+	}
+
+	var tx = this.NullTx()
+
+	// 服务范围
+	var serverIds = []int64{}
+	if userId > 0 {
+		if req.UserId > 0 && userId != req.UserId {
+			return this.PermissionError()
+		}
+		if req.ServerId > 0 {
+			err = models.SharedServerDAO.CheckUserServer(tx, userId, req.ServerId)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		userId = req.UserId
+	}
+	if req.ServerId > 0 {
+		serverIds = []int64{req.ServerId}
+	} else if userId > 0 {
+		serverIds, err = models.SharedServerDAO.FindAllEnabledServerIdsWithUserId(tx, userId)
+		if err != nil {
+			return err
+		}
+		if len(serverIds) == 0 {
+			return stream.Send(&pb.QueryHTTPAccessLogsResponse{IsDone: true})
+		}
+	}
+
+	var projection = logquery.NewProjection(req.Fields)
+	nextCursor, hasMore, err := models.SharedHTTPAccessLogDAO.QueryAccessLogs(tx, expr, timeFrom, timeTo, serverIds, req.Cursor, size, httpAccessLogQueryBatchSize, func(accessLogs []*models.HTTPAccessLog) error {
+		// 客户端已断开
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var pbAccessLogs = []*pb.HTTPAccessLog{}
+		for _, accessLog := range accessLogs {
+			pbAccessLog, err := accessLog.ToPB()
+			if err != nil {
+				return err
+			}
+			pbAccessLog, err = projection.Apply(pbAccessLog)
+			if err != nil {
+				return err
+			}
+			pbAccessLogs = append(pbAccessLogs, pbAccessLog)
+		}
+		return stream.Send(&pb.QueryHTTPAccessLogsResponse{
+			HttpAccessLogs: pbAccessLogs,
+			Cursor:         accessLogs[len(accessLogs)-1].RequestId,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return stream.Send(&pb.QueryHTTPAccessLogsResponse{
+		Cursor:  nextCursor,
+		HasMore: hasMore,
+		IsDone:  true,
+	})
+}
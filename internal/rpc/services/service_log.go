@@ -5,6 +5,8 @@ import (
 	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
 )
 
 // LogService 管理员、用户或者其他系统用户日志
@@ -88,6 +90,9 @@ func (this *LogService) ListLogs(ctx context.Context, req *pb.ListLogsRequest) (
 			Ip:          log.Ip,
 			UserName:    userName,
 			Description: log.Description,
+			RpcMethod:   log.RpcMethod,
+			DiffJSON:    []byte(log.Diff),
+			Hash:        log.Hash,
 		})
 	}
 
@@ -103,10 +108,14 @@ func (this *LogService) DeleteLogPermanently(ctx context.Context, req *pb.Delete
 
 	// TODO 校验权限
 
-	tx := this.NullTx()
-
 	// 执行物理删除
-	err = models.SharedLogDAO.DeleteLogPermanently(tx, req.LogId)
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		err := models.SharedLogDAO.DeleteLogPermanently(tx, req.LogId)
+		if err != nil {
+			return err
+		}
+		return this.CreateAuditLog(ctx, tx, "warn", "删除操作日志："+types.String(req.LogId), nil, nil)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -123,14 +132,23 @@ func (this *LogService) DeleteLogsPermanently(ctx context.Context, req *pb.Delet
 
 	// TODO 校验权限
 
-	tx := this.NullTx()
-
 	// 执行物理删除
-	for _, logId := range req.LogIds {
-		err = models.SharedLogDAO.DeleteLogPermanently(tx, logId)
-		if err != nil {
-			return nil, err
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		for _, logId := range req.LogIds {
+			err := models.SharedLogDAO.DeleteLogPermanently(tx, logId)
+			if err != nil {
+				return err
+			}
+
+			err = this.CreateAuditLog(ctx, tx, "warn", "删除操作日志："+types.String(logId), nil, nil)
+			if err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return this.Success()
@@ -177,3 +195,22 @@ func (this *LogService) SumLogsSize(ctx context.Context, req *pb.SumLogsSizeRequ
 	}
 	return &pb.SumLogsResponse{SizeBytes: size}, nil
 }
+
+// CheckLogHashChain 检查日志哈希链是否完整
+func (this *LogService) CheckLogHashChain(ctx context.Context, req *pb.CheckLogHashChainRequest) (*pb.CheckLogHashChainResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := this.NullTx()
+
+	brokenLogId, err := models.SharedLogDAO.CheckHashChain(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CheckLogHashChainResponse{
+		IsOk:        brokenLogId == 0,
+		BrokenLogId: brokenLogId,
+	}, nil
+}
@@ -733,6 +733,37 @@ func (this *NodeService) InstallNode(ctx context.Context, req *pb.InstallNodeReq
 	return &pb.InstallNodeResponse{}, nil
 }
 
+// PreflightNodeInstall 安装前检查节点系统环境
+func (this *NodeService) PreflightNodeInstall(ctx context.Context, req *pb.PreflightNodeInstallRequest) (*pb.PreflightNodeInstallResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := installers.SharedNodeQueue().PreflightNode(req.NodeId, req.IsUpgrading)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PreflightNodeInstallResponse{
+		Items: ConvertNodeInstallPreflightItems(items),
+		IsOk:  installers.PreflightError(items) == nil,
+	}, nil
+}
+
+// ConvertNodeInstallPreflightItems 转换安装前检查结果
+func ConvertNodeInstallPreflightItems(items []*models.NodeInstallPreflightItem) []*pb.NodeInstallPreflightItem {
+	var pbItems = []*pb.NodeInstallPreflightItem{}
+	for _, item := range items {
+		pbItems = append(pbItems, &pb.NodeInstallPreflightItem{
+			Code:    item.Code,
+			Name:    item.Name,
+			Status:  item.Status,
+			Message: item.Message,
+		})
+	}
+	return pbItems
+}
+
 // UpgradeNode 升级节点
 func (this *NodeService) UpgradeNode(ctx context.Context, req *pb.UpgradeNodeRequest) (*pb.UpgradeNodeResponse, error) {
 	// 校验节点
@@ -992,7 +1023,11 @@ func (this *NodeService) CountAllUpgradeNodesWithNodeClusterId(ctx context.Conte
 
 	tx := this.NullTx()
 
-	deployFiles := installers.SharedDeployManager.LoadNodeFiles()
+	versionRange, err := models.SharedNodeClusterDAO.FindClusterPackageVersionRange(tx, req.NodeClusterId)
+	if err != nil {
+		return nil, err
+	}
+	deployFiles := installers.SharedDeployManager.LoadNodeFilesWithRange(versionRange)
 	total := int64(0)
 	for _, deployFile := range deployFiles {
 		count, err := models.SharedNodeDAO.CountAllLowerVersionNodesWithClusterId(tx, req.NodeClusterId, deployFile.OS, deployFile.Arch, deployFile.Version)
@@ -1016,7 +1051,11 @@ func (this *NodeService) FindAllUpgradeNodesWithNodeClusterId(ctx context.Contex
 	tx := this.NullTx()
 
 	// 获取当前能升级到的最新版本
-	deployFiles := installers.SharedDeployManager.LoadNodeFiles()
+	versionRange, err := models.SharedNodeClusterDAO.FindClusterPackageVersionRange(tx, req.NodeClusterId)
+	if err != nil {
+		return nil, err
+	}
+	deployFiles := installers.SharedDeployManager.LoadNodeFilesWithRange(versionRange)
 	result := []*pb.FindAllUpgradeNodesWithNodeClusterIdResponse_NodeUpgrade{}
 	for _, deployFile := range deployFiles {
 		nodes, err := models.SharedNodeDAO.FindAllLowerVersionNodesWithClusterId(tx, req.NodeClusterId, deployFile.OS, deployFile.Arch, deployFile.Version)
@@ -1130,12 +1169,13 @@ func (this *NodeService) FindNodeInstallStatus(ctx context.Context, req *pb.Find
 	}
 
 	pbInstallStatus := &pb.NodeInstallStatus{
-		IsRunning:  installStatus.IsRunning,
-		IsFinished: installStatus.IsFinished,
-		IsOk:       installStatus.IsOk,
-		Error:      installStatus.Error,
-		ErrorCode:  installStatus.ErrorCode,
-		UpdatedAt:  installStatus.UpdatedAt,
+		IsRunning:      installStatus.IsRunning,
+		IsFinished:     installStatus.IsFinished,
+		IsOk:           installStatus.IsOk,
+		Error:          installStatus.Error,
+		ErrorCode:      installStatus.ErrorCode,
+		UpdatedAt:      installStatus.UpdatedAt,
+		PreflightItems: ConvertNodeInstallPreflightItems(installStatus.Preflight),
 	}
 	return &pb.FindNodeInstallStatusResponse{InstallStatus: pbInstallStatus}, nil
 }
@@ -1494,22 +1534,32 @@ func (this *NodeService) UpdateNodeUp(ctx context.Context, req *pb.UpdateNodeUpR
 
 // DownloadNodeInstallationFile 下载最新边缘节点安装文件
 func (this *NodeService) DownloadNodeInstallationFile(ctx context.Context, req *pb.DownloadNodeInstallationFileRequest) (*pb.DownloadNodeInstallationFileResponse, error) {
-	_, err := this.ValidateNode(ctx)
+	nodeId, err := this.ValidateNode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	clusterId, err := models.SharedNodeDAO.FindNodeClusterId(tx, nodeId)
+	if err != nil {
+		return nil, err
+	}
+	versionRange, err := models.SharedNodeClusterDAO.FindClusterPackageVersionRange(tx, clusterId)
 	if err != nil {
 		return nil, err
 	}
 
-	file := installers.SharedDeployManager.FindNodeFile(req.Os, req.Arch)
+	file := installers.SharedDeployManager.FindNodeFileWithRange(req.Os, req.Arch, versionRange)
 	if file == nil {
 		return &pb.DownloadNodeInstallationFileResponse{}, nil
 	}
 
-	sum, err := file.Sum()
+	// 每个片段都从校验过的内容中读取，返回的概要为校验过的SHA256
+	fileData, sum, err := installers.SharedDeployManager.ReadVerifiedFile(file)
 	if err != nil {
 		return nil, err
 	}
-
-	data, offset, err := file.Read(req.ChunkOffset)
+	data, offset, err := installers.ReadDeployChunk(fileData, req.ChunkOffset)
 	if err != nil && err != io.EOF {
 		return nil, err
 	}
@@ -486,7 +486,7 @@ func (this *NodeClusterService) FindEnabledNodeClusterDNS(ctx context.Context, r
 			TypeName: dnsclients.FindProviderTypeName(provider.Type),
 		}
 
-		manager := dnsclients.FindProvider(provider.Type)
+		manager := dnsclients.FindProviderWithContext(ctx, provider.Type)
 		if manager != nil {
 			apiParams, err := provider.DecodeAPIParams()
 			if err != nil {
@@ -0,0 +1,159 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package services
+
+import (
+	"context"
+	"github.com/1uLang/EdgeCommon/pkg/nodeconfigs"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/installers"
+	"github.com/iwind/TeaGo/logs"
+)
+
+// NodeDecommissionService 边缘节点和DNS节点下线
+type NodeDecommissionService struct {
+	BaseService
+}
+
+// DecommissionNode 下线节点
+// 卸载远程主机上的节点程序，吊销节点Token并禁用节点，执行过程记录在下线记录中
+func (this *NodeDecommissionService) DecommissionNode(ctx context.Context, req *pb.DecommissionNodeRequest) (*pb.DecommissionNodeResponse, error) {
+	adminId, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	var role = req.Role
+	if len(role) == 0 {
+		role = nodeconfigs.NodeRoleNode
+	}
+
+	var nodeName string
+	var process func(decommissionId int64) error
+	switch role {
+	case nodeconfigs.NodeRoleNode:
+		node, err := models.SharedNodeDAO.FindEnabledNode(tx, req.NodeId)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, errors.New("can not find node")
+		}
+		nodeName = node.Name
+		process = func(decommissionId int64) error {
+			return installers.SharedNodeQueue().DecommissionNodeProcess(decommissionId, req.NodeId, req.IsForced)
+		}
+	case nodeconfigs.NodeRoleDNS:
+		node, err := models.SharedNSNodeDAO.FindEnabledNSNode(tx, req.NodeId)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, errors.New("can not find node")
+		}
+		nodeName = node.Name
+		process = func(decommissionId int64) error {
+			return installers.SharedNSNodeQueue().DecommissionNodeProcess(decommissionId, req.NodeId, req.IsForced)
+		}
+	default:
+		return nil, errors.New("invalid role '" + role + "'")
+	}
+
+	decommissionId, err := models.SharedNodeDecommissionDAO.CreateDecommissionIfNotRunning(tx, role, req.NodeId, nodeName, adminId, req.IsForced)
+	if err != nil {
+		return nil, err
+	}
+	if decommissionId == 0 {
+		return nil, errors.New("the node is being decommissioned")
+	}
+
+	go func() {
+		err := process(decommissionId)
+		if err != nil {
+			logs.Println("[RPC]decommission node '" + nodeName + "':" + err.Error())
+		}
+	}()
+
+	return &pb.DecommissionNodeResponse{NodeDecommissionId: decommissionId}, nil
+}
+
+// FindEnabledNodeDecommission 查找下线记录
+func (this *NodeDecommissionService) FindEnabledNodeDecommission(ctx context.Context, req *pb.FindEnabledNodeDecommissionRequest) (*pb.FindEnabledNodeDecommissionResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	decommission, err := models.SharedNodeDecommissionDAO.FindEnabledNodeDecommission(tx, req.NodeDecommissionId)
+	if err != nil {
+		return nil, err
+	}
+	if decommission == nil {
+		return &pb.FindEnabledNodeDecommissionResponse{NodeDecommission: nil}, nil
+	}
+	return &pb.FindEnabledNodeDecommissionResponse{NodeDecommission: this.convertDecommission(decommission)}, nil
+}
+
+// CountAllEnabledNodeDecommissions 计算下线记录数量
+func (this *NodeDecommissionService) CountAllEnabledNodeDecommissions(ctx context.Context, req *pb.CountAllEnabledNodeDecommissionsRequest) (*pb.RPCCountResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	count, err := models.SharedNodeDecommissionDAO.CountAllEnabledDecommissions(tx, req.Role, req.NodeId)
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// ListEnabledNodeDecommissions 列出单页下线记录
+func (this *NodeDecommissionService) ListEnabledNodeDecommissions(ctx context.Context, req *pb.ListEnabledNodeDecommissionsRequest) (*pb.ListEnabledNodeDecommissionsResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	decommissions, err := models.SharedNodeDecommissionDAO.ListEnabledDecommissions(tx, req.Role, req.NodeId, req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	var pbDecommissions = []*pb.NodeDecommission{}
+	for _, decommission := range decommissions {
+		pbDecommissions = append(pbDecommissions, this.convertDecommission(decommission))
+	}
+	return &pb.ListEnabledNodeDecommissionsResponse{NodeDecommissions: pbDecommissions}, nil
+}
+
+// 转换下线记录
+func (this *NodeDecommissionService) convertDecommission(decommission *models.NodeDecommission) *pb.NodeDecommission {
+	var pbSteps = []*pb.NodeDecommissionStep{}
+	for _, step := range decommission.DecodeSteps() {
+		pbSteps = append(pbSteps, &pb.NodeDecommissionStep{
+			Code:      step.Code,
+			Status:    step.Status,
+			Message:   step.Message,
+			CreatedAt: step.CreatedAt,
+		})
+	}
+	return &pb.NodeDecommission{
+		Id:         int64(decommission.Id),
+		Role:       decommission.Role,
+		NodeId:     int64(decommission.NodeId),
+		NodeName:   decommission.NodeName,
+		AdminId:    int64(decommission.AdminId),
+		IsForced:   decommission.IsForced == 1,
+		Status:     decommission.Status,
+		Steps:      pbSteps,
+		Error:      decommission.Error,
+		CreatedAt:  int64(decommission.CreatedAt),
+		FinishedAt: int64(decommission.FinishedAt),
+	}
+}
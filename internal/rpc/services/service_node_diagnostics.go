@@ -0,0 +1,231 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/1uLang/EdgeCommon/pkg/messageconfigs"
+	"github.com/1uLang/EdgeCommon/pkg/nodeconfigs"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/installers"
+	"github.com/iwind/TeaGo/logs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+	"time"
+)
+
+const (
+	NodeDiagnosticsMethodAuto   = "auto"   // 优先使用节点连接，失败时使用SSH
+	NodeDiagnosticsMethodStream = "stream" // 通过节点和API节点之间的连接
+	NodeDiagnosticsMethodSSH    = "ssh"    // 通过SSH登录节点
+
+	nodeDiagnosticsStreamTimeout = 60 // 通过节点连接执行的超时时间
+)
+
+// NodeDiagnosticsService 节点诊断
+type NodeDiagnosticsService struct {
+	BaseService
+}
+
+// FindAllNodeDiagnosticCommands 列出所有可以执行的诊断命令
+func (this *NodeDiagnosticsService) FindAllNodeDiagnosticCommands(ctx context.Context, req *pb.FindAllNodeDiagnosticCommandsRequest) (*pb.FindAllNodeDiagnosticCommandsResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbCommands = []*pb.NodeDiagnosticCommand{}
+	for _, command := range installers.DiagnosticCommands {
+		pbCommands = append(pbCommands, &pb.NodeDiagnosticCommand{
+			Code: command.Code,
+			Name: command.Name,
+		})
+	}
+	return &pb.FindAllNodeDiagnosticCommandsResponse{NodeDiagnosticCommands: pbCommands}, nil
+}
+
+// RunNodeDiagnostics 在节点上执行诊断命令并生成诊断包
+// 只能执行预先审核过的命令，诊断包保存在文件管理中，每次调用都会记录审计日志
+func (this *NodeDiagnosticsService) RunNodeDiagnostics(ctx context.Context, req *pb.RunNodeDiagnosticsRequest) (*pb.RunNodeDiagnosticsResponse, error) {
+	adminId, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	var role = req.Role
+	if len(role) == 0 {
+		role = nodeconfigs.NodeRoleNode
+	}
+	var method = req.Method
+	if len(method) == 0 {
+		method = NodeDiagnosticsMethodAuto
+	}
+	if method != NodeDiagnosticsMethodAuto && method != NodeDiagnosticsMethodStream && method != NodeDiagnosticsMethodSSH {
+		return nil, errors.New("invalid method '" + method + "'")
+	}
+	_, err = installers.FindDiagnosticCommands(req.Codes)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodeName string
+	switch role {
+	case nodeconfigs.NodeRoleNode:
+		node, err := models.SharedNodeDAO.FindEnabledNode(tx, req.NodeId)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, errors.New("can not find node")
+		}
+		nodeName = node.Name
+	case nodeconfigs.NodeRoleDNS:
+		// DNS节点暂时只能通过SSH执行
+		if method == NodeDiagnosticsMethodStream {
+			return nil, errors.New("dns node does not support method '" + method + "'")
+		}
+		method = NodeDiagnosticsMethodSSH
+		node, err := models.SharedNSNodeDAO.FindEnabledNSNode(tx, req.NodeId)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, errors.New("can not find node")
+		}
+		nodeName = node.Name
+	default:
+		return nil, errors.New("invalid role '" + role + "'")
+	}
+
+	results, usedMethod, runErr := this.run(role, req.NodeId, req.Codes, method)
+
+	// 保存诊断包
+	var fileId int64
+	var filename string
+	if runErr == nil {
+		var info = &installers.DiagnosticsBundleInfo{
+			Role:      role,
+			NodeId:    req.NodeId,
+			NodeName:  nodeName,
+			Method:    usedMethod,
+			AdminId:   adminId,
+			CreatedAt: time.Now().Unix(),
+		}
+		filename = "diagnostics-" + role + "-" + types.String(req.NodeId) + "-" + time.Unix(info.CreatedAt, 0).Format("20060102150405") + ".zip"
+		bundle, err := installers.BuildDiagnosticsBundle(info, results)
+		if err == nil {
+			fileId, err = models.SharedFileDAO.CreateFileWithData(tx, adminId, 0, installers.DiagnosticsFileType, "诊断包："+nodeName, filename, bundle)
+		}
+		runErr = err
+	}
+
+	// 成功和失败都需要记录审计日志
+	var level = "info"
+	var auditMap = maps.Map{
+		"role":     role,
+		"nodeId":   req.NodeId,
+		"nodeName": nodeName,
+		"codes":    req.Codes,
+		"method":   usedMethod,
+		"fileId":   fileId,
+	}
+	if runErr != nil {
+		level = "error"
+		auditMap["error"] = runErr.Error()
+	}
+	err = this.CreateAuditLog(ctx, nil, level, "收集节点诊断信息 "+nodeName, nil, auditMap)
+	if err != nil {
+		logs.Println("[RPC]create audit log for node diagnostics failed: " + err.Error())
+	}
+
+	if runErr != nil {
+		return nil, runErr
+	}
+
+	var pbResults = []*pb.NodeDiagnosticResult{}
+	for _, result := range results {
+		pbResults = append(pbResults, &pb.NodeDiagnosticResult{
+			Code:   result.Code,
+			Name:   result.Name,
+			Error:  result.Error,
+			Size:   int64(len(result.Output)),
+			CostMs: result.CostMs,
+		})
+	}
+	return &pb.RunNodeDiagnosticsResponse{
+		FileId:                fileId,
+		Filename:              filename,
+		Method:                usedMethod,
+		NodeDiagnosticResults: pbResults,
+	}, nil
+}
+
+// 执行诊断命令，返回结果和实际使用的方式
+func (this *NodeDiagnosticsService) run(role string, nodeId int64, codes []string, method string) (results []*installers.DiagnosticResult, usedMethod string, err error) {
+	if role == nodeconfigs.NodeRoleDNS {
+		results, err = installers.SharedNSNodeQueue().RunDiagnostics(nodeId, codes)
+		return results, NodeDiagnosticsMethodSSH, err
+	}
+
+	if method != NodeDiagnosticsMethodSSH {
+		results, err = this.runWithStream(nodeId, codes)
+		if err == nil || method == NodeDiagnosticsMethodStream {
+			return results, NodeDiagnosticsMethodStream, err
+		}
+		logs.Println("[RPC]run diagnostics on node '" + types.String(nodeId) + "' with stream failed, try ssh: " + err.Error())
+	}
+
+	results, err = installers.SharedNodeQueue().RunDiagnostics(nodeId, codes)
+	return results, NodeDiagnosticsMethodSSH, err
+}
+
+// 通过节点连接执行诊断命令，节点只会执行和代号对应的命令
+func (this *NodeDiagnosticsService) runWithStream(nodeId int64, codes []string) ([]*installers.DiagnosticResult, error) {
+	commands, err := installers.FindDiagnosticCommands(codes)
+	if err != nil {
+		return nil, err
+	}
+	var msg = &messageconfigs.RunDiagnosticsMessage{}
+	for _, command := range commands {
+		msg.Codes = append(msg.Codes, command.Code)
+	}
+	msgJSON, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := SendCommandToNode(nodeId, NextCommandRequestId(), messageconfigs.MessageCodeRunDiagnostics, msgJSON, nodeDiagnosticsStreamTimeout, true)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.IsOk {
+		return nil, errors.New(resp.Message)
+	}
+
+	var nodeResults = []*installers.DiagnosticResult{}
+	err = json.Unmarshal(resp.DataJSON, &nodeResults)
+	if err != nil {
+		return nil, errors.New("decode diagnostic results failed: " + err.Error())
+	}
+
+	// 只保留请求的命令结果
+	var results = []*installers.DiagnosticResult{}
+	for _, command := range commands {
+		for _, result := range nodeResults {
+			if result.Code != command.Code {
+				continue
+			}
+			result.Name = command.Name
+			if len(result.Output) > installers.DiagnosticsMaxOutputBytes {
+				result.Output = result.Output[:installers.DiagnosticsMaxOutputBytes]
+			}
+			results = append(results, result)
+			break
+		}
+	}
+	return results, nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils/numberutils"
+	"github.com/iwind/TeaGo/dbs"
 	"golang.org/x/crypto/ssh"
 	"net"
 	"time"
@@ -24,15 +25,27 @@ func (this *NodeGrantService) CreateNodeGrant(ctx context.Context, req *pb.Creat
 		return nil, err
 	}
 
-	tx := this.NullTx()
-
-	grantId, err := models.SharedNodeGrantDAO.CreateGrant(tx, adminId, req.Name, req.Method, req.Username, req.Password, req.PrivateKey, req.Passphrase, req.Description, req.NodeId)
+	var grantId int64
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		grantId, err = models.SharedNodeGrantDAO.CreateGrant(tx, adminId, req.Name, req.Method, req.Username, req.Password, req.PrivateKey, req.Passphrase, req.Description, req.NodeId)
+		if err != nil {
+			return err
+		}
+		grant, err := models.SharedNodeGrantDAO.FindEnabledNodeGrant(tx, grantId)
+		if err != nil {
+			return err
+		}
+		if grant == nil {
+			return nil
+		}
+		return this.CreateAuditLog(ctx, tx, "info", "创建节点认证 "+grant.Name, nil, grant.AuditMap())
+	})
 	if err != nil {
 		return nil, err
 	}
 	return &pb.CreateNodeGrantResponse{
 		NodeGrantId: grantId,
-	}, err
+	}, nil
 }
 
 // UpdateNodeGrant 修改认证
@@ -46,9 +59,33 @@ func (this *NodeGrantService) UpdateNodeGrant(ctx context.Context, req *pb.Updat
 		return nil, errors.New("wrong grantId")
 	}
 
-	tx := this.NullTx()
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		oldGrant, err := models.SharedNodeGrantDAO.FindEnabledNodeGrant(tx, req.NodeGrantId)
+		if err != nil {
+			return err
+		}
+		if oldGrant == nil {
+			return errors.New("can not find grant with id '" + numberutils.FormatInt64(req.NodeGrantId) + "'")
+		}
+
+		err = models.SharedNodeGrantDAO.UpdateGrant(tx, req.NodeGrantId, req.Name, req.Method, req.Username, req.Password, req.PrivateKey, req.Passphrase, req.Description, req.NodeId)
+		if err != nil {
+			return err
+		}
+
+		newGrant, err := models.SharedNodeGrantDAO.FindEnabledNodeGrant(tx, req.NodeGrantId)
+		if err != nil {
+			return err
+		}
+		if newGrant == nil {
+			return nil
+		}
+		return this.CreateAuditLog(ctx, tx, "info", "修改节点认证 "+newGrant.Name, oldGrant.AuditMap(), newGrant.AuditMap())
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	err = models.SharedNodeGrantDAO.UpdateGrant(tx, req.NodeGrantId, req.Name, req.Method, req.Username, req.Password, req.PrivateKey, req.Passphrase, req.Description, req.NodeId)
 	return this.Success()
 }
 
@@ -59,9 +96,20 @@ func (this *NodeGrantService) DisableNodeGrant(ctx context.Context, req *pb.Disa
 		return nil, err
 	}
 
-	tx := this.NullTx()
-
-	err = models.SharedNodeGrantDAO.DisableNodeGrant(tx, req.NodeGrantId)
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		oldGrant, err := models.SharedNodeGrantDAO.FindEnabledNodeGrant(tx, req.NodeGrantId)
+		if err != nil {
+			return err
+		}
+		err = models.SharedNodeGrantDAO.DisableNodeGrant(tx, req.NodeGrantId)
+		if err != nil {
+			return err
+		}
+		if oldGrant == nil {
+			return nil
+		}
+		return this.CreateAuditLog(ctx, tx, "warn", "删除节点认证 "+oldGrant.Name, oldGrant.AuditMap(), nil)
+	})
 	return &pb.DisableNodeGrantResponse{}, err
 }
 
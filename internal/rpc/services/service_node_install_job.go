@@ -0,0 +1,215 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package services
+
+import (
+	"context"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/iwind/TeaGo/dbs"
+)
+
+// NodeInstallJobService 节点批量安装和滚动升级任务
+type NodeInstallJobService struct {
+	BaseService
+}
+
+// CreateNodeInstallJob 创建批量安装任务
+// 没有指定节点时，安装集群中所有未安装的节点，或者升级集群中所有已安装的节点
+func (this *NodeInstallJobService) CreateNodeInstallJob(ctx context.Context, req *pb.CreateNodeInstallJobRequest) (*pb.CreateNodeInstallJobResponse, error) {
+	adminId, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	var nodeIds = req.NodeIds
+	if len(nodeIds) == 0 {
+		if req.NodeClusterId <= 0 {
+			return nil, errors.New("'nodeIds' or 'nodeClusterId' should not be empty")
+		}
+		nodes, err := models.SharedNodeDAO.FindAllEnabledNodesWithClusterId(tx, req.NodeClusterId)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			if node.IsOn != 1 {
+				continue
+			}
+			if req.IsUpgrading != (node.IsInstalled == 1) {
+				continue
+			}
+			nodeIds = append(nodeIds, int64(node.Id))
+		}
+		if len(nodeIds) == 0 {
+			return nil, errors.New("no nodes to install in the cluster")
+		}
+	}
+
+	jobId, err := models.SharedNodeInstallJobDAO.CreateJob(tx, adminId, req.NodeClusterId, nodeIds, req.IsUpgrading, int(req.Concurrency), int(req.CanarySize), int(req.MaxFailures), req.HealthCheck)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateNodeInstallJobResponse{NodeInstallJobId: jobId}, nil
+}
+
+// FindEnabledNodeInstallJob 查找任务进度
+func (this *NodeInstallJobService) FindEnabledNodeInstallJob(ctx context.Context, req *pb.FindEnabledNodeInstallJobRequest) (*pb.FindEnabledNodeInstallJobResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	job, err := models.SharedNodeInstallJobDAO.FindEnabledNodeInstallJob(tx, req.NodeInstallJobId)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return &pb.FindEnabledNodeInstallJobResponse{NodeInstallJob: nil}, nil
+	}
+	pbJob, err := this.convertJob(tx, job, true)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.FindEnabledNodeInstallJobResponse{NodeInstallJob: pbJob}, nil
+}
+
+// CountAllEnabledNodeInstallJobs 计算任务数量
+func (this *NodeInstallJobService) CountAllEnabledNodeInstallJobs(ctx context.Context, req *pb.CountAllEnabledNodeInstallJobsRequest) (*pb.RPCCountResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	count, err := models.SharedNodeInstallJobDAO.CountAllEnabledJobs(tx, req.NodeClusterId)
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// ListEnabledNodeInstallJobs 列出单页任务，不包含节点进度
+func (this *NodeInstallJobService) ListEnabledNodeInstallJobs(ctx context.Context, req *pb.ListEnabledNodeInstallJobsRequest) (*pb.ListEnabledNodeInstallJobsResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	jobs, err := models.SharedNodeInstallJobDAO.ListEnabledJobs(tx, req.NodeClusterId, req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	var pbJobs = []*pb.NodeInstallJob{}
+	for _, job := range jobs {
+		pbJob, err := this.convertJob(tx, job, false)
+		if err != nil {
+			return nil, err
+		}
+		pbJobs = append(pbJobs, pbJob)
+	}
+	return &pb.ListEnabledNodeInstallJobsResponse{NodeInstallJobs: pbJobs}, nil
+}
+
+// PauseNodeInstallJob 暂停任务
+func (this *NodeInstallJobService) PauseNodeInstallJob(ctx context.Context, req *pb.PauseNodeInstallJobRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	ok, err := models.SharedNodeInstallJobDAO.PauseJob(tx, req.NodeInstallJobId, "paused by admin")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("only pending or running job can be paused")
+	}
+	return this.Success()
+}
+
+// ResumeNodeInstallJob 恢复暂停的任务
+func (this *NodeInstallJobService) ResumeNodeInstallJob(ctx context.Context, req *pb.ResumeNodeInstallJobRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	ok, err := models.SharedNodeInstallJobDAO.ResumeJob(tx, req.NodeInstallJobId)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("only paused job can be resumed")
+	}
+	return this.Success()
+}
+
+// CancelNodeInstallJob 取消任务
+func (this *NodeInstallJobService) CancelNodeInstallJob(ctx context.Context, req *pb.CancelNodeInstallJobRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	ok, err := models.SharedNodeInstallJobDAO.CancelJob(tx, req.NodeInstallJobId)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("the job has already finished")
+	}
+	return this.Success()
+}
+
+func (this *NodeInstallJobService) convertJob(tx *dbs.Tx, job *models.NodeInstallJob, withNodes bool) (*pb.NodeInstallJob, error) {
+	var pbJob = &pb.NodeInstallJob{
+		Id:            int64(job.Id),
+		NodeClusterId: int64(job.ClusterId),
+		IsUpgrading:   job.IsUpgrading == 1,
+		Concurrency:   int32(job.Concurrency),
+		CanarySize:    int32(job.CanarySize),
+		MaxFailures:   int32(job.MaxFailures),
+		HealthCheck:   job.HealthCheck == 1,
+		Status:        job.Status,
+		CountNodes:    int32(job.CountNodes),
+		CountFinished: int32(job.CountFinished),
+		CountFailed:   int32(job.CountFailed),
+		CurrentWave:   int32(job.CurrentWave),
+		CountWaves:    int32(job.CountWaves()),
+		Error:         job.Error,
+		CreatedAt:     int64(job.CreatedAt),
+		StartedAt:     int64(job.StartedAt),
+		UpdatedAt:     int64(job.UpdatedAt),
+		FinishedAt:    int64(job.FinishedAt),
+	}
+	if withNodes {
+		jobNodes, err := job.DecodeNodes()
+		if err != nil {
+			return nil, err
+		}
+		for _, jobNode := range jobNodes {
+			nodeName, err := models.SharedNodeDAO.FindNodeName(tx, jobNode.NodeId)
+			if err != nil {
+				return nil, err
+			}
+			pbJob.Nodes = append(pbJob.Nodes, &pb.NodeInstallJobNode{
+				NodeId:     jobNode.NodeId,
+				NodeName:   nodeName,
+				Wave:       int32(jobNode.Wave),
+				Status:     jobNode.Status,
+				Error:      jobNode.Error,
+				ErrorCode:  jobNode.ErrorCode,
+				StartedAt:  jobNode.StartedAt,
+				FinishedAt: jobNode.FinishedAt,
+			})
+		}
+	}
+	return pbJob, nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package services
+
+import (
+	"context"
+	"github.com/1uLang/EdgeCommon/pkg/nodeconfigs"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/iwind/TeaGo/dbs"
+	"net"
+	"strings"
+)
+
+// 节点注册时最多可以上报的IP地址数量
+const maxEnrollNodeIPAddresses = 16
+
+// NodeJoinTokenService 节点注册令牌
+type NodeJoinTokenService struct {
+	BaseService
+}
+
+// CreateNodeJoinToken 创建注册令牌，令牌明文只在创建时返回一次
+func (this *NodeJoinTokenService) CreateNodeJoinToken(ctx context.Context, req *pb.CreateNodeJoinTokenRequest) (*pb.CreateNodeJoinTokenResponse, error) {
+	adminId, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	cluster, err := models.SharedNodeClusterDAO.FindEnabledNodeCluster(tx, req.NodeClusterId)
+	if err != nil {
+		return nil, err
+	}
+	if cluster == nil {
+		return nil, errors.New("can not find cluster")
+	}
+
+	tokenId, token, err := models.SharedNodeJoinTokenDAO.CreateToken(tx, adminId, req.NodeClusterId, req.NodeGroupId, req.NodeRegionId, req.Name, req.LifeSeconds)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateNodeJoinTokenResponse{
+		NodeJoinTokenId: tokenId,
+		Token:           token,
+	}, nil
+}
+
+// DeleteNodeJoinToken 吊销注册令牌
+func (this *NodeJoinTokenService) DeleteNodeJoinToken(ctx context.Context, req *pb.DeleteNodeJoinTokenRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedNodeJoinTokenDAO.DisableNodeJoinToken(tx, req.NodeJoinTokenId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// CountAllEnabledNodeJoinTokens 计算注册令牌数量
+func (this *NodeJoinTokenService) CountAllEnabledNodeJoinTokens(ctx context.Context, req *pb.CountAllEnabledNodeJoinTokensRequest) (*pb.RPCCountResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	count, err := models.SharedNodeJoinTokenDAO.CountAllEnabledTokens(tx, req.NodeClusterId)
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// ListEnabledNodeJoinTokens 列出单页注册令牌
+func (this *NodeJoinTokenService) ListEnabledNodeJoinTokens(ctx context.Context, req *pb.ListEnabledNodeJoinTokensRequest) (*pb.ListEnabledNodeJoinTokensResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	tokens, err := models.SharedNodeJoinTokenDAO.ListEnabledTokens(tx, req.NodeClusterId, req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	var pbTokens = []*pb.NodeJoinToken{}
+	for _, token := range tokens {
+		pbTokens = append(pbTokens, &pb.NodeJoinToken{
+			Id:            int64(token.Id),
+			NodeClusterId: int64(token.ClusterId),
+			NodeGroupId:   int64(token.GroupId),
+			NodeRegionId:  int64(token.RegionId),
+			Name:          token.Name,
+			ExpiresAt:     int64(token.ExpiresAt),
+			IsUsed:        token.IsUsed == 1,
+			UsedAt:        int64(token.UsedAt),
+			UsedNodeId:    int64(token.UsedNodeId),
+			UsedIP:        token.UsedIP,
+			CreatedAt:     int64(token.CreatedAt),
+		})
+	}
+	return &pb.ListEnabledNodeJoinTokensResponse{NodeJoinTokens: pbTokens}, nil
+}
+
+// EnrollNode 节点使用注册令牌注册
+// 此接口不需要节点认证，由令牌本身校验；注册成功后返回节点的ID和密钥
+func (this *NodeJoinTokenService) EnrollNode(ctx context.Context, req *pb.EnrollNodeRequest) (*pb.EnrollNodeResponse, error) {
+	var tx = this.NullTx()
+	token, err := models.SharedNodeJoinTokenDAO.FindUsableToken(tx, req.Token)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, errors.New("invalid or expired join token")
+	}
+
+	var clusterId = int64(token.ClusterId)
+	cluster, err := models.SharedNodeClusterDAO.FindEnabledNodeCluster(tx, clusterId)
+	if err != nil {
+		return nil, err
+	}
+	if cluster == nil {
+		return nil, errors.New("the cluster of join token has been deleted")
+	}
+
+	// 检查上报的IP地址
+	var requestIP = rpcutils.RequestIP(ctx)
+	var ipAddresses = []string{}
+	for _, ip := range req.IpAddresses {
+		ip = strings.TrimSpace(ip)
+		if net.ParseIP(ip) == nil {
+			return nil, errors.New("invalid ip address '" + ip + "'")
+		}
+		ipAddresses = append(ipAddresses, ip)
+	}
+	if len(ipAddresses) > maxEnrollNodeIPAddresses {
+		return nil, errors.New("too many ip addresses")
+	}
+	if len(ipAddresses) == 0 && net.ParseIP(requestIP) != nil {
+		ipAddresses = append(ipAddresses, requestIP)
+	}
+
+	var name = strings.TrimSpace(req.Name)
+	if len(name) == 0 {
+		name = strings.TrimSpace(req.Hostname)
+	}
+	if len(name) == 0 && len(ipAddresses) > 0 {
+		name = ipAddresses[0]
+	}
+	if len(name) == 0 {
+		return nil, errors.New("'name' should not be empty")
+	}
+
+	var adminId = int64(token.AdminId)
+	var nodeId int64
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		nodeId, err = models.SharedNodeDAO.CreateNode(tx, adminId, name, clusterId, int64(token.GroupId), int64(token.RegionId))
+		if err != nil {
+			return err
+		}
+
+		// 令牌只能使用一次
+		ok, err := models.SharedNodeJoinTokenDAO.ConsumeToken(tx, int64(token.Id), nodeId, requestIP)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("invalid or expired join token")
+		}
+
+		err = models.SharedNodeDAO.UpdateNodeIsInstalled(tx, nodeId, true)
+		if err != nil {
+			return err
+		}
+
+		for _, ip := range ipAddresses {
+			_, err = models.SharedNodeIPAddressDAO.CreateAddress(tx, adminId, nodeId, nodeconfigs.NodeRoleNode, "", ip, true, true)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := models.SharedNodeDAO.FindEnabledNode(tx, nodeId)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, errors.New("can not find node after creating")
+	}
+
+	// 获取集群可以使用的所有API节点
+	apiAddrs, err := models.SharedNodeClusterDAO.FindAllAPINodeAddrsWithCluster(tx, clusterId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.EnrollNodeResponse{
+		NodeId:    nodeId,
+		UniqueId:  node.UniqueId,
+		Secret:    node.Secret,
+		Endpoints: apiAddrs,
+	}, nil
+}
@@ -66,3 +66,58 @@ func (this *NodeLoginService) FindNodeLoginSuggestPorts(ctx context.Context, req
 		AvailablePorts: availablePorts,
 	}, nil
 }
+
+// FindNodeLoginHostKey 查看信任的和待确认的主机密钥
+func (this *NodeLoginService) FindNodeLoginHostKey(ctx context.Context, req *pb.FindNodeLoginHostKeyRequest) (*pb.FindNodeLoginHostKeyResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	login, err := models.SharedNodeLoginDAO.FindEnabledNodeLogin(tx, req.NodeLoginId)
+	if err != nil {
+		return nil, err
+	}
+	if login == nil {
+		return &pb.FindNodeLoginHostKeyResponse{}, nil
+	}
+	return &pb.FindNodeLoginHostKeyResponse{
+		HostKeyType:               login.HostKeyType,
+		HostKeyFingerprint:        login.HostKeyFingerprint,
+		HostKeyPinnedAt:           int64(login.HostKeyPinnedAt),
+		PendingHostKeyType:        login.PendingHostKeyType,
+		PendingHostKeyFingerprint: login.PendingHostKeyFingerprint,
+		PendingHostKeyAt:          int64(login.PendingHostKeyAt),
+	}, nil
+}
+
+// ApproveNodeLoginHostKey 信任待确认的主机密钥
+func (this *NodeLoginService) ApproveNodeLoginHostKey(ctx context.Context, req *pb.ApproveNodeLoginHostKeyRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedNodeLoginDAO.ApprovePendingHostKey(tx, req.NodeLoginId, req.HostKeyFingerprint)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// ResetNodeLoginHostKey 清除信任的主机密钥，下次连接时重新信任
+func (this *NodeLoginService) ResetNodeLoginHostKey(ctx context.Context, req *pb.ResetNodeLoginHostKeyRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedNodeLoginDAO.ResetHostKey(tx, req.NodeLoginId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
@@ -161,6 +161,16 @@ func (this *NodeService) NodeStream(server pb.NodeService_NodeStreamServer) erro
 		if err != nil {
 			return err
 		}
+
+		// 通知Webhook订阅
+		err = models.SharedWebhookDAO.NotifyEvent(tx, models.WebhookEventTypeNodeOnline, maps.Map{
+			"nodeId":    nodeId,
+			"name":      nodeName,
+			"clusterId": clusterId,
+		})
+		if err != nil {
+			remotelogs.Error("NODE_SERVICE", "notify webhooks failed: "+err.Error())
+		}
 	}
 
 	nodeLocker.Lock()
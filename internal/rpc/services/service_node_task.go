@@ -49,7 +49,15 @@ func (this *NodeTaskService) FindNodeTasks(ctx context.Context, req *pb.FindNode
 			return nil, err
 		}
 		if status != nil && len(status.OS) > 0 && len(status.Arch) > 0 && len(status.BuildVersion) > 0 {
-			deployFile := installers.SharedDeployManager.FindNodeFile(status.OS, status.Arch)
+			clusterId, err := models.SharedNodeDAO.FindNodeClusterId(tx, nodeId)
+			if err != nil {
+				return nil, err
+			}
+			versionRange, err := models.SharedNodeClusterDAO.FindClusterPackageVersionRange(tx, clusterId)
+			if err != nil {
+				return nil, err
+			}
+			deployFile := installers.SharedDeployManager.FindNodeFileWithRange(status.OS, status.Arch, versionRange)
 			if deployFile != nil {
 				if stringutil.VersionCompare(deployFile.Version, status.BuildVersion) > 0 {
 					pbTasks = append(pbTasks, &pb.NodeTask{
@@ -7,6 +7,7 @@ import (
 	"github.com/1uLang/EdgeCommon/pkg/serverconfigs/sslconfigs"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models/acme"
+	"github.com/iwind/TeaGo/dbs"
 )
 
 // SSLCertService SSL证书相关服务
@@ -22,9 +23,14 @@ func (this *SSLCertService) CreateSSLCert(ctx context.Context, req *pb.CreateSSL
 		return nil, err
 	}
 
-	tx := this.NullTx()
-
-	certId, err := models.SharedSSLCertDAO.CreateCert(tx, adminId, userId, req.IsOn, req.Name, req.Description, req.ServerName, req.IsCA, req.CertData, req.KeyData, req.TimeBeginAt, req.TimeEndAt, req.DnsNames, req.CommonNames)
+	var certId int64
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		certId, err = models.SharedSSLCertDAO.CreateCert(tx, adminId, userId, req.IsOn, req.Name, req.Description, req.ServerName, req.IsCA, req.CertData, req.KeyData, req.TimeBeginAt, req.TimeEndAt, req.DnsNames, req.CommonNames)
+		if err != nil {
+			return err
+		}
+		return this.auditCert(ctx, tx, "创建证书", nil, certId)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +56,17 @@ func (this *SSLCertService) UpdateSSLCert(ctx context.Context, req *pb.UpdateSSL
 		}
 	}
 
-	err = models.SharedSSLCertDAO.UpdateCert(tx, req.SslCertId, req.IsOn, req.Name, req.Description, req.ServerName, req.IsCA, req.CertData, req.KeyData, req.TimeBeginAt, req.TimeEndAt, req.DnsNames, req.CommonNames)
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		oldCert, err := models.SharedSSLCertDAO.FindEnabledSSLCert(tx, req.SslCertId)
+		if err != nil {
+			return err
+		}
+		err = models.SharedSSLCertDAO.UpdateCert(tx, req.SslCertId, req.IsOn, req.Name, req.Description, req.ServerName, req.IsCA, req.CertData, req.KeyData, req.TimeBeginAt, req.TimeEndAt, req.DnsNames, req.CommonNames)
+		if err != nil {
+			return err
+		}
+		return this.auditCert(ctx, tx, "修改证书", oldCert, req.SslCertId)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -106,13 +122,25 @@ func (this *SSLCertService) DeleteSSLCert(ctx context.Context, req *pb.DeleteSSL
 		}
 	}
 
-	err = models.SharedSSLCertDAO.DisableSSLCert(tx, req.SslCertId)
-	if err != nil {
-		return nil, err
-	}
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		oldCert, err := models.SharedSSLCertDAO.FindEnabledSSLCert(tx, req.SslCertId)
+		if err != nil {
+			return err
+		}
 
-	// 停止相关ACME任务
-	err = acme.SharedACMETaskDAO.DisableAllTasksWithCertId(tx, req.SslCertId)
+		err = models.SharedSSLCertDAO.DisableSSLCert(tx, req.SslCertId)
+		if err != nil {
+			return err
+		}
+
+		// 停止相关ACME任务
+		err = acme.SharedACMETaskDAO.DisableAllTasksWithCertId(tx, req.SslCertId)
+		if err != nil {
+			return err
+		}
+
+		return this.auditCert(ctx, tx, "删除证书", oldCert, 0)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -180,3 +208,32 @@ func (this *SSLCertService) ListSSLCerts(ctx context.Context, req *pb.ListSSLCer
 	}
 	return &pb.ListSSLCertsResponse{SslCertsJSON: certConfigsJSON}, nil
 }
+
+// 记录证书变更的审计日志
+// oldCert为变更前的证书，newCertId为变更后需要读取的证书ID，删除时为0
+func (this *SSLCertService) auditCert(ctx context.Context, tx *dbs.Tx, description string, oldCert *models.SSLCert, newCertId int64) error {
+	var before, after interface{}
+	var name = ""
+	if oldCert != nil {
+		before = oldCert.AuditMap()
+		name = oldCert.Name
+	}
+	if newCertId > 0 {
+		newCert, err := models.SharedSSLCertDAO.FindEnabledSSLCert(tx, newCertId)
+		if err != nil {
+			return err
+		}
+		if newCert != nil {
+			after = newCert.AuditMap()
+			name = newCert.Name
+		}
+	}
+	if before == nil && after == nil {
+		return nil
+	}
+	var level = "info"
+	if after == nil {
+		level = "warn"
+	}
+	return this.CreateAuditLog(ctx, tx, level, description+" "+name, before, after)
+}
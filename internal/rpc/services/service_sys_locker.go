@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/iwind/TeaGo/types"
 )
 
 // SysLockerService 互斥锁管理
@@ -13,12 +14,9 @@ type SysLockerService struct {
 
 // SysLockerLock 获得锁
 func (this *SysLockerService) SysLockerLock(ctx context.Context, req *pb.SysLockerLockRequest) (*pb.SysLockerLockResponse, error) {
-	_, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
+	owner, userId, err := this.validateLockerOwner(ctx)
 	if err != nil {
-		_, err = this.ValidateMonitorNode(ctx)
-		if err != nil {
-			return nil, err
-		}
+		return nil, err
 	}
 
 	key := req.Key
@@ -34,21 +32,18 @@ func (this *SysLockerService) SysLockerLock(ctx context.Context, req *pb.SysLock
 	}
 
 	var tx = this.NullTx()
-	ok, err := models.SharedSysLockerDAO.Lock(tx, key, timeout)
+	token, ok, err := models.SharedSysLockerDAO.AcquireLock(tx, key, owner, timeout)
 	if err != nil {
 		return nil, err
 	}
-	return &pb.SysLockerLockResponse{Ok: ok}, nil
+	return &pb.SysLockerLockResponse{Ok: ok, FencingToken: token}, nil
 }
 
 // SysLockerUnlock 释放锁
 func (this *SysLockerService) SysLockerUnlock(ctx context.Context, req *pb.SysLockerUnlockRequest) (*pb.RPCSuccess, error) {
-	_, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
+	owner, userId, err := this.validateLockerOwner(ctx)
 	if err != nil {
-		_, err = this.ValidateMonitorNode(ctx)
-		if err != nil {
-			return nil, err
-		}
+		return nil, err
 	}
 
 	key := req.Key
@@ -56,9 +51,27 @@ func (this *SysLockerService) SysLockerUnlock(ctx context.Context, req *pb.SysLo
 		key = "@user"
 	}
 	var tx = this.NullTx()
-	err = models.SharedSysLockerDAO.Unlock(tx, key)
+	// 只能释放自己持有的锁
+	err = models.SharedSysLockerDAO.ReleaseLock(tx, key, owner, req.FencingToken)
 	if err != nil {
 		return nil, err
 	}
 	return this.Success()
 }
+
+// 校验调用者并获取锁的持有者标识
+func (this *SysLockerService) validateLockerOwner(ctx context.Context) (owner string, userId int64, err error) {
+	adminId, userId, err := this.ValidateAdminAndUser(ctx, 0, 0)
+	if err == nil {
+		if userId > 0 {
+			return "user:" + types.String(userId), userId, nil
+		}
+		return "admin:" + types.String(adminId), 0, nil
+	}
+
+	nodeId, err := this.ValidateMonitorNode(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	return "monitor:" + types.String(nodeId), 0, nil
+}
@@ -2,9 +2,14 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/filestores"
 	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
+	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/iwind/TeaGo/dbs"
 )
 
 type SysSettingService struct {
@@ -21,7 +26,36 @@ func (this *SysSettingService) UpdateSysSetting(ctx context.Context, req *pb.Upd
 
 	tx := this.NullTx()
 
-	err = models.SharedSysSettingDAO.UpdateSetting(tx, req.Code, req.ValueJSON)
+	// 检查文件存储配置
+	if req.Code == filestores.SettingCode {
+		var config = filestores.NewConfig()
+		err = json.Unmarshal(req.ValueJSON, config)
+		if err != nil {
+			return nil, errors.New("decode file store config failed: " + err.Error())
+		}
+		err = config.Init()
+		if err != nil {
+			return nil, err
+		}
+		err = models.SharedFileBlobDAO.CheckConfig(tx, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		oldValueJSON, err := models.SharedSysSettingDAO.ReadSetting(tx, req.Code)
+		if err != nil {
+			return err
+		}
+
+		err = models.SharedSysSettingDAO.UpdateSetting(tx, req.Code, req.ValueJSON)
+		if err != nil {
+			return err
+		}
+
+		return this.CreateAuditLog(ctx, tx, "info", "修改系统配置 "+req.Code, this.auditValue(oldValueJSON), this.auditValue(req.ValueJSON))
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -46,3 +80,17 @@ func (this *SysSettingService) ReadSysSetting(ctx context.Context, req *pb.ReadS
 
 	return &pb.ReadSysSettingResponse{ValueJSON: valueJSON}, nil
 }
+
+// 将配置值转换为审计日志中使用的数据
+// 密钥、密码和Header等敏感字段会被替换为掩码，以免写入审计日志
+func (this *SysSettingService) auditValue(valueJSON []byte) interface{} {
+	if len(valueJSON) == 0 {
+		return nil
+	}
+	var value interface{}
+	err := json.Unmarshal(valueJSON, &value)
+	if err != nil {
+		return string(valueJSON)
+	}
+	return utils.RedactJSONSecrets(value)
+}
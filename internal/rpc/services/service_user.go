@@ -10,6 +10,7 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	rpcutils "github.com/TeaOSLab/EdgeAPI/internal/rpc/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
+	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/types"
 	timeutil "github.com/iwind/TeaGo/utils/time"
 	"time"
@@ -27,9 +28,14 @@ func (this *UserService) CreateUser(ctx context.Context, req *pb.CreateUserReque
 		return nil, err
 	}
 
-	tx := this.NullTx()
-
-	userId, err := models.SharedUserDAO.CreateUser(tx, req.Username, req.Password, req.Fullname, req.Mobile, req.Tel, req.Email, req.Remark, req.Source, req.NodeClusterId)
+	var userId int64
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		userId, err = models.SharedUserDAO.CreateUser(tx, req.Username, req.Password, req.Fullname, req.Mobile, req.Tel, req.Email, req.Remark, req.Source, req.NodeClusterId)
+		if err != nil {
+			return err
+		}
+		return this.auditUser(ctx, tx, "创建用户", nil, userId)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -43,23 +49,33 @@ func (this *UserService) UpdateUser(ctx context.Context, req *pb.UpdateUserReque
 		return nil, err
 	}
 
-	tx := this.NullTx()
-
-	oldClusterId, err := models.SharedUserDAO.FindUserClusterId(tx, req.UserId)
-	if err != nil {
-		return nil, err
-	}
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		oldUser, err := models.SharedUserDAO.FindEnabledUser(tx, req.UserId, nil)
+		if err != nil {
+			return err
+		}
 
-	err = models.SharedUserDAO.UpdateUser(tx, req.UserId, req.Username, req.Password, req.Fullname, req.Mobile, req.Tel, req.Email, req.Remark, req.IsOn, req.NodeClusterId)
-	if err != nil {
-		return nil, err
-	}
+		oldClusterId, err := models.SharedUserDAO.FindUserClusterId(tx, req.UserId)
+		if err != nil {
+			return err
+		}
 
-	if oldClusterId != req.NodeClusterId {
-		err = models.SharedServerDAO.UpdateUserServersClusterId(tx, req.UserId, oldClusterId, req.NodeClusterId)
+		err = models.SharedUserDAO.UpdateUser(tx, req.UserId, req.Username, req.Password, req.Fullname, req.Mobile, req.Tel, req.Email, req.Remark, req.IsOn, req.NodeClusterId)
 		if err != nil {
-			return nil, err
+			return err
 		}
+
+		if oldClusterId != req.NodeClusterId {
+			err = models.SharedServerDAO.UpdateUserServersClusterId(tx, req.UserId, oldClusterId, req.NodeClusterId)
+			if err != nil {
+				return err
+			}
+		}
+
+		return this.auditUser(ctx, tx, "修改用户", oldUser, req.UserId)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return this.Success()
@@ -72,21 +88,30 @@ func (this *UserService) DeleteUser(ctx context.Context, req *pb.DeleteUserReque
 		return nil, err
 	}
 
-	tx := this.NullTx()
+	err = this.RunTx(func(tx *dbs.Tx) error {
+		oldUser, err := models.SharedUserDAO.FindEnabledUser(tx, req.UserId, nil)
+		if err != nil {
+			return err
+		}
 
-	// 删除其下的Server
-	serverIds, err := models.SharedServerDAO.FindAllEnabledServerIdsWithUserId(tx, req.UserId)
-	if err != nil {
-		return nil, err
-	}
-	for _, serverId := range serverIds {
-		err := models.SharedServerDAO.DisableServer(tx, serverId)
+		// 删除其下的Server
+		serverIds, err := models.SharedServerDAO.FindAllEnabledServerIdsWithUserId(tx, req.UserId)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		for _, serverId := range serverIds {
+			err := models.SharedServerDAO.DisableServer(tx, serverId)
+			if err != nil {
+				return err
+			}
 		}
-	}
 
-	_, err = models.SharedUserDAO.DisableUser(tx, req.UserId)
+		_, err = models.SharedUserDAO.DisableUser(tx, req.UserId)
+		if err != nil {
+			return err
+		}
+		return this.auditUser(ctx, tx, "删除用户", oldUser, 0)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -587,3 +612,32 @@ func (this *UserService) ComposeUserGlobalBoard(ctx context.Context, req *pb.Com
 
 	return result, nil
 }
+
+// 记录用户变更的审计日志
+// oldUser为变更前的用户，newUserId为变更后需要读取的用户ID，删除时为0
+func (this *UserService) auditUser(ctx context.Context, tx *dbs.Tx, description string, oldUser *models.User, newUserId int64) error {
+	var before, after interface{}
+	var username = ""
+	if oldUser != nil {
+		before = oldUser.AuditMap()
+		username = oldUser.Username
+	}
+	if newUserId > 0 {
+		newUser, err := models.SharedUserDAO.FindEnabledUser(tx, newUserId, nil)
+		if err != nil {
+			return err
+		}
+		if newUser != nil {
+			after = newUser.AuditMap()
+			username = newUser.Username
+		}
+	}
+	if before == nil && after == nil {
+		return nil
+	}
+	var level = "info"
+	if after == nil {
+		level = "warn"
+	}
+	return this.CreateAuditLog(ctx, tx, level, description+" "+username, before, after)
+}
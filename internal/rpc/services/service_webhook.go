@@ -0,0 +1,270 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package services
+
+import (
+	"context"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/iwind/TeaGo/types"
+)
+
+// WebhookService Webhook订阅服务
+type WebhookService struct {
+	BaseService
+}
+
+// CreateWebhook 创建订阅
+func (this *WebhookService) CreateWebhook(ctx context.Context, req *pb.CreateWebhookRequest) (*pb.CreateWebhookResponse, error) {
+	adminId, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.Url) == 0 {
+		return nil, errors.New("'url' should not be empty")
+	}
+
+	var tx = this.NullTx()
+	webhookId, err := models.SharedWebhookDAO.CreateWebhook(tx, adminId, req.Name, req.Url, req.Secret, req.EventTypes, req.IsOn)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateWebhookResponse{WebhookId: webhookId}, nil
+}
+
+// UpdateWebhook 修改订阅
+func (this *WebhookService) UpdateWebhook(ctx context.Context, req *pb.UpdateWebhookRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.Url) == 0 {
+		return nil, errors.New("'url' should not be empty")
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedWebhookDAO.UpdateWebhook(tx, req.WebhookId, req.Name, req.Url, req.Secret, req.EventTypes, req.IsOn)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// DeleteWebhook 删除订阅
+func (this *WebhookService) DeleteWebhook(ctx context.Context, req *pb.DeleteWebhookRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedWebhookDAO.DisableWebhook(tx, req.WebhookId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// FindEnabledWebhook 查找单个订阅
+func (this *WebhookService) FindEnabledWebhook(ctx context.Context, req *pb.FindEnabledWebhookRequest) (*pb.FindEnabledWebhookResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	webhook, err := models.SharedWebhookDAO.FindEnabledWebhook(tx, req.WebhookId)
+	if err != nil {
+		return nil, err
+	}
+	if webhook == nil {
+		return &pb.FindEnabledWebhookResponse{Webhook: nil}, nil
+	}
+	return &pb.FindEnabledWebhookResponse{Webhook: this.convertWebhook(webhook)}, nil
+}
+
+// CountAllEnabledWebhooks 计算订阅数量
+func (this *WebhookService) CountAllEnabledWebhooks(ctx context.Context, req *pb.CountAllEnabledWebhooksRequest) (*pb.RPCCountResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	count, err := models.SharedWebhookDAO.CountAllEnabledWebhooks(tx)
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// ListEnabledWebhooks 列出单页订阅
+func (this *WebhookService) ListEnabledWebhooks(ctx context.Context, req *pb.ListEnabledWebhooksRequest) (*pb.ListEnabledWebhooksResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	webhooks, err := models.SharedWebhookDAO.ListEnabledWebhooks(tx, req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	var pbWebhooks = []*pb.Webhook{}
+	for _, webhook := range webhooks {
+		pbWebhooks = append(pbWebhooks, this.convertWebhook(webhook))
+	}
+	return &pb.ListEnabledWebhooksResponse{Webhooks: pbWebhooks}, nil
+}
+
+// FindAllWebhookEventTypes 查找所有可订阅的事件类型
+func (this *WebhookService) FindAllWebhookEventTypes(ctx context.Context, req *pb.FindAllWebhookEventTypesRequest) (*pb.FindAllWebhookEventTypesResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var pbEventTypes = []*pb.WebhookEventType{}
+	for _, eventType := range models.FindAllWebhookEventTypes() {
+		pbEventTypes = append(pbEventTypes, &pb.WebhookEventType{
+			Name:        eventType.GetString("name"),
+			Code:        eventType.GetString("code"),
+			Description: eventType.GetString("description"),
+		})
+	}
+	return &pb.FindAllWebhookEventTypesResponse{WebhookEventTypes: pbEventTypes}, nil
+}
+
+// PingWebhook 发送测试事件
+func (this *WebhookService) PingWebhook(ctx context.Context, req *pb.PingWebhookRequest) (*pb.RPCSuccess, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	err = models.SharedWebhookDAO.PingWebhook(tx, req.WebhookId)
+	if err != nil {
+		return nil, err
+	}
+	return this.Success()
+}
+
+// CountWebhookDeliveries 计算投递数量
+func (this *WebhookService) CountWebhookDeliveries(ctx context.Context, req *pb.CountWebhookDeliveriesRequest) (*pb.RPCCountResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	count, err := models.SharedWebhookDeliveryDAO.CountDeliveries(tx, req.WebhookId, int(req.Status))
+	if err != nil {
+		return nil, err
+	}
+	return this.SuccessCount(count)
+}
+
+// ListWebhookDeliveries 列出单页投递
+func (this *WebhookService) ListWebhookDeliveries(ctx context.Context, req *pb.ListWebhookDeliveriesRequest) (*pb.ListWebhookDeliveriesResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	deliveries, err := models.SharedWebhookDeliveryDAO.ListDeliveries(tx, req.WebhookId, int(req.Status), req.Offset, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	var pbDeliveries = []*pb.WebhookDelivery{}
+	for _, delivery := range deliveries {
+		pbDeliveries = append(pbDeliveries, &pb.WebhookDelivery{
+			Id:            int64(delivery.Id),
+			WebhookId:     int64(delivery.WebhookId),
+			EventId:       delivery.EventId,
+			EventType:     delivery.EventType,
+			PayloadJSON:   []byte(delivery.Payload),
+			Status:        int32(delivery.Status),
+			CountAttempts: int32(delivery.CountAttempts),
+			NextAttemptAt: int64(delivery.NextAttemptAt),
+			LastAttemptAt: int64(delivery.LastAttemptAt),
+			CreatedAt:     int64(delivery.CreatedAt),
+		})
+	}
+	return &pb.ListWebhookDeliveriesResponse{WebhookDeliveries: pbDeliveries}, nil
+}
+
+// ListWebhookDeliveryAttempts 列出某个投递的所有尝试记录
+func (this *WebhookService) ListWebhookDeliveryAttempts(ctx context.Context, req *pb.ListWebhookDeliveryAttemptsRequest) (*pb.ListWebhookDeliveryAttemptsResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	attempts, err := models.SharedWebhookDeliveryAttemptDAO.FindAllAttemptsWithDeliveryId(tx, req.WebhookDeliveryId)
+	if err != nil {
+		return nil, err
+	}
+	var pbAttempts = []*pb.WebhookDeliveryAttempt{}
+	for _, attempt := range attempts {
+		pbAttempts = append(pbAttempts, this.convertAttempt(attempt))
+	}
+	return &pb.ListWebhookDeliveryAttemptsResponse{WebhookDeliveryAttempts: pbAttempts}, nil
+}
+
+// RedeliverWebhookDelivery 手动重新投递
+func (this *WebhookService) RedeliverWebhookDelivery(ctx context.Context, req *pb.RedeliverWebhookDeliveryRequest) (*pb.RedeliverWebhookDeliveryResponse, error) {
+	_, err := this.ValidateAdmin(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var tx = this.NullTx()
+	delivery, err := models.SharedWebhookDeliveryDAO.FindDelivery(tx, req.WebhookDeliveryId)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil {
+		return nil, errors.New("can not find delivery '" + types.String(req.WebhookDeliveryId) + "'")
+	}
+
+	attempt, err := models.SharedWebhookDeliveryDAO.Deliver(tx, delivery, true)
+	if err != nil {
+		return nil, err
+	}
+	if attempt == nil {
+		return nil, errors.New("the webhook of the delivery has been deleted")
+	}
+	return &pb.RedeliverWebhookDeliveryResponse{WebhookDeliveryAttempt: this.convertAttempt(attempt)}, nil
+}
+
+func (this *WebhookService) convertWebhook(webhook *models.Webhook) *pb.Webhook {
+	return &pb.Webhook{
+		Id:         int64(webhook.Id),
+		Name:       webhook.Name,
+		Url:        webhook.Url,
+		Secret:     webhook.Secret,
+		EventTypes: webhook.DecodeEventTypes(),
+		IsOn:       webhook.IsOn == 1,
+		CreatedAt:  int64(webhook.CreatedAt),
+	}
+}
+
+func (this *WebhookService) convertAttempt(attempt *models.WebhookDeliveryAttempt) *pb.WebhookDeliveryAttempt {
+	return &pb.WebhookDeliveryAttempt{
+		Id:                int64(attempt.Id),
+		WebhookDeliveryId: int64(attempt.DeliveryId),
+		IsManual:          attempt.IsManual == 1,
+		IsOk:              attempt.IsOk == 1,
+		StatusCode:        int32(attempt.StatusCode),
+		Error:             attempt.Error,
+		Response:          attempt.Response,
+		CostMs:            int64(attempt.CostMs),
+		CreatedAt:         int64(attempt.CreatedAt),
+	}
+}
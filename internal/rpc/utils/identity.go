@@ -0,0 +1,62 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package rpcutils
+
+import (
+	"context"
+	"errors"
+	"github.com/iwind/TeaGo/lists"
+)
+
+type identityContextKey struct{}
+
+// RequestIdentity 校验过的调用者身份
+type RequestIdentity struct {
+	UserType UserType
+	NodeId   int64
+	UserId   int64
+	Err      error // 校验失败时的错误
+}
+
+// IsAuthenticated 是否认证成功
+func (this *RequestIdentity) IsAuthenticated() bool {
+	return this.Err == nil
+}
+
+// ContextWithIdentity 校验请求并把结果放入上下文
+// 之后在同一个上下文中调用 ValidateRequest() 时直接使用此结果，不再重复解密令牌和查询数据库
+func ContextWithIdentity(ctx context.Context) (context.Context, *RequestIdentity) {
+	var identity = identityFromContext(ctx)
+	if identity != nil {
+		return ctx, identity
+	}
+
+	userType, nodeId, userId, err := ValidateRequest(ctx)
+	identity = &RequestIdentity{
+		UserType: userType,
+		NodeId:   nodeId,
+		UserId:   userId,
+		Err:      err,
+	}
+	return context.WithValue(ctx, identityContextKey{}, identity), identity
+}
+
+// 从上下文中读取校验过的身份
+func identityFromContext(ctx context.Context) *RequestIdentity {
+	identity, ok := ctx.Value(identityContextKey{}).(*RequestIdentity)
+	if !ok {
+		return nil
+	}
+	return identity
+}
+
+// 检查身份是否为允许的用户类型
+func (this *RequestIdentity) validate(userTypes []UserType) (userType UserType, nodeId int64, userId int64, err error) {
+	if this.Err != nil {
+		return this.UserType, this.NodeId, this.UserId, this.Err
+	}
+	if len(userTypes) > 0 && !lists.ContainsString(userTypes, this.UserType) {
+		return UserTypeNone, 0, 0, errors.New("not supported node type: '" + this.UserType + "'")
+	}
+	return this.UserType, this.NodeId, this.UserId, nil
+}
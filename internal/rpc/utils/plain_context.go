@@ -9,6 +9,9 @@ type PlainContext struct {
 	UserType string
 	UserId   int64
 
+	Method   string // 调用的方法，比如 /pb.NodeService/createNode
+	ClientIP string // 客户端IP
+
 	ctx context.Context
 }
 
@@ -35,3 +38,8 @@ func (this *PlainContext) Err() error {
 func (this *PlainContext) Value(key interface{}) interface{} {
 	return this.ctx.Value(key)
 }
+
+// SetContext 设置上级上下文，用于传递链路追踪跨度等数据
+func (this *PlainContext) SetContext(ctx context.Context) {
+	this.ctx = ctx
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package rpcutils
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+)
+
+// RequestMethod 获取当前请求的RPC方法
+func RequestMethod(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	plainCtx, ok := ctx.(*PlainContext)
+	if ok {
+		return plainCtx.Method
+	}
+
+	method, _ := grpc.Method(ctx)
+	return method
+}
+
+// RequestIP 获取当前请求的客户端IP
+// 优先使用客户端通过ip元数据传递的用户IP
+func RequestIP(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	plainCtx, ok := ctx.(*PlainContext)
+	if ok {
+		return plainCtx.ClientIP
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		ips := md.Get("ip")
+		if len(ips) > 0 && len(ips[0]) > 0 {
+			return ips[0]
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// RequestPeerIP 获取当前连接的对端IP
+// 和 RequestIP() 不同，不使用客户端自行传递的元数据，可以用于对未认证的调用限流
+func RequestPeerIP(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
@@ -12,7 +12,9 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	"github.com/iwind/TeaGo/lists"
 	"github.com/iwind/TeaGo/maps"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 type UserType = string
@@ -34,7 +36,22 @@ const (
 )
 
 // ValidateRequest 校验请求
+// 认证失败时返回 codes.Unauthenticated 错误，查询数据失败时返回 codes.Internal 错误
 func ValidateRequest(ctx context.Context, userTypes ...UserType) (userType UserType, resultNodeId int64, userId int64, err error) {
+	// 已经在拦截器中校验过
+	if ctx != nil {
+		identity := identityFromContext(ctx)
+		if identity != nil {
+			userType, resultNodeId, userId, err = identity.validate(userTypes)
+			return userType, resultNodeId, userId, toStatusError(err)
+		}
+	}
+
+	userType, resultNodeId, userId, err = validateRequest(ctx, userTypes...)
+	return userType, resultNodeId, userId, toStatusError(err)
+}
+
+func validateRequest(ctx context.Context, userTypes ...UserType) (userType UserType, resultNodeId int64, userId int64, err error) {
 	if ctx == nil {
 		err = errors.New("context should not be nil")
 		return
@@ -48,7 +65,11 @@ func ValidateRequest(ctx context.Context, userTypes ...UserType) (userType UserT
 
 		if len(userTypes) > 0 && !lists.ContainsString(userTypes, userType) {
 			userType = UserTypeNone
-			userId = 0
+			if userId > 0 {
+				userId = 0
+				err = status.Error(codes.PermissionDenied, "context: permission denied")
+				return
+			}
 		}
 
 		if userId <= 0 {
@@ -87,7 +108,7 @@ func ValidateRequest(ctx context.Context, userTypes ...UserType) (userType UserT
 	apiToken, err := models.SharedApiTokenDAO.FindEnabledTokenWithNodeCacheable(nil, nodeId)
 	if err != nil {
 		utils.PrintError(err)
-		return UserTypeNone, 0, 0, err
+		return UserTypeNone, 0, 0, internalError(err)
 	}
 	nodeUserId := int64(0)
 	if apiToken == nil {
@@ -108,7 +129,7 @@ func ValidateRequest(ctx context.Context, userTypes ...UserType) (userType UserT
 	method, err := encrypt.NewMethodInstance(teaconst.EncryptMethod, apiToken.Secret, nodeId)
 	if err != nil {
 		utils.PrintError(err)
-		return UserTypeNone, 0, 0, err
+		return UserTypeNone, 0, 0, internalError(err)
 	}
 	data, err = method.Decrypt(data)
 	if err != nil {
@@ -134,7 +155,7 @@ func ValidateRequest(ctx context.Context, userTypes ...UserType) (userType UserT
 		// TODO 需要检查集群是否已经删除
 		nodeIntId, err := models.SharedNodeDAO.FindEnabledNodeIdWithUniqueIdCacheable(nil, nodeId)
 		if err != nil {
-			return UserTypeNode, 0, 0, errors.New("context: " + err.Error())
+			return UserTypeNode, 0, 0, internalError(errors.New("context: " + err.Error()))
 		}
 		if nodeIntId <= 0 {
 			return UserTypeNode, 0, 0, errors.New("context: not found node with id '" + nodeId + "'")
@@ -144,7 +165,7 @@ func ValidateRequest(ctx context.Context, userTypes ...UserType) (userType UserT
 	case UserTypeCluster:
 		clusterId, err := models.SharedNodeClusterDAO.FindEnabledClusterIdWithUniqueId(nil, nodeId)
 		if err != nil {
-			return UserTypeCluster, 0, 0, errors.New("context: " + err.Error())
+			return UserTypeCluster, 0, 0, internalError(errors.New("context: " + err.Error()))
 		}
 		if clusterId <= 0 {
 			return UserTypeCluster, 0, 0, errors.New("context: not found cluster with id '" + nodeId + "'")
@@ -154,7 +175,7 @@ func ValidateRequest(ctx context.Context, userTypes ...UserType) (userType UserT
 	case UserTypeUser:
 		nodeIntId, err := models.SharedUserNodeDAO.FindEnabledUserNodeIdWithUniqueId(nil, nodeId)
 		if err != nil {
-			return UserTypeUser, 0, 0, errors.New("context: " + err.Error())
+			return UserTypeUser, 0, 0, internalError(errors.New("context: " + err.Error()))
 		}
 		if nodeIntId <= 0 {
 			return UserTypeUser, 0, 0, errors.New("context: not found node with id '" + nodeId + "'")
@@ -163,7 +184,7 @@ func ValidateRequest(ctx context.Context, userTypes ...UserType) (userType UserT
 	case UserTypeMonitor:
 		nodeIntId, err := models.SharedMonitorNodeDAO.FindEnabledMonitorNodeIdWithUniqueId(nil, nodeId)
 		if err != nil {
-			return UserTypeMonitor, 0, 0, errors.New("context: " + err.Error())
+			return UserTypeMonitor, 0, 0, internalError(errors.New("context: " + err.Error()))
 		}
 		if nodeIntId <= 0 {
 			return UserTypeMonitor, 0, 0, errors.New("context: not found node with id '" + nodeId + "'")
@@ -172,7 +193,7 @@ func ValidateRequest(ctx context.Context, userTypes ...UserType) (userType UserT
 	case UserTypeAuthority:
 		nodeIntId, err := authority.SharedAuthorityNodeDAO.FindEnabledAuthorityNodeIdWithUniqueId(nil, nodeId)
 		if err != nil {
-			return UserTypeAuthority, 0, 0, errors.New("context: " + err.Error())
+			return UserTypeAuthority, 0, 0, internalError(errors.New("context: " + err.Error()))
 		}
 		if nodeIntId <= 0 {
 			return UserTypeAuthority, 0, 0, errors.New("context: not found node with id '" + nodeId + "'")
@@ -182,7 +203,7 @@ func ValidateRequest(ctx context.Context, userTypes ...UserType) (userType UserT
 	case UserTypeDNS:
 		nodeIntId, err := models.SharedNSNodeDAO.FindEnabledNodeIdWithUniqueId(nil, nodeId)
 		if err != nil {
-			return UserTypeDNS, nodeIntId, 0, errors.New("context: " + err.Error())
+			return UserTypeDNS, nodeIntId, 0, internalError(errors.New("context: " + err.Error()))
 		}
 		if nodeIntId <= 0 {
 			return UserTypeDNS, nodeIntId, 0, errors.New("context: not found node with id '" + nodeId + "'")
@@ -192,7 +213,7 @@ func ValidateRequest(ctx context.Context, userTypes ...UserType) (userType UserT
 	case UserTypeReport:
 		nodeIntId, err := models.SharedReportNodeDAO.FindEnabledNodeIdWithUniqueId(nil, nodeId)
 		if err != nil {
-			return UserTypeReport, nodeIntId, 0, errors.New("context: " + err.Error())
+			return UserTypeReport, nodeIntId, 0, internalError(errors.New("context: " + err.Error()))
 		}
 		if nodeIntId <= 0 {
 			return UserTypeReport, nodeIntId, 0, errors.New("context: not found node with id '" + nodeId + "'")
@@ -208,10 +229,41 @@ func ValidateRequest(ctx context.Context, userTypes ...UserType) (userType UserT
 	}
 }
 
+// 查询数据等内部错误
+type internalErr struct {
+	err error
+}
+
+func (this *internalErr) Error() string {
+	return this.err.Error()
+}
+
+func internalError(err error) error {
+	return &internalErr{err: err}
+}
+
+// 转换为gRPC状态错误，从而调用者可以区分认证失败和服务器内部错误
+func toStatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if _, ok := err.(*internalErr); ok {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return status.Error(codes.Unauthenticated, err.Error())
+}
+
 // Wrap 包装错误
+// 包装gRPC状态错误时保留原有的状态码
 func Wrap(description string, err error) error {
 	if err == nil {
 		return errors.New(description)
 	}
+	if s, ok := status.FromError(err); ok {
+		return status.Error(s.Code(), description+": "+s.Message())
+	}
 	return errors.New(description + ": " + err.Error())
 }
@@ -0,0 +1,136 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package secrets
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/iwind/TeaGo/Tea"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	EnvMasterKeys = "EDGE_API_MASTER_KEYS" // 环境变量，格式和主密钥文件相同，多个密钥可以用逗号分隔
+	MasterKeyFile = "master.key"           // 配置目录下的主密钥文件
+	MasterKeySize = 32                     // 主密钥长度
+)
+
+var keyIdReg = regexp.MustCompile(`^[\w-]+$`)
+
+// MasterKey 主密钥
+type MasterKey struct {
+	Id  string
+	Key []byte
+}
+
+// DeriveKey 从主密钥派生用于其他用途的密钥，比如审计日志的哈希链
+// 不同用途使用不同的密钥，不会直接暴露主密钥
+func (this *MasterKey) DeriveKey(purpose string) []byte {
+	var h = hmac.New(sha256.New, this.Key)
+	h.Write([]byte("edge-api:" + purpose))
+	return h.Sum(nil)
+}
+
+// Keyring 主密钥集合
+// 第一个密钥为当前使用的密钥，用来加密新数据；其余的为轮换前的旧密钥，只用来解密
+type Keyring struct {
+	keys []*MasterKey
+}
+
+// ParseKeyring 分析主密钥，每行（或者用逗号分隔）一个密钥，格式为 ID:BASE64密钥
+// 空行和以#开头的行会被忽略
+func ParseKeyring(data string) (*Keyring, error) {
+	var keyring = &Keyring{}
+	var lines = strings.FieldsFunc(data, func(r rune) bool {
+		return r == '\n' || r == ','
+	})
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var index = strings.Index(line, ":")
+		if index <= 0 {
+			return nil, errors.New("invalid master key line, should be 'ID:BASE64_KEY'")
+		}
+		var keyId = line[:index]
+		if !keyIdReg.MatchString(keyId) {
+			return nil, errors.New("invalid master key id '" + keyId + "'")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line[index+1:]))
+		if err != nil {
+			return nil, errors.New("decode master key '" + keyId + "' failed: " + err.Error())
+		}
+		if len(key) != MasterKeySize {
+			return nil, errors.New("master key '" + keyId + "' should be 32 bytes")
+		}
+		if keyring.FindKey(keyId) != nil {
+			return nil, errors.New("duplicate master key id '" + keyId + "'")
+		}
+		keyring.keys = append(keyring.keys, &MasterKey{
+			Id:  keyId,
+			Key: key,
+		})
+	}
+	return keyring, nil
+}
+
+// LoadKeyring 从环境变量或者主密钥文件中加载主密钥
+// 都没有设置时返回空的主密钥集合
+func LoadKeyring() (*Keyring, error) {
+	var data = os.Getenv(EnvMasterKeys)
+	if len(data) > 0 {
+		return ParseKeyring(data)
+	}
+
+	fileData, err := ioutil.ReadFile(Tea.ConfigFile(MasterKeyFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Keyring{}, nil
+		}
+		return nil, err
+	}
+	return ParseKeyring(string(fileData))
+}
+
+// GenerateKeyLine 生成新的主密钥，返回可以直接写入主密钥文件的一行
+func GenerateKeyLine(keyId string) (string, error) {
+	if !keyIdReg.MatchString(keyId) {
+		return "", errors.New("invalid master key id '" + keyId + "'")
+	}
+	var key = make([]byte, MasterKeySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return keyId + ":" + base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ActiveKey 当前使用的主密钥
+func (this *Keyring) ActiveKey() *MasterKey {
+	if len(this.keys) == 0 {
+		return nil
+	}
+	return this.keys[0]
+}
+
+// FindKey 根据ID查找主密钥
+func (this *Keyring) FindKey(keyId string) *MasterKey {
+	for _, key := range this.keys {
+		if key.Id == keyId {
+			return key
+		}
+	}
+	return nil
+}
+
+// IsEmpty 是否没有任何主密钥
+func (this *Keyring) IsEmpty() bool {
+	return len(this.keys) == 0
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// 加密后的格式：EDGE_SECRET:v1:主密钥ID:BASE64(被主密钥加密的数据密钥):BASE64(被数据密钥加密的数据)
+// 每条数据使用单独的随机数据密钥，轮换主密钥时只需要用新的主密钥重新加密
+const (
+	SecretPrefix  = "EDGE_SECRET:"
+	secretVersion = "v1"
+	dataKeySize   = 32
+)
+
+var ErrMasterKeyNotFound = errors.New("master key not found")
+var ErrInvalidSecret = errors.New("invalid secret")
+
+// IsEncrypted 判断数据是否已经被加密
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, SecretPrefix)
+}
+
+// Encrypt 使用当前的主密钥加密数据
+func (this *Keyring) Encrypt(plaintext []byte) (string, error) {
+	var masterKey = this.ActiveKey()
+	if masterKey == nil {
+		return "", ErrMasterKeyNotFound
+	}
+
+	var dataKey = make([]byte, dataKeySize)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := seal(masterKey.Key, dataKey, this.additionalData(masterKey.Id))
+	if err != nil {
+		return "", err
+	}
+	data, err := seal(dataKey, plaintext, nil)
+	if err != nil {
+		return "", err
+	}
+	return SecretPrefix + secretVersion + ":" + masterKey.Id + ":" + base64.StdEncoding.EncodeToString(wrappedKey) + ":" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Decrypt 解密数据，可以使用任何一个主密钥
+func (this *Keyring) Decrypt(secret string) ([]byte, error) {
+	keyId, wrappedKey, data, err := this.parse(secret)
+	if err != nil {
+		return nil, err
+	}
+	var masterKey = this.FindKey(keyId)
+	if masterKey == nil {
+		return nil, errors.New("master key '" + keyId + "' not found")
+	}
+
+	dataKey, err := open(masterKey.Key, wrappedKey, this.additionalData(keyId))
+	if err != nil {
+		return nil, errors.New("decrypt data key with master key '" + keyId + "' failed: " + err.Error())
+	}
+	plaintext, err := open(dataKey, data, nil)
+	if err != nil {
+		return nil, errors.New("decrypt data failed: " + err.Error())
+	}
+	return plaintext, nil
+}
+
+// NeedsReencrypt 判断数据是否需要使用当前的主密钥重新加密
+// 包括明文数据和使用旧主密钥加密的数据
+func (this *Keyring) NeedsReencrypt(value string) bool {
+	var masterKey = this.ActiveKey()
+	if masterKey == nil || len(value) == 0 {
+		return false
+	}
+	if !IsEncrypted(value) {
+		return true
+	}
+	keyId, _, _, err := this.parse(value)
+	if err != nil {
+		return false
+	}
+	return keyId != masterKey.Id
+}
+
+// Reencrypt 使用当前的主密钥重新加密数据，不需要重新加密时返回原数据
+func (this *Keyring) Reencrypt(value string) (newValue string, changed bool, err error) {
+	if !this.NeedsReencrypt(value) {
+		return value, false, nil
+	}
+	var plaintext = []byte(value)
+	if IsEncrypted(value) {
+		plaintext, err = this.Decrypt(value)
+		if err != nil {
+			return value, false, err
+		}
+	}
+	newValue, err = this.Encrypt(plaintext)
+	if err != nil {
+		return value, false, err
+	}
+	return newValue, true, nil
+}
+
+func (this *Keyring) parse(secret string) (keyId string, wrappedKey []byte, data []byte, err error) {
+	if !IsEncrypted(secret) {
+		return "", nil, nil, ErrInvalidSecret
+	}
+	var pieces = strings.Split(secret[len(SecretPrefix):], ":")
+	if len(pieces) != 4 || pieces[0] != secretVersion {
+		return "", nil, nil, ErrInvalidSecret
+	}
+	keyId = pieces[1]
+	wrappedKey, err = base64.StdEncoding.DecodeString(pieces[2])
+	if err != nil {
+		return "", nil, nil, ErrInvalidSecret
+	}
+	data, err = base64.StdEncoding.DecodeString(pieces[3])
+	if err != nil {
+		return "", nil, nil, ErrInvalidSecret
+	}
+	return keyId, wrappedKey, data, nil
+}
+
+// 将版本和主密钥ID绑定到数据密钥上，防止被替换
+func (this *Keyring) additionalData(keyId string) []byte {
+	return []byte(secretVersion + ":" + keyId)
+}
+
+// 使用AES-256-GCM加密，返回随机数+密文
+func seal(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	var nonce = make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// 解密 seal() 加密的数据
+func open(key []byte, data []byte, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, ErrInvalidSecret
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,194 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package secrets
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeyring_Encrypt(t *testing.T) {
+	line, err := GenerateKeyLine("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := ParseKeyring(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := keyring.Encrypt([]byte("Hello, World"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(secret)
+	if !IsEncrypted(secret) {
+		t.Fatal("should be encrypted")
+	}
+
+	// 每次加密结果都不相同
+	secret2, err := keyring.Encrypt([]byte("Hello, World"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == secret2 {
+		t.Fatal("should use different data keys")
+	}
+
+	data, err := keyring.Decrypt(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "Hello, World" {
+		t.Fatal("decrypt failed:", string(data))
+	}
+
+	// 篡改数据
+	var pieces = strings.Split(secret, ":")
+	pieces[len(pieces)-1] = "A" + pieces[len(pieces)-1][1:]
+	_, err = keyring.Decrypt(strings.Join(pieces, ":"))
+	if err == nil {
+		t.Fatal("should fail with modified data")
+	}
+	t.Log(err)
+}
+
+func TestKeyring_Rotate(t *testing.T) {
+	oldLine, err := GenerateKeyLine("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLine, err := GenerateKeyLine("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldKeyring, err := ParseKeyring(oldLine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := oldKeyring.Encrypt([]byte("123456"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 新密钥放在第一行
+	keyring, err := ParseKeyring("# rotated\n" + newLine + "\n" + oldLine + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyring.ActiveKey().Id != "new" {
+		t.Fatal("active key should be 'new'")
+	}
+	if !keyring.NeedsReencrypt(secret) {
+		t.Fatal("should need re-encrypt")
+	}
+	if !keyring.NeedsReencrypt("plaintext") {
+		t.Fatal("plaintext should need re-encrypt")
+	}
+	if keyring.NeedsReencrypt("") {
+		t.Fatal("empty value should not need re-encrypt")
+	}
+
+	newSecret, changed, err := keyring.Reencrypt(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || keyring.NeedsReencrypt(newSecret) {
+		t.Fatal("re-encrypt failed")
+	}
+	data, err := keyring.Decrypt(newSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "123456" {
+		t.Fatal("decrypt failed:", string(data))
+	}
+
+	// 移除旧密钥后仍然可以解密
+	newKeyring, err := ParseKeyring(newLine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newKeyring.Decrypt(newSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newKeyring.Decrypt(secret)
+	if err == nil {
+		t.Fatal("should not decrypt with removed key")
+	}
+}
+
+func TestParseKeyring_Invalid(t *testing.T) {
+	for _, data := range []string{
+		"abc",
+		"1:abc",
+		"1:MTIz",
+		"a b:MTIz",
+	} {
+		_, err := ParseKeyring(data)
+		if err == nil {
+			t.Fatal("'" + data + "' should be invalid")
+		}
+	}
+}
+
+func TestEncryptString(t *testing.T) {
+	// 没有主密钥时不加密
+	SetSharedKeyring(&Keyring{})
+	value, err := EncryptString("123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "123456" {
+		t.Fatal("should not be encrypted")
+	}
+
+	line, err := GenerateKeyLine("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := ParseKeyring(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSharedKeyring(keyring)
+	defer SetSharedKeyring(nil)
+
+	value, err = EncryptString("123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(value) {
+		t.Fatal("should be encrypted")
+	}
+	value, err = DecryptString(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "123456" {
+		t.Fatal("decrypt failed:", value)
+	}
+}
+
+func TestMasterKey_DeriveKey(t *testing.T) {
+	line, err := GenerateKeyLine("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := ParseKeyring(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var key = keyring.ActiveKey()
+	if string(key.DeriveKey("log")) != string(key.DeriveKey("log")) {
+		t.Fatal("derived key should be stable")
+	}
+	if string(key.DeriveKey("log")) == string(key.DeriveKey("other")) {
+		t.Fatal("derived keys for different purposes should be different")
+	}
+	if string(key.DeriveKey("log")) == string(key.Key) {
+		t.Fatal("derived key should not be master key")
+	}
+}
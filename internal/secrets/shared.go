@@ -0,0 +1,118 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package secrets
+
+import (
+	"github.com/iwind/TeaGo/logs"
+	"sync"
+)
+
+var sharedKeyring *Keyring
+var sharedKeyringErr error
+var sharedLocker sync.Mutex
+
+// SharedKeyring 获取共享的主密钥集合，第一次调用时加载
+func SharedKeyring() (*Keyring, error) {
+	sharedLocker.Lock()
+	defer sharedLocker.Unlock()
+	if sharedKeyring == nil && sharedKeyringErr == nil {
+		sharedKeyring, sharedKeyringErr = LoadKeyring()
+		if sharedKeyringErr != nil {
+			logs.Println("[SECRETS]load master keys failed: " + sharedKeyringErr.Error())
+		} else if sharedKeyring.IsEmpty() {
+			logs.Println("[SECRETS]no master key found, secrets will be stored without encryption")
+		}
+	}
+	return sharedKeyring, sharedKeyringErr
+}
+
+// SetSharedKeyring 设置共享的主密钥集合，为nil时下次使用时重新加载
+func SetSharedKeyring(keyring *Keyring) {
+	sharedLocker.Lock()
+	sharedKeyring = keyring
+	sharedKeyringErr = nil
+	sharedLocker.Unlock()
+}
+
+// IsEnabled 是否已经设置主密钥
+func IsEnabled() bool {
+	keyring, err := SharedKeyring()
+	return err == nil && !keyring.IsEmpty()
+}
+
+// EncryptString 加密敏感数据
+// 没有设置主密钥、数据为空或者已经加密时返回原数据
+func EncryptString(value string) (string, error) {
+	if len(value) == 0 || IsEncrypted(value) {
+		return value, nil
+	}
+	keyring, err := SharedKeyring()
+	if err != nil {
+		return "", err
+	}
+	if keyring.IsEmpty() {
+		return value, nil
+	}
+	return keyring.Encrypt([]byte(value))
+}
+
+// DecryptString 解密敏感数据，未加密的数据直接返回
+func DecryptString(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	keyring, err := SharedKeyring()
+	if err != nil {
+		return "", err
+	}
+	if keyring.IsEmpty() {
+		return "", ErrMasterKeyNotFound
+	}
+	data, err := keyring.Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ReencryptString 使用当前主密钥重新加密数据
+func ReencryptString(value string) (newValue string, changed bool, err error) {
+	keyring, err := SharedKeyring()
+	if err != nil {
+		return value, false, err
+	}
+	return keyring.Reencrypt(value)
+}
+
+// EncryptStrings 加密多个敏感数据
+func EncryptStrings(values ...*string) error {
+	for _, value := range values {
+		encrypted, err := EncryptString(*value)
+		if err != nil {
+			return err
+		}
+		*value = encrypted
+	}
+	return nil
+}
+
+// DecryptStrings 解密多个敏感数据
+func DecryptStrings(values ...*string) error {
+	for _, value := range values {
+		decrypted, err := DecryptString(*value)
+		if err != nil {
+			return err
+		}
+		*value = decrypted
+	}
+	return nil
+}
+
+// NeedsReencrypt 判断数据是否需要使用当前的主密钥重新加密
+func NeedsReencrypt(value string) bool {
+	keyring, err := SharedKeyring()
+	if err != nil {
+		return false
+	}
+	return keyring.NeedsReencrypt(value)
+}
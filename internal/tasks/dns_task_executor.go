@@ -12,6 +12,7 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/lists"
+	"github.com/iwind/TeaGo/maps"
 	"net"
 	"strings"
 	"time"
@@ -19,6 +20,7 @@ import (
 
 func init() {
 	dbs.OnReadyDone(func() {
+		SharedLeaderElector.Register(LeaderTaskDNSTaskExecutor)
 		go NewDNSTaskExecutor().Start()
 	})
 }
@@ -34,6 +36,10 @@ func NewDNSTaskExecutor() *DNSTaskExecutor {
 func (this *DNSTaskExecutor) Start() {
 	ticker := time.NewTicker(10 * time.Second)
 	for range ticker.C {
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskDNSTaskExecutor) {
+			continue
+		}
 		err := this.LoopWithLocker(10)
 		if err != nil {
 			remotelogs.Error("DNSTaskExecutor", err.Error())
@@ -42,52 +48,67 @@ func (this *DNSTaskExecutor) Start() {
 }
 
 func (this *DNSTaskExecutor) LoopWithLocker(seconds int64) error {
-	ok, err := models.SharedSysLockerDAO.Lock(nil, "dns_task_executor", seconds-1) // 假设执行时间为1秒
+	lease, err := models.SharedSysLockerDAO.AcquireLease(nil, "dns_task_executor", seconds-1) // 假设执行时间为1秒
 	if err != nil {
 		return err
 	}
-	if !ok {
+	if lease == nil {
 		return nil
 	}
-	return this.Loop()
+
+	// 执行期间自动续期，结束后释放，以便接管的Leader可以立即执行
+	defer func() {
+		_ = lease.Release()
+	}()
+
+	return this.loop(lease)
 }
 
 func (this *DNSTaskExecutor) Loop() error {
+	return this.loop(nil)
+}
+
+func (this *DNSTaskExecutor) loop(lease *models.SysLease) error {
 	tasks, err := dnsmodels.SharedDNSTaskDAO.FindAllDoingTasks(nil)
 	if err != nil {
 		return err
 	}
 	for _, task := range tasks {
+		// 锁已经被其他API节点接管
+		if lease != nil && lease.IsLost() {
+			return models.ErrLeaseLost
+		}
+
 		taskId := int64(task.Id)
 		switch task.Type {
 		case dnsmodels.DNSTaskTypeServerChange:
-			err = this.doServer(taskId, int64(task.ServerId))
+			err = this.doServer(lease, taskId, int64(task.ServerId))
 			if err != nil {
-				err = dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskError(nil, taskId, err.Error())
+				err = this.failTask(lease, task, err)
 				if err != nil {
 					return err
 				}
 			}
 		case dnsmodels.DNSTaskTypeNodeChange:
-			err = this.doNode(taskId, int64(task.NodeId))
+			err = this.doNode(lease, taskId, int64(task.NodeId))
 			if err != nil {
-				err = dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskError(nil, taskId, err.Error())
+				err = this.failTask(lease, task, err)
 				if err != nil {
 					return err
 				}
 			}
 		case dnsmodels.DNSTaskTypeClusterChange:
-			err = this.doCluster(taskId, int64(task.ClusterId))
+			err = this.doCluster(lease, taskId, int64(task.ClusterId))
 			if err != nil {
-				err = dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskError(nil, taskId, err.Error())
+				err = this.failTask(lease, task, err)
 				if err != nil {
 					return err
 				}
 			}
 		case dnsmodels.DNSTaskTypeDomainChange:
-			err = this.doDomain(taskId, int64(task.DomainId))
+			err = this.doDomain(lease, taskId, int64(task.DomainId))
 			if err != nil {
-				err = dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskError(nil, taskId, err.Error())
+				err = this.failTask(lease, task, err)
 				if err != nil {
 					return err
 				}
@@ -98,14 +119,47 @@ func (this *DNSTaskExecutor) Loop() error {
 	return nil
 }
 
+// 记录任务错误，并通知Webhook订阅
+func (this *DNSTaskExecutor) failTask(lease *models.SysLease, task *dnsmodels.DNSTask, taskErr error) error {
+	err := this.runTx(lease, func(tx *dbs.Tx) error {
+		return dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskError(tx, int64(task.Id), taskErr.Error())
+	})
+	if err != nil {
+		return err
+	}
+	err = models.SharedWebhookDAO.NotifyEvent(nil, models.WebhookEventTypeDNSTaskFailed, maps.Map{
+		"taskId":    task.Id,
+		"type":      task.Type,
+		"clusterId": task.ClusterId,
+		"serverId":  task.ServerId,
+		"nodeId":    task.NodeId,
+		"domainId":  task.DomainId,
+		"error":     taskErr.Error(),
+	})
+	if err != nil {
+		remotelogs.Error("DNSTaskExecutor", "notify webhooks failed: "+err.Error())
+	}
+	return nil
+}
+
+// 在租约的事务中修改任务状态，被其他API节点接管后不再修改；没有租约时直接修改
+func (this *DNSTaskExecutor) runTx(lease *models.SysLease, f func(tx *dbs.Tx) error) error {
+	if lease == nil {
+		return f(nil)
+	}
+	return lease.RunTx(f)
+}
+
 // 修改服务相关记录
-func (this *DNSTaskExecutor) doServer(taskId int64, serverId int64) error {
+func (this *DNSTaskExecutor) doServer(lease *models.SysLease, taskId int64, serverId int64) error {
 	var tx *dbs.Tx
 
 	isOk := false
 	defer func() {
 		if isOk {
-			err := dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskDone(tx, taskId)
+			err := this.runTx(lease, func(tx *dbs.Tx) error {
+				return dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskDone(tx, taskId)
+			})
 			if err != nil {
 				remotelogs.Error("DNSTaskExecutor", err.Error())
 			}
@@ -219,11 +273,13 @@ func (this *DNSTaskExecutor) doServer(taskId int64, serverId int64) error {
 }
 
 // 修改节点相关记录
-func (this *DNSTaskExecutor) doNode(taskId int64, nodeId int64) error {
+func (this *DNSTaskExecutor) doNode(lease *models.SysLease, taskId int64, nodeId int64) error {
 	isOk := false
 	defer func() {
 		if isOk {
-			err := dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskDone(nil, taskId)
+			err := this.runTx(lease, func(tx *dbs.Tx) error {
+				return dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskDone(tx, taskId)
+			})
 			if err != nil {
 				remotelogs.Error("DNSTaskExecutor", err.Error())
 			}
@@ -258,11 +314,13 @@ func (this *DNSTaskExecutor) doNode(taskId int64, nodeId int64) error {
 }
 
 // 修改集群相关记录
-func (this *DNSTaskExecutor) doCluster(taskId int64, clusterId int64) error {
+func (this *DNSTaskExecutor) doCluster(lease *models.SysLease, taskId int64, clusterId int64) error {
 	isOk := false
 	defer func() {
 		if isOk {
-			err := dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskDone(nil, taskId)
+			err := this.runTx(lease, func(tx *dbs.Tx) error {
+				return dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskDone(tx, taskId)
+			})
 			if err != nil {
 				remotelogs.Error("DNSTaskExecutor", err.Error())
 			}
@@ -463,13 +521,15 @@ func (this *DNSTaskExecutor) doCluster(taskId int64, clusterId int64) error {
 	return nil
 }
 
-func (this *DNSTaskExecutor) doDomain(taskId int64, domainId int64) error {
+func (this *DNSTaskExecutor) doDomain(lease *models.SysLease, taskId int64, domainId int64) error {
 	var tx *dbs.Tx
 
 	isOk := false
 	defer func() {
 		if isOk {
-			err := dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskDone(tx, taskId)
+			err := this.runTx(lease, func(tx *dbs.Tx) error {
+				return dnsmodels.SharedDNSTaskDAO.UpdateDNSTaskDone(tx, taskId)
+			})
 			if err != nil {
 				remotelogs.Error("DNSTaskExecutor", err.Error())
 			}
@@ -9,6 +9,7 @@ import (
 
 func init() {
 	dbs.OnReady(func() {
+		SharedLeaderElector.Register(LeaderTaskEventLooper)
 		looper := NewEventLooper()
 		go looper.Start()
 	})
@@ -25,6 +26,10 @@ func NewEventLooper() *EventLooper {
 func (this *EventLooper) Start() {
 	ticker := time.NewTicker(2 * time.Second)
 	for range ticker.C {
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskEventLooper) {
+			continue
+		}
 		err := this.loop()
 		if err != nil {
 			logs.Println("[EVENT_LOOPER]" + err.Error())
@@ -34,25 +39,28 @@ func (this *EventLooper) Start() {
 
 func (this *EventLooper) loop() error {
 	lockerKey := "eventLooper"
-	isOk, err := models.SharedSysLockerDAO.Lock(nil, lockerKey, 3600)
+	lease, err := models.SharedSysLockerDAO.AcquireLease(nil, lockerKey, 60)
 	if err != nil {
 		return err
 	}
+	if lease == nil {
+		return nil
+	}
 	defer func() {
-		err = models.SharedSysLockerDAO.Unlock(nil, lockerKey)
+		err := lease.Release()
 		if err != nil {
 			logs.Println("[EVENT_LOOPER]" + err.Error())
 		}
 	}()
-	if !isOk {
-		return nil
-	}
 
 	events, err := models.SharedSysEventDAO.FindEvents(nil, 100)
 	if err != nil {
 		return err
 	}
 	for _, eventOne := range events {
+		if lease.IsLost() {
+			return models.ErrLeaseLost
+		}
 		event, err := eventOne.DecodeEvent()
 		if err != nil {
 			logs.Println("[EVENT_LOOPER]" + err.Error())
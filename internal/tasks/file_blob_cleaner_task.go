@@ -0,0 +1,67 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tasks
+
+import (
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	"time"
+)
+
+func init() {
+	dbs.OnReadyDone(func() {
+		SharedLeaderElector.Register(LeaderTaskFileBlobCleaner)
+		go NewFileBlobCleanerTask().Start()
+	})
+}
+
+// FileBlobCleanerTask 清理没有被任何文件引用的文件数据，以及过期的未完成上传
+type FileBlobCleanerTask struct {
+}
+
+func NewFileBlobCleanerTask() *FileBlobCleanerTask {
+	return &FileBlobCleanerTask{}
+}
+
+func (this *FileBlobCleanerTask) Start() {
+	ticker := time.NewTicker(1 * time.Hour)
+	for range ticker.C {
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskFileBlobCleaner) {
+			continue
+		}
+		err := this.Loop()
+		if err != nil {
+			remotelogs.Error("FILE_BLOB_CLEANER", err.Error())
+		}
+	}
+}
+
+func (this *FileBlobCleanerTask) Loop() error {
+	// 7天没有继续上传的断点续传文件
+	fileIds, err := models.SharedFileDAO.FindAllExpiredUploadingFileIds(nil, 7, 1000)
+	if err != nil {
+		return err
+	}
+	for _, fileId := range fileIds {
+		err = models.SharedFileDAO.DeleteUploadingFile(nil, fileId)
+		if err != nil {
+			return err
+		}
+	}
+
+	blobIds, err := models.SharedFileBlobDAO.FindAllUnusedBlobIds(nil, 1000)
+	if err != nil {
+		return err
+	}
+	for _, blobId := range blobIds {
+		err = models.SharedFileBlobDAO.DeleteUnusedBlob(nil, blobId)
+		if err != nil {
+			// 删除失败时下次再试
+			remotelogs.Error("FILE_BLOB_CLEANER", "delete blob '"+types.String(blobId)+"' failed: "+err.Error())
+		}
+	}
+	return nil
+}
@@ -15,6 +15,7 @@ import (
 
 func init() {
 	dbs.OnReady(func() {
+		SharedLeaderElector.Register(LeaderTaskHealthCheck)
 		go NewHealthCheckTask().Run()
 	})
 }
@@ -36,7 +37,8 @@ func (this *HealthCheckTask) Run() {
 		logs.Println("[TASK][HEALTH_CHECK]" + err.Error())
 	}
 
-	ticker := utils.NewTicker(60 * time.Second)
+	// 检查间隔较短，以便Leader切换后尽快接管
+	ticker := utils.NewTicker(10 * time.Second)
 	for ticker.Wait() {
 		err := this.loop()
 		if err != nil {
@@ -46,6 +48,15 @@ func (this *HealthCheckTask) Run() {
 }
 
 func (this *HealthCheckTask) loop() error {
+	// 不是Leader时停止所有集群的检查
+	if !SharedLeaderElector.IsLeader(LeaderTaskHealthCheck) {
+		for clusterId, task := range this.tasksMap {
+			task.Stop()
+			delete(this.tasksMap, clusterId)
+		}
+		return nil
+	}
+
 	clusters, err := models.NewNodeClusterDAO().FindAllEnableClusters(nil)
 	if err != nil {
 		return err
@@ -0,0 +1,328 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tasks
+
+import (
+	"encoding/json"
+	"github.com/TeaOSLab/EdgeAPI/internal/accesslogs/logquery"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/maps"
+	"github.com/iwind/TeaGo/types"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	dbs.OnReadyDone(func() {
+		go NewHTTPAccessLogExportTask().Start()
+	})
+}
+
+var errHTTPAccessLogExportCanceled = errors.New("export has been canceled")
+var errHTTPAccessLogExportLost = errors.New("export has been claimed by another runner")
+
+// HTTPAccessLogExportTask 访问日志导出任务
+type HTTPAccessLogExportTask struct {
+	chunkSize         int
+	batchSize         int64
+	progressInterval  time.Duration
+	heartbeatInterval time.Duration
+}
+
+func NewHTTPAccessLogExportTask() *HTTPAccessLogExportTask {
+	return &HTTPAccessLogExportTask{
+		chunkSize:         1024 * 1024,
+		batchSize:         1000,
+		progressInterval:  2 * time.Second,
+		heartbeatInterval: 30 * time.Second,
+	}
+}
+
+func (this *HTTPAccessLogExportTask) Start() {
+	ticker := time.NewTicker(10 * time.Second)
+	for range ticker.C {
+		err := this.Loop()
+		if err != nil {
+			remotelogs.Error("HTTP_ACCESS_LOG_EXPORT_TASK", err.Error())
+		}
+	}
+}
+
+// Loop 领取并执行一个任务
+func (this *HTTPAccessLogExportTask) Loop() error {
+	export, err := this.claim()
+	if err != nil {
+		return err
+	}
+	if export == nil {
+		return nil
+	}
+
+	var exportId = int64(export.Id)
+	countLogs, size, runErr := this.run(export)
+	if runErr == errHTTPAccessLogExportLost {
+		// 任务已被其他执行者领取，不再修改任务状态
+		return nil
+	}
+	if runErr != nil {
+		err = models.SharedHTTPAccessLogExportDAO.UpdateExportFailed(nil, exportId, export.RunToken, runErr.Error())
+		if err != nil {
+			if err == models.ErrHTTPAccessLogExportLost {
+				return nil
+			}
+			return err
+		}
+		if runErr == errHTTPAccessLogExportCanceled {
+			return nil
+		}
+		return this.notify(export, false, 0, 0, runErr.Error())
+	}
+
+	err = models.SharedHTTPAccessLogExportDAO.UpdateExportDone(nil, exportId, export.RunToken, countLogs, size)
+	if err != nil {
+		if err == models.ErrHTTPAccessLogExportLost {
+			return nil
+		}
+		return err
+	}
+	return this.notify(export, true, countLogs, size, "")
+}
+
+// 领取任务
+func (this *HTTPAccessLogExportTask) claim() (*models.HTTPAccessLogExport, error) {
+	// 防止多个API节点领取同一个任务
+	lockerKey := "httpAccessLogExportTask"
+	ok, err := models.SharedSysLockerDAO.Lock(nil, lockerKey, 60)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	defer func() {
+		_ = models.SharedSysLockerDAO.Unlock(nil, lockerKey)
+	}()
+
+	return models.SharedHTTPAccessLogExportDAO.ClaimPendingExport(nil)
+}
+
+// 执行导出
+func (this *HTTPAccessLogExportTask) run(export *models.HTTPAccessLogExport) (countLogs int64, size int64, err error) {
+	var exportId = int64(export.Id)
+
+	expr, err := logquery.Parse(export.Query)
+	if err != nil {
+		return 0, 0, errors.New("invalid query: " + err.Error())
+	}
+
+	var serverIds = []int64{}
+	if export.ServerId > 0 {
+		serverIds = []int64{int64(export.ServerId)}
+	} else if export.UserId > 0 {
+		serverIds, err = models.SharedServerDAO.FindAllEnabledServerIdsWithUserId(nil, int64(export.UserId))
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(serverIds) == 0 {
+			return 0, 0, errors.New("the user does not have any servers")
+		}
+	}
+
+	var filename = "access-logs-" + types.String(export.ServerId) + "-" + time.Unix(int64(export.TimeFrom), 0).Format("20060102150405") + "-" + time.Unix(int64(export.TimeTo), 0).Format("20060102150405") + "." + export.Format + ".gz"
+	fileId, err := models.SharedFileDAO.CreateFile(nil, int64(export.AdminId), int64(export.UserId), models.HTTPAccessLogExportFileType, "", filename, 0, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	isValid, err := models.SharedHTTPAccessLogExportDAO.UpdateExportFile(nil, exportId, export.RunToken, fileId)
+	if err != nil || !isValid {
+		this.discardFile(fileId)
+		if err != nil {
+			return 0, 0, err
+		}
+		return 0, 0, errHTTPAccessLogExportLost
+	}
+
+	// 单独的心跳，避免在查询较慢时任务被其他API节点重新领取
+	var heartbeat = this.startHeartbeat(exportId, export.RunToken)
+	defer heartbeat.Stop()
+
+	var chunkWriter = NewHTTPAccessLogExportChunkWriter(nil, fileId, this.chunkSize)
+	exportWriter, err := NewHTTPAccessLogExportWriter(chunkWriter, export.Format)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var timeFrom = int64(export.TimeFrom)
+	var timeTo = int64(export.TimeTo)
+	var lastProgressTime = time.Now()
+	_, _, err = models.SharedHTTPAccessLogDAO.QueryAccessLogs(nil, expr, timeFrom, timeTo, serverIds, "", math.MaxInt64, this.batchSize, func(accessLogs []*models.HTTPAccessLog) error {
+		for _, accessLog := range accessLogs {
+			pbAccessLog, err := accessLog.ToPB()
+			if err != nil {
+				return err
+			}
+			err = exportWriter.Write(pbAccessLog)
+			if err != nil {
+				return err
+			}
+		}
+		countLogs += int64(len(accessLogs))
+
+		if heartbeat.IsInvalid() {
+			return this.invalidError(exportId, export.RunToken)
+		}
+		if time.Since(lastProgressTime) < this.progressInterval {
+			return nil
+		}
+		lastProgressTime = time.Now()
+
+		// 日志按时间倒序读取，所以可以根据最后一条日志的时间估算进度
+		var progress = 0
+		if timeTo > timeFrom {
+			progress = int((timeTo - int64(accessLogs[len(accessLogs)-1].CreatedAt)) * 100 / (timeTo - timeFrom))
+		}
+		isValid, err := models.SharedHTTPAccessLogExportDAO.UpdateExportProgress(nil, exportId, export.RunToken, progress, countLogs, chunkWriter.Size())
+		if err != nil {
+			return err
+		}
+		if !isValid {
+			return this.invalidError(exportId, export.RunToken)
+		}
+		return nil
+	})
+	if err == nil && heartbeat.IsInvalid() {
+		err = this.invalidError(exportId, export.RunToken)
+	}
+	if err != nil {
+		if err == errHTTPAccessLogExportLost {
+			this.discardFile(fileId)
+		}
+		return 0, 0, err
+	}
+
+	err = exportWriter.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+	err = chunkWriter.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = models.SharedFileDAO.UpdateFileSize(nil, fileId, chunkWriter.Size())
+	if err != nil {
+		return 0, 0, err
+	}
+	err = models.SharedFileDAO.UpdateFileIsFinished(nil, fileId)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return countLogs, chunkWriter.Size(), nil
+}
+
+// 启动心跳
+func (this *HTTPAccessLogExportTask) startHeartbeat(exportId int64, runToken string) *httpAccessLogExportHeartbeat {
+	var heartbeat = &httpAccessLogExportHeartbeat{
+		stopChan: make(chan struct{}),
+	}
+	go func() {
+		var ticker = time.NewTicker(this.heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeat.stopChan:
+				return
+			case <-ticker.C:
+				isValid, err := models.SharedHTTPAccessLogExportDAO.UpdateExportHeartbeat(nil, exportId, runToken)
+				if err != nil {
+					// 数据库暂时不可用时继续尝试，超时后由其他执行者重新领取
+					remotelogs.Error("HTTP_ACCESS_LOG_EXPORT_TASK", "update heartbeat for export '"+types.String(exportId)+"' failed: "+err.Error())
+					continue
+				}
+				if !isValid {
+					atomic.StoreInt32(&heartbeat.isInvalid, 1)
+					return
+				}
+			}
+		}
+	}()
+	return heartbeat
+}
+
+// 任务失效的原因：任务被删除时为取消，否则为被其他执行者领取
+func (this *HTTPAccessLogExportTask) invalidError(exportId int64, runToken string) error {
+	export, err := models.SharedHTTPAccessLogExportDAO.Find(nil, exportId)
+	if err != nil {
+		return err
+	}
+	if export == nil {
+		return errHTTPAccessLogExportLost
+	}
+	var exportObj = export.(*models.HTTPAccessLogExport)
+	if exportObj.RunToken == runToken && exportObj.State != models.HTTPAccessLogExportStateEnabled {
+		return errHTTPAccessLogExportCanceled
+	}
+	return errHTTPAccessLogExportLost
+}
+
+// 丢弃当前执行者创建的文件
+func (this *HTTPAccessLogExportTask) discardFile(fileId int64) {
+	err := models.SharedFileChunkDAO.DeleteFileChunks(nil, fileId)
+	if err == nil {
+		err = models.SharedFileDAO.DisableFile(nil, fileId)
+	}
+	if err != nil {
+		remotelogs.Error("HTTP_ACCESS_LOG_EXPORT_TASK", "discard file '"+types.String(fileId)+"' failed: "+err.Error())
+	}
+}
+
+// 通知创建任务的管理员或用户
+func (this *HTTPAccessLogExportTask) notify(export *models.HTTPAccessLogExport, isOk bool, countLogs int64, size int64, errString string) error {
+	var params = maps.Map{
+		"exportId":  export.Id,
+		"serverId":  export.ServerId,
+		"isOk":      isOk,
+		"countLogs": countLogs,
+		"size":      size,
+		"error":     errString,
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	var timeRange = time.Unix(int64(export.TimeFrom), 0).Format("2006-01-02 15:04:05") + " - " + time.Unix(int64(export.TimeTo), 0).Format("2006-01-02 15:04:05")
+	if isOk {
+		err = models.SharedMessageDAO.CreateMessage(nil, int64(export.AdminId), int64(export.UserId), models.MessageTypeAccessLogExportSuccess, models.MessageLevelSuccess, "访问日志导出完成", "访问日志（"+timeRange+"）导出完成，共"+types.String(countLogs)+"条，可以在导出列表中下载。", paramsJSON)
+	} else {
+		err = models.SharedMessageDAO.CreateMessage(nil, int64(export.AdminId), int64(export.UserId), models.MessageTypeAccessLogExportFailed, models.MessageLevelError, "访问日志导出失败", "访问日志（"+timeRange+"）导出失败："+errString, paramsJSON)
+	}
+	if err != nil {
+		return err
+	}
+
+	params["adminId"] = export.AdminId
+	params["userId"] = export.UserId
+	return models.SharedWebhookDAO.NotifyEvent(nil, models.WebhookEventTypeAccessLogExportFinished, params)
+}
+
+// 导出任务心跳
+type httpAccessLogExportHeartbeat struct {
+	stopChan  chan struct{}
+	isInvalid int32
+}
+
+// IsInvalid 任务是否已被删除或者已被其他执行者领取
+func (this *httpAccessLogExportHeartbeat) IsInvalid() bool {
+	return atomic.LoadInt32(&this.isInvalid) == 1
+}
+
+// Stop 停止心跳
+func (this *httpAccessLogExportHeartbeat) Stop() {
+	close(this.stopChan)
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tasks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/errors"
+	"github.com/iwind/TeaGo/dbs"
+	"io"
+)
+
+// CSV导出的列，对应访问日志中的键名
+var httpAccessLogExportCSVColumns = []string{
+	"requestId",
+	"timestamp",
+	"serverId",
+	"nodeId",
+	"remoteAddr",
+	"host",
+	"requestMethod",
+	"requestURI",
+	"proto",
+	"status",
+	"bytesSent",
+	"requestTime",
+	"referer",
+	"userAgent",
+	"firewallPolicyId",
+	"firewallRuleGroupId",
+	"firewallRuleSetId",
+	"firewallRuleId",
+}
+
+// HTTPAccessLogExportWriter 将访问日志以指定格式写入gzip压缩流
+type HTTPAccessLogExportWriter struct {
+	format    models.HTTPAccessLogExportFormat
+	gzWriter  *gzip.Writer
+	csvWriter *csv.Writer
+}
+
+// NewHTTPAccessLogExportWriter 获取新对象
+func NewHTTPAccessLogExportWriter(writer io.Writer, format models.HTTPAccessLogExportFormat) (*HTTPAccessLogExportWriter, error) {
+	var gzWriter = gzip.NewWriter(writer)
+	var exportWriter = &HTTPAccessLogExportWriter{
+		format:   format,
+		gzWriter: gzWriter,
+	}
+
+	switch format {
+	case models.HTTPAccessLogExportFormatNDJSON:
+	case models.HTTPAccessLogExportFormatCSV:
+		exportWriter.csvWriter = csv.NewWriter(gzWriter)
+		err := exportWriter.csvWriter.Write(httpAccessLogExportCSVColumns)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("invalid format '" + format + "'")
+	}
+	return exportWriter, nil
+}
+
+// Write 写入单条访问日志
+func (this *HTTPAccessLogExportWriter) Write(accessLog *pb.HTTPAccessLog) error {
+	data, err := json.Marshal(accessLog)
+	if err != nil {
+		return err
+	}
+
+	if this.csvWriter == nil {
+		_, err = this.gzWriter.Write(append(data, '\n'))
+		return err
+	}
+
+	// 使用json.Number以免数字被转换为科学计数法
+	var m = map[string]interface{}{}
+	var decoder = json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&m)
+	if err != nil {
+		return err
+	}
+	var record = []string{}
+	for _, column := range httpAccessLogExportCSVColumns {
+		value, ok := m[column]
+		if !ok || value == nil {
+			record = append(record, "")
+			continue
+		}
+		record = append(record, fmt.Sprint(value))
+	}
+	return this.csvWriter.Write(record)
+}
+
+// Close 结束写入
+// 不会关闭下层的writer
+func (this *HTTPAccessLogExportWriter) Close() error {
+	if this.csvWriter != nil {
+		this.csvWriter.Flush()
+		err := this.csvWriter.Error()
+		if err != nil {
+			return err
+		}
+	}
+	return this.gzWriter.Close()
+}
+
+// HTTPAccessLogExportChunkWriter 将数据按固定大小分块写入文件存储
+type HTTPAccessLogExportChunkWriter struct {
+	tx        *dbs.Tx
+	fileId    int64
+	chunkSize int
+	buf       *bytes.Buffer
+	size      int64
+}
+
+// NewHTTPAccessLogExportChunkWriter 获取新对象
+func NewHTTPAccessLogExportChunkWriter(tx *dbs.Tx, fileId int64, chunkSize int) *HTTPAccessLogExportChunkWriter {
+	return &HTTPAccessLogExportChunkWriter{
+		tx:        tx,
+		fileId:    fileId,
+		chunkSize: chunkSize,
+		buf:       &bytes.Buffer{},
+	}
+}
+
+// Write 写入数据，缓冲区满时保存为一个分块
+func (this *HTTPAccessLogExportChunkWriter) Write(p []byte) (n int, err error) {
+	n, _ = this.buf.Write(p)
+	this.size += int64(n)
+	for this.buf.Len() >= this.chunkSize {
+		err = this.saveChunk(this.buf.Next(this.chunkSize))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Size 已写入的数据尺寸
+func (this *HTTPAccessLogExportChunkWriter) Size() int64 {
+	return this.size
+}
+
+// Close 保存剩余的数据
+func (this *HTTPAccessLogExportChunkWriter) Close() error {
+	if this.buf.Len() == 0 {
+		return nil
+	}
+	return this.saveChunk(this.buf.Next(this.buf.Len()))
+}
+
+func (this *HTTPAccessLogExportChunkWriter) saveChunk(data []byte) error {
+	_, err := models.SharedFileChunkDAO.CreateFileChunk(this.tx, this.fileId, data)
+	return err
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tasks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/1uLang/EdgeCommon/pkg/rpc/pb"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/iwind/TeaGo/dbs"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestHTTPAccessLogExportWriter_CSV(t *testing.T) {
+	var buf = &bytes.Buffer{}
+	writer, err := NewHTTPAccessLogExportWriter(buf, models.HTTPAccessLogExportFormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Write(&pb.HTTPAccessLog{RequestId: "1634000000000001", Timestamp: 1634000000, ServerId: 1, RemoteAddr: "127.0.0.1", Host: "example.com", RequestURI: "/a,b", Status: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := readGzipLines(t, buf)
+	if len(lines) != 2 {
+		t.Fatal("expected 2 lines, got", len(lines))
+	}
+	if !strings.HasPrefix(lines[1], "1634000000000001,1634000000,1,") || !strings.Contains(lines[1], `"/a,b"`) {
+		t.Fatal("unexpected line:", lines[1])
+	}
+	t.Log(lines)
+}
+
+func TestHTTPAccessLogExportWriter_NDJSON(t *testing.T) {
+	var buf = &bytes.Buffer{}
+	writer, err := NewHTTPAccessLogExportWriter(buf, models.HTTPAccessLogExportFormatNDJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err = writer.Write(&pb.HTTPAccessLog{RequestId: "1634000000000001", Status: 200})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := readGzipLines(t, buf)
+	if len(lines) != 3 {
+		t.Fatal("expected 3 lines, got", len(lines))
+	}
+	t.Log(lines)
+}
+
+func TestHTTPAccessLogExportTask_Loop(t *testing.T) {
+	dbs.NotifyReady()
+
+	err := NewHTTPAccessLogExportTask().Loop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ok")
+}
+
+func readGzipLines(t *testing.T, buf *bytes.Buffer) []string {
+	reader, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
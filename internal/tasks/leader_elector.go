@@ -0,0 +1,219 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tasks
+
+import (
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/events"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 单例任务名称
+const (
+	LeaderTaskDNSTaskExecutor        = "dnsTaskExecutor"
+	LeaderTaskNodeTaskExtractor      = "nodeTaskExtractor"
+	LeaderTaskEventLooper            = "eventLooper"
+	LeaderTaskHealthCheck            = "healthCheck"
+	LeaderTaskMessage                = "message"
+	LeaderTaskMonitorItemValue       = "monitorItemValue"
+	LeaderTaskNodeLogCleaner         = "nodeLogCleaner"
+	LeaderTaskNodeMonitor            = "nodeMonitor"
+	LeaderTaskNSNodeMonitor          = "nsNodeMonitor"
+	LeaderTaskSSLCertExpireCheck     = "sslCertExpireCheck"
+	LeaderTaskServerAccessLogCleaner = "serverAccessLogCleaner"
+	LeaderTaskLog                    = "log"
+	LeaderTaskWebhookDelivery        = "webhookDelivery"
+	LeaderTaskFileBlobCleaner        = "fileBlobCleaner"
+	LeaderTaskNodeInstallJob         = "nodeInstallJob"
+)
+
+const (
+	leaderLeaseSeconds  = 15              // Leader租约有效时间，Leader退出后最多经过这么长时间会被其他节点接管
+	leaderRetryInterval = 3 * time.Second // 非Leader节点尝试竞选的间隔
+)
+
+var SharedLeaderElector = NewLeaderElector()
+
+func init() {
+	// 退出时主动释放，以便其他节点尽快接管
+	events.On(events.EventQuit, func() {
+		SharedLeaderElector.Stop()
+	})
+}
+
+// LeaderElector 单例任务的Leader选举
+// 每个单例任务单独选举，所有API节点都会参与竞选，只有当选的节点执行任务
+type LeaderElector struct {
+	campaigns map[string]*leaderCampaign // task => campaign
+	isStopped bool
+	locker    sync.Mutex
+}
+
+// NewLeaderElector 获取新对象
+func NewLeaderElector() *LeaderElector {
+	return &LeaderElector{
+		campaigns: map[string]*leaderCampaign{},
+	}
+}
+
+// Register 注册单例任务并开始竞选，重复注册时不做任何操作
+func (this *LeaderElector) Register(task string) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	if this.isStopped {
+		return
+	}
+	_, ok := this.campaigns[task]
+	if ok {
+		return
+	}
+	var campaign = &leaderCampaign{
+		task:     task,
+		stopChan: make(chan bool),
+		doneChan: make(chan bool),
+	}
+	this.campaigns[task] = campaign
+	go campaign.run()
+}
+
+// IsLeader 判断当前节点是否为某个任务的Leader
+func (this *LeaderElector) IsLeader(task string) bool {
+	var lease = this.Lease(task)
+	return lease != nil && !lease.IsLost()
+}
+
+// Lease 获取当前节点持有的任务租约，非Leader时返回nil
+// 执行有副作用的操作之前可以调用租约的 Check() 确认仍然是Leader
+func (this *LeaderElector) Lease(task string) *models.SysLease {
+	this.locker.Lock()
+	campaign, ok := this.campaigns[task]
+	this.locker.Unlock()
+	if !ok {
+		return nil
+	}
+	return campaign.currentLease()
+}
+
+// Elected 获取当前节点成为某个任务的Leader时收到通知的通道
+// 执行间隔较长的任务可以在当选时立即执行一次，而不用等到下一次定时执行；任务未注册时返回的通道不会收到通知
+func (this *LeaderElector) Elected(task string) <-chan bool {
+	var electedChan = make(chan bool, 1)
+
+	this.locker.Lock()
+	campaign, ok := this.campaigns[task]
+	this.locker.Unlock()
+	if !ok {
+		return electedChan
+	}
+
+	// 订阅之前已经当选时立即通知
+	campaign.locker.Lock()
+	campaign.electedChans = append(campaign.electedChans, electedChan)
+	if campaign.lease != nil && !campaign.lease.IsLost() {
+		electedChan <- true
+	}
+	campaign.locker.Unlock()
+	return electedChan
+}
+
+// FindAllTasks 所有注册的任务名称
+func (this *LeaderElector) FindAllTasks() []string {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	var result = []string{}
+	for task := range this.campaigns {
+		result = append(result, task)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Stop 停止竞选并释放所有任务的租约
+func (this *LeaderElector) Stop() {
+	this.locker.Lock()
+	if this.isStopped {
+		this.locker.Unlock()
+		return
+	}
+	this.isStopped = true
+	var campaigns = []*leaderCampaign{}
+	for _, campaign := range this.campaigns {
+		campaigns = append(campaigns, campaign)
+	}
+	this.locker.Unlock()
+
+	for _, campaign := range campaigns {
+		campaign.stop()
+	}
+}
+
+// 单个任务的竞选
+type leaderCampaign struct {
+	task         string
+	lease        *models.SysLease
+	electedChans []chan bool
+
+	locker   sync.Mutex
+	stopChan chan bool
+	doneChan chan bool
+}
+
+func (this *leaderCampaign) run() {
+	defer close(this.doneChan)
+
+	for {
+		lease, err := models.SharedSysLockerDAO.AcquireLease(nil, models.SysLockerLeaderPrefix+this.task, leaderLeaseSeconds)
+		if err != nil {
+			remotelogs.Error("LEADER_ELECTOR", "campaign for '"+this.task+"' failed: "+err.Error())
+		} else if lease != nil {
+			remotelogs.Println("LEADER_ELECTOR", "became leader of '"+this.task+"'")
+			this.locker.Lock()
+			this.lease = lease
+			for _, electedChan := range this.electedChans {
+				select {
+				case electedChan <- true:
+				default:
+				}
+			}
+			this.locker.Unlock()
+
+			select {
+			case <-lease.Lost():
+				remotelogs.Warn("LEADER_ELECTOR", "lost leadership of '"+this.task+"'")
+			case <-this.stopChan:
+			}
+
+			this.locker.Lock()
+			this.lease = nil
+			this.locker.Unlock()
+
+			select {
+			case <-this.stopChan:
+				_ = lease.Release()
+				return
+			default:
+				lease.Stop()
+			}
+		}
+
+		select {
+		case <-this.stopChan:
+			return
+		case <-time.After(leaderRetryInterval):
+		}
+	}
+}
+
+func (this *leaderCampaign) currentLease() *models.SysLease {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	return this.lease
+}
+
+func (this *leaderCampaign) stop() {
+	close(this.stopChan)
+	<-this.doneChan
+}
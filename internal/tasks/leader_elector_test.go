@@ -0,0 +1,60 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tasks
+
+import (
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	"testing"
+	"time"
+)
+
+func TestLeaderElector_Register(t *testing.T) {
+	dbs.NotifyReady()
+
+	var task = "test-" + types.String(time.Now().UnixNano())
+	var elector = NewLeaderElector()
+	elector.Register(task)
+	elector.Register(task)
+	var electedChan = elector.Elected(task)
+
+	var tasks = elector.FindAllTasks()
+	if len(tasks) != 1 || tasks[0] != task {
+		t.Fatal("expected only one task, but got:", tasks)
+	}
+
+	select {
+	case <-electedChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("should be elected")
+	}
+	if !elector.IsLeader(task) {
+		t.Fatal("should be leader")
+	}
+	var lease = elector.Lease(task)
+	if lease == nil || lease.Token() <= 0 {
+		t.Fatal("should hold a lease with token")
+	}
+
+	// 已经当选之后订阅也需要收到通知
+	select {
+	case <-elector.Elected(task):
+	default:
+		t.Fatal("should notify subscriber after elected")
+	}
+
+	elector.Stop()
+	if elector.IsLeader(task) {
+		t.Fatal("should not be leader after stopped")
+	}
+
+	locker, err := models.SharedSysLockerDAO.FindLocker(nil, models.SysLockerLeaderPrefix+task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locker == nil || len(locker.Owner) > 0 || locker.TimeoutAt > 0 {
+		t.Fatal("lease should be released after stopped")
+	}
+	_, _ = models.SharedSysLockerDAO.Query(nil).Attr("key", models.SysLockerLeaderPrefix+task).Delete()
+}
@@ -4,20 +4,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/1uLang/EdgeCommon/pkg/systemconfigs"
+	"github.com/TeaOSLab/EdgeAPI/internal/accesslogs"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	"github.com/TeaOSLab/EdgeAPI/internal/utils/numberutils"
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/logs"
+	"github.com/iwind/TeaGo/types"
 	"time"
 )
 
 func init() {
 	dbs.OnReady(func() {
+		SharedLeaderElector.Register(LeaderTaskLog)
 		go NewLogTask().Run()
 	})
 }
 
+const logTaskExportLastIdKey = "logTaskExportLastId"
+
 type LogTask struct {
 }
 
@@ -28,11 +33,23 @@ func NewLogTask() *LogTask {
 func (this *LogTask) Run() {
 	go this.runClean()
 	go this.runMonitor()
+	go this.runExport()
 }
 
 func (this *LogTask) runClean() {
-	ticker := utils.NewTicker(24 * time.Hour)
-	for ticker.Wait() {
+	ticker := time.NewTicker(24 * time.Hour)
+	electedChan := SharedLeaderElector.Elected(LeaderTaskLog)
+	for {
+		// 当选Leader时立即执行一次，以免接管之后要等待一个周期；上次执行时间会被检查，所以不会重复清理
+		select {
+		case <-ticker.C:
+		case <-electedChan:
+		}
+
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskLog) {
+			continue
+		}
 		err := this.loopClean(86400)
 		if err != nil {
 			logs.Println("[TASK][LOG]" + err.Error())
@@ -84,6 +101,10 @@ func (this *LogTask) loopClean(seconds int64) error {
 func (this *LogTask) runMonitor() {
 	ticker := utils.NewTicker(1 * time.Minute)
 	for ticker.Wait() {
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskLog) {
+			continue
+		}
 		err := this.loopMonitor(60)
 		if err != nil {
 			logs.Println("[TASK][LOG]" + err.Error())
@@ -143,6 +164,128 @@ func (this *LogTask) loopMonitor(seconds int64) error {
 	return nil
 }
 
+func (this *LogTask) runExport() {
+	ticker := utils.NewTicker(1 * time.Minute)
+	for ticker.Wait() {
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskLog) {
+			continue
+		}
+		err := this.loopExport()
+		if err != nil {
+			logs.Println("[TASK][LOG]export failed: " + err.Error())
+		}
+	}
+}
+
+// 将操作日志导出到外部存储
+func (this *LogTask) loopExport() error {
+	valueJSON, err := models.SharedSysSettingDAO.ReadSetting(nil, models.LogExportSettingCode)
+	if err != nil {
+		return err
+	}
+	if len(valueJSON) == 0 {
+		return nil
+	}
+	config := models.NewLogExportConfig()
+	err = json.Unmarshal(valueJSON, config)
+	if err != nil {
+		return err
+	}
+	if !config.IsOn || len(config.PolicyIds) == 0 {
+		return nil
+	}
+
+	// 防止多个API节点重复导出
+	lockerKey := "logTaskExportLoop"
+	lease, err := models.SharedSysLockerDAO.AcquireLease(nil, lockerKey, 60)
+	if err != nil {
+		return err
+	}
+	if lease == nil {
+		return nil
+	}
+	defer func() {
+		_ = lease.Release()
+	}()
+
+	// 每个策略单独记录导出位置，以免一个策略出错时其他策略重复导出
+	lastIds, err := this.readExportLastIds(config.PolicyIds)
+	if err != nil {
+		return err
+	}
+	for _, policyId := range config.PolicyIds {
+		err = this.exportToPolicy(policyId, lastIds)
+		if err != nil {
+			logs.Println("[TASK][LOG]export to policy '" + types.String(policyId) + "' failed: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// 将某个策略尚未导出的日志导出
+func (this *LogTask) exportToPolicy(policyId int64, lastIds map[int64]int64) error {
+	for {
+		logList, err := models.SharedLogDAO.ListLogsAfterId(nil, lastIds[policyId], 1000)
+		if err != nil {
+			return err
+		}
+		if len(logList) == 0 {
+			return nil
+		}
+
+		var items = [][]byte{}
+		for _, log := range logList {
+			data, err := log.ExportJSON()
+			if err != nil {
+				return err
+			}
+			items = append(items, data)
+		}
+
+		err = accesslogs.SharedStorageManager.WriteRaw(policyId, items)
+		if err != nil {
+			return err
+		}
+
+		lastIds[policyId] = int64(logList[len(logList)-1].Id)
+		lastIdsJSON, err := json.Marshal(lastIds)
+		if err != nil {
+			return err
+		}
+		err = models.SharedSysSettingDAO.UpdateSetting(nil, logTaskExportLastIdKey, lastIdsJSON)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// 读取每个策略已导出的最后一条日志ID
+// 兼容以前所有策略共用一个ID的格式
+func (this *LogTask) readExportLastIds(policyIds []int64) (map[int64]int64, error) {
+	lastIdJSON, err := models.SharedSysSettingDAO.ReadSetting(nil, logTaskExportLastIdKey)
+	if err != nil {
+		return nil, err
+	}
+	var lastIds = map[int64]int64{}
+	if len(lastIdJSON) == 0 {
+		return lastIds, nil
+	}
+	if lastIdJSON[0] == '{' {
+		err = json.Unmarshal(lastIdJSON, &lastIds)
+		if err != nil {
+			return nil, err
+		}
+		return lastIds, nil
+	}
+
+	var lastId = types.Int64(string(lastIdJSON))
+	for _, policyId := range policyIds {
+		lastIds[policyId] = lastId
+	}
+	return lastIds, nil
+}
+
 func (this *LogTask) formatBytes(bytes int64) string {
 	sizeHuman := ""
 	if bytes < 1024 {
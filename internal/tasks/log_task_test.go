@@ -26,3 +26,14 @@ func TestLogTask_loopMonitor(t *testing.T) {
 	}
 	t.Log("ok")
 }
+
+func TestLogTask_loopExport(t *testing.T) {
+	dbs.NotifyReady()
+
+	task := NewLogTask()
+	err := task.loopExport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ok")
+}
@@ -2,7 +2,6 @@ package tasks
 
 import (
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
-	"github.com/TeaOSLab/EdgeAPI/internal/utils"
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/logs"
 	"time"
@@ -10,6 +9,7 @@ import (
 
 func init() {
 	dbs.OnReady(func() {
+		SharedLeaderElector.Register(LeaderTaskMessage)
 		go NewMessageTask().Run()
 	})
 }
@@ -25,8 +25,19 @@ func NewMessageTask() *MessageTask {
 
 // 运行
 func (this *MessageTask) Run() {
-	ticker := utils.NewTicker(24 * time.Hour)
-	for ticker.Wait() {
+	ticker := time.NewTicker(24 * time.Hour)
+	electedChan := SharedLeaderElector.Elected(LeaderTaskMessage)
+	for {
+		// 当选Leader时立即执行一次，以免接管之后要等待一个周期
+		select {
+		case <-ticker.C:
+		case <-electedChan:
+		}
+
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskMessage) {
+			continue
+		}
 		err := this.loop()
 		if err != nil {
 			logs.Println("[TASK][MESSAGE]" + err.Error())
@@ -12,6 +12,7 @@ import (
 
 func init() {
 	dbs.OnReady(func() {
+		SharedLeaderElector.Register(LeaderTaskMonitorItemValue)
 		go NewMonitorItemValueTask().Start()
 	})
 }
@@ -31,6 +32,10 @@ func (this *MonitorItemValueTask) Start() {
 		ticker = time.NewTicker(1 * time.Minute)
 	}
 	for range ticker.C {
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskMonitorItemValue) {
+			continue
+		}
 		err := this.Loop()
 		if err != nil {
 			remotelogs.Error("MonitorItemValueTask", err.Error())
@@ -0,0 +1,297 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tasks
+
+import (
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/installers"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/iwind/TeaGo/dbs"
+	"github.com/iwind/TeaGo/types"
+	"sync"
+	"time"
+)
+
+// 安装完成后等待节点启动的时间，然后再执行健康检查
+const nodeInstallJobHealthCheckDelay = 10 * time.Second
+
+func init() {
+	dbs.OnReadyDone(func() {
+		SharedLeaderElector.Register(LeaderTaskNodeInstallJob)
+		go NewNodeInstallJobTask().Start()
+	})
+}
+
+// NodeInstallJobTask 执行节点批量安装和滚动升级任务
+// 节点分批安装：先安装灰度节点，然后每批并行安装一组节点；每批结束后可以执行健康检查，
+// 灰度节点失败或者失败数量达到阈值时暂停任务，等待管理员处理后恢复
+type NodeInstallJobTask struct {
+	jobNodesLocker sync.Mutex
+}
+
+func NewNodeInstallJobTask() *NodeInstallJobTask {
+	return &NodeInstallJobTask{}
+}
+
+func (this *NodeInstallJobTask) Start() {
+	ticker := time.NewTicker(5 * time.Second)
+	for range ticker.C {
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskNodeInstallJob) {
+			continue
+		}
+		err := this.Loop()
+		if err != nil {
+			remotelogs.Error("NODE_INSTALL_JOB", err.Error())
+		}
+	}
+}
+
+func (this *NodeInstallJobTask) Loop() error {
+	var lease = SharedLeaderElector.Lease(LeaderTaskNodeInstallJob)
+	if lease == nil {
+		return nil
+	}
+
+	job, err := models.SharedNodeInstallJobDAO.FindNextJob(nil)
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return nil
+	}
+
+	// 使用租约的防护令牌接管任务，之后所有修改都需要带上令牌，被新的Leader接管后旧的修改都会失败
+	var jobId = int64(job.Id)
+	var leaderToken = lease.Token()
+	ok, err := models.SharedNodeInstallJobDAO.ClaimJob(nil, jobId, leaderToken)
+	if err != nil || !ok {
+		return err
+	}
+
+	err = this.runJob(job, lease)
+	if err != nil {
+		remotelogs.Error("NODE_INSTALL_JOB", "job '"+types.String(jobId)+"' failed: "+err.Error())
+		return models.SharedNodeInstallJobDAO.FinishJob(nil, jobId, leaderToken, err.Error())
+	}
+	return nil
+}
+
+func (this *NodeInstallJobTask) runJob(job *models.NodeInstallJob, lease *models.SysLease) error {
+	var jobId = int64(job.Id)
+	var leaderToken = lease.Token()
+	jobNodes, err := job.DecodeNodes()
+	if err != nil {
+		return err
+	}
+
+	var countWaves = job.CountWaves()
+	for wave := 1; wave <= countWaves; wave++ {
+		var waveNodes = []*models.NodeInstallJobNode{}
+		for _, jobNode := range jobNodes {
+			// 上次中断时正在安装的节点需要重新安装
+			if jobNode.Wave == wave && !jobNode.IsDone() {
+				waveNodes = append(waveNodes, jobNode)
+			}
+		}
+		if len(waveNodes) == 0 {
+			continue
+		}
+
+		// 检查是否已被暂停、取消，或者已经被其他Leader接管
+		if lease.IsLost() {
+			return nil
+		}
+		status, err := models.SharedNodeInstallJobDAO.FindJobStatus(nil, jobId)
+		if err != nil {
+			return err
+		}
+		if status != models.NodeInstallJobStatusRunning {
+			return nil
+		}
+
+		// 安装
+		this.installWave(job, lease, jobNodes, waveNodes, wave)
+
+		// 健康检查
+		if job.HealthCheck == 1 {
+			err = this.checkWave(waveNodes)
+			if err != nil {
+				return err
+			}
+		}
+
+		ok, err := models.SharedNodeInstallJobDAO.UpdateJobProgress(nil, jobId, leaderToken, jobNodes, wave)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			remotelogs.Warn("NODE_INSTALL_JOB", "job '"+types.String(jobId)+"' has been taken over by another leader")
+			return nil
+		}
+
+		// 检查是否需要暂停
+		var countWaveFailed = 0
+		for _, jobNode := range waveNodes {
+			if jobNode.Status == models.NodeInstallJobNodeStatusFailed {
+				countWaveFailed++
+			}
+		}
+		if countWaveFailed > 0 {
+			job, err = models.SharedNodeInstallJobDAO.FindEnabledNodeInstallJob(nil, jobId)
+			if err != nil {
+				return err
+			}
+			if job == nil {
+				return nil
+			}
+			var reason = ""
+			if wave == 1 && job.CanarySize > 0 {
+				reason = "canary nodes failed"
+			} else if job.IsPausedOnFailures() {
+				reason = "too many nodes failed"
+			}
+			if len(reason) > 0 {
+				_, err = models.SharedNodeInstallJobDAO.PauseJobWithLeader(nil, jobId, leaderToken, reason)
+				return err
+			}
+		}
+	}
+
+	return models.SharedNodeInstallJobDAO.FinishJob(nil, jobId, leaderToken, "")
+}
+
+// 并行安装一批节点
+// 每个节点开始安装之前都会到数据库中确认仍然持有租约，并且任务没有被其他Leader接管，以免多个Leader同时安装同一个节点
+func (this *NodeInstallJobTask) installWave(job *models.NodeInstallJob, lease *models.SysLease, jobNodes []*models.NodeInstallJobNode, waveNodes []*models.NodeInstallJobNode, wave int) {
+	var jobId = int64(job.Id)
+	var leaderToken = lease.Token()
+	var isUpgrading = job.IsUpgrading == 1
+
+	var wg = sync.WaitGroup{}
+	wg.Add(len(waveNodes))
+	for _, jobNode := range waveNodes {
+		go func(jobNode *models.NodeInstallJobNode) {
+			defer wg.Done()
+
+			err := lease.Check()
+			if err != nil {
+				remotelogs.Warn("NODE_INSTALL_JOB", "skip node '"+types.String(jobNode.NodeId)+"': "+err.Error())
+				return
+			}
+			var isClaimed = this.updateJobNode(jobId, leaderToken, jobNodes, wave, func() {
+				jobNode.Status = models.NodeInstallJobNodeStatusRunning
+				jobNode.Error = ""
+				jobNode.ErrorCode = ""
+				jobNode.StartedAt = time.Now().Unix()
+				jobNode.FinishedAt = 0
+			})
+			if !isClaimed {
+				return
+			}
+
+			installStatus, err := this.installNode(jobNode.NodeId, isUpgrading)
+
+			this.updateJobNode(jobId, leaderToken, jobNodes, wave, func() {
+				jobNode.FinishedAt = time.Now().Unix()
+				if err != nil {
+					jobNode.Status = models.NodeInstallJobNodeStatusFailed
+					jobNode.Error = err.Error()
+					return
+				}
+				if installStatus == nil || !installStatus.IsOk {
+					jobNode.Status = models.NodeInstallJobNodeStatusFailed
+					if installStatus != nil {
+						jobNode.Error = installStatus.Error
+						jobNode.ErrorCode = installStatus.ErrorCode
+					}
+					return
+				}
+				jobNode.Status = models.NodeInstallJobNodeStatusOk
+			})
+		}(jobNode)
+	}
+	wg.Wait()
+}
+
+// 安装单个节点，返回节点的安装状态
+func (this *NodeInstallJobTask) installNode(nodeId int64, isUpgrading bool) (*models.NodeInstallStatus, error) {
+	if isUpgrading {
+		err := models.SharedNodeDAO.UpdateNodeIsInstalled(nil, nodeId, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := installers.SharedNodeQueue().InstallNodeProcess(nodeId, isUpgrading)
+	if err != nil {
+		return nil, err
+	}
+	return models.SharedNodeDAO.FindNodeInstallStatus(nil, nodeId)
+}
+
+// 对一批中安装成功的节点执行健康检查，没有设置健康检查的集群会跳过
+func (this *NodeInstallJobTask) checkWave(waveNodes []*models.NodeInstallJobNode) error {
+	var clusterNodesMap = map[int64][]*models.NodeInstallJobNode{} // clusterId => nodes
+	for _, jobNode := range waveNodes {
+		if jobNode.Status == models.NodeInstallJobNodeStatusOk {
+			clusterNodesMap[jobNode.ClusterId] = append(clusterNodesMap[jobNode.ClusterId], jobNode)
+		}
+	}
+	if len(clusterNodesMap) == 0 {
+		return nil
+	}
+
+	time.Sleep(nodeInstallJobHealthCheckDelay)
+
+	for clusterId, clusterNodes := range clusterNodesMap {
+		config, err := models.SharedNodeClusterDAO.FindClusterHealthCheckConfig(nil, clusterId)
+		if err != nil {
+			return err
+		}
+		if config == nil {
+			remotelogs.Warn("NODE_INSTALL_JOB", "skip health check for cluster '"+types.String(clusterId)+"': health check config is not found")
+			continue
+		}
+
+		results, err := NewHealthCheckExecutor(clusterId).Run()
+		if err != nil {
+			return err
+		}
+		var resultsMap = map[int64]*HealthCheckResult{} // nodeId => result
+		for _, result := range results {
+			resultsMap[int64(result.Node.Id)] = result
+		}
+		for _, jobNode := range clusterNodes {
+			result, ok := resultsMap[jobNode.NodeId]
+			if !ok {
+				// 节点未启用等情况不会被检查
+				continue
+			}
+			if !result.IsOk {
+				jobNode.Status = models.NodeInstallJobNodeStatusFailed
+				jobNode.Error = "health check failed: " + result.Error
+				jobNode.ErrorCode = "HEALTH_CHECK_FAILED"
+			}
+		}
+	}
+	return nil
+}
+
+// 修改节点进度并保存，任务已经被其他Leader接管时返回false
+// 保存出错时只记录日志，进度会在这一批结束时再次保存
+func (this *NodeInstallJobTask) updateJobNode(jobId int64, leaderToken int64, jobNodes []*models.NodeInstallJobNode, wave int, f func()) bool {
+	this.jobNodesLocker.Lock()
+	defer this.jobNodesLocker.Unlock()
+
+	f()
+	ok, err := models.SharedNodeInstallJobDAO.UpdateJobProgress(nil, jobId, leaderToken, jobNodes, wave)
+	if err != nil {
+		remotelogs.Error("NODE_INSTALL_JOB", "update job '"+types.String(jobId)+"' progress failed: "+err.Error())
+		return true
+	}
+	if !ok {
+		remotelogs.Warn("NODE_INSTALL_JOB", "job '"+types.String(jobId)+"' has been taken over by another leader")
+	}
+	return ok
+}
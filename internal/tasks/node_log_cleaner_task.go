@@ -9,6 +9,7 @@ import (
 
 func init() {
 	dbs.OnReady(func() {
+		SharedLeaderElector.Register(LeaderTaskNodeLogCleaner)
 		go NewNodeLogCleanerTask().Start()
 	})
 }
@@ -27,6 +28,10 @@ func NewNodeLogCleanerTask() *NodeLogCleanerTask {
 func (this *NodeLogCleanerTask) Start() {
 	ticker := time.NewTicker(this.duration)
 	for range ticker.C {
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskNodeLogCleaner) {
+			continue
+		}
 		err := this.loop()
 		if err != nil {
 			logs.Println("[TASK]" + err.Error())
@@ -7,15 +7,21 @@ import (
 	"github.com/TeaOSLab/EdgeAPI/internal/utils/numberutils"
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/logs"
+	"github.com/iwind/TeaGo/maps"
 	"time"
 )
 
 func init() {
 	dbs.OnReady(func() {
+		SharedLeaderElector.Register(LeaderTaskNodeMonitor)
 		task := NewNodeMonitorTask(60)
 		ticker := time.NewTicker(60 * time.Second)
 		go func() {
 			for range ticker.C {
+				// 只有Leader执行
+				if !SharedLeaderElector.IsLeader(LeaderTaskNodeMonitor) {
+					continue
+				}
 				err := task.loop()
 				if err != nil {
 					logs.Println("[TASK][NODE_MONITOR]" + err.Error())
@@ -88,6 +94,16 @@ func (this *NodeMonitorTask) monitorCluster(cluster *models.NodeCluster) error {
 			return err
 		}
 
+		// 通知Webhook订阅
+		err = models.SharedWebhookDAO.NotifyEvent(nil, models.WebhookEventTypeNodeOffline, maps.Map{
+			"nodeId":    node.Id,
+			"name":      node.Name,
+			"clusterId": clusterId,
+		})
+		if err != nil {
+			logs.Println("[TASK][NODE_MONITOR]notify webhooks failed: " + err.Error())
+		}
+
 		// 修改在线状态
 		err = models.SharedNodeDAO.UpdateNodeActive(nil, int64(node.Id), false)
 		if err != nil {
@@ -10,6 +10,7 @@ import (
 
 func init() {
 	dbs.OnReadyDone(func() {
+		SharedLeaderElector.Register(LeaderTaskNodeTaskExtractor)
 		go NewNodeTaskExtractor().Start()
 	})
 }
@@ -25,6 +26,10 @@ func NewNodeTaskExtractor() *NodeTaskExtractor {
 func (this *NodeTaskExtractor) Start() {
 	ticker := time.NewTicker(10 * time.Second)
 	for range ticker.C {
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskNodeTaskExtractor) {
+			continue
+		}
 		err := this.Loop()
 		if err != nil {
 			logs.Println("[TASK][NODE_TASK_EXTRACTOR]" + err.Error())
@@ -33,17 +38,23 @@ func (this *NodeTaskExtractor) Start() {
 }
 
 func (this *NodeTaskExtractor) Loop() error {
-	ok, err := models.SharedSysLockerDAO.Lock(nil, "node_task_extractor", 10-1) // 假设执行时间为1秒
+	lease, err := models.SharedSysLockerDAO.AcquireLease(nil, "node_task_extractor", 10-1) // 假设执行时间为1秒
 	if err != nil {
 		return err
 	}
-	if !ok {
+	if lease == nil {
 		return nil
 	}
 
-	// 这里不解锁，是为了让任务N秒钟之内只运行一次
+	// 执行期间自动续期，结束后释放，以便接管的Leader可以立即执行
+	defer func() {
+		_ = lease.Release()
+	}()
 
 	for _, role := range []string{nodeconfigs.NodeRoleNode, nodeconfigs.NodeRoleDNS} {
+		if lease.IsLost() {
+			return models.ErrLeaseLost
+		}
 		err = models.SharedNodeTaskDAO.ExtractAllClusterTasks(nil, role)
 		if err != nil {
 			return err
@@ -12,10 +12,15 @@ import (
 
 func init() {
 	dbs.OnReady(func() {
+		SharedLeaderElector.Register(LeaderTaskNSNodeMonitor)
 		task := NewNSNodeMonitorTask(60)
 		ticker := time.NewTicker(60 * time.Second)
 		go func() {
 			for range ticker.C {
+				// 只有Leader执行
+				if !SharedLeaderElector.IsLeader(LeaderTaskNSNodeMonitor) {
+					continue
+				}
 				err := task.loop()
 				if err != nil {
 					logs.Println("[TASK][NS_NODE_MONITOR]" + err.Error())
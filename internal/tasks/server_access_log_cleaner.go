@@ -3,10 +3,12 @@ package tasks
 import (
 	"encoding/json"
 	"github.com/1uLang/EdgeCommon/pkg/systemconfigs"
+	"github.com/TeaOSLab/EdgeAPI/internal/accesslogs/archive"
 	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
 	"github.com/TeaOSLab/EdgeAPI/internal/errors"
 	"github.com/iwind/TeaGo/dbs"
 	"github.com/iwind/TeaGo/logs"
+	"github.com/iwind/TeaGo/types"
 	timeutil "github.com/iwind/TeaGo/utils/time"
 	"regexp"
 	"strings"
@@ -15,6 +17,7 @@ import (
 
 func init() {
 	dbs.OnReady(func() {
+		SharedLeaderElector.Register(LeaderTaskServerAccessLogCleaner)
 		task := NewServerAccessLogCleaner()
 		go task.Start()
 	})
@@ -30,7 +33,18 @@ func NewServerAccessLogCleaner() *ServerAccessLogCleaner {
 
 func (this *ServerAccessLogCleaner) Start() {
 	ticker := time.NewTicker(12 * time.Hour)
-	for range ticker.C {
+	electedChan := SharedLeaderElector.Elected(LeaderTaskServerAccessLogCleaner)
+	for {
+		// 当选Leader时立即执行一次，以免接管之后要等待一个周期
+		select {
+		case <-ticker.C:
+		case <-electedChan:
+		}
+
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskServerAccessLogCleaner) {
+			continue
+		}
 		err := this.Loop()
 		if err != nil {
 			logs.Println("[TASK][ServerAccessLogCleaner]Error: " + err.Error())
@@ -39,6 +53,19 @@ func (this *ServerAccessLogCleaner) Start() {
 }
 
 func (this *ServerAccessLogCleaner) Loop() error {
+	// 防止多个API节点同时归档和删除同一个表，归档时间较长时租约会自动续期
+	lockerKey := "serverAccessLogCleaner"
+	lease, err := models.SharedSysLockerDAO.AcquireLease(nil, lockerKey, 60)
+	if err != nil {
+		return err
+	}
+	if lease == nil {
+		return nil
+	}
+	defer func() {
+		_ = lease.Release()
+	}()
+
 	// 当前设置
 	configJSON, err := models.SharedSysSettingDAO.ReadSetting(nil, systemconfigs.SettingCodeDatabaseConfigSetting)
 	if err != nil {
@@ -58,12 +85,18 @@ func (this *ServerAccessLogCleaner) Loop() error {
 	days := config.ServerAccessLog.Clean.Days
 	endDay := timeutil.Format("Ymd", time.Now().AddDate(0, 0, -days+1))
 
+	// 归档设置
+	archiveConfig, err := models.SharedHTTPAccessLogArchiveDAO.ReadConfig(nil)
+	if err != nil {
+		return err
+	}
+
 	// 当前连接的数据库
 	db, err := dbs.Default()
 	if err != nil {
 		return err
 	}
-	err = this.cleanDB(db, endDay)
+	err = this.cleanDB(lease, db, 0, endDay, archiveConfig)
 	if err != nil {
 		return err
 	}
@@ -79,7 +112,7 @@ func (this *ServerAccessLogCleaner) Loop() error {
 		if err != nil {
 			return err
 		}
-		err = this.cleanDB(db, endDay)
+		err = this.cleanDB(lease, db, int64(node.Id), endDay, archiveConfig)
 		if err != nil {
 			_ = db.Close()
 			return err
@@ -91,7 +124,7 @@ func (this *ServerAccessLogCleaner) Loop() error {
 	return nil
 }
 
-func (this *ServerAccessLogCleaner) cleanDB(db *dbs.DB, endDay string) error {
+func (this *ServerAccessLogCleaner) cleanDB(lease *models.SysLease, db *dbs.DB, dbNodeId int64, endDay string, archiveConfig *archive.Config) error {
 	ones, columnNames, err := db.FindOnes("SHOW TABLES")
 	if err != nil {
 		return err
@@ -118,6 +151,30 @@ func (this *ServerAccessLogCleaner) cleanDB(db *dbs.DB, endDay string) error {
 		}
 		day := tableName[index+1:]
 		if day < endDay {
+			// 确认仍然持有锁，防止和接管的API节点同时操作
+			err = lease.Check()
+			if err != nil {
+				return err
+			}
+
+			// 删除之前先归档HTTP访问日志
+			if archiveConfig.IsOn && strings.HasPrefix(strings.ToLower(tableName), "edgehttpaccesslogs_") {
+				canDrop, err := this.archiveTable(db, dbNodeId, day, archiveConfig)
+				if err != nil {
+					logs.Println("[TASK][ServerAccessLogCleaner]archive table '" + tableName + "' failed: " + err.Error())
+					continue
+				}
+				if !canDrop {
+					continue
+				}
+
+				// 归档可能持续较长时间
+				err = lease.Check()
+				if err != nil {
+					return err
+				}
+			}
+
 			_, err = db.Exec("DROP TABLE " + tableName)
 			if err != nil {
 				return err
@@ -126,3 +183,25 @@ func (this *ServerAccessLogCleaner) cleanDB(db *dbs.DB, endDay string) error {
 	}
 	return nil
 }
+
+// 归档日志表，返回是否可以删除
+// 已经归档的表不再重复归档；最近恢复过的表在保留期内不会被删除
+func (this *ServerAccessLogCleaner) archiveTable(db *dbs.DB, dbNodeId int64, day string, archiveConfig *archive.Config) (canDrop bool, err error) {
+	accessLogArchive, err := models.SharedHTTPAccessLogArchiveDAO.FindArchive(nil, dbNodeId, day)
+	if err != nil {
+		return false, err
+	}
+	if accessLogArchive != nil {
+		var keepSeconds = int64(archiveConfig.RestoredKeepDays) * 86400
+		return int64(accessLogArchive.RestoredAt) < time.Now().Unix()-keepSeconds, nil
+	}
+
+	accessLogArchive, err = models.SharedHTTPAccessLogArchiveDAO.ArchiveTable(nil, db, dbNodeId, day, archiveConfig)
+	if err != nil {
+		return false, err
+	}
+	if accessLogArchive != nil {
+		logs.Println("[TASK][ServerAccessLogCleaner]archived '" + accessLogArchive.TableName + "': " + types.String(accessLogArchive.CountRows) + " rows, " + types.String(accessLogArchive.CountFiles) + " files")
+	}
+	return true, nil
+}
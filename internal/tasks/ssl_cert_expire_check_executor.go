@@ -14,6 +14,7 @@ import (
 
 func init() {
 	dbs.OnReady(func() {
+		SharedLeaderElector.Register(LeaderTaskSSLCertExpireCheck)
 		go NewSSLCertExpireCheckExecutor().Start()
 	})
 }
@@ -30,7 +31,18 @@ func NewSSLCertExpireCheckExecutor() *SSLCertExpireCheckExecutor {
 func (this *SSLCertExpireCheckExecutor) Start() {
 	seconds := int64(3600)
 	ticker := time.NewTicker(time.Duration(seconds) * time.Second)
-	for range ticker.C {
+	electedChan := SharedLeaderElector.Elected(LeaderTaskSSLCertExpireCheck)
+	for {
+		// 当选Leader时立即执行一次，以免接管之后要等待一个周期
+		select {
+		case <-ticker.C:
+		case <-electedChan:
+		}
+
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskSSLCertExpireCheck) {
+			continue
+		}
 		err := this.loop(seconds)
 		if err != nil {
 			logs.Println("[ERROR][SSLCertExpireCheckExecutor]" + err.Error())
@@ -131,6 +143,17 @@ func (this *SSLCertExpireCheckExecutor) loop(seconds int64) error {
 								"acmeTaskId": cert.AcmeTaskId,
 							}.AsJSON())
 
+							// 通知Webhook订阅
+							err = models.SharedWebhookDAO.NotifyEvent(nil, models.WebhookEventTypeCertRenewed, maps.Map{
+								"certId":     cert.Id,
+								"name":       cert.Name,
+								"dnsNames":   cert.DecodeDNSNames(),
+								"acmeTaskId": cert.AcmeTaskId,
+							})
+							if err != nil {
+								logs.Println("[ERROR][SSLCertExpireCheckExecutor]notify webhooks failed: " + err.Error())
+							}
+
 							// 更新通知时间
 							err = models.SharedSSLCertDAO.UpdateCertNotifiedAt(nil, int64(cert.Id))
 							if err != nil {
@@ -145,6 +168,18 @@ func (this *SSLCertExpireCheckExecutor) loop(seconds int64) error {
 								"acmeTaskId": cert.AcmeTaskId,
 							}.AsJSON())
 
+							// 通知Webhook订阅
+							err = models.SharedWebhookDAO.NotifyEvent(nil, models.WebhookEventTypeCertRenewFailed, maps.Map{
+								"certId":     cert.Id,
+								"name":       cert.Name,
+								"dnsNames":   cert.DecodeDNSNames(),
+								"acmeTaskId": cert.AcmeTaskId,
+								"error":      errMsg,
+							})
+							if err != nil {
+								logs.Println("[ERROR][SSLCertExpireCheckExecutor]notify webhooks failed: " + err.Error())
+							}
+
 							// 更新通知时间
 							err = models.SharedSSLCertDAO.UpdateCertNotifiedAt(nil, int64(cert.Id))
 							if err != nil {
@@ -0,0 +1,90 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tasks
+
+import (
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/iwind/TeaGo/dbs"
+	"sync"
+	"time"
+)
+
+func init() {
+	dbs.OnReadyDone(func() {
+		SharedLeaderElector.Register(LeaderTaskWebhookDelivery)
+		go NewWebhookDeliveryTask().Start()
+	})
+}
+
+// WebhookDeliveryTask Webhook投递任务
+type WebhookDeliveryTask struct {
+	concurrent int
+}
+
+func NewWebhookDeliveryTask() *WebhookDeliveryTask {
+	return &WebhookDeliveryTask{
+		concurrent: 8,
+	}
+}
+
+func (this *WebhookDeliveryTask) Start() {
+	ticker := time.NewTicker(5 * time.Second)
+	for range ticker.C {
+		// 只有Leader执行
+		if !SharedLeaderElector.IsLeader(LeaderTaskWebhookDelivery) {
+			continue
+		}
+		err := this.Loop()
+		if err != nil {
+			remotelogs.Error("WEBHOOK_DELIVERY_TASK", err.Error())
+		}
+	}
+}
+
+// Loop 单次投递
+func (this *WebhookDeliveryTask) Loop() error {
+	// 防止多个API节点重复投递
+	lockerKey := "webhookDeliveryTask"
+	lease, err := models.SharedSysLockerDAO.AcquireLease(nil, lockerKey, 60)
+	if err != nil {
+		return err
+	}
+	if lease == nil {
+		return nil
+	}
+	defer func() {
+		_ = lease.Release()
+	}()
+
+	deliveries, err := models.SharedWebhookDeliveryDAO.FindDueDeliveries(nil, 100)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	var deliveryChan = make(chan *models.WebhookDelivery, len(deliveries))
+	for _, delivery := range deliveries {
+		deliveryChan <- delivery
+	}
+	close(deliveryChan)
+
+	var wg = &sync.WaitGroup{}
+	for i := 0; i < this.concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for delivery := range deliveryChan {
+				_, err := models.SharedWebhookDeliveryDAO.Deliver(nil, delivery, false)
+				if err != nil {
+					remotelogs.Error("WEBHOOK_DELIVERY_TASK", "deliver '"+delivery.EventType+"' failed: "+err.Error())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
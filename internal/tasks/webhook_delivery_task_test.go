@@ -0,0 +1,18 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tasks
+
+import (
+	"github.com/iwind/TeaGo/dbs"
+	"testing"
+)
+
+func TestWebhookDeliveryTask_Loop(t *testing.T) {
+	dbs.NotifyReady()
+
+	err := NewWebhookDeliveryTask().Loop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ok")
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tracing
+
+// SettingCode 链路追踪配置在系统设置中的代号
+const SettingCode = "apiTracingConfig"
+
+// Config 链路追踪配置
+type Config struct {
+	IsOn        bool        `json:"isOn"`        // 是否启用
+	ServiceName string      `json:"serviceName"` // 服务名，为空时使用 edge-api
+	OTLP        *OTLPConfig `json:"otlp"`        // 导出到OTLP收集器
+	File        *FileConfig `json:"file"`        // 导出到本地文件
+}
+
+// NewConfig 获取新对象
+func NewConfig() *Config {
+	return &Config{
+		OTLP: &OTLPConfig{},
+		File: &FileConfig{},
+	}
+}
+
+// OTLPConfig OTLP导出配置，使用 OTLP/HTTP + JSON 协议
+type OTLPConfig struct {
+	IsOn           bool              `json:"isOn"`           // 是否启用
+	Endpoint       string            `json:"endpoint"`       // 收集器地址，比如 http://127.0.0.1:4318/v1/traces
+	Headers        map[string]string `json:"headers"`        // 附加的Header，比如认证信息
+	TimeoutSeconds int               `json:"timeoutSeconds"` // 超时时间
+	SampleRate     float64           `json:"sampleRate"`     // 采样率：0-1
+}
+
+// FileConfig 本地文件导出配置，用于离线调试
+type FileConfig struct {
+	IsOn       bool    `json:"isOn"`       // 是否启用
+	Path       string  `json:"path"`       // 文件路径，为空时使用 logs/trace.log
+	MaxSizeMB  int     `json:"maxSizeMB"`  // 文件最大尺寸，超出后轮转，为空时使用 100MB
+	SampleRate float64 `json:"sampleRate"` // 采样率：0-1
+}
+
+// 是否需要导出到OTLP收集器
+func (this *Config) otlpIsOn() bool {
+	return this.IsOn && this.OTLP != nil && this.OTLP.IsOn && len(this.OTLP.Endpoint) > 0
+}
+
+// 是否需要导出到本地文件
+func (this *Config) fileIsOn() bool {
+	return this.IsOn && this.File != nil && this.File.IsOn
+}
@@ -0,0 +1,29 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tracing
+
+import (
+	"context"
+)
+
+type spanContextKey struct{}
+
+// ContextWithSpan 将跨度放入上下文
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext 从上下文中读取跨度
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, ok := ctx.Value(spanContextKey{}).(*Span)
+	if ok {
+		return span
+	}
+	return nil
+}
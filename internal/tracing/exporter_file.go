@@ -0,0 +1,127 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tracing
+
+import (
+	"encoding/json"
+	"github.com/iwind/TeaGo/Tea"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileExporter 将跨度写入本地文件，每行一个JSON，用于离线调试
+// 每行的格式和 OTLP/JSON 中的跨度相同，另外附加了 serviceName
+type FileExporter struct {
+	serviceName string
+	path        string
+	maxSize     int64
+
+	fp       *os.File
+	size     int64
+	isClosed bool
+	locker   sync.Mutex
+}
+
+// NewFileExporter 获取新对象
+func NewFileExporter(serviceName string, config *FileConfig) *FileExporter {
+	var path = config.Path
+	if len(path) == 0 {
+		path = Tea.Root + "/logs/trace.log"
+	}
+	var maxSizeMB = config.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = 100
+	}
+	return &FileExporter{
+		serviceName: serviceName,
+		path:        path,
+		maxSize:     int64(maxSizeMB) << 20,
+	}
+}
+
+// Path 文件路径
+func (this *FileExporter) Path() string {
+	return this.path
+}
+
+// Export 导出
+func (this *FileExporter) Export(spans []*Span) error {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	if this.isClosed {
+		return nil
+	}
+
+	err := this.open()
+	if err != nil {
+		return err
+	}
+
+	for _, span := range spans {
+		var spanMap = encodeOTLPSpan(span)
+		spanMap["serviceName"] = this.serviceName
+		data, err := json.Marshal(spanMap)
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		n, err := this.fp.Write(data)
+		this.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 轮转
+	if this.size >= this.maxSize {
+		_ = this.fp.Close()
+		this.fp = nil
+		return os.Rename(this.path, this.path+".1")
+	}
+
+	return nil
+}
+
+// Close 关闭
+func (this *FileExporter) Close() error {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	this.isClosed = true
+	if this.fp != nil {
+		err := this.fp.Close()
+		this.fp = nil
+		return err
+	}
+	return nil
+}
+
+func (this *FileExporter) open() error {
+	if this.fp != nil {
+		return nil
+	}
+
+	var dir = filepath.Dir(this.path)
+	_, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(dir, 0777)
+		if err != nil {
+			return err
+		}
+	}
+
+	fp, err := os.OpenFile(this.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	stat, err := fp.Stat()
+	if err != nil {
+		_ = fp.Close()
+		return err
+	}
+	this.fp = fp
+	this.size = stat.Size()
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	teaconst "github.com/TeaOSLab/EdgeAPI/internal/const"
+	"github.com/iwind/TeaGo/maps"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// OTLPExporter 使用 OTLP/HTTP + JSON 协议将跨度导出到收集器
+type OTLPExporter struct {
+	serviceName string
+	config      *OTLPConfig
+	client      *http.Client
+}
+
+// NewOTLPExporter 获取新对象
+func NewOTLPExporter(serviceName string, config *OTLPConfig) *OTLPExporter {
+	var timeout = time.Duration(config.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &OTLPExporter{
+		serviceName: serviceName,
+		config:      config,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+// Endpoint 收集器地址
+func (this *OTLPExporter) Endpoint() string {
+	return this.config.Endpoint
+}
+
+// Export 导出
+func (this *OTLPExporter) Export(spans []*Span) error {
+	data, err := json.Marshal(EncodeOTLP(this.serviceName, spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, this.config.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", teaconst.ProductName+"/"+teaconst.Version)
+	for k, v := range this.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.New("invalid response status '" + strconv.Itoa(resp.StatusCode) + "': " + string(body))
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// EncodeOTLP 将跨度编码为 ExportTraceServiceRequest 的JSON形式
+func EncodeOTLP(serviceName string, spans []*Span) maps.Map {
+	var spanMaps = []maps.Map{}
+	for _, span := range spans {
+		spanMaps = append(spanMaps, encodeOTLPSpan(span))
+	}
+
+	return maps.Map{
+		"resourceSpans": []maps.Map{
+			{
+				"resource": maps.Map{
+					"attributes": encodeOTLPAttributes(map[string]interface{}{
+						"service.name":    serviceName,
+						"service.version": teaconst.Version,
+					}),
+				},
+				"scopeSpans": []maps.Map{
+					{
+						"scope": maps.Map{
+							"name":    "github.com/TeaOSLab/EdgeAPI/internal/tracing",
+							"version": teaconst.Version,
+						},
+						"spans": spanMaps,
+					},
+				},
+			},
+		},
+	}
+}
+
+func encodeOTLPSpan(span *Span) maps.Map {
+	span.locker.Lock()
+	var statusCode = span.StatusCode
+	var statusMessage = span.StatusMessage
+	var endTime = span.EndTime
+	span.locker.Unlock()
+
+	var result = maps.Map{
+		"traceId":           span.TraceId,
+		"spanId":            span.SpanId,
+		"name":              span.Name,
+		"kind":              span.Kind,
+		"startTimeUnixNano": strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(endTime.UnixNano(), 10),
+		"attributes":        encodeOTLPAttributes(span.copyAttributes()),
+		"status": maps.Map{
+			"code":    statusCode,
+			"message": statusMessage,
+		},
+	}
+	if len(span.ParentSpanId) > 0 {
+		result["parentSpanId"] = span.ParentSpanId
+	}
+	return result
+}
+
+func encodeOTLPAttributes(attributes map[string]interface{}) []maps.Map {
+	var keys = []string{}
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result = []maps.Map{}
+	for _, key := range keys {
+		var value maps.Map
+		switch v := attributes[key].(type) {
+		case string:
+			value = maps.Map{"stringValue": v}
+		case bool:
+			value = maps.Map{"boolValue": v}
+		case int:
+			value = maps.Map{"intValue": strconv.FormatInt(int64(v), 10)}
+		case int32:
+			value = maps.Map{"intValue": strconv.FormatInt(int64(v), 10)}
+		case int64:
+			value = maps.Map{"intValue": strconv.FormatInt(v, 10)}
+		case uint32:
+			value = maps.Map{"intValue": strconv.FormatUint(uint64(v), 10)}
+		case uint64:
+			value = maps.Map{"intValue": strconv.FormatUint(v, 10)}
+		case float32:
+			value = maps.Map{"doubleValue": float64(v)}
+		case float64:
+			value = maps.Map{"doubleValue": v}
+		default:
+			value = maps.Map{"stringValue": fmt.Sprintf("%v", v)}
+		}
+		result = append(result, maps.Map{
+			"key":   key,
+			"value": value,
+		})
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tracing
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// HTTPTransport 为外部HTTP调用记录跨度
+// 用于DNS服务商API、ACME等对外请求
+type HTTPTransport struct {
+	base      http.RoundTripper
+	component string
+}
+
+// NewHTTPTransport 获取新对象
+// component 为调用方组件名，比如 dnspod、acme
+func NewHTTPTransport(base http.RoundTripper, component string) *HTTPTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &HTTPTransport{
+		base:      base,
+		component: component,
+	}
+}
+
+// Base 原始的Transport
+func (this *HTTPTransport) Base() http.RoundTripper {
+	return this.base
+}
+
+// RoundTrip 执行请求
+func (this *HTTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := SharedTracer.StartSpan(req.Context(), this.component+" "+req.Method+" "+req.URL.Host, SpanKindClient)
+	if span == nil {
+		return this.base.RoundTrip(req)
+	}
+	defer span.End()
+
+	span.SetAttribute("component", this.component)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path) // 不记录参数，防止泄露密钥
+	span.SetAttribute("net.peer.name", req.URL.Hostname())
+
+	// 按照RoundTripper的约定，不能修改原始请求
+	req = req.Clone(ctx)
+	req.Header.Set("traceparent", span.TraceParent())
+
+	resp, err := this.base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		span.SetStatus(StatusCodeError, "HTTP "+strconv.Itoa(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections 关闭空闲连接
+func (this *HTTPTransport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if tr, ok := this.base.(closeIdler); ok {
+		tr.CloseIdleConnections()
+	}
+}
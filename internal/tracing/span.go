@@ -0,0 +1,176 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SpanKind 跨度类型，和OpenTelemetry中的定义保持一致
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// StatusCode 跨度状态，和OpenTelemetry中的定义保持一致
+type StatusCode int
+
+const (
+	StatusCodeUnset StatusCode = 0
+	StatusCodeOk    StatusCode = 1
+	StatusCodeError StatusCode = 2
+)
+
+// 采样标记
+const (
+	sampleFlagOTLP uint8 = 1 << iota // 导出到OTLP收集器
+	sampleFlagFile                   // 导出到本地文件
+)
+
+// Span 跨度
+// 所有方法都可以在nil上调用，未被采样的调用链中的跨度都为nil
+type Span struct {
+	TraceId       string
+	SpanId        string
+	ParentSpanId  string
+	Name          string
+	Kind          SpanKind
+	StartTime     time.Time
+	EndTime       time.Time
+	Attributes    map[string]interface{}
+	StatusCode    StatusCode
+	StatusMessage string
+
+	tracer      *Tracer
+	sampleFlags uint8
+	isEnded     int32
+
+	locker sync.Mutex
+}
+
+func newSpan(tracer *Tracer, traceId string, parentSpanId string, name string, kind SpanKind, sampleFlags uint8) *Span {
+	return &Span{
+		TraceId:      traceId,
+		SpanId:       newSpanId(),
+		ParentSpanId: parentSpanId,
+		Name:         name,
+		Kind:         kind,
+		StartTime:    time.Now(),
+		Attributes:   map[string]interface{}{},
+		tracer:       tracer,
+		sampleFlags:  sampleFlags,
+	}
+}
+
+// SetAttribute 设置属性
+func (this *Span) SetAttribute(key string, value interface{}) {
+	if this == nil {
+		return
+	}
+	this.locker.Lock()
+	this.Attributes[key] = value
+	this.locker.Unlock()
+}
+
+// SetError 设置错误
+func (this *Span) SetError(err error) {
+	if this == nil || err == nil {
+		return
+	}
+	this.locker.Lock()
+	this.StatusCode = StatusCodeError
+	this.StatusMessage = err.Error()
+	this.locker.Unlock()
+}
+
+// SetStatus 设置状态
+func (this *Span) SetStatus(code StatusCode, message string) {
+	if this == nil {
+		return
+	}
+	this.locker.Lock()
+	this.StatusCode = code
+	this.StatusMessage = message
+	this.locker.Unlock()
+}
+
+// End 结束跨度并提交给导出队列，重复调用只有第一次有效
+func (this *Span) End() {
+	if this == nil {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&this.isEnded, 0, 1) {
+		return
+	}
+	this.locker.Lock()
+	this.EndTime = time.Now()
+	this.locker.Unlock()
+
+	if this.tracer != nil {
+		this.tracer.submit(this)
+	}
+}
+
+// Duration 耗时
+func (this *Span) Duration() time.Duration {
+	if this == nil {
+		return 0
+	}
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	if this.EndTime.IsZero() {
+		return time.Since(this.StartTime)
+	}
+	return this.EndTime.Sub(this.StartTime)
+}
+
+// TraceParent 生成W3C Trace Context中的traceparent
+func (this *Span) TraceParent() string {
+	if this == nil {
+		return ""
+	}
+	var flags = "00"
+	if this.sampleFlags&sampleFlagOTLP > 0 {
+		flags = "01"
+	}
+	return "00-" + this.TraceId + "-" + this.SpanId + "-" + flags
+}
+
+// 复制属性，防止导出时被修改
+func (this *Span) copyAttributes() map[string]interface{} {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	var result = make(map[string]interface{}, len(this.Attributes))
+	for k, v := range this.Attributes {
+		result[k] = v
+	}
+	return result
+}
+
+func newTraceId() string {
+	return randomHex(16)
+}
+
+func newSpanId() string {
+	return randomHex(8)
+}
+
+func randomHex(size int) string {
+	var b = make([]byte, size)
+	_, err := rand.Read(b)
+	if err != nil {
+		// 基本不会发生，使用时间作为后备
+		var nano = time.Now().UnixNano()
+		for i := 0; i < size; i++ {
+			b[i] = byte(nano >> (uint(i%8) * 8))
+		}
+	}
+	return hex.EncodeToString(b)
+}
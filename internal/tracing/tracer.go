@@ -0,0 +1,306 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/TeaOSLab/EdgeAPI/internal/db/models"
+	"github.com/TeaOSLab/EdgeAPI/internal/metrics"
+	"github.com/TeaOSLab/EdgeAPI/internal/remotelogs"
+	"github.com/iwind/TeaGo/Tea"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 每批最多导出的跨度数量
+const maxBatchSize = 512
+
+var SharedTracer = NewTracer()
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+
+	metrics.SharedRegistry.Describe("edge_api_tracing_spans_total", "Spans exported by tracer")
+	metrics.SharedRegistry.Describe("edge_api_tracing_dropped_spans_total", "Spans dropped because export queue is full")
+	metrics.SharedRegistry.Describe("edge_api_tracing_export_errors_total", "Failed span exports")
+}
+
+// Tracer 链路追踪
+type Tracer struct {
+	config *Config
+
+	otlpExporter *OTLPExporter
+	fileExporter *FileExporter
+
+	queue  chan *Span
+	locker sync.RWMutex
+}
+
+// NewTracer 获取新对象
+func NewTracer() *Tracer {
+	return &Tracer{
+		config: NewConfig(),
+		queue:  make(chan *Span, 10240),
+	}
+}
+
+// Start 启动，定时读取配置
+func (this *Tracer) Start() {
+	go this.exportLoop()
+
+	var ticker = time.NewTicker(30 * time.Second)
+	if Tea.IsTesting() {
+		ticker = time.NewTicker(5 * time.Second)
+	}
+
+	// 启动时执行一次
+	err := this.Loop()
+	if err != nil {
+		remotelogs.Error("TRACING", "load config failed: "+err.Error())
+	}
+
+	for range ticker.C {
+		err := this.Loop()
+		if err != nil {
+			remotelogs.Error("TRACING", "load config failed: "+err.Error())
+		}
+	}
+}
+
+// Loop 读取配置
+func (this *Tracer) Loop() error {
+	valueJSON, err := models.SharedSysSettingDAO.ReadSetting(nil, SettingCode)
+	if err != nil {
+		return err
+	}
+	var config = NewConfig()
+	if len(valueJSON) > 0 {
+		err = json.Unmarshal(valueJSON, config)
+		if err != nil {
+			return err
+		}
+	}
+	this.UpdateConfig(config)
+	return nil
+}
+
+// 导出循环，每次最多导出 maxBatchSize 个跨度
+func (this *Tracer) exportLoop() {
+	var ticker = time.NewTicker(5 * time.Second)
+	var spans = []*Span{}
+	for {
+		select {
+		case span := <-this.queue:
+			spans = append(spans, span)
+			if len(spans) < maxBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(spans) == 0 {
+				continue
+			}
+		}
+
+		this.export(spans)
+		spans = []*Span{}
+	}
+}
+
+// UpdateConfig 修改配置
+func (this *Tracer) UpdateConfig(config *Config) {
+	if config == nil {
+		config = NewConfig()
+	}
+
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	configJSON, _ := json.Marshal(config)
+	oldConfigJSON, _ := json.Marshal(this.config)
+	if string(configJSON) == string(oldConfigJSON) {
+		return
+	}
+
+	this.config = config
+
+	var serviceName = this.serviceName()
+	if config.otlpIsOn() {
+		this.otlpExporter = NewOTLPExporter(serviceName, config.OTLP)
+	} else {
+		this.otlpExporter = nil
+	}
+
+	if this.fileExporter != nil {
+		_ = this.fileExporter.Close()
+		this.fileExporter = nil
+	}
+	if config.fileIsOn() {
+		this.fileExporter = NewFileExporter(serviceName, config.File)
+	}
+}
+
+// IsOn 是否已启用
+func (this *Tracer) IsOn() bool {
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+	return this.config.otlpIsOn() || this.config.fileIsOn()
+}
+
+// StartSpan 开始一个跨度
+// 父跨度从上下文中查找，如果没有父跨度，则根据采样率决定是否开始新的调用链
+// 未被采样时返回的跨度为nil，可以直接调用其方法
+func (this *Tracer) StartSpan(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	var parent = SpanFromContext(ctx)
+	if parent != nil {
+		var span = newSpan(this, parent.TraceId, parent.SpanId, name, kind, parent.sampleFlags)
+		return ContextWithSpan(ctx, span), span
+	}
+
+	var span = this.startRootSpan(name, kind, "")
+	if span == nil {
+		return ctx, nil
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// StartChildSpan 在上下文中的跨度下开始一个子跨度，没有父跨度时不会开始新的调用链
+func (this *Tracer) StartChildSpan(ctx context.Context, name string, kind SpanKind) *Span {
+	var parent = SpanFromContext(ctx)
+	if parent == nil {
+		return nil
+	}
+	return newSpan(this, parent.TraceId, parent.SpanId, name, kind, parent.sampleFlags)
+}
+
+// StartServerSpan 开始一个服务端跨度
+// traceParent 为调用方传入的W3C traceparent，如果调用方已采样，则本地也一定会导出到OTLP收集器
+func (this *Tracer) StartServerSpan(ctx context.Context, name string, traceParent string) (context.Context, *Span) {
+	var span = this.startRootSpan(name, SpanKindServer, traceParent)
+	if span == nil {
+		return ctx, nil
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+func (this *Tracer) startRootSpan(name string, kind SpanKind, traceParent string) *Span {
+	this.locker.RLock()
+	var config = this.config
+	this.locker.RUnlock()
+
+	if !config.IsOn {
+		return nil
+	}
+
+	traceId, parentSpanId, parentSampled := ParseTraceParent(traceParent)
+
+	var flags uint8 = 0
+	if config.otlpIsOn() && (parentSampled || sample(config.OTLP.SampleRate)) {
+		flags |= sampleFlagOTLP
+	}
+	if config.fileIsOn() && sample(config.File.SampleRate) {
+		flags |= sampleFlagFile
+	}
+	if flags == 0 {
+		return nil
+	}
+
+	if len(traceId) == 0 {
+		traceId = newTraceId()
+	}
+	return newSpan(this, traceId, parentSpanId, name, kind, flags)
+}
+
+// 提交到导出队列
+func (this *Tracer) submit(span *Span) {
+	select {
+	case this.queue <- span:
+	default:
+		metrics.SharedRegistry.Counter("edge_api_tracing_dropped_spans_total").Increase()
+	}
+}
+
+// 导出
+func (this *Tracer) export(spans []*Span) {
+	this.locker.RLock()
+	var otlpExporter = this.otlpExporter
+	var fileExporter = this.fileExporter
+	this.locker.RUnlock()
+
+	var otlpSpans = []*Span{}
+	var fileSpans = []*Span{}
+	for _, span := range spans {
+		if span.sampleFlags&sampleFlagOTLP > 0 {
+			otlpSpans = append(otlpSpans, span)
+		}
+		if span.sampleFlags&sampleFlagFile > 0 {
+			fileSpans = append(fileSpans, span)
+		}
+	}
+
+	if otlpExporter != nil && len(otlpSpans) > 0 {
+		err := otlpExporter.Export(otlpSpans)
+		if err != nil {
+			metrics.SharedRegistry.Counter("edge_api_tracing_export_errors_total", "exporter", "otlp").Increase()
+			remotelogs.Error("TRACING", "export spans to '"+otlpExporter.Endpoint()+"' failed: "+err.Error())
+		} else {
+			metrics.SharedRegistry.Counter("edge_api_tracing_spans_total", "exporter", "otlp").Add(int64(len(otlpSpans)))
+		}
+	}
+
+	if fileExporter != nil && len(fileSpans) > 0 {
+		err := fileExporter.Export(fileSpans)
+		if err != nil {
+			metrics.SharedRegistry.Counter("edge_api_tracing_export_errors_total", "exporter", "file").Increase()
+			remotelogs.Error("TRACING", "write spans to file failed: "+err.Error())
+		} else {
+			metrics.SharedRegistry.Counter("edge_api_tracing_spans_total", "exporter", "file").Add(int64(len(fileSpans)))
+		}
+	}
+}
+
+func (this *Tracer) serviceName() string {
+	if this.config != nil && len(this.config.ServiceName) > 0 {
+		return this.config.ServiceName
+	}
+	return "edge-api"
+}
+
+// ParseTraceParent 解析W3C traceparent
+// 格式为：version-traceId-parentId-flags，比如 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceParent(traceParent string) (traceId string, spanId string, sampled bool) {
+	var pieces = strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(pieces) < 4 || len(pieces[1]) != 32 || len(pieces[2]) != 16 || len(pieces[3]) != 2 {
+		return "", "", false
+	}
+	if !isHex(pieces[1]) || !isHex(pieces[2]) || strings.Trim(pieces[1], "0") == "" || strings.Trim(pieces[2], "0") == "" {
+		return "", "", false
+	}
+	flags, err := strconv.ParseUint(pieces[3], 16, 8)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.ToLower(pieces[1]), strings.ToLower(pieces[2]), flags&1 == 1
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func sample(rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	return rand.Float64() < rate
+}
@@ -0,0 +1,241 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestTracer(fileRate float64, otlpRate float64) *Tracer {
+	var tracer = NewTracer()
+	var config = NewConfig()
+	config.IsOn = true
+	config.File.IsOn = fileRate > 0
+	config.File.SampleRate = fileRate
+	config.File.Path = filepath.Join(os.TempDir(), "edge-api-trace-test.log")
+	config.OTLP.IsOn = otlpRate > 0
+	config.OTLP.Endpoint = "http://127.0.0.1:4318/v1/traces"
+	config.OTLP.SampleRate = otlpRate
+	tracer.UpdateConfig(config)
+	return tracer
+}
+
+func TestParseTraceParent(t *testing.T) {
+	{
+		traceId, spanId, sampled := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		if traceId != "4bf92f3577b34da6a3ce929d0e0e4736" || spanId != "00f067aa0ba902b7" || !sampled {
+			t.Fatal("parse failed:", traceId, spanId, sampled)
+		}
+	}
+	{
+		_, _, sampled := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		if sampled {
+			t.Fatal("should not be sampled")
+		}
+	}
+	for _, traceParent := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		traceId, _, _ := ParseTraceParent(traceParent)
+		if len(traceId) > 0 {
+			t.Fatal("'" + traceParent + "' should be invalid")
+		}
+	}
+}
+
+func TestTracer_StartSpan(t *testing.T) {
+	{
+		var tracer = NewTracer()
+		_, span := tracer.StartSpan(context.Background(), "test", SpanKindInternal)
+		if span != nil {
+			t.Fatal("span should be nil when tracer is off")
+		}
+
+		// nil跨度上的调用不应该出错
+		span.SetAttribute("a", 1)
+		span.SetError(nil)
+		span.End()
+	}
+
+	{
+		var tracer = newTestTracer(1, 0)
+		ctx, root := tracer.StartServerSpan(context.Background(), "root", "")
+		if root == nil {
+			t.Fatal("root span should not be nil")
+		}
+		_, child := tracer.StartSpan(ctx, "child", SpanKindClient)
+		if child == nil || child.TraceId != root.TraceId || child.ParentSpanId != root.SpanId {
+			t.Fatal("child span should belong to root span")
+		}
+		if child.sampleFlags&sampleFlagFile == 0 || child.sampleFlags&sampleFlagOTLP > 0 {
+			t.Fatal("child should inherit sample flags")
+		}
+	}
+
+	{
+		// 调用方已采样
+		var tracer = newTestTracer(0, 0.0000001)
+		_, span := tracer.StartServerSpan(context.Background(), "root", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		if span == nil || span.TraceId != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanId != "00f067aa0ba902b7" {
+			t.Fatal("should continue the trace from caller")
+		}
+	}
+}
+
+func TestStartChildSpan(t *testing.T) {
+	var tracer = newTestTracer(1, 0)
+
+	if tracer.StartChildSpan(context.Background(), "SQL SELECT", SpanKindClient) != nil {
+		t.Fatal("should not start child span without parent")
+	}
+
+	ctx, root := tracer.StartServerSpan(context.Background(), "root", "")
+	var child = tracer.StartChildSpan(ctx, "SQL SELECT", SpanKindClient)
+	if child == nil || child.TraceId != root.TraceId || child.ParentSpanId != root.SpanId {
+		t.Fatal("child span should belong to the span in context")
+	}
+}
+
+func TestEncodeOTLP(t *testing.T) {
+	var tracer = newTestTracer(1, 0)
+	_, span := tracer.StartServerSpan(context.Background(), "/pb.NodeService/findEnabledNode", "")
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.grpc.status_code", 0)
+	span.End()
+
+	data, err := json.Marshal(EncodeOTLP("edge-api", []*Span{span}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"resourceSpans"`, `"scopeSpans"`, `"traceId":"` + span.TraceId + `"`, `{"key":"rpc.grpc.status_code","value":{"intValue":"0"}}`} {
+		if !strings.Contains(string(data), s) {
+			t.Fatal("should contain " + s + ", data: " + string(data))
+		}
+	}
+	t.Log(string(data))
+}
+
+func TestOTLPExporter_Export(t *testing.T) {
+	var received []byte
+	var server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer 123" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received, _ = ioutil.ReadAll(req.Body)
+	}))
+	defer server.Close()
+
+	var tracer = newTestTracer(1, 0)
+	_, span := tracer.StartServerSpan(context.Background(), "test", "")
+	span.End()
+
+	var exporter = NewOTLPExporter("edge-api", &OTLPConfig{
+		IsOn:     true,
+		Endpoint: server.URL,
+		Headers:  map[string]string{"Authorization": "Bearer 123"},
+	})
+	err := exporter.Export([]*Span{span})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(received), span.SpanId) {
+		t.Fatal("span not received")
+	}
+
+	exporter.config.Headers = nil
+	err = exporter.Export([]*Span{span})
+	if err == nil {
+		t.Fatal("should fail without authorization")
+	}
+}
+
+func TestFileExporter_Export(t *testing.T) {
+	var path = filepath.Join(os.TempDir(), "edge-api-trace-export-test.log")
+	_ = os.Remove(path)
+	defer func() {
+		_ = os.Remove(path)
+	}()
+
+	var tracer = newTestTracer(1, 0)
+	_, span := tracer.StartServerSpan(context.Background(), "test", "")
+	span.End()
+
+	var exporter = NewFileExporter("edge-api", &FileConfig{IsOn: true, Path: path})
+	err := exporter.Export([]*Span{span, span})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = exporter.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines = strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatal("expect 2 lines, but got", len(lines))
+	}
+	var m = map[string]interface{}{}
+	err = json.Unmarshal([]byte(lines[0]), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["serviceName"] != "edge-api" || m["spanId"] != span.SpanId {
+		t.Fatal("invalid line:", lines[0])
+	}
+}
+
+func TestHTTPTransport_RoundTrip(t *testing.T) {
+	var traceParent string
+	var server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
+		traceParent = req.Header.Get("traceparent")
+		writer.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	var oldTracer = SharedTracer
+	SharedTracer = newTestTracer(1, 0)
+	defer func() {
+		SharedTracer = oldTracer
+	}()
+
+	ctx, root := SharedTracer.StartServerSpan(context.Background(), "root", "")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/records?secret=123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var client = &http.Client{Transport: NewHTTPTransport(nil, "test")}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	traceId, parentSpanId, _ := ParseTraceParent(traceParent)
+	if traceId != root.TraceId || len(parentSpanId) == 0 || parentSpanId == root.SpanId {
+		t.Fatal("invalid traceparent: " + traceParent)
+	}
+	if req.Header.Get("traceparent") != "" {
+		t.Fatal("original request should not be modified")
+	}
+
+	var span = <-SharedTracer.queue
+	if span.SpanId != parentSpanId || span.StatusCode != StatusCodeError {
+		t.Fatal("invalid client span")
+	}
+	if strings.Contains(span.Attributes["http.url"].(string), "secret") {
+		t.Fatal("query should not be recorded")
+	}
+}
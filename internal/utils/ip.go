@@ -29,3 +29,39 @@ func IP2Long(ip string) uint64 {
 func IsIPv6(ip string) bool {
 	return strings.Contains(ip, ":")
 }
+
+var privateIPNets = func() (result []*net.IPNet) {
+	for _, cidr := range []string{
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"100.64.0.0/10", // 运营商级NAT
+		"fc00::/7",      // IPv6唯一本地地址
+	} {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err == nil {
+			result = append(result, ipNet)
+		}
+	}
+	return
+}()
+
+// IsPublicIP 判断是否为公网IP
+// 本地回环、链路本地、内网、组播和未指定地址都不是公网IP
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil ||
+		ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() {
+		return false
+	}
+	for _, ipNet := range privateIPNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,32 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package utils
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for ip, isPublic := range map[string]bool{
+		"8.8.8.8":            true,
+		"2001:4860::8888":    true,
+		"127.0.0.1":          false,
+		"::1":                false,
+		"0.0.0.0":            false,
+		"10.1.2.3":           false,
+		"172.16.0.1":         false,
+		"172.32.0.1":         true,
+		"192.168.1.1":        false,
+		"169.254.169.254":    false,
+		"fe80::1":            false,
+		"fd00::1":            false,
+		"::ffff:127.0.0.1":   false,
+		"::ffff:192.168.1.1": false,
+		"224.0.0.1":          false,
+	} {
+		if IsPublicIP(net.ParseIP(ip)) != isPublic {
+			t.Fatal(ip, "expected public:", isPublic)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// JSONDiffItem 一处JSON变更
+type JSONDiffItem struct {
+	Path   string      `json:"path"`   // 字段路径，比如 a.b[1].c，为空表示整个对象
+	Before interface{} `json:"before"` // 变更前的值
+	After  interface{} `json:"after"`  // 变更后的值
+}
+
+// DiffObjects 对比两个对象的变更
+// 对象会先被编码为JSON再进行对比，nil表示对象不存在
+func DiffObjects(before interface{}, after interface{}) ([]*JSONDiffItem, error) {
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return nil, err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return nil, err
+	}
+	return DiffJSON(beforeJSON, afterJSON)
+}
+
+// DiffJSON 对比两段JSON数据的变更
+func DiffJSON(beforeJSON []byte, afterJSON []byte) ([]*JSONDiffItem, error) {
+	var before interface{}
+	var after interface{}
+	if len(beforeJSON) > 0 {
+		err := json.Unmarshal(beforeJSON, &before)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(afterJSON) > 0 {
+		err := json.Unmarshal(afterJSON, &after)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result = []*JSONDiffItem{}
+	diffJSONValue("", before, after, &result)
+	return result, nil
+}
+
+func diffJSONValue(path string, before interface{}, after interface{}, result *[]*JSONDiffItem) {
+	switch beforeValue := before.(type) {
+	case map[string]interface{}:
+		afterValue, ok := after.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		var keys = []string{}
+		for k := range beforeValue {
+			keys = append(keys, k)
+		}
+		for k := range afterValue {
+			_, ok := beforeValue[k]
+			if !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			var subPath = k
+			if len(path) > 0 {
+				subPath = path + "." + k
+			}
+			diffJSONValue(subPath, beforeValue[k], afterValue[k], result)
+		}
+		return
+	case []interface{}:
+		afterValue, ok := after.([]interface{})
+		if !ok {
+			break
+		}
+
+		var l = len(beforeValue)
+		if len(afterValue) > l {
+			l = len(afterValue)
+		}
+		for i := 0; i < l; i++ {
+			var beforeItem interface{}
+			var afterItem interface{}
+			if i < len(beforeValue) {
+				beforeItem = beforeValue[i]
+			}
+			if i < len(afterValue) {
+				afterItem = afterValue[i]
+			}
+			diffJSONValue(path+"["+strconv.Itoa(i)+"]", beforeItem, afterItem, result)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*result = append(*result, &JSONDiffItem{
+			Path:   path,
+			Before: before,
+			After:  after,
+		})
+	}
+}
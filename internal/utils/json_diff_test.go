@@ -0,0 +1,44 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	items, err := DiffJSON([]byte(`{"name":"a","ports":[80,443],"ssl":{"isOn":false}}`), []byte(`{"name":"b","ports":[80],"ssl":{"isOn":true},"remark":"new"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 4 {
+		t.Fatal("expect 4 items, but got", len(items))
+	}
+	for _, item := range items {
+		itemJSON, _ := json.Marshal(item)
+		t.Log(string(itemJSON))
+	}
+}
+
+func TestDiffObjects(t *testing.T) {
+	{
+		items, err := DiffObjects(nil, map[string]interface{}{"name": "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 || items[0].Path != "" {
+			t.Fatal("should be one item for the whole object")
+		}
+	}
+
+	{
+		items, err := DiffObjects(map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 0 {
+			t.Fatal("should not have changes")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package utils
+
+import (
+	"strings"
+)
+
+// JSONRedactedValue 敏感字段被替换后的值
+const JSONRedactedValue = "******"
+
+// 字段名中包含这些片段时认为是敏感字段，比较时不区分大小写
+var jsonSecretKeyParts = []string{"secret", "password", "token", "accesskey", "apikey", "privatekey"}
+
+// 这些字段下的所有值都认为是敏感数据，比如认证Header
+var jsonSecretContainerKeys = []string{"headers"}
+
+// RedactJSONSecrets 将解码后的JSON数据中的密钥、密码、令牌和Header等敏感字段替换为掩码
+// 空值保持不变，以便仍然可以看出是否设置过；返回新的数据，不会修改原数据
+func RedactJSONSecrets(value interface{}) interface{} {
+	return redactJSONValue(value, false)
+}
+
+func redactJSONValue(value interface{}, isSecret bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var result = map[string]interface{}{}
+		for key, item := range v {
+			result[key] = redactJSONValue(item, isSecret || isJSONSecretKey(key))
+		}
+		return result
+	case []interface{}:
+		var result = make([]interface{}, 0, len(v))
+		for _, item := range v {
+			result = append(result, redactJSONValue(item, isSecret))
+		}
+		return result
+	case string:
+		if isSecret && len(v) > 0 {
+			return JSONRedactedValue
+		}
+		return v
+	case nil:
+		return nil
+	default:
+		if isSecret {
+			return JSONRedactedValue
+		}
+		return v
+	}
+}
+
+func isJSONSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, containerKey := range jsonSecretContainerKeys {
+		if key == containerKey {
+			return true
+		}
+	}
+	for _, part := range jsonSecretKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRedactJSONSecrets(t *testing.T) {
+	var value interface{}
+	err := json.Unmarshal([]byte(`{
+		"storageType": "s3",
+		"s3": {"bucket": "logs", "accessKeyId": "AKID", "accessKeySecret": "SECRET", "prefix": ""},
+		"otlp": {"endpoint": "http://127.0.0.1:4318", "headers": {"Authorization": "Bearer abc", "X-Tenant": "1"}},
+		"users": [{"name": "a", "password": "123"}, {"name": "b", "password": ""}]
+	}`), &value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resultJSON, err := json.Marshal(RedactJSONSecrets(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(string(resultJSON))
+
+	var expected = `{"otlp":{"endpoint":"http://127.0.0.1:4318","headers":{"Authorization":"******","X-Tenant":"******"}},"s3":{"accessKeyId":"******","accessKeySecret":"******","bucket":"logs","prefix":""},"storageType":"s3","users":[{"name":"a","password":"******"},{"name":"b","password":""}]}`
+	if string(resultJSON) != expected {
+		t.Fatal("unexpected result:", string(resultJSON))
+	}
+
+	// 原数据不应被修改
+	if value.(map[string]interface{})["s3"].(map[string]interface{})["accessKeySecret"] != "SECRET" {
+		t.Fatal("original value should not be changed")
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package objectstorage
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Storage 对象存储接口
+type Storage interface {
+	// Put 写入对象，reader需要支持Seek以便计算校验值和重试
+	Put(key string, reader io.ReadSeeker, size int64) error
+
+	// Get 读取对象，不存在时返回 ErrNotFound
+	Get(key string) (io.ReadCloser, error)
+
+	// GetRange 读取对象的一部分，从offset开始最多读取size个字节
+	GetRange(key string, offset int64, size int64) (io.ReadCloser, error)
+
+	// Delete 删除对象，不存在时不返回错误
+	Delete(key string) error
+}
+
+// 检查对象名，防止访问存储之外的路径
+func checkKey(key string) error {
+	if len(key) == 0 {
+		return errors.New("key should not be empty")
+	}
+	if strings.HasPrefix(key, "/") {
+		return errors.New("invalid key '" + key + "'")
+	}
+	for _, piece := range strings.Split(key, "/") {
+		if len(piece) == 0 || piece == "." || piece == ".." {
+			return errors.New("invalid key '" + key + "'")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package objectstorage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalStorage 本地目录存储
+type LocalStorage struct {
+	dir string
+}
+
+// NewLocalStorage 获取新对象
+func NewLocalStorage(dir string) *LocalStorage {
+	return &LocalStorage{dir: dir}
+}
+
+// Put 写入对象，先写入临时文件再改名，以免留下不完整的文件
+func (this *LocalStorage) Put(key string, reader io.ReadSeeker, size int64) error {
+	path, err := this.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	var tmpPath = path + ".tmp"
+	fp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fp, reader)
+	if err != nil {
+		_ = fp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	err = fp.Sync()
+	if err != nil {
+		_ = fp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	err = fp.Close()
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Get 读取对象
+func (this *LocalStorage) Get(key string) (io.ReadCloser, error) {
+	path, err := this.path(key)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return fp, nil
+}
+
+// GetRange 读取对象的一部分
+func (this *LocalStorage) GetRange(key string, offset int64, size int64) (io.ReadCloser, error) {
+	reader, err := this.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	var fp = reader.(*os.File)
+	_, err = fp.Seek(offset, io.SeekStart)
+	if err != nil {
+		_ = fp.Close()
+		return nil, err
+	}
+	return &limitedReadCloser{
+		Reader: io.LimitReader(fp, size),
+		Closer: fp,
+	}, nil
+}
+
+// Delete 删除对象
+func (this *LocalStorage) Delete(key string) error {
+	path, err := this.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (this *LocalStorage) path(key string) (string, error) {
+	err := checkKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(this.dir, filepath.FromSlash(key)), nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
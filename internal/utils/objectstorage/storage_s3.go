@@ -0,0 +1,313 @@
+// Copyright 2021 Liuxiangchao iwind.liu@gmail.com. All rights reserved.
+
+package objectstorage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Config S3兼容的对象存储设置
+type S3Config struct {
+	Endpoint        string `json:"endpoint"`        // 服务地址，比如 https://s3.amazonaws.com
+	Region          string `json:"region"`          // 区域，为空表示 us-east-1
+	Bucket          string `json:"bucket"`          // 存储桶
+	AccessKeyId     string `json:"accessKeyId"`     // AccessKey ID
+	AccessKeySecret string `json:"accessKeySecret"` // AccessKey密钥
+	PathStyle       bool   `json:"pathStyle"`       // 是否使用路径风格的地址，MinIO等通常需要开启
+	Prefix          string `json:"prefix"`          // 对象名前缀
+}
+
+// S3Storage S3兼容的对象存储
+// 使用AWS Signature Version 4签名，支持AWS S3、MinIO等
+type S3Storage struct {
+	config *S3Config
+	client *http.Client
+}
+
+// NewS3Storage 获取新对象
+func NewS3Storage(config *S3Config) *S3Storage {
+	return &S3Storage{
+		config: config,
+		client: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+	}
+}
+
+// Put 写入对象
+func (this *S3Storage) Put(key string, reader io.ReadSeeker, size int64) error {
+	// 计算内容的SHA256
+	var hash = sha256.New()
+	_, err := io.Copy(hash, reader)
+	if err != nil {
+		return err
+	}
+	_, err = reader.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	req, err := this.newRequest(http.MethodPut, key, ioutil.NopCloser(reader))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := this.do(req, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return this.responseError(resp)
+	}
+	return nil
+}
+
+// Get 读取对象
+func (this *S3Storage) Get(key string) (io.ReadCloser, error) {
+	req, err := this.newRequest(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := this.do(req, s3EmptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		return nil, this.responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+// GetRange 读取对象的一部分
+func (this *S3Storage) GetRange(key string, offset int64, size int64) (io.ReadCloser, error) {
+	if offset < 0 || size <= 0 {
+		return nil, errors.New("invalid range")
+	}
+	req, err := this.newRequest(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-"+strconv.FormatInt(offset+size-1, 10))
+	resp, err := this.do(req, s3EmptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		return nil, this.responseError(resp)
+	}
+
+	// 服务端不支持Range时会返回完整内容
+	if resp.StatusCode == http.StatusOK && offset > 0 {
+		_, err = io.CopyN(ioutil.Discard, resp.Body, offset)
+		if err != nil {
+			_ = resp.Body.Close()
+			return nil, err
+		}
+	}
+	return &limitedReadCloser{
+		Reader: io.LimitReader(resp.Body, size),
+		Closer: resp.Body,
+	}, nil
+}
+
+// Delete 删除对象
+func (this *S3Storage) Delete(key string) error {
+	req, err := this.newRequest(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := this.do(req, s3EmptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return this.responseError(resp)
+	}
+	return nil
+}
+
+func (this *S3Storage) newRequest(method string, key string, body io.ReadCloser) (*http.Request, error) {
+	err := checkKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(this.config.Endpoint, "/"))
+	if err != nil {
+		return nil, errors.New("invalid endpoint: " + err.Error())
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, errors.New("invalid endpoint '" + this.config.Endpoint + "', should start with 'http://' or 'https://'")
+	}
+
+	var objectKey = key
+	var prefix = strings.Trim(this.config.Prefix, "/")
+	if len(prefix) > 0 {
+		objectKey = prefix + "/" + key
+	}
+
+	var u = &url.URL{
+		Scheme: endpoint.Scheme,
+		Host:   endpoint.Host,
+	}
+	if this.config.PathStyle {
+		u.Path = endpoint.Path + "/" + this.config.Bucket + "/" + objectKey
+	} else {
+		u.Host = this.config.Bucket + "." + endpoint.Host
+		u.Path = endpoint.Path + "/" + objectKey
+	}
+	u.RawPath = s3EscapePath(u.Path)
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Body = body
+	}
+	return req, nil
+}
+
+func (this *S3Storage) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	var region = this.config.Region
+	if len(region) == 0 {
+		region = "us-east-1"
+	}
+	s3SignRequest(req, payloadHash, this.config.AccessKeyId, this.config.AccessKeySecret, region, time.Now())
+	return this.client.Do(req)
+}
+
+func (this *S3Storage) responseError(resp *http.Response) error {
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return errors.New("s3 response status '" + strconv.Itoa(resp.StatusCode) + "': " + string(data))
+}
+
+// 使用AWS Signature Version 4签名请求
+// 签名包含host、range、content-type、content-md5和所有x-amz-*头部
+func s3SignRequest(req *http.Request, payloadHash string, accessKeyId string, accessKeySecret string, region string, t time.Time) {
+	var amzDate = t.UTC().Format("20060102T150405Z")
+	var dateStamp = t.UTC().Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// 需要签名的头部
+	var headerMap = map[string]string{
+		"host": req.URL.Host,
+	}
+	for name, values := range req.Header {
+		var lowerName = strings.ToLower(name)
+		if strings.HasPrefix(lowerName, "x-amz-") || lowerName == "range" || lowerName == "content-type" || lowerName == "content-md5" {
+			headerMap[lowerName] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	var headerNames = []string{}
+	for name := range headerMap {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+
+	var canonicalHeaders = ""
+	for _, name := range headerNames {
+		canonicalHeaders += name + ":" + headerMap[name] + "\n"
+	}
+	var signedHeaders = strings.Join(headerNames, ";")
+
+	var canonicalURI = req.URL.EscapedPath()
+	if len(canonicalURI) == 0 {
+		canonicalURI = "/"
+	}
+	var canonicalRequest = strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	var scope = dateStamp + "/" + region + "/s3/aws4_request"
+	var requestHash = sha256.Sum256([]byte(canonicalRequest))
+	var stringToSign = "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	var signingKey = s3HMAC([]byte("AWS4"+accessKeySecret), dateStamp)
+	signingKey = s3HMAC(signingKey, region)
+	signingKey = s3HMAC(signingKey, "s3")
+	signingKey = s3HMAC(signingKey, "aws4_request")
+	var signature = hex.EncodeToString(s3HMAC(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyId+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	var h = hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	var keys = []string{}
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pieces = []string{}
+	for _, key := range keys {
+		var values = query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pieces = append(pieces, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(pieces, "&")
+}
+
+// 按照S3的要求编码路径，除了未保留字符和'/'外都需要编码
+func s3EscapePath(path string) string {
+	return s3Escape(path, false)
+}
+
+func s3Escape(s string, encodeSlash bool) string {
+	var builder = strings.Builder{}
+	for _, b := range []byte(s) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !encodeSlash) {
+			builder.WriteByte(b)
+		} else {
+			builder.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{b})))
+		}
+	}
+	return builder.String()
+}